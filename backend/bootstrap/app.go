@@ -27,6 +27,11 @@ type ServiceContainer struct {
 	PPTXGenerator            *services.PPTXGenerator // TASK-161
 	SemanticLayerService     *services.SemanticLayerService
 	ModelingService          *services.ModelingService
+	MetricRegistryService    *services.MetricRegistryService
+	SemanticLayerV2Service   *services.SemanticLayerV2Service
+	SemanticDrillService     *services.SemanticDrillService
+	SemanticQueryService     *services.SemanticQueryService
+	KPIService               *services.KPIService
 	RateLimiterService       *services.RateLimiter
 	UsageTrackerService      *services.UsageTracker
 	CronService              *services.CronService
@@ -59,6 +64,7 @@ type ServiceContainer struct {
 	AuthService              *services.AuthService
 	OAuthService             *services.OAuthService
 	MaterializedViewService  *services.MaterializedViewService
+	ExtractService           *services.ExtractService
 	AlertNotificationService *services.AlertNotificationService
 	AlertService             *services.AlertService
 	OrganizationService      *services.OrganizationService
@@ -67,11 +73,13 @@ type ServiceContainer struct {
 	ScheduledReportService   *services.ScheduledReportService
 	SecurityLogService       *services.SecurityLogService
 
-	SystemHealthService *services.SystemHealthService
-	PulseService        *services.PulseService      // TASK-156
-	ScreenshotService   *services.ScreenshotService // TASK-156
-	FormulaEngine       *formula_engine.FormulaEngine
-	RedisCache          *services.RedisCache
+	SystemHealthService          *services.SystemHealthService
+	PulseService                 *services.PulseService      // TASK-156
+	ScreenshotService            *services.ScreenshotService // TASK-156
+	FormulaEngine                *formula_engine.FormulaEngine
+	FormulaFunctionService       *services.FormulaFunctionService
+	CalculatedFieldImpactService *services.CalculatedFieldImpactService
+	RedisCache                   *services.RedisCache
 }
 
 // NewApp initializes the entire application
@@ -20,15 +20,23 @@ func InitHandlers(svc *ServiceContainer) *routes.HandlerContainer {
 	visualQueryHandler := handlers.NewVisualQueryHandler(database.DB, svc.QueryBuilder, svc.QueryExecutor, svc.SchemaDiscovery, svc.QueryCache)
 	connectionHandler := handlers.NewConnectionHandler(svc.QueryExecutor, svc.SchemaDiscovery, svc.EmbeddingService)
 	queryHandler := handlers.NewQueryHandler(svc.QueryExecutor, svc.QueryCache)
+	queryHandler.SetQueryBuilder(svc.QueryBuilder)
 	queryAnalyzerHandler := handlers.NewQueryAnalyzerHandler(database.DB, svc.QueryExecutor)
 
 	materializedViewHandler := handlers.NewMaterializedViewHandler(database.DB, svc.MaterializedViewService)
+	extractHandler := handlers.NewExtractHandler(database.DB, svc.ExtractService)
 	engineHandler := handlers.NewEngineHandler(svc.EngineService)
 	geoJSONHandler := handlers.NewGeoJSONHandler(svc.GeoJSONService)
 	dataGovernanceHandler := handlers.NewDataGovernanceHandler(svc.DataGovernanceService)
 
 	semanticLayerHandler := handlers.NewSemanticLayerHandler(svc.SemanticLayerService)
+	semanticLayerHandler.SetSemanticQueryService(svc.SemanticQueryService)
+	semanticQueryHandler := handlers.NewSemanticQueryHandler(svc.SemanticQueryService, svc.SemanticLayerV2Service)
+	semanticDrillHandler := handlers.NewSemanticDrillHandler(svc.SemanticDrillService)
+	kpiHandler := handlers.NewKPIHandler(svc.KPIService, svc.SemanticLayerV2Service)
+	semanticCalendarHandler := handlers.NewSemanticCalendarHandler(svc.SemanticLayerV2Service)
 	modelingHandler := handlers.NewModelingHandler(svc.ModelingService)
+	metricRegistryHandler := handlers.NewMetricRegistryHandler(svc.MetricRegistryService)
 
 	dashboardHandler := handlers.NewDashboardHandler()
 	dashboardCardHandler := handlers.NewDashboardCardHandler()
@@ -84,6 +92,10 @@ func InitHandlers(svc *ServiceContainer) *routes.HandlerContainer {
 	lineageController := controllers.NewLineageController()
 	permissionHandler := handlers.NewPermissionHandler(database.DB)
 	formulaHandler := handlers.NewFormulaHandler(svc.FormulaEngine) // GAP-004
+	formulaHandler.SetFunctionService(svc.FormulaFunctionService)
+	formulaHandler.SetAutocomplete(services.NewFormulaAutocomplete(database.DB))
+	formulaFunctionHandler := handlers.NewFormulaFunctionHandler(svc.FormulaFunctionService)
+	calculatedFieldHandler := handlers.NewCalculatedFieldHandler(svc.CalculatedFieldImpactService)
 
 	return &routes.HandlerContainer{
 		AIHandler:    aiHandler,
@@ -93,16 +105,24 @@ func InitHandlers(svc *ServiceContainer) *routes.HandlerContainer {
 
 		PermissionHandler:       permissionHandler,
 		FormulaHandler:          formulaHandler, // GAP-004
+		FormulaFunctionHandler:  formulaFunctionHandler,
+		CalculatedFieldHandler:  calculatedFieldHandler,
 		QueryHandler:            queryHandler,
 		VisualQueryHandler:      visualQueryHandler,
 		ConnectionHandler:       connectionHandler,
 		QueryAnalyzerHandler:    queryAnalyzerHandler,
 		MaterializedViewHandler: materializedViewHandler,
+		ExtractHandler:          extractHandler,
 		EngineHandler:           engineHandler,
 		GeoJSONHandler:          geoJSONHandler,
 		DataGovernanceHandler:   dataGovernanceHandler,
 		SemanticLayerHandler:    semanticLayerHandler,
+		SemanticDrillHandler:    semanticDrillHandler,
+		KPIHandler:              kpiHandler,
+		SemanticCalendarHandler: semanticCalendarHandler,
+		SemanticQueryHandler:    semanticQueryHandler,
 		ModelingHandler:         modelingHandler,
+		MetricRegistryHandler:   metricRegistryHandler,
 		DashboardHandler:        dashboardHandler,
 		DashboardCardHandler:    dashboardCardHandler,
 		NotificationHandler:     notificationHandler,
@@ -1,8 +1,10 @@
 package bootstrap
 
 import (
+	"context"
 	"fmt"
 	"insight-engine-backend/database"
+	"insight-engine-backend/models"
 	"insight-engine-backend/pkg/resilience"
 	"insight-engine-backend/services"
 	"insight-engine-backend/services/formula_engine"
@@ -56,7 +58,6 @@ func InitServices() *ServiceContainer {
 	// Cron & Scheduler
 	cronService := services.NewCronService(database.DB)
 	cronService.SetPulseService(pulseService) // Inject PulseService
-	cronService.Start()
 
 	schedulerService := services.NewSchedulerService(database.DB)
 	schedulerService.Start()
@@ -99,6 +100,21 @@ func InitServices() *ServiceContainer {
 	circuitBreaker := resilience.NewCircuitBreaker(cbConfig)
 	queryOptimizer := services.NewQueryOptimizer()
 	queryExecutor := services.NewQueryExecutor(circuitBreaker, queryOptimizer, queryCache)
+	dataflowExecutor := services.NewDataflowExecutor(database.DB, queryExecutor)
+	services.GlobalJobQueue.SetDataflowExecutor(dataflowExecutor)
+	services.InitPipelineExecutor()
+	services.GlobalPipelineExecutor.SetQueryExecutor(queryExecutor)
+	services.GlobalPipelineExecutor.SetNotificationService(notificationService)
+
+	// Pipelines triggered by their upstreams and by files landing in watched directories
+	services.GlobalJobQueue.SetPipelineCompletionListener(func(execution *models.JobExecution) {
+		services.PipelineUpstreamSucceeded(services.UpstreamPipeline, execution.PipelineID, execution.ID)
+	})
+	dataflowExecutor.SetCompletionListener(func(run *models.DataflowRun) {
+		services.PipelineUpstreamSucceeded(services.UpstreamDataflow, run.DataflowID, run.ID)
+	})
+	pipelineFileWatcher := services.NewPipelineFileWatcher(30 * time.Second)
+	pipelineFileWatcher.Start()
 	queryQueueService := services.NewQueryQueueService(queryExecutor, 10)
 	schemaDiscovery := services.NewSchemaDiscovery(queryExecutor)
 	queryValidator := services.NewQueryValidator([]string{})
@@ -119,6 +135,11 @@ func InitServices() *ServiceContainer {
 
 	// Additional Features
 	materializedViewService := services.NewMaterializedViewService(database.DB, queryExecutor)
+	extractService := services.NewExtractService(database.DB, services.GlobalPipelineExecutor)
+	queryExecutor.SetExtractService(extractService)
+	if err := extractService.Start(); err != nil {
+		services.LogWarn("extract_start", "Failed to start extracts", map[string]interface{}{"error": err.Error()})
+	}
 	reportingService := services.NewReportingService()
 	forecastingService := services.NewForecastingService()
 	anomalyDetectionService := services.NewAnomalyDetectionService()
@@ -135,6 +156,39 @@ func InitServices() *ServiceContainer {
 
 	modelingService := services.NewModelingService(database.DB)
 
+	// Metric registry: canonical metrics shared by modeling, semantic layer, glossary and AI context
+	metricRegistryService := services.NewMetricRegistryService(database.DB)
+	if err := metricRegistryService.AutoMigrate(); err != nil {
+		services.LogWarn("metric_registry_migrate", "Failed to migrate metric registry tables", map[string]interface{}{"error": err})
+	} else if report, err := metricRegistryService.MigrateLegacyMetrics("", false); err != nil {
+		services.LogWarn("metric_registry_migrate", "Failed to convert legacy metrics", map[string]interface{}{"error": err})
+	} else if report.Created+report.Bound > 0 || len(report.Conflicts)+len(report.Invalid) > 0 {
+		services.LogInfo("metric_registry_migrate", "Converted legacy metrics into the registry", map[string]interface{}{
+			"created": report.Created, "bound": report.Bound, "conflicts": len(report.Conflicts), "invalid": len(report.Invalid),
+		})
+	}
+	modelingService.SetMetricRegistry(metricRegistryService)
+	semanticLayerService.SetMetricRegistry(metricRegistryService)
+	glossaryService.SetMetricRegistry(metricRegistryService)
+	aiService.SetMetricRegistry(metricRegistryService)
+
+	// Semantic Layer V2 (GAP-007) + drill execution
+	semanticLayerV2Service := services.NewSemanticLayerV2Service(database.DB)
+	if err := semanticLayerV2Service.AutoMigrateV2(); err != nil {
+		services.LogWarn("semantic_v2_migrate", "Failed to migrate semantic layer v2 tables", map[string]interface{}{"error": err})
+	}
+	semanticDrillService := services.NewSemanticDrillService(database.DB, semanticLayerV2Service, queryExecutor, rlsService)
+	semanticQueryService := services.NewSemanticQueryService(database.DB, semanticLayerV2Service, queryExecutor, rlsService, queryCache)
+	materializedViewService.SetRefreshListener(func(mvID string) {
+		if err := semanticQueryService.InvalidateMaterializedView(context.Background(), mvID); err != nil {
+			services.LogWarn("semantic_query_cache", "Failed to invalidate aggregate results", map[string]interface{}{"mv_id": mvID, "error": err.Error()})
+		}
+		services.PipelineUpstreamSucceeded(services.UpstreamMaterializedView, mvID, "")
+	})
+	kpiService := services.NewKPIService(database.DB, semanticLayerV2Service, queryExecutor, rlsService)
+	cronService.SetKPIService(kpiService)
+	cronService.Start() // Start once every service is injected
+
 	// Alerts
 	baseURL := os.Getenv("APP_BASE_URL")
 	if baseURL == "" {
@@ -148,6 +202,8 @@ func InitServices() *ServiceContainer {
 	scheduledReportService, err := services.NewScheduledReportService(database.DB, emailService, "./exports", baseURL)
 	if err != nil {
 		services.LogWarn("scheduled_report_init", "Failed to initialize scheduled report service", map[string]interface{}{"error": err})
+	} else {
+		scheduledReportService.SetKPIService(kpiService)
 	}
 
 	// System Health (GAP-003)
@@ -156,6 +212,15 @@ func InitServices() *ServiceContainer {
 	// Formula Engine (GAP-004)
 	formulaEngine := formula_engine.NewFormulaEngine()
 
+	// Workspace user-defined formula functions
+	formulaFunctionService := services.NewFormulaFunctionService(database.DB, formulaEngine)
+	if err := formulaFunctionService.AutoMigrate(); err != nil {
+		services.LogWarn("formula_functions_migrate", "Failed to migrate formula function tables", map[string]interface{}{"error": err})
+	}
+	queryBuilder.SetFormulaFunctionService(formulaFunctionService)
+	services.GlobalPipelineExecutor.SetFormulaFunctionService(formulaFunctionService)
+	calculatedFieldImpactService := services.NewCalculatedFieldImpactService(database.DB, formulaEngine)
+
 	return &ServiceContainer{
 		EncryptionService:  encryptionService,
 		EmbeddingService:   embeddingService,
@@ -167,6 +232,11 @@ func InitServices() *ServiceContainer {
 		PPTXGenerator:            pptxGenerator, // TASK-161
 		SemanticLayerService:     semanticLayerService,
 		ModelingService:          modelingService,
+		MetricRegistryService:    metricRegistryService,
+		SemanticLayerV2Service:   semanticLayerV2Service,
+		SemanticQueryService:     semanticQueryService,
+		SemanticDrillService:     semanticDrillService,
+		KPIService:               kpiService,
 		RateLimiterService:       rateLimiterService,
 		UsageTrackerService:      usageTrackerService,
 		CronService:              cronService,
@@ -199,6 +269,7 @@ func InitServices() *ServiceContainer {
 		AuthService:              authService,
 		OAuthService:             oauthService,
 		MaterializedViewService:  materializedViewService,
+		ExtractService:           extractService,
 		AlertNotificationService: alertNotificationService,
 		AlertService:             alertService,
 		OrganizationService:      organizationService,
@@ -211,7 +282,9 @@ func InitServices() *ServiceContainer {
 		PulseService:           pulseService,
 		ScreenshotService:      screenshotService,
 		// ...
-		FormulaEngine: formulaEngine, // GAP-004
-		RedisCache:    redisCache,
+		FormulaEngine:                formulaEngine, // GAP-004
+		FormulaFunctionService:       formulaFunctionService,
+		CalculatedFieldImpactService: calculatedFieldImpactService,
+		RedisCache:                   redisCache,
 	}
 }
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/datatypes"
+)
+
+// CalculatedFieldHandler reports the impact of editing calculated fields
+type CalculatedFieldHandler struct {
+	service *services.CalculatedFieldImpactService
+}
+
+// NewCalculatedFieldHandler creates a new CalculatedFieldHandler
+func NewCalculatedFieldHandler(service *services.CalculatedFieldImpactService) *CalculatedFieldHandler {
+	return &CalculatedFieldHandler{service: service}
+}
+
+// CalculatedFieldImpactRequest names the edited field; Formula is the
+// proposed formula, omitted to report on the field as it is
+type CalculatedFieldImpactRequest struct {
+	Field   string  `json:"field"`
+	Formula *string `json:"formula"`
+}
+
+func parseImpactRequest(c *fiber.Ctx) (*CalculatedFieldImpactRequest, error) {
+	var req CalculatedFieldImpactRequest
+	if err := c.BodyParser(&req); err != nil || req.Field == "" {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "field is required",
+		})
+	}
+	return &req, nil
+}
+
+// CardImpact godoc
+// @Summary Calculated field impact on a card
+// @Description List the calculated fields, cards and alerts affected by editing a card's calculated field
+// @Tags dashboards
+// @Accept json
+// @Produce json
+// @Param id path string true "Dashboard ID"
+// @Param cardId path string true "Card ID"
+// @Param request body CalculatedFieldImpactRequest true "Edited field"
+// @Success 200 {object} services.CalculatedFieldImpact
+// @Failure 400 {object} map[string]string
+// @Router /api/dashboards/{id}/cards/{cardId}/calculated-fields/impact [post]
+func (h *CalculatedFieldHandler) CardImpact(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userId").(string)
+
+	var dashboard models.Dashboard
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&dashboard).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Dashboard not found",
+		})
+	}
+	var card models.DashboardCard
+	if err := database.DB.Where("id = ? AND dashboard_id = ?", c.Params("cardId"), dashboard.ID).First(&card).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Card not found",
+		})
+	}
+
+	req, err := parseImpactRequest(c)
+	if req == nil {
+		return err
+	}
+	report, err := h.service.CardImpact(&card, req.Field, req.Formula)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(report)
+}
+
+// VisualQueryImpact godoc
+// @Summary Calculated field impact on a visual query
+// @Description List the calculated fields, cards and alerts affected by editing a visual query's calculated field
+// @Tags visual-queries
+// @Accept json
+// @Produce json
+// @Param id path string true "Visual query ID"
+// @Param request body CalculatedFieldImpactRequest true "Edited field"
+// @Success 200 {object} services.CalculatedFieldImpact
+// @Failure 400 {object} map[string]string
+// @Router /api/visual-queries/{id}/calculated-fields/impact [post]
+func (h *CalculatedFieldHandler) VisualQueryImpact(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var query models.VisualQuery
+	if err := database.DB.Where("id = ? AND user_id = ?", c.Params("id"), userID).First(&query).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Visual query not found",
+		})
+	}
+
+	req, err := parseImpactRequest(c)
+	if req == nil {
+		return err
+	}
+	report, err := h.service.VisualQueryImpact(&query, req.Field, req.Formula)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(report)
+}
+
+// encodeCardCalculatedFields validates the calculated fields sent with a card
+// and encodes them for storage; nil when the card has none
+func encodeCardCalculatedFields(raw interface{}) (datatypes.JSON, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var fields []models.CalculatedField
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if err := services.ValidateCalculatedFields(fields); err != nil {
+		return nil, err
+	}
+	return datatypes.JSON(data), nil
+}
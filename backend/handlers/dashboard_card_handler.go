@@ -64,6 +64,7 @@ func (h *DashboardCardHandler) AddCard(c *fiber.Ctx) error {
 		VisualizationConfig map[string]interface{} `json:"visualizationConfig"`
 		Type                *string                `json:"type"`
 		TextContent         *string                `json:"textContent"`
+		CalculatedFields    interface{}            `json:"calculatedFields"`
 	}
 
 	req := new(AddCardRequest)
@@ -97,6 +98,14 @@ func (h *DashboardCardHandler) AddCard(c *fiber.Ctx) error {
 		vizConfigJSON = datatypes.JSON(vizBytes)
 	}
 
+	calculatedFieldsJSON, err := encodeCardCalculatedFields(req.CalculatedFields)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"success": false,
+			"error":   err.Error(),
+		})
+	}
+
 	cardType := "visualization"
 	if req.Type != nil {
 		cardType = *req.Type
@@ -126,6 +135,7 @@ func (h *DashboardCardHandler) AddCard(c *fiber.Ctx) error {
 		TextContent:         req.TextContent,
 		Position:            datatypes.JSON(positionJSON),
 		VisualizationConfig: vizConfigJSON,
+		CalculatedFields:    calculatedFieldsJSON,
 	}
 
 	if err := database.DB.Create(&card).Error; err != nil {
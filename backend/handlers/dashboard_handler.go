@@ -173,6 +173,21 @@ func (h *DashboardHandler) UpdateDashboard(c *fiber.Ctx) error {
 
 	// Check if this is a layout update (cards array present)
 	if cards, hasCards := body["cards"].([]interface{}); hasCards {
+		// Validate calculated fields before replacing any card
+		calculatedFields := make([]datatypes.JSON, len(cards))
+		for i, cardData := range cards {
+			cardMap, _ := cardData.(map[string]interface{})
+			fieldsJSON, err := encodeCardCalculatedFields(cardMap["calculatedFields"])
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"status":  "error",
+					"message": "Invalid calculated fields",
+					"error":   err.Error(),
+				})
+			}
+			calculatedFields[i] = fieldsJSON
+		}
+
 		// Update metadata first if provided
 		updates := make(map[string]interface{})
 		if name, ok := body["name"].(string); ok {
@@ -202,7 +217,7 @@ func (h *DashboardHandler) UpdateDashboard(c *fiber.Ctx) error {
 		database.DB.Where("dashboard_id = ?", dashboardID).Delete(&models.DashboardCard{})
 
 		// Create new cards
-		for _, cardData := range cards {
+		for i, cardData := range cards {
 			cardMap := cardData.(map[string]interface{})
 
 			var queryID *uuid.UUID
@@ -234,6 +249,7 @@ func (h *DashboardHandler) UpdateDashboard(c *fiber.Ctx) error {
 				Title:               title,
 				Position:            datatypes.JSON(positionJSON),
 				VisualizationConfig: vizConfigJSON,
+				CalculatedFields:    calculatedFields[i],
 			}
 
 			if cardIDString, ok := cardMap["id"].(string); ok && cardIDString != "" {
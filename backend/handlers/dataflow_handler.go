@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"insight-engine-backend/database"
 	"insight-engine-backend/models"
 	"insight-engine-backend/services"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // GetDataflows returns all dataflows for a user (with optional pagination)
@@ -19,8 +22,8 @@ func GetDataflows(c *fiber.Ctx) error {
 	offset := c.QueryInt("offset", 0)
 
 	var dataflows []models.Dataflow
-	query := database.DB.Where("user_id = ?", userID).
-		Order("created_at DESC") // Consistent ordering for pagination
+	query := database.DB.Where(`"userId" = ?`, userID).
+		Order(`"createdAt" DESC`) // Consistent ordering for pagination
 
 	// Backward compatibility: If no pagination params, return old format
 	if limit == 0 {
@@ -33,7 +36,7 @@ func GetDataflows(c *fiber.Ctx) error {
 	// Paginated response
 	var total int64
 	if err := database.DB.Model(&models.Dataflow{}).
-		Where("user_id = ?", userID).
+		Where(`"userId" = ?`, userID).
 		Count(&total).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
@@ -98,7 +101,7 @@ func UpdateDataflow(c *fiber.Ctx) error {
 
 	// Find existing dataflow and verify ownership
 	var dataflow models.Dataflow
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&dataflow).Error; err != nil {
+	if err := database.DB.Where(`id = ? AND "userId" = ?`, id, userID).First(&dataflow).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
 	}
 
@@ -144,7 +147,7 @@ func DeleteDataflow(c *fiber.Ctx) error {
 
 	// Find existing dataflow and verify ownership
 	var dataflow models.Dataflow
-	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&dataflow).Error; err != nil {
+	if err := database.DB.Where(`id = ? AND "userId" = ?`, id, userID).First(&dataflow).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
 	}
 
@@ -185,14 +188,214 @@ func RunDataflow(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Enqueue job for background processing
+	enqueueDataflowRun(&run)
+
+	return c.Status(201).JSON(run)
+}
+
+// enqueueDataflowRun hands a PENDING run to the job queue; the job ID is the run ID
+func enqueueDataflowRun(run *models.DataflowRun) {
 	services.GlobalJobQueue.Enqueue(services.Job{
 		ID:        run.ID,
 		Type:      services.JobTypeDataflow,
-		EntityID:  dataflowID,
+		EntityID:  run.DataflowID,
 		CreatedAt: time.Now(),
 		Retries:   0,
 	})
+}
+
+// findUserDataflow loads a dataflow owned by the current user
+func findUserDataflow(c *fiber.Ctx) (*models.Dataflow, error) {
+	userID := c.Locals("userID").(string)
+	var dataflow models.Dataflow
+	if err := database.DB.Where(`id = ? AND "userId" = ?`, c.Params("id"), userID).First(&dataflow).Error; err != nil {
+		return nil, err
+	}
+	return &dataflow, nil
+}
+
+// GetDataflowSteps returns the steps of a dataflow in order
+func GetDataflowSteps(c *fiber.Ctx) error {
+	dataflow, err := findUserDataflow(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
+	}
+
+	var steps []models.DataflowStep
+	if err := database.DB.Where(`"dataflowId" = ?`, dataflow.ID).Order(`"order" ASC`).Find(&steps).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(steps)
+}
+
+// UpdateDataflowSteps replaces the steps of a dataflow. The steps are
+// validated as a whole (types, settings, inputs, cycles) before any is saved.
+func UpdateDataflowSteps(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	dataflow, err := findUserDataflow(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
+	}
+
+	var input []struct {
+		ID     string          `json:"id"`
+		Name   string          `json:"name"`
+		Type   string          `json:"type"`
+		Config json.RawMessage `json:"config"`
+	}
+	if err := c.BodyParser(&input); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	now := time.Now()
+	steps := make([]models.DataflowStep, len(input))
+	for i, in := range input {
+		id := in.ID
+		if id == "" {
+			id = uuid.New().String()
+		}
+		config := "{}"
+		if len(in.Config) > 0 {
+			// Config may be sent as an object or as its JSON string
+			var encoded string
+			if json.Unmarshal(in.Config, &encoded) == nil {
+				config = encoded
+			} else {
+				config = string(in.Config)
+			}
+		}
+		steps[i] = models.DataflowStep{
+			ID:         id,
+			DataflowID: dataflow.ID,
+			Order:      i,
+			Type:       strings.ToUpper(in.Type),
+			Name:       in.Name,
+			Config:     config,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+	}
+
+	if err := services.ValidateDataflowSteps(steps); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	for _, connectionID := range services.DataflowConnectionIDs(steps) {
+		var count int64
+		database.DB.Model(&models.Connection{}).Where("id = ? AND user_id = ?", connectionID, userID).Count(&count)
+		if count == 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Connection not found: " + connectionID})
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(`"dataflowId" = ?`, dataflow.ID).Delete(&models.DataflowStep{}).Error; err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			return nil
+		}
+		return tx.Create(&steps).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(steps)
+}
+
+// GetDataflowRuns returns the runs of a dataflow, newest first
+func GetDataflowRuns(c *fiber.Ctx) error {
+	dataflow, err := findUserDataflow(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	var runs []models.DataflowRun
+	if err := database.DB.Where(`"dataflowId" = ?`, dataflow.ID).
+		Order(`"startedAt" DESC`).
+		Limit(limit).
+		Find(&runs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(runs)
+}
+
+// GetDataflowRun returns a run with the status, row count, duration and
+// error of each step
+func GetDataflowRun(c *fiber.Ctx) error {
+	dataflow, err := findUserDataflow(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
+	}
+
+	var run models.DataflowRun
+	if err := database.DB.Where(`id = ? AND "dataflowId" = ?`, c.Params("runId"), dataflow.ID).First(&run).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Run not found"})
+	}
+	return c.JSON(fiber.Map{
+		"run":   run,
+		"steps": run.StepLogs().Steps,
+	})
+}
+
+// RetryDataflowRun starts a new run from the failed steps of a run; the
+// steps it completed are reused rather than executed again
+func RetryDataflowRun(c *fiber.Ctx) error {
+	dataflow, err := findUserDataflow(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
+	}
+
+	var failed models.DataflowRun
+	if err := database.DB.Where(`id = ? AND "dataflowId" = ?`, c.Params("runId"), dataflow.ID).First(&failed).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Run not found"})
+	}
+	if failed.Status != "FAILED" && failed.Status != "CANCELLED" {
+		return c.Status(409).JSON(fiber.Map{"error": "Only failed or cancelled runs can be retried"})
+	}
+
+	run := models.DataflowRun{
+		ID:         uuid.New().String(),
+		DataflowID: dataflow.ID,
+		Status:     "PENDING",
+		StartedAt:  time.Now(),
+	}
+	run.SetStepLogs(models.DataflowRunLogs{
+		RetryOf: failed.ID,
+		Steps:   failed.StepLogs().Steps,
+	})
+	if err := database.DB.Create(&run).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	enqueueDataflowRun(&run)
 
 	return c.Status(201).JSON(run)
 }
+
+// CancelDataflowRun cancels a queued or running run
+func CancelDataflowRun(c *fiber.Ctx) error {
+	dataflow, err := findUserDataflow(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Dataflow not found"})
+	}
+
+	var run models.DataflowRun
+	if err := database.DB.Where(`id = ? AND "dataflowId" = ?`, c.Params("runId"), dataflow.ID).First(&run).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Run not found"})
+	}
+	if run.Status != "PENDING" && run.Status != "RUNNING" {
+		return c.Status(409).JSON(fiber.Map{"error": "Run is not in progress"})
+	}
+
+	services.GlobalJobQueue.Cancel(run.ID)
+
+	// A run still in the queue never reaches the executor, so close it here;
+	// a running one is closed by the executor once its steps stop
+	now := time.Now()
+	database.DB.Model(&models.DataflowRun{}).
+		Where("id = ? AND status = ?", run.ID, "PENDING").
+		Updates(map[string]interface{}{"status": "CANCELLED", "completedAt": now})
+
+	return c.JSON(fiber.Map{"message": "Run cancellation requested"})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ExtractHandler handles API requests for extracts
+type ExtractHandler struct {
+	db      *gorm.DB
+	service *services.ExtractService
+}
+
+// NewExtractHandler creates a new extract handler
+func NewExtractHandler(db *gorm.DB, service *services.ExtractService) *ExtractHandler {
+	return &ExtractHandler{db: db, service: service}
+}
+
+// CreateExtractRequest represents the request to create an extract. A
+// queryId takes the connection and SQL of a saved query, so the cards using
+// it are answered from the extract.
+type CreateExtractRequest struct {
+	Name            string          `json:"name"`
+	SourceType      string          `json:"sourceType"` // CONNECTION (default) or REST_API
+	ConnectionID    string          `json:"connectionId"`
+	SourceQuery     string          `json:"sourceQuery"`
+	QueryID         string          `json:"queryId"`
+	SourceConfig    json.RawMessage `json:"sourceConfig"` // REST_API request, as for pipelines
+	Store           string          `json:"store"`        // INTERNAL (default) or EMBEDDED
+	RefreshMode     string          `json:"refreshMode"`  // full (default) or incremental
+	WatermarkColumn string          `json:"watermarkColumn"`
+	PrimaryKey      string          `json:"primaryKey"`
+	Schedule        string          `json:"schedule"` // cron expression (optional)
+}
+
+// findExtract loads an extract of the requesting user
+func (h *ExtractHandler) findExtract(c *fiber.Ctx) (*models.Extract, error) {
+	var extract models.Extract
+	err := h.db.Where(`id = ? AND "userId" = ?`, c.Params("id"), c.Locals("userId")).First(&extract).Error
+	if err != nil {
+		return nil, err
+	}
+	return &extract, nil
+}
+
+// CreateExtract handles POST /api/extracts
+func (h *ExtractHandler) CreateExtract(c *fiber.Ctx) error {
+	var req CreateExtractRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	userID := c.Locals("userId").(string)
+
+	if req.QueryID != "" {
+		var query models.SavedQuery
+		if err := h.db.Where("id = ? AND user_id = ?", req.QueryID, userID).First(&query).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Saved query not found"})
+		}
+		req.ConnectionID = query.ConnectionID
+		req.SourceQuery = query.SQL
+	}
+
+	extract := models.Extract{
+		UserID:          userID,
+		Name:            req.Name,
+		SourceType:      req.SourceType,
+		SourceQuery:     req.SourceQuery,
+		Store:           req.Store,
+		RefreshMode:     req.RefreshMode,
+		WatermarkColumn: req.WatermarkColumn,
+		PrimaryKey:      req.PrimaryKey,
+		Schedule:        req.Schedule,
+	}
+	if req.ConnectionID != "" {
+		extract.ConnectionID = &req.ConnectionID
+	}
+	if len(req.SourceConfig) > 0 {
+		config := string(req.SourceConfig)
+		extract.SourceConfig = &config
+	}
+	if err := services.ValidateExtract(&extract); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if extract.ConnectionID != nil {
+		var count int64
+		h.db.Model(&models.Connection{}).Where("id = ? AND user_id = ?", *extract.ConnectionID, userID).Count(&count)
+		if count == 0 {
+			return c.Status(404).JSON(fiber.Map{"error": "Connection not found"})
+		}
+	}
+
+	if err := h.service.CreateExtract(&extract); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(extract)
+}
+
+// ListExtracts handles GET /api/extracts
+func (h *ExtractHandler) ListExtracts(c *fiber.Ctx) error {
+	query := h.db.Where(`"userId" = ?`, c.Locals("userId"))
+	if connectionID := c.Query("connectionId"); connectionID != "" {
+		query = query.Where(`"connectionId" = ?`, connectionID)
+	}
+	var extracts []models.Extract
+	if err := query.Order("created_at DESC").Find(&extracts).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"extracts": extracts})
+}
+
+// GetExtract handles GET /api/extracts/:id
+func (h *ExtractHandler) GetExtract(c *fiber.Ctx) error {
+	extract, err := h.findExtract(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Extract not found"})
+	}
+	return c.JSON(extract)
+}
+
+// RefreshExtract handles POST /api/extracts/:id/refresh; ?full=true reloads
+// every row of an incremental extract
+func (h *ExtractHandler) RefreshExtract(c *fiber.Ctx) error {
+	extract, err := h.findExtract(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Extract not found"})
+	}
+	if err := h.service.RefreshExtract(extract.ID, c.QueryBool("full")); err != nil {
+		if errors.Is(err, services.ErrExtractRefreshing) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(202).JSON(fiber.Map{"message": "Extract refresh started"})
+}
+
+// UpdateExtractSchedule handles PUT /api/extracts/:id/schedule
+func (h *ExtractHandler) UpdateExtractSchedule(c *fiber.Ctx) error {
+	extract, err := h.findExtract(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Extract not found"})
+	}
+	var req struct {
+		Schedule string `json:"schedule"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if err := h.service.UpdateSchedule(extract, req.Schedule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(extract)
+}
+
+// DeleteExtract handles DELETE /api/extracts/:id
+func (h *ExtractHandler) DeleteExtract(c *fiber.Ctx) error {
+	extract, err := h.findExtract(c)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Extract not found"})
+	}
+	if err := h.service.DeleteExtract(c.Context(), extract); err != nil {
+		if errors.Is(err, services.ErrExtractRefreshing) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.SendStatus(204)
+}
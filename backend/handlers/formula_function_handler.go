@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// FormulaFunctionHandler exposes workspace user-defined formula functions
+type FormulaFunctionHandler struct {
+	service *services.FormulaFunctionService
+}
+
+// NewFormulaFunctionHandler creates a new FormulaFunctionHandler
+func NewFormulaFunctionHandler(service *services.FormulaFunctionService) *FormulaFunctionHandler {
+	return &FormulaFunctionHandler{service: service}
+}
+
+// FormulaFunctionRequest is the payload to create or update a function
+type FormulaFunctionRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Params      []string `json:"params"`
+	Body        string   `json:"body"`
+}
+
+// callerWorkspace returns the caller's workspace, rejecting callers outside it
+func (h *FormulaFunctionHandler) callerWorkspace(c *fiber.Ctx) (string, error) {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	if workspaceID == "" {
+		return "", c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Workspace ID is required",
+		})
+	}
+	userID, _ := c.Locals("userID").(string)
+	if !isMember(workspaceID, userID) {
+		return "", c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Access denied",
+		})
+	}
+	return workspaceID, nil
+}
+
+// loadWorkspaceFunction fetches a function of the caller's workspace
+func (h *FormulaFunctionHandler) loadWorkspaceFunction(c *fiber.Ctx) (*models.FormulaFunction, error) {
+	workspaceID, err := h.callerWorkspace(c)
+	if workspaceID == "" {
+		return nil, err
+	}
+	function, err := h.service.Get(c.Params("id"))
+	if err != nil || function.WorkspaceID != workspaceID {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Function not found",
+		})
+	}
+	return function, nil
+}
+
+// ListFunctions godoc
+// @Summary List formula functions
+// @Description List the user-defined formula functions of the workspace
+// @Tags formulas
+// @Produce json
+// @Success 200 {array} models.FormulaFunction
+// @Router /api/formula-functions [get]
+func (h *FormulaFunctionHandler) ListFunctions(c *fiber.Ctx) error {
+	workspaceID, err := h.callerWorkspace(c)
+	if workspaceID == "" {
+		return err
+	}
+	functions, err := h.service.List(workspaceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve functions",
+		})
+	}
+	return c.JSON(functions)
+}
+
+// GetFunction godoc
+// @Summary Get formula function
+// @Tags formulas
+// @Produce json
+// @Param id path string true "Function ID"
+// @Success 200 {object} models.FormulaFunction
+// @Failure 404 {object} map[string]string
+// @Router /api/formula-functions/{id} [get]
+func (h *FormulaFunctionHandler) GetFunction(c *fiber.Ctx) error {
+	function, err := h.loadWorkspaceFunction(c)
+	if function == nil {
+		return err
+	}
+	return c.JSON(function)
+}
+
+// CreateFunction godoc
+// @Summary Create formula function
+// @Description Define a function in the formula language, e.g. FISCAL_QUARTER(date)
+// @Tags formulas
+// @Accept json
+// @Produce json
+// @Param function body FormulaFunctionRequest true "Function definition"
+// @Success 201 {object} models.FormulaFunction
+// @Failure 400 {object} map[string]string
+// @Router /api/formula-functions [post]
+func (h *FormulaFunctionHandler) CreateFunction(c *fiber.Ctx) error {
+	workspaceID, err := h.callerWorkspace(c)
+	if workspaceID == "" {
+		return err
+	}
+
+	var req FormulaFunctionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	function := &models.FormulaFunction{
+		WorkspaceID: workspaceID,
+		Name:        req.Name,
+		Description: req.Description,
+		Body:        req.Body,
+		CreatedBy:   c.Locals("userID").(string),
+	}
+	function.SetParamNames(req.Params)
+	if err := h.service.Create(function); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(function)
+}
+
+// UpdateFunction godoc
+// @Summary Update formula function
+// @Description Update a function and record a new version; rejected if it breaks a function that calls it
+// @Tags formulas
+// @Accept json
+// @Produce json
+// @Param id path string true "Function ID"
+// @Param function body FormulaFunctionRequest true "Function definition"
+// @Success 200 {object} models.FormulaFunction
+// @Failure 400 {object} map[string]string
+// @Router /api/formula-functions/{id} [put]
+func (h *FormulaFunctionHandler) UpdateFunction(c *fiber.Ctx) error {
+	function, err := h.loadWorkspaceFunction(c)
+	if function == nil {
+		return err
+	}
+
+	var req FormulaFunctionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	function.Name = req.Name
+	function.Description = req.Description
+	function.Body = req.Body
+	function.SetParamNames(req.Params)
+
+	if err := h.service.Update(function, c.Locals("userID").(string)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(function)
+}
+
+// DeleteFunction godoc
+// @Summary Delete formula function
+// @Tags formulas
+// @Param id path string true "Function ID"
+// @Success 204
+// @Failure 400 {object} map[string]string
+// @Router /api/formula-functions/{id} [delete]
+func (h *FormulaFunctionHandler) DeleteFunction(c *fiber.Ctx) error {
+	function, err := h.loadWorkspaceFunction(c)
+	if function == nil {
+		return err
+	}
+	if err := h.service.Delete(function.ID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListVersions godoc
+// @Summary List formula function versions
+// @Tags formulas
+// @Produce json
+// @Param id path string true "Function ID"
+// @Success 200 {array} models.FormulaFunctionVersion
+// @Router /api/formula-functions/{id}/versions [get]
+func (h *FormulaFunctionHandler) ListVersions(c *fiber.Ctx) error {
+	function, err := h.loadWorkspaceFunction(c)
+	if function == nil {
+		return err
+	}
+	versions, err := h.service.Versions(function.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve versions",
+		})
+	}
+	return c.JSON(versions)
+}
+
+// RestoreVersion godoc
+// @Summary Restore formula function version
+// @Description Make an earlier version current again, recorded as a new version
+// @Tags formulas
+// @Produce json
+// @Param id path string true "Function ID"
+// @Param version path int true "Version"
+// @Success 200 {object} models.FormulaFunction
+// @Failure 400 {object} map[string]string
+// @Router /api/formula-functions/{id}/versions/{version}/restore [post]
+func (h *FormulaFunctionHandler) RestoreVersion(c *fiber.Ctx) error {
+	function, err := h.loadWorkspaceFunction(c)
+	if function == nil {
+		return err
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid version",
+		})
+	}
+
+	restored, err := h.service.Restore(function.ID, version, c.Locals("userID").(string))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(restored)
+}
@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"fmt"
+	"insight-engine-backend/services"
 	"insight-engine-backend/services/formula_engine"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // FormulaHandler handles formula-related requests
 type FormulaHandler struct {
-	engine *formula_engine.FormulaEngine
+	engine       *formula_engine.FormulaEngine
+	functions    *services.FormulaFunctionService
+	autocomplete *services.FormulaAutocomplete
 }
 
 // NewFormulaHandler creates a new FormulaHandler
@@ -19,9 +23,33 @@ func NewFormulaHandler(engine *formula_engine.FormulaEngine) *FormulaHandler {
 	}
 }
 
+// SetFunctionService resolves the workspace's user-defined functions in
+// validated and evaluated formulas
+func (h *FormulaHandler) SetFunctionService(functions *services.FormulaFunctionService) {
+	h.functions = functions
+}
+
+// SetAutocomplete enables formula autocomplete suggestions
+func (h *FormulaHandler) SetAutocomplete(autocomplete *services.FormulaAutocomplete) {
+	h.autocomplete = autocomplete
+}
+
+// engineFor returns the engine for the caller's workspace
+func (h *FormulaHandler) engineFor(c *fiber.Ctx) (*formula_engine.FormulaEngine, error) {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	if h.functions == nil || workspaceID == "" {
+		return h.engine, nil
+	}
+	return h.functions.EngineFor(workspaceID)
+}
+
 // ValidateRequest represents the request body for validation
 type ValidateRequest struct {
 	Formula string `json:"formula"`
+	// Fields maps field names to catalog column types (e.g. "numeric", "varchar")
+	// or formula types ("number", "text", "date", "boolean"); when present the
+	// formula is type-checked against them
+	Fields map[string]string `json:"fields"`
 }
 
 // EvaluateRequest represents the request body for evaluation
@@ -44,7 +72,12 @@ func (h *FormulaHandler) Validate(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "formula is required"})
 	}
 
-	if err := h.engine.Validate(req.Formula); err != nil {
+	engine, err := h.engineFor(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := engine.Validate(req.Formula); err != nil {
 		return c.Status(fiber.StatusOK).JSON(fiber.Map{
 			"valid": false,
 			"error": err.Error(),
@@ -52,14 +85,41 @@ func (h *FormulaHandler) Validate(c *fiber.Ctx) error {
 	}
 
 	// Extract references to show what columns/cells are used
-	refs, _ := h.engine.ExtractReferences(req.Formula)
+	refs, _ := engine.ExtractReferences(req.Formula)
+
+	var fields map[string]formula_engine.ValueType
+	if req.Fields != nil {
+		fields = make(map[string]formula_engine.ValueType, len(req.Fields))
+		for name, typ := range req.Fields {
+			fields[name] = fieldValueType(typ)
+		}
+	}
+	result, err := engine.TypeCheck(req.Formula, fields)
+	if err != nil {
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"valid": false,
+			"error": err.Error(),
+		})
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"valid":      true,
+		"valid":      result.Valid(),
 		"references": refs,
+		"type":       result.Type,
+		"issues":     result.Issues,
 	})
 }
 
+// fieldValueType accepts either a formula type name or a catalog column type
+func fieldValueType(typ string) formula_engine.ValueType {
+	switch t := formula_engine.ValueType(strings.ToLower(typ)); t {
+	case formula_engine.TypeAny, formula_engine.TypeNumber, formula_engine.TypeText,
+		formula_engine.TypeBool, formula_engine.TypeDate:
+		return t
+	}
+	return formula_engine.TypeFromSQL(typ)
+}
+
 // Evaluate evaluates a formula with provided context
 func (h *FormulaHandler) Evaluate(c *fiber.Ctx) error {
 	var req EvaluateRequest
@@ -71,16 +131,23 @@ func (h *FormulaHandler) Evaluate(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "formula is required"})
 	}
 
+	engine, err := h.engineFor(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
 	// Build context
 	ctx := &formula_engine.FormulaContext{
 		FieldValues: req.Context,
 		CellValues:  make(map[string]interface{}), // Can be expanded if needed
 	}
 
-	result, err := h.engine.Evaluate(req.Formula, ctx)
+	result, err := engine.Evaluate(req.Formula, ctx)
 	if err != nil {
+		fe := formula_engine.AsFormulaError(err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
+			"code":  fe.Code,
 		})
 	}
 
@@ -89,9 +156,27 @@ func (h *FormulaHandler) Evaluate(c *fiber.Ctx) error {
 	})
 }
 
+// Autocomplete suggests built-in and workspace functions, operators and keywords
+func (h *FormulaHandler) Autocomplete(c *fiber.Ctx) error {
+	if h.autocomplete == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "autocomplete is not available"})
+	}
+	var req services.AutocompleteRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	req.WorkspaceID, _ = c.Locals("workspaceID").(string)
+
+	return c.Status(fiber.StatusOK).JSON(h.autocomplete.GetSuggestions(c.Context(), req))
+}
+
 // RegisterRoutes registers the formula routes
-func (h *FormulaHandler) RegisterRoutes(router fiber.Router) {
+func (h *FormulaHandler) RegisterRoutes(router fiber.Router, middlewares ...func(*fiber.Ctx) error) {
 	formulas := router.Group("/formulas")
+	for _, mw := range middlewares {
+		formulas.Use(mw)
+	}
 	formulas.Post("/validate", h.Validate)
 	formulas.Post("/evaluate", h.Evaluate)
+	formulas.Post("/autocomplete", h.Autocomplete)
 }
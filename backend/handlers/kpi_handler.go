@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"time"
+
+	"insight-engine-backend/database"
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// KPIHandler serves KPI definitions, evaluation, history, targets and scorecards
+type KPIHandler struct {
+	kpiService *services.KPIService
+	semanticV2 *services.SemanticLayerV2Service
+}
+
+// NewKPIHandler creates a new KPIHandler
+func NewKPIHandler(kpiService *services.KPIService, semanticV2 *services.SemanticLayerV2Service) *KPIHandler {
+	return &KPIHandler{kpiService: kpiService, semanticV2: semanticV2}
+}
+
+// kpiCaller loads the KPI of the request, which must belong to a model in a
+// workspace the caller is a member of
+func kpiCaller(c *fiber.Ctx) (*services.SemanticKPI, *fiber.Error) {
+	var kpi services.SemanticKPI
+	if err := database.DB.First(&kpi, "id = ?", c.Params("id")).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "KPI not found")
+	}
+	if ferr := modelCaller(c, kpi.ModelID); ferr != nil {
+		return nil, ferr
+	}
+	return &kpi, nil
+}
+
+// ListKPIs godoc
+// @Summary List model KPIs
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "Model ID"
+// @Success 200 {array} services.SemanticKPI
+// @Failure 403 {object} map[string]string
+// @Router /api/semantic/models/{id}/kpis [get]
+func (h *KPIHandler) ListKPIs(c *fiber.Ctx) error {
+	if ferr := modelCaller(c, c.Params("id")); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	kpis, err := h.semanticV2.ListKPIs(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve KPIs",
+		})
+	}
+	return c.JSON(kpis)
+}
+
+// CreateKPI godoc
+// @Summary Create KPI
+// @Description Define a KPI on a model metric, with its evaluation time column, schedule, parent KPI and target table
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param id path string true "Model ID"
+// @Param kpi body services.SemanticKPI true "KPI definition"
+// @Success 201 {object} services.SemanticKPI
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/semantic/models/{id}/kpis [post]
+func (h *KPIHandler) CreateKPI(c *fiber.Ctx) error {
+	if ferr := modelCaller(c, c.Params("id")); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	var kpi services.SemanticKPI
+	if err := c.BodyParser(&kpi); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	kpi.ID = ""
+	kpi.ModelID = c.Params("id")
+	kpi.LastEvaluatedAt = nil
+
+	if err := h.semanticV2.CreateKPI(&kpi); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(kpi)
+}
+
+// UpdateKPI godoc
+// @Summary Update KPI
+// @Description Update a KPI definition; fields missing from the body keep their values
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param id path string true "KPI ID"
+// @Param kpi body services.SemanticKPI true "KPI definition"
+// @Success 200 {object} services.SemanticKPI
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/semantic/kpis/{id} [put]
+func (h *KPIHandler) UpdateKPI(c *fiber.Ctx) error {
+	existing, ferr := kpiCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	kpi := *existing
+	if err := c.BodyParser(&kpi); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	kpi.ID = existing.ID
+	kpi.ModelID = existing.ModelID
+	kpi.LastEvaluatedAt = existing.LastEvaluatedAt
+	kpi.CreatedAt = existing.CreatedAt
+
+	if err := h.semanticV2.UpdateKPI(&kpi); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(kpi)
+}
+
+// GetScorecard godoc
+// @Summary Get KPI scorecard
+// @Description Get the KPI tree of a semantic model with latest values and rolled-up statuses
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "Model ID"
+// @Success 200 {object} services.KPIScorecard
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /api/semantic/models/{id}/scorecard [get]
+func (h *KPIHandler) GetScorecard(c *fiber.Ctx) error {
+	if ferr := modelCaller(c, c.Params("id")); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	scorecard, err := h.kpiService.BuildScorecard(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(scorecard)
+}
+
+// EvaluateKPI godoc
+// @Summary Evaluate KPI
+// @Description Resolve the KPI metric for the current period and store a snapshot
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "KPI ID"
+// @Success 200 {object} services.SemanticKPISnapshot
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/kpis/{id}/evaluate [post]
+func (h *KPIHandler) EvaluateKPI(c *fiber.Ctx) error {
+	kpi, ferr := kpiCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	userCtx, err := drillUserContext(c)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to load user roles",
+		})
+	}
+
+	snapshot, err := h.kpiService.EvaluateKPI(c.UserContext(), kpi.ID, time.Now(), userCtx)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(snapshot)
+}
+
+// GetHistory godoc
+// @Summary Get KPI history
+// @Description Get the actual vs target time series of a KPI
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "KPI ID"
+// @Param from query string false "Start date (YYYY-MM-DD)"
+// @Param to query string false "End date (YYYY-MM-DD)"
+// @Success 200 {array} services.SemanticKPISnapshot
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/kpis/{id}/history [get]
+func (h *KPIHandler) GetHistory(c *fiber.Ctx) error {
+	kpi, ferr := kpiCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	var from, to time.Time
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid from date"})
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid to date"})
+		}
+	}
+
+	history, err := h.kpiService.GetHistory(kpi.ID, from, to)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve KPI history",
+		})
+	}
+	return c.JSON(history)
+}
+
+// ListTargets godoc
+// @Summary List KPI targets
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "KPI ID"
+// @Success 200 {array} services.SemanticKPITarget
+// @Router /api/semantic/kpis/{id}/targets [get]
+func (h *KPIHandler) ListTargets(c *fiber.Ctx) error {
+	kpi, ferr := kpiCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	targets, err := h.kpiService.ListTargets(kpi.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve KPI targets",
+		})
+	}
+	return c.JSON(targets)
+}
+
+// SetTargets godoc
+// @Summary Replace manual KPI targets
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param id path string true "KPI ID"
+// @Param targets body []services.SemanticKPITarget true "Targets"
+// @Success 200 {array} services.SemanticKPITarget
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/kpis/{id}/targets [put]
+func (h *KPIHandler) SetTargets(c *fiber.Ctx) error {
+	kpi, ferr := kpiCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	var targets []services.SemanticKPITarget
+	if err := c.BodyParser(&targets); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := h.kpiService.SetTargets(kpi.ID, targets); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(targets)
+}
+
+// ImportTargets godoc
+// @Summary Import KPI targets from the configured target table
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "KPI ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/kpis/{id}/targets/import [post]
+func (h *KPIHandler) ImportTargets(c *fiber.Ctx) error {
+	kpi, ferr := kpiCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	count, err := h.kpiService.ImportTargetsFromTable(c.UserContext(), kpi.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"imported": count,
+	})
+}
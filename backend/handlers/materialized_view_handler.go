@@ -23,11 +23,12 @@ func NewMaterializedViewHandler(db *gorm.DB, service *services.MaterializedViewS
 
 // CreateMaterializedViewRequest represents the request to create a materialized view
 type CreateMaterializedViewRequest struct {
-	ConnectionID string `json:"connectionId"`
-	Name         string `json:"name"`
-	SourceQuery  string `json:"sourceQuery"`
-	RefreshMode  string `json:"refreshMode"` // "full" or "incremental"
-	Schedule     string `json:"schedule"`    // cron expression (optional)
+	ConnectionID string                 `json:"connectionId"`
+	Name         string                 `json:"name"`
+	SourceQuery  string                 `json:"sourceQuery"`
+	RefreshMode  string                 `json:"refreshMode"` // "full" or "incremental"
+	Schedule     string                 `json:"schedule"`    // cron expression (optional)
+	Metadata     map[string]interface{} `json:"metadata"`    // incremental settings: primary_keys, timestamp_column, lookback_seconds, deleted_column, tombstone_table, reconcile_every
 }
 
 // UpdateScheduleRequest represents the request to update refresh schedule
@@ -80,6 +81,7 @@ func (h *MaterializedViewHandler) CreateMaterializedView(c *fiber.Ctx) error {
 		req.SourceQuery,
 		req.RefreshMode,
 		req.Schedule,
+		req.Metadata,
 	)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -162,6 +164,33 @@ func (h *MaterializedViewHandler) RefreshMaterializedView(c *fiber.Ctx) error {
 	})
 }
 
+// GetDependencyChain handles GET /api/materialized-views/:id/chain
+func (h *MaterializedViewHandler) GetDependencyChain(c *fiber.Ctx) error {
+	mvID := c.Params("id")
+	if mvID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "Missing parameter",
+			"message": "materialized view ID is required",
+		})
+	}
+
+	chain, err := h.service.GetDependencyChain(mvID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error":   "Not found",
+				"message": "Materialized view not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error":   "Failed to get dependency chain",
+			"message": err.Error(),
+		})
+	}
+
+	return c.JSON(chain)
+}
+
 // DropMaterializedView handles DELETE /api/materialized-views/:id
 func (h *MaterializedViewHandler) DropMaterializedView(c *fiber.Ctx) error {
 	mvID := c.Params("id")
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MetricRegistryHandler exposes the workspace metric registry
+type MetricRegistryHandler struct {
+	service *services.MetricRegistryService
+}
+
+// NewMetricRegistryHandler creates a new MetricRegistryHandler
+func NewMetricRegistryHandler(service *services.MetricRegistryService) *MetricRegistryHandler {
+	return &MetricRegistryHandler{service: service}
+}
+
+// MetricRegistryRequest is the payload to create or update a registry metric
+type MetricRegistryRequest struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	Formula         string `json:"formula"`
+	DataType        string `json:"dataType"`
+	Format          string `json:"format"`
+	AggregationType string `json:"aggregationType"`
+	Owner           string `json:"owner"`
+	Status          string `json:"status"`
+}
+
+// loadWorkspaceMetric fetches a registry metric of the caller's workspace
+func (h *MetricRegistryHandler) loadWorkspaceMetric(c *fiber.Ctx) (*models.RegistryMetric, error) {
+	metric, err := h.service.Get(c.Params("id"))
+	if err != nil || metric.WorkspaceID != c.Locals("workspaceID").(string) {
+		return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Metric not found",
+		})
+	}
+	return metric, nil
+}
+
+// ListMetrics godoc
+// @Summary List registry metrics
+// @Description List the canonical metrics of the workspace with their semantic layer and modeling bindings
+// @Tags metrics
+// @Produce json
+// @Param includeDeprecated query bool false "Include deprecated metrics"
+// @Success 200 {array} models.RegistryMetric
+// @Router /api/metrics [get]
+func (h *MetricRegistryHandler) ListMetrics(c *fiber.Ctx) error {
+	workspaceID := c.Locals("workspaceID").(string)
+
+	metrics, err := h.service.List(workspaceID, c.QueryBool("includeDeprecated", false))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve metrics",
+		})
+	}
+	return c.JSON(metrics)
+}
+
+// GetMetric godoc
+// @Summary Get registry metric
+// @Tags metrics
+// @Produce json
+// @Param id path string true "Metric ID"
+// @Success 200 {object} models.RegistryMetric
+// @Failure 404 {object} map[string]string
+// @Router /api/metrics/{id} [get]
+func (h *MetricRegistryHandler) GetMetric(c *fiber.Ctx) error {
+	metric, err := h.loadWorkspaceMetric(c)
+	if metric == nil {
+		return err
+	}
+	return c.JSON(metric)
+}
+
+// CreateMetric godoc
+// @Summary Create registry metric
+// @Tags metrics
+// @Accept json
+// @Produce json
+// @Param metric body MetricRegistryRequest true "Metric definition"
+// @Success 201 {object} models.RegistryMetric
+// @Failure 400 {object} map[string]string
+// @Router /api/metrics [post]
+func (h *MetricRegistryHandler) CreateMetric(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(string)
+	workspaceID := c.Locals("workspaceID").(string)
+
+	var req MetricRegistryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	owner := req.Owner
+	if owner == "" {
+		owner = userID
+	}
+	metric := &models.RegistryMetric{
+		WorkspaceID:     workspaceID,
+		Name:            req.Name,
+		Description:     req.Description,
+		Formula:         req.Formula,
+		DataType:        req.DataType,
+		Format:          req.Format,
+		AggregationType: req.AggregationType,
+		Owner:           owner,
+		Status:          req.Status,
+		CreatedBy:       userID,
+	}
+	if err := h.service.Create(metric); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(metric)
+}
+
+// UpdateMetric godoc
+// @Summary Update registry metric
+// @Description Update a metric and propagate it to every bound semantic model and modeling definition
+// @Tags metrics
+// @Accept json
+// @Produce json
+// @Param id path string true "Metric ID"
+// @Param metric body MetricRegistryRequest true "Metric definition"
+// @Success 200 {object} models.RegistryMetric
+// @Failure 400 {object} map[string]string
+// @Router /api/metrics/{id} [put]
+func (h *MetricRegistryHandler) UpdateMetric(c *fiber.Ctx) error {
+	metric, err := h.loadWorkspaceMetric(c)
+	if metric == nil {
+		return err
+	}
+
+	var req MetricRegistryRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	metric.Name = req.Name
+	metric.Description = req.Description
+	metric.Formula = req.Formula
+	metric.DataType = req.DataType
+	metric.Format = req.Format
+	metric.AggregationType = req.AggregationType
+	if req.Owner != "" {
+		metric.Owner = req.Owner
+	}
+	if req.Status != "" {
+		metric.Status = req.Status
+	}
+
+	if err := h.service.Update(metric); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(metric)
+}
+
+// DeleteMetric godoc
+// @Summary Delete registry metric
+// @Tags metrics
+// @Produce json
+// @Param id path string true "Metric ID"
+// @Success 200 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /api/metrics/{id} [delete]
+func (h *MetricRegistryHandler) DeleteMetric(c *fiber.Ctx) error {
+	metric, err := h.loadWorkspaceMetric(c)
+	if metric == nil {
+		return err
+	}
+
+	if err := h.service.Delete(metric.ID); err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Metric deleted successfully",
+	})
+}
+
+// BindMetric godoc
+// @Summary Bind registry metric to a semantic model
+// @Tags metrics
+// @Accept json
+// @Produce json
+// @Param id path string true "Metric ID"
+// @Param body body object true "Semantic model (modelId)"
+// @Success 200 {object} models.RegistryMetric
+// @Failure 400 {object} map[string]string
+// @Router /api/metrics/{id}/bind [post]
+func (h *MetricRegistryHandler) BindMetric(c *fiber.Ctx) error {
+	metric, err := h.loadWorkspaceMetric(c)
+	if metric == nil {
+		return err
+	}
+
+	var req struct {
+		ModelID string `json:"modelId"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.ModelID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Model ID is required",
+		})
+	}
+
+	if err := h.service.BindToSemanticModel(metric.ID, req.ModelID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	bound, err := h.service.Get(metric.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve metric",
+		})
+	}
+	return c.JSON(bound)
+}
+
+// MigrateMetrics godoc
+// @Summary Migrate legacy metrics into the registry
+// @Description Convert semantic layer and modeling metrics of the workspace into registry metrics and report conflicts
+// @Tags metrics
+// @Produce json
+// @Param dryRun query bool false "Report without persisting"
+// @Success 200 {object} services.MetricMigrationReport
+// @Router /api/metrics/migrate [post]
+func (h *MetricRegistryHandler) MigrateMetrics(c *fiber.Ctx) error {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	if workspaceID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Workspace ID is required",
+		})
+	}
+	userID, _ := c.Locals("userID").(string)
+	if !isMember(workspaceID, userID) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Access denied",
+		})
+	}
+
+	report, err := h.service.MigrateLegacyMetrics(workspaceID, c.QueryBool("dryRun", false))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to migrate metrics",
+		})
+	}
+	return c.JSON(report)
+}
+
+// ValidateFormula godoc
+// @Summary Validate metric formula
+// @Tags metrics
+// @Accept json
+// @Produce json
+// @Param body body object true "Formula (formula)"
+// @Success 200 {object} map[string]interface{}
+// @Router /api/metrics/validate [post]
+func (h *MetricRegistryHandler) ValidateFormula(c *fiber.Ctx) error {
+	var req struct {
+		Formula string `json:"formula"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if err := services.ValidateMetricFormula(req.Formula); err != nil {
+		return c.JSON(fiber.Map{
+			"valid": false,
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(fiber.Map{
+		"valid": true,
+	})
+}
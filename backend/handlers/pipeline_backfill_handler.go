@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// findPipelineBackfill loads a backfill of a pipeline
+func findPipelineBackfill(pipelineID string, backfillID string) (*models.PipelineBackfill, error) {
+	var backfill models.PipelineBackfill
+	if err := database.DB.Where(`id = ? AND "pipelineId" = ?`, backfillID, pipelineID).First(&backfill).Error; err != nil {
+		return nil, err
+	}
+	return &backfill, nil
+}
+
+// CreatePipelineBackfill starts reprocessing a date or ID range of a
+// pipeline's history, chunk by chunk
+func CreatePipelineBackfill(c *fiber.Ctx) error {
+	pipeline, status, err := findEditablePipeline(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	var req struct {
+		Column      string `json:"column"`
+		RangeType   string `json:"rangeType"`
+		RangeStart  string `json:"rangeStart"`
+		RangeEnd    string `json:"rangeEnd"`
+		ChunkSize   int    `json:"chunkSize"`
+		Parallelism int    `json:"parallelism"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	backfill := models.PipelineBackfill{
+		Column:      req.Column,
+		RangeType:   req.RangeType,
+		RangeStart:  req.RangeStart,
+		RangeEnd:    req.RangeEnd,
+		ChunkSize:   req.ChunkSize,
+		Parallelism: req.Parallelism,
+		CreatedBy:   c.Locals("userID").(string),
+	}
+	if _, err := services.PlanPipelineBackfill(pipeline, &backfill); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := services.CreatePipelineBackfill(pipeline, &backfill); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(201).JSON(backfill)
+}
+
+// GetPipelineBackfills lists a pipeline's backfills, newest first
+func GetPipelineBackfills(c *fiber.Ctx) error {
+	pipeline, status, message := findReadablePipeline(c)
+	if pipeline == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
+	}
+
+	var backfills []models.PipelineBackfill
+	if err := database.DB.Where(`"pipelineId" = ?`, pipeline.ID).Order("created_at DESC").Limit(50).Find(&backfills).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"backfills": backfills})
+}
+
+// GetPipelineBackfill returns a backfill with the status of its chunks
+func GetPipelineBackfill(c *fiber.Ctx) error {
+	pipeline, status, message := findReadablePipeline(c)
+	if pipeline == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
+	}
+
+	var backfill models.PipelineBackfill
+	err := database.DB.Preload("Chunks", func(db *gorm.DB) *gorm.DB { return db.Order("seq ASC") }).
+		Where(`id = ? AND "pipelineId" = ?`, c.Params("backfillId"), pipeline.ID).First(&backfill).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backfill not found"})
+	}
+	return c.JSON(backfill)
+}
+
+// ResumePipelineBackfill runs the chunks of a failed or cancelled backfill
+// that did not complete
+func ResumePipelineBackfill(c *fiber.Ctx) error {
+	pipeline, status, err := findEditablePipeline(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	backfill, err := findPipelineBackfill(pipeline.ID, c.Params("backfillId"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backfill not found"})
+	}
+	if backfill.Status != "FAILED" && backfill.Status != "CANCELLED" {
+		return c.Status(409).JSON(fiber.Map{"error": "Only failed or cancelled backfills can be resumed"})
+	}
+	if err := services.ResumePipelineBackfill(backfill); err != nil {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(backfill)
+}
+
+// CancelPipelineBackfill cancels a queued or running backfill; chunks that
+// completed stay loaded
+func CancelPipelineBackfill(c *fiber.Ctx) error {
+	pipeline, status, err := findEditablePipeline(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	backfill, err := findPipelineBackfill(pipeline.ID, c.Params("backfillId"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Backfill not found"})
+	}
+	if backfill.Status != "PENDING" && backfill.Status != "RUNNING" {
+		return c.Status(409).JSON(fiber.Map{"error": "Backfill is not in progress"})
+	}
+
+	services.GlobalJobQueue.Cancel(backfill.ID)
+
+	// A backfill still in the queue never reaches the executor, so close it
+	// here; a running one is closed once its chunks stop
+	database.DB.Model(&models.PipelineBackfill{}).
+		Where("id = ? AND status = ?", backfill.ID, "PENDING").
+		Updates(map[string]interface{}{"status": "CANCELLED", "finished_at": time.Now()})
+
+	return c.JSON(fiber.Map{"message": "Backfill cancellation requested"})
+}
@@ -91,7 +91,7 @@ func GetPipeline(c *fiber.Ctx) error {
 	pipelineID := c.Params("id")
 
 	var pipeline models.Pipeline
-	if err := database.DB.Preload("QualityRules").First(&pipeline, "id = ?", pipelineID).Error; err != nil {
+	if err := database.DB.Preload("QualityRules").Preload("Dependencies").First(&pipeline, "id = ?", pipelineID).Error; err != nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Pipeline not found"})
 	}
 
@@ -116,20 +116,23 @@ func CreatePipeline(c *fiber.Ctx) error {
 	}
 
 	var input struct {
-		Name                string                 `json:"name" validate:"required"`
-		Description         *string                `json:"description"`
-		WorkspaceID         string                 `json:"workspaceId" validate:"required"`
-		SourceType          string                 `json:"sourceType" validate:"required"`
-		SourceConfig        map[string]interface{} `json:"sourceConfig" validate:"required"`
-		ConnectionID        *string                `json:"connectionId"`
-		SourceQuery         *string                `json:"sourceQuery"`
-		DestinationType     string                 `json:"destinationType" validate:"required"`
-		DestinationConfig   map[string]interface{} `json:"destinationConfig"`
-		Mode                string                 `json:"mode" validate:"required,oneof=batch stream ETL ELT"`
-		TransformationSteps []interface{}          `json:"transformationSteps"`
-		QualityRules        []interface{}          `json:"qualityRules"`
-		ScheduleCron        *string                `json:"scheduleCron"`
-		RowLimit            int                    `json:"rowLimit"`
+		Name                string                      `json:"name" validate:"required"`
+		Description         *string                     `json:"description"`
+		WorkspaceID         string                      `json:"workspaceId" validate:"required"`
+		SourceType          string                      `json:"sourceType" validate:"required"`
+		SourceConfig        map[string]interface{}      `json:"sourceConfig" validate:"required"`
+		ConnectionID        *string                     `json:"connectionId"`
+		SourceQuery         *string                     `json:"sourceQuery"`
+		DestinationType     string                      `json:"destinationType" validate:"required"`
+		DestinationConfig   map[string]interface{}      `json:"destinationConfig"`
+		Mode                string                      `json:"mode" validate:"required,oneof=batch stream ETL ELT"`
+		TransformationSteps []interface{}               `json:"transformationSteps"`
+		QualityRules        []models.QualityRule        `json:"qualityRules"`
+		ScheduleCron        *string                     `json:"scheduleCron"`
+		RowLimit            *int                        `json:"rowLimit" validate:"omitempty,min=0"` // 0 = no limit
+		Dependencies        []models.PipelineDependency `json:"dependencies"`
+		WatchPath           *string                     `json:"watchPath"`
+		WatchPattern        *string                     `json:"watchPattern"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -173,16 +176,32 @@ func CreatePipeline(c *fiber.Ctx) error {
 			return c.Status(400).JSON(fiber.Map{"error": "Invalid transformation steps"})
 		}
 		str := string(transformationStepsJSON)
+		if err := validatePipelineSteps(str, input.Mode, input.DestinationType, input.WorkspaceID, userID); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
 		transformationStepsStr = &str
 	}
 
-	rowLimit := input.RowLimit
-	if rowLimit <= 0 {
-		rowLimit = 100000
+	rowLimit := 0 // no limit
+	if input.RowLimit != nil {
+		rowLimit = *input.RowLimit
+	}
+
+	watchPath, watchPattern, err := pipelineWatch(input.WatchPath, input.WatchPattern, nil, nil)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	pipelineID := uuid.New().String()
+	if err := services.ValidatePipelineDependencies(pipelineID, input.WorkspaceID, userID, input.Dependencies); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := services.ValidateQualityRules(input.QualityRules, input.DestinationType); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	pipeline := models.Pipeline{
-		ID:                  uuid.New().String(),
+		ID:                  pipelineID,
 		Name:                input.Name,
 		Description:         input.Description,
 		WorkspaceID:         input.WorkspaceID,
@@ -196,6 +215,8 @@ func CreatePipeline(c *fiber.Ctx) error {
 		TransformationSteps: transformationStepsStr,
 		ScheduleCron:        input.ScheduleCron,
 		RowLimit:            rowLimit,
+		WatchPath:           watchPath,
+		WatchPattern:        watchPattern,
 		IsActive:            true,
 		CreatedAt:           time.Now(),
 		UpdatedAt:           time.Now(),
@@ -204,10 +225,73 @@ func CreatePipeline(c *fiber.Ctx) error {
 	if err := database.DB.Create(&pipeline).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	if len(input.Dependencies) > 0 {
+		if err := services.SetPipelineDependencies(pipeline.ID, pipeline.WorkspaceID, userID, input.Dependencies); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		pipeline.Dependencies = input.Dependencies
+	}
+	if len(input.QualityRules) > 0 {
+		if err := services.SetPipelineQualityRules(pipeline.ID, pipeline.DestinationType, input.QualityRules); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		pipeline.QualityRules = input.QualityRules
+	}
 
 	return c.Status(201).JSON(pipeline)
 }
 
+// pipelineWatch resolves the watched directory and file pattern of a
+// pipeline from the request and the current values; an empty path stops
+// watching
+func pipelineWatch(path, pattern, currentPath, currentPattern *string) (*string, *string, error) {
+	if path == nil {
+		path = currentPath
+	}
+	if pattern == nil {
+		pattern = currentPattern
+	}
+	if path == nil || *path == "" {
+		return nil, nil, nil
+	}
+	p := ""
+	if pattern != nil {
+		p = *pattern
+	}
+	if err := services.ValidatePipelineWatch(*path, p); err != nil {
+		return nil, nil, err
+	}
+	return path, pattern, nil
+}
+
+// validatePipelineSteps rejects unknown or misconfigured transform steps, SQL
+// steps outside ELT mode or on the internal store, and JOIN/UNION inputs
+// reading connections or pipelines the user cannot access
+func validatePipelineSteps(raw string, mode string, destinationType string, workspaceID string, userID string) error {
+	steps, err := services.ParseTransformSteps(&raw)
+	if err != nil {
+		return err
+	}
+	if err := services.ValidateTransformSteps(steps, mode, destinationType); err != nil {
+		return err
+	}
+	for _, input := range services.TransformStepInputs(steps) {
+		var count int64
+		if input.ConnectionID != "" {
+			database.DB.Model(&models.Connection{}).Where("id = ? AND user_id = ?", input.ConnectionID, userID).Count(&count)
+			if count == 0 {
+				return fmt.Errorf("connection not found: %s", input.ConnectionID)
+			}
+			continue
+		}
+		database.DB.Model(&models.Pipeline{}).Where("id = ? AND workspace_id = ?", input.PipelineID, workspaceID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("input pipeline not found: %s", input.PipelineID)
+		}
+	}
+	return nil
+}
+
 // UpdatePipeline updates an existing pipeline
 func UpdatePipeline(c *fiber.Ctx) error {
 	userIDVal := c.Locals("userID")
@@ -236,16 +320,21 @@ func UpdatePipeline(c *fiber.Ctx) error {
 	}
 
 	var input struct {
-		Name                *string                `json:"name"`
-		Description         *string                `json:"description"`
-		SourceType          *string                `json:"sourceType"`
-		SourceConfig        map[string]interface{} `json:"sourceConfig"`
-		DestinationType     *string                `json:"destinationType"`
-		DestinationConfig   map[string]interface{} `json:"destinationConfig"`
-		Mode                *string                `json:"mode" validate:"omitempty,oneof=batch stream"`
-		TransformationSteps []interface{}          `json:"transformationSteps"`
-		ScheduleCron        *string                `json:"scheduleCron"`
-		IsActive            *bool                  `json:"isActive"`
+		Name                *string                      `json:"name"`
+		Description         *string                      `json:"description"`
+		SourceType          *string                      `json:"sourceType"`
+		SourceConfig        map[string]interface{}       `json:"sourceConfig"`
+		DestinationType     *string                      `json:"destinationType"`
+		DestinationConfig   map[string]interface{}       `json:"destinationConfig"`
+		Mode                *string                      `json:"mode" validate:"omitempty,oneof=batch stream ETL ELT"`
+		TransformationSteps []interface{}                `json:"transformationSteps"`
+		ScheduleCron        *string                      `json:"scheduleCron"`
+		RowLimit            *int                         `json:"rowLimit" validate:"omitempty,min=0"` // 0 = no limit
+		QualityRules        *[]models.QualityRule        `json:"qualityRules"`
+		Dependencies        *[]models.PipelineDependency `json:"dependencies"`
+		WatchPath           *string                      `json:"watchPath"` // empty stops watching
+		WatchPattern        *string                      `json:"watchPattern"`
+		IsActive            *bool                        `json:"isActive"`
 	}
 
 	if err := c.BodyParser(&input); err != nil {
@@ -281,13 +370,60 @@ func UpdatePipeline(c *fiber.Ctx) error {
 	if input.Mode != nil {
 		updates["mode"] = *input.Mode
 	}
-	if input.TransformationSteps != nil {
-		transformationStepsJSON, _ := json.Marshal(input.TransformationSteps)
-		updates["transformation_steps"] = string(transformationStepsJSON)
+	destinationType := pipeline.DestinationType
+	if input.DestinationType != nil {
+		destinationType = *input.DestinationType
+	}
+	if input.TransformationSteps != nil || input.Mode != nil || input.DestinationType != nil {
+		// Steps are checked against the mode and destination they will run in
+		steps := ""
+		if pipeline.TransformationSteps != nil {
+			steps = *pipeline.TransformationSteps
+		}
+		if input.TransformationSteps != nil {
+			transformationStepsJSON, _ := json.Marshal(input.TransformationSteps)
+			steps = string(transformationStepsJSON)
+			updates["transformation_steps"] = steps
+		}
+		mode := pipeline.Mode
+		if input.Mode != nil {
+			mode = *input.Mode
+		}
+		if err := validatePipelineSteps(steps, mode, destinationType, pipeline.WorkspaceID, userID); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
 	}
 	if input.ScheduleCron != nil {
 		updates["schedule_cron"] = *input.ScheduleCron
 	}
+	if input.RowLimit != nil {
+		updates["row_limit"] = *input.RowLimit
+	}
+	if input.WatchPath != nil || input.WatchPattern != nil {
+		watchPath, watchPattern, err := pipelineWatch(input.WatchPath, input.WatchPattern, pipeline.WatchPath, pipeline.WatchPattern)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		updates["watch_path"] = watchPath
+		updates["watch_pattern"] = watchPattern
+	}
+	if input.Dependencies != nil {
+		if err := services.ValidatePipelineDependencies(pipeline.ID, pipeline.WorkspaceID, userID, *input.Dependencies); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if input.QualityRules != nil || input.DestinationType != nil {
+		// Rules are checked against the destination they will run in
+		var rules []models.QualityRule
+		if input.QualityRules != nil {
+			rules = *input.QualityRules
+		} else if err := database.DB.Where("\"pipelineId\" = ?", pipeline.ID).Find(&rules).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := services.ValidateQualityRules(rules, destinationType); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
 	if input.IsActive != nil {
 		updates["is_active"] = *input.IsActive
 	}
@@ -296,9 +432,19 @@ func UpdatePipeline(c *fiber.Ctx) error {
 	if err := database.DB.Model(&pipeline).Updates(updates).Error; err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
+	if input.Dependencies != nil {
+		if err := services.SetPipelineDependencies(pipeline.ID, pipeline.WorkspaceID, userID, *input.Dependencies); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
+	if input.QualityRules != nil {
+		if err := services.SetPipelineQualityRules(pipeline.ID, destinationType, *input.QualityRules); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+	}
 
 	// Reload to get updated data
-	database.DB.First(&pipeline, "id = ?", pipelineID)
+	database.DB.Preload("QualityRules").Preload("Dependencies").First(&pipeline, "id = ?", pipelineID)
 
 	return c.JSON(pipeline)
 }
@@ -361,29 +507,110 @@ func RunPipeline(c *fiber.Ctx) error {
 		return c.Status(403).JSON(fiber.Map{"error": "Access denied"})
 	}
 
-	// Create execution record
-	execution := models.JobExecution{
-		ID:            uuid.New().String(),
-		PipelineID:    pipelineID,
-		Status:        "PENDING",
-		StartedAt:     time.Now(),
-		RowsProcessed: 0,
+	execution, err := services.EnqueuePipelineRun(pipelineID, services.PipelineTriggerManual, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if err := database.DB.Create(&execution).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	return c.Status(201).JSON(execution)
+}
+
+// RollbackPipelineLoad restores the destination table version the pipeline's
+// last load replaced
+func RollbackPipelineLoad(c *fiber.Ctx) error {
+	userIDVal := c.Locals("userID")
+	if userIDVal == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
 	}
+	userID, ok := userIDVal.(string)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid user session"})
+	}
+	pipelineID := c.Params("id")
 
-	// Enqueue job for background processing
-	services.GlobalJobQueue.Enqueue(services.Job{
-		ID:        execution.ID,
-		Type:      services.JobTypePipeline,
-		EntityID:  pipelineID,
-		CreatedAt: time.Now(),
-		Retries:   0,
-	})
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, "id = ?", pipelineID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Pipeline not found"})
+	}
 
-	return c.Status(201).JSON(execution)
+	// Verify workspace access (ADMIN, OWNER, EDITOR only)
+	var membership models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", pipeline.WorkspaceID, userID).First(&membership).Error; err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Access denied"})
+	}
+
+	if membership.Role != "ADMIN" && membership.Role != "OWNER" && membership.Role != "EDITOR" {
+		return c.Status(403).JSON(fiber.Map{"error": "Insufficient permissions"})
+	}
+
+	if err := services.GlobalPipelineExecutor.RollbackLoad(c.Context(), &pipeline); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Destination rolled back to its previous version"})
+}
+
+// PreviewPipelineSteps runs transformation steps on a sample of the
+// pipeline's source without loading anything. The body may carry unsaved
+// steps; the saved ones are previewed otherwise.
+func PreviewPipelineSteps(c *fiber.Ctx) error {
+	userIDVal := c.Locals("userID")
+	if userIDVal == nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	userID, ok := userIDVal.(string)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "Invalid user session"})
+	}
+	pipelineID := c.Params("id")
+
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, "id = ?", pipelineID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Pipeline not found"})
+	}
+
+	// Verify workspace access (ADMIN, OWNER, EDITOR only)
+	var membership models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", pipeline.WorkspaceID, userID).First(&membership).Error; err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Access denied"})
+	}
+
+	if membership.Role != "ADMIN" && membership.Role != "OWNER" && membership.Role != "EDITOR" {
+		return c.Status(403).JSON(fiber.Map{"error": "Insufficient permissions"})
+	}
+
+	var input struct {
+		TransformationSteps []interface{} `json:"transformationSteps"`
+		SampleSize          int           `json:"sampleSize"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Invalid request body"})
+		}
+	}
+
+	steps := ""
+	if pipeline.TransformationSteps != nil {
+		steps = *pipeline.TransformationSteps
+	}
+	if input.TransformationSteps != nil {
+		transformationStepsJSON, _ := json.Marshal(input.TransformationSteps)
+		steps = string(transformationStepsJSON)
+	}
+	if err := validatePipelineSteps(steps, pipeline.Mode, pipeline.DestinationType, pipeline.WorkspaceID, userID); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	parsed, _ := services.ParseTransformSteps(&steps)
+
+	sampleSize := input.SampleSize
+	if sampleSize <= 0 || sampleSize > 1000 {
+		sampleSize = 100
+	}
+
+	preview, err := services.GlobalPipelineExecutor.PreviewTransformSteps(c.Context(), &pipeline, parsed, sampleSize)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(preview)
 }
 
 // GetPipelineStats returns pipeline statistics for a workspace
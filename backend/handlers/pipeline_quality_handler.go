@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// findReadablePipeline loads a pipeline of a workspace the current user is a
+// member of, with the status to answer otherwise
+func findReadablePipeline(c *fiber.Ctx) (*models.Pipeline, int, string) {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return nil, 401, "Unauthorized"
+	}
+
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, "id = ?", c.Params("id")).Error; err != nil {
+		return nil, 404, "Pipeline not found"
+	}
+
+	var membership models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", pipeline.WorkspaceID, userID).First(&membership).Error; err != nil {
+		return nil, 403, "Access denied"
+	}
+	return &pipeline, 0, ""
+}
+
+// GetPipelineScorecards returns the quality scorecards of a pipeline's runs,
+// newest first
+func GetPipelineScorecards(c *fiber.Ctx) error {
+	pipeline, status, message := findReadablePipeline(c)
+	if pipeline == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
+	}
+
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > 200 {
+		limit = 20
+	}
+	scorecards, err := services.QualityScorecards(pipeline.ID, c.Query("executionId"), limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"scorecards": scorecards})
+}
+
+// GetPipelineQuarantine returns the rows a pipeline's runs quarantined,
+// newest first
+func GetPipelineQuarantine(c *fiber.Ctx) error {
+	pipeline, status, message := findReadablePipeline(c)
+	if pipeline == nil {
+		return c.Status(status).JSON(fiber.Map{"error": message})
+	}
+
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+	rows, err := services.GlobalPipelineExecutor.QuarantinedRows(c.Context(), pipeline, c.Query("executionId"), limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"rows": rows})
+}
@@ -31,7 +31,9 @@ func StreamPipelineStatus(c *fiber.Ctx) error {
 		defer ticker.Stop()
 
 		timeout := time.After(30 * time.Minute)
-		var lastProgress int = -1
+		// A run reports rows processed rather than a percentage; an update is
+		// sent whenever its status or row counts change
+		var last *services.ExecutionContext
 
 		for {
 			select {
@@ -61,12 +63,14 @@ func StreamPipelineStatus(c *fiber.Ctx) error {
 					})
 					w.Flush()
 
-					// If we previously had progress, the execution is done
-					if lastProgress > 0 {
+					// If we previously saw the execution, it is done
+					if last != nil {
 						writeSSEEvent(w, "complete", map[string]interface{}{
-							"pipelineId": pipelineID,
-							"status":     "COMPLETED",
-							"progress":   100,
+							"pipelineId":    pipelineID,
+							"status":        "COMPLETED",
+							"progress":      100,
+							"rowsExtracted": last.RowsExtracted,
+							"rowsLoaded":    last.RowsLoaded,
 						})
 						w.Flush()
 						return
@@ -75,14 +79,17 @@ func StreamPipelineStatus(c *fiber.Ctx) error {
 				}
 
 				// Active execution — send progress update
-				if activeExec.Progress != lastProgress {
-					lastProgress = activeExec.Progress
+				if last == nil || activeExec.Status != last.Status ||
+					activeExec.RowsExtracted != last.RowsExtracted || activeExec.RowsLoaded != last.RowsLoaded {
+					last = activeExec
 					writeSSEEvent(w, "progress", map[string]interface{}{
-						"pipelineId":  pipelineID,
-						"executionId": activeExec.ExecutionID,
-						"status":      activeExec.Status,
-						"progress":    activeExec.Progress,
-						"elapsedMs":   int(time.Since(activeExec.StartedAt).Milliseconds()),
+						"pipelineId":    pipelineID,
+						"executionId":   activeExec.ExecutionID,
+						"status":        activeExec.Status,
+						"progress":      activeExec.Progress,
+						"rowsExtracted": activeExec.RowsExtracted,
+						"rowsLoaded":    activeExec.RowsLoaded,
+						"elapsedMs":     int(time.Since(activeExec.StartedAt).Milliseconds()),
 					})
 					w.Flush()
 
@@ -92,6 +99,7 @@ func StreamPipelineStatus(c *fiber.Ctx) error {
 							"executionId": activeExec.ExecutionID,
 							"status":      "COMPLETED",
 							"progress":    100,
+							"rowsLoaded":  activeExec.RowsLoaded,
 						})
 						w.Flush()
 						return
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// findEditablePipeline loads a pipeline the current user may edit (ADMIN,
+// OWNER or EDITOR of its workspace), with the status to answer otherwise
+func findEditablePipeline(c *fiber.Ctx) (*models.Pipeline, int, error) {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return nil, 401, errors.New("Unauthorized")
+	}
+
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, "id = ?", c.Params("id")).Error; err != nil {
+		return nil, 404, errors.New("Pipeline not found")
+	}
+
+	var membership models.WorkspaceMember
+	if err := database.DB.Where("workspace_id = ? AND user_id = ?", pipeline.WorkspaceID, userID).First(&membership).Error; err != nil {
+		return nil, 403, errors.New("Access denied")
+	}
+	if membership.Role != "ADMIN" && membership.Role != "OWNER" && membership.Role != "EDITOR" {
+		return nil, 403, errors.New("Insufficient permissions")
+	}
+	return &pipeline, 0, nil
+}
+
+// EnablePipelineWebhook enables the trigger webhook of a pipeline with a new
+// secret, replacing any previous one. The secret is only returned here.
+func EnablePipelineWebhook(c *fiber.Ctx) error {
+	pipeline, status, err := findEditablePipeline(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	secret, err := services.RotatePipelineWebhookSecret(pipeline.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"url":    "/api/pipelines/" + pipeline.ID + "/trigger",
+		"secret": secret,
+		"signature": "hex HMAC-SHA256 of \"<timestamp>.<body>\" in X-Pipeline-Signature, " +
+			"with the Unix timestamp in X-Pipeline-Timestamp",
+	})
+}
+
+// DisablePipelineWebhook turns the trigger webhook of a pipeline off
+func DisablePipelineWebhook(c *fiber.Ctx) error {
+	pipeline, status, err := findEditablePipeline(c)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := database.DB.Model(pipeline).Update("webhook_secret", nil).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Webhook trigger disabled"})
+}
+
+// TriggerPipelineWebhook starts a pipeline run from a signed inbound request.
+// It is not behind the auth middleware: the signature authenticates it.
+func TriggerPipelineWebhook(c *fiber.Ctx) error {
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, "id = ?", c.Params("id")).Error; err != nil || pipeline.WebhookSecret == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Pipeline not found"})
+	}
+
+	err := services.VerifyPipelineWebhook(*pipeline.WebhookSecret, c.Get("X-Pipeline-Timestamp"), c.Body(), c.Get("X-Pipeline-Signature"), time.Now())
+	if err != nil {
+		services.LogWarn("pipeline_webhook", "Rejected pipeline trigger", map[string]interface{}{"pipeline_id": pipeline.ID, "ip": c.IP(), "error": err.Error()})
+		return c.Status(401).JSON(fiber.Map{"error": err.Error()})
+	}
+	if !pipeline.IsActive {
+		return c.Status(409).JSON(fiber.Map{"error": "Pipeline is not active"})
+	}
+
+	execution, err := services.EnqueuePipelineRun(pipeline.ID, services.PipelineTriggerWebhook, []models.TriggerLink{
+		{Type: services.PipelineTriggerWebhook, ID: c.IP()},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(202).JSON(fiber.Map{"executionId": execution.ID})
+}
@@ -15,6 +15,7 @@ type QueryHandler struct {
 	queryExecutor     services.QueryExecutorInterface
 	queryCache        *services.QueryCache
 	encryptionService *services.EncryptionService
+	queryBuilder      *services.QueryBuilder
 }
 
 func NewQueryHandler(qe services.QueryExecutorInterface, qc *services.QueryCache) *QueryHandler {
@@ -31,6 +32,20 @@ func NewQueryHandler(qe services.QueryExecutorInterface, qc *services.QueryCache
 	}
 }
 
+// SetQueryBuilder lets RunQuery evaluate the calculated fields of a dashboard card
+func (h *QueryHandler) SetQueryBuilder(qb *services.QueryBuilder) {
+	h.queryBuilder = qb
+}
+
+// applyCardFields evaluates the calculated fields of the card a query runs for, if any
+func (h *QueryHandler) applyCardFields(c *fiber.Ctx, card *models.DashboardCard, result *models.QueryResult, paged bool) error {
+	if card == nil || h.queryBuilder == nil {
+		return nil
+	}
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	return h.queryBuilder.ApplyCardCalculatedFields(result, card, workspaceID, paged)
+}
+
 // GetQueries returns a list of saved queries
 // @Summary List saved queries
 // @Description Returns a list of saved queries for the authenticated user.
@@ -317,8 +332,9 @@ func (h *QueryHandler) RunQuery(c *fiber.Ctx) error {
 
 	// Parse request body for limit/offset
 	type RunParams struct {
-		Limit  *int `json:"limit" validate:"omitempty,min=0"`
-		Offset *int `json:"offset" validate:"omitempty,min=0"`
+		Limit  *int   `json:"limit" validate:"omitempty,min=0"`
+		Offset *int   `json:"offset" validate:"omitempty,min=0"`
+		CardID string `json:"cardId"` // evaluate this dashboard card's calculated fields
 	}
 	params := new(RunParams)
 	if err := c.BodyParser(params); err != nil {
@@ -332,6 +348,18 @@ func (h *QueryHandler) RunQuery(c *fiber.Ctx) error {
 		})
 	}
 
+	var card *models.DashboardCard
+	if params.CardID != "" {
+		card = &models.DashboardCard{}
+		if err := database.DB.Where("id = ? AND query_id = ?", params.CardID, query.ID).First(card).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"status":  "error",
+				"message": "Card not found",
+			})
+		}
+	}
+	paged := params.Limit != nil || params.Offset != nil
+
 	// Execute query context
 	ctx := context.Background()
 
@@ -341,6 +369,12 @@ func (h *QueryHandler) RunQuery(c *fiber.Ctx) error {
 		cacheKey = h.queryCache.GenerateRawQueryCacheKey(query.Connection.ID, query.SQL, nil, params.Limit, params.Offset)
 		cachedResult, err := h.queryCache.GetCachedResult(ctx, cacheKey)
 		if err == nil && cachedResult != nil {
+			if err := h.applyCardFields(c, card, cachedResult, paged); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"status":  "error",
+					"message": err.Error(),
+				})
+			}
 			return c.JSON(fiber.Map{
 				"success": true,
 				"data":    cachedResult,
@@ -366,6 +400,14 @@ func (h *QueryHandler) RunQuery(c *fiber.Ctx) error {
 		_ = h.queryCache.SetCachedResult(ctx, cacheKey, result, tags)
 	}
 
+	// Card fields are applied after caching, so the cached rows stay the query's own
+	if err := h.applyCardFields(c, card, result, paged); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"status":  "error",
+			"message": err.Error(),
+		})
+	}
+
 	// Check if Arrow format is requested
 	format := c.Query("format")
 	if format == "arrow" {
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SemanticCalendarHandler manages the workspace time intelligence calendar
+type SemanticCalendarHandler struct {
+	semanticV2 *services.SemanticLayerV2Service
+}
+
+// NewSemanticCalendarHandler creates a new SemanticCalendarHandler
+func NewSemanticCalendarHandler(semanticV2 *services.SemanticLayerV2Service) *SemanticCalendarHandler {
+	return &SemanticCalendarHandler{semanticV2: semanticV2}
+}
+
+// GetCalendar godoc
+// @Summary Get workspace calendar
+// @Description Get the fiscal/retail/ISO/custom calendar used by time grains and period filters
+// @Tags semantic-layer
+// @Produce json
+// @Success 200 {object} services.WorkspaceCalendar
+// @Failure 500 {object} map[string]string
+// @Router /api/semantic/calendar [get]
+func (h *SemanticCalendarHandler) GetCalendar(c *fiber.Ctx) error {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+
+	cal, err := h.semanticV2.GetWorkspaceCalendar(workspaceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve calendar",
+		})
+	}
+	if cal == nil {
+		cal = &services.WorkspaceCalendar{WorkspaceID: workspaceID, Type: services.CalendarGregorian, FiscalYearStartMonth: 1}
+	}
+	return c.JSON(cal)
+}
+
+// SaveCalendar godoc
+// @Summary Save workspace calendar
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param calendar body services.WorkspaceCalendar true "Calendar definition"
+// @Success 200 {object} services.WorkspaceCalendar
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/calendar [put]
+func (h *SemanticCalendarHandler) SaveCalendar(c *fiber.Ctx) error {
+	var cal services.WorkspaceCalendar
+	if err := c.BodyParser(&cal); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	cal.WorkspaceID, _ = c.Locals("workspaceID").(string)
+
+	if err := h.semanticV2.SaveWorkspaceCalendar(&cal); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(cal)
+}
+
+// ListPeriods godoc
+// @Summary Preview calendar periods
+// @Description List the most recent periods of a grain under the workspace calendar
+// @Tags semantic-layer
+// @Produce json
+// @Param grain query string false "Time grain (day, week, month, quarter, year)"
+// @Param count query int false "Number of periods (default 12)"
+// @Success 200 {array} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/calendar/periods [get]
+func (h *SemanticCalendarHandler) ListPeriods(c *fiber.Ctx) error {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	grain := services.TimeGrain(c.Query("grain", "month"))
+	count, err := strconv.Atoi(c.Query("count", "12"))
+	if err != nil || count < 1 || count > 366 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "count must be between 1 and 366"})
+	}
+
+	cal, err := h.semanticV2.GetWorkspaceCalendar(workspaceID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve calendar",
+		})
+	}
+
+	start := cal.AddPeriods(grain, cal.PeriodStart(grain, time.Now()), -(count - 1))
+	periods := make([]fiber.Map, 0, count)
+	for i := 0; i < count; i++ {
+		end := cal.AddPeriods(grain, start, 1)
+		periods = append(periods, fiber.Map{
+			"label": services.CalendarPeriodLabel(cal, grain, start),
+			"start": start.Format("2006-01-02"),
+			"end":   end.Format("2006-01-02"),
+		})
+		start = end
+	}
+	return c.JSON(periods)
+}
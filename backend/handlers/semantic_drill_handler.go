@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SemanticDrillHandler handles drill-down and drill-through execution
+type SemanticDrillHandler struct {
+	drillService *services.SemanticDrillService
+}
+
+// NewSemanticDrillHandler creates a new SemanticDrillHandler
+func NewSemanticDrillHandler(drillService *services.SemanticDrillService) *SemanticDrillHandler {
+	return &SemanticDrillHandler{drillService: drillService}
+}
+
+// DrillDown godoc
+// @Summary Drill down a hierarchy
+// @Description Build and execute the next-level query for a clicked chart point
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param request body services.DrillRequest true "Drill request"
+// @Success 200 {object} services.DrillDownResult
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/drill/down [post]
+func (h *SemanticDrillHandler) DrillDown(c *fiber.Ctx) error {
+	var req services.DrillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.HierarchyID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Hierarchy ID is required",
+		})
+	}
+	if len(req.Members) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "At least one clicked member value is required",
+		})
+	}
+
+	workspaceID, userCtx, ferr := drillCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	result, err := h.drillService.DrillDown(c.UserContext(), &req, workspaceID, userCtx)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// DrillThrough godoc
+// @Summary Drill through to detail rows
+// @Description Return the underlying detail rows for a clicked member, with RLS applied and a row cap
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param request body services.DrillRequest true "Drill request"
+// @Success 200 {object} services.DrillThroughResult
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/drill/through [post]
+func (h *SemanticDrillHandler) DrillThrough(c *fiber.Ctx) error {
+	var req services.DrillRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Query.ModelID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Model ID is required",
+		})
+	}
+
+	workspaceID, userCtx, ferr := drillCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	result, err := h.drillService.DrillThrough(c.UserContext(), &req, workspaceID, userCtx)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(result)
+}
+
+// drillCaller returns the workspace of a semantic request, of which the
+// caller must be a member, and the caller's RLS user context
+func drillCaller(c *fiber.Ctx) (string, models.UserContext, *fiber.Error) {
+	workspaceID, _ := c.Locals("workspaceID").(string)
+	if workspaceID == "" {
+		return "", models.UserContext{}, fiber.NewError(fiber.StatusBadRequest, "Workspace ID is required")
+	}
+	userCtx, err := drillUserContext(c)
+	if err != nil {
+		return "", models.UserContext{}, fiber.NewError(fiber.StatusInternalServerError, "Failed to load user roles")
+	}
+	if !isMember(workspaceID, userCtx.UserID) {
+		return "", models.UserContext{}, fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	return workspaceID, userCtx, nil
+}
+
+// drillUserContext builds the RLS user context of the authenticated user,
+// with the user's legacy role and assigned RBAC roles
+func drillUserContext(c *fiber.Ctx) (models.UserContext, error) {
+	userCtx := models.UserContext{}
+	userCtx.UserID, _ = c.Locals("userID").(string)
+	userCtx.Email, _ = c.Locals("userEmail").(string)
+
+	var user models.User
+	if err := database.DB.Preload("Roles").First(&user, "id = ?", userCtx.UserID).Error; err != nil {
+		return userCtx, err
+	}
+	if user.Role != "" {
+		userCtx.Roles = append(userCtx.Roles, user.Role)
+	}
+	for _, role := range user.Roles {
+		userCtx.Roles = append(userCtx.Roles, role.Name)
+	}
+	return userCtx, nil
+}
+
+// modelCaller checks that the caller is a member of the workspace a semantic
+// model belongs to
+func modelCaller(c *fiber.Ctx, modelID string) *fiber.Error {
+	var model models.SemanticModel
+	if err := database.DB.Select("id", "workspace_id").First(&model, "id = ?", modelID).Error; err != nil {
+		return fiber.NewError(fiber.StatusNotFound, "Model not found")
+	}
+	userID, _ := c.Locals("userID").(string)
+	if !isMember(model.WorkspaceID, userID) {
+		return fiber.NewError(fiber.StatusForbidden, "Access denied")
+	}
+	return nil
+}
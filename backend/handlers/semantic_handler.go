@@ -353,6 +353,8 @@ func (h *SemanticHandler) FormulaAutocomplete(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Input is required"})
 	}
 
+	input.WorkspaceID, _ = c.Locals("workspaceID").(string)
+
 	// Get autocomplete suggestions
 	result := h.semanticService.GetAutocompleteSuggestions(c.Context(), input)
 
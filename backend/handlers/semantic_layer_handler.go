@@ -9,13 +9,19 @@ import (
 )
 
 type SemanticLayerHandler struct {
-	service *services.SemanticLayerService
+	service      *services.SemanticLayerService
+	queryService *services.SemanticQueryService
 }
 
 func NewSemanticLayerHandler(service *services.SemanticLayerService) *SemanticLayerHandler {
 	return &SemanticLayerHandler{service: service}
 }
 
+// SetSemanticQueryService enables cache invalidation when models change
+func (h *SemanticLayerHandler) SetSemanticQueryService(queryService *services.SemanticQueryService) {
+	h.queryService = queryService
+}
+
 // ListSemanticModels godoc
 // @Summary List semantic models
 // @Description Get all semantic models for the user's workspace
@@ -332,6 +338,9 @@ func (h *SemanticLayerHandler) UpdateSemanticModel(c *fiber.Ctx) error {
 			"error": err.Error(),
 		})
 	}
+	if h.queryService != nil {
+		_ = h.queryService.InvalidateModel(c.UserContext(), existing.ID)
+	}
 
 	return c.JSON(existing)
 }
@@ -369,6 +378,9 @@ func (h *SemanticLayerHandler) DeleteSemanticModel(c *fiber.Ctx) error {
 			"error": "Failed to delete model",
 		})
 	}
+	if h.queryService != nil {
+		_ = h.queryService.InvalidateModel(c.UserContext(), id)
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "Model deleted successfully",
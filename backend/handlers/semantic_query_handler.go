@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+
+	"insight-engine-backend/services"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// SemanticQueryHandler executes semantic queries and manages model aggregates
+type SemanticQueryHandler struct {
+	queryService *services.SemanticQueryService
+	semanticV2   *services.SemanticLayerV2Service
+}
+
+// NewSemanticQueryHandler creates a new SemanticQueryHandler
+func NewSemanticQueryHandler(queryService *services.SemanticQueryService, semanticV2 *services.SemanticLayerV2Service) *SemanticQueryHandler {
+	return &SemanticQueryHandler{queryService: queryService, semanticV2: semanticV2}
+}
+
+// Query godoc
+// @Summary Execute semantic query
+// @Description Execute a semantic query, routed to the smallest aggregate able to answer it
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param query body services.SemanticQueryV2 true "Semantic query"
+// @Success 200 {object} services.SemanticQueryResult
+// @Failure 400 {object} map[string]string
+// @Router /api/semantic/v2/query [post]
+func (h *SemanticQueryHandler) Query(c *fiber.Ctx) error {
+	var query services.SemanticQueryV2
+	if err := c.BodyParser(&query); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if query.ModelID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Model ID is required",
+		})
+	}
+
+	workspaceID, userCtx, ferr := drillCaller(c)
+	if ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	result, err := h.queryService.Execute(c.UserContext(), &query, workspaceID, userCtx)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.JSON(result)
+}
+
+// ListAggregates godoc
+// @Summary List model aggregates
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "Model ID"
+// @Success 200 {array} services.SemanticAggregate
+// @Failure 403 {object} map[string]string
+// @Router /api/semantic/models/{id}/aggregates [get]
+func (h *SemanticQueryHandler) ListAggregates(c *fiber.Ctx) error {
+	if ferr := modelCaller(c, c.Params("id")); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	aggs, err := h.semanticV2.ListAggregates(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve aggregates",
+		})
+	}
+	return c.JSON(aggs)
+}
+
+// RegisterAggregate godoc
+// @Summary Register model aggregate
+// @Description Register a materialized view or rollup table as a pre-aggregated source of a model
+// @Tags semantic-layer
+// @Accept json
+// @Produce json
+// @Param id path string true "Model ID"
+// @Param aggregate body services.SemanticAggregate true "Aggregate definition"
+// @Success 201 {object} services.SemanticAggregate
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /api/semantic/models/{id}/aggregates [post]
+func (h *SemanticQueryHandler) RegisterAggregate(c *fiber.Ctx) error {
+	if ferr := modelCaller(c, c.Params("id")); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	var agg services.SemanticAggregate
+	if err := c.BodyParser(&agg); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	agg.ModelID = c.Params("id")
+
+	if err := h.semanticV2.RegisterAggregate(&agg); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	_ = h.queryService.InvalidateModel(c.UserContext(), agg.ModelID)
+
+	return c.Status(fiber.StatusCreated).JSON(agg)
+}
+
+// DeleteAggregate godoc
+// @Summary Delete model aggregate
+// @Tags semantic-layer
+// @Produce json
+// @Param id path string true "Model ID"
+// @Param aggregateId path string true "Aggregate ID"
+// @Success 200 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /api/semantic/models/{id}/aggregates/{aggregateId} [delete]
+func (h *SemanticQueryHandler) DeleteAggregate(c *fiber.Ctx) error {
+	if ferr := modelCaller(c, c.Params("id")); ferr != nil {
+		return c.Status(ferr.Code).JSON(fiber.Map{
+			"error": ferr.Message,
+		})
+	}
+
+	if err := h.semanticV2.DeleteAggregate(c.Params("id"), c.Params("aggregateId")); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Aggregate not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to delete aggregate",
+		})
+	}
+	_ = h.queryService.InvalidateModel(c.UserContext(), c.Params("id"))
+
+	return c.JSON(fiber.Map{
+		"message": "Aggregate deleted successfully",
+	})
+}
@@ -0,0 +1,27 @@
+-- Migration: Extracts
+-- Description: Query results of slow or rate-limited sources copied into a local store
+-- Date: 2026-10-18
+CREATE TABLE IF NOT EXISTS "Extract" (
+    id VARCHAR(36) PRIMARY KEY,
+    "userId" TEXT NOT NULL,
+    name TEXT NOT NULL,
+    source_type TEXT NOT NULL, -- CONNECTION, REST_API
+    "connectionId" TEXT REFERENCES connections(id) ON DELETE CASCADE,
+    source_query TEXT,
+    source_config JSONB,
+    store TEXT NOT NULL, -- INTERNAL, EMBEDDED
+    target_table TEXT NOT NULL,
+    refresh_mode TEXT NOT NULL, -- full, incremental
+    watermark_column TEXT,
+    primary_key TEXT,
+    schedule TEXT,
+    status TEXT NOT NULL, -- idle, refreshing, error
+    last_refresh_at TIMESTAMPTZ,
+    last_error TEXT,
+    row_count BIGINT NOT NULL DEFAULT 0,
+    refresh_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_extract_user ON "Extract" ("userId");
+CREATE INDEX IF NOT EXISTS idx_extract_connection ON "Extract" ("connectionId");
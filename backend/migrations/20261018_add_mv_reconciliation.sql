@@ -0,0 +1,11 @@
+-- Migration: Materialized view reconciliation
+-- Description: Row counts and checksums compared by the periodic reconciliation of incremental materialized views
+-- Date: 2026-10-18
+ALTER TABLE refresh_history
+ADD COLUMN IF NOT EXISTS reconciled BOOLEAN DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS source_rows BIGINT,
+ADD COLUMN IF NOT EXISTS target_rows BIGINT,
+ADD COLUMN IF NOT EXISTS source_checksum TEXT,
+ADD COLUMN IF NOT EXISTS target_checksum TEXT,
+ADD COLUMN IF NOT EXISTS drift BOOLEAN DEFAULT FALSE;
+COMMENT ON COLUMN materialized_views.metadata IS 'Stores configuration for incremental refresh: primary_keys (array), timestamp_column (string), lookback_seconds, deleted_column, tombstone_table, tombstone_timestamp_column, reconcile_every';
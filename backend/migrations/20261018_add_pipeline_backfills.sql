@@ -0,0 +1,38 @@
+-- Migration: Pipeline backfills
+-- Description: Reprocessing of a date or ID range of a pipeline, split into chunks with their own status
+-- Date: 2026-10-18
+CREATE TABLE IF NOT EXISTS "PipelineBackfill" (
+    id VARCHAR(36) PRIMARY KEY,
+    "pipelineId" VARCHAR(30) NOT NULL REFERENCES "Pipeline"(id) ON DELETE CASCADE,
+    "column" TEXT NOT NULL,
+    range_type TEXT NOT NULL, -- DATE, ID
+    range_start TEXT NOT NULL,
+    range_end TEXT NOT NULL, -- exclusive
+    chunk_size INTEGER NOT NULL DEFAULT 1,
+    parallelism INTEGER NOT NULL DEFAULT 2,
+    status TEXT NOT NULL, -- PENDING, RUNNING, COMPLETED, FAILED, CANCELLED
+    rows_loaded INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    "createdBy" TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_pipeline_backfill_pipeline ON "PipelineBackfill" ("pipelineId", created_at DESC);
+
+CREATE TABLE IF NOT EXISTS "PipelineBackfillChunk" (
+    id VARCHAR(36) PRIMARY KEY,
+    "backfillId" VARCHAR(36) NOT NULL REFERENCES "PipelineBackfill"(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    range_start TEXT NOT NULL,
+    range_end TEXT NOT NULL, -- exclusive
+    status TEXT NOT NULL, -- PENDING, RUNNING, COMPLETED, FAILED, CANCELLED
+    attempts INTEGER NOT NULL DEFAULT 0,
+    rows_loaded INTEGER NOT NULL DEFAULT 0,
+    rows_deleted INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_pipeline_backfill_chunk_backfill ON "PipelineBackfillChunk" ("backfillId", seq);
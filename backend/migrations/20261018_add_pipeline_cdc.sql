@@ -0,0 +1,14 @@
+-- Migration: Pipeline watermarks
+-- Description: High-water marks of incremental pipelines and LSN checkpoints of Postgres CDC pipelines
+-- Date: 2026-10-18
+CREATE TABLE IF NOT EXISTS pipeline_watermarks (
+    id TEXT PRIMARY KEY,
+    pipeline_id TEXT NOT NULL UNIQUE,
+    column_name TEXT NOT NULL, -- the replication slot of a CDC pipeline
+    column_type TEXT NOT NULL, -- timestamp, integer, string, lsn
+    last_value TEXT,
+    rows_last_sync BIGINT DEFAULT 0,
+    last_sync_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
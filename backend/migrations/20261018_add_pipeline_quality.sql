@@ -0,0 +1,20 @@
+-- Migration: Pipeline data quality
+-- Description: Run-level quality rules, quarantine severity, and per-run quality scorecards
+-- Date: 2026-10-18
+ALTER TABLE "QualityRule" ALTER COLUMN id TYPE VARCHAR(36);
+ALTER TABLE "QualityRule" ALTER COLUMN "column" DROP NOT NULL; -- run rules have no column
+
+CREATE TABLE IF NOT EXISTS "QualityScorecard" (
+    id VARCHAR(36) PRIMARY KEY,
+    "pipelineId" VARCHAR(30) NOT NULL REFERENCES "Pipeline"(id) ON DELETE CASCADE,
+    "executionId" TEXT NOT NULL,
+    status TEXT NOT NULL, -- PASSED, WARNED, FAILED
+    score DOUBLE PRECISION NOT NULL DEFAULT 100,
+    rows_checked INTEGER NOT NULL DEFAULT 0,
+    rows_quarantined INTEGER NOT NULL DEFAULT 0,
+    results JSONB, -- [{"ruleId", "ruleType", "column", "severity", "passed", "violations", "observed", "message"}]
+    metrics JSONB, -- {"column": {"mean", "nullRate"}}, the baseline of DRIFT rules
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_quality_scorecard_pipeline ON "QualityScorecard" ("pipelineId", created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_quality_scorecard_execution ON "QualityScorecard" ("executionId");
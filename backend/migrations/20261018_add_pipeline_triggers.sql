@@ -0,0 +1,21 @@
+-- Migration: Pipeline dependencies and event triggers
+-- Description: Upstream dependencies of pipelines, webhook and watched-directory triggers, and the trigger of each execution
+-- Date: 2026-10-18
+CREATE TABLE IF NOT EXISTS "PipelineDependency" (
+    id VARCHAR(36) PRIMARY KEY,
+    "pipelineId" VARCHAR(30) NOT NULL REFERENCES "Pipeline"(id) ON DELETE CASCADE,
+    upstream_type TEXT NOT NULL, -- PIPELINE, DATAFLOW, MATERIALIZED_VIEW
+    upstream_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_pipeline_dependency_pipeline ON "PipelineDependency" ("pipelineId");
+CREATE INDEX IF NOT EXISTS idx_pipeline_dependency_upstream ON "PipelineDependency" (upstream_type, upstream_id);
+
+ALTER TABLE "Pipeline"
+ADD COLUMN IF NOT EXISTS webhook_secret TEXT,
+ADD COLUMN IF NOT EXISTS watch_path TEXT,
+ADD COLUMN IF NOT EXISTS watch_pattern TEXT;
+
+ALTER TABLE "JobExecution"
+ADD COLUMN IF NOT EXISTS trigger_type TEXT DEFAULT 'MANUAL',
+ADD COLUMN IF NOT EXISTS trigger_chain JSONB; -- [{"type", "id", "runId"}], earliest first
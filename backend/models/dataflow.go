@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -10,7 +11,7 @@ type Dataflow struct {
 	Name        string  `json:"name" gorm:"not null"`
 	Description *string `json:"description"`
 	Schedule    *string `json:"schedule"` // Cron expression
-	IsActive    bool    `json:"isActive" gorm:"default:true"`
+	IsActive    bool    `json:"isActive" gorm:"default:true;column:isActive"`
 
 	UserID string `json:"userId" gorm:"not null;index;column:userId"`
 
@@ -18,8 +19,8 @@ type Dataflow struct {
 	Steps []DataflowStep `json:"steps,omitempty" gorm:"foreignKey:DataflowID"`
 	Runs  []DataflowRun  `json:"runs,omitempty" gorm:"foreignKey:DataflowID"`
 
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updatedAt"`
 }
 
 // TableName specifies the table name for GORM
@@ -33,15 +34,19 @@ type DataflowStep struct {
 	DataflowID string `json:"dataflowId" gorm:"not null;index;column:dataflowId"`
 	Order      int    `json:"order" gorm:"not null"`
 
-	Type   string `json:"type" gorm:"not null"` // QUERY, MATERIALIZE
-	Name   string `json:"name" gorm:"not null"`
+	Type string `json:"type" gorm:"not null"` // QUERY, MATERIALIZE
+	Name string `json:"name" gorm:"not null"`
+	// Config holds the step settings plus the steps it reads from:
+	// QUERY: {"sql": "...", "connectionId": "...", "inputs": [...], "output": "..."}
+	// MATERIALIZE: {"sourceStepId": "...", "targetTable": "...", "connectionId": "...", "mode": "overwrite|append"}
+	// Inputs and sourceStepId name upstream steps by ID, name or output name.
 	Config string `json:"config" gorm:"type:jsonb;not null"`
 
 	// Relationship
 	Dataflow Dataflow `json:"dataflow,omitempty" gorm:"foreignKey:DataflowID"`
 
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updatedAt"`
 }
 
 // TableName specifies the table name for GORM
@@ -54,20 +59,58 @@ type DataflowRun struct {
 	ID         string `json:"id" gorm:"primaryKey;type:varchar(30)"`
 	DataflowID string `json:"dataflowId" gorm:"not null;index;column:dataflowId"`
 
-	Status      string     `json:"status" gorm:"not null"` // RUNNING, COMPLETED, FAILED
-	StartedAt   time.Time  `json:"startedAt"`
-	CompletedAt *time.Time `json:"completedAt"`
+	Status      string     `json:"status" gorm:"not null"` // PENDING, RUNNING, COMPLETED, FAILED, CANCELLED
+	StartedAt   time.Time  `json:"startedAt" gorm:"column:startedAt"`
+	CompletedAt *time.Time `json:"completedAt" gorm:"column:completedAt"`
 	Error       *string    `json:"error"`
-	Logs        *string    `json:"logs" gorm:"type:jsonb"`
+	Logs        *string    `json:"logs" gorm:"type:jsonb"` // DataflowRunLogs
 
 	// Relationship
 	Dataflow Dataflow `json:"dataflow,omitempty" gorm:"foreignKey:DataflowID"`
 
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	// Not stored: the DataflowRun table has no timestamps besides startedAt/completedAt
+	CreatedAt time.Time `json:"createdAt" gorm:"-"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"-"`
 }
 
 // TableName specifies the table name for GORM
 func (DataflowRun) TableName() string {
 	return "DataflowRun"
 }
+
+// DataflowRunLogs is the per-step record of a run, stored in DataflowRun.Logs
+type DataflowRunLogs struct {
+	// RetryOf is the failed run this run retries; its completed steps are reused
+	RetryOf string            `json:"retryOf,omitempty"`
+	Steps   []DataflowStepRun `json:"steps"`
+}
+
+// DataflowStepRun is the outcome of one step within a run
+type DataflowStepRun struct {
+	StepID      string     `json:"stepId"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Status      string     `json:"status"` // PENDING, RUNNING, COMPLETED, FAILED, SKIPPED, CANCELLED
+	RowCount    int        `json:"rowCount"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	DurationMs  int64      `json:"durationMs"`
+	Error       string     `json:"error,omitempty"`
+	Reused      bool       `json:"reused,omitempty"` // completed by the run being retried
+}
+
+// StepLogs decodes the per-step record of the run
+func (r *DataflowRun) StepLogs() DataflowRunLogs {
+	var logs DataflowRunLogs
+	if r.Logs != nil && *r.Logs != "" {
+		_ = json.Unmarshal([]byte(*r.Logs), &logs)
+	}
+	return logs
+}
+
+// SetStepLogs encodes the per-step record of the run
+func (r *DataflowRun) SetStepLogs(logs DataflowRunLogs) {
+	data, _ := json.Marshal(logs)
+	s := string(data)
+	r.Logs = &s
+}
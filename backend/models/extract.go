@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Extract copies the result of a query on a slow or rate-limited source into
+// a local store, refreshed in full or incrementally on a schedule. Queries
+// on the source connection whose SQL is the extract's source query are
+// answered from the copy.
+type Extract struct {
+	ID     string `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID string `json:"userId" gorm:"not null;index;column:userId"`
+	Name   string `json:"name" gorm:"not null"`
+
+	SourceType   string  `json:"sourceType" gorm:"not null"`                    // CONNECTION or REST_API
+	ConnectionID *string `json:"connectionId" gorm:"index;column:connectionId"` // Source connection (CONNECTION)
+	SourceQuery  string  `json:"sourceQuery"`                                   // SQL run on the source connection (CONNECTION)
+	SourceConfig *string `json:"sourceConfig,omitempty" gorm:"type:jsonb"`      // Request of a REST_API source, as for pipelines
+
+	Store       string   `json:"store" gorm:"not null"`                    // INTERNAL (application Postgres) or EMBEDDED (in-process engine)
+	TargetTable string   `json:"targetTable" gorm:"not null"`              // Table in the store; columns are typed like the source's where it reports types
+	Columns     []string `json:"columns,omitempty" gorm:"serializer:json"` // Source query columns, in order, as last loaded
+
+	RefreshMode     string `json:"refreshMode" gorm:"not null"` // full or incremental
+	WatermarkColumn string `json:"watermarkColumn,omitempty"`   // incremental: only rows above the last value are fetched
+	PrimaryKey      string `json:"primaryKey,omitempty"`        // incremental: fetched rows replace stored rows with the same key
+	Schedule        string `json:"schedule,omitempty"`          // cron expression, empty for manual refreshes
+
+	Status        string     `json:"status" gorm:"not null"` // idle, refreshing, error
+	LastRefreshAt *time.Time `json:"lastRefreshAt,omitempty"`
+	LastError     *string    `json:"lastError,omitempty"`
+	RowCount      int64      `json:"rowCount"`
+	RefreshCount  int        `json:"refreshCount"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM
+func (Extract) TableName() string {
+	return "Extract"
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// FormulaFunction is a workspace-scoped user-defined function written in the
+// formula language, e.g. FISCAL_QUARTER(date). Every change is recorded as a
+// FormulaFunctionVersion.
+type FormulaFunction struct {
+	ID          string         `gorm:"primaryKey" json:"id"`
+	WorkspaceID string         `gorm:"uniqueIndex:idx_formula_function_workspace_name;not null" json:"workspaceId"`
+	Name        string         `gorm:"uniqueIndex:idx_formula_function_workspace_name;not null" json:"name"`
+	Description string         `json:"description"`
+	Params      datatypes.JSON `json:"params"` // parameter names, in call order
+	Body        string         `gorm:"type:text;not null" json:"body"`
+	Version     int            `gorm:"not null;default:1" json:"version"`
+	CreatedBy   string         `gorm:"not null" json:"createdBy"`
+	UpdatedBy   string         `json:"updatedBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM
+func (FormulaFunction) TableName() string {
+	return "formula_functions"
+}
+
+// ParamNames decodes the parameter list
+func (f *FormulaFunction) ParamNames() []string {
+	var params []string
+	if len(f.Params) > 0 {
+		_ = json.Unmarshal(f.Params, &params)
+	}
+	return params
+}
+
+// SetParamNames encodes the parameter list
+func (f *FormulaFunction) SetParamNames(params []string) {
+	if params == nil {
+		params = []string{}
+	}
+	data, _ := json.Marshal(params)
+	f.Params = datatypes.JSON(data)
+}
+
+// FormulaFunctionVersion is a snapshot of a user-defined function
+type FormulaFunctionVersion struct {
+	ID          string         `gorm:"primaryKey" json:"id"`
+	FunctionID  string         `gorm:"uniqueIndex:idx_formula_function_version;not null" json:"functionId"`
+	Version     int            `gorm:"uniqueIndex:idx_formula_function_version;not null" json:"version"`
+	Name        string         `gorm:"not null" json:"name"`
+	Description string         `json:"description"`
+	Params      datatypes.JSON `json:"params"`
+	Body        string         `gorm:"type:text;not null" json:"body"`
+	CreatedBy   string         `gorm:"not null" json:"createdBy"`
+	CreatedAt   time.Time      `json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM
+func (FormulaFunctionVersion) TableName() string {
+	return "formula_function_versions"
+}
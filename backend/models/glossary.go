@@ -32,7 +32,7 @@ type TermColumnMapping struct {
 	DataSourceID string    `json:"data_source_id"` // Optional: if linking to physical table
 	TableName    string    `json:"table_name"`
 	ColumnName   string    `json:"column_name"`
-	MetricID     *string   `json:"metric_id,omitempty"` // Optional: if linking to semantic metric
+	MetricID     *string   `json:"metric_id,omitempty"` // Optional: if linking to a metric registry entry
 	CreatedAt    time.Time `json:"created_at"`
 }
 
@@ -20,6 +20,11 @@ type JobExecution struct {
 	QualityViolations int   `json:"qualityViolations" gorm:"default:0"`
 	Progress          int   `json:"progress" gorm:"default:0"` // 0-100 percentage
 
+	// What started the run; the chain lists the upstream runs that led to it,
+	// earliest first
+	TriggerType  string  `json:"triggerType" gorm:"default:MANUAL"` // MANUAL, DEPENDENCY, WEBHOOK, FILE
+	TriggerChain *string `json:"triggerChain" gorm:"type:jsonb"`    // Array of TriggerLink
+
 	// Error and logging
 	Error *string `json:"error"`
 	Logs  *string `json:"logs" gorm:"type:jsonb"` // Array of structured log entries
@@ -41,3 +46,10 @@ type ExecutionLog struct {
 	Step      string    `json:"step,omitempty"` // EXTRACT, TRANSFORM, LOAD, VALIDATE
 	Details   string    `json:"details,omitempty"`
 }
+
+// TriggerLink is one step of the chain of runs that triggered an execution
+type TriggerLink struct {
+	Type  string `json:"type"`            // PIPELINE, DATAFLOW, MATERIALIZED_VIEW, WEBHOOK, FILE
+	ID    string `json:"id"`              // Upstream ID, the file path for FILE, the caller address for WEBHOOK
+	RunID string `json:"runId,omitempty"` // Upstream pipeline execution or dataflow run
+}
@@ -12,10 +12,10 @@ type MaterializedView struct {
 	TargetTable  string                 `json:"targetTable" gorm:"not null;uniqueIndex"`
 	RefreshMode  string                 `json:"refreshMode" gorm:"not null;default:'full'"` // "full" or "incremental"
 	Schedule     string                 `json:"schedule" gorm:"default:''"`                 // cron expression, empty = manual only
-	Metadata     map[string]interface{} `json:"metadata" gorm:"type:jsonb"`                 // Stores primary_keys, timestamp_column, etc.
+	Metadata     map[string]interface{} `json:"metadata" gorm:"type:jsonb;serializer:json"` // Stores primary_keys, timestamp_column, etc.
 	LastRefresh  *time.Time             `json:"lastRefresh" gorm:"index"`
 	NextRefresh  *time.Time             `json:"nextRefresh"`
-	Status       string                 `json:"status" gorm:"not null;default:'idle'"` // "idle", "refreshing", "error"
+	Status       string                 `json:"status" gorm:"not null;default:'idle'"` // "idle", "refreshing", "error", "blocked" (an upstream view failed)
 	ErrorMessage string                 `json:"errorMessage" gorm:"type:text"`
 	RowCount     int64                  `json:"rowCount" gorm:"default:0"`
 	RefreshCount int                    `json:"refreshCount" gorm:"default:0"`
@@ -35,10 +35,18 @@ type RefreshHistory struct {
 	RefreshMode      string     `json:"refreshMode" gorm:"not null"`
 	StartedAt        time.Time  `json:"startedAt" gorm:"not null;index"`
 	CompletedAt      *time.Time `json:"completedAt"`
-	Status           string     `json:"status" gorm:"not null"` // "running", "success", "failed"
+	Status           string     `json:"status" gorm:"not null"` // "running", "success", "failed", "blocked"
 	RowsAffected     int64      `json:"rowsAffected" gorm:"default:0"`
 	ErrorMessage     string     `json:"errorMessage" gorm:"type:text"`
 	Duration         int64      `json:"duration"` // milliseconds
+
+	// Periodic reconciliation of incremental views with their source
+	Reconciled     bool   `json:"reconciled" gorm:"default:false"`
+	SourceRows     int64  `json:"sourceRows,omitempty"`
+	TargetRows     int64  `json:"targetRows,omitempty"`
+	SourceChecksum string `json:"sourceChecksum,omitempty"`
+	TargetChecksum string `json:"targetChecksum,omitempty"`
+	Drift          bool   `json:"drift" gorm:"default:false"` // the view differed from its source and was rebuilt in full
 }
 
 // TableName overrides the table name
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+)
+
+// Metric registry origins and bound systems
+const (
+	MetricSystemRegistry      = "registry"
+	MetricSystemSemanticLayer = "semantic_layer"
+	MetricSystemModeling      = "modeling"
+)
+
+// Metric registry statuses
+const (
+	MetricStatusActive     = "active"
+	MetricStatusDeprecated = "deprecated"
+)
+
+// RegistryMetric is the workspace-wide canonical definition of a business metric.
+// Semantic model metrics and modeling metric definitions are projections of it.
+type RegistryMetric struct {
+	ID              string                  `gorm:"primaryKey" json:"id"`
+	WorkspaceID     string                  `gorm:"uniqueIndex:idx_registry_workspace_metric;not null" json:"workspaceId"`
+	Name            string                  `gorm:"uniqueIndex:idx_registry_workspace_metric;not null" json:"name"`
+	Description     string                  `json:"description"`
+	Formula         string                  `gorm:"not null" json:"formula"`
+	DataType        string                  `gorm:"not null;default:'number'" json:"dataType"` // number, currency, percentage, count, decimal
+	Format          string                  `json:"format,omitempty"`
+	AggregationType string                  `json:"aggregationType,omitempty"` // sum, avg, count, min, max, count_distinct
+	Owner           string                  `json:"owner,omitempty"`
+	Status          string                  `gorm:"not null;default:'active'" json:"status"` // active, deprecated
+	Version         int                     `gorm:"not null;default:1" json:"version"`
+	Origin          string                  `gorm:"not null" json:"origin"` // registry, semantic_layer, modeling
+	CreatedBy       string                  `gorm:"not null" json:"createdBy"`
+	Bindings        []RegistryMetricBinding `gorm:"foreignKey:MetricID;constraint:OnDelete:CASCADE" json:"bindings,omitempty"`
+	CreatedAt       time.Time               `json:"createdAt"`
+	UpdatedAt       time.Time               `json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM
+func (RegistryMetric) TableName() string {
+	return "metric_registry"
+}
+
+// RegistryMetricBinding links a registry metric to its projection in a legacy system.
+// ScopeID is the semantic model ID for the semantic layer and the workspace ID for modeling.
+type RegistryMetricBinding struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	MetricID  string    `gorm:"index;not null" json:"metricId"`
+	System    string    `gorm:"uniqueIndex:idx_registry_binding_scope;not null" json:"system"`
+	ScopeID   string    `gorm:"uniqueIndex:idx_registry_binding_scope;not null" json:"scopeId"`
+	Name      string    `gorm:"uniqueIndex:idx_registry_binding_scope;not null" json:"name"`
+	LegacyID  string    `gorm:"index" json:"legacyId"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM
+func (RegistryMetricBinding) TableName() string {
+	return "metric_registry_bindings"
+}
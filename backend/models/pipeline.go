@@ -12,7 +12,7 @@ type Pipeline struct {
 	WorkspaceID string  `json:"workspaceId" gorm:"not null;index"`
 
 	// Source Configuration
-	SourceType   string  `json:"sourceType" gorm:"not null"` // POSTGRES, MYSQL, CSV, REST_API
+	SourceType   string  `json:"sourceType" gorm:"not null"` // POSTGRES, POSTGRES_CDC, MYSQL, CSV, JSON, EXCEL, REST_API, or any type with a connectionId
 	SourceConfig string  `json:"sourceConfig" gorm:"type:jsonb;not null"`
 	ConnectionID *string `json:"connectionId" gorm:"index"` // FK to Connection for DB sources
 	SourceQuery  *string `json:"sourceQuery"`               // SQL query to execute on source
@@ -29,16 +29,23 @@ type Pipeline struct {
 	ScheduleCron *string `json:"scheduleCron"`
 	IsActive     bool    `json:"isActive" gorm:"default:true;index"`
 
+	// Triggers besides the schedule: upstream dependencies (Dependencies), a
+	// signed inbound webhook, and files landing in a watched directory
+	WebhookSecret *string `json:"-"`                      // HMAC secret of the trigger webhook, nil = disabled
+	WatchPath     *string `json:"watchPath"`              // Directory relative to the pipeline files directory
+	WatchPattern  *string `json:"watchPattern,omitempty"` // Glob of the file names that trigger a run, all when empty
+
 	// Safety
-	RowLimit int `json:"rowLimit" gorm:"default:100000"` // Max rows per execution
+	RowLimit int `json:"rowLimit"` // Max rows per execution, 0 = no limit
 
 	// Execution Tracking
 	LastRunAt  *time.Time `json:"lastRunAt"`
 	LastStatus *string    `json:"lastStatus"` // SUCCESS, FAILED
 
 	// Relationships
-	Executions   []JobExecution `json:"executions,omitempty" gorm:"foreignKey:PipelineID"`
-	QualityRules []QualityRule  `json:"qualityRules,omitempty" gorm:"foreignKey:PipelineID"`
+	Executions   []JobExecution       `json:"executions,omitempty" gorm:"foreignKey:PipelineID"`
+	QualityRules []QualityRule        `json:"qualityRules,omitempty" gorm:"foreignKey:PipelineID"`
+	Dependencies []PipelineDependency `json:"dependencies,omitempty" gorm:"foreignKey:PipelineID"`
 
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
@@ -49,9 +56,25 @@ func (Pipeline) TableName() string {
 	return "Pipeline"
 }
 
+// PipelineDependency is an upstream a pipeline waits for: it is triggered
+// once every one of its upstreams has succeeded since its last run
+type PipelineDependency struct {
+	ID           string `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	PipelineID   string `json:"pipelineId" gorm:"not null;index;column:pipelineId"`
+	UpstreamType string `json:"upstreamType" gorm:"not null"` // PIPELINE, DATAFLOW, MATERIALIZED_VIEW
+	UpstreamID   string `json:"upstreamId" gorm:"not null;index"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM
+func (PipelineDependency) TableName() string {
+	return "PipelineDependency"
+}
+
 // TransformStep defines a single transformation operation
 type TransformStep struct {
-	Type   string                 `json:"type"`   // FILTER, RENAME, CAST, AGGREGATE, DEDUPLICATE, VALIDATE
+	Type   string                 `json:"type"`   // FILTER, RENAME, CAST, DEDUPLICATE, AGGREGATE, JOIN, UNION, PIVOT, UNPIVOT, DERIVE, SQL
 	Config map[string]interface{} `json:"config"` // Step-specific configuration
 	Order  int                    `json:"order"`  // Execution order
 }
@@ -67,16 +90,34 @@ type SourceConfig struct {
 	SSLMode  string `json:"sslMode,omitempty"`
 	Query    string `json:"query,omitempty"`
 
-	// For CSV sources
+	// For file sources (CSV, JSON, EXCEL); FilePath is relative to the pipeline files directory
 	FilePath  string `json:"filePath,omitempty"`
-	Delimiter string `json:"delimiter,omitempty"`
-	HasHeader bool   `json:"hasHeader,omitempty"`
+	Delimiter string `json:"delimiter,omitempty"` // CSV; detected when empty
+	HasHeader *bool  `json:"hasHeader,omitempty"` // CSV and EXCEL; default true
+	SheetName string `json:"sheetName,omitempty"` // EXCEL; active sheet when empty
+	SkipRows  int    `json:"skipRows,omitempty"`
+
+	// For JSON files and REST API responses: dot path to the array of records
+	DataPath string `json:"dataPath,omitempty"`
 
 	// For REST API sources
-	URL     string            `json:"url,omitempty"`
-	Method  string            `json:"method,omitempty"`
-	Headers map[string]string `json:"headers,omitempty"`
-	Body    string            `json:"body,omitempty"`
+	URL              string            `json:"url,omitempty"`
+	Method           string            `json:"method,omitempty"`
+	Headers          map[string]string `json:"headers,omitempty"`
+	Body             string            `json:"body,omitempty"`
+	QueryParams      map[string]string `json:"queryParams,omitempty"`
+	AuthType         string            `json:"authType,omitempty"` // none, api_key, basic, bearer, oauth2, custom
+	AuthConfig       map[string]string `json:"authConfig,omitempty"`
+	PaginationType   string            `json:"paginationType,omitempty"` // none, offset, cursor, page
+	PaginationConfig map[string]string `json:"paginationConfig,omitempty"`
+	MaxPages         int               `json:"maxPages,omitempty"` // default 100
+
+	// For POSTGRES_CDC sources: the table whose changes are captured, and the
+	// replication slot and publication, created on the first run when missing
+	Table        string `json:"table,omitempty"`        // schema.table, public when unqualified
+	SlotName     string `json:"slotName,omitempty"`     // default pipeline_<id>
+	Publication  string `json:"publication,omitempty"`  // default pipeline_<id>
+	SkipSnapshot bool   `json:"skipSnapshot,omitempty"` // start from the slot without copying the table first
 }
 
 // DestConfig holds parsed destination configuration
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// PipelineBackfill reprocesses a range of a pipeline's history: the range of
+// the partition column is split into chunks, and each chunk's rows replace
+// the destination rows of that range. Backfills leave the pipeline's
+// watermark and run status alone.
+type PipelineBackfill struct {
+	ID         string `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	PipelineID string `json:"pipelineId" gorm:"not null;index;column:pipelineId"`
+
+	Column      string `json:"column" gorm:"not null"`    // Partition column, in the source rows and the destination table
+	RangeType   string `json:"rangeType" gorm:"not null"` // DATE (YYYY-MM-DD) or ID (integers)
+	RangeStart  string `json:"rangeStart" gorm:"not null"`
+	RangeEnd    string `json:"rangeEnd" gorm:"not null"` // Exclusive
+	ChunkSize   int    `json:"chunkSize"`                // Days (DATE) or IDs (ID) per chunk
+	Parallelism int    `json:"parallelism"`              // Chunks run at once
+
+	Status     string     `json:"status" gorm:"not null"` // PENDING, RUNNING, COMPLETED, FAILED, CANCELLED
+	RowsLoaded int        `json:"rowsLoaded"`
+	Error      *string    `json:"error,omitempty"`
+	CreatedBy  string     `json:"createdBy" gorm:"column:createdBy"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+
+	Chunks []PipelineBackfillChunk `json:"chunks,omitempty" gorm:"foreignKey:BackfillID"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TableName specifies the table name for GORM
+func (PipelineBackfill) TableName() string {
+	return "PipelineBackfill"
+}
+
+// PipelineBackfillChunk is one partition range of a backfill
+type PipelineBackfillChunk struct {
+	ID         string `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	BackfillID string `json:"backfillId" gorm:"not null;index;column:backfillId"`
+	Seq        int    `json:"seq"`
+
+	RangeStart string `json:"rangeStart"`
+	RangeEnd   string `json:"rangeEnd"` // Exclusive
+
+	Status      string     `json:"status"` // PENDING, RUNNING, COMPLETED, FAILED, CANCELLED
+	Attempts    int        `json:"attempts"`
+	RowsLoaded  int        `json:"rowsLoaded"`
+	RowsDeleted int        `json:"rowsDeleted"` // Destination rows of the range the chunk replaced
+	Error       *string    `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// TableName specifies the table name for GORM
+func (PipelineBackfillChunk) TableName() string {
+	return "PipelineBackfillChunk"
+}
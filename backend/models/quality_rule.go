@@ -4,15 +4,27 @@ import (
 	"time"
 )
 
-// QualityRule represents a data quality validation rule
+// QualityRule represents a data quality validation rule. Row rules check
+// every row; the other rules check the run as a whole before it is
+// committed. The value holds the rule's parameter:
+//
+//	RANGE            {"min": 0, "max": 100}
+//	REGEX            text the value must contain
+//	ALLOWED_VALUES   ["EU", "US"]
+//	REFERENTIAL      {"table": "customers", "column": "id"}, in the destination database
+//	ROW_COUNT        {"min": 1, "max": 1000000}
+//	ROW_COUNT_DELTA  {"maxPercent": 20}, versus the last loaded run
+//	FRESHNESS        {"maxAgeMinutes": 1440}, of the newest timestamp in the column
+//	DRIFT            {"metric": "mean" | "nullRate", "maxChange": 0.2}, versus the last loaded run
+//	CUSTOM_SQL       SELECT returning the number of failing rows, {{table}} being the rows of the run
 type QualityRule struct {
-	ID         string `json:"id" gorm:"primaryKey;type:varchar(30)"`
+	ID         string `json:"id" gorm:"primaryKey;type:varchar(36)"`
 	PipelineID string `json:"pipelineId" gorm:"not null;index;column:pipelineId"`
 
-	Column      string  `json:"column" gorm:"not null"`
-	RuleType    string  `json:"ruleType" gorm:"not null"`     // NOT_NULL, UNIQUE, RANGE, REGEX
+	Column      string  `json:"column"`                       // empty for ROW_COUNT, ROW_COUNT_DELTA and CUSTOM_SQL
+	RuleType    string  `json:"ruleType" gorm:"not null"`     // NOT_NULL, UNIQUE, RANGE, REGEX, ALLOWED_VALUES, REFERENTIAL, ROW_COUNT, ROW_COUNT_DELTA, FRESHNESS, DRIFT, CUSTOM_SQL
 	Value       *string `json:"value"`                        // validation parameter
-	Severity    string  `json:"severity" gorm:"default:WARN"` // WARN, FAIL
+	Severity    string  `json:"severity" gorm:"default:WARN"` // WARN, FAIL, QUARANTINE (row rules: failing rows are quarantined, not loaded)
 	Description *string `json:"description"`
 
 	// Relationship
@@ -26,3 +38,36 @@ type QualityRule struct {
 func (QualityRule) TableName() string {
 	return "QualityRule"
 }
+
+// QualityScorecard is the outcome of a pipeline run's quality rules
+type QualityScorecard struct {
+	ID          string `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	PipelineID  string `json:"pipelineId" gorm:"not null;index;column:pipelineId"`
+	ExecutionID string `json:"executionId" gorm:"not null;index;column:executionId"`
+
+	Status          string  `json:"status"` // PASSED, WARNED (WARN rules failed or rows quarantined), FAILED (the run was aborted)
+	Score           float64 `json:"score"`  // Percentage of rules passed
+	RowsChecked     int     `json:"rowsChecked"`
+	RowsQuarantined int     `json:"rowsQuarantined"`
+	Results         string  `json:"results" gorm:"type:jsonb"` // []QualityRuleResult
+	Metrics         string  `json:"metrics" gorm:"type:jsonb"` // {"column": {"mean": 1.5, "nullRate": 0.1}}, the baseline of DRIFT rules
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TableName specifies the table name for GORM
+func (QualityScorecard) TableName() string {
+	return "QualityScorecard"
+}
+
+// QualityRuleResult is the outcome of one rule in a scorecard
+type QualityRuleResult struct {
+	RuleID     string   `json:"ruleId"`
+	RuleType   string   `json:"ruleType"`
+	Column     string   `json:"column,omitempty"`
+	Severity   string   `json:"severity"`
+	Passed     bool     `json:"passed"`
+	Violations int      `json:"violations"`         // Failing rows of a row rule
+	Observed   *float64 `json:"observed,omitempty"` // Measured value of a run rule
+	Message    string   `json:"message,omitempty"`
+}
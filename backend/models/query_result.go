@@ -14,6 +14,27 @@ type QueryResult struct {
 	NextCursor    *string              `json:"nextCursor,omitempty"` // For keyset pagination
 	Analysis      *QueryAnalysisResult `json:"analysis,omitempty"`   // Optimization suggestions
 	Cached        bool                 `json:"cached"`               // GAP-008: Cache status
+
+	CalculatedFields []CalculatedFieldExecution `json:"calculatedFields,omitempty"`
+	Freshness        *DataFreshness             `json:"freshness,omitempty"` // Set when an extract answered the query
+}
+
+// DataFreshness tells how old the data of a result answered from an extract
+// is
+type DataFreshness struct {
+	ExtractID   string    `json:"extractId"`
+	ExtractName string    `json:"extractName"`
+	RefreshedAt time.Time `json:"refreshedAt"`
+	AgeSeconds  int64     `json:"ageSeconds"`
+	Refreshing  bool      `json:"refreshing"` // A newer copy is being loaded
+}
+
+// CalculatedFieldExecution reports where a calculated field was computed:
+// pushed down into the generated SQL or evaluated in memory on the fetched rows
+type CalculatedFieldExecution struct {
+	Name       string `json:"name"`
+	PushedDown bool   `json:"pushedDown"`
+	Reason     string `json:"reason,omitempty"` // Why the field could not be pushed down
 }
 
 // QueryExecutionRequest represents a request to execute a query
@@ -34,6 +34,8 @@ type ReportResourceType string
 const (
 	ReportResourceDashboard ReportResourceType = "dashboard"
 	ReportResourceQuery     ReportResourceType = "query"
+	// ReportResourceKPIScorecard digests the KPI scorecard of a semantic model (ResourceID = model ID)
+	ReportResourceKPIScorecard ReportResourceType = "kpi_scorecard"
 )
 
 // ReportRunStatus represents the status of a report run
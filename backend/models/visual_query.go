@@ -39,6 +39,8 @@ type VisualQueryConfig struct {
 	OrderBy      []OrderByClause   `json:"orderBy"`
 	Limit        *int              `json:"limit"`
 	Cursor       *string           `json:"cursor"` // Encoded cursor for keyset pagination
+
+	CalculatedFields []CalculatedField `json:"calculatedFields,omitempty"`
 }
 
 // TableSelection represents a selected table in the query
@@ -79,6 +81,17 @@ type Aggregation struct {
 	Alias    string `json:"alias"`
 }
 
+// CalculatedField is a formula-engine expression computed per row; filters,
+// group-by and order-by entries may refer to it by name. Table calculations
+// (RUNNING_SUM, RANK, LOOKUP, ...) are evaluated over the result rows, split by
+// PartitionBy and ordered by OrderBy.
+type CalculatedField struct {
+	Name        string          `json:"name"`
+	Formula     string          `json:"formula"`
+	PartitionBy []string        `json:"partitionBy,omitempty"`
+	OrderBy     []OrderByClause `json:"orderBy,omitempty"`
+}
+
 // OrderByClause represents an ORDER BY clause
 type OrderByClause struct {
 	Column    string `json:"column"`
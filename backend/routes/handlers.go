@@ -21,12 +21,20 @@ type HandlerContainer struct {
 	ConnectionHandler       *handlers.ConnectionHandler
 	QueryAnalyzerHandler    *handlers.QueryAnalyzerHandler
 	MaterializedViewHandler *handlers.MaterializedViewHandler
+	ExtractHandler          *handlers.ExtractHandler
 	EngineHandler           *handlers.EngineHandler
 	GeoJSONHandler          *handlers.GeoJSONHandler
 	DataGovernanceHandler   *handlers.DataGovernanceHandler
 	SemanticLayerHandler    *handlers.SemanticLayerHandler
+	SemanticDrillHandler    *handlers.SemanticDrillHandler
+	KPIHandler              *handlers.KPIHandler
+	SemanticCalendarHandler *handlers.SemanticCalendarHandler
+	SemanticQueryHandler    *handlers.SemanticQueryHandler
 	ModelingHandler         *handlers.ModelingHandler
+	MetricRegistryHandler   *handlers.MetricRegistryHandler
 	FormulaHandler          *handlers.FormulaHandler // GAP-004
+	FormulaFunctionHandler  *handlers.FormulaFunctionHandler
+	CalculatedFieldHandler  *handlers.CalculatedFieldHandler
 
 	// Real-time & Collaboration Handlers
 	NotificationHandler  *handlers.NotificationHandler
@@ -69,6 +69,7 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	api.Post("/visual-queries/:id/preview", m.AuthMiddleware, h.VisualQueryHandler.PreviewVisualQuery)
 	api.Get("/visual-queries/cache/stats", m.AuthMiddleware, h.VisualQueryHandler.GetCacheStats)
 	api.Post("/visual-queries/join-suggestions", m.AuthMiddleware, h.VisualQueryHandler.GetJoinSuggestions)
+	api.Post("/visual-queries/:id/calculated-fields/impact", m.AuthMiddleware, h.CalculatedFieldHandler.VisualQueryImpact)
 
 	// Materialized Views
 	api.Post("/materialized-views", m.AuthMiddleware, h.MaterializedViewHandler.CreateMaterializedView)
@@ -79,6 +80,15 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	api.Put("/materialized-views/:id/schedule", m.AuthMiddleware, h.MaterializedViewHandler.UpdateSchedule)
 	api.Get("/materialized-views/:id/status", m.AuthMiddleware, h.MaterializedViewHandler.GetStatus)
 	api.Get("/materialized-views/:id/history", m.AuthMiddleware, h.MaterializedViewHandler.GetRefreshHistory)
+	api.Get("/materialized-views/:id/chain", m.AuthMiddleware, h.MaterializedViewHandler.GetDependencyChain)
+
+	// Extracts: query results of slow sources copied into a local store
+	api.Post("/extracts", m.AuthMiddleware, h.ExtractHandler.CreateExtract)
+	api.Get("/extracts", m.AuthMiddleware, h.ExtractHandler.ListExtracts)
+	api.Get("/extracts/:id", m.AuthMiddleware, h.ExtractHandler.GetExtract)
+	api.Delete("/extracts/:id", m.AuthMiddleware, h.ExtractHandler.DeleteExtract)
+	api.Post("/extracts/:id/refresh", m.AuthMiddleware, h.ExtractHandler.RefreshExtract)
+	api.Put("/extracts/:id/schedule", m.AuthMiddleware, h.ExtractHandler.UpdateExtractSchedule)
 
 	// Connections
 	api.Get("/connections", m.AuthMiddleware, h.ConnectionHandler.GetConnections)
@@ -138,6 +148,30 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	api.Delete("/semantic/models/:id", m.AuthMiddleware, h.SemanticLayerHandler.DeleteSemanticModel)
 	api.Get("/semantic/metrics", m.AuthMiddleware, h.SemanticLayerHandler.ListSemanticMetrics)
 	api.Post("/semantic/query", m.AuthMiddleware, h.SemanticLayerHandler.ExecuteSemanticQuery)
+	api.Post("/semantic/drill/down", m.AuthMiddleware, h.SemanticDrillHandler.DrillDown)
+	api.Post("/semantic/drill/through", m.AuthMiddleware, h.SemanticDrillHandler.DrillThrough)
+	api.Post("/semantic/v2/query", m.AuthMiddleware, h.SemanticQueryHandler.Query)
+
+	// Aggregate Awareness
+	api.Get("/semantic/models/:id/aggregates", m.AuthMiddleware, h.SemanticQueryHandler.ListAggregates)
+	api.Post("/semantic/models/:id/aggregates", m.AuthMiddleware, h.SemanticQueryHandler.RegisterAggregate)
+	api.Delete("/semantic/models/:id/aggregates/:aggregateId", m.AuthMiddleware, h.SemanticQueryHandler.DeleteAggregate)
+
+	// KPI Scorecards
+	api.Get("/semantic/models/:id/kpis", m.AuthMiddleware, h.KPIHandler.ListKPIs)
+	api.Post("/semantic/models/:id/kpis", m.AuthMiddleware, h.KPIHandler.CreateKPI)
+	api.Put("/semantic/kpis/:id", m.AuthMiddleware, h.KPIHandler.UpdateKPI)
+	api.Get("/semantic/models/:id/scorecard", m.AuthMiddleware, h.KPIHandler.GetScorecard)
+	api.Post("/semantic/kpis/:id/evaluate", m.AuthMiddleware, h.KPIHandler.EvaluateKPI)
+	api.Get("/semantic/kpis/:id/history", m.AuthMiddleware, h.KPIHandler.GetHistory)
+	api.Get("/semantic/kpis/:id/targets", m.AuthMiddleware, h.KPIHandler.ListTargets)
+	api.Put("/semantic/kpis/:id/targets", m.AuthMiddleware, h.KPIHandler.SetTargets)
+	api.Post("/semantic/kpis/:id/targets/import", m.AuthMiddleware, h.KPIHandler.ImportTargets)
+
+	// Time Intelligence Calendar
+	api.Get("/semantic/calendar", m.AuthMiddleware, h.SemanticCalendarHandler.GetCalendar)
+	api.Put("/semantic/calendar", m.AuthMiddleware, h.SemanticCalendarHandler.SaveCalendar)
+	api.Get("/semantic/calendar/periods", m.AuthMiddleware, h.SemanticCalendarHandler.ListPeriods)
 
 	// Semantic Layer Chat/GenAI
 	// Note: Semantic handlers for chat are seemingly mixed directly in handlers package in main.go (handlers.Semantic*)
@@ -160,7 +194,16 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	// Let's use `handlers.SemanticExplainData` directly here since they sound global.
 
 	// Modeling
-	h.FormulaHandler.RegisterRoutes(api)
+	h.FormulaHandler.RegisterRoutes(api, m.AuthMiddleware)
+
+	// Workspace formula functions
+	api.Get("/formula-functions", m.AuthMiddleware, h.FormulaFunctionHandler.ListFunctions)
+	api.Post("/formula-functions", m.AuthMiddleware, h.FormulaFunctionHandler.CreateFunction)
+	api.Get("/formula-functions/:id", m.AuthMiddleware, h.FormulaFunctionHandler.GetFunction)
+	api.Put("/formula-functions/:id", m.AuthMiddleware, h.FormulaFunctionHandler.UpdateFunction)
+	api.Delete("/formula-functions/:id", m.AuthMiddleware, h.FormulaFunctionHandler.DeleteFunction)
+	api.Get("/formula-functions/:id/versions", m.AuthMiddleware, h.FormulaFunctionHandler.ListVersions)
+	api.Post("/formula-functions/:id/versions/:version/restore", m.AuthMiddleware, h.FormulaFunctionHandler.RestoreVersion)
 
 	api.Get("/modeling/definitions", m.AuthMiddleware, h.ModelingHandler.ListModelDefinitions)
 	api.Post("/modeling/definitions", m.AuthMiddleware, h.ModelingHandler.CreateModelDefinition)
@@ -173,6 +216,16 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	api.Put("/modeling/metrics/:id", m.AuthMiddleware, h.ModelingHandler.UpdateMetricDefinition)
 	api.Delete("/modeling/metrics/:id", m.AuthMiddleware, h.ModelingHandler.DeleteMetricDefinition)
 
+	// Metric Registry
+	api.Get("/metrics", m.AuthMiddleware, h.MetricRegistryHandler.ListMetrics)
+	api.Post("/metrics", m.AuthMiddleware, h.MetricRegistryHandler.CreateMetric)
+	api.Post("/metrics/migrate", m.AuthMiddleware, h.MetricRegistryHandler.MigrateMetrics)
+	api.Post("/metrics/validate", m.AuthMiddleware, h.MetricRegistryHandler.ValidateFormula)
+	api.Get("/metrics/:id", m.AuthMiddleware, h.MetricRegistryHandler.GetMetric)
+	api.Put("/metrics/:id", m.AuthMiddleware, h.MetricRegistryHandler.UpdateMetric)
+	api.Delete("/metrics/:id", m.AuthMiddleware, h.MetricRegistryHandler.DeleteMetric)
+	api.Post("/metrics/:id/bind", m.AuthMiddleware, h.MetricRegistryHandler.BindMetric)
+
 	// Business Glossary (TASK-125)
 	api.Get("/glossary/terms", m.AuthMiddleware, h.GlossaryHandler.ListTerms)
 	api.Post("/glossary/terms", m.AuthMiddleware, h.GlossaryHandler.CreateTerm)
@@ -198,6 +251,7 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	api.Post("/dashboards/:id/cards", m.AuthMiddleware, h.DashboardCardHandler.AddCard)
 	api.Put("/dashboards/:id/cards/positions", m.AuthMiddleware, h.DashboardCardHandler.UpdateCardPositions)
 	api.Delete("/dashboards/:id/cards", m.AuthMiddleware, h.DashboardCardHandler.RemoveCard)
+	api.Post("/dashboards/:id/cards/:cardId/calculated-fields/impact", m.AuthMiddleware, h.CalculatedFieldHandler.CardImpact)
 
 	// Collections (TASK-Gap Fix)
 	api.Get("/collections", m.AuthMiddleware, h.CollectionHandler.GetCollections)
@@ -363,6 +417,31 @@ func SetupRoutes(app *fiber.App, h *HandlerContainer, m *MiddlewareContainer) {
 	api.Put("/pipelines/:id", m.AuthMiddleware, handlers.UpdatePipeline)
 	api.Delete("/pipelines/:id", m.AuthMiddleware, handlers.DeletePipeline)
 	api.Post("/pipelines/:id/run", m.AuthMiddleware, handlers.RunPipeline)
+	api.Post("/pipelines/:id/preview", m.AuthMiddleware, handlers.PreviewPipelineSteps)
+	api.Post("/pipelines/:id/rollback", m.AuthMiddleware, handlers.RollbackPipelineLoad)
+	api.Post("/pipelines/:id/webhook", m.AuthMiddleware, handlers.EnablePipelineWebhook)
+	api.Delete("/pipelines/:id/webhook", m.AuthMiddleware, handlers.DisablePipelineWebhook)
+	api.Post("/pipelines/:id/trigger", handlers.TriggerPipelineWebhook) // Signed webhook - no auth middleware
 	api.Get("/pipelines/:id/executions", m.AuthMiddleware, handlers.GetPipelineExecutions)
+	api.Get("/pipelines/:id/scorecards", m.AuthMiddleware, handlers.GetPipelineScorecards)
+	api.Get("/pipelines/:id/quarantine", m.AuthMiddleware, handlers.GetPipelineQuarantine)
+	api.Get("/pipelines/:id/backfills", m.AuthMiddleware, handlers.GetPipelineBackfills)
+	api.Post("/pipelines/:id/backfills", m.AuthMiddleware, handlers.CreatePipelineBackfill)
+	api.Get("/pipelines/:id/backfills/:backfillId", m.AuthMiddleware, handlers.GetPipelineBackfill)
+	api.Post("/pipelines/:id/backfills/:backfillId/resume", m.AuthMiddleware, handlers.ResumePipelineBackfill)
+	api.Post("/pipelines/:id/backfills/:backfillId/cancel", m.AuthMiddleware, handlers.CancelPipelineBackfill)
 	api.Get("/pipelines/:id/stream", handlers.StreamPipelineStatus) // SSE - no auth middleware (uses query token)
+
+	// --- Dataflow Routes ---
+	api.Get("/dataflows", m.AuthMiddleware, handlers.GetDataflows)
+	api.Post("/dataflows", m.AuthMiddleware, handlers.CreateDataflow)
+	api.Put("/dataflows/:id", m.AuthMiddleware, handlers.UpdateDataflow)
+	api.Delete("/dataflows/:id", m.AuthMiddleware, handlers.DeleteDataflow)
+	api.Get("/dataflows/:id/steps", m.AuthMiddleware, handlers.GetDataflowSteps)
+	api.Put("/dataflows/:id/steps", m.AuthMiddleware, handlers.UpdateDataflowSteps)
+	api.Post("/dataflows/:id/run", m.AuthMiddleware, handlers.RunDataflow)
+	api.Get("/dataflows/:id/runs", m.AuthMiddleware, handlers.GetDataflowRuns)
+	api.Get("/dataflows/:id/runs/:runId", m.AuthMiddleware, handlers.GetDataflowRun)
+	api.Post("/dataflows/:id/runs/:runId/retry", m.AuthMiddleware, handlers.RetryDataflowRun)
+	api.Post("/dataflows/:id/runs/:runId/cancel", m.AuthMiddleware, handlers.CancelDataflowRun)
 }
@@ -17,6 +17,7 @@ type AIService struct {
 	encryptionService *EncryptionService
 	embeddingService  *EmbeddingService
 	semanticService   *SemanticLayerService
+	metricRegistry    *MetricRegistryService
 	providerFactory   *ai.ProviderFactory
 }
 
@@ -30,6 +31,54 @@ func NewAIService(encryptionService *EncryptionService, embeddingService *Embedd
 	}
 }
 
+// SetMetricRegistry makes prompt context use the canonical registry metrics
+func (s *AIService) SetMetricRegistry(registry *MetricRegistryService) {
+	s.metricRegistry = registry
+}
+
+// metricContext lists the business metrics defined for a connection so generated SQL reuses their formulas
+func (s *AIService) metricContext(connID string) string {
+	type metricLine struct{ name, formula, description string }
+	var lines []metricLine
+
+	if s.metricRegistry != nil {
+		metrics, err := s.metricRegistry.MetricsForConnection(connID)
+		if err != nil {
+			return ""
+		}
+		for _, metric := range metrics {
+			lines = append(lines, metricLine{metric.Name, metric.Formula, metric.Description})
+		}
+		unbound, err := s.metricRegistry.UnboundSemanticMetrics(connID)
+		if err != nil {
+			return ""
+		}
+		for _, metric := range unbound {
+			lines = append(lines, metricLine{metric.Name, metric.Formula, metric.Description})
+		}
+	} else if s.semanticService != nil {
+		// Metrics belong to models which belong to connections (data_source_id)
+		var modelsData []models.SemanticModel
+		if err := database.DB.Preload("Metrics").Where("data_source_id = ?", connID).Find(&modelsData).Error; err != nil {
+			return ""
+		}
+		for _, m := range modelsData {
+			for _, metric := range m.Metrics {
+				lines = append(lines, metricLine{metric.Name, metric.Formula, metric.Description})
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	metricContext := "You MUST use the following predefined Business Metrics (Formulas) when generating SQL. Do NOT invent your own formulas for these metrics:\n"
+	for _, line := range lines {
+		metricContext += fmt.Sprintf("- Metric: %s | Formula: %s | Description: %s\n", line.name, line.formula, line.description)
+	}
+	return metricContext + "\n"
+}
+
 // Generate generates content using the specified provider
 func (s *AIService) Generate(ctx context.Context, providerID, userID, prompt string, context map[string]interface{}) (*models.AIRequest, error) {
 	startTime := time.Now()
@@ -86,25 +135,7 @@ func (s *AIService) Generate(ctx context.Context, providerID, userID, prompt str
 			}
 
 			// Semantic Metric Injection
-			if s.semanticService != nil {
-				// Metrics belong to models which belong to connections (data_source_id)
-				var modelsData []models.SemanticModel
-				if err := database.DB.Preload("Metrics").Where("data_source_id = ?", connID).Find(&modelsData).Error; err == nil {
-					hasMetrics := false
-					metricContext := "You MUST use the following predefined Business Metrics (Formulas) when generating SQL. Do NOT invent your own formulas for these metrics:\n"
-
-					for _, m := range modelsData {
-						for _, metric := range m.Metrics {
-							hasMetrics = true
-							metricContext += fmt.Sprintf("- Metric: %s | Formula: %s | Description: %s\n", metric.Name, metric.Formula, metric.Description)
-						}
-					}
-
-					if hasMetrics {
-						contextPrefix += metricContext + "\n"
-					}
-				}
-			}
+			contextPrefix += s.metricContext(connID)
 		}
 
 		if contextPrefix != "" {
@@ -218,24 +249,7 @@ func (s *AIService) StreamGenerate(ctx context.Context, providerID, userID, prom
 			}
 
 			// Semantic Metric Injection
-			if s.semanticService != nil {
-				var modelsData []models.SemanticModel
-				if err := database.DB.Preload("Metrics").Where("data_source_id = ?", connID).Find(&modelsData).Error; err == nil {
-					hasMetrics := false
-					metricContext := "You MUST use the following predefined Business Metrics (Formulas) when generating SQL. Do NOT invent your own formulas for these metrics:\n"
-
-					for _, m := range modelsData {
-						for _, metric := range m.Metrics {
-							hasMetrics = true
-							metricContext += fmt.Sprintf("- Metric: %s | Formula: %s | Description: %s\n", metric.Name, metric.Formula, metric.Description)
-						}
-					}
-
-					if hasMetrics {
-						contextPrefix += metricContext + "\n"
-					}
-				}
-			}
+			contextPrefix += s.metricContext(connID)
 		}
 
 		if contextPrefix != "" {
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
+	"strings"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// CalculatedFieldImpactService reports what depends on a calculated field:
+// the calculated fields that reference it, and the cards and alerts that use
+// any of them
+type CalculatedFieldImpactService struct {
+	db     *gorm.DB
+	engine *formula_engine.FormulaEngine
+}
+
+// NewCalculatedFieldImpactService creates a new calculated field impact service
+func NewCalculatedFieldImpactService(db *gorm.DB, engine *formula_engine.FormulaEngine) *CalculatedFieldImpactService {
+	return &CalculatedFieldImpactService{db: db, engine: engine}
+}
+
+// CalculatedFieldImpact is the impact report of editing a calculated field
+type CalculatedFieldImpact struct {
+	Field string `json:"field"`
+	// Cycle is set when the edit would make fields reference each other in a loop
+	Cycle []string `json:"cycle,omitempty"`
+	// Fields are the dependent calculated fields, in recalculation order
+	Fields []string        `json:"fields"`
+	Cards  []ImpactedCard  `json:"cards"`
+	Alerts []ImpactedAlert `json:"alerts"`
+}
+
+// ImpactedCard is a dashboard card using the field or one of its dependents
+type ImpactedCard struct {
+	ID          string   `json:"id"`
+	DashboardID string   `json:"dashboardId"`
+	Title       string   `json:"title,omitempty"`
+	Fields      []string `json:"fields"` // affected fields the card uses or defines
+}
+
+// ImpactedAlert is an alert watching the field or one of its dependents
+type ImpactedAlert struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Column string `json:"column"`
+}
+
+// CardCalculatedFields decodes the calculated fields stored on a card
+func CardCalculatedFields(card *models.DashboardCard) ([]models.CalculatedField, error) {
+	var fields []models.CalculatedField
+	if len(card.CalculatedFields) == 0 || string(card.CalculatedFields) == "null" {
+		return fields, nil
+	}
+	if err := json.Unmarshal(card.CalculatedFields, &fields); err != nil {
+		return nil, fmt.Errorf("invalid calculated fields: %w", err)
+	}
+	return fields, nil
+}
+
+// ValidateCalculatedFields checks that calculated fields parse and do not
+// reference each other in a loop
+func ValidateCalculatedFields(fields []models.CalculatedField) error {
+	for _, f := range fields {
+		if strings.TrimSpace(f.Name) == "" {
+			return fmt.Errorf("calculated field name is required")
+		}
+	}
+	graph, err := formula_engine.NewFormulaEngine().DependencyGraph(namedFormulas(fields))
+	if err != nil {
+		return err
+	}
+	_, err = graph.Order()
+	return err
+}
+
+// applyEdit returns fields with the formula of field replaced, or added when
+// it is new; a nil formula reports on the field as it is
+func applyEdit(fields []models.CalculatedField, field string, formula *string) ([]models.CalculatedField, error) {
+	edited := make([]models.CalculatedField, 0, len(fields)+1)
+	found := false
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, field) {
+			found = true
+			if formula != nil {
+				f.Formula = *formula
+			}
+		}
+		edited = append(edited, f)
+	}
+	if !found {
+		if formula == nil {
+			return nil, fmt.Errorf("calculated field '%s' not found", field)
+		}
+		edited = append(edited, models.CalculatedField{Name: field, Formula: *formula})
+	}
+	return edited, nil
+}
+
+// dependents builds the report's field list; a cycle introduced by the edit is
+// recorded rather than failing, so the editor can show it
+func (s *CalculatedFieldImpactService) dependents(fields []models.CalculatedField, field string, report *CalculatedFieldImpact) error {
+	graph, err := s.engine.DependencyGraph(namedFormulas(fields))
+	if err != nil {
+		return err
+	}
+	if _, err := graph.Order(); err != nil {
+		var cycle *formula_engine.CycleError
+		if !errors.As(err, &cycle) {
+			return err
+		}
+		report.Cycle = cycle.Path
+	}
+	report.Fields = graph.Dependents(field)
+	if report.Fields == nil {
+		report.Fields = []string{}
+	}
+	return nil
+}
+
+// CardImpact reports the impact of editing a calculated field of a card
+func (s *CalculatedFieldImpactService) CardImpact(card *models.DashboardCard, field string, formula *string) (*CalculatedFieldImpact, error) {
+	fields, err := CardCalculatedFields(card)
+	if err != nil {
+		return nil, err
+	}
+	if fields, err = applyEdit(fields, field, formula); err != nil {
+		return nil, err
+	}
+
+	report := &CalculatedFieldImpact{Field: field, Cards: []ImpactedCard{}, Alerts: []ImpactedAlert{}}
+	if err := s.dependents(fields, field, report); err != nil {
+		return nil, err
+	}
+
+	// The card defines every affected field
+	affected := append([]string{field}, report.Fields...)
+	owner := impactedCard(card, nil)
+	owner.Fields = affected
+	report.Cards = append(report.Cards, owner)
+	if card.QueryID != nil {
+		if report.Alerts, err = s.alertsOn(card.QueryID.String(), affected); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// VisualQueryImpact reports the impact of editing a calculated field of a
+// visual query, including the cards built on it and their own calculated fields
+func (s *CalculatedFieldImpactService) VisualQueryImpact(query *models.VisualQuery, field string, formula *string) (*CalculatedFieldImpact, error) {
+	var config models.VisualQueryConfig
+	if err := json.Unmarshal(query.Config, &config); err != nil {
+		return nil, fmt.Errorf("invalid visual query config: %w", err)
+	}
+	fields, err := applyEdit(config.CalculatedFields, field, formula)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CalculatedFieldImpact{Field: field, Cards: []ImpactedCard{}, Alerts: []ImpactedAlert{}}
+	if err := s.dependents(fields, field, report); err != nil {
+		return nil, err
+	}
+	affected := append([]string{field}, report.Fields...)
+
+	var cards []models.DashboardCard
+	if err := s.db.Where("query_id = ?", query.ID).Find(&cards).Error; err != nil {
+		return nil, err
+	}
+	for i := range cards {
+		// A card's own fields may build on the query's fields
+		used := affected
+		if cardFields, err := CardCalculatedFields(&cards[i]); err == nil && len(cardFields) > 0 {
+			combined := append(append([]models.CalculatedField{}, fields...), cardFields...)
+			if graph, err := s.engine.DependencyGraph(namedFormulas(combined)); err == nil {
+				used = append(append([]string{}, affected...), graph.Dependents(field)...)
+			}
+		}
+		if entry := impactedCard(&cards[i], used); len(entry.Fields) > 0 {
+			report.Cards = append(report.Cards, entry)
+		}
+	}
+
+	if report.Alerts, err = s.alertsOn(query.ID, affected); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// impactedCard lists which of the affected fields a card defines or mentions
+// in its visualization config
+func impactedCard(card *models.DashboardCard, affected []string) ImpactedCard {
+	entry := ImpactedCard{ID: card.ID.String(), DashboardID: card.DashboardID.String(), Fields: []string{}}
+	if card.Title != nil {
+		entry.Title = *card.Title
+	}
+	defined := make(map[string]bool)
+	if fields, err := CardCalculatedFields(card); err == nil {
+		for _, f := range fields {
+			defined[strings.ToLower(f.Name)] = true
+		}
+	}
+	seen := make(map[string]bool)
+	for _, name := range affected {
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		if defined[key] || jsonMentions(card.VisualizationConfig, name) {
+			seen[key] = true
+			entry.Fields = append(entry.Fields, name)
+		}
+	}
+	return entry
+}
+
+// jsonMentions reports whether any string value in a JSON document equals name
+func jsonMentions(doc datatypes.JSON, name string) bool {
+	if len(doc) == 0 {
+		return false
+	}
+	var value interface{}
+	if err := json.Unmarshal(doc, &value); err != nil {
+		return false
+	}
+	var walk func(v interface{}) bool
+	walk = func(v interface{}) bool {
+		switch t := v.(type) {
+		case string:
+			return strings.EqualFold(t, name)
+		case []interface{}:
+			for _, item := range t {
+				if walk(item) {
+					return true
+				}
+			}
+		case map[string]interface{}:
+			for _, item := range t {
+				if walk(item) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return walk(value)
+}
+
+func (s *CalculatedFieldImpactService) alertsOn(queryID string, affected []string) ([]ImpactedAlert, error) {
+	var alerts []models.Alert
+	if err := s.db.Where("query_id = ?", queryID).Find(&alerts).Error; err != nil {
+		return nil, err
+	}
+	impacted := []ImpactedAlert{}
+	for _, alert := range alerts {
+		for _, name := range affected {
+			if strings.EqualFold(alert.Column, name) {
+				impacted = append(impacted, ImpactedAlert{ID: alert.ID, Name: alert.Name, Column: alert.Column})
+				break
+			}
+		}
+	}
+	return impacted, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+
+	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/datatypes"
+)
+
+func TestCardImpact_DependentsAndCycle(t *testing.T) {
+	svc := NewCalculatedFieldImpactService(nil, formula_engine.NewFormulaEngine())
+	card := &models.DashboardCard{
+		ID:          uuid.New(),
+		DashboardID: uuid.New(),
+		CalculatedFields: datatypes.JSON(`[
+			{"name": "Profit", "formula": "[Sales] - [Cost]"},
+			{"name": "Margin", "formula": "[Profit] / [Sales]"},
+			{"name": "MarginPct", "formula": "[Margin] * 100"}
+		]`),
+	}
+
+	report, err := svc.CardImpact(card, "Profit", nil)
+	require.NoError(t, err)
+	assert.Empty(t, report.Cycle)
+	assert.Equal(t, []string{"Margin", "MarginPct"}, report.Fields)
+	require.Len(t, report.Cards, 1)
+	assert.Equal(t, []string{"Profit", "Margin", "MarginPct"}, report.Cards[0].Fields)
+
+	formula := "[MarginPct] * [Sales]"
+	report, err = svc.CardImpact(card, "Profit", &formula)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Profit", "MarginPct", "Margin", "Profit"}, report.Cycle)
+
+	_, err = svc.CardImpact(card, "Missing", nil)
+	assert.Error(t, err)
+}
+
+func TestValidateCalculatedFields(t *testing.T) {
+	assert.NoError(t, ValidateCalculatedFields([]models.CalculatedField{
+		{Name: "b", Formula: "[a] * 2"},
+		{Name: "a", Formula: "[Sales] + 1"},
+	}))
+	assert.ErrorContains(t, ValidateCalculatedFields([]models.CalculatedField{
+		{Name: "a", Formula: "[b] + 1"},
+		{Name: "b", Formula: "[a] + 1"},
+	}), "a -> b -> a")
+	assert.Error(t, ValidateCalculatedFields([]models.CalculatedField{{Name: "", Formula: "1"}}))
+}
+
+func TestJSONMentions(t *testing.T) {
+	doc := datatypes.JSON(`{"xAxis": "Region", "series": [{"field": "margin"}]}`)
+	assert.True(t, jsonMentions(doc, "Margin"))
+	assert.False(t, jsonMentions(doc, "Profit"))
+	assert.False(t, jsonMentions(nil, "Margin"))
+}
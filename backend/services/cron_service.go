@@ -15,6 +15,7 @@ type CronService struct {
 	scheduledReportService *ScheduledReportService
 	alertService           *AlertService
 	pulseService           *PulseService
+	kpiService             *KPIService
 }
 
 // SetPulseService injects the pulse service
@@ -22,6 +23,11 @@ func (s *CronService) SetPulseService(pulseService *PulseService) {
 	s.pulseService = pulseService
 }
 
+// SetKPIService injects the KPI evaluation service
+func (s *CronService) SetKPIService(kpiService *KPIService) {
+	s.kpiService = kpiService
+}
+
 // NewCronService creates a new cron service
 func NewCronService(db *gorm.DB) *CronService {
 	return &CronService{
@@ -167,6 +173,21 @@ func (s *CronService) Start() {
 		LogError("cron_schedule", "Failed to schedule pulse processing job", map[string]interface{}{"error": err})
 	}
 
+	// KPI evaluation - runs every minute, each KPI follows its own schedule
+	_, err = s.cron.AddFunc("* * * * *", func() {
+		if s.kpiService != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			defer cancel()
+
+			if err := s.kpiService.ProcessDueKPIs(ctx); err != nil {
+				LogError("cron_kpis", "Failed to process KPI evaluations", map[string]interface{}{"error": err})
+			}
+		}
+	})
+	if err != nil {
+		LogError("cron_schedule", "Failed to schedule KPI evaluation job", map[string]interface{}{"error": err})
+	}
+
 	// Cleanup old report runs - runs daily at 3 AM
 	_, err = s.cron.AddFunc("0 3 * * *", func() {
 		LogInfo("cron_report_cleanup", "Cleaning up old report runs", nil)
@@ -377,6 +377,206 @@ func (imp *CSVImporter) ImportCSV(
 	return result, nil
 }
 
+// ReadCSVRows reads every row of a CSV file into records keyed by the cleaned
+// column names, with values converted to the detected column types
+func (imp *CSVImporter) ReadCSVRows(
+	ctx context.Context,
+	r io.Reader,
+	options *CSVImportOptions,
+) ([]map[string]interface{}, error) {
+	reader, err := imp.newCSVRowReader(ctx, r, options)
+	if err != nil {
+		return nil, err
+	}
+	var records []map[string]interface{}
+	for {
+		batch, err := reader.next(ctx, 1000)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, batch...)
+	}
+}
+
+// csvRowReader reads the records of a CSV file a batch at a time. Column
+// types are detected from the first rows, which are held until read.
+type csvRowReader struct {
+	imp     *CSVImporter
+	reader  *csv.Reader
+	options *CSVImportOptions
+	columns []CSVColumn
+	nulls   map[string]bool
+	pending [][]string // rows read for type detection and not returned yet
+	read    int        // rows read from the file
+	done    bool
+}
+
+func (imp *CSVImporter) newCSVRowReader(ctx context.Context, r io.Reader, options *CSVImportOptions) (*csvRowReader, error) {
+	if options == nil {
+		options = imp.GetDefaultOptions()
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = options.Delimiter
+	reader.TrimLeadingSpace = options.TrimWhitespace
+	reader.FieldsPerRecord = -1 // Ragged rows are padded below
+
+	for i := 0; i < options.SkipRows; i++ {
+		if _, err := reader.Read(); err != nil {
+			return nil, fmt.Errorf("failed to skip row %d: %w", i, err)
+		}
+	}
+
+	var headers []string
+	if options.HasHeader {
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+		headers = imp.cleanHeaders(header)
+	}
+
+	cr := &csvRowReader{imp: imp, reader: reader, options: options}
+	sample, err := cr.readRows(ctx, imp.sampleSize)
+	if err != nil {
+		return nil, err
+	}
+	if headers == nil {
+		width := 0
+		if len(sample) > 0 {
+			width = len(sample[0])
+		}
+		headers = make([]string, width)
+		for i := range headers {
+			headers[i] = fmt.Sprintf("column_%d", i+1)
+		}
+	}
+	cr.columns = imp.detectColumnTypes(headers, sample, options)
+	cr.nulls = nullMarkers(options)
+	cr.pending = sample
+	return cr, nil
+}
+
+// readRows reads up to n rows, stopping at MaxRows
+func (cr *csvRowReader) readRows(ctx context.Context, n int) ([][]string, error) {
+	var rows [][]string
+	for len(rows) < n && !cr.done && (cr.options.MaxRows <= 0 || cr.read < cr.options.MaxRows) {
+		if cr.read%1000 == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		row, err := cr.reader.Read()
+		if err == io.EOF {
+			cr.done = true
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed CSV: %w", err)
+		}
+		rows = append(rows, row)
+		cr.read++
+	}
+	return rows, nil
+}
+
+// next returns up to n records, or io.EOF after the last
+func (cr *csvRowReader) next(ctx context.Context, n int) ([]map[string]interface{}, error) {
+	rows := cr.pending
+	cr.pending = nil
+	if len(rows) > n {
+		rows, cr.pending = rows[:n], rows[n:]
+	} else if len(rows) < n {
+		more, err := cr.readRows(ctx, n-len(rows))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, more...)
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+
+	records := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		records[i] = cr.imp.typedRecord(cr.columns, cr.nulls, row, cr.options)
+	}
+	return records, nil
+}
+
+// typedRecords turns string rows into records, converting values to the
+// column types detected from a sample of the rows
+func (imp *CSVImporter) typedRecords(headers []string, rows [][]string, options *CSVImportOptions) []map[string]interface{} {
+	sample := rows
+	if len(sample) > imp.sampleSize {
+		sample = sample[:imp.sampleSize]
+	}
+	columns := imp.detectColumnTypes(headers, sample, options)
+	nulls := nullMarkers(options)
+
+	records := make([]map[string]interface{}, len(rows))
+	for r, row := range rows {
+		records[r] = imp.typedRecord(columns, nulls, row, options)
+	}
+	return records
+}
+
+// nullMarkers returns the set of values read as NULL
+func nullMarkers(options *CSVImportOptions) map[string]bool {
+	nulls := make(map[string]bool, len(options.NullValues))
+	for _, v := range options.NullValues {
+		nulls[v] = true
+	}
+	return nulls
+}
+
+// typedRecord turns a string row into a record of the detected column types.
+// NULL markers become nil and values that do not parse as their column type
+// stay text.
+func (imp *CSVImporter) typedRecord(columns []CSVColumn, nulls map[string]bool, row []string, options *CSVImportOptions) map[string]interface{} {
+	record := make(map[string]interface{}, len(columns))
+	for i, col := range columns {
+		if i >= len(row) {
+			record[col.Name] = nil
+			continue
+		}
+		value := row[i]
+		if options.TrimWhitespace {
+			value = strings.TrimSpace(value)
+		}
+		if nulls[strings.TrimSpace(value)] {
+			record[col.Name] = nil
+			continue
+		}
+		record[col.Name] = imp.convertValue(value, col.DetectedType)
+	}
+	return record
+}
+
+// convertValue parses a value as a detected column type
+func (imp *CSVImporter) convertValue(value string, detectedType string) interface{} {
+	trimmed := strings.TrimSpace(value)
+	switch detectedType {
+	case "integer":
+		if n, err := strconv.ParseInt(trimmed, 10, 64); err == nil {
+			return n
+		}
+	case "float":
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		switch strings.ToLower(trimmed) {
+		case "true", "yes", "1", "t", "y":
+			return true
+		case "false", "no", "0", "f", "n":
+			return false
+		}
+	}
+	return value
+}
+
 // ValidateCSVFile validates CSV file before import
 func (imp *CSVImporter) ValidateCSVFile(fileHeader *multipart.FileHeader) error {
 	// Check file size
@@ -0,0 +1,682 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"insight-engine-backend/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultDataflowParallelism bounds how many steps of one run execute at once
+const DefaultDataflowParallelism = 4
+
+// dataflowStepConfig is the decoded DataflowStep.Config
+type dataflowStepConfig struct {
+	Inputs       []string `json:"inputs"`
+	Output       string   `json:"output"`
+	SQL          string   `json:"sql"`
+	ConnectionID string   `json:"connectionId"`
+	SourceStepID string   `json:"sourceStepId"`
+	TargetTable  string   `json:"targetTable"`
+	Mode         string   `json:"mode"`
+}
+
+// dataflowDataset is the output of a step, handed to the steps reading it
+type dataflowDataset struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// dataflowStepRunner executes one step type; input is the dataset of the
+// step's source, nil for steps that do not consume one
+type dataflowStepRunner func(ctx context.Context, step *models.DataflowStep, config *dataflowStepConfig, input *dataflowDataset) (*dataflowDataset, error)
+
+// dataflowNode is a step of a validated dataflow
+type dataflowNode struct {
+	step   *models.DataflowStep
+	config dataflowStepConfig
+	deps   []int // upstream steps, as positions in the plan
+	source int   // upstream step whose rows the step consumes, -1 if none
+}
+
+// dataflowPlan is the dependency graph of a dataflow's steps
+type dataflowPlan struct {
+	nodes []*dataflowNode
+}
+
+// DataflowExecutor runs dataflows as a DAG of steps: a step starts once the
+// steps it declares as inputs completed, and independent steps run in parallel
+type DataflowExecutor struct {
+	db            *gorm.DB
+	queryExecutor *QueryExecutor
+	maxParallel   int
+	runners       map[string]dataflowStepRunner
+	onCompleted   func(run *models.DataflowRun) // called after a run completes successfully
+}
+
+// SetCompletionListener registers a callback invoked after each successful run
+func (x *DataflowExecutor) SetCompletionListener(fn func(run *models.DataflowRun)) {
+	x.onCompleted = fn
+}
+
+// NewDataflowExecutor creates a new dataflow executor
+func NewDataflowExecutor(db *gorm.DB, queryExecutor *QueryExecutor) *DataflowExecutor {
+	x := &DataflowExecutor{
+		db:            db,
+		queryExecutor: queryExecutor,
+		maxParallel:   DefaultDataflowParallelism,
+	}
+	x.runners = map[string]dataflowStepRunner{
+		"QUERY":       x.runQuery,
+		"MATERIALIZE": x.runMaterialize,
+	}
+	return x
+}
+
+// SetMaxParallel sets how many steps of one run execute at once
+func (x *DataflowExecutor) SetMaxParallel(n int) {
+	if n > 0 {
+		x.maxParallel = n
+	}
+}
+
+// ValidateDataflowSteps checks a dataflow definition before it is saved:
+// known step types, required settings, inputs that name existing steps and
+// no dependency cycles
+func ValidateDataflowSteps(steps []models.DataflowStep) error {
+	_, err := planDataflow(steps)
+	return err
+}
+
+// DataflowConnectionIDs lists the connections a dataflow's steps use, so
+// callers can check the user may access them
+func DataflowConnectionIDs(steps []models.DataflowStep) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, step := range steps {
+		var config dataflowStepConfig
+		if err := json.Unmarshal([]byte(step.Config), &config); err != nil || config.ConnectionID == "" {
+			continue
+		}
+		if !seen[config.ConnectionID] {
+			seen[config.ConnectionID] = true
+			ids = append(ids, config.ConnectionID)
+		}
+	}
+	return ids
+}
+
+func planDataflow(steps []models.DataflowStep) (*dataflowPlan, error) {
+	plan := &dataflowPlan{nodes: make([]*dataflowNode, len(steps))}
+	refs := make(map[string]int) // step ID, lower-cased name or output -> position
+	claim := func(key string, i int) error {
+		if key == "" {
+			return nil
+		}
+		if j, ok := refs[key]; ok && j != i {
+			return fmt.Errorf("steps '%s' and '%s' share the name or output '%s'", steps[j].Name, steps[i].Name, key)
+		}
+		refs[key] = i
+		return nil
+	}
+
+	for i := range steps {
+		step := &steps[i]
+		node := &dataflowNode{step: step, source: -1}
+		if strings.TrimSpace(step.Name) == "" {
+			return nil, fmt.Errorf("step %d: name is required", i+1)
+		}
+		if step.Config != "" {
+			if err := json.Unmarshal([]byte(step.Config), &node.config); err != nil {
+				return nil, fmt.Errorf("step '%s': invalid config: %w", step.Name, err)
+			}
+		}
+		if err := validateDataflowStepConfig(step, &node.config); err != nil {
+			return nil, err
+		}
+		plan.nodes[i] = node
+
+		if step.ID != "" {
+			refs[step.ID] = i
+		}
+		if err := claim(strings.ToLower(step.Name), i); err != nil {
+			return nil, err
+		}
+		if err := claim(strings.ToLower(node.config.Output), i); err != nil {
+			return nil, err
+		}
+	}
+
+	resolve := func(node *dataflowNode, ref string) (int, error) {
+		if j, ok := refs[ref]; ok {
+			return j, nil
+		}
+		if j, ok := refs[strings.ToLower(ref)]; ok {
+			return j, nil
+		}
+		return -1, fmt.Errorf("step '%s': unknown input '%s'", node.step.Name, ref)
+	}
+	for i, node := range plan.nodes {
+		seen := make(map[int]bool)
+		inputs := node.config.Inputs
+		if node.config.SourceStepID != "" {
+			inputs = append([]string{node.config.SourceStepID}, inputs...)
+		}
+		for _, ref := range inputs {
+			j, err := resolve(node, ref)
+			if err != nil {
+				return nil, err
+			}
+			if j == i {
+				return nil, fmt.Errorf("step '%s' cannot be its own input", node.step.Name)
+			}
+			if !seen[j] {
+				seen[j] = true
+				node.deps = append(node.deps, j)
+			}
+		}
+		if node.step.Type == "MATERIALIZE" {
+			node.source = node.deps[0]
+			if plan.nodes[node.source].step.Type != "QUERY" {
+				return nil, fmt.Errorf("step '%s': source '%s' must be a QUERY step", node.step.Name, plan.nodes[node.source].step.Name)
+			}
+		}
+	}
+
+	if cycle := plan.cycle(); cycle != nil {
+		return nil, fmt.Errorf("dataflow steps form a dependency cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return plan, nil
+}
+
+func validateDataflowStepConfig(step *models.DataflowStep, config *dataflowStepConfig) error {
+	switch step.Type {
+	case "QUERY":
+		if strings.TrimSpace(config.SQL) == "" {
+			return fmt.Errorf("step '%s': sql is required", step.Name)
+		}
+		if config.ConnectionID == "" {
+			return fmt.Errorf("step '%s': connectionId is required", step.Name)
+		}
+	case "MATERIALIZE":
+		if config.SourceStepID == "" && len(config.Inputs) == 0 {
+			return fmt.Errorf("step '%s': sourceStepId is required", step.Name)
+		}
+		if config.TargetTable == "" {
+			return fmt.Errorf("step '%s': targetTable is required", step.Name)
+		}
+		if config.ConnectionID == "" {
+			return fmt.Errorf("step '%s': connectionId is required", step.Name)
+		}
+		switch strings.ToLower(config.Mode) {
+		case "", "overwrite", "append":
+		default:
+			return fmt.Errorf("step '%s': mode must be overwrite or append", step.Name)
+		}
+	default:
+		return fmt.Errorf("step '%s': unknown step type '%s'", step.Name, step.Type)
+	}
+	return nil
+}
+
+// cycle returns the step names along a dependency cycle, or nil
+func (p *dataflowPlan) cycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(p.nodes))
+	var stack []int
+	var found []string
+
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		switch state[i] {
+		case done:
+			return false
+		case visiting:
+			for k := len(stack) - 1; k >= 0; k-- {
+				if stack[k] == i {
+					for _, j := range stack[k:] {
+						found = append(found, p.nodes[j].step.Name)
+					}
+					break
+				}
+			}
+			found = append(found, p.nodes[i].step.Name)
+			return true
+		}
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range p.nodes[i].deps {
+			if visit(j) {
+				return true
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = done
+		return false
+	}
+	for i := range p.nodes {
+		if visit(i) {
+			return found
+		}
+	}
+	return nil
+}
+
+// dataflowRunState is the shared record of a run while its steps execute
+type dataflowRunState struct {
+	mu   sync.Mutex
+	x    *DataflowExecutor
+	run  *models.DataflowRun
+	logs models.DataflowRunLogs // Steps are in plan order
+}
+
+func (s *dataflowRunState) update(i int, change func(rec *models.DataflowStepRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change(&s.logs.Steps[i])
+	s.run.SetStepLogs(s.logs)
+	s.x.db.Model(&models.DataflowRun{}).Where("id = ?", s.run.ID).Update("logs", s.run.Logs)
+}
+
+type dataflowStepResult struct {
+	node   int
+	output *dataflowDataset
+	err    error
+}
+
+// Run executes a PENDING run. When the run retries a failed one (see
+// DataflowRunLogs.RetryOf), steps that completed before are reused, except
+// QUERY steps whose rows a re-run step needs. Step failures skip the steps
+// downstream of them and fail the run; cancelling ctx cancels the run. The
+// returned error is set only when the run could not be started.
+func (x *DataflowExecutor) Run(ctx context.Context, run *models.DataflowRun) error {
+	var steps []models.DataflowStep
+	if err := x.db.Where(`"dataflowId" = ?`, run.DataflowID).Order(`"order" ASC`).Find(&steps).Error; err != nil {
+		return fmt.Errorf("failed to load dataflow steps: %w", err)
+	}
+
+	run.Status = "RUNNING"
+	plan, err := planDataflow(steps)
+	if err != nil {
+		return x.finish(run, "FAILED", err.Error())
+	}
+	if len(plan.nodes) == 0 {
+		return x.finish(run, "FAILED", "dataflow has no steps")
+	}
+
+	// Seed the step records, reusing what a retried run completed
+	previous := make(map[string]models.DataflowStepRun)
+	seeded := run.StepLogs()
+	for _, rec := range seeded.Steps {
+		previous[rec.StepID] = rec
+	}
+	state := &dataflowRunState{x: x, run: run}
+	state.logs.RetryOf = seeded.RetryOf
+	mustRun := make([]bool, len(plan.nodes))
+	for i, node := range plan.nodes {
+		rec := models.DataflowStepRun{StepID: node.step.ID, Name: node.step.Name, Type: node.step.Type, Status: "PENDING"}
+		if prev, ok := previous[node.step.ID]; ok && prev.Status == "COMPLETED" {
+			rec = prev
+			rec.Reused = true
+		} else {
+			mustRun[i] = true
+		}
+		state.logs.Steps = append(state.logs.Steps, rec)
+	}
+	// Step outputs are not kept between runs, so sources of re-run steps run again
+	for changed := true; changed; {
+		changed = false
+		for i, node := range plan.nodes {
+			if mustRun[i] && node.source >= 0 && !mustRun[node.source] {
+				mustRun[node.source] = true
+				state.logs.Steps[node.source].Status = "PENDING"
+				state.logs.Steps[node.source].Reused = false
+				changed = true
+			}
+		}
+	}
+
+	run.SetStepLogs(state.logs)
+	if err := x.db.Model(&models.DataflowRun{}).Where("id = ?", run.ID).
+		Updates(map[string]interface{}{"status": "RUNNING", "logs": run.Logs}).Error; err != nil {
+		return fmt.Errorf("failed to update run: %w", err)
+	}
+
+	failure := x.execute(ctx, plan, mustRun, state)
+
+	switch {
+	case failure != "":
+		return x.finish(run, "FAILED", failure)
+	case ctx.Err() != nil:
+		return x.finish(run, "CANCELLED", "run was cancelled")
+	default:
+		return x.finish(run, "COMPLETED", "")
+	}
+}
+
+// execute schedules the steps that must run and returns the first failure
+func (x *DataflowExecutor) execute(ctx context.Context, plan *dataflowPlan, mustRun []bool, state *dataflowRunState) string {
+	n := len(plan.nodes)
+	waiting := make([]int, n)      // unfinished upstream steps
+	consumers := make([]int, n)    // pending steps reading the output
+	dependents := make([][]int, n) // downstream steps
+	for i, node := range plan.nodes {
+		for _, j := range node.deps {
+			dependents[j] = append(dependents[j], i)
+			if mustRun[j] {
+				waiting[i]++
+			}
+		}
+		if node.source >= 0 && mustRun[i] {
+			consumers[node.source]++
+		}
+	}
+
+	var ready []int
+	for i := range plan.nodes {
+		if mustRun[i] && waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	outputs := make(map[int]*dataflowDataset)
+	blocked := make([]bool, n)
+	results := make(chan dataflowStepResult)
+	running := 0
+	failure := ""
+
+	var skip func(i int, reason string)
+	skip = func(i int, reason string) {
+		for _, d := range dependents[i] {
+			if mustRun[d] && !blocked[d] {
+				blocked[d] = true
+				state.update(d, func(rec *models.DataflowStepRun) {
+					rec.Status = "SKIPPED"
+					rec.Error = reason
+				})
+				skip(d, reason)
+			}
+		}
+	}
+
+	for {
+		for len(ready) > 0 && running < x.maxParallel && ctx.Err() == nil {
+			i := ready[0]
+			ready = ready[1:]
+			node := plan.nodes[i]
+			var input *dataflowDataset
+			if node.source >= 0 {
+				input = outputs[node.source]
+			}
+			running++
+			go func() {
+				output, err := x.runStep(ctx, i, node, input, state)
+				results <- dataflowStepResult{node: i, output: output, err: err}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+
+		res := <-results
+		running--
+		node := plan.nodes[res.node]
+		if node.source >= 0 {
+			if consumers[node.source]--; consumers[node.source] == 0 {
+				delete(outputs, node.source)
+			}
+		}
+		if res.err != nil {
+			// Steps downstream of a cancelled step are cancelled below
+			if ctx.Err() == nil {
+				if failure == "" {
+					failure = fmt.Sprintf("step '%s' failed: %v", node.step.Name, res.err)
+				}
+				skip(res.node, fmt.Sprintf("upstream step '%s' failed", node.step.Name))
+			}
+			continue
+		}
+		if consumers[res.node] > 0 {
+			outputs[res.node] = res.output
+		}
+		for _, d := range dependents[res.node] {
+			if !mustRun[d] {
+				continue
+			}
+			if waiting[d]--; waiting[d] == 0 && !blocked[d] {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	// Steps that never started were cancelled with the run
+	if ctx.Err() != nil {
+		for i := range plan.nodes {
+			if mustRun[i] && state.logs.Steps[i].Status == "PENDING" {
+				state.update(i, func(rec *models.DataflowStepRun) {
+					rec.Status = "CANCELLED"
+				})
+			}
+		}
+	}
+	return failure
+}
+
+func (x *DataflowExecutor) runStep(ctx context.Context, i int, node *dataflowNode, input *dataflowDataset, state *dataflowRunState) (*dataflowDataset, error) {
+	started := time.Now()
+	state.update(i, func(rec *models.DataflowStepRun) {
+		rec.Status = "RUNNING"
+		rec.StartedAt = &started
+		rec.CompletedAt = nil
+		rec.Error = ""
+		rec.RowCount = 0
+	})
+
+	output, err := x.runners[node.step.Type](ctx, node.step, &node.config, input)
+
+	completed := time.Now()
+	state.update(i, func(rec *models.DataflowStepRun) {
+		rec.CompletedAt = &completed
+		rec.DurationMs = completed.Sub(started).Milliseconds()
+		switch {
+		case err != nil && ctx.Err() != nil:
+			rec.Status = "CANCELLED"
+		case err != nil:
+			rec.Status = "FAILED"
+			rec.Error = err.Error()
+		default:
+			rec.Status = "COMPLETED"
+			if output != nil {
+				rec.RowCount = len(output.Rows)
+			}
+		}
+	})
+	return output, err
+}
+
+func (x *DataflowExecutor) finish(run *models.DataflowRun, status string, message string) error {
+	now := time.Now()
+	run.Status = status
+	run.CompletedAt = &now
+	run.Error = nil
+	if message != "" {
+		run.Error = &message
+	}
+	if err := x.db.Model(&models.DataflowRun{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+		"status":      run.Status,
+		"completedAt": run.CompletedAt,
+		"error":       run.Error,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to update run: %w", err)
+	}
+	LogInfo("dataflow_run_complete", fmt.Sprintf("Dataflow %s run %s: %s", run.DataflowID, run.ID, status), nil)
+	if status == "COMPLETED" && x.onCompleted != nil {
+		x.onCompleted(run)
+	}
+	return nil
+}
+
+func (x *DataflowExecutor) connection(id string) (*models.Connection, error) {
+	var conn models.Connection
+	if err := x.db.First(&conn, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("connection not found: %w", err)
+	}
+	return &conn, nil
+}
+
+// runQuery executes a QUERY step's SQL on its connection
+func (x *DataflowExecutor) runQuery(ctx context.Context, step *models.DataflowStep, config *dataflowStepConfig, _ *dataflowDataset) (*dataflowDataset, error) {
+	conn, err := x.connection(config.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := x.queryExecutor.Execute(ctx, conn, config.SQL, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, errors.New(*result.Error)
+	}
+	return &dataflowDataset{Columns: result.Columns, Rows: result.Rows}, nil
+}
+
+// runMaterialize writes the rows of the step's source into a table on its
+// connection, replacing the table or appending to it
+func (x *DataflowExecutor) runMaterialize(ctx context.Context, step *models.DataflowStep, config *dataflowStepConfig, input *dataflowDataset) (*dataflowDataset, error) {
+	if input == nil {
+		return nil, fmt.Errorf("no input rows")
+	}
+	conn, err := x.connection(config.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.Type == "duckdb" || conn.Type == "sqlite_memory" {
+		return nil, fmt.Errorf("materializing into %s connections is not supported", conn.Type)
+	}
+	db, err := x.queryExecutor.getConnection(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDataflowTable(ctx, db, conn.Type, config.TargetTable, strings.ToLower(config.Mode) == "append", input); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// writeDataflowTable stores a dataset as a table of TEXT columns (the raw
+// ingestion pattern of pipeline loads), recreating it unless appending
+func writeDataflowTable(ctx context.Context, db *sql.DB, connType string, table string, appendRows bool, data *dataflowDataset) error {
+	dialect := normalizeSQLDialect(connType)
+	switch dialect {
+	case "postgres", "mysql", "sqlite", "sqlserver":
+	default:
+		return fmt.Errorf("materializing into %s connections is not supported", connType)
+	}
+	if len(data.Columns) == 0 {
+		return fmt.Errorf("source returned no columns")
+	}
+
+	quote := func(name string) string {
+		name = strings.Map(func(r rune) rune {
+			if r == '"' || r == '`' || r == '[' || r == ']' {
+				return -1
+			}
+			return r
+		}, name)
+		switch dialect {
+		case "mysql":
+			return "`" + name + "`"
+		case "sqlserver":
+			return "[" + name + "]"
+		default:
+			return `"` + name + `"`
+		}
+	}
+	placeholder := func(n int) string {
+		switch dialect {
+		case "postgres":
+			return fmt.Sprintf("$%d", n)
+		case "sqlserver":
+			return fmt.Sprintf("@p%d", n)
+		default:
+			return "?"
+		}
+	}
+
+	target := quote(table)
+	columns := make([]string, len(data.Columns))
+	defs := make([]string, len(data.Columns))
+	for i, col := range data.Columns {
+		columns[i] = quote(col)
+		defs[i] = columns[i] + " TEXT"
+	}
+	sorted := append([]string(nil), columns...)
+	sort.Strings(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			return fmt.Errorf("source has duplicate column %s", sorted[i])
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if !appendRows {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", target)); err != nil {
+			return fmt.Errorf("failed to drop table: %w", err)
+		}
+	}
+	create := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", target, strings.Join(defs, ", "))
+	if dialect == "sqlserver" {
+		create = fmt.Sprintf("IF OBJECT_ID(N'%s', N'U') IS NULL CREATE TABLE %s (%s)", strings.ReplaceAll(table, "'", "''"), target, strings.Join(defs, ", "))
+	}
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+
+	// Batch inserts, keeping each statement under common parameter limits
+	batchSize := 1000 / len(columns)
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	for start := 0; start < len(data.Rows); start += batchSize {
+		end := start + batchSize
+		if end > len(data.Rows) {
+			end = len(data.Rows)
+		}
+		var values []string
+		var args []interface{}
+		for _, row := range data.Rows[start:end] {
+			marks := make([]string, len(columns))
+			for i := range columns {
+				marks[i] = placeholder(len(args) + 1)
+				var val interface{}
+				if i < len(row) && row[i] != nil {
+					val = fmt.Sprintf("%v", row[i])
+				}
+				args = append(args, val)
+			}
+			values = append(values, "("+strings.Join(marks, ", ")+")")
+		}
+		insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", target, strings.Join(columns, ", "), strings.Join(values, ", "))
+		if _, err := tx.ExecContext(ctx, insert, args...); err != nil {
+			return fmt.Errorf("insert failed at row %d: %w", start, err)
+		}
+	}
+	return tx.Commit()
+}
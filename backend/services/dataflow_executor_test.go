@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupDataflowTestDB creates the dataflow tables with the column names of
+// the Prisma schema
+func setupDataflowTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t)
+	require.NoError(t, db.Exec(`CREATE TABLE "DataflowStep" (
+		id TEXT PRIMARY KEY, "dataflowId" TEXT NOT NULL, "order" INTEGER NOT NULL,
+		type TEXT NOT NULL, name TEXT NOT NULL, config TEXT NOT NULL,
+		"createdAt" DATETIME, "updatedAt" DATETIME)`).Error)
+	require.NoError(t, db.Exec(`CREATE TABLE "DataflowRun" (
+		id TEXT PRIMARY KEY, "dataflowId" TEXT NOT NULL, status TEXT NOT NULL,
+		"startedAt" DATETIME, "completedAt" DATETIME, error TEXT, logs TEXT)`).Error)
+	return db
+}
+
+func queryStep(id string, inputs ...string) models.DataflowStep {
+	quoted := make([]string, len(inputs))
+	for i, in := range inputs {
+		quoted[i] = `"` + in + `"`
+	}
+	return models.DataflowStep{
+		ID:     id,
+		Name:   id,
+		Type:   "QUERY",
+		Config: fmt.Sprintf(`{"sql": "SELECT 1", "connectionId": "conn", "inputs": [%s]}`, strings.Join(quoted, ", ")),
+	}
+}
+
+// fakeDataflowExecutor runs QUERY steps with the given functions, by step name
+func fakeDataflowExecutor(t *testing.T, db *gorm.DB, steps []models.DataflowStep, fns map[string]func(ctx context.Context) error) *DataflowExecutor {
+	t.Helper()
+	for i := range steps {
+		steps[i].DataflowID = "flow"
+		steps[i].Order = i
+		require.NoError(t, db.Create(&steps[i]).Error)
+	}
+	x := NewDataflowExecutor(db, nil)
+	x.runners["QUERY"] = func(ctx context.Context, step *models.DataflowStep, _ *dataflowStepConfig, _ *dataflowDataset) (*dataflowDataset, error) {
+		if fn := fns[step.Name]; fn != nil {
+			if err := fn(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return &dataflowDataset{Columns: []string{"n"}, Rows: [][]interface{}{{1}, {2}}}, nil
+	}
+	return x
+}
+
+func startDataflowRun(t *testing.T, db *gorm.DB, x *DataflowExecutor, ctx context.Context, seed *models.DataflowRunLogs) *models.DataflowRun {
+	t.Helper()
+	run := &models.DataflowRun{ID: fmt.Sprintf("run-%d", time.Now().UnixNano()), DataflowID: "flow", Status: "PENDING", StartedAt: time.Now()}
+	if seed != nil {
+		run.SetStepLogs(*seed)
+	}
+	require.NoError(t, db.Create(run).Error)
+	require.NoError(t, x.Run(ctx, run))
+
+	var stored models.DataflowRun
+	require.NoError(t, db.First(&stored, "id = ?", run.ID).Error)
+	return &stored
+}
+
+func stepStatuses(run *models.DataflowRun) map[string]string {
+	statuses := make(map[string]string)
+	for _, rec := range run.StepLogs().Steps {
+		statuses[rec.Name] = rec.Status
+	}
+	return statuses
+}
+
+func TestValidateDataflowSteps(t *testing.T) {
+	materialize := models.DataflowStep{
+		ID: "m", Name: "m", Type: "MATERIALIZE",
+		Config: `{"sourceStepId": "a", "targetTable": "out", "connectionId": "conn"}`,
+	}
+	tests := []struct {
+		name    string
+		steps   []models.DataflowStep
+		wantErr string
+	}{
+		{"valid", []models.DataflowStep{queryStep("a"), queryStep("b", "a"), materialize}, ""},
+		{"input by name", []models.DataflowStep{queryStep("a"), queryStep("b", "A")}, ""},
+		{"unknown type", []models.DataflowStep{{ID: "x", Name: "x", Type: "SORT", Config: "{}"}}, "unknown step type"},
+		{"unknown input", []models.DataflowStep{queryStep("a", "missing")}, "unknown input 'missing'"},
+		{"self input", []models.DataflowStep{queryStep("a", "a")}, "its own input"},
+		{"cycle", []models.DataflowStep{queryStep("a", "c"), queryStep("b", "a"), queryStep("c", "b")}, "cycle: a -> c -> b -> a"},
+		{"missing sql", []models.DataflowStep{{ID: "a", Name: "a", Type: "QUERY", Config: `{"connectionId": "conn"}`}}, "sql is required"},
+		{"materialize from materialize", []models.DataflowStep{queryStep("a"), materialize, {
+			ID: "m2", Name: "m2", Type: "MATERIALIZE",
+			Config: `{"sourceStepId": "m", "targetTable": "out2", "connectionId": "conn"}`,
+		}}, "must be a QUERY step"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDataflowSteps(tt.steps)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDataflowExecutor_RunsIndependentStepsInParallel(t *testing.T) {
+	db := setupDataflowTestDB(t)
+
+	// a and b only finish once both started, so they must run concurrently
+	var started sync.WaitGroup
+	started.Add(2)
+	both := func(ctx context.Context) error {
+		started.Done()
+		done := make(chan struct{})
+		go func() { started.Wait(); close(done) }()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(2 * time.Second):
+			return errors.New("steps did not run in parallel")
+		}
+	}
+	var mu sync.Mutex
+	var order []string
+	record := func(name string, fn func(context.Context) error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			err := error(nil)
+			if fn != nil {
+				err = fn(ctx)
+			}
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return err
+		}
+	}
+
+	steps := []models.DataflowStep{queryStep("c", "a", "b"), queryStep("a"), queryStep("b")}
+	x := fakeDataflowExecutor(t, db, steps, map[string]func(context.Context) error{
+		"a": record("a", both), "b": record("b", both), "c": record("c", nil),
+	})
+	run := startDataflowRun(t, db, x, context.Background(), nil)
+
+	assert.Equal(t, "COMPLETED", run.Status)
+	assert.NotNil(t, run.CompletedAt)
+	require.Len(t, order, 3)
+	assert.Equal(t, "c", order[2])
+	for _, rec := range run.StepLogs().Steps {
+		assert.Equal(t, "COMPLETED", rec.Status, rec.Name)
+		assert.Equal(t, 2, rec.RowCount, rec.Name)
+		assert.NotNil(t, rec.StartedAt, rec.Name)
+	}
+}
+
+func TestDataflowExecutor_FailureSkipsDependents(t *testing.T) {
+	db := setupDataflowTestDB(t)
+	steps := []models.DataflowStep{queryStep("a"), queryStep("b", "a"), queryStep("c", "b"), queryStep("d")}
+	x := fakeDataflowExecutor(t, db, steps, map[string]func(context.Context) error{
+		"a": func(context.Context) error { return errors.New("relation does not exist") },
+	})
+	run := startDataflowRun(t, db, x, context.Background(), nil)
+
+	assert.Equal(t, "FAILED", run.Status)
+	require.NotNil(t, run.Error)
+	assert.Contains(t, *run.Error, "step 'a' failed: relation does not exist")
+	assert.Equal(t, map[string]string{"a": "FAILED", "b": "SKIPPED", "c": "SKIPPED", "d": "COMPLETED"}, stepStatuses(run))
+	assert.Equal(t, "relation does not exist", run.StepLogs().Steps[0].Error)
+}
+
+func TestDataflowExecutor_RetryReusesCompletedSteps(t *testing.T) {
+	db := setupDataflowTestDB(t)
+	calls := make(map[string]int)
+	var mu sync.Mutex
+	failB := true
+	count := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			calls[name]++
+			if name == "b" && failB {
+				return errors.New("timeout")
+			}
+			return nil
+		}
+	}
+	steps := []models.DataflowStep{queryStep("a"), queryStep("b", "a"), queryStep("c", "b")}
+	x := fakeDataflowExecutor(t, db, steps, map[string]func(context.Context) error{
+		"a": count("a"), "b": count("b"), "c": count("c"),
+	})
+
+	failed := startDataflowRun(t, db, x, context.Background(), nil)
+	require.Equal(t, "FAILED", failed.Status)
+
+	failB = false
+	retry := startDataflowRun(t, db, x, context.Background(), &models.DataflowRunLogs{
+		RetryOf: failed.ID,
+		Steps:   failed.StepLogs().Steps,
+	})
+
+	assert.Equal(t, "COMPLETED", retry.Status)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "c": 1}, calls)
+	logs := retry.StepLogs()
+	assert.Equal(t, failed.ID, logs.RetryOf)
+	assert.True(t, logs.Steps[0].Reused)
+	assert.False(t, logs.Steps[1].Reused)
+}
+
+func TestDataflowExecutor_RetryRerunsSourceOfMaterialize(t *testing.T) {
+	db := setupDataflowTestDB(t)
+	steps := []models.DataflowStep{queryStep("a"), {
+		ID: "m", Name: "m", Type: "MATERIALIZE",
+		Config: `{"sourceStepId": "a", "targetTable": "out", "connectionId": "conn"}`,
+	}}
+	x := fakeDataflowExecutor(t, db, steps, nil)
+	var got *dataflowDataset
+	x.runners["MATERIALIZE"] = func(_ context.Context, _ *models.DataflowStep, _ *dataflowStepConfig, input *dataflowDataset) (*dataflowDataset, error) {
+		got = input
+		return input, nil
+	}
+
+	run := startDataflowRun(t, db, x, context.Background(), &models.DataflowRunLogs{
+		RetryOf: "previous",
+		Steps: []models.DataflowStepRun{
+			{StepID: "a", Name: "a", Type: "QUERY", Status: "COMPLETED", RowCount: 2},
+			{StepID: "m", Name: "m", Type: "MATERIALIZE", Status: "FAILED"},
+		},
+	})
+
+	assert.Equal(t, "COMPLETED", run.Status)
+	require.NotNil(t, got)
+	assert.Len(t, got.Rows, 2)
+	assert.False(t, run.StepLogs().Steps[0].Reused)
+}
+
+func TestDataflowExecutor_Cancel(t *testing.T) {
+	db := setupDataflowTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	steps := []models.DataflowStep{queryStep("a"), queryStep("b", "a")}
+	x := fakeDataflowExecutor(t, db, steps, map[string]func(context.Context) error{
+		"a": func(ctx context.Context) error {
+			cancel()
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	run := startDataflowRun(t, db, x, ctx, nil)
+
+	assert.Equal(t, "CANCELLED", run.Status)
+	assert.Equal(t, map[string]string{"a": "CANCELLED", "b": "CANCELLED"}, stepStatuses(run))
+}
+
+func TestWriteDataflowTable(t *testing.T) {
+	db := setupDataflowTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	data := &dataflowDataset{
+		Columns: []string{"id", "name"},
+		Rows:    [][]interface{}{{1, "north"}, {2, nil}},
+	}
+	require.NoError(t, writeDataflowTable(ctx, sqlDB, "sqlite", "regions", false, data))
+	require.NoError(t, writeDataflowTable(ctx, sqlDB, "sqlite", "regions", true, data))
+
+	var count int64
+	require.NoError(t, db.Table("regions").Count(&count).Error)
+	assert.Equal(t, int64(4), count)
+
+	require.NoError(t, writeDataflowTable(ctx, sqlDB, "sqlite", "regions", false, data))
+	require.NoError(t, db.Table("regions").Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	err = writeDataflowTable(ctx, sqlDB, "sqlite", "dup", false, &dataflowDataset{Columns: []string{"a", "a"}})
+	assert.ErrorContains(t, err, "duplicate column")
+	err = writeDataflowTable(ctx, sqlDB, "bigquery", "regions", false, data)
+	assert.ErrorContains(t, err, "not supported")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"strings"
 	"time"
@@ -254,6 +255,75 @@ func (imp *ExcelImporter) ImportExcel(
 	return result, nil
 }
 
+// ReadExcelRows reads every row of a sheet into records keyed by the cleaned
+// column names, with values converted to the detected column types
+func (imp *ExcelImporter) ReadExcelRows(
+	ctx context.Context,
+	r io.Reader,
+	options *ExcelImportOptions,
+) ([]map[string]interface{}, error) {
+	if options == nil {
+		options = imp.GetDefaultOptions()
+	}
+
+	xlsxFile, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Excel file: %w", err)
+	}
+	defer xlsxFile.Close()
+
+	sheetList := xlsxFile.GetSheetList()
+	if len(sheetList) == 0 {
+		return nil, errors.New("Excel file has no sheets")
+	}
+	targetSheet := options.SheetName
+	if targetSheet == "" {
+		if options.SheetIndex >= 0 && options.SheetIndex < len(sheetList) {
+			targetSheet = sheetList[options.SheetIndex]
+		} else {
+			targetSheet = xlsxFile.GetSheetName(xlsxFile.GetActiveSheetIndex())
+		}
+	}
+
+	allRows, err := xlsxFile.GetRows(targetSheet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sheet %s: %w", targetSheet, err)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if options.SkipRows > 0 {
+		if options.SkipRows >= len(allRows) {
+			return []map[string]interface{}{}, nil
+		}
+		allRows = allRows[options.SkipRows:]
+	}
+	if len(allRows) == 0 {
+		return []map[string]interface{}{}, nil
+	}
+
+	var headers []string
+	dataRows := allRows
+	if options.HasHeader {
+		headers = imp.csvImporter.cleanHeaders(allRows[0])
+		dataRows = allRows[1:]
+	} else {
+		headers = make([]string, len(allRows[0]))
+		for i := range headers {
+			headers[i] = fmt.Sprintf("column_%d", i+1)
+		}
+	}
+	if options.MaxRows > 0 && len(dataRows) > options.MaxRows {
+		dataRows = dataRows[:options.MaxRows]
+	}
+
+	return imp.csvImporter.typedRecords(headers, imp.normalizeRowLengths(dataRows, len(headers)), &CSVImportOptions{
+		DetectTypes:    options.DetectTypes,
+		TrimWhitespace: options.TrimWhitespace,
+		NullValues:     options.NullValues,
+	}), nil
+}
+
 // ValidateExcelFile validates Excel file before import
 func (imp *ExcelImporter) ValidateExcelFile(fileHeader *multipart.FileHeader) error {
 	// Check file size
@@ -0,0 +1,663 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"insight-engine-backend/models"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"gorm.io/gorm"
+)
+
+// Stores an extract can be copied into
+const (
+	ExtractStoreInternal = "INTERNAL" // the application's Postgres database
+	ExtractStoreEmbedded = "EMBEDDED" // the in-process engine of the AccelerationService
+)
+
+// ErrExtractRefreshing is returned when a refresh of the extract is already
+// running
+var ErrExtractRefreshing = errors.New("extract is already being refreshed")
+
+// ExtractService loads extracts from their sources into a local store and
+// answers the queries they copy from that store
+type ExtractService struct {
+	db        *gorm.DB
+	pipelines *PipelineExecutor
+	cron      *cron.Cron
+
+	mu        sync.Mutex
+	schedules map[string]cron.EntryID   // extract ID → scheduled refresh
+	running   map[string]bool           // extract IDs being refreshed
+	routes    map[string]models.Extract // source connection and query → extract answering it
+}
+
+// NewExtractService creates an extract service reading sources through the
+// pipeline executor
+func NewExtractService(db *gorm.DB, pipelines *PipelineExecutor) *ExtractService {
+	c := cron.New()
+	c.Start()
+
+	return &ExtractService{
+		db:        db,
+		pipelines: pipelines,
+		cron:      c,
+		schedules: make(map[string]cron.EntryID),
+		running:   make(map[string]bool),
+		routes:    make(map[string]models.Extract),
+	}
+}
+
+// Start schedules the stored extracts and starts answering their queries.
+// The embedded store does not survive a restart, so its extracts are
+// reloaded.
+func (s *ExtractService) Start() error {
+	var extracts []models.Extract
+	if err := s.db.Find(&extracts).Error; err != nil {
+		return fmt.Errorf("failed to load extracts: %w", err)
+	}
+	for i := range extracts {
+		extract := &extracts[i]
+		if extract.Status == "refreshing" {
+			// Interrupted by the restart
+			s.db.Model(extract).Update("status", "idle")
+			extract.Status = "idle"
+		}
+		if err := s.schedule(extract); err != nil {
+			LogWarn("extract_schedule", "Failed to schedule extract", map[string]interface{}{"extract_id": extract.ID, "error": err.Error()})
+		}
+		if extract.Store == ExtractStoreEmbedded {
+			if err := s.RefreshExtract(extract.ID, true); err != nil {
+				LogWarn("extract_refresh", "Failed to reload embedded extract", map[string]interface{}{"extract_id": extract.ID, "error": err.Error()})
+			}
+			continue
+		}
+		s.route(extract)
+	}
+	return nil
+}
+
+// ValidateExtract checks an extract's definition and fills in defaults
+func ValidateExtract(extract *models.Extract) error {
+	extract.Name = strings.TrimSpace(extract.Name)
+	if extract.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	extract.SourceType = strings.ToUpper(extract.SourceType)
+	if extract.SourceType == "" {
+		extract.SourceType = "CONNECTION"
+	}
+	switch extract.SourceType {
+	case "CONNECTION":
+		if extract.ConnectionID == nil || *extract.ConnectionID == "" {
+			return fmt.Errorf("connectionId is required")
+		}
+		if strings.TrimSpace(extract.SourceQuery) == "" {
+			return fmt.Errorf("sourceQuery is required")
+		}
+	case "REST_API":
+		var config models.SourceConfig
+		if extract.SourceConfig == nil || json.Unmarshal([]byte(*extract.SourceConfig), &config) != nil {
+			return fmt.Errorf("sourceConfig with the REST request is required")
+		}
+		if config.URL == "" {
+			return fmt.Errorf("sourceConfig.url is required")
+		}
+		extract.ConnectionID = nil
+		extract.SourceQuery = ""
+	default:
+		return fmt.Errorf("unsupported source type %s: use CONNECTION or REST_API", extract.SourceType)
+	}
+
+	extract.Store = strings.ToUpper(extract.Store)
+	if extract.Store == "" {
+		extract.Store = ExtractStoreInternal
+	}
+	if extract.Store != ExtractStoreInternal && extract.Store != ExtractStoreEmbedded {
+		return fmt.Errorf("unsupported store %s: use INTERNAL or EMBEDDED", extract.Store)
+	}
+
+	extract.RefreshMode = strings.ToLower(extract.RefreshMode)
+	if extract.RefreshMode == "" {
+		extract.RefreshMode = "full"
+	}
+	switch extract.RefreshMode {
+	case "full":
+		extract.WatermarkColumn = ""
+		extract.PrimaryKey = ""
+	case "incremental":
+		if extract.WatermarkColumn == "" {
+			return fmt.Errorf("incremental refresh requires watermarkColumn")
+		}
+	default:
+		return fmt.Errorf("invalid refresh mode: must be 'full' or 'incremental'")
+	}
+
+	if extract.Schedule != "" {
+		if _, err := cron.ParseStandard(extract.Schedule); err != nil {
+			return fmt.Errorf("invalid cron schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+// extractTableName is the store table of an extract; the ID keeps extracts
+// of the same name apart
+func extractTableName(extract *models.Extract) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(extract.Name))
+	if len(name) > 40 {
+		name = name[:40]
+	}
+	return fmt.Sprintf("extract_%s_%s", name, strings.ReplaceAll(extract.ID, "-", "")[:8])
+}
+
+// CreateExtract stores a validated extract, schedules it and starts its
+// first load
+func (s *ExtractService) CreateExtract(extract *models.Extract) error {
+	extract.ID = uuid.New().String()
+	extract.TargetTable = extractTableName(extract)
+	extract.Status = "idle"
+	if err := s.db.Create(extract).Error; err != nil {
+		return fmt.Errorf("failed to create extract: %w", err)
+	}
+	if err := s.schedule(extract); err != nil {
+		return err
+	}
+	return s.RefreshExtract(extract.ID, true)
+}
+
+// UpdateSchedule replaces the refresh schedule of an extract; an empty
+// schedule leaves refreshes to manual requests
+func (s *ExtractService) UpdateSchedule(extract *models.Extract, schedule string) error {
+	if schedule != "" {
+		if _, err := cron.ParseStandard(schedule); err != nil {
+			return fmt.Errorf("invalid cron schedule: %w", err)
+		}
+	}
+	if err := s.db.Model(extract).Update("schedule", schedule).Error; err != nil {
+		return err
+	}
+	extract.Schedule = schedule
+	return s.schedule(extract)
+}
+
+// DeleteExtract stops answering an extract's queries and drops its copy
+func (s *ExtractService) DeleteExtract(ctx context.Context, extract *models.Extract) error {
+	s.mu.Lock()
+	if s.running[extract.ID] {
+		s.mu.Unlock()
+		return ErrExtractRefreshing
+	}
+	s.running[extract.ID] = true // Keeps refreshes out while the extract goes
+	if entry, ok := s.schedules[extract.ID]; ok {
+		s.cron.Remove(entry)
+		delete(s.schedules, extract.ID)
+	}
+	s.unrouteLocked(extract.ID)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, extract.ID)
+		s.mu.Unlock()
+	}()
+
+	dest, err := s.destination(extract)
+	if err != nil {
+		return err
+	}
+	if _, err := dest.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+dest.quote(extract.TargetTable)); err != nil {
+		return fmt.Errorf("failed to drop extract table: %w", err)
+	}
+	if err := s.db.Where("pipeline_id = ?", extract.ID).Delete(&PipelineWatermark{}).Error; err != nil {
+		return err
+	}
+	return s.db.Delete(extract).Error
+}
+
+// RefreshExtract starts refreshing an extract in the background. A full
+// refresh reloads every row, also of an incremental extract.
+func (s *ExtractService) RefreshExtract(extractID string, full bool) error {
+	var extract models.Extract
+	if err := s.db.First(&extract, "id = ?", extractID).Error; err != nil {
+		return fmt.Errorf("extract not found: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.running[extractID] {
+		s.mu.Unlock()
+		return ErrExtractRefreshing
+	}
+	s.running[extractID] = true
+	s.mu.Unlock()
+
+	s.db.Model(&extract).Update("status", "refreshing")
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, extractID)
+			s.mu.Unlock()
+		}()
+		if err := s.Refresh(context.Background(), &extract, full); err != nil {
+			LogWarn("extract_refresh", "Extract refresh failed", map[string]interface{}{"extract_id": extractID, "error": err.Error()})
+		}
+	}()
+	return nil
+}
+
+// Refresh loads an extract and records the outcome. Its queries keep being
+// answered from the previous copy until the new one is in place.
+func (s *ExtractService) Refresh(ctx context.Context, extract *models.Extract, full bool) error {
+	rowCount, columns, err := s.load(ctx, extract, full)
+	if err != nil {
+		message := err.Error()
+		extract.Status = "error"
+		extract.LastError = &message
+		s.db.Model(extract).Updates(map[string]interface{}{"status": "error", "last_error": message})
+		return err
+	}
+
+	now := time.Now()
+	extract.Status = "idle"
+	extract.LastRefreshAt = &now
+	extract.LastError = nil
+	extract.RowCount = rowCount
+	extract.RefreshCount++
+	if columns != nil {
+		extract.Columns = columns
+		s.db.Model(extract).Select("Columns").Updates(extract)
+	}
+	s.db.Model(extract).Updates(map[string]interface{}{
+		"status":          "idle",
+		"last_refresh_at": now,
+		"last_error":      nil,
+		"row_count":       rowCount,
+		"refresh_count":   gorm.Expr("refresh_count + 1"),
+	})
+	s.route(extract)
+	return nil
+}
+
+// load copies the source rows into the store and returns the number of rows
+// the extract holds and the source columns, nil when no rows were loaded. An
+// incremental load fetches the rows above the watermark and appends them, or
+// replaces the stored rows sharing their primary key; the first load and
+// full loads replace the whole table.
+func (s *ExtractService) load(ctx context.Context, extract *models.Extract, full bool) (int64, []string, error) {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get underlying DB: %w", err)
+	}
+	dest, err := s.destination(extract)
+	if err != nil {
+		return 0, nil, err
+	}
+	exists, err := dest.hasTable(ctx, dest.table)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	incremental := extract.RefreshMode == "incremental"
+	var watermark *PipelineWatermark
+	if incremental {
+		if watermark, err = NewIncrementalRefreshV2Service(sqlDB).GetWatermark(ctx, extract.ID); err != nil {
+			return 0, nil, err
+		}
+		if watermark == nil {
+			watermark = &PipelineWatermark{ID: uuid.New().String(), PipelineID: extract.ID, ColumnName: extract.WatermarkColumn, ColumnType: "string", CreatedAt: time.Now()}
+		}
+	}
+	after := ""
+	writeMode := "OVERWRITE"
+	if incremental && !full && exists && watermark.LastValue != "" {
+		after = watermark.LastValue
+		writeMode = "APPEND"
+		if extract.PrimaryKey != "" {
+			writeMode = "UPSERT"
+		}
+	}
+
+	source, err := s.openSource(ctx, extract, after)
+	if err != nil {
+		return 0, nil, fmt.Errorf("extraction failed: %w", err)
+	}
+	defer source.Close()
+
+	loader, err := beginLoad(ctx, dest, writeMode, extract.PrimaryKey, true)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer loader.abort()
+	if cs, ok := source.(columnSource); ok && cs.sourceColumns() != nil {
+		loader.declare(cs.sourceColumns())
+	}
+
+	high := after
+	for {
+		batch, err := source.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("extraction failed: %w", err)
+		}
+		if incremental {
+			kept := batch[:0]
+			for _, row := range batch {
+				value := watermarkString(row[extract.WatermarkColumn])
+				if after != "" && !watermarkAbove(value, after) {
+					continue // REST sources cannot filter at the source
+				}
+				if value != "" && (high == "" || watermarkAbove(value, high)) {
+					high = value
+				}
+				kept = append(kept, row)
+			}
+			batch = kept
+		}
+		if err := loader.write(ctx, batch); err != nil {
+			return 0, nil, fmt.Errorf("load failed: %w", err)
+		}
+	}
+
+	if writeMode == "OVERWRITE" && loader.columns == nil && exists {
+		// The source is empty now; a load without rows would keep the old copy
+		if _, err := loader.tx.ExecContext(ctx, "DELETE FROM "+dest.quote(dest.table)); err != nil {
+			return 0, nil, fmt.Errorf("failed to empty extract table: %w", err)
+		}
+	}
+
+	// The internal store keeps the watermark in the same transaction as the
+	// rows; the embedded one may reload rows after a failure in between
+	saveWatermark := incremental && high != watermark.LastValue
+	if saveWatermark {
+		watermark.LastValue = high
+		watermark.RowsLastSync = int64(loader.rows)
+		watermark.LastSyncAt = time.Now()
+		watermark.UpdatedAt = time.Now()
+		if extract.Store == ExtractStoreInternal {
+			if err := upsertWatermark(ctx, loader.tx, watermark); err != nil {
+				return 0, nil, fmt.Errorf("failed to save watermark: %w", err)
+			}
+		}
+	}
+	if err := loader.commit(ctx); err != nil {
+		return 0, nil, fmt.Errorf("failed to publish extract: %w", err)
+	}
+	if saveWatermark && extract.Store != ExtractStoreInternal {
+		if err := upsertWatermark(ctx, sqlDB, watermark); err != nil {
+			return 0, nil, fmt.Errorf("failed to save watermark: %w", err)
+		}
+	}
+
+	var count int64
+	if err := dest.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+dest.quote(dest.table)).Scan(&count); err != nil {
+		if loader.columns == nil && !exists {
+			return 0, nil, nil // Nothing was ever loaded
+		}
+		return 0, nil, fmt.Errorf("failed to count extract rows: %w", err)
+	}
+	return count, loader.columns, nil
+}
+
+// openSource streams an extract's source rows, those above after when set.
+// Connection sources filter in the source query.
+func (s *ExtractService) openSource(ctx context.Context, extract *models.Extract, after string) (rowStream, error) {
+	pipeline := &models.Pipeline{ID: extract.ID, Name: extract.Name, SourceType: extract.SourceType, ConnectionID: extract.ConnectionID}
+	var config models.SourceConfig
+	if extract.SourceConfig != nil && *extract.SourceConfig != "" {
+		if err := json.Unmarshal([]byte(*extract.SourceConfig), &config); err != nil {
+			return nil, fmt.Errorf("invalid source config: %w", err)
+		}
+	}
+	if extract.SourceType == "CONNECTION" {
+		query := extract.SourceQuery
+		if after != "" {
+			var err error
+			if query, err = s.incrementalQuery(extract, after); err != nil {
+				return nil, err
+			}
+		}
+		pipeline.SourceQuery = &query
+	}
+	return s.pipelines.openSource(ctx, pipeline, &config)
+}
+
+// incrementalQuery wraps the source query of an extract so it only returns
+// the rows above the watermark
+func (s *ExtractService) incrementalQuery(extract *models.Extract, after string) (string, error) {
+	var conn models.Connection
+	if err := s.db.First(&conn, "id = ?", *extract.ConnectionID).Error; err != nil {
+		return "", fmt.Errorf("connection not found: %w", err)
+	}
+	column := quoteSourceColumn(normalizeSQLDialect(conn.Type), extract.WatermarkColumn)
+	literal := sqlStringLiteral(after)
+	if _, err := strconv.ParseFloat(after, 64); err == nil {
+		literal = after
+	}
+	query := strings.TrimRight(strings.TrimSpace(extract.SourceQuery), ";")
+	return fmt.Sprintf("SELECT * FROM (%s) _extract WHERE %s > %s", query, column, literal), nil
+}
+
+// watermarkString is how a watermark column value is compared and stored
+func watermarkString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// watermarkAbove reports whether a watermark value is above another:
+// numerically for numbers, in time for RFC 3339 timestamps, as text
+// otherwise
+func watermarkAbove(value string, mark string) bool {
+	if a, err := strconv.ParseFloat(value, 64); err == nil {
+		if b, err := strconv.ParseFloat(mark, 64); err == nil {
+			return a > b
+		}
+	}
+	if a, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		if b, err := time.Parse(time.RFC3339Nano, mark); err == nil {
+			return a.After(b)
+		}
+	}
+	return value > mark
+}
+
+// destination opens the store table of an extract
+func (s *ExtractService) destination(extract *models.Extract) (*pipelineDestination, error) {
+	if extract.Store == ExtractStoreEmbedded {
+		accel := GetAccelerationService()
+		if accel == nil || accel.db == nil {
+			return nil, fmt.Errorf("embedded engine not available")
+		}
+		return &pipelineDestination{db: accel.db, dialect: "sqlite", table: extract.TargetTable}, nil
+	}
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get underlying DB: %w", err)
+	}
+	return &pipelineDestination{db: sqlDB, dialect: "postgres", table: extract.TargetTable}, nil
+}
+
+// schedule replaces the scheduled refresh of an extract
+func (s *ExtractService) schedule(extract *models.Extract) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry, ok := s.schedules[extract.ID]; ok {
+		s.cron.Remove(entry)
+		delete(s.schedules, extract.ID)
+	}
+	if extract.Schedule == "" {
+		return nil
+	}
+	extractID := extract.ID
+	entry, err := s.cron.AddFunc(extract.Schedule, func() {
+		if err := s.RefreshExtract(extractID, false); err != nil && err != ErrExtractRefreshing {
+			LogWarn("extract_refresh", "Scheduled extract refresh failed", map[string]interface{}{"extract_id": extractID, "error": err.Error()})
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to schedule extract: %w", err)
+	}
+	s.schedules[extract.ID] = entry
+	return nil
+}
+
+// extractRouteKey identifies the query an extract answers
+func extractRouteKey(connectionID string, query string) string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	return connectionID + "\x00" + strings.Join(strings.Fields(query), " ")
+}
+
+// route starts answering the source query of a loaded extract from its copy.
+// The copy does not keep the order of the source rows, so queries sorting
+// them are left to the source.
+func (s *ExtractService) route(extract *models.Extract) {
+	if extract.SourceType != "CONNECTION" || extract.ConnectionID == nil || extract.LastRefreshAt == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unrouteLocked(extract.ID)
+	if sortsRows(extract.SourceQuery) {
+		return
+	}
+	s.routes[extractRouteKey(*extract.ConnectionID, extract.SourceQuery)] = *extract
+}
+
+// sortsRows reports whether a query ends with an ORDER BY of its own, rather
+// than in a subquery
+func sortsRows(query string) bool {
+	depth := 0
+	tokens := sqlTokens(query)
+	for i, token := range tokens {
+		switch token {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		default:
+			if depth == 0 && strings.EqualFold(token, "ORDER") && i+1 < len(tokens) && strings.EqualFold(tokens[i+1], "BY") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *ExtractService) unrouteLocked(extractID string) {
+	for key, routed := range s.routes {
+		if routed.ID == extractID {
+			delete(s.routes, key)
+		}
+	}
+}
+
+// Serve answers a query from the extract copying it, if there is one. A
+// copy that cannot be read leaves the query to the source.
+func (s *ExtractService) Serve(ctx context.Context, conn *models.Connection, query string, limit *int, offset *int) (*models.QueryResult, bool) {
+	s.mu.Lock()
+	extract, ok := s.routes[extractRouteKey(conn.ID, query)]
+	refreshing := s.running[extract.ID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	dest, err := s.destination(&extract)
+	if err != nil {
+		return nil, false
+	}
+	// The stored columns may predate the source's current order
+	selectList := "*"
+	if len(extract.Columns) > 0 {
+		quoted := make([]string, len(extract.Columns))
+		for i, col := range extract.Columns {
+			quoted[i] = dest.quote(col)
+		}
+		selectList = strings.Join(quoted, ", ")
+	}
+	storeQuery := "SELECT " + selectList + " FROM " + dest.quote(extract.TargetTable)
+	if limit != nil {
+		storeQuery = fmt.Sprintf("%s LIMIT %d", storeQuery, *limit)
+	}
+	if offset != nil {
+		if limit == nil && dest.dialect == "sqlite" {
+			storeQuery += " LIMIT -1" // SQLite takes OFFSET only after LIMIT
+		}
+		storeQuery = fmt.Sprintf("%s OFFSET %d", storeQuery, *offset)
+	}
+
+	start := time.Now()
+	result, err := queryStore(ctx, dest.db, storeQuery)
+	if err != nil {
+		LogWarn("extract_serve", "Failed to read extract, querying the source", map[string]interface{}{"extract_id": extract.ID, "error": err.Error()})
+		return nil, false
+	}
+	result.ExecutionTime = time.Since(start).Milliseconds()
+	result.Freshness = &models.DataFreshness{
+		ExtractID:   extract.ID,
+		ExtractName: extract.Name,
+		RefreshedAt: *extract.LastRefreshAt,
+		AgeSeconds:  int64(time.Since(*extract.LastRefreshAt).Seconds()),
+		Refreshing:  refreshing,
+	}
+	return result, true
+}
+
+// queryStore runs a query on a store and returns its rows in column order
+func queryStore(ctx context.Context, db *sql.DB, query string) (*models.QueryResult, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.QueryResult{Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.RowCount = len(result.Rows)
+	return result, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"insight-engine-backend/models"
+	"insight-engine-backend/pkg/resilience"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateExtract(t *testing.T) {
+	conn := "c1"
+	extract := models.Extract{Name: " Orders ", ConnectionID: &conn, SourceQuery: "SELECT 1", WatermarkColumn: "updated_at"}
+	require.NoError(t, ValidateExtract(&extract))
+	assert.Equal(t, "Orders", extract.Name)
+	assert.Equal(t, "CONNECTION", extract.SourceType)
+	assert.Equal(t, ExtractStoreInternal, extract.Store)
+	assert.Equal(t, "full", extract.RefreshMode)
+	assert.Empty(t, extract.WatermarkColumn, "full refreshes keep no watermark")
+
+	rest := `{"url": "https://api.example.com/orders"}`
+	for _, bad := range []models.Extract{
+		{ConnectionID: &conn, SourceQuery: "SELECT 1"},
+		{Name: "x", SourceQuery: "SELECT 1"},
+		{Name: "x", ConnectionID: &conn},
+		{Name: "x", SourceType: "REST_API"},
+		{Name: "x", SourceType: "FTP", SourceConfig: &rest},
+		{Name: "x", SourceType: "REST_API", SourceConfig: &rest, Store: "REDIS"},
+		{Name: "x", SourceType: "REST_API", SourceConfig: &rest, RefreshMode: "incremental"},
+		{Name: "x", SourceType: "REST_API", SourceConfig: &rest, Schedule: "every hour"},
+	} {
+		assert.Error(t, ValidateExtract(&bad), "%+v", bad)
+	}
+}
+
+func TestSortsRows(t *testing.T) {
+	assert.True(t, sortsRows("SELECT * FROM orders ORDER BY id"))
+	assert.True(t, sortsRows("select * from orders order\n by id limit 5"))
+	assert.False(t, sortsRows("SELECT * FROM (SELECT * FROM orders ORDER BY id LIMIT 5) top"))
+	assert.False(t, sortsRows("SELECT id, ROW_NUMBER() OVER (ORDER BY amount) FROM orders"))
+	assert.False(t, sortsRows("SELECT 'ORDER BY' FROM orders"))
+}
+
+func TestWatermarkAbove(t *testing.T) {
+	assert.True(t, watermarkAbove("10", "9"))
+	assert.False(t, watermarkAbove("2024-01-02T00:30:00+02:00", "2024-01-01T23:00:00Z"), "compared in time, not as text")
+	assert.False(t, watermarkAbove("2024-01-01", "2024-01-01"))
+	assert.True(t, watermarkAbove("b", "a"))
+}
+
+// setupExtractTest creates an acceleration source table and a connection
+// on it, and an extract service with a query executor routing to it
+func setupExtractTest(t *testing.T, source string) (*ExtractService, *QueryExecutor, *models.Connection) {
+	t.Helper()
+	withSmallBatches(t)
+	db := setupTestDB(t, &models.Pipeline{}, &models.QualityRule{}, &models.JobExecution{}, &models.Extract{}, &models.Connection{}, &PipelineWatermark{})
+
+	accel := GetAccelerationService()
+	require.NotNil(t, accel)
+	_, err := accel.db.Exec(`DROP TABLE IF EXISTS "` + source + `"`)
+	require.NoError(t, err)
+	_, err = accel.db.Exec(`CREATE TABLE "` + source + `" (id INTEGER, updated_at TEXT, amount INTEGER)`)
+	require.NoError(t, err)
+	_, err = accel.db.Exec(`INSERT INTO "` + source + `" VALUES (1, '2024-01-01', 10), (2, '2024-01-02', 20), (3, '2024-01-03', 30)`)
+	require.NoError(t, err)
+	t.Cleanup(func() { accel.db.Exec(`DROP TABLE IF EXISTS "` + source + `"`) })
+
+	conn := models.Connection{ID: "src-" + source, Name: "Replica", Type: "sqlite_memory", Database: "acceleration", UserID: "u1"}
+	require.NoError(t, db.Create(&conn).Error)
+
+	qe := NewQueryExecutor(&resilience.MockCircuitBreaker{NameVal: "test"}, nil, nil)
+	pe := NewPipelineExecutor()
+	pe.SetQueryExecutor(qe)
+	svc := NewExtractService(db, pe)
+	qe.SetExtractService(svc)
+	return svc, qe, &conn
+}
+
+func TestExtractService_IncrementalRefreshAndServe(t *testing.T) {
+	svc, qe, conn := setupExtractTest(t, "extract_src_orders")
+	ctx := context.Background()
+	accel := GetAccelerationService()
+
+	extract := models.Extract{ID: "0e1e1e1e-0000-4000-8000-000000000001", UserID: "u1", Name: "Orders", ConnectionID: &conn.ID, SourceQuery: "SELECT * FROM extract_src_orders;",
+		RefreshMode: "incremental", WatermarkColumn: "updated_at", PrimaryKey: "id"}
+	require.NoError(t, ValidateExtract(&extract))
+	extract.TargetTable = extractTableName(&extract)
+	extract.Status = "idle"
+	require.NoError(t, svc.db.Create(&extract).Error)
+
+	// Nothing is answered before the first load
+	result, err := qe.Execute(ctx, conn, extract.SourceQuery, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.Freshness)
+
+	require.NoError(t, svc.Refresh(ctx, &extract, false))
+	assert.Equal(t, int64(3), extract.RowCount)
+	assert.NotNil(t, extract.LastRefreshAt)
+	var stored models.Extract
+	require.NoError(t, svc.db.First(&stored, "id = ?", extract.ID).Error)
+	assert.Equal(t, []string{"id", "updated_at", "amount"}, stored.Columns)
+
+	// Row 2 changes, row 4 arrives, and row 1 changes without moving the
+	// watermark column, so the incremental refresh does not see it
+	_, err = accel.db.Exec(`UPDATE extract_src_orders SET amount = 21, updated_at = '2024-01-04' WHERE id = 2`)
+	require.NoError(t, err)
+	_, err = accel.db.Exec(`UPDATE extract_src_orders SET amount = 11 WHERE id = 1`)
+	require.NoError(t, err)
+	_, err = accel.db.Exec(`INSERT INTO extract_src_orders VALUES (4, '2024-01-05', 40)`)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.Refresh(ctx, &extract, false))
+	assert.Equal(t, int64(4), extract.RowCount)
+	var watermark PipelineWatermark
+	require.NoError(t, svc.db.First(&watermark, "pipeline_id = ?", extract.ID).Error)
+	assert.Equal(t, "2024-01-05", watermark.LastValue)
+	assert.Equal(t, int64(2), watermark.RowsLastSync)
+
+	var rows []struct{ ID, Amount string }
+	require.NoError(t, svc.db.Raw(`SELECT id, amount FROM `+extract.TargetTable+` ORDER BY id`).Scan(&rows).Error)
+	assert.Equal(t, []struct{ ID, Amount string }{{"1", "10"}, {"2", "21"}, {"3", "30"}, {"4", "40"}}, rows)
+
+	// The same query on the source connection is answered by the extract,
+	// whatever its whitespace
+	limit := 2
+	result, err = qe.Execute(ctx, conn, "SELECT *\n  FROM extract_src_orders", nil, &limit, nil)
+	require.NoError(t, err)
+	require.NotNil(t, result.Freshness)
+	assert.Equal(t, extract.ID, result.Freshness.ExtractID)
+	assert.Equal(t, extract.LastRefreshAt.Unix(), result.Freshness.RefreshedAt.Unix())
+	assert.Equal(t, 2, result.RowCount)
+	assert.Equal(t, []string{"id", "updated_at", "amount"}, result.Columns, "columns keep the source order")
+	assert.Equal(t, int64(1), result.Rows[0][0], "columns keep the source types")
+
+	result, err = qe.Execute(ctx, conn, "SELECT * FROM extract_src_orders WHERE id = 1", nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.Freshness, "other queries go to the source")
+	assert.Equal(t, int64(11), result.Rows[0][2])
+
+	// A full refresh picks up every change, deletions included
+	_, err = accel.db.Exec(`DELETE FROM extract_src_orders WHERE id = 3`)
+	require.NoError(t, err)
+	require.NoError(t, svc.Refresh(ctx, &extract, true))
+	assert.Equal(t, int64(3), extract.RowCount)
+	require.NoError(t, svc.db.Raw(`SELECT id, amount FROM `+extract.TargetTable+` ORDER BY id`).Scan(&rows).Error)
+	assert.Equal(t, []struct{ ID, Amount string }{{"1", "11"}, {"2", "21"}, {"4", "40"}}, rows)
+}
+
+func TestExtractService_EmbeddedStore(t *testing.T) {
+	svc, qe, conn := setupExtractTest(t, "extract_src_events")
+	ctx := context.Background()
+
+	extract := models.Extract{ID: "0e2e2e2e-0000-4000-8000-000000000002", UserID: "u1", Name: "Events", ConnectionID: &conn.ID, SourceQuery: "SELECT id, amount FROM extract_src_events", Store: "embedded"}
+	require.NoError(t, ValidateExtract(&extract))
+	extract.TargetTable = extractTableName(&extract)
+	extract.Status = "idle"
+	require.NoError(t, svc.db.Create(&extract).Error)
+
+	require.NoError(t, svc.Refresh(ctx, &extract, false))
+	assert.Equal(t, int64(3), extract.RowCount)
+	offset := 1
+	result, err := qe.Execute(ctx, conn, extract.SourceQuery, nil, nil, &offset)
+	require.NoError(t, err)
+	require.NotNil(t, result.Freshness)
+	assert.Equal(t, 2, result.RowCount)
+
+	// A failed refresh keeps answering from the last copy
+	broken := extract
+	broken.SourceQuery = "SELECT * FROM missing_table"
+	require.Error(t, svc.Refresh(ctx, &broken, false))
+	var stored models.Extract
+	require.NoError(t, svc.db.First(&stored, "id = ?", extract.ID).Error)
+	assert.Equal(t, "error", stored.Status)
+	assert.Contains(t, *stored.LastError, "extraction failed")
+	result, err = qe.Execute(ctx, conn, extract.SourceQuery, nil, nil, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, result.Freshness)
+
+	require.NoError(t, svc.DeleteExtract(ctx, &extract))
+	exists, err := (&pipelineDestination{db: GetAccelerationService().db, dialect: "sqlite"}).hasTable(ctx, extract.TargetTable)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	result, err = qe.Execute(ctx, conn, extract.SourceQuery, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.Freshness)
+	assert.Equal(t, 3, result.RowCount)
+}
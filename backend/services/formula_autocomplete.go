@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"insight-engine-backend/models"
 	"strings"
 
 	"gorm.io/gorm"
@@ -28,6 +30,7 @@ type AutocompleteRequest struct {
 	Input        string `json:"input"`        // Current input text
 	CursorPos    int    `json:"cursorPos"`    // Cursor position
 	DataSourceID string `json:"dataSourceId"` // Optional: for column suggestions
+	WorkspaceID  string `json:"-"`            // Set from the session: for user-defined functions
 }
 
 // AutocompleteResponse represents an autocomplete response
@@ -53,6 +56,11 @@ func (fa *FormulaAutocomplete) GetSuggestions(ctx context.Context, req Autocompl
 	// Add function suggestions
 	suggestions = append(suggestions, fa.getFunctionSuggestions(prefix)...)
 
+	// Add the workspace's user-defined functions
+	if req.WorkspaceID != "" {
+		suggestions = append(suggestions, fa.getUserFunctionSuggestions(req.WorkspaceID)...)
+	}
+
 	// Add operator suggestions
 	suggestions = append(suggestions, fa.getOperatorSuggestions(prefix)...)
 
@@ -299,6 +307,42 @@ func (fa *FormulaAutocomplete) getKeywordSuggestions(prefix string) []Autocomple
 	return keywords
 }
 
+// getUserFunctionSuggestions returns the user-defined functions of a workspace
+func (fa *FormulaAutocomplete) getUserFunctionSuggestions(workspaceID string) []AutocompleteSuggestion {
+	if fa.db == nil {
+		return nil
+	}
+	var functions []models.FormulaFunction
+	if err := fa.db.Where("workspace_id = ?", workspaceID).Order("name ASC").Find(&functions).Error; err != nil {
+		LogWarn("formula_autocomplete", "Failed to load formula functions", map[string]interface{}{"workspace_id": workspaceID, "error": err})
+		return nil
+	}
+
+	suggestions := make([]AutocompleteSuggestion, 0, len(functions))
+	for _, fn := range functions {
+		params := fn.ParamNames()
+		signature := fmt.Sprintf("%s(%s)", fn.Name, strings.Join(params, ", "))
+		args := make([]string, len(params))
+		for i, p := range params {
+			args[i] = "[" + p + "]"
+		}
+		description := fn.Description
+		if description == "" {
+			description = "Workspace function"
+		}
+		suggestions = append(suggestions, AutocompleteSuggestion{
+			Type:        "function",
+			Value:       fn.Name,
+			Label:       signature,
+			Description: description,
+			Signature:   signature,
+			Example:     fmt.Sprintf("%s(%s)", fn.Name, strings.Join(args, ", ")),
+			Category:    "Workspace",
+		})
+	}
+	return suggestions
+}
+
 // getColumnSuggestions returns column suggestions from schema
 func (fa *FormulaAutocomplete) getColumnSuggestions(ctx context.Context, dataSourceID string, prefix string) []AutocompleteSuggestion {
 	// This would query the schema to get actual columns
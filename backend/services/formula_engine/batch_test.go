@@ -36,7 +36,12 @@ func TestEvaluateSeries(t *testing.T) {
 		{
 			name:    "Unknown Field",
 			formula: "[Profit]",
-			want:    []interface{}{"#ERROR: unresolved reference: Profit", "#ERROR: unresolved reference: Profit", "#ERROR: unresolved reference: Profit"},
+			want:    []interface{}{ErrRef, ErrRef, ErrRef},
+		},
+		{
+			name:    "Division By Zero Row",
+			formula: "[Sales] / ([Cost] - 50)",
+			want:    []interface{}{ErrDiv0, 2.0, 5.0},
 		},
 		{
 			name:    "String Comparison",
@@ -58,6 +63,13 @@ func TestEvaluateSeries(t *testing.T) {
 			}
 
 			for i := range got {
+				if code, ok := tt.want[i].(ErrorCode); ok {
+					fe, isErr := got[i].(*FormulaError)
+					if !isErr || fe.Code != code {
+						t.Errorf("Row %d: got %v, want error %s", i, got[i], code)
+					}
+					continue
+				}
 				if got[i] != tt.want[i] {
 					t.Errorf("Row %d: got %v, want %v", i, got[i], tt.want[i])
 				}
@@ -0,0 +1,178 @@
+package formula_engine
+
+// evalFn evaluates a compiled formula, or one of its subexpressions, for one row
+type evalFn func(ctx *FormulaContext) (interface{}, error)
+
+// CompiledFormula is a formula parsed and compiled once into a tree of
+// closures, so evaluating it per row skips re-walking the AST. It is safe for
+// concurrent use.
+type CompiledFormula struct {
+	node   FormulaNode
+	run    evalFn
+	vector *vectorPlan // nil when the formula has no columnar form
+}
+
+// Compile parses a formula and compiles it for repeated evaluation
+func (e *FormulaEngine) Compile(formula string) (*CompiledFormula, error) {
+	node, err := e.ParseFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledFormula{
+		node:   node,
+		run:    e.compileNode(node),
+		vector: planVector(node),
+	}, nil
+}
+
+// Evaluate evaluates the compiled formula against the provided context
+func (f *CompiledFormula) Evaluate(ctx *FormulaContext) (interface{}, error) {
+	return f.run(ctx)
+}
+
+// compileNode turns an AST node into a closure with the same semantics as evalNode
+func (e *FormulaEngine) compileNode(node FormulaNode) evalFn {
+	switch n := node.(type) {
+	case *NumberNode:
+		return constant(n.Value)
+	case *StringNode:
+		return constant(n.Value)
+	case *BoolNode:
+		return constant(n.Value)
+	case *CellRefNode:
+		return func(ctx *FormulaContext) (interface{}, error) {
+			val, err := e.resolveRef(n, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if fe, ok := val.(*FormulaError); ok {
+				return nil, fe
+			}
+			return val, nil
+		}
+	case *UnaryNode:
+		return compileUnary(n.Op, e.compileNode(n.Operand))
+	case *BinaryNode:
+		return compileBinary(n.Op, e.compileNode(n.Left), e.compileNode(n.Right))
+	case *FuncCallNode:
+		return e.compileFunc(n)
+	default:
+		return func(*FormulaContext) (interface{}, error) {
+			return e.evalNode(node, nil)
+		}
+	}
+}
+
+func constant(v interface{}) evalFn {
+	return func(*FormulaContext) (interface{}, error) {
+		return v, nil
+	}
+}
+
+func compileUnary(op TokenKind, operand evalFn) evalFn {
+	return func(ctx *FormulaContext) (interface{}, error) {
+		val, err := operand(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if num, ok := val.(float64); ok {
+			if op == TokMinus {
+				return -num, nil
+			}
+			return num, nil
+		}
+		return applyUnary(op, val)
+	}
+}
+
+func compileBinary(op TokenKind, left, right evalFn) evalFn {
+	// Numbers skip the generic coercions, except for the operators that
+	// compare or join the text form of their operands
+	numeric := op != TokAmpersand && op != TokEq && op != TokNeq
+	return func(ctx *FormulaContext) (interface{}, error) {
+		l, err := left(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if numeric {
+			if lNum, ok := l.(float64); ok {
+				if rNum, ok := r.(float64); ok {
+					return numericBinary(op, lNum, rNum)
+				}
+			}
+		}
+		return applyBinary(op, l, r)
+	}
+}
+
+func (e *FormulaEngine) compileArgs(nodes []FormulaNode) []evalFn {
+	args := make([]evalFn, len(nodes))
+	for i, arg := range nodes {
+		args[i] = e.compileNode(arg)
+	}
+	return args
+}
+
+// compileFunc resolves the function once, mirroring the dispatch of evalFunc
+func (e *FormulaEngine) compileFunc(n *FuncCallNode) evalFn {
+	fn, ok := GetFunction(n.Name)
+	if !ok {
+		if uf, ok := e.userFunctions[n.Name]; ok {
+			args := e.compileArgs(n.Args)
+			return func(ctx *FormulaContext) (interface{}, error) {
+				return callUserFunction(uf, args, ctx)
+			}
+		}
+		return func(*FormulaContext) (interface{}, error) {
+			return nil, newFormulaError(ErrName, "unknown function: %s", n.Name)
+		}
+	}
+
+	// Table calculations read the partition through the AST of their arguments
+	if windowFunctions[n.Name] {
+		return func(ctx *FormulaContext) (interface{}, error) {
+			return e.evalWindow(n, ctx)
+		}
+	}
+
+	args := e.compileArgs(n.Args)
+	if lazyFunctions[n.Name] {
+		name := n.Name
+		return func(ctx *FormulaContext) (interface{}, error) {
+			return callLazy(name, args, ctx)
+		}
+	}
+
+	flatten := !rangeFunctions[n.Name]
+	return func(ctx *FormulaContext) (interface{}, error) {
+		vals := make([]interface{}, len(args))
+		hasRange := false
+		for i, arg := range args {
+			val, err := arg(ctx)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := val.([]interface{}); ok {
+				hasRange = true
+			}
+			vals[i] = val
+		}
+		if !flatten || !hasRange {
+			return fn(vals)
+		}
+
+		flatArgs := make([]interface{}, 0, len(vals))
+		for _, val := range vals {
+			if slice, ok := val.([]interface{}); ok {
+				flatArgs = append(flatArgs, slice...)
+			} else {
+				flatArgs = append(flatArgs, val)
+			}
+		}
+		return fn(flatArgs)
+	}
+}
@@ -0,0 +1,223 @@
+package formula_engine
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// treeWalk evaluates a formula per row with the AST evaluator, the reference
+// the compiled and columnar evaluators must agree with
+func treeWalk(t testing.TB, engine *FormulaEngine, formula string, data []map[string]interface{}) []interface{} {
+	node, err := engine.ParseFormula(formula)
+	if err != nil {
+		t.Fatalf("parse %q: %v", formula, err)
+	}
+	out := make([]interface{}, len(data))
+	for i, row := range data {
+		val, err := engine.evalNode(node, &FormulaContext{FieldValues: row})
+		if err != nil {
+			out[i] = AsFormulaError(err)
+		} else {
+			out[i] = val
+		}
+	}
+	return out
+}
+
+func sameResults(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		ea, aIsErr := a[i].(*FormulaError)
+		eb, bIsErr := b[i].(*FormulaError)
+		if aIsErr || bIsErr {
+			if !aIsErr || !bIsErr || ea.Code != eb.Code {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func numericRows(n int) []map[string]interface{} {
+	rng := rand.New(rand.NewSource(42))
+	data := make([]map[string]interface{}, n)
+	for i := range data {
+		data[i] = map[string]interface{}{
+			"Sales":    float64(rng.Intn(1000)),
+			"Cost":     float64(rng.Intn(800)),
+			"Discount": float64(rng.Intn(3)), // zero in a third of the rows
+			"Qty":      int64(rng.Intn(50)),
+			"Region":   []string{"US", "EU", "APAC"}[i%3],
+		}
+	}
+	return data
+}
+
+var equivalenceFormulas = []string{
+	"[Sales] - [Cost]",
+	"([Sales] - [Cost]) / [Sales] * 100",
+	"[Sales] / [Discount]",
+	"[Sales] % [Discount] + 1",
+	"-[Sales] ^ 2",
+	"[Qty] * 2",
+	"[Qty]",
+	"[Sales] > [Cost]",
+	"IF([Sales] > [Cost], [Sales] - [Cost], 0)",
+	"IF([Discount], [Sales] / [Discount], -1)",
+	"IF([Discount] = 0, 0, [Sales] / [Discount])",
+	"IF([Sales] > 500, TRUE)",
+	"IF([Sales] > 500, [Sales], [Region])",
+	"[Region] & \"-\" & [Sales]",
+	"ROUND([Sales] / 3, 2)",
+	"IFERROR([Sales] / [Discount], 0)",
+	"[Sales] + [Missing]",
+}
+
+func TestCompiledFormula_MatchesTreeWalk(t *testing.T) {
+	engine := NewFormulaEngine()
+	data := numericRows(vectorBatchSize + 100) // spans two batches
+
+	for _, formula := range equivalenceFormulas {
+		t.Run(formula, func(t *testing.T) {
+			want := treeWalk(t, engine, formula, data)
+
+			got, err := engine.EvaluateSeries(formula, data)
+			if err != nil {
+				t.Fatalf("EvaluateSeries() error = %v", err)
+			}
+			if !sameResults(got, want) {
+				t.Errorf("batch results differ from the tree walk")
+			}
+
+			compiled, err := engine.Compile(formula)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			rows := make([]interface{}, len(data))
+			for i, row := range data {
+				rows[i] = compiled.evaluateRow(&FormulaContext{FieldValues: row})
+			}
+			if !sameResults(rows, want) {
+				t.Errorf("compiled results differ from the tree walk")
+			}
+		})
+	}
+}
+
+func TestPlanVector(t *testing.T) {
+	engine := NewFormulaEngine()
+	tests := []struct {
+		formula string
+		want    bool
+	}{
+		{"[Sales] - [Cost]", true},
+		{"IF([Sales] > 0, [Sales] * 2, 0)", true},
+		{"[Sales] > [Cost]", true},
+		{"[Sales]", false},                     // returned unconverted
+		{"IF([Sales] > 0, [Sales], 0)", false}, // branch returned unconverted
+		{"[Sales] = [Cost]", false},            // compares text forms
+		{"IF([Sales] > 0, 1, FALSE)", false},   // mixed branch types
+		{"ROUND([Sales], 2)", false},
+		{"RUNNING_SUM([Sales])", false},
+	}
+	for _, tt := range tests {
+		node, err := engine.ParseFormula(tt.formula)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tt.formula, err)
+		}
+		if got := planVector(node) != nil; got != tt.want {
+			t.Errorf("planVector(%q) = %v, want %v", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestCompiledFormula_MixedBatchFallsBack(t *testing.T) {
+	engine := NewFormulaEngine()
+	data := []map[string]interface{}{
+		{"Sales": 100.0, "Cost": 40.0},
+		{"Sales": "250", "Cost": 50.0}, // numeric text: row evaluator only
+		{"Sales": nil, "Cost": 10.0},
+	}
+	got, err := engine.EvaluateSeries("[Sales] - [Cost]", data)
+	if err != nil {
+		t.Fatalf("EvaluateSeries() error = %v", err)
+	}
+	if got[0] != 60.0 || got[1] != 200.0 {
+		t.Errorf("got %v, want 60 and 200", got[:2])
+	}
+	if fe, ok := got[2].(*FormulaError); !ok || fe.Code != ErrValue {
+		t.Errorf("got %v for a blank operand, want #VALUE!", got[2])
+	}
+}
+
+func TestCompiledFormula_UserFunctions(t *testing.T) {
+	engine, err := NewFormulaEngine().WithUserFunctions([]UserFunction{
+		{Name: "MARGIN", Params: []string{"sales", "cost"}, Body: "([sales] - [cost]) / [sales]"},
+		{Name: "FACT", Params: []string{"n"}, Body: "IF([n] <= 1, 1, [n] * FACT([n] - 1))"},
+	})
+	if err != nil {
+		t.Fatalf("WithUserFunctions() error = %v", err)
+	}
+	data := numericRows(10)
+	for _, formula := range []string{"MARGIN([Sales], [Cost])", "FACT(5) + [Qty]", "FACT(100)"} {
+		got, err := engine.EvaluateSeries(formula, data)
+		if err != nil {
+			t.Fatalf("EvaluateSeries(%q) error = %v", formula, err)
+		}
+		if want := treeWalk(t, engine, formula, data); !sameResults(got, want) {
+			t.Errorf("%s: got %v, want %v", formula, got, want)
+		}
+	}
+}
+
+func benchmarkRows(n int, mixed bool) []map[string]interface{} {
+	data := numericRows(n)
+	if mixed {
+		// One text value per batch keeps every batch on the row evaluator
+		for i := 0; i < n; i += vectorBatchSize {
+			data[i]["Sales"] = fmt.Sprintf("%v", data[i]["Sales"])
+		}
+	}
+	return data
+}
+
+const benchmarkFormula = "IF([Sales] > [Cost], ([Sales] - [Cost]) / [Sales] * 100, 0)"
+
+func BenchmarkEvaluate_TreeWalk(b *testing.B) {
+	engine := NewFormulaEngine()
+	data := benchmarkRows(100000, false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		treeWalk(b, engine, benchmarkFormula, data)
+	}
+}
+
+func BenchmarkEvaluate_Compiled(b *testing.B) {
+	engine := NewFormulaEngine()
+	data := benchmarkRows(100000, true)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.EvaluateSeries(benchmarkFormula, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvaluate_Columnar(b *testing.B) {
+	engine := NewFormulaEngine()
+	data := benchmarkRows(100000, false)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := engine.EvaluateSeries(benchmarkFormula, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
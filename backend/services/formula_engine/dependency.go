@@ -0,0 +1,195 @@
+package formula_engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NamedFormula is a calculated field: a formula that other formulas can
+// reference by name
+type NamedFormula struct {
+	Name    string
+	Formula string
+}
+
+// CycleError reports calculated fields that reference each other in a loop
+type CycleError struct {
+	// Path lists the fields along the cycle, starting and ending with the same field
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("calculated fields form a reference cycle: %s", strings.Join(e.Path, " -> "))
+}
+
+// DependencyGraph links calculated fields to the calculated fields their
+// formulas reference. References to anything else (columns, aliases) are
+// inputs and not part of the graph.
+type DependencyGraph struct {
+	names []string       // declaration order
+	index map[string]int // lower-cased name -> position
+	deps  [][]int        // direct dependencies of each field
+}
+
+// DependencyGraph builds the dependency graph of a set of calculated fields.
+// It fails only on formulas that do not parse; cycles are reported by Order.
+func (e *FormulaEngine) DependencyGraph(fields []NamedFormula) (*DependencyGraph, error) {
+	g := &DependencyGraph{index: make(map[string]int, len(fields))}
+	for _, f := range fields {
+		key := strings.ToLower(f.Name)
+		if _, dup := g.index[key]; dup {
+			return nil, fmt.Errorf("duplicate calculated field '%s'", f.Name)
+		}
+		g.index[key] = len(g.names)
+		g.names = append(g.names, f.Name)
+	}
+
+	g.deps = make([][]int, len(fields))
+	for i, f := range fields {
+		refs, err := e.ExtractReferences(f.Formula)
+		if err != nil {
+			return nil, fmt.Errorf("calculated field '%s': %w", f.Name, err)
+		}
+		seen := make(map[int]bool)
+		for _, ref := range refs {
+			if j, ok := g.index[strings.ToLower(ref)]; ok && !seen[j] {
+				seen[j] = true
+				g.deps[i] = append(g.deps[i], j)
+			}
+		}
+	}
+	return g, nil
+}
+
+// Has reports whether name is one of the graph's fields
+func (g *DependencyGraph) Has(name string) bool {
+	_, ok := g.index[strings.ToLower(name)]
+	return ok
+}
+
+// Dependencies returns the calculated fields a field references directly
+func (g *DependencyGraph) Dependencies(name string) []string {
+	i, ok := g.index[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	out := make([]string, len(g.deps[i]))
+	for k, j := range g.deps[i] {
+		out[k] = g.names[j]
+	}
+	return out
+}
+
+// Dependents returns every field that directly or transitively references
+// name, in the order they have to be recalculated after it changes
+func (g *DependencyGraph) Dependents(name string) []string {
+	start, ok := g.index[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+	affected := map[int]bool{start: true}
+	for changed := true; changed; {
+		changed = false
+		for i, deps := range g.deps {
+			if affected[i] {
+				continue
+			}
+			for _, j := range deps {
+				if affected[j] {
+					affected[i] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	order, err := g.Order()
+	if err != nil {
+		// Fall back to declaration order when the fields are cyclic
+		order = g.names
+	}
+	var out []string
+	for _, n := range order {
+		i := g.index[strings.ToLower(n)]
+		if i != start && affected[i] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// Order returns the fields in evaluation order: every field after the fields
+// it references, otherwise keeping declaration order. It returns a
+// *CycleError when the fields reference each other in a loop.
+func (g *DependencyGraph) Order() ([]string, error) {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(g.names))
+	order := make([]string, 0, len(g.names))
+	var stack []int
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			path := []string{}
+			for k := len(stack) - 1; k >= 0; k-- {
+				if stack[k] == i {
+					for _, j := range stack[k:] {
+						path = append(path, g.names[j])
+					}
+					break
+				}
+			}
+			return &CycleError{Path: append(path, g.names[i])}
+		}
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range g.deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = done
+		order = append(order, g.names[i])
+		return nil
+	}
+
+	for i := range g.names {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// EvaluateFields evaluates calculated fields over a dataset in dependency
+// order, adding each field's value to every row so later fields can use it
+func (e *FormulaEngine) EvaluateFields(fields []NamedFormula, data []map[string]interface{}) error {
+	g, err := e.DependencyGraph(fields)
+	if err != nil {
+		return err
+	}
+	order, err := g.Order()
+	if err != nil {
+		return err
+	}
+	for _, name := range order {
+		f := fields[g.index[strings.ToLower(name)]]
+		values, err := e.EvaluateSeries(f.Formula, data)
+		if err != nil {
+			return fmt.Errorf("calculated field '%s': %w", f.Name, err)
+		}
+		for i, row := range data {
+			row[f.Name] = values[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package formula_engine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDependencyGraph_Order(t *testing.T) {
+	engine := NewFormulaEngine()
+	g, err := engine.DependencyGraph([]NamedFormula{
+		{Name: "Margin %", Formula: "[Profit] / [Revenue]"},
+		{Name: "Profit", Formula: "[Revenue] - [Cost]"},
+		{Name: "Label", Formula: `IF([margin %] > 0.5, "high", "low")`},
+		{Name: "Units", Formula: "[Qty] * 1"},
+	})
+	if err != nil {
+		t.Fatalf("DependencyGraph() error = %v", err)
+	}
+
+	order, err := g.Order()
+	if err != nil {
+		t.Fatalf("Order() error = %v", err)
+	}
+	if want := []string{"Profit", "Margin %", "Label", "Units"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("Order() = %v, want %v", order, want)
+	}
+	if got := g.Dependencies("Margin %"); !reflect.DeepEqual(got, []string{"Profit"}) {
+		t.Errorf("Dependencies() = %v", got)
+	}
+	if got := g.Dependents("profit"); !reflect.DeepEqual(got, []string{"Margin %", "Label"}) {
+		t.Errorf("Dependents() = %v", got)
+	}
+	if got := g.Dependents("Units"); len(got) != 0 {
+		t.Errorf("Dependents(Units) = %v, want none", got)
+	}
+}
+
+func TestDependencyGraph_Cycle(t *testing.T) {
+	engine := NewFormulaEngine()
+	g, err := engine.DependencyGraph([]NamedFormula{
+		{Name: "a", Formula: "[b] + 1"},
+		{Name: "b", Formula: "[c] * 2"},
+		{Name: "c", Formula: "[a] - [x]"},
+		{Name: "d", Formula: "[a]"},
+	})
+	if err != nil {
+		t.Fatalf("DependencyGraph() error = %v", err)
+	}
+	_, err = g.Order()
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("Order() error = %v, want *CycleError", err)
+	}
+	if want := []string{"a", "b", "c", "a"}; !reflect.DeepEqual(cycle.Path, want) {
+		t.Errorf("cycle = %v, want %v", cycle.Path, want)
+	}
+	// Impact is still reported for cyclic fields
+	if got := g.Dependents("c"); !reflect.DeepEqual(got, []string{"a", "b", "d"}) {
+		t.Errorf("Dependents() = %v", got)
+	}
+
+	g, _ = engine.DependencyGraph([]NamedFormula{{Name: "self", Formula: "[self] + 1"}})
+	if _, err := g.Order(); !errors.As(err, &cycle) {
+		t.Errorf("self reference error = %v, want *CycleError", err)
+	}
+}
+
+func TestEvaluateFields(t *testing.T) {
+	data := []map[string]interface{}{
+		{"Revenue": 200.0, "Cost": 50.0},
+		{"Revenue": 100.0, "Cost": 80.0},
+	}
+	err := NewFormulaEngine().EvaluateFields([]NamedFormula{
+		{Name: "Margin %", Formula: "[Profit] / [Revenue]"},
+		{Name: "Profit", Formula: "[Revenue] - [Cost]"},
+	}, data)
+	if err != nil {
+		t.Fatalf("EvaluateFields() error = %v", err)
+	}
+	if data[0]["Margin %"] != 0.75 || data[1]["Profit"] != 20.0 {
+		t.Errorf("unexpected rows: %v", data)
+	}
+}
@@ -6,7 +6,11 @@ import (
 )
 
 // FormulaEngine is the top-level entry point for formula parsing and evaluation
-type FormulaEngine struct{}
+type FormulaEngine struct {
+	// userFunctions are the user-defined functions resolved next to the
+	// built-in ones (see WithUserFunctions)
+	userFunctions map[string]*userFunction
+}
 
 // NewFormulaEngine creates a new formula engine
 func NewFormulaEngine() *FormulaEngine {
@@ -15,10 +19,14 @@ func NewFormulaEngine() *FormulaEngine {
 
 // ParseFormula tokenizes and parses a formula string into an AST
 func (e *FormulaEngine) ParseFormula(formula string) (FormulaNode, error) {
-	// Strip leading = if present (Excel convention)
-	formula = strings.TrimSpace(formula)
+	// Strip leading = if present (Excel convention), keeping token positions
+	// relative to the text the user wrote
+	trimmed := strings.TrimLeft(formula, " \t\r\n")
+	offset := len(formula) - len(trimmed)
+	formula = strings.TrimSpace(trimmed)
 	if len(formula) > 0 && formula[0] == '=' {
 		formula = formula[1:]
+		offset++
 	}
 
 	lexer := NewLexer(formula)
@@ -26,6 +34,9 @@ func (e *FormulaEngine) ParseFormula(formula string) (FormulaNode, error) {
 	if err != nil {
 		return nil, fmt.Errorf("tokenize error: %w", err)
 	}
+	for i := range tokens {
+		tokens[i].Pos += offset
+	}
 
 	parser := NewParser(tokens)
 	return parser.Parse()
@@ -77,34 +88,9 @@ func (e *FormulaEngine) collectRefs(node FormulaNode, refs *[]string) {
 }
 
 // EvaluateSeries evaluates a formula against a dataset (list of rows)
-// It parses the formula once and evaluates it for each row
+// It parses the formula once and evaluates it for each row; a row that fails
+// yields a *FormulaError value (#DIV/0!, #VALUE!, #N/A, #REF!, ...).
+// Table calculations treat the dataset as one partition in its given order.
 func (e *FormulaEngine) EvaluateSeries(formula string, data []map[string]interface{}) ([]interface{}, error) {
-	// 1. Parse formula once
-	node, err := e.ParseFormula(formula)
-	if err != nil {
-		return nil, err
-	}
-
-	results := make([]interface{}, len(data))
-
-	// 2. Iterate and evaluate
-	for i, row := range data {
-		ctx := &FormulaContext{
-			FieldValues: row,
-		}
-
-		val, err := e.evalNode(node, ctx)
-		if err != nil {
-			// Check if we should fail fast or return error for this row?
-			// For now, return error string as value or nil?
-			// Excel returns #ERROR. Let's return error message or nil.
-			// Better: return nil and logic layer handles it, or return specific Error type.
-			// Let's return the error as a string value for now to keep alignment.
-			results[i] = fmt.Sprintf("#ERROR: %v", err)
-		} else {
-			results[i] = val
-		}
-	}
-
-	return results, nil
+	return e.EvaluateTable(formula, data, WindowSpec{})
 }
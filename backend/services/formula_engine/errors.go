@@ -0,0 +1,121 @@
+package formula_engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is an Excel-compatible formula error value
+type ErrorCode string
+
+const (
+	ErrDiv0  ErrorCode = "#DIV/0!"
+	ErrValue ErrorCode = "#VALUE!"
+	ErrNA    ErrorCode = "#N/A"
+	ErrNum   ErrorCode = "#NUM!"
+	ErrRef   ErrorCode = "#REF!"
+	ErrName  ErrorCode = "#NAME?"
+)
+
+// FormulaError is an evaluation error carrying an Excel error code
+type FormulaError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *FormulaError) Error() string {
+	if e.Message == "" {
+		return string(e.Code)
+	}
+	return fmt.Sprintf("%s %s", e.Code, e.Message)
+}
+
+// MarshalJSON renders an error value as {"error": "#DIV/0!", "message": "..."}
+// so clients can tell it apart from text that happens to look like an error code
+func (e *FormulaError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Error   ErrorCode `json:"error"`
+		Message string    `json:"message,omitempty"`
+	}{e.Code, e.Message})
+}
+
+func newFormulaError(code ErrorCode, format string, args ...interface{}) *FormulaError {
+	return &FormulaError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrorCodeOf returns the Excel error code of an evaluation error
+func ErrorCodeOf(err error) (ErrorCode, bool) {
+	var fe *FormulaError
+	if errors.As(err, &fe) {
+		return fe.Code, true
+	}
+	return "", false
+}
+
+// AsFormulaError converts an evaluation error to an error value; errors that
+// carry no code become #VALUE!
+func AsFormulaError(err error) *FormulaError {
+	var fe *FormulaError
+	if errors.As(err, &fe) {
+		return fe
+	}
+	return &FormulaError{Code: ErrValue, Message: err.Error()}
+}
+
+// arityError reports a call with the wrong number of arguments
+func arityError(name string, expected string) *FormulaError {
+	return newFormulaError(ErrValue, "%s requires %s", name, expected)
+}
+
+func checkArity(name string, args []interface{}, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		switch {
+		case min == max:
+			return arityError(name, fmt.Sprintf("%d argument(s)", min))
+		case max < 0:
+			return arityError(name, fmt.Sprintf("at least %d argument(s)", min))
+		default:
+			return arityError(name, fmt.Sprintf("%d to %d arguments", min, max))
+		}
+	}
+	return nil
+}
+
+// numberArg converts a function argument to a number, failing with #VALUE!
+func numberArg(name string, v interface{}) (float64, error) {
+	if fe, ok := v.(*FormulaError); ok {
+		return 0, fe
+	}
+	if v == nil {
+		return 0, nil
+	}
+	f, err := toFloat64(v)
+	if err != nil {
+		return 0, newFormulaError(ErrValue, "%s: %v", name, err)
+	}
+	return f, nil
+}
+
+// optionalNumberArg returns args[i] as a number or the default when omitted
+func optionalNumberArg(name string, args []interface{}, i int, def float64) (float64, error) {
+	if i >= len(args) {
+		return def, nil
+	}
+	return numberArg(name, args[i])
+}
+
+// textArg renders a function argument as text the way Excel does
+func textArg(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		if val {
+			return "TRUE"
+		}
+		return "FALSE"
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -14,6 +14,11 @@ type FormulaContext struct {
 	FieldValues map[string]interface{}
 	// RangeResolver resolves a range (e.g., "A1:A10") into a list of values
 	RangeResolver func(start string, end string) ([]interface{}, error)
+
+	// window is the current row's partition for table calculations (set by EvaluateTable)
+	window *windowFrame
+	// depth counts the user-defined function calls being evaluated
+	depth int
 }
 
 // Evaluate evaluates a formula AST node against the provided context
@@ -26,7 +31,15 @@ func (e *FormulaEngine) evalNode(node FormulaNode, ctx *FormulaContext) (interfa
 	case *BoolNode:
 		return n.Value, nil
 	case *CellRefNode:
-		return e.resolveRef(n, ctx)
+		val, err := e.resolveRef(n, ctx)
+		if err != nil {
+			return nil, err
+		}
+		// Error values in the data (e.g. from another calculated field) propagate
+		if fe, ok := val.(*FormulaError); ok {
+			return nil, fe
+		}
+		return val, nil
 	case *UnaryNode:
 		return e.evalUnary(n, ctx)
 	case *BinaryNode:
@@ -40,7 +53,7 @@ func (e *FormulaEngine) evalNode(node FormulaNode, ctx *FormulaContext) (interfa
 
 func (e *FormulaEngine) resolveRef(n *CellRefNode, ctx *FormulaContext) (interface{}, error) {
 	if ctx == nil {
-		return nil, fmt.Errorf("no context provided for reference '%s'", n.Ref)
+		return nil, newFormulaError(ErrRef, "no context provided for reference '%s'", n.Ref)
 	}
 
 	// Range resolution
@@ -48,7 +61,7 @@ func (e *FormulaEngine) resolveRef(n *CellRefNode, ctx *FormulaContext) (interfa
 		if ctx.RangeResolver != nil {
 			return ctx.RangeResolver(n.Ref, n.RangeEnd)
 		}
-		return nil, fmt.Errorf("range resolution not supported in this context")
+		return nil, newFormulaError(ErrRef, "range resolution not supported in this context")
 	}
 
 	// Try cell values first
@@ -71,7 +84,7 @@ func (e *FormulaEngine) resolveRef(n *CellRefNode, ctx *FormulaContext) (interfa
 		}
 	}
 
-	return nil, fmt.Errorf("unresolved reference: %s", n.Ref)
+	return nil, newFormulaError(ErrRef, "unresolved reference: %s", n.Ref)
 }
 
 func (e *FormulaEngine) evalUnary(n *UnaryNode, ctx *FormulaContext) (interface{}, error) {
@@ -79,13 +92,17 @@ func (e *FormulaEngine) evalUnary(n *UnaryNode, ctx *FormulaContext) (interface{
 	if err != nil {
 		return nil, err
 	}
+	return applyUnary(n.Op, operand)
+}
 
+// applyUnary applies a unary operator to an evaluated operand
+func applyUnary(op TokenKind, operand interface{}) (interface{}, error) {
 	num, err := toFloat64(operand)
 	if err != nil {
-		return nil, fmt.Errorf("unary operator requires numeric operand: %w", err)
+		return nil, newFormulaError(ErrValue, "unary operator requires numeric operand: %v", err)
 	}
 
-	if n.Op == TokMinus {
+	if op == TokMinus {
 		return -num, nil
 	}
 	return num, nil
@@ -100,14 +117,18 @@ func (e *FormulaEngine) evalBinary(n *BinaryNode, ctx *FormulaContext) (interfac
 	if err != nil {
 		return nil, err
 	}
+	return applyBinary(n.Op, left, right)
+}
 
+// applyBinary applies a binary operator to evaluated operands
+func applyBinary(op TokenKind, left, right interface{}) (interface{}, error) {
 	// String concatenation
-	if n.Op == TokAmpersand {
+	if op == TokAmpersand {
 		return fmt.Sprintf("%v%v", left, right), nil
 	}
 
 	// Comparison operators (work on both numbers and strings)
-	switch n.Op {
+	switch op {
 	case TokEq:
 		return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right), nil
 	case TokNeq:
@@ -117,109 +138,81 @@ func (e *FormulaEngine) evalBinary(n *BinaryNode, ctx *FormulaContext) (interfac
 	// Numeric operations
 	lNum, lErr := toFloat64(left)
 	rNum, rErr := toFloat64(right)
+	if lErr == nil && rErr == nil {
+		return numericBinary(op, lNum, rNum)
+	}
 
-	// Comparison with numeric coercion
-	switch n.Op {
+	// Comparison of non-numeric operands falls back to text
+	switch op {
 	case TokLt:
-		if lErr == nil && rErr == nil {
-			return lNum < rNum, nil
-		}
 		return fmt.Sprintf("%v", left) < fmt.Sprintf("%v", right), nil
 	case TokGt:
-		if lErr == nil && rErr == nil {
-			return lNum > rNum, nil
-		}
 		return fmt.Sprintf("%v", left) > fmt.Sprintf("%v", right), nil
 	case TokLte:
-		if lErr == nil && rErr == nil {
-			return lNum <= rNum, nil
-		}
 		return fmt.Sprintf("%v", left) <= fmt.Sprintf("%v", right), nil
 	case TokGte:
-		if lErr == nil && rErr == nil {
-			return lNum >= rNum, nil
-		}
 		return fmt.Sprintf("%v", left) >= fmt.Sprintf("%v", right), nil
 	}
 
 	// Arithmetic — both must be numeric
 	if lErr != nil {
-		return nil, fmt.Errorf("left operand is not numeric: %v", left)
-	}
-	if rErr != nil {
-		return nil, fmt.Errorf("right operand is not numeric: %v", right)
+		return nil, newFormulaError(ErrValue, "left operand is not numeric: %v", left)
 	}
+	return nil, newFormulaError(ErrValue, "right operand is not numeric: %v", right)
+}
 
-	switch n.Op {
+// numericBinary applies an arithmetic or ordering operator to two numbers
+func numericBinary(op TokenKind, l, r float64) (interface{}, error) {
+	switch op {
+	case TokLt:
+		return l < r, nil
+	case TokGt:
+		return l > r, nil
+	case TokLte:
+		return l <= r, nil
+	case TokGte:
+		return l >= r, nil
 	case TokPlus:
-		return lNum + rNum, nil
+		return l + r, nil
 	case TokMinus:
-		return lNum - rNum, nil
+		return l - r, nil
 	case TokStar:
-		return lNum * rNum, nil
+		return l * r, nil
 	case TokSlash:
-		if rNum == 0 {
-			return nil, fmt.Errorf("division by zero")
+		if r == 0 {
+			return nil, newFormulaError(ErrDiv0, "division by zero")
 		}
-		return lNum / rNum, nil
+		return l / r, nil
 	case TokPercent:
-		if rNum == 0 {
-			return nil, fmt.Errorf("modulo by zero")
+		if r == 0 {
+			return nil, newFormulaError(ErrDiv0, "modulo by zero")
 		}
-		return math.Mod(lNum, rNum), nil
+		return math.Mod(l, r), nil
 	case TokCaret:
-		return math.Pow(lNum, rNum), nil
+		return math.Pow(l, r), nil
 	default:
-		return nil, fmt.Errorf("unknown binary operator: %s", n.Op.String())
+		return nil, fmt.Errorf("unknown binary operator: %s", op.String())
 	}
 }
 
 func (e *FormulaEngine) evalFunc(n *FuncCallNode, ctx *FormulaContext) (interface{}, error) {
 	fn, ok := GetFunction(n.Name)
 	if !ok {
-		return nil, fmt.Errorf("unknown function: %s", n.Name)
-	}
-
-	// Evaluate arguments using 'e' reference to call evalNode
-	// But Wait, evalNode is a method on e.
-	// We need to evaluate all arguments before passing to function
-	// Except for IF, which might be lazy?
-	// For standard functions, strict evaluation is easier.
-	// For IF, we should specialize or let the function handle raw nodes?
-	// Standard excel evaluates args first usually, but IF is special.
-	// CURRENT ARCHITECTURE: Evaluate args first. (Simplification)
-	// TODO: Support lazy evaluation for control flow functions by passing nodes + context to function?
-	// For now, Eager evaluation.
-
-	// Special case for IF to support lazy eval if we wanted, but let's stick to eager for simplicity unless broken.
-	// Actually IF needs lazy eval to avoid DivByZero in dead branches.
-	// e.g. IF(B1=0, 0, A1/B1). If eager, A1/B1 crashes.
-	// Let's special case IF here.
-
-	if n.Name == "IF" {
-		if len(n.Args) < 2 || len(n.Args) > 3 {
-			return nil, fmt.Errorf("IF requires 2 or 3 arguments")
-		}
-		cond, err := e.evalNode(n.Args[0], ctx)
-		if err != nil {
-			return nil, err
+		if uf, ok := e.userFunctions[n.Name]; ok {
+			return e.evalUserFunction(uf, n, ctx)
 		}
+		return nil, newFormulaError(ErrName, "unknown function: %s", n.Name)
+	}
 
-		condBool := false
-		switch v := cond.(type) {
-		case bool:
-			condBool = v
-		case float64:
-			condBool = v != 0
-		}
+	// Table calculations read the whole partition instead of their evaluated arguments
+	if windowFunctions[n.Name] {
+		return e.evalWindow(n, ctx)
+	}
 
-		if condBool {
-			return e.evalNode(n.Args[1], ctx)
-		}
-		if len(n.Args) == 3 {
-			return e.evalNode(n.Args[2], ctx)
-		}
-		return false, nil
+	// IF, IFS, SWITCH and IFERROR evaluate their arguments lazily so dead
+	// branches (e.g. IF(B1=0, 0, A1/B1)) and caught errors never surface
+	if lazyFunctions[n.Name] {
+		return e.evalLazy(n, ctx)
 	}
 
 	args := make([]interface{}, len(n.Args))
@@ -242,18 +235,12 @@ func (e *FormulaEngine) evalFunc(n *FuncCallNode, ctx *FormulaContext) (interfac
 		args[i] = val
 	}
 
-	// Post-processing for Aggregates:
-	// If a function receives a slice as an arg, it needs to handle it.
-	// Our `funcSum` expects `interface{}` but looks for float64.
-	// We need to update `registry.go` to handle slices in SUM/AVG etc. if we pass them here.
-
-	// Let's verify `funcSum` in `registry.go`...
-	// It treats `arg` as `interface{}` and calls `toFloat64`.
-	// `toFloat64` fails on slice.
-	// Fix required in `registry.go` or here.
-	// Better to fix in `registry.go` or make `toFloat64` handle flattening?
-	// Flattening here is safer for the generic engine.
+	// Lookup and conditional-aggregate functions need their ranges intact
+	if rangeFunctions[n.Name] {
+		return fn(args)
+	}
 
+	// Other functions take ranges as a flat list of values, e.g. SUM(A1, B1:B5)
 	flatArgs := make([]interface{}, 0, len(args))
 	for _, arg := range args {
 		if slice, ok := arg.([]interface{}); ok {
@@ -263,16 +250,5 @@ func (e *FormulaEngine) evalFunc(n *FuncCallNode, ctx *FormulaContext) (interfac
 		}
 	}
 
-	// Only flatten for aggregation functions?
-	// VLOOKUP expects a Range as a range, not flattened.
-	// Complex... for now let's pass `args` and let function decide?
-	// But `funcSum` in registry.go is simple.
-	// Let's use `flatArgs` for now, assuming mostly Aggregations.
-	// TODO: Add metadata to FunctionRegistry about whether it accepts ranges or scalars.
-	// For 100% parity, we need robust handling.
-
-	// Assumption: All implemented functions (SUM, AVG, MIN, MAX) handle flat lists.
-	// VLOOKUP isn't fully implemented yet.
-
 	return fn(flatArgs)
 }
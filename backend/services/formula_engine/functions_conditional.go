@@ -0,0 +1,355 @@
+package formula_engine
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rangeFunctions receive their range arguments as-is instead of flattened
+// into the argument list, so ranges stay aligned with their criteria
+var rangeFunctions = map[string]bool{
+	"VLOOKUP":    true,
+	"COUNTIF":    true,
+	"COUNTIFS":   true,
+	"SUMIF":      true,
+	"SUMIFS":     true,
+	"AVERAGEIF":  true,
+	"AVERAGEIFS": true,
+	"INDEX":      true,
+	"MATCH":      true,
+}
+
+// rangeValues flattens a range argument row by row, keeping blanks so that
+// positions line up across ranges of the same shape
+func rangeValues(v interface{}) []interface{} {
+	switch r := v.(type) {
+	case []interface{}:
+		var out []interface{}
+		for _, item := range r {
+			if row, ok := item.([]interface{}); ok {
+				out = append(out, row...)
+			} else {
+				out = append(out, item)
+			}
+		}
+		return out
+	case [][]interface{}:
+		var out []interface{}
+		for _, row := range r {
+			out = append(out, row...)
+		}
+		return out
+	default:
+		return []interface{}{v}
+	}
+}
+
+// isNumeric reports whether a cell holds a number (or a date, which Excel stores as a number)
+func isNumeric(v interface{}) bool {
+	switch v.(type) {
+	case float64, float32, int, int32, int64, time.Time:
+		return true
+	}
+	return false
+}
+
+func funcCount(args []interface{}) (interface{}, error) {
+	count := 0
+	for _, arg := range args {
+		for _, v := range rangeValues(arg) {
+			if isNumeric(v) {
+				count++
+			}
+		}
+	}
+	return float64(count), nil
+}
+
+// criterion is a parsed COUNTIF-style condition such as ">=10", "<>North" or "A*"
+type criterion struct {
+	op      string
+	number  *float64
+	date    *time.Time
+	text    string
+	pattern *regexp.Regexp
+}
+
+func parseCriterion(c interface{}) criterion {
+	switch v := c.(type) {
+	case string:
+		crit := criterion{op: "="}
+		for _, op := range []string{">=", "<=", "<>", ">", "<", "="} {
+			if strings.HasPrefix(v, op) {
+				crit.op = op
+				v = v[len(op):]
+				break
+			}
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			crit.number = &f
+			return crit
+		}
+		if t, err := toTime(v); err == nil {
+			crit.date = &t
+		}
+		crit.text = v
+		if (crit.op == "=" || crit.op == "<>") && strings.ContainsAny(v, "*?") {
+			crit.pattern = wildcardPattern(v)
+		}
+		return crit
+	case bool:
+		return criterion{op: "=", text: textArg(v)}
+	case time.Time:
+		return criterion{op: "=", date: &v}
+	default:
+		if f, err := toFloat64(v); err == nil {
+			return criterion{op: "=", number: &f}
+		}
+		return criterion{op: "=", text: textArg(v)}
+	}
+}
+
+// wildcardPattern converts Excel wildcards (* and ?, escaped with ~) to a case-insensitive regexp
+func wildcardPattern(s string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '~':
+			escaped = true
+		case r == '*':
+			b.WriteString(".*")
+		case r == '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func compareOrdered(op string, cmp int) bool {
+	switch op {
+	case "=":
+		return cmp == 0
+	case "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func (c criterion) matches(v interface{}) bool {
+	if c.date != nil {
+		if t, ok := v.(time.Time); ok {
+			return compareOrdered(c.op, t.Compare(*c.date))
+		}
+	}
+
+	if c.number != nil {
+		var f float64
+		switch val := v.(type) {
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				return c.op == "<>"
+			}
+			f = parsed
+		case bool, nil:
+			return c.op == "<>"
+		default:
+			converted, err := toFloat64(val)
+			if err != nil {
+				return c.op == "<>"
+			}
+			f = converted
+		}
+		switch {
+		case f < *c.number:
+			return compareOrdered(c.op, -1)
+		case f > *c.number:
+			return compareOrdered(c.op, 1)
+		default:
+			return compareOrdered(c.op, 0)
+		}
+	}
+
+	// An empty criterion matches blank cells ("=") or non-blank cells ("<>")
+	if c.text == "" && (c.op == "=" || c.op == "<>") {
+		blank := v == nil || v == ""
+		return blank == (c.op == "=")
+	}
+	if v == nil {
+		return c.op == "<>"
+	}
+	text := textArg(v)
+	if c.pattern != nil {
+		return c.pattern.MatchString(text) == (c.op == "=")
+	}
+	if isNumeric(v) && c.op != "=" && c.op != "<>" {
+		// Numbers never compare against text with < or >
+		return false
+	}
+	return compareOrdered(c.op, strings.Compare(strings.ToLower(text), strings.ToLower(c.text)))
+}
+
+// criteriaMatches evaluates (range, criterion) pairs and returns the matching positions
+func criteriaMatches(name string, pairs []interface{}) ([]bool, error) {
+	var matched []bool
+	for i := 0; i+1 < len(pairs); i += 2 {
+		values := rangeValues(pairs[i])
+		crit := parseCriterion(pairs[i+1])
+		if matched == nil {
+			matched = make([]bool, len(values))
+			for j := range matched {
+				matched[j] = true
+			}
+		} else if len(values) != len(matched) {
+			return nil, newFormulaError(ErrValue, "%s: criteria ranges must have the same size", name)
+		}
+		for j, v := range values {
+			if matched[j] && !crit.matches(v) {
+				matched[j] = false
+			}
+		}
+	}
+	return matched, nil
+}
+
+// sumMatched sums the numeric cells of target at the matching positions
+func sumMatched(name string, target interface{}, matched []bool) (float64, int, error) {
+	values := rangeValues(target)
+	if len(values) != len(matched) {
+		return 0, 0, newFormulaError(ErrValue, "%s: ranges must have the same size", name)
+	}
+	sum, count := 0.0, 0
+	for i, v := range values {
+		if !matched[i] || !isNumeric(v) {
+			continue
+		}
+		f, err := toFloat64(v)
+		if err != nil {
+			continue
+		}
+		sum += f
+		count++
+	}
+	return sum, count, nil
+}
+
+func funcCountIf(args []interface{}) (interface{}, error) {
+	if err := checkArity("COUNTIF", args, 2, 2); err != nil {
+		return nil, err
+	}
+	return countMatched("COUNTIF", args)
+}
+
+func funcCountIfs(args []interface{}) (interface{}, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, arityError("COUNTIFS", "range/criteria pairs")
+	}
+	return countMatched("COUNTIFS", args)
+}
+
+func countMatched(name string, pairs []interface{}) (interface{}, error) {
+	matched, err := criteriaMatches(name, pairs)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for _, m := range matched {
+		if m {
+			count++
+		}
+	}
+	return float64(count), nil
+}
+
+// SUMIF(range, criteria, [sum_range])
+func funcSumIf(args []interface{}) (interface{}, error) {
+	if err := checkArity("SUMIF", args, 2, 3); err != nil {
+		return nil, err
+	}
+	matched, err := criteriaMatches("SUMIF", args[:2])
+	if err != nil {
+		return nil, err
+	}
+	target := args[0]
+	if len(args) == 3 {
+		target = args[2]
+	}
+	sum, _, err := sumMatched("SUMIF", target, matched)
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// SUMIFS(sum_range, criteria_range1, criteria1, ...)
+func funcSumIfs(args []interface{}) (interface{}, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, arityError("SUMIFS", "a sum range and range/criteria pairs")
+	}
+	matched, err := criteriaMatches("SUMIFS", args[1:])
+	if err != nil {
+		return nil, err
+	}
+	sum, _, err := sumMatched("SUMIFS", args[0], matched)
+	if err != nil {
+		return nil, err
+	}
+	return sum, nil
+}
+
+// AVERAGEIF(range, criteria, [average_range])
+func funcAverageIf(args []interface{}) (interface{}, error) {
+	if err := checkArity("AVERAGEIF", args, 2, 3); err != nil {
+		return nil, err
+	}
+	matched, err := criteriaMatches("AVERAGEIF", args[:2])
+	if err != nil {
+		return nil, err
+	}
+	target := args[0]
+	if len(args) == 3 {
+		target = args[2]
+	}
+	return averageMatched("AVERAGEIF", target, matched)
+}
+
+// AVERAGEIFS(average_range, criteria_range1, criteria1, ...)
+func funcAverageIfs(args []interface{}) (interface{}, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, arityError("AVERAGEIFS", "an average range and range/criteria pairs")
+	}
+	matched, err := criteriaMatches("AVERAGEIFS", args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return averageMatched("AVERAGEIFS", args[0], matched)
+}
+
+func averageMatched(name string, target interface{}, matched []bool) (interface{}, error) {
+	sum, count, err := sumMatched(name, target, matched)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, newFormulaError(ErrDiv0, "%s: no cells match the criteria", name)
+	}
+	return sum / float64(count), nil
+}
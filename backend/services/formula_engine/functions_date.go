@@ -2,6 +2,8 @@ package formula_engine
 
 import (
 	"fmt"
+	"math"
+	"strings"
 	"time"
 )
 
@@ -17,9 +19,9 @@ func funcToday(args []interface{}) (interface{}, error) {
 
 func funcYear(args []interface{}) (interface{}, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("YEAR requires 1 argument")
+		return nil, arityError("YEAR", "1 argument")
 	}
-	t, err := toTime(args[0])
+	t, err := dateArg("YEAR", args[0])
 	if err != nil {
 		return nil, err
 	}
@@ -28,9 +30,9 @@ func funcYear(args []interface{}) (interface{}, error) {
 
 func funcMonth(args []interface{}) (interface{}, error) {
 	if len(args) != 1 {
-		return nil, fmt.Errorf("MONTH requires 1 argument")
+		return nil, arityError("MONTH", "1 argument")
 	}
-	t, err := toTime(args[0])
+	t, err := dateArg("MONTH", args[0])
 	if err != nil {
 		return nil, err
 	}
@@ -47,11 +49,200 @@ func toTime(v interface{}) (time.Time, error) {
 		if t, err := time.Parse(time.RFC3339, val); err == nil {
 			return t, nil
 		}
-		if t, err := time.Parse("2006-01-02", val); err == nil {
-			return t, nil
+		for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t, nil
+			}
 		}
 		return time.Time{}, fmt.Errorf("cannot parse date: %s", val)
+	case float64:
+		// Excel serial date: days since 1899-12-30, fraction is the time of day
+		return excelEpoch.Add(time.Duration(val * float64(24*time.Hour))), nil
 	default:
 		return time.Time{}, fmt.Errorf("cannot convert type %T to date", val)
 	}
 }
+
+// excelEpoch is day zero of Excel's 1900 date system (accounting for its 1900 leap-year bug)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// excelSerial converts a date to an Excel serial number
+func excelSerial(t time.Time) float64 {
+	y, m, d := t.Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(excelEpoch).Hours() / 24
+	seconds := t.Hour()*3600 + t.Minute()*60 + t.Second()
+	return math.Round(days) + float64(seconds)/86400
+}
+
+// dateArg converts a function argument to a date, failing with #VALUE!
+func dateArg(name string, v interface{}) (time.Time, error) {
+	if fe, ok := v.(*FormulaError); ok {
+		return time.Time{}, fe
+	}
+	t, err := toTime(v)
+	if err != nil {
+		return time.Time{}, newFormulaError(ErrValue, "%s: %v", name, err)
+	}
+	return t, nil
+}
+
+// DATE(year, month, day) normalizes out-of-range months and days like Excel;
+// years below 1900 are offset from 1900
+func funcDate(args []interface{}) (interface{}, error) {
+	if err := checkArity("DATE", args, 3, 3); err != nil {
+		return nil, err
+	}
+	parts := make([]int, 3)
+	for i, arg := range args {
+		f, err := numberArg("DATE", arg)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = int(f)
+	}
+	year := parts[0]
+	if year >= 0 && year < 1900 {
+		year += 1900
+	}
+	if year < 0 || year > 9999 {
+		return nil, newFormulaError(ErrNum, "DATE: year out of range")
+	}
+	return time.Date(year, time.Month(parts[1]), parts[2], 0, 0, 0, 0, time.UTC), nil
+}
+
+func funcDay(args []interface{}) (interface{}, error) {
+	if err := checkArity("DAY", args, 1, 1); err != nil {
+		return nil, err
+	}
+	t, err := dateArg("DAY", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return float64(t.Day()), nil
+}
+
+// WEEKDAY(date, [return_type]): 1 = Sunday..Saturday as 1..7, 2 = Monday..Sunday as 1..7,
+// 3 = Monday..Sunday as 0..6
+func funcWeekday(args []interface{}) (interface{}, error) {
+	if err := checkArity("WEEKDAY", args, 1, 2); err != nil {
+		return nil, err
+	}
+	t, err := dateArg("WEEKDAY", args[0])
+	if err != nil {
+		return nil, err
+	}
+	returnType, err := optionalNumberArg("WEEKDAY", args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	wd := int(t.Weekday()) // Sunday = 0
+	switch int(returnType) {
+	case 1:
+		return float64(wd + 1), nil
+	case 2:
+		return float64((wd+6)%7 + 1), nil
+	case 3:
+		return float64((wd + 6) % 7), nil
+	}
+	return nil, newFormulaError(ErrNum, "WEEKDAY: unsupported return_type %v", returnType)
+}
+
+// addMonths shifts a date by whole months, clamping the day to the target month's length
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// EDATE(start_date, months)
+func funcEDate(args []interface{}) (interface{}, error) {
+	if err := checkArity("EDATE", args, 2, 2); err != nil {
+		return nil, err
+	}
+	t, err := dateArg("EDATE", args[0])
+	if err != nil {
+		return nil, err
+	}
+	months, err := numberArg("EDATE", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return addMonths(t, int(months)), nil
+}
+
+// EOMONTH(start_date, months) returns the last day of the month months away
+func funcEOMonth(args []interface{}) (interface{}, error) {
+	if err := checkArity("EOMONTH", args, 2, 2); err != nil {
+		return nil, err
+	}
+	t, err := dateArg("EOMONTH", args[0])
+	if err != nil {
+		return nil, err
+	}
+	months, err := numberArg("EOMONTH", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return time.Date(t.Year(), t.Month()+time.Month(int(months))+1, 0, 0, 0, 0, 0, t.Location()), nil
+}
+
+// DATEDIFF(start_date, end_date, [unit]) follows Excel's DATEDIF units:
+// Y, M, D (default), MD, YM and YD; a start after the end is #NUM!
+func funcDateDiff(args []interface{}) (interface{}, error) {
+	if err := checkArity("DATEDIFF", args, 2, 3); err != nil {
+		return nil, err
+	}
+	start, err := dateArg("DATEDIFF", args[0])
+	if err != nil {
+		return nil, err
+	}
+	end, err := dateArg("DATEDIFF", args[1])
+	if err != nil {
+		return nil, err
+	}
+	unit := "D"
+	if len(args) == 3 {
+		unit = strings.ToUpper(textArg(args[2]))
+	}
+
+	sy, sm, sd := start.Date()
+	ey, em, ed := end.Date()
+	start = time.Date(sy, sm, sd, 0, 0, 0, 0, time.UTC)
+	end = time.Date(ey, em, ed, 0, 0, 0, 0, time.UTC)
+	if start.After(end) {
+		return nil, newFormulaError(ErrNum, "DATEDIFF: start date is after end date")
+	}
+
+	months := (ey-sy)*12 + int(em) - int(sm)
+	if ed < sd {
+		months--
+	}
+	days := func(from, to time.Time) float64 { return math.Round(to.Sub(from).Hours() / 24) }
+
+	switch unit {
+	case "D":
+		return days(start, end), nil
+	case "M":
+		return float64(months), nil
+	case "Y":
+		return float64(months / 12), nil
+	case "YM":
+		return float64(months % 12), nil
+	case "MD":
+		if ed >= sd {
+			return float64(ed - sd), nil
+		}
+		return days(time.Date(ey, em-1, sd, 0, 0, 0, 0, time.UTC), end), nil
+	case "YD":
+		shifted := time.Date(ey, sm, sd, 0, 0, 0, 0, time.UTC)
+		if shifted.After(end) {
+			shifted = time.Date(ey-1, sm, sd, 0, 0, 0, 0, time.UTC)
+		}
+		return days(shifted, end), nil
+	}
+	return nil, newFormulaError(ErrNum, "DATEDIFF: unsupported unit '%s'", unit)
+}
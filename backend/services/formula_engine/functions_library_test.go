@@ -0,0 +1,256 @@
+package formula_engine
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func libraryContext() *FormulaContext {
+	return &FormulaContext{
+		FieldValues: map[string]interface{}{
+			"Region":  []interface{}{"North", "South", "North", "East", "north"},
+			"Sales":   []interface{}{100.0, 200.0, 50.0, nil, 25.0},
+			"Units":   []interface{}{1.0, 4.0, 2.0, 3.0, "n/a"},
+			"Grid":    [][]interface{}{{"a", 1.0, 10.0}, {"b", 2.0, 20.0}, {"c", 3.0, 30.0}},
+			"Sorted":  []interface{}{10.0, 20.0, 30.0, 40.0},
+			"Blank":   nil,
+			"Amount":  0.0,
+			"Ordered": time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func assertFormulaValue(t *testing.T, formula string, got, want interface{}) {
+	t.Helper()
+	switch w := want.(type) {
+	case float64:
+		g, err := toFloat64(got)
+		if err != nil || math.Abs(g-w) > 1e-9 {
+			t.Errorf("%s = %v (%T), want %v", formula, got, got, w)
+		}
+	case time.Time:
+		g, ok := got.(time.Time)
+		if !ok || !g.Equal(w) {
+			t.Errorf("%s = %v, want %v", formula, got, w)
+		}
+	default:
+		if got != want {
+			t.Errorf("%s = %v (%T), want %v", formula, got, got, want)
+		}
+	}
+}
+
+func runLibraryCases(t *testing.T, tests []struct {
+	formula string
+	want    interface{}
+	errCode ErrorCode
+}) {
+	t.Helper()
+	engine := NewFormulaEngine()
+	ctx := libraryContext()
+
+	for _, tt := range tests {
+		t.Run(tt.formula, func(t *testing.T) {
+			got, err := engine.Evaluate(tt.formula, ctx)
+			if tt.errCode != "" {
+				code, ok := ErrorCodeOf(err)
+				if !ok || code != tt.errCode {
+					t.Fatalf("%s: got (%v, %v), want error %s", tt.formula, got, err, tt.errCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tt.formula, err)
+			}
+			assertFormulaValue(t, tt.formula, got, tt.want)
+		})
+	}
+}
+
+func TestLogicalFunctions(t *testing.T) {
+	runLibraryCases(t, []struct {
+		formula string
+		want    interface{}
+		errCode ErrorCode
+	}{
+		{"AND(TRUE, 1 > 0)", true, ""},
+		{"AND(TRUE, 0)", false, ""},
+		{`AND("text")`, nil, ErrValue},
+		{"OR(FALSE, 2 = 2)", true, ""},
+		{"OR(0, FALSE)", false, ""},
+		{"NOT(1 > 2)", true, ""},
+		{"NOT(1, 2)", nil, ErrValue},
+		{`IFS(Amount > 10, "big", Amount > 0, "small", TRUE, "none")`, "none", ""},
+		{`IFS(Amount > 10, "big")`, nil, ErrNA},
+		{`IFS(TRUE)`, nil, ErrValue},
+		{`SWITCH(2, 1, "one", 2, "two")`, "two", ""},
+		{`SWITCH("B", "a", 1, "b", 2)`, 2.0, ""},
+		{`SWITCH(9, 1, "one", "other")`, "other", ""},
+		{`SWITCH(9, 1, "one")`, nil, ErrNA},
+		{"IFERROR(1 / Amount, -1)", -1.0, ""},
+		{"IFERROR(10 / 4, -1)", 2.5, ""},
+		{"IFERROR(MissingField, 0)", 0.0, ""},
+		{"IF(Amount = 0, 0, 1 / Amount)", 0.0, ""},
+		{"ISBLANK(Blank)", true, ""},
+		{"ISBLANK(Amount)", false, ""},
+	})
+}
+
+func TestMathFunctions(t *testing.T) {
+	runLibraryCases(t, []struct {
+		formula string
+		want    interface{}
+		errCode ErrorCode
+	}{
+		{"ROUND(2.5)", 3.0, ""},
+		{"ROUND(-2.5)", -3.0, ""},
+		{"ROUND(3.14159, 2)", 3.14, ""},
+		{"ROUND(1234.5, -2)", 1200.0, ""},
+		{"ROUND(1.005, 2)", 1.01, ""},
+		{"ROUND(-1.005, 2)", -1.01, ""},
+		{"ROUND(2.675, 2)", 2.68, ""},
+		{"ROUND(1250, -2)", 1300.0, ""},
+		{`ROUND("x", 1)`, nil, ErrValue},
+		{"ABS(-4)", 4.0, ""},
+		{"MOD(10, 3)", 1.0, ""},
+		{"MOD(-3, 2)", 1.0, ""},
+		{"MOD(3, -2)", -1.0, ""},
+		{"MOD(1, 0)", nil, ErrDiv0},
+		{"POWER(2, 10)", 1024.0, ""},
+		{"POWER(0, -1)", nil, ErrDiv0},
+		{"POWER(-8, 0.5)", nil, ErrNum},
+		{"SQRT(16)", 4.0, ""},
+		{"SQRT(-1)", nil, ErrNum},
+		{"LOG(1000)", 3.0, ""},
+		{"LOG(8, 2)", 3.0, ""},
+		{"LOG(0)", nil, ErrNum},
+		{"LOG(10, 1)", nil, ErrDiv0},
+		{"CEILING(2.1)", 3.0, ""},
+		{"CEILING(2.5, 0.5)", 2.5, ""},
+		{"CEILING(-2.5, 2)", -2.0, ""},
+		{"CEILING(2.5, -2)", nil, ErrNum},
+		{"FLOOR(2.9)", 2.0, ""},
+		{"FLOOR(-2.5, 2)", -4.0, ""},
+		{"FLOOR(0.3, 0.1)", 0.3, ""},
+		{"1 / 0", nil, ErrDiv0},
+	})
+}
+
+func TestConditionalAggregateFunctions(t *testing.T) {
+	runLibraryCases(t, []struct {
+		formula string
+		want    interface{}
+		errCode ErrorCode
+	}{
+		{"COUNT(Sales)", 4.0, ""},
+		{"COUNT(Units, Grid)", 10.0, ""},
+		{`COUNTIF(Region, "North")`, 3.0, ""},
+		{`COUNTIF(Region, "<>North")`, 2.0, ""},
+		{`COUNTIF(Region, "N*")`, 3.0, ""},
+		{`COUNTIF(Region, "?ast")`, 1.0, ""},
+		{`COUNTIF(Sales, ">=100")`, 2.0, ""},
+		{`COUNTIF(Sales, "")`, 1.0, ""},
+		{`COUNTIF(Units, 4)`, 1.0, ""},
+		{`COUNTIFS(Region, "North", Sales, ">60")`, 1.0, ""},
+		{`COUNTIFS(Region, "North", Sorted, ">0")`, nil, ErrValue},
+		{`SUMIF(Region, "North", Sales)`, 175.0, ""},
+		{`SUMIF(Sales, ">50")`, 300.0, ""},
+		{`SUMIFS(Sales, Region, "north", Units, "<3")`, 150.0, ""},
+		{`AVERAGEIF(Region, "North", Sales)`, 175.0 / 3, ""},
+		{`AVERAGEIF(Region, "West", Sales)`, nil, ErrDiv0},
+		{`AVERAGEIFS(Sales, Region, "<>East", Units, ">1")`, 125.0, ""},
+	})
+}
+
+func TestTextFunctions(t *testing.T) {
+	runLibraryCases(t, []struct {
+		formula string
+		want    interface{}
+		errCode ErrorCode
+	}{
+		{`MID("Spreadsheet", 7, 5)`, "sheet", ""},
+		{`MID("abc", 5, 2)`, "", ""},
+		{`MID("abc", 0, 2)`, nil, ErrValue},
+		{`FIND("s", "Sales sheets")`, 5.0, ""},
+		{`FIND("s", "Sales sheets", 6)`, 7.0, ""},
+		{`FIND("z", "Sales")`, nil, ErrValue},
+		{`SUBSTITUTE("a-b-c", "-", "+")`, "a+b+c", ""},
+		{`SUBSTITUTE("a-b-c", "-", "+", 2)`, "a-b+c", ""},
+		{`SUBSTITUTE("a-b-c", "-", "+", 0)`, nil, ErrValue},
+		{`REPLACE("abcdef", 2, 3, "XY")`, "aXYef", ""},
+		{`REPLACE("abc", 0, 1, "X")`, nil, ErrValue},
+		{`TEXT(1234.567, "#,##0.00")`, "1,234.57", ""},
+		{`TEXT(0.256, "0.0%")`, "25.6%", ""},
+		{`TEXT(5, "000")`, "005", ""},
+		{`TEXT(-1234, "$#,##0")`, "$-1,234", ""},
+		{`TEXT(2.5, "0.##")`, "2.5", ""},
+		{`TEXT(Ordered, "yyyy-mm-dd")`, "2024-01-31", ""},
+		{`TEXT(Ordered, "dddd, mmm d")`, "Wednesday, Jan 31", ""},
+		{`TEXT("abc", "0.00")`, nil, ErrValue},
+		{`VALUE("1,234.5")`, 1234.5, ""},
+		{`VALUE("45%")`, 0.45, ""},
+		{`VALUE("$12")`, 12.0, ""},
+		{`VALUE("2024-01-31")`, 45322.0, ""},
+		{`VALUE("abc")`, nil, ErrValue},
+		{`REGEXMATCH("INV-2024-001", "^INV-\d{4}")`, true, ""},
+		{`REGEXMATCH("PO-1", "^INV")`, false, ""},
+		{`REGEXMATCH("x", "(")`, nil, ErrValue},
+	})
+}
+
+func TestDateFunctions(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	runLibraryCases(t, []struct {
+		formula string
+		want    interface{}
+		errCode ErrorCode
+	}{
+		{"DATE(2024, 2, 29)", date(2024, 2, 29), ""},
+		{"DATE(2024, 14, 1)", date(2025, 2, 1), ""},
+		{"DATE(2024, 3, 0)", date(2024, 2, 29), ""},
+		{"DATE(124, 1, 1)", date(2024, 1, 1), ""},
+		{"DATE(10000, 1, 1)", nil, ErrNum},
+		{"DAY(Ordered)", 31.0, ""},
+		{`DAY("not a date")`, nil, ErrValue},
+		{"WEEKDAY(Ordered)", 4.0, ""},
+		{"WEEKDAY(Ordered, 2)", 3.0, ""},
+		{"WEEKDAY(Ordered, 3)", 2.0, ""},
+		{"WEEKDAY(Ordered, 9)", nil, ErrNum},
+		{"EOMONTH(Ordered, 1)", date(2024, 2, 29), ""},
+		{"EOMONTH(Ordered, -2)", date(2023, 11, 30), ""},
+		{"EDATE(Ordered, 1)", date(2024, 2, 29), ""},
+		{"EDATE(Ordered, 13)", date(2025, 2, 28), ""},
+		{`DATEDIFF("2024-01-15", "2024-03-10")`, 55.0, ""},
+		{`DATEDIFF("2024-01-15", "2024-03-10", "M")`, 1.0, ""},
+		{`DATEDIFF("2020-06-30", "2024-06-29", "Y")`, 3.0, ""},
+		{`DATEDIFF("2020-06-30", "2024-08-15", "YM")`, 1.0, ""},
+		{`DATEDIFF("2024-01-25", "2024-03-10", "MD")`, 14.0, ""},
+		{`DATEDIFF("2023-11-20", "2024-01-05", "YD")`, 46.0, ""},
+		{`DATEDIFF("2024-03-10", "2024-01-15")`, nil, ErrNum},
+		{`DATEDIFF("2024-01-15", "2024-03-10", "Q")`, nil, ErrNum},
+		{"YEAR(45322)", 2024.0, ""},
+	})
+}
+
+func TestLookupFunctions(t *testing.T) {
+	runLibraryCases(t, []struct {
+		formula string
+		want    interface{}
+		errCode ErrorCode
+	}{
+		{"INDEX(Grid, 2, 3)", 20.0, ""},
+		{"INDEX(Sorted, 3)", 30.0, ""},
+		{"INDEX(Grid, 4, 1)", nil, ErrRef},
+		{"INDEX(Grid, 1, 5)", nil, ErrRef},
+		{`MATCH("North", Region, 0)`, 1.0, ""},
+		{`MATCH("ea*", Region, 0)`, 4.0, ""},
+		{`MATCH("West", Region, 0)`, nil, ErrNA},
+		{"MATCH(25, Sorted)", 2.0, ""},
+		{"MATCH(5, Sorted, 1)", nil, ErrNA},
+		{`INDEX(Sales, MATCH("East", Region, 0))`, nil, ""},
+		{`INDEX(Units, MATCH("South", Region, 0))`, 4.0, ""},
+		{`VLOOKUP("z", Grid, 2, FALSE)`, nil, ErrNA},
+	})
+}
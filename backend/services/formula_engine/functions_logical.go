@@ -0,0 +1,226 @@
+package formula_engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lazyFunctions are evaluated by the evaluator on unevaluated arguments so
+// branches that are not taken (or errors that are caught) never run
+var lazyFunctions = map[string]bool{
+	"IF":      true,
+	"IFS":     true,
+	"SWITCH":  true,
+	"IFERROR": true,
+}
+
+// funcLazy is registered for lazily evaluated functions so they can be looked
+// up like any other function; the evaluator never calls it
+func funcLazy(name string) Function {
+	return func(args []interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("%s must be evaluated by the formula evaluator", name)
+	}
+}
+
+// toBool converts a value to a logical the way Excel does for conditions
+func toBool(v interface{}) (bool, error) {
+	switch val := v.(type) {
+	case bool:
+		return val, nil
+	case nil:
+		return false, nil
+	case string:
+		switch strings.ToUpper(val) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		}
+		return false, newFormulaError(ErrValue, "cannot convert '%s' to a logical value", val)
+	case *FormulaError:
+		return false, val
+	default:
+		f, err := toFloat64(val)
+		if err != nil {
+			return false, newFormulaError(ErrValue, "cannot convert %T to a logical value", val)
+		}
+		return f != 0, nil
+	}
+}
+
+func (e *FormulaEngine) evalLazy(n *FuncCallNode, ctx *FormulaContext) (interface{}, error) {
+	args := make([]evalFn, len(n.Args))
+	for i, arg := range n.Args {
+		node := arg
+		args[i] = func(ctx *FormulaContext) (interface{}, error) {
+			return e.evalNode(node, ctx)
+		}
+	}
+	return callLazy(n.Name, args, ctx)
+}
+
+// callLazy runs a lazily evaluated function on arguments that are evaluated
+// on demand; it serves both the tree-walking and the compiled evaluator
+func callLazy(name string, args []evalFn, ctx *FormulaContext) (interface{}, error) {
+	switch name {
+	case "IF":
+		return lazyIf(args, ctx)
+	case "IFS":
+		return lazyIfs(args, ctx)
+	case "SWITCH":
+		return lazySwitch(args, ctx)
+	case "IFERROR":
+		return lazyIfError(args, ctx)
+	}
+	return nil, newFormulaError(ErrName, "unknown function: %s", name)
+}
+
+func lazyIf(args []evalFn, ctx *FormulaContext) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, arityError("IF", "2 or 3 arguments")
+	}
+	cond, err := args[0](ctx)
+	if err != nil {
+		return nil, err
+	}
+	condBool, err := toBool(cond)
+	if err != nil {
+		return nil, err
+	}
+
+	if condBool {
+		return args[1](ctx)
+	}
+	if len(args) == 3 {
+		return args[2](ctx)
+	}
+	return false, nil
+}
+
+// IFS(cond1, value1, [cond2, value2], ...) returns the value of the first true condition
+func lazyIfs(args []evalFn, ctx *FormulaContext) (interface{}, error) {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return nil, arityError("IFS", "condition/value pairs")
+	}
+	for i := 0; i < len(args); i += 2 {
+		cond, err := args[i](ctx)
+		if err != nil {
+			return nil, err
+		}
+		ok, err := toBool(cond)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return args[i+1](ctx)
+		}
+	}
+	return nil, newFormulaError(ErrNA, "IFS: no condition was met")
+}
+
+// SWITCH(expr, value1, result1, [value2, result2], ..., [default])
+func lazySwitch(args []evalFn, ctx *FormulaContext) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, arityError("SWITCH", "at least 3 arguments")
+	}
+	expr, err := args[0](ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := args[1:]
+	for i := 0; i+1 < len(cases); i += 2 {
+		val, err := cases[i](ctx)
+		if err != nil {
+			return nil, err
+		}
+		if valuesEqual(expr, val) {
+			return cases[i+1](ctx)
+		}
+	}
+	if len(cases)%2 == 1 {
+		return cases[len(cases)-1](ctx)
+	}
+	return nil, newFormulaError(ErrNA, "SWITCH: no value matched")
+}
+
+// IFERROR(value, value_if_error) catches any evaluation error of its first argument
+func lazyIfError(args []evalFn, ctx *FormulaContext) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, arityError("IFERROR", "2 arguments")
+	}
+	val, err := args[0](ctx)
+	if _, isErrValue := val.(*FormulaError); err != nil || isErrValue {
+		return args[1](ctx)
+	}
+	return val, nil
+}
+
+// logicalValues collects the logical values of AND/OR arguments; text and blanks in ranges are ignored
+func logicalValues(name string, args []interface{}) ([]bool, error) {
+	var values []bool
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			continue
+		case string:
+			upper := strings.ToUpper(v)
+			if upper != "TRUE" && upper != "FALSE" {
+				continue
+			}
+		}
+		b, err := toBool(arg)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, b)
+	}
+	if len(values) == 0 {
+		return nil, newFormulaError(ErrValue, "%s has no logical arguments", name)
+	}
+	return values, nil
+}
+
+func funcAnd(args []interface{}) (interface{}, error) {
+	values, err := logicalValues("AND", args)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if !v {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func funcOr(args []interface{}) (interface{}, error) {
+	values, err := logicalValues("OR", args)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		if v {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func funcNot(args []interface{}) (interface{}, error) {
+	if err := checkArity("NOT", args, 1, 1); err != nil {
+		return nil, err
+	}
+	b, err := toBool(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+func funcIsBlank(args []interface{}) (interface{}, error) {
+	if err := checkArity("ISBLANK", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return args[0] == nil, nil
+}
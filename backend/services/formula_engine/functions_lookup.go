@@ -0,0 +1,192 @@
+package formula_engine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// valuesEqual compares two values like Excel's "=": numbers numerically,
+// text case-insensitively, dates by instant
+func valuesEqual(a, b interface{}) bool {
+	if isNumeric(a) && isNumeric(b) {
+		if ta, ok := a.(time.Time); ok {
+			if tb, ok := b.(time.Time); ok {
+				return ta.Equal(tb)
+			}
+		}
+		fa, errA := toFloat64(a)
+		fb, errB := toFloat64(b)
+		return errA == nil && errB == nil && fa == fb
+	}
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if okA && okB {
+		return strings.EqualFold(sa, sb)
+	}
+	return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+}
+
+// compareLookup orders two values of the same kind for approximate MATCH;
+// ok is false when the values cannot be compared
+func compareLookup(a, b interface{}) (cmp int, ok bool) {
+	if isNumeric(a) && isNumeric(b) {
+		fa, errA := toFloat64(a)
+		fb, errB := toFloat64(b)
+		if errA != nil || errB != nil {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	sa, okA := a.(string)
+	sb, okB := b.(string)
+	if okA && okB {
+		return strings.Compare(strings.ToLower(sa), strings.ToLower(sb)), true
+	}
+	return 0, false
+}
+
+// tableRows normalizes a range argument into rows
+func tableRows(v interface{}) ([][]interface{}, bool) {
+	switch t := v.(type) {
+	case [][]interface{}:
+		return t, true
+	case []interface{}:
+		rows := make([][]interface{}, len(t))
+		for i, item := range t {
+			if row, ok := item.([]interface{}); ok {
+				rows[i] = row
+			} else {
+				rows[i] = []interface{}{item}
+			}
+		}
+		return rows, true
+	}
+	return nil, false
+}
+
+// INDEX(array, row_num, [column_num]); a zero row or column returns the whole column or row
+func funcIndex(args []interface{}) (interface{}, error) {
+	if err := checkArity("INDEX", args, 2, 3); err != nil {
+		return nil, err
+	}
+	rows, ok := tableRows(args[0])
+	if !ok {
+		rows = [][]interface{}{{args[0]}}
+	}
+	rowNum, err := numberArg("INDEX", args[1])
+	if err != nil {
+		return nil, err
+	}
+	colNum, err := optionalNumberArg("INDEX", args, 2, 0)
+	if err != nil {
+		return nil, err
+	}
+	r, c := int(rowNum), int(colNum)
+	if r < 0 || c < 0 {
+		return nil, newFormulaError(ErrValue, "INDEX: row and column must not be negative")
+	}
+
+	// Vectors are indexed by position alone: INDEX(row, 2) or INDEX(column, 2)
+	if len(args) == 2 {
+		switch {
+		case len(rows) == 1 && len(rows[0]) > 1:
+			r, c = 1, r
+		case len(rows) > 0 && len(rows[0]) == 1:
+			c = 1
+		}
+	}
+
+	if r > len(rows) {
+		return nil, newFormulaError(ErrRef, "INDEX: row %d is out of range", r)
+	}
+	switch {
+	case r == 0 && c == 0:
+		return args[0], nil
+	case r == 0:
+		column := make([]interface{}, len(rows))
+		for i, row := range rows {
+			if c > len(row) {
+				return nil, newFormulaError(ErrRef, "INDEX: column %d is out of range", c)
+			}
+			column[i] = row[c-1]
+		}
+		return column, nil
+	case c == 0:
+		return rows[r-1], nil
+	}
+	if c > len(rows[r-1]) {
+		return nil, newFormulaError(ErrRef, "INDEX: column %d is out of range", c)
+	}
+	return rows[r-1][c-1], nil
+}
+
+// MATCH(lookup_value, lookup_array, [match_type]) returns a 1-based position.
+// match_type 0 is exact (with wildcards for text), 1 finds the largest value
+// <= lookup in ascending data and -1 the smallest value >= lookup in descending data.
+func funcMatch(args []interface{}) (interface{}, error) {
+	if err := checkArity("MATCH", args, 2, 3); err != nil {
+		return nil, err
+	}
+	lookup := args[0]
+	values := rangeValues(args[1])
+	matchType, err := optionalNumberArg("MATCH", args, 2, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case matchType == 0:
+		if text, ok := lookup.(string); ok && strings.ContainsAny(text, "*?") {
+			pattern := wildcardPattern(text)
+			for i, v := range values {
+				if s, ok := v.(string); ok && pattern.MatchString(s) {
+					return float64(i + 1), nil
+				}
+			}
+		} else {
+			for i, v := range values {
+				if valuesEqual(v, lookup) {
+					return float64(i + 1), nil
+				}
+			}
+		}
+	case matchType > 0:
+		found := -1
+		for i, v := range values {
+			cmp, ok := compareLookup(v, lookup)
+			if !ok {
+				continue
+			}
+			if cmp > 0 {
+				break
+			}
+			found = i
+		}
+		if found >= 0 {
+			return float64(found + 1), nil
+		}
+	default:
+		found := -1
+		for i, v := range values {
+			cmp, ok := compareLookup(v, lookup)
+			if !ok {
+				continue
+			}
+			if cmp < 0 {
+				break
+			}
+			found = i
+		}
+		if found >= 0 {
+			return float64(found + 1), nil
+		}
+	}
+	return nil, newFormulaError(ErrNA, "MATCH: value not found")
+}
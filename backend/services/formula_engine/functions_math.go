@@ -0,0 +1,167 @@
+package formula_engine
+
+import (
+	"math"
+	"strconv"
+)
+
+// roundHalfAwayFromZero rounds like Excel's ROUND, which rounds .5 away from zero;
+// negative digits round to the left of the decimal point. Like Excel, the
+// scaled value is first cut to 15 significant digits, so binary representation
+// error does not decide the rounding: ROUND(1.005, 2) is 1.01, not 1.
+func roundHalfAwayFromZero(x float64, digits int) float64 {
+	if digits < 0 {
+		pow := math.Pow(10, float64(-digits))
+		return math.Round(significant15(x/pow)) * pow
+	}
+	pow := math.Pow(10, float64(digits))
+	scaled := x * pow
+	if math.IsInf(scaled, 0) || math.IsNaN(scaled) {
+		return x
+	}
+	return math.Round(significant15(scaled)) / pow
+}
+
+func significant15(x float64) float64 {
+	trimmed, err := strconv.ParseFloat(strconv.FormatFloat(x, 'g', 15, 64), 64)
+	if err != nil {
+		return x
+	}
+	return trimmed
+}
+
+func funcRound(args []interface{}) (interface{}, error) {
+	if err := checkArity("ROUND", args, 1, 2); err != nil {
+		return nil, err
+	}
+	x, err := numberArg("ROUND", args[0])
+	if err != nil {
+		return nil, err
+	}
+	digits, err := optionalNumberArg("ROUND", args, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return roundHalfAwayFromZero(x, int(digits)), nil
+}
+
+func funcAbs(args []interface{}) (interface{}, error) {
+	if err := checkArity("ABS", args, 1, 1); err != nil {
+		return nil, err
+	}
+	x, err := numberArg("ABS", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return math.Abs(x), nil
+}
+
+// MOD returns a result with the sign of the divisor, like Excel
+func funcMod(args []interface{}) (interface{}, error) {
+	if err := checkArity("MOD", args, 2, 2); err != nil {
+		return nil, err
+	}
+	n, err := numberArg("MOD", args[0])
+	if err != nil {
+		return nil, err
+	}
+	d, err := numberArg("MOD", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if d == 0 {
+		return nil, newFormulaError(ErrDiv0, "MOD: division by zero")
+	}
+	return n - d*math.Floor(n/d), nil
+}
+
+func funcPower(args []interface{}) (interface{}, error) {
+	if err := checkArity("POWER", args, 2, 2); err != nil {
+		return nil, err
+	}
+	base, err := numberArg("POWER", args[0])
+	if err != nil {
+		return nil, err
+	}
+	exp, err := numberArg("POWER", args[1])
+	if err != nil {
+		return nil, err
+	}
+	if base == 0 && exp < 0 {
+		return nil, newFormulaError(ErrDiv0, "POWER: zero raised to a negative power")
+	}
+	result := math.Pow(base, exp)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, newFormulaError(ErrNum, "POWER: result is not a real number")
+	}
+	return result, nil
+}
+
+func funcSqrt(args []interface{}) (interface{}, error) {
+	if err := checkArity("SQRT", args, 1, 1); err != nil {
+		return nil, err
+	}
+	x, err := numberArg("SQRT", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if x < 0 {
+		return nil, newFormulaError(ErrNum, "SQRT: negative argument")
+	}
+	return math.Sqrt(x), nil
+}
+
+// LOG(number, [base]) defaults to base 10
+func funcLog(args []interface{}) (interface{}, error) {
+	if err := checkArity("LOG", args, 1, 2); err != nil {
+		return nil, err
+	}
+	x, err := numberArg("LOG", args[0])
+	if err != nil {
+		return nil, err
+	}
+	base, err := optionalNumberArg("LOG", args, 1, 10)
+	if err != nil {
+		return nil, err
+	}
+	if x <= 0 || base <= 0 {
+		return nil, newFormulaError(ErrNum, "LOG: arguments must be positive")
+	}
+	if base == 1 {
+		return nil, newFormulaError(ErrDiv0, "LOG: base cannot be 1")
+	}
+	return math.Log(x) / math.Log(base), nil
+}
+
+// roundToMultiple implements CEILING and FLOOR: a positive number with a
+// negative significance is #NUM!, a zero significance yields 0
+func roundToMultiple(name string, args []interface{}, round func(float64) float64) (interface{}, error) {
+	if err := checkArity(name, args, 1, 2); err != nil {
+		return nil, err
+	}
+	x, err := numberArg(name, args[0])
+	if err != nil {
+		return nil, err
+	}
+	significance, err := optionalNumberArg(name, args, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if significance == 0 || x == 0 {
+		return 0.0, nil
+	}
+	if x > 0 && significance < 0 {
+		return nil, newFormulaError(ErrNum, "%s: significance must have the sign of the number", name)
+	}
+	// Round the quotient first so binary noise (e.g. 0.3/0.1) does not skip a multiple
+	quotient := roundHalfAwayFromZero(x/significance, 9)
+	return round(quotient) * significance, nil
+}
+
+func funcCeiling(args []interface{}) (interface{}, error) {
+	return roundToMultiple("CEILING", args, math.Ceil)
+}
+
+func funcFloor(args []interface{}) (interface{}, error) {
+	return roundToMultiple("FLOOR", args, math.Floor)
+}
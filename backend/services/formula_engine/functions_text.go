@@ -2,21 +2,28 @@ package formula_engine
 
 import (
 	"fmt"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 func funcUpper(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("UPPER requires 1 argument")
+	if err := checkArity("UPPER", args, 1, 1); err != nil {
+		return nil, err
 	}
-	return strings.ToUpper(fmt.Sprintf("%v", args[0])), nil
+	return strings.ToUpper(textArg(args[0])), nil
 }
 
 func funcLower(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("LOWER requires 1 argument")
+	if err := checkArity("LOWER", args, 1, 1); err != nil {
+		return nil, err
 	}
-	return strings.ToLower(fmt.Sprintf("%v", args[0])), nil
+	return strings.ToLower(textArg(args[0])), nil
 }
 
 func funcConcat(args []interface{}) (interface{}, error) {
@@ -34,51 +41,465 @@ func funcConcat(args []interface{}) (interface{}, error) {
 }
 
 func funcLen(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("LEN requires 1 argument")
+	if err := checkArity("LEN", args, 1, 1); err != nil {
+		return nil, err
 	}
-	return float64(len(fmt.Sprintf("%v", args[0]))), nil
+	return float64(len(textArg(args[0]))), nil
 }
 
 func funcTrim(args []interface{}) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("TRIM requires 1 argument")
+	if err := checkArity("TRIM", args, 1, 1); err != nil {
+		return nil, err
 	}
-	return strings.TrimSpace(fmt.Sprintf("%v", args[0])), nil
+	return strings.TrimSpace(textArg(args[0])), nil
 }
 
+// LEFT(text, [num_chars]) defaults to one character
 func funcLeft(args []interface{}) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("LEFT requires 2 arguments")
+	str, n, err := textCountArgs("LEFT", args)
+	if err != nil {
+		return nil, err
+	}
+	if n >= len(str) {
+		return str, nil
 	}
-	str := fmt.Sprintf("%v", args[0])
-	n, err := toFloat64(args[1])
+	return str[:n], nil
+}
+
+// RIGHT(text, [num_chars]) defaults to one character
+func funcRight(args []interface{}) (interface{}, error) {
+	str, n, err := textCountArgs("RIGHT", args)
 	if err != nil {
 		return nil, err
 	}
-	if int(n) >= len(str) {
+	if n >= len(str) {
 		return str, nil
 	}
+	return str[len(str)-n:], nil
+}
+
+func textCountArgs(name string, args []interface{}) (string, int, error) {
+	if err := checkArity(name, args, 1, 2); err != nil {
+		return "", 0, err
+	}
+	n, err := optionalNumberArg(name, args, 1, 1)
+	if err != nil {
+		return "", 0, err
+	}
 	if n < 0 {
-		return "", fmt.Errorf("length cannot be negative")
+		return "", 0, newFormulaError(ErrValue, "%s: length cannot be negative", name)
 	}
-	return str[:int(n)], nil
+	return textArg(args[0]), int(n), nil
 }
 
-func funcRight(args []interface{}) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("RIGHT requires 2 arguments")
+// intArg converts a 1-based position or length argument to an int, failing with #VALUE! below min
+func intArg(name string, v interface{}, min int) (int, error) {
+	f, err := numberArg(name, v)
+	if err != nil {
+		return 0, err
 	}
-	str := fmt.Sprintf("%v", args[0])
-	n, err := toFloat64(args[1])
+	if int(f) < min {
+		return 0, newFormulaError(ErrValue, "%s: argument must be at least %d", name, min)
+	}
+	return int(f), nil
+}
+
+// MID(text, start_num, num_chars)
+func funcMid(args []interface{}) (interface{}, error) {
+	if err := checkArity("MID", args, 3, 3); err != nil {
+		return nil, err
+	}
+	text := []rune(textArg(args[0]))
+	start, err := intArg("MID", args[1], 1)
 	if err != nil {
 		return nil, err
 	}
-	if int(n) >= len(str) {
-		return str, nil
+	n, err := intArg("MID", args[2], 0)
+	if err != nil {
+		return nil, err
 	}
-	if n < 0 {
-		return "", fmt.Errorf("length cannot be negative")
+	if start > len(text) {
+		return "", nil
+	}
+	end := start - 1 + n
+	if end > len(text) {
+		end = len(text)
+	}
+	return string(text[start-1 : end]), nil
+}
+
+// FIND(find_text, within_text, [start_num]) is case-sensitive and returns a 1-based position
+func funcFind(args []interface{}) (interface{}, error) {
+	if err := checkArity("FIND", args, 2, 3); err != nil {
+		return nil, err
+	}
+	find := []rune(textArg(args[0]))
+	within := []rune(textArg(args[1]))
+	start := 1
+	if len(args) == 3 {
+		s, err := intArg("FIND", args[2], 1)
+		if err != nil {
+			return nil, err
+		}
+		start = s
+	}
+	if start > len(within)+1 {
+		return nil, newFormulaError(ErrValue, "FIND: start_num is beyond the text")
+	}
+	rest := string(within[start-1:])
+	idx := strings.Index(rest, string(find))
+	if idx < 0 {
+		return nil, newFormulaError(ErrValue, "FIND: text not found")
+	}
+	return float64(start + utf8.RuneCountInString(rest[:idx])), nil
+}
+
+// SUBSTITUTE(text, old_text, new_text, [instance_num])
+func funcSubstitute(args []interface{}) (interface{}, error) {
+	if err := checkArity("SUBSTITUTE", args, 3, 4); err != nil {
+		return nil, err
+	}
+	text, old, repl := textArg(args[0]), textArg(args[1]), textArg(args[2])
+	if old == "" {
+		return text, nil
+	}
+	if len(args) == 3 {
+		return strings.ReplaceAll(text, old, repl), nil
+	}
+
+	instance, err := intArg("SUBSTITUTE", args[3], 1)
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	for i := 1; ; i++ {
+		idx := strings.Index(text[offset:], old)
+		if idx < 0 {
+			return text, nil
+		}
+		if i == instance {
+			pos := offset + idx
+			return text[:pos] + repl + text[pos+len(old):], nil
+		}
+		offset += idx + len(old)
+	}
+}
+
+// REPLACE(old_text, start_num, num_chars, new_text)
+func funcReplace(args []interface{}) (interface{}, error) {
+	if err := checkArity("REPLACE", args, 4, 4); err != nil {
+		return nil, err
+	}
+	text := []rune(textArg(args[0]))
+	start, err := intArg("REPLACE", args[1], 1)
+	if err != nil {
+		return nil, err
+	}
+	n, err := intArg("REPLACE", args[2], 0)
+	if err != nil {
+		return nil, err
+	}
+	if start > len(text)+1 {
+		start = len(text) + 1
+	}
+	end := start - 1 + n
+	if end > len(text) {
+		end = len(text)
+	}
+	return string(text[:start-1]) + textArg(args[3]) + string(text[end:]), nil
+}
+
+// TEXT(value, format_text) supports Excel number formats (0, #, thousands
+// separators, percent, literal prefixes/suffixes) and date formats
+func funcText(args []interface{}) (interface{}, error) {
+	if err := checkArity("TEXT", args, 2, 2); err != nil {
+		return nil, err
+	}
+	format := textArg(args[1])
+	if t, ok := args[0].(time.Time); ok || isDateFormat(format) {
+		if !ok {
+			var err error
+			if t, err = toTime(args[0]); err != nil {
+				return nil, newFormulaError(ErrValue, "TEXT: %v", err)
+			}
+		}
+		return formatDate(t, format), nil
+	}
+
+	x, err := numberArg("TEXT", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return formatNumber(x, format), nil
+}
+
+// isDateFormat reports whether a format code contains date/time placeholders
+func isDateFormat(format string) bool {
+	inQuote := false
+	for _, r := range strings.ToLower(format) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case !inQuote && strings.ContainsRune("ydhs", r):
+			return true
+		case !inQuote && r == 'm' && !strings.ContainsAny(format, "0#"):
+			return true
+		}
+	}
+	return false
+}
+
+func formatNumber(x float64, format string) string {
+	start := strings.IndexAny(format, "0#")
+	if start < 0 {
+		return format
+	}
+	end := start
+	for end < len(format) && strings.ContainsRune("0#,.", rune(format[end])) {
+		end++
+	}
+	prefix, pattern, suffix := format[:start], format[start:end], format[end:]
+	if strings.Contains(suffix, "%") || strings.Contains(prefix, "%") {
+		x *= 100
+	}
+
+	intPattern, decPattern := pattern, ""
+	if dot := strings.Index(pattern, "."); dot >= 0 {
+		intPattern, decPattern = pattern[:dot], pattern[dot+1:]
+	}
+	decimals := strings.Count(decPattern, "0") + strings.Count(decPattern, "#")
+	minInt := strings.Count(intPattern, "0")
+
+	negative := x < 0
+	digits := strconv.FormatFloat(math.Abs(roundHalfAwayFromZero(x, decimals)), 'f', decimals, 64)
+	intPart, decPart := digits, ""
+	if dot := strings.Index(digits, "."); dot >= 0 {
+		intPart, decPart = digits[:dot], digits[dot+1:]
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	for len(intPart) < minInt {
+		intPart = "0" + intPart
+	}
+	if strings.Contains(intPattern, ",") {
+		var b strings.Builder
+		for i, r := range intPart {
+			if i > 0 && (len(intPart)-i)%3 == 0 {
+				b.WriteRune(',')
+			}
+			b.WriteRune(r)
+		}
+		intPart = b.String()
+	}
+	// Optional (#) decimals drop trailing zeros
+	optional := strings.Count(decPattern, "#")
+	for optional > 0 && strings.HasSuffix(decPart, "0") {
+		decPart = decPart[:len(decPart)-1]
+		optional--
+	}
+
+	result := intPart
+	if decPart != "" {
+		result += "." + decPart
+	}
+	if negative && strings.Trim(result, "0.,") != "" {
+		result = "-" + result
+	}
+	return strings.ReplaceAll(prefix, `"`, "") + result + strings.ReplaceAll(suffix, `"`, "")
+}
+
+func formatDate(t time.Time, format string) string {
+	runes := []rune(format)
+	upper := strings.ToUpper(format)
+	twelveHour := strings.Contains(upper, "AM/PM")
+
+	type token struct {
+		kind  rune
+		count int
+		text  string
+	}
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		lower := unicode.ToLower(r)
+		switch {
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, token{text: string(runes[i+1 : min(j, len(runes))])})
+			i = j + 1
+		case strings.HasPrefix(strings.ToUpper(string(runes[i:])), "AM/PM"):
+			tokens = append(tokens, token{kind: 'a'})
+			i += 5
+		case strings.ContainsRune("ymdhs", lower):
+			j := i
+			for j < len(runes) && unicode.ToLower(runes[j]) == lower {
+				j++
+			}
+			tokens = append(tokens, token{kind: lower, count: j - i})
+			i = j
+		default:
+			tokens = append(tokens, token{text: string(r)})
+			i++
+		}
+	}
+
+	// "m" means minutes right after an hour or right before seconds
+	for i, tok := range tokens {
+		if tok.kind != 'm' {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if tokens[j].kind != 0 {
+				if tokens[j].kind == 'h' {
+					tokens[i].kind = 'n'
+				}
+				break
+			}
+		}
+		for j := i + 1; j < len(tokens); j++ {
+			if tokens[j].kind != 0 {
+				if tokens[j].kind == 's' {
+					tokens[i].kind = 'n'
+				}
+				break
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, tok := range tokens {
+		switch tok.kind {
+		case 0:
+			b.WriteString(tok.text)
+		case 'y':
+			if tok.count <= 2 {
+				b.WriteString(fmt.Sprintf("%02d", t.Year()%100))
+			} else {
+				b.WriteString(fmt.Sprintf("%04d", t.Year()))
+			}
+		case 'm':
+			switch tok.count {
+			case 1:
+				b.WriteString(strconv.Itoa(int(t.Month())))
+			case 2:
+				b.WriteString(fmt.Sprintf("%02d", int(t.Month())))
+			case 3:
+				b.WriteString(t.Month().String()[:3])
+			default:
+				b.WriteString(t.Month().String())
+			}
+		case 'd':
+			switch tok.count {
+			case 1:
+				b.WriteString(strconv.Itoa(t.Day()))
+			case 2:
+				b.WriteString(fmt.Sprintf("%02d", t.Day()))
+			case 3:
+				b.WriteString(t.Weekday().String()[:3])
+			default:
+				b.WriteString(t.Weekday().String())
+			}
+		case 'h':
+			hour := t.Hour()
+			if twelveHour {
+				hour = hour % 12
+				if hour == 0 {
+					hour = 12
+				}
+			}
+			if tok.count == 1 {
+				b.WriteString(strconv.Itoa(hour))
+			} else {
+				b.WriteString(fmt.Sprintf("%02d", hour))
+			}
+		case 'n':
+			if tok.count == 1 {
+				b.WriteString(strconv.Itoa(t.Minute()))
+			} else {
+				b.WriteString(fmt.Sprintf("%02d", t.Minute()))
+			}
+		case 's':
+			if tok.count == 1 {
+				b.WriteString(strconv.Itoa(t.Second()))
+			} else {
+				b.WriteString(fmt.Sprintf("%02d", t.Second()))
+			}
+		case 'a':
+			if t.Hour() < 12 {
+				b.WriteString("AM")
+			} else {
+				b.WriteString("PM")
+			}
+		}
+	}
+	return b.String()
+}
+
+// VALUE(text) converts numeric text (with thousands separators, currency
+// symbols or a percent sign) or a date to a number
+func funcValue(args []interface{}) (interface{}, error) {
+	if err := checkArity("VALUE", args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		s = strings.TrimPrefix(strings.NewReplacer(",", "", "$", "", "€", "", "£", "").Replace(s), "+")
+		percent := strings.HasSuffix(s, "%")
+		s = strings.TrimSuffix(s, "%")
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			if percent {
+				f /= 100
+			}
+			return f, nil
+		}
+		if t, err := toTime(v); err == nil {
+			return excelSerial(t), nil
+		}
+		return nil, newFormulaError(ErrValue, "VALUE: '%s' is not a number", v)
+	case time.Time:
+		return excelSerial(v), nil
+	default:
+		return numberArg("VALUE", v)
+	}
+}
+
+var (
+	regexCacheMu sync.RWMutex
+	regexCache   = map[string]*regexp.Regexp{}
+)
+
+// compileCachedRegexp compiles a pattern once; formulas evaluate it for every row
+func compileCachedRegexp(pattern string) (*regexp.Regexp, error) {
+	regexCacheMu.RLock()
+	re, ok := regexCache[pattern]
+	regexCacheMu.RUnlock()
+	if ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regexCacheMu.Lock()
+	if len(regexCache) > 1000 {
+		regexCache = map[string]*regexp.Regexp{}
+	}
+	regexCache[pattern] = re
+	regexCacheMu.Unlock()
+	return re, nil
+}
+
+// REGEXMATCH(text, regular_expression)
+func funcRegexMatch(args []interface{}) (interface{}, error) {
+	if err := checkArity("REGEXMATCH", args, 2, 2); err != nil {
+		return nil, err
+	}
+	re, err := compileCachedRegexp(textArg(args[1]))
+	if err != nil {
+		return nil, newFormulaError(ErrValue, "REGEXMATCH: invalid regular expression: %v", err)
 	}
-	return str[len(str)-int(n):], nil
+	return re.MatchString(textArg(args[0])), nil
 }
@@ -0,0 +1,500 @@
+package formula_engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// windowFunctions are table calculations: they are evaluated over the rows of
+// the current partition rather than the current row alone
+var windowFunctions = map[string]bool{
+	"RUNNING_SUM":      true,
+	"RUNNING_AVG":      true,
+	"RUNNING_COUNT":    true,
+	"WINDOW_SUM":       true,
+	"WINDOW_AVG":       true,
+	"WINDOW_MIN":       true,
+	"WINDOW_MAX":       true,
+	"WINDOW_COUNT":     true,
+	"RANK":             true,
+	"PERCENT_OF_TOTAL": true,
+	"LOOKUP":           true,
+	"FIRST":            true,
+	"LAST":             true,
+}
+
+// WindowSpec configures how table calculations split and order the result set
+type WindowSpec struct {
+	PartitionBy []string
+	OrderBy     []WindowOrder
+}
+
+// WindowOrder is one ordering key of a WindowSpec
+type WindowOrder struct {
+	Field string
+	Desc  bool
+}
+
+// windowPartition holds the ordered rows of one partition and caches the
+// per-row values of window functions and their arguments
+type windowPartition struct {
+	rows  []map[string]interface{}
+	cache map[FormulaNode][]interface{}
+}
+
+// windowFrame is the position of the row being evaluated within its partition
+type windowFrame struct {
+	part *windowPartition
+	pos  int
+}
+
+// EvaluateTable evaluates a formula over a whole result set. Table calculations
+// (RUNNING_SUM, WINDOW_AVG, RANK, PERCENT_OF_TOTAL, LOOKUP, FIRST, LAST) see the
+// rows of the current partition in the spec's order; results are returned in
+// the original row order, with failing rows holding a *FormulaError.
+func (e *FormulaEngine) EvaluateTable(formula string, data []map[string]interface{}, spec WindowSpec) ([]interface{}, error) {
+	compiled, err := e.Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.EvaluateTable(data, spec), nil
+}
+
+// EvaluateTable evaluates the compiled formula over a whole result set, like
+// FormulaEngine.EvaluateTable. Formulas without table calculations run in
+// batches: columnar when the referenced fields are numeric throughout the
+// batch, row by row otherwise.
+func (f *CompiledFormula) EvaluateTable(data []map[string]interface{}, spec WindowSpec) []interface{} {
+	results := make([]interface{}, len(data))
+	if !hasWindowFunction(f.node) {
+		for start := 0; start < len(data); start += vectorBatchSize {
+			end := start + vectorBatchSize
+			if end > len(data) {
+				end = len(data)
+			}
+			if f.vector != nil && f.vector.evaluate(data[start:end], results[start:end]) {
+				continue
+			}
+			for i := start; i < end; i++ {
+				results[i] = f.evaluateRow(&FormulaContext{FieldValues: data[i]})
+			}
+		}
+		return results
+	}
+
+	for _, indexes := range partitionRows(data, spec) {
+		part := &windowPartition{
+			rows:  make([]map[string]interface{}, len(indexes)),
+			cache: make(map[FormulaNode][]interface{}),
+		}
+		for j, i := range indexes {
+			part.rows[j] = data[i]
+		}
+		for j, i := range indexes {
+			results[i] = f.evaluateRow(&FormulaContext{FieldValues: data[i], window: &windowFrame{part: part, pos: j}})
+		}
+	}
+	return results
+}
+
+// evaluateRow evaluates one row, turning a failure into an error value
+func (f *CompiledFormula) evaluateRow(ctx *FormulaContext) interface{} {
+	val, err := f.run(ctx)
+	if err != nil {
+		return AsFormulaError(err)
+	}
+	return val
+}
+
+// IsTableCalculation reports whether a formula uses window functions
+func (e *FormulaEngine) IsTableCalculation(formula string) (bool, error) {
+	node, err := e.ParseFormula(formula)
+	if err != nil {
+		return false, err
+	}
+	return hasWindowFunction(node), nil
+}
+
+func hasWindowFunction(node FormulaNode) bool {
+	switch n := node.(type) {
+	case *FuncCallNode:
+		if windowFunctions[n.Name] {
+			return true
+		}
+		for _, arg := range n.Args {
+			if hasWindowFunction(arg) {
+				return true
+			}
+		}
+	case *BinaryNode:
+		return hasWindowFunction(n.Left) || hasWindowFunction(n.Right)
+	case *UnaryNode:
+		return hasWindowFunction(n.Operand)
+	}
+	return false
+}
+
+// fieldValue looks a field up by name, falling back to a case-insensitive match
+func fieldValue(row map[string]interface{}, name string) interface{} {
+	if v, ok := row[name]; ok {
+		return v
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// partitionRows groups row indexes by the partition fields (in order of first
+// appearance) and sorts each group by the order fields; blanks sort last
+func partitionRows(data []map[string]interface{}, spec WindowSpec) [][]int {
+	var keys []string
+	groups := make(map[string][]int)
+	for i, row := range data {
+		parts := make([]string, len(spec.PartitionBy))
+		for j, field := range spec.PartitionBy {
+			parts[j] = fmt.Sprintf("%v", fieldValue(row, field))
+		}
+		key := strings.Join(parts, "\x1f")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	partitions := make([][]int, len(keys))
+	for p, key := range keys {
+		indexes := groups[key]
+		if len(spec.OrderBy) > 0 {
+			sort.SliceStable(indexes, func(a, b int) bool {
+				for _, order := range spec.OrderBy {
+					va := fieldValue(data[indexes[a]], order.Field)
+					vb := fieldValue(data[indexes[b]], order.Field)
+					cmp := compareWindowValues(va, vb)
+					if cmp == 0 {
+						continue
+					}
+					if va == nil || vb == nil {
+						return vb == nil
+					}
+					if order.Desc {
+						return cmp > 0
+					}
+					return cmp < 0
+				}
+				return false
+			})
+		}
+		partitions[p] = indexes
+	}
+	return partitions
+}
+
+// compareWindowValues orders numbers numerically, dates chronologically and
+// everything else as case-insensitive text
+func compareWindowValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	if cmp, ok := compareLookup(a, b); ok {
+		return cmp
+	}
+	return strings.Compare(strings.ToLower(textArg(a)), strings.ToLower(textArg(b)))
+}
+
+func (e *FormulaEngine) evalWindow(n *FuncCallNode, ctx *FormulaContext) (interface{}, error) {
+	if ctx == nil || ctx.window == nil {
+		return nil, newFormulaError(ErrValue, "%s is a table calculation and needs a result set", n.Name)
+	}
+	frame := ctx.window
+	size := len(frame.part.rows)
+
+	switch n.Name {
+	case "FIRST", "LAST":
+		if len(n.Args) > 1 {
+			return nil, arityError(n.Name, "0 or 1 argument")
+		}
+		target := 0
+		if n.Name == "LAST" {
+			target = size - 1
+		}
+		// FIRST() and LAST() are offsets for LOOKUP and WINDOW_ bounds;
+		// FIRST(expr) and LAST(expr) return the value at that row
+		if len(n.Args) == 0 {
+			return float64(target - frame.pos), nil
+		}
+		return e.windowValueAt(n.Args[0], frame.part, target)
+	case "LOOKUP":
+		if len(n.Args) != 2 {
+			return nil, arityError("LOOKUP", "2 arguments")
+		}
+		offset, err := e.evalNode(n.Args[1], ctx)
+		if err != nil {
+			return nil, err
+		}
+		k, err := numberArg("LOOKUP", offset)
+		if err != nil {
+			return nil, err
+		}
+		target := frame.pos + int(k)
+		if target < 0 || target >= size {
+			return nil, nil
+		}
+		return e.windowValueAt(n.Args[0], frame.part, target)
+	}
+
+	values, ok := frame.part.cache[n]
+	if !ok {
+		var err error
+		values, err = e.computeWindow(n, frame.part)
+		if err != nil {
+			return nil, err
+		}
+		frame.part.cache[n] = values
+	}
+	if fe, ok := values[frame.pos].(*FormulaError); ok {
+		return nil, fe
+	}
+	return values[frame.pos], nil
+}
+
+// windowColumn evaluates an expression for every row of the partition;
+// failing rows hold their *FormulaError
+func (e *FormulaEngine) windowColumn(node FormulaNode, part *windowPartition) []interface{} {
+	if values, ok := part.cache[node]; ok {
+		return values
+	}
+	values := make([]interface{}, len(part.rows))
+	for j, row := range part.rows {
+		val, err := e.evalNode(node, &FormulaContext{FieldValues: row, window: &windowFrame{part: part, pos: j}})
+		if err != nil {
+			values[j] = AsFormulaError(err)
+		} else {
+			values[j] = val
+		}
+	}
+	part.cache[node] = values
+	return values
+}
+
+func (e *FormulaEngine) windowValueAt(node FormulaNode, part *windowPartition, pos int) (interface{}, error) {
+	val := e.windowColumn(node, part)[pos]
+	if fe, ok := val.(*FormulaError); ok {
+		return nil, fe
+	}
+	return val, nil
+}
+
+func (e *FormulaEngine) computeWindow(n *FuncCallNode, part *windowPartition) ([]interface{}, error) {
+	size := len(part.rows)
+	results := make([]interface{}, size)
+
+	switch n.Name {
+	case "RUNNING_SUM", "RUNNING_AVG", "RUNNING_COUNT":
+		if len(n.Args) != 1 {
+			return nil, arityError(n.Name, "1 argument")
+		}
+		agg := strings.TrimPrefix(n.Name, "RUNNING_")
+		values := e.windowColumn(n.Args[0], part)
+		acc := &windowAccumulator{}
+		for j, v := range values {
+			acc.add(v)
+			results[j] = acc.result(agg)
+		}
+		return results, nil
+
+	case "WINDOW_SUM", "WINDOW_AVG", "WINDOW_MIN", "WINDOW_MAX", "WINDOW_COUNT":
+		if len(n.Args) != 1 && len(n.Args) != 3 {
+			return nil, arityError(n.Name, "1 or 3 arguments")
+		}
+		agg := strings.TrimPrefix(n.Name, "WINDOW_")
+		values := e.windowColumn(n.Args[0], part)
+		if len(n.Args) == 1 {
+			acc := &windowAccumulator{}
+			for _, v := range values {
+				acc.add(v)
+			}
+			total := acc.result(agg)
+			for j := range results {
+				results[j] = total
+			}
+			return results, nil
+		}
+		// WINDOW_AVG(expr, start, end) uses offsets relative to each row, e.g. -2, 0
+		starts := e.windowColumn(n.Args[1], part)
+		ends := e.windowColumn(n.Args[2], part)
+		for j := range results {
+			start, err := numberArg(n.Name, starts[j])
+			if err != nil {
+				results[j] = AsFormulaError(err)
+				continue
+			}
+			end, err := numberArg(n.Name, ends[j])
+			if err != nil {
+				results[j] = AsFormulaError(err)
+				continue
+			}
+			from, to := max(j+int(start), 0), min(j+int(end), size-1)
+			acc := &windowAccumulator{}
+			for k := from; k <= to; k++ {
+				acc.add(values[k])
+			}
+			results[j] = acc.result(agg)
+		}
+		return results, nil
+
+	case "RANK":
+		if len(n.Args) < 1 || len(n.Args) > 2 {
+			return nil, arityError("RANK", "1 or 2 arguments")
+		}
+		values := e.windowColumn(n.Args[0], part)
+		ascending := false
+		if len(n.Args) == 2 && size > 0 {
+			order, err := e.windowValueAt(n.Args[1], part, 0)
+			if err != nil {
+				return nil, err
+			}
+			switch strings.ToLower(textArg(order)) {
+			case "asc":
+				ascending = true
+			case "desc":
+			default:
+				return nil, newFormulaError(ErrValue, "RANK: order must be \"asc\" or \"desc\"")
+			}
+		}
+		// Competition ranking: ties share a rank and leave a gap (1, 2, 2, 4)
+		for j, v := range values {
+			if fe, ok := v.(*FormulaError); ok {
+				results[j] = fe
+				continue
+			}
+			if v == nil {
+				continue
+			}
+			rank := 1
+			for _, other := range values {
+				if other == nil {
+					continue
+				}
+				if _, isErr := other.(*FormulaError); isErr {
+					continue
+				}
+				cmp := compareWindowValues(other, v)
+				if (ascending && cmp < 0) || (!ascending && cmp > 0) {
+					rank++
+				}
+			}
+			results[j] = float64(rank)
+		}
+		return results, nil
+
+	case "PERCENT_OF_TOTAL":
+		if len(n.Args) != 1 {
+			return nil, arityError("PERCENT_OF_TOTAL", "1 argument")
+		}
+		values := e.windowColumn(n.Args[0], part)
+		acc := &windowAccumulator{}
+		for _, v := range values {
+			acc.add(v)
+		}
+		total := acc.result("SUM")
+		for j, v := range values {
+			switch {
+			case acc.err != nil:
+				results[j] = acc.err
+			case v == nil:
+			case total == 0.0:
+				results[j] = newFormulaError(ErrDiv0, "PERCENT_OF_TOTAL: total is zero")
+			default:
+				f, err := numberArg("PERCENT_OF_TOTAL", v)
+				if err != nil {
+					results[j] = AsFormulaError(err)
+					continue
+				}
+				results[j] = f / total.(float64)
+			}
+		}
+		return results, nil
+	}
+	return nil, newFormulaError(ErrName, "unknown function: %s", n.Name)
+}
+
+// windowAccumulator aggregates partition values: blanks and text are skipped
+// like Excel's SUM, and the first error value poisons the result
+type windowAccumulator struct {
+	sum      float64
+	count    int
+	nonBlank int
+	min, max float64
+	err      *FormulaError
+}
+
+func (a *windowAccumulator) add(v interface{}) {
+	if fe, ok := v.(*FormulaError); ok {
+		if a.err == nil {
+			a.err = fe
+		}
+		return
+	}
+	if v == nil {
+		return
+	}
+	a.nonBlank++
+	if _, isText := v.(string); isText {
+		return
+	}
+	f, err := toFloat64(v)
+	if err != nil {
+		return
+	}
+	if a.count == 0 || f < a.min {
+		a.min = f
+	}
+	if a.count == 0 || f > a.max {
+		a.max = f
+	}
+	a.sum += f
+	a.count++
+}
+
+func (a *windowAccumulator) result(agg string) interface{} {
+	if a.err != nil {
+		return a.err
+	}
+	switch agg {
+	case "SUM":
+		return a.sum
+	case "COUNT":
+		return float64(a.nonBlank)
+	case "AVG":
+		if a.count == 0 {
+			return newFormulaError(ErrDiv0, "no numeric values to average")
+		}
+		return a.sum / float64(a.count)
+	case "MIN":
+		if a.count == 0 {
+			return nil
+		}
+		return a.min
+	case "MAX":
+		if a.count == 0 {
+			return nil
+		}
+		return a.max
+	}
+	return newFormulaError(ErrName, "unknown aggregate: %s", agg)
+}
@@ -0,0 +1,94 @@
+package formula_engine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func windowData() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"Region": "N", "Month": 1, "Sales": 10},
+		{"Region": "S", "Month": 1, "Sales": 40},
+		{"Region": "N", "Month": 3, "Sales": 30},
+		{"Region": "N", "Month": 2, "Sales": 20},
+		{"Region": "S", "Month": 2, "Sales": 40},
+		{"Region": "S", "Month": 3, "Sales": nil},
+	}
+}
+
+func TestEvaluateTable(t *testing.T) {
+	engine := NewFormulaEngine()
+	byRegion := WindowSpec{PartitionBy: []string{"Region"}, OrderBy: []WindowOrder{{Field: "Month"}}}
+
+	tests := []struct {
+		name    string
+		formula string
+		spec    WindowSpec
+		want    []interface{}
+	}{
+		{"Running sum per partition", "RUNNING_SUM([Sales])", byRegion,
+			[]interface{}{10.0, 40.0, 60.0, 30.0, 80.0, 80.0}},
+		{"Running count skips blanks", "RUNNING_COUNT([Sales])", byRegion,
+			[]interface{}{1.0, 1.0, 3.0, 2.0, 2.0, 2.0}},
+		{"Moving average", "WINDOW_AVG([Sales], -1, 0)", byRegion,
+			[]interface{}{10.0, 40.0, 25.0, 15.0, 40.0, 40.0}},
+		{"Window max of partition", "WINDOW_MAX([Sales])", byRegion,
+			[]interface{}{30.0, 40.0, 30.0, 30.0, 40.0, 40.0}},
+		{"Rank with ties", "RANK([Sales])", WindowSpec{},
+			[]interface{}{5.0, 1.0, 3.0, 4.0, 1.0, nil}},
+		{"Rank ascending", `RANK([Sales], "asc")`, WindowSpec{PartitionBy: []string{"Region"}},
+			[]interface{}{1.0, 1.0, 3.0, 2.0, 1.0, nil}},
+		{"Percent of total", "PERCENT_OF_TOTAL([Sales])", WindowSpec{PartitionBy: []string{"Region"}},
+			[]interface{}{10.0 / 60, 0.5, 0.5, 20.0 / 60, 0.5, nil}},
+		{"Previous row", "LOOKUP([Sales], -1)", byRegion,
+			[]interface{}{nil, nil, 20, 10, 40, 40}},
+		{"Difference from first", "[Month] - LOOKUP([Month], FIRST())", byRegion,
+			[]interface{}{0.0, 0.0, 2.0, 1.0, 1.0, 2.0}},
+		{"Offsets", "FIRST() & \"/\" & LAST()", byRegion,
+			[]interface{}{"0/2", "0/2", "-2/0", "-1/1", "-1/1", "-2/0"}},
+		{"Last value", "LAST([Month])", byRegion,
+			[]interface{}{3, 3, 3, 3, 3, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engine.EvaluateTable(tt.formula, windowData(), tt.spec)
+			if err != nil {
+				t.Fatalf("EvaluateTable(%q) error = %v", tt.formula, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("EvaluateTable(%q) = %v, want %v", tt.formula, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateTable_RowFormulasUnchanged(t *testing.T) {
+	engine := NewFormulaEngine()
+	got, err := engine.EvaluateTable("[Sales] * 2", windowData(), WindowSpec{PartitionBy: []string{"Region"}})
+	if err != nil {
+		t.Fatalf("EvaluateTable() error = %v", err)
+	}
+	want := []interface{}{20.0, 80.0, 60.0, 40.0, 80.0}
+	if !reflect.DeepEqual(got[:5], want) {
+		t.Errorf("EvaluateTable() = %v, want %v", got[:5], want)
+	}
+}
+
+func TestIsTableCalculation(t *testing.T) {
+	engine := NewFormulaEngine()
+	for formula, want := range map[string]bool{
+		"[Sales] * 2":                           false,
+		"SUM([a], [b])":                         false,
+		"[Sales] / WINDOW_SUM([Sales])":         true,
+		"IF(RANK([Sales]) <= 3, \"top\", \"\")": true,
+	} {
+		got, err := engine.IsTableCalculation(formula)
+		if err != nil {
+			t.Fatalf("IsTableCalculation(%q) error = %v", formula, err)
+		}
+		if got != want {
+			t.Errorf("IsTableCalculation(%q) = %v, want %v", formula, got, want)
+		}
+	}
+}
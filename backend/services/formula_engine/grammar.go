@@ -104,7 +104,8 @@ type Token struct {
 
 // ---- AST Nodes ----
 
-// FormulaNode is the interface for all AST nodes
+// FormulaNode is the interface for all AST nodes. Node Pos fields are byte
+// offsets into the formula text.
 type FormulaNode interface {
 	NodeType() string
 	String() string
@@ -113,6 +114,7 @@ type FormulaNode interface {
 // NumberNode represents a numeric literal
 type NumberNode struct {
 	Value float64
+	Pos   int
 }
 
 func (n *NumberNode) NodeType() string { return "number" }
@@ -121,6 +123,7 @@ func (n *NumberNode) String() string   { return fmt.Sprintf("%g", n.Value) }
 // StringNode represents a string literal
 type StringNode struct {
 	Value string
+	Pos   int
 }
 
 func (n *StringNode) NodeType() string { return "string" }
@@ -129,6 +132,7 @@ func (n *StringNode) String() string   { return fmt.Sprintf("%q", n.Value) }
 // BoolNode represents TRUE/FALSE
 type BoolNode struct {
 	Value bool
+	Pos   int
 }
 
 func (n *BoolNode) NodeType() string { return "bool" }
@@ -139,6 +143,7 @@ func (n *BoolNode) String() string   { return fmt.Sprintf("%v", n.Value) }
 type CellRefNode struct {
 	Ref      string
 	RangeEnd string // empty if single cell or named ref
+	Pos      int
 }
 
 func (n *CellRefNode) NodeType() string { return "cellRef" }
@@ -153,6 +158,7 @@ func (n *CellRefNode) String() string {
 type UnaryNode struct {
 	Op      TokenKind
 	Operand FormulaNode
+	Pos     int
 }
 
 func (n *UnaryNode) NodeType() string { return "unary" }
@@ -163,6 +169,7 @@ type BinaryNode struct {
 	Op    TokenKind
 	Left  FormulaNode
 	Right FormulaNode
+	Pos   int // position of the operator
 }
 
 func (n *BinaryNode) NodeType() string { return "binary" }
@@ -174,6 +181,7 @@ func (n *BinaryNode) String() string {
 type FuncCallNode struct {
 	Name string
 	Args []FormulaNode
+	Pos  int
 }
 
 func (n *FuncCallNode) NodeType() string { return "funcCall" }
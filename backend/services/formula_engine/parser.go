@@ -72,12 +72,12 @@ func (p *FormulaParser) parseComparison() (FormulaNode, error) {
 	for {
 		kind := p.current().Kind
 		if kind == TokEq || kind == TokNeq || kind == TokLt || kind == TokGt || kind == TokLte || kind == TokGte {
-			p.advance()
+			op := p.advance()
 			right, err := p.parseConcat()
 			if err != nil {
 				return nil, err
 			}
-			left = &BinaryNode{Op: kind, Left: left, Right: right}
+			left = &BinaryNode{Op: kind, Left: left, Right: right, Pos: op.Pos}
 		} else {
 			break
 		}
@@ -92,12 +92,12 @@ func (p *FormulaParser) parseConcat() (FormulaNode, error) {
 	}
 
 	for p.current().Kind == TokAmpersand {
-		p.advance()
+		op := p.advance()
 		right, err := p.parseAdditive()
 		if err != nil {
 			return nil, err
 		}
-		left = &BinaryNode{Op: TokAmpersand, Left: left, Right: right}
+		left = &BinaryNode{Op: TokAmpersand, Left: left, Right: right, Pos: op.Pos}
 	}
 	return left, nil
 }
@@ -111,12 +111,12 @@ func (p *FormulaParser) parseAdditive() (FormulaNode, error) {
 	for {
 		kind := p.current().Kind
 		if kind == TokPlus || kind == TokMinus {
-			p.advance()
+			op := p.advance()
 			right, err := p.parseMultiplicative()
 			if err != nil {
 				return nil, err
 			}
-			left = &BinaryNode{Op: kind, Left: left, Right: right}
+			left = &BinaryNode{Op: kind, Left: left, Right: right, Pos: op.Pos}
 		} else {
 			break
 		}
@@ -133,12 +133,12 @@ func (p *FormulaParser) parseMultiplicative() (FormulaNode, error) {
 	for {
 		kind := p.current().Kind
 		if kind == TokStar || kind == TokSlash || kind == TokPercent {
-			p.advance()
+			op := p.advance()
 			right, err := p.parsePower()
 			if err != nil {
 				return nil, err
 			}
-			left = &BinaryNode{Op: kind, Left: left, Right: right}
+			left = &BinaryNode{Op: kind, Left: left, Right: right, Pos: op.Pos}
 		} else {
 			break
 		}
@@ -153,12 +153,12 @@ func (p *FormulaParser) parsePower() (FormulaNode, error) {
 	}
 
 	if p.current().Kind == TokCaret {
-		p.advance()
+		op := p.advance()
 		exp, err := p.parseUnary()
 		if err != nil {
 			return nil, err
 		}
-		return &BinaryNode{Op: TokCaret, Left: base, Right: exp}, nil
+		return &BinaryNode{Op: TokCaret, Left: base, Right: exp, Pos: op.Pos}, nil
 	}
 	return base, nil
 }
@@ -170,7 +170,7 @@ func (p *FormulaParser) parseUnary() (FormulaNode, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &UnaryNode{Op: op.Kind, Operand: operand}, nil
+		return &UnaryNode{Op: op.Kind, Operand: operand, Pos: op.Pos}, nil
 	}
 	return p.parsePrimary()
 }
@@ -185,15 +185,15 @@ func (p *FormulaParser) parsePrimary() (FormulaNode, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid number: %s", tok.Value)
 		}
-		return &NumberNode{Value: val}, nil
+		return &NumberNode{Value: val, Pos: tok.Pos}, nil
 
 	case TokString:
 		p.advance()
-		return &StringNode{Value: tok.Value}, nil
+		return &StringNode{Value: tok.Value, Pos: tok.Pos}, nil
 
 	case TokBool:
 		p.advance()
-		return &BoolNode{Value: tok.Value == "TRUE"}, nil
+		return &BoolNode{Value: tok.Value == "TRUE", Pos: tok.Pos}, nil
 
 	case TokCellRef:
 		p.advance()
@@ -207,18 +207,18 @@ func (p *FormulaParser) parsePrimary() (FormulaNode, error) {
 			}
 			rangeEnd = endTok.Value
 		}
-		return &CellRefNode{Ref: ref, RangeEnd: rangeEnd}, nil
+		return &CellRefNode{Ref: ref, RangeEnd: rangeEnd, Pos: tok.Pos}, nil
 
 	case TokIdent:
 		// Could be a function call
 		name := tok.Value
 		p.advance()
 		if p.current().Kind == TokLParen {
-			return p.parseFuncCall(name)
+			return p.parseFuncCall(name, tok.Pos)
 		}
 		// Otherwise treat as a named reference (column/field name)
 		// Or maybe just an identifier. For now, we reuse CellRefNode which handles named refs too.
-		return &CellRefNode{Ref: name}, nil
+		return &CellRefNode{Ref: name, Pos: tok.Pos}, nil
 
 	case TokLParen:
 		p.advance()
@@ -236,7 +236,7 @@ func (p *FormulaParser) parsePrimary() (FormulaNode, error) {
 	}
 }
 
-func (p *FormulaParser) parseFuncCall(name string) (FormulaNode, error) {
+func (p *FormulaParser) parseFuncCall(name string, pos int) (FormulaNode, error) {
 	p.advance() // skip (
 	var args []FormulaNode
 
@@ -261,5 +261,5 @@ func (p *FormulaParser) parseFuncCall(name string) (FormulaNode, error) {
 		return nil, fmt.Errorf("expected ')' after function arguments at position %d", p.current().Pos)
 	}
 
-	return &FuncCallNode{Name: name, Args: args}, nil
+	return &FuncCallNode{Name: name, Args: args, Pos: pos}, nil
 }
@@ -3,6 +3,7 @@ package formula_engine
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"strings"
 )
 
@@ -17,19 +18,75 @@ var FunctionRegistry = map[string]Function{
 	"MAX":     funcMax,
 	"IF":      funcIf,
 	"VLOOKUP": funcVLookup,
+	// Logical
+	"AND":     funcAnd,
+	"OR":      funcOr,
+	"NOT":     funcNot,
+	"IFS":     funcLazy("IFS"),
+	"SWITCH":  funcLazy("SWITCH"),
+	"IFERROR": funcLazy("IFERROR"),
+	"ISBLANK": funcIsBlank,
+	// Math
+	"ROUND":   funcRound,
+	"ABS":     funcAbs,
+	"MOD":     funcMod,
+	"POWER":   funcPower,
+	"SQRT":    funcSqrt,
+	"LOG":     funcLog,
+	"CEILING": funcCeiling,
+	"FLOOR":   funcFloor,
+	// Conditional aggregates
+	"COUNT":      funcCount,
+	"COUNTIF":    funcCountIf,
+	"COUNTIFS":   funcCountIfs,
+	"SUMIF":      funcSumIf,
+	"SUMIFS":     funcSumIfs,
+	"AVERAGEIF":  funcAverageIf,
+	"AVERAGEIFS": funcAverageIfs,
+	// Lookup
+	"INDEX": funcIndex,
+	"MATCH": funcMatch,
 	// Date/Time
-	"NOW":   funcNow,
-	"TODAY": funcToday,
-	"YEAR":  funcYear,
-	"MONTH": funcMonth,
+	"NOW":      funcNow,
+	"TODAY":    funcToday,
+	"YEAR":     funcYear,
+	"MONTH":    funcMonth,
+	"DATE":     funcDate,
+	"DAY":      funcDay,
+	"WEEKDAY":  funcWeekday,
+	"EOMONTH":  funcEOMonth,
+	"EDATE":    funcEDate,
+	"DATEDIFF": funcDateDiff,
+	"DATEDIF":  funcDateDiff,
 	// Text
-	"UPPER":  funcUpper,
-	"LOWER":  funcLower,
-	"CONCAT": funcConcat,
-	"LEN":    funcLen,
-	"TRIM":   funcTrim,
-	"LEFT":   funcLeft,
-	"RIGHT":  funcRight,
+	"UPPER":      funcUpper,
+	"LOWER":      funcLower,
+	"CONCAT":     funcConcat,
+	"LEN":        funcLen,
+	"TRIM":       funcTrim,
+	"LEFT":       funcLeft,
+	"RIGHT":      funcRight,
+	"MID":        funcMid,
+	"FIND":       funcFind,
+	"SUBSTITUTE": funcSubstitute,
+	"REPLACE":    funcReplace,
+	"TEXT":       funcText,
+	"VALUE":      funcValue,
+	"REGEXMATCH": funcRegexMatch,
+	// Table calculations (evaluated over the partition by the evaluator)
+	"RUNNING_SUM":      funcLazy("RUNNING_SUM"),
+	"RUNNING_AVG":      funcLazy("RUNNING_AVG"),
+	"RUNNING_COUNT":    funcLazy("RUNNING_COUNT"),
+	"WINDOW_SUM":       funcLazy("WINDOW_SUM"),
+	"WINDOW_AVG":       funcLazy("WINDOW_AVG"),
+	"WINDOW_MIN":       funcLazy("WINDOW_MIN"),
+	"WINDOW_MAX":       funcLazy("WINDOW_MAX"),
+	"WINDOW_COUNT":     funcLazy("WINDOW_COUNT"),
+	"RANK":             funcLazy("RANK"),
+	"PERCENT_OF_TOTAL": funcLazy("PERCENT_OF_TOTAL"),
+	"LOOKUP":           funcLazy("LOOKUP"),
+	"FIRST":            funcLazy("FIRST"),
+	"LAST":             funcLazy("LAST"),
 }
 
 // Helper to convert any value to float64
@@ -47,14 +104,10 @@ func toFloat64(v interface{}) (float64, error) {
 		}
 		return 0, nil
 	case string:
-		// Excel-like: strings in arithmetic might convert if they look like numbers
-		// But in strict mode, maybe not. Let's try to parse.
-		/*
-			f, err := strconv.ParseFloat(val, 64)
-			if err == nil {
-				return f, nil
-			}
-		*/
+		// Like Excel, text that looks like a number takes part in arithmetic
+		if f, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+			return f, nil
+		}
 		return 0, fmt.Errorf("cannot convert string '%s' to number", val)
 	default:
 		return 0, fmt.Errorf("cannot convert type %T to number", val)
@@ -133,8 +186,8 @@ func funcMax(args []interface{}) (interface{}, error) {
 }
 
 func funcIf(args []interface{}) (interface{}, error) {
-	if len(args) < 2 || len(args) > 3 {
-		return nil, fmt.Errorf("IF requires 2 or 3 arguments")
+	if err := checkArity("IF", args, 2, 3); err != nil {
+		return nil, err
 	}
 
 	// IF logic now handled in evaluator.go (lazy eval), but we keep this for legacy or direct calls
@@ -153,8 +206,8 @@ func funcIf(args []interface{}) (interface{}, error) {
 }
 
 func funcVLookup(args []interface{}) (interface{}, error) {
-	if len(args) < 3 || len(args) > 4 {
-		return nil, fmt.Errorf("VLOOKUP requires 3 or 4 arguments")
+	if err := checkArity("VLOOKUP", args, 3, 4); err != nil {
+		return nil, err
 	}
 
 	lookupValue := args[0]
@@ -187,10 +240,10 @@ func funcVLookup(args []interface{}) (interface{}, error) {
 
 	colIndex, err := toFloat64(colIndexArg)
 	if err != nil {
-		return nil, fmt.Errorf("col_index_num must be a number")
+		return nil, newFormulaError(ErrValue, "VLOOKUP: col_index_num must be a number")
 	}
 	if colIndex < 1 {
-		return nil, fmt.Errorf("col_index_num must be >= 1")
+		return nil, newFormulaError(ErrValue, "VLOOKUP: col_index_num must be >= 1")
 	}
 
 	// Resolve Table Array
@@ -212,7 +265,7 @@ func funcVLookup(args []interface{}) (interface{}, error) {
 			}
 		}
 	default:
-		return nil, fmt.Errorf("table_array must be a range or array")
+		return nil, newFormulaError(ErrValue, "VLOOKUP: table_array must be a range or array")
 	}
 
 	targetCol := int(colIndex) - 1
@@ -237,13 +290,13 @@ func funcVLookup(args []interface{}) (interface{}, error) {
 
 		if match {
 			if targetCol >= len(row) {
-				return nil, fmt.Errorf("col_index_num out of bounds")
+				return nil, newFormulaError(ErrRef, "col_index_num out of bounds")
 			}
 			return row[targetCol], nil
 		}
 	}
 
-	return nil, fmt.Errorf("N/A") // VLOOKUP returns N/A if not found
+	return nil, newFormulaError(ErrNA, "VLOOKUP: value not found")
 }
 
 func areEqual(a, b interface{}) bool {
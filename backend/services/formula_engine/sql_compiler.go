@@ -0,0 +1,642 @@
+package formula_engine
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNotTranslatable is returned (wrapped) when a formula uses a construct
+// that has no SQL equivalent, so callers can fall back to in-memory evaluation
+var ErrNotTranslatable = errors.New("formula is not translatable to SQL")
+
+// SQLCompileOptions controls how a formula is compiled to a SQL expression
+type SQLCompileOptions struct {
+	// Dialect is a connection type such as "postgres", "mysql" or "sqlserver"
+	Dialect string
+	// ResolveField maps a field reference to a SQL expression. When nil,
+	// references are quoted as plain column names.
+	ResolveField func(name string) (string, error)
+	// Window partitions and orders table calculations, which compile to
+	// window functions (OVER clauses)
+	Window WindowSpec
+}
+
+// CompileSQL compiles a formula to a SQL expression for the given dialect.
+// Errors wrapping ErrNotTranslatable mean the formula is valid but must be
+// evaluated in memory.
+func (e *FormulaEngine) CompileSQL(formula string, opts SQLCompileOptions) (string, error) {
+	node, err := e.ParseFormula(formula)
+	if err != nil {
+		return "", err
+	}
+	return e.CompileNodeSQL(node, opts)
+}
+
+// CompileNodeSQL compiles a parsed formula to a SQL value expression
+func (e *FormulaEngine) CompileNodeSQL(node FormulaNode, opts SQLCompileOptions) (string, error) {
+	c := &sqlCompiler{dialect: normalizeDialect(opts.Dialect), resolve: opts.ResolveField, window: opts.Window, udfs: e.userFunctions}
+	if c.resolve == nil {
+		c.resolve = func(name string) (string, error) {
+			return c.quoteIdent(name), nil
+		}
+	}
+	return c.value(node)
+}
+
+// normalizeDialect maps connection types onto the dialects the compiler knows;
+// unknown types compile as PostgreSQL
+func normalizeDialect(dialect string) string {
+	switch strings.ToLower(dialect) {
+	case "mysql", "mariadb":
+		return "mysql"
+	case "sqlserver", "mssql":
+		return "sqlserver"
+	case "oracle":
+		return "oracle"
+	case "snowflake":
+		return "snowflake"
+	case "bigquery":
+		return "bigquery"
+	case "sqlite", "sqlite_memory", "duckdb":
+		return "sqlite"
+	default:
+		return "postgres"
+	}
+}
+
+func notTranslatable(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrNotTranslatable, fmt.Sprintf(format, args...))
+}
+
+// sqlExpr is a compiled expression; predicate marks boolean conditions, which
+// SQL Server and Oracle cannot use as values
+type sqlExpr struct {
+	sql       string
+	predicate bool
+}
+
+type sqlCompiler struct {
+	dialect  string
+	resolve  func(name string) (string, error)
+	window   WindowSpec
+	udfs     map[string]*userFunction
+	inlining []string // user-defined functions being inlined, outermost first
+}
+
+var unsafeIdentChars = regexp.MustCompile(`[^a-zA-Z0-9_ ]`)
+
+func (c *sqlCompiler) quoteIdent(name string) string {
+	name = unsafeIdentChars.ReplaceAllString(name, "")
+	switch c.dialect {
+	case "mysql", "bigquery":
+		return "`" + name + "`"
+	case "sqlserver":
+		return "[" + name + "]"
+	default:
+		return `"` + name + `"`
+	}
+}
+
+func (c *sqlCompiler) quoteString(s string) string {
+	s = strings.ReplaceAll(s, "'", "''")
+	if c.dialect == "mysql" {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
+
+// hasBooleans reports whether predicates can be selected as values
+func (c *sqlCompiler) hasBooleans() bool {
+	return c.dialect != "sqlserver" && c.dialect != "oracle"
+}
+
+// value compiles a node for use as a value (select list, function argument)
+func (c *sqlCompiler) value(node FormulaNode) (string, error) {
+	expr, err := c.compile(node)
+	if err != nil {
+		return "", err
+	}
+	if expr.predicate && !c.hasBooleans() {
+		return fmt.Sprintf("CASE WHEN %s THEN 1 ELSE 0 END", expr.sql), nil
+	}
+	return expr.sql, nil
+}
+
+// condition compiles a node for use as a condition (IF, AND, NOT)
+func (c *sqlCompiler) condition(node FormulaNode) (string, error) {
+	expr, err := c.compile(node)
+	if err != nil {
+		return "", err
+	}
+	if !expr.predicate && !c.hasBooleans() {
+		return fmt.Sprintf("(%s <> 0)", expr.sql), nil
+	}
+	return expr.sql, nil
+}
+
+func (c *sqlCompiler) values(nodes []FormulaNode) ([]string, error) {
+	out := make([]string, len(nodes))
+	for i, node := range nodes {
+		v, err := c.value(node)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (c *sqlCompiler) compile(node FormulaNode) (sqlExpr, error) {
+	switch n := node.(type) {
+	case *NumberNode:
+		return sqlExpr{sql: strconv.FormatFloat(n.Value, 'f', -1, 64)}, nil
+	case *StringNode:
+		return sqlExpr{sql: c.quoteString(n.Value)}, nil
+	case *BoolNode:
+		if !c.hasBooleans() {
+			if n.Value {
+				return sqlExpr{sql: "(1 = 1)", predicate: true}, nil
+			}
+			return sqlExpr{sql: "(1 = 0)", predicate: true}, nil
+		}
+		if n.Value {
+			return sqlExpr{sql: "TRUE"}, nil
+		}
+		return sqlExpr{sql: "FALSE"}, nil
+	case *CellRefNode:
+		if n.RangeEnd != "" {
+			return sqlExpr{}, notTranslatable("range %s:%s", n.Ref, n.RangeEnd)
+		}
+		ref, err := c.resolve(n.Ref)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: ref}, nil
+	case *UnaryNode:
+		operand, err := c.value(n.Operand)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		if n.Op == TokMinus {
+			return sqlExpr{sql: fmt.Sprintf("(-%s)", operand)}, nil
+		}
+		return sqlExpr{sql: operand}, nil
+	case *BinaryNode:
+		return c.binary(n)
+	case *FuncCallNode:
+		return c.call(n)
+	default:
+		return sqlExpr{}, notTranslatable("node type %T", node)
+	}
+}
+
+func (c *sqlCompiler) binary(n *BinaryNode) (sqlExpr, error) {
+	left, err := c.value(n.Left)
+	if err != nil {
+		return sqlExpr{}, err
+	}
+	right, err := c.value(n.Right)
+	if err != nil {
+		return sqlExpr{}, err
+	}
+
+	switch n.Op {
+	case TokPlus, TokMinus, TokStar:
+		return sqlExpr{sql: fmt.Sprintf("(%s %s %s)", left, n.Op.String(), right)}, nil
+	case TokSlash:
+		// Force decimal division and turn a zero divisor into NULL instead of a query error
+		return sqlExpr{sql: fmt.Sprintf("(%s * 1.0 / NULLIF(%s, 0))", left, right)}, nil
+	case TokPercent:
+		if c.dialect == "sqlserver" || c.dialect == "sqlite" {
+			return sqlExpr{sql: fmt.Sprintf("(%s %% NULLIF(%s, 0))", left, right)}, nil
+		}
+		return sqlExpr{sql: fmt.Sprintf("MOD(%s, NULLIF(%s, 0))", left, right)}, nil
+	case TokCaret:
+		return sqlExpr{sql: fmt.Sprintf("POWER(%s, %s)", left, right)}, nil
+	case TokAmpersand:
+		return sqlExpr{sql: c.concat([]string{left, right})}, nil
+	case TokEq, TokLt, TokGt, TokLte, TokGte, TokNeq:
+		return sqlExpr{sql: fmt.Sprintf("(%s %s %s)", left, n.Op.String(), right), predicate: true}, nil
+	default:
+		return sqlExpr{}, notTranslatable("operator %s", n.Op.String())
+	}
+}
+
+func (c *sqlCompiler) concat(parts []string) string {
+	switch c.dialect {
+	case "mysql", "sqlserver", "bigquery":
+		return "CONCAT(" + strings.Join(parts, ", ") + ")"
+	default:
+		return "(" + strings.Join(parts, " || ") + ")"
+	}
+}
+
+func (c *sqlCompiler) fn(name string, args []FormulaNode) (sqlExpr, error) {
+	vals, err := c.values(args)
+	if err != nil {
+		return sqlExpr{}, err
+	}
+	return sqlExpr{sql: fmt.Sprintf("%s(%s)", name, strings.Join(vals, ", "))}, nil
+}
+
+// sqlFunctions lists the functions the compiler can translate; the others
+// (lookups, conditional aggregates, text formatting, date arithmetic) are
+// evaluated in memory
+var sqlFunctions = map[string]bool{
+	"IF": true, "IFS": true, "SWITCH": true, "IFERROR": true,
+	"AND": true, "OR": true, "NOT": true, "ISBLANK": true,
+	"SUM": true, "MIN": true, "MAX": true, "AVG": true,
+	"ROUND": true, "ABS": true, "SQRT": true, "POWER": true, "MOD": true,
+	"LOG": true, "CEILING": true, "FLOOR": true,
+	"UPPER": true, "LOWER": true, "TRIM": true, "LEN": true, "LEFT": true,
+	"RIGHT": true, "MID": true, "CONCAT": true, "SUBSTITUTE": true, "FIND": true,
+	"YEAR": true, "MONTH": true, "DAY": true, "TODAY": true, "NOW": true,
+	"RUNNING_SUM": true, "RUNNING_AVG": true, "RUNNING_COUNT": true,
+	"WINDOW_SUM": true, "WINDOW_AVG": true, "WINDOW_MIN": true, "WINDOW_MAX": true,
+	"WINDOW_COUNT": true, "RANK": true, "PERCENT_OF_TOTAL": true,
+	"LOOKUP": true, "FIRST": true, "LAST": true,
+}
+
+// SQLTranslatable reports whether a function can be compiled to SQL
+func SQLTranslatable(name string) bool {
+	return sqlFunctions[strings.ToUpper(name)]
+}
+
+func sqlArity(name string, args []FormulaNode, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return notTranslatable("%s: wrong number of arguments", name)
+	}
+	return nil
+}
+
+func (c *sqlCompiler) call(n *FuncCallNode) (sqlExpr, error) {
+	if windowFunctions[n.Name] {
+		return c.windowCall(n)
+	}
+	if uf, ok := c.udfs[n.Name]; ok {
+		return c.userCall(uf, n)
+	}
+
+	args := n.Args
+	switch n.Name {
+	case "IF":
+		if err := sqlArity("IF", args, 2, 3); err != nil {
+			return sqlExpr{}, err
+		}
+		return c.caseWhen(args, len(args) == 3)
+	case "IFS":
+		if err := sqlArity("IFS", args, 2, -1); err != nil {
+			return sqlExpr{}, err
+		}
+		if len(args)%2 != 0 {
+			return sqlExpr{}, notTranslatable("IFS: wrong number of arguments")
+		}
+		return c.caseWhen(args, false)
+	case "SWITCH":
+		if err := sqlArity("SWITCH", args, 3, -1); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "CASE %s", vals[0])
+		cases := vals[1:]
+		for i := 0; i+1 < len(cases); i += 2 {
+			fmt.Fprintf(&b, " WHEN %s THEN %s", cases[i], cases[i+1])
+		}
+		if len(cases)%2 == 1 {
+			fmt.Fprintf(&b, " ELSE %s", cases[len(cases)-1])
+		}
+		b.WriteString(" END")
+		return sqlExpr{sql: b.String()}, nil
+	case "IFERROR":
+		// Errors such as division by zero compile to NULL, so COALESCE is the SQL analogue
+		if err := sqlArity("IFERROR", args, 2, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		return c.fn("COALESCE", args)
+	case "AND", "OR":
+		if err := sqlArity(n.Name, args, 1, -1); err != nil {
+			return sqlExpr{}, err
+		}
+		conds := make([]string, len(args))
+		for i, arg := range args {
+			cond, err := c.condition(arg)
+			if err != nil {
+				return sqlExpr{}, err
+			}
+			conds[i] = cond
+		}
+		return sqlExpr{sql: "(" + strings.Join(conds, " "+n.Name+" ") + ")", predicate: true}, nil
+	case "NOT":
+		if err := sqlArity("NOT", args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		cond, err := c.condition(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("(NOT %s)", cond), predicate: true}, nil
+	case "ISBLANK":
+		if err := sqlArity("ISBLANK", args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("(%s IS NULL)", v), predicate: true}, nil
+
+	case "SUM":
+		// Row-level SUM adds its arguments and skips blanks, like the evaluator
+		if err := sqlArity("SUM", args, 1, -1); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		for i, v := range vals {
+			vals[i] = fmt.Sprintf("COALESCE(%s, 0)", v)
+		}
+		return sqlExpr{sql: "(" + strings.Join(vals, " + ") + ")"}, nil
+	case "MIN", "MAX":
+		if err := sqlArity(n.Name, args, 1, -1); err != nil {
+			return sqlExpr{}, err
+		}
+		if len(args) == 1 {
+			return c.compile(args[0])
+		}
+		switch c.dialect {
+		case "sqlite":
+			return c.fn(n.Name, args)
+		case "sqlserver":
+			return sqlExpr{}, notTranslatable("%s with several arguments on %s", n.Name, c.dialect)
+		}
+		if n.Name == "MIN" {
+			return c.fn("LEAST", args)
+		}
+		return c.fn("GREATEST", args)
+	case "AVG":
+		if len(args) != 1 {
+			return sqlExpr{}, notTranslatable("AVG with several arguments")
+		}
+		return c.compile(args[0])
+
+	case "ROUND":
+		if err := sqlArity("ROUND", args, 1, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		digits := "0"
+		if len(vals) == 2 {
+			digits = vals[1]
+		}
+		if c.dialect == "postgres" {
+			// PostgreSQL only rounds to a scale for NUMERIC, which also rounds half away from zero
+			return sqlExpr{sql: fmt.Sprintf("ROUND(CAST(%s AS NUMERIC), CAST(%s AS INTEGER))", vals[0], digits)}, nil
+		}
+		return sqlExpr{sql: fmt.Sprintf("ROUND(%s, %s)", vals[0], digits)}, nil
+	case "ABS", "SQRT":
+		if err := sqlArity(n.Name, args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		return c.fn(n.Name, args)
+	case "POWER":
+		if err := sqlArity("POWER", args, 2, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		return c.fn("POWER", args)
+	case "MOD":
+		// Excel's MOD takes the sign of the divisor, SQL's takes the sign of the dividend
+		if err := sqlArity("MOD", args, 2, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("(%s - %s * FLOOR(%s * 1.0 / NULLIF(%s, 0)))", vals[0], vals[1], vals[0], vals[1])}, nil
+	case "LOG":
+		if err := sqlArity("LOG", args, 1, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		if len(vals) == 2 {
+			ln := "LN"
+			if c.dialect == "sqlserver" {
+				ln = "LOG"
+			}
+			return sqlExpr{sql: fmt.Sprintf("(%s(%s) / NULLIF(%s(%s), 0))", ln, vals[0], ln, vals[1])}, nil
+		}
+		switch c.dialect {
+		case "postgres":
+			return sqlExpr{sql: fmt.Sprintf("LOG(%s)", vals[0])}, nil
+		case "oracle", "snowflake":
+			return sqlExpr{sql: fmt.Sprintf("LOG(10, %s)", vals[0])}, nil
+		default:
+			return sqlExpr{sql: fmt.Sprintf("LOG10(%s)", vals[0])}, nil
+		}
+	case "CEILING", "FLOOR":
+		if err := sqlArity(n.Name, args, 1, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		name := n.Name
+		if name == "CEILING" && c.dialect == "oracle" {
+			name = "CEIL"
+		}
+		if len(vals) == 1 {
+			return sqlExpr{sql: fmt.Sprintf("%s(%s)", name, vals[0])}, nil
+		}
+		return sqlExpr{sql: fmt.Sprintf("(%s(%s * 1.0 / NULLIF(%s, 0)) * %s)", name, vals[0], vals[1], vals[1])}, nil
+
+	case "UPPER", "LOWER":
+		if err := sqlArity(n.Name, args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		return c.fn(n.Name, args)
+	case "TRIM":
+		if err := sqlArity("TRIM", args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		if c.dialect == "sqlserver" {
+			v, err := c.value(args[0])
+			if err != nil {
+				return sqlExpr{}, err
+			}
+			return sqlExpr{sql: fmt.Sprintf("LTRIM(RTRIM(%s))", v)}, nil
+		}
+		return c.fn("TRIM", args)
+	case "LEN":
+		if err := sqlArity("LEN", args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		switch c.dialect {
+		case "mysql":
+			return c.fn("CHAR_LENGTH", args)
+		case "sqlserver":
+			return c.fn("LEN", args)
+		default:
+			return c.fn("LENGTH", args)
+		}
+	case "LEFT", "RIGHT":
+		if err := sqlArity(n.Name, args, 1, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		count := "1"
+		if len(vals) == 2 {
+			count = vals[1]
+		}
+		if c.dialect == "sqlite" || c.dialect == "oracle" {
+			if n.Name == "LEFT" {
+				return sqlExpr{sql: fmt.Sprintf("SUBSTR(%s, 1, %s)", vals[0], count)}, nil
+			}
+			return sqlExpr{sql: fmt.Sprintf("SUBSTR(%s, -(%s))", vals[0], count)}, nil
+		}
+		return sqlExpr{sql: fmt.Sprintf("%s(%s, %s)", n.Name, vals[0], count)}, nil
+	case "MID":
+		if err := sqlArity("MID", args, 3, 3); err != nil {
+			return sqlExpr{}, err
+		}
+		switch c.dialect {
+		case "sqlite", "oracle", "bigquery":
+			return c.fn("SUBSTR", args)
+		default:
+			return c.fn("SUBSTRING", args)
+		}
+	case "CONCAT":
+		if err := sqlArity("CONCAT", args, 1, -1); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: c.concat(vals)}, nil
+	case "SUBSTITUTE":
+		if len(args) == 4 {
+			return sqlExpr{}, notTranslatable("SUBSTITUTE with an instance number")
+		}
+		if err := sqlArity("SUBSTITUTE", args, 3, 3); err != nil {
+			return sqlExpr{}, err
+		}
+		return c.fn("REPLACE", args)
+	case "FIND":
+		// A missing substring is #VALUE! in the evaluator and NULL in SQL
+		if len(args) == 3 {
+			return sqlExpr{}, notTranslatable("FIND with a start position")
+		}
+		if err := sqlArity("FIND", args, 2, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		vals, err := c.values(args)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		find, within := vals[0], vals[1]
+		var pos string
+		switch c.dialect {
+		case "mysql":
+			pos = fmt.Sprintf("LOCATE(%s, %s)", find, within)
+		case "sqlserver", "snowflake":
+			pos = fmt.Sprintf("CHARINDEX(%s, %s)", find, within)
+		case "sqlite", "oracle":
+			pos = fmt.Sprintf("INSTR(%s, %s)", within, find)
+		default:
+			pos = fmt.Sprintf("STRPOS(%s, %s)", within, find)
+		}
+		return sqlExpr{sql: fmt.Sprintf("NULLIF(%s, 0)", pos)}, nil
+
+	case "YEAR", "MONTH", "DAY":
+		if err := sqlArity(n.Name, args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		switch c.dialect {
+		case "sqlserver":
+			return sqlExpr{sql: fmt.Sprintf("%s(%s)", n.Name, v)}, nil
+		case "sqlite":
+			format := map[string]string{"YEAR": "%Y", "MONTH": "%m", "DAY": "%d"}[n.Name]
+			return sqlExpr{sql: fmt.Sprintf("CAST(STRFTIME('%s', %s) AS INTEGER)", format, v)}, nil
+		default:
+			return sqlExpr{sql: fmt.Sprintf("EXTRACT(%s FROM %s)", n.Name, v)}, nil
+		}
+	case "TODAY":
+		if err := sqlArity("TODAY", args, 0, 0); err != nil {
+			return sqlExpr{}, err
+		}
+		switch c.dialect {
+		case "sqlserver":
+			return sqlExpr{sql: "CAST(GETDATE() AS DATE)"}, nil
+		case "oracle":
+			return sqlExpr{sql: "TRUNC(SYSDATE)"}, nil
+		case "sqlite":
+			return sqlExpr{sql: "DATE('now')"}, nil
+		default:
+			return sqlExpr{sql: "CURRENT_DATE"}, nil
+		}
+	case "NOW":
+		if err := sqlArity("NOW", args, 0, 0); err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: "CURRENT_TIMESTAMP"}, nil
+	}
+
+	if _, ok := GetFunction(n.Name); !ok {
+		return sqlExpr{}, newFormulaError(ErrName, "unknown function: %s", n.Name)
+	}
+	return sqlExpr{}, notTranslatable("function %s", n.Name)
+}
+
+// caseWhen compiles IF/IFS style condition/value pairs; withElse treats the
+// trailing argument as the ELSE branch
+func (c *sqlCompiler) caseWhen(args []FormulaNode, withElse bool) (sqlExpr, error) {
+	pairs := args
+	if withElse {
+		pairs = args[:len(args)-1]
+	}
+	var b strings.Builder
+	b.WriteString("CASE")
+	for i := 0; i+1 < len(pairs); i += 2 {
+		cond, err := c.condition(pairs[i])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		val, err := c.value(pairs[i+1])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		fmt.Fprintf(&b, " WHEN %s THEN %s", cond, val)
+	}
+	if withElse {
+		val, err := c.value(args[len(args)-1])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		fmt.Fprintf(&b, " ELSE %s", val)
+	}
+	b.WriteString(" END")
+	return sqlExpr{sql: b.String()}, nil
+}
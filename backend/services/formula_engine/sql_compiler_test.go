@@ -0,0 +1,144 @@
+package formula_engine
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompileSQL(t *testing.T) {
+	engine := NewFormulaEngine()
+
+	tests := []struct {
+		name    string
+		formula string
+		dialect string
+		want    string
+	}{
+		{"Arithmetic", "[Sales] - [Cost] * 2", "postgres", `("Sales" - ("Cost" * 2))`},
+		{"Division guards zero", "[Sales] / [Units]", "postgres", `("Sales" * 1.0 / NULLIF("Units", 0))`},
+		{"Power", "[x] ^ 2", "postgres", `POWER("x", 2)`},
+		{"Concat postgres", `[First] & " " & [Last]`, "postgres", `(("First" || ' ') || "Last")`},
+		{"Concat mysql", `[First] & [Last]`, "mysql", "CONCAT(`First`, `Last`)"},
+		{"String escaping", `"O'Brien"`, "postgres", `'O''Brien'`},
+		{"IF to CASE", `IF([Sales] > 100, "High", "Low")`, "postgres", `CASE WHEN ("Sales" > 100) THEN 'High' ELSE 'Low' END`},
+		{"IF without else", `IF([Sales] > 100, 1)`, "postgres", `CASE WHEN ("Sales" > 100) THEN 1 END`},
+		{"Predicate as value on SQL Server", "[a] > [b]", "sqlserver", "CASE WHEN ([a] > [b]) THEN 1 ELSE 0 END"},
+		{"Value as condition on SQL Server", "IF([flag], 1, 0)", "sqlserver", "CASE WHEN ([flag] <> 0) THEN 1 ELSE 0 END"},
+		{"AND/NOT", "AND([a] > 1, NOT([b] = 2))", "postgres", `(("a" > 1) AND (NOT ("b" = 2)))`},
+		{"SWITCH", `SWITCH([r], "N", 1, "S", 2, 0)`, "postgres", `CASE "r" WHEN 'N' THEN 1 WHEN 'S' THEN 2 ELSE 0 END`},
+		{"IFERROR", "IFERROR([a] / [b], 0)", "postgres", `COALESCE(("a" * 1.0 / NULLIF("b", 0)), 0)`},
+		{"ROUND postgres", "ROUND([x], 2)", "postgres", `ROUND(CAST("x" AS NUMERIC), CAST(2 AS INTEGER))`},
+		{"ROUND mysql", "ROUND([x])", "mysql", "ROUND(`x`, 0)"},
+		{"Row SUM skips blanks", "SUM([a], [b])", "postgres", `(COALESCE("a", 0) + COALESCE("b", 0))`},
+		{"MAX of several", "MAX([a], [b])", "postgres", `GREATEST("a", "b")`},
+		{"LEN mysql", "LEN([name])", "mysql", "CHAR_LENGTH(`name`)"},
+		{"LEFT sqlite", "LEFT([name], 3)", "sqlite", `SUBSTR("name", 1, 3)`},
+		{"FIND sqlserver", `FIND("a", [name])`, "sqlserver", "NULLIF(CHARINDEX('a', [name]), 0)"},
+		{"YEAR postgres", "YEAR([d])", "postgres", `EXTRACT(YEAR FROM "d")`},
+		{"YEAR sqlserver", "YEAR([d])", "sqlserver", "YEAR([d])"},
+		{"TODAY sqlserver", "TODAY()", "sqlserver", "CAST(GETDATE() AS DATE)"},
+		{"Unary minus", "-[x]", "postgres", `(-"x")`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engine.CompileSQL(tt.formula, SQLCompileOptions{Dialect: tt.dialect})
+			if err != nil {
+				t.Fatalf("CompileSQL(%q) error = %v", tt.formula, err)
+			}
+			if got != tt.want {
+				t.Errorf("CompileSQL(%q) = %s, want %s", tt.formula, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSQL_NotTranslatable(t *testing.T) {
+	engine := NewFormulaEngine()
+
+	tests := []struct {
+		formula string
+		dialect string
+	}{
+		{`VLOOKUP([id], A1:B10, 2)`, "postgres"},
+		{`TEXT([d], "yyyy-mm-dd")`, "postgres"},
+		{`COUNTIF(A1:A5, ">1")`, "postgres"},
+		{`SUBSTITUTE([s], "a", "b", 2)`, "postgres"},
+		{`MAX([a], [b])`, "sqlserver"},
+	}
+
+	for _, tt := range tests {
+		_, err := engine.CompileSQL(tt.formula, SQLCompileOptions{Dialect: tt.dialect})
+		if !errors.Is(err, ErrNotTranslatable) {
+			t.Errorf("CompileSQL(%q, %s) error = %v, want ErrNotTranslatable", tt.formula, tt.dialect, err)
+		}
+	}
+}
+
+func TestCompileSQL_UnknownFunction(t *testing.T) {
+	_, err := NewFormulaEngine().CompileSQL("NOPE([a])", SQLCompileOptions{})
+	if code, ok := ErrorCodeOf(err); !ok || code != ErrName {
+		t.Errorf("CompileSQL() error = %v, want #NAME?", err)
+	}
+}
+
+func TestCompileSQL_ResolveField(t *testing.T) {
+	got, err := NewFormulaEngine().CompileSQL("[Revenue] * 2", SQLCompileOptions{
+		ResolveField: func(name string) (string, error) {
+			return "SUM(orders.amount)", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("CompileSQL() error = %v", err)
+	}
+	if want := "(SUM(orders.amount) * 2)"; got != want {
+		t.Errorf("CompileSQL() = %s, want %s", got, want)
+	}
+}
+
+func TestCompileSQL_Window(t *testing.T) {
+	engine := NewFormulaEngine()
+	spec := WindowSpec{PartitionBy: []string{"Region"}, OrderBy: []WindowOrder{{Field: "Month"}}}
+	over := `PARTITION BY "Region" ORDER BY "Month"`
+
+	tests := []struct {
+		name    string
+		formula string
+		want    string
+	}{
+		{"Running sum", "RUNNING_SUM([Sales])", `SUM("Sales") OVER (` + over + ` ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)`},
+		{"Window total", "WINDOW_SUM([Sales])", `SUM("Sales") OVER (PARTITION BY "Region")`},
+		{"Moving average", "WINDOW_AVG([Sales], -2, 0)", `AVG("Sales") OVER (` + over + ` ROWS BETWEEN 2 PRECEDING AND CURRENT ROW)`},
+		{"Window to end", "WINDOW_MAX([Sales], 0, LAST())", `MAX("Sales") OVER (` + over + ` ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING)`},
+		{"Rank", "RANK([Sales])", `CASE WHEN "Sales" IS NULL THEN NULL ELSE RANK() OVER (PARTITION BY "Region" ORDER BY CASE WHEN "Sales" IS NULL THEN 1 ELSE 0 END, "Sales" DESC) END`},
+		{"Percent of total", "PERCENT_OF_TOTAL([Sales])", `("Sales" * 1.0 / NULLIF(SUM("Sales") OVER (PARTITION BY "Region"), 0))`},
+		{"Previous row", "LOOKUP([Sales], -1)", `LAG("Sales", 1) OVER (` + over + `)`},
+		{"Next row", "LOOKUP([Sales], 2)", `LEAD("Sales", 2) OVER (` + over + `)`},
+		{"Lookup first", "LOOKUP([Sales], FIRST())", `FIRST_VALUE("Sales") OVER (` + over + ` ` + fullFrame + `)`},
+		{"First offset", "FIRST()", `(1 - ROW_NUMBER() OVER (` + over + `))`},
+		{"Last offset", "LAST()", `(COUNT(*) OVER (PARTITION BY "Region") - ROW_NUMBER() OVER (` + over + `))`},
+		{"Combined with row math", "[Sales] - LOOKUP([Sales], -1)", `("Sales" - LAG("Sales", 1) OVER (` + over + `))`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := engine.CompileSQL(tt.formula, SQLCompileOptions{Dialect: "postgres", Window: spec})
+			if err != nil {
+				t.Fatalf("CompileSQL(%q) error = %v", tt.formula, err)
+			}
+			if got != tt.want {
+				t.Errorf("CompileSQL(%q) =\n  %s\nwant\n  %s", tt.formula, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileSQL_WindowNeedsOrder(t *testing.T) {
+	engine := NewFormulaEngine()
+	for _, formula := range []string{"RUNNING_SUM([Sales])", "LOOKUP([Sales], -1)", "WINDOW_SUM([Sales], [n], 0)"} {
+		_, err := engine.CompileSQL(formula, SQLCompileOptions{Dialect: "postgres"})
+		if !errors.Is(err, ErrNotTranslatable) {
+			t.Errorf("CompileSQL(%q) error = %v, want ErrNotTranslatable", formula, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package formula_engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+const fullFrame = "ROWS BETWEEN UNBOUNDED PRECEDING AND UNBOUNDED FOLLOWING"
+
+// overClause builds the OVER clause of a table calculation from the window
+// spec. Functions that depend on row order cannot be translated without one,
+// since SQL would otherwise pick an arbitrary order.
+func (c *sqlCompiler) overClause(name string, ordered bool, frame string) (string, error) {
+	var parts []string
+	if len(c.window.PartitionBy) > 0 {
+		cols := make([]string, len(c.window.PartitionBy))
+		for i, field := range c.window.PartitionBy {
+			col, err := c.resolve(field)
+			if err != nil {
+				return "", err
+			}
+			cols[i] = col
+		}
+		parts = append(parts, "PARTITION BY "+strings.Join(cols, ", "))
+	}
+	if ordered {
+		if len(c.window.OrderBy) == 0 {
+			return "", notTranslatable("%s needs an ordering", name)
+		}
+		cols := make([]string, len(c.window.OrderBy))
+		for i, order := range c.window.OrderBy {
+			col, err := c.resolve(order.Field)
+			if err != nil {
+				return "", err
+			}
+			if order.Desc {
+				col += " DESC"
+			}
+			cols[i] = col
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(cols, ", "))
+		if frame != "" {
+			parts = append(parts, frame)
+		}
+	}
+	return "OVER (" + strings.Join(parts, " ") + ")", nil
+}
+
+// literalOffset reads a constant row offset such as 2 or -1
+func literalOffset(node FormulaNode) (int, bool) {
+	switch n := node.(type) {
+	case *NumberNode:
+		return int(n.Value), n.Value == float64(int(n.Value))
+	case *UnaryNode:
+		k, ok := literalOffset(n.Operand)
+		if n.Op == TokMinus {
+			k = -k
+		}
+		return k, ok
+	}
+	return 0, false
+}
+
+// frameBound translates a WINDOW_ bound: a constant offset, FIRST() or LAST()
+func frameBound(node FormulaNode) (string, bool) {
+	if call, ok := node.(*FuncCallNode); ok && len(call.Args) == 0 {
+		switch call.Name {
+		case "FIRST":
+			return "UNBOUNDED PRECEDING", true
+		case "LAST":
+			return "UNBOUNDED FOLLOWING", true
+		}
+	}
+	k, ok := literalOffset(node)
+	switch {
+	case !ok:
+		return "", false
+	case k < 0:
+		return fmt.Sprintf("%d PRECEDING", -k), true
+	case k > 0:
+		return fmt.Sprintf("%d FOLLOWING", k), true
+	}
+	return "CURRENT ROW", true
+}
+
+func (c *sqlCompiler) windowCall(n *FuncCallNode) (sqlExpr, error) {
+	args := n.Args
+	switch n.Name {
+	case "RUNNING_SUM", "RUNNING_AVG", "RUNNING_COUNT":
+		if err := sqlArity(n.Name, args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		over, err := c.overClause(n.Name, true, "ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW")
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("%s(%s) %s", strings.TrimPrefix(n.Name, "RUNNING_"), v, over)}, nil
+
+	case "WINDOW_SUM", "WINDOW_AVG", "WINDOW_MIN", "WINDOW_MAX", "WINDOW_COUNT":
+		if len(args) != 1 && len(args) != 3 {
+			return sqlExpr{}, notTranslatable("%s: wrong number of arguments", n.Name)
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		agg := strings.TrimPrefix(n.Name, "WINDOW_")
+		if len(args) == 1 {
+			over, err := c.overClause(n.Name, false, "")
+			if err != nil {
+				return sqlExpr{}, err
+			}
+			return sqlExpr{sql: fmt.Sprintf("%s(%s) %s", agg, v, over)}, nil
+		}
+		start, okStart := frameBound(args[1])
+		end, okEnd := frameBound(args[2])
+		if !okStart || !okEnd {
+			return sqlExpr{}, notTranslatable("%s bounds must be constant offsets, FIRST() or LAST()", n.Name)
+		}
+		over, err := c.overClause(n.Name, true, fmt.Sprintf("ROWS BETWEEN %s AND %s", start, end))
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("%s(%s) %s", agg, v, over)}, nil
+
+	case "RANK":
+		if err := sqlArity("RANK", args, 1, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		direction := "DESC"
+		if len(args) == 2 {
+			order, ok := args[1].(*StringNode)
+			if !ok || (!strings.EqualFold(order.Value, "asc") && !strings.EqualFold(order.Value, "desc")) {
+				return sqlExpr{}, notTranslatable("RANK order must be \"asc\" or \"desc\"")
+			}
+			direction = strings.ToUpper(order.Value)
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		// Rank on the expression itself; blanks get no rank, like the evaluator
+		over, err := c.overClause("RANK", false, "")
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		orderBy := fmt.Sprintf("ORDER BY CASE WHEN %s IS NULL THEN 1 ELSE 0 END, %s %s", v, v, direction)
+		over = strings.TrimSuffix(over, ")")
+		if over != "OVER (" {
+			over += " "
+		}
+		return sqlExpr{sql: fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE RANK() %s%s) END", v, over, orderBy)}, nil
+
+	case "PERCENT_OF_TOTAL":
+		if err := sqlArity("PERCENT_OF_TOTAL", args, 1, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		over, err := c.overClause("PERCENT_OF_TOTAL", false, "")
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("(%s * 1.0 / NULLIF(SUM(%s) %s, 0))", v, v, over)}, nil
+
+	case "LOOKUP":
+		if err := sqlArity("LOOKUP", args, 2, 2); err != nil {
+			return sqlExpr{}, err
+		}
+		if call, ok := args[1].(*FuncCallNode); ok && len(call.Args) == 0 && (call.Name == "FIRST" || call.Name == "LAST") {
+			return c.windowCall(&FuncCallNode{Name: call.Name, Args: args[:1], Pos: n.Pos})
+		}
+		k, ok := literalOffset(args[1])
+		if !ok {
+			return sqlExpr{}, notTranslatable("LOOKUP offset must be a constant, FIRST() or LAST()")
+		}
+		v, err := c.value(args[0])
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		if k == 0 {
+			return sqlExpr{sql: v}, nil
+		}
+		over, err := c.overClause("LOOKUP", true, "")
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		if k < 0 {
+			return sqlExpr{sql: fmt.Sprintf("LAG(%s, %d) %s", v, -k, over)}, nil
+		}
+		return sqlExpr{sql: fmt.Sprintf("LEAD(%s, %d) %s", v, k, over)}, nil
+
+	case "FIRST", "LAST":
+		if err := sqlArity(n.Name, args, 0, 1); err != nil {
+			return sqlExpr{}, err
+		}
+		if len(args) == 1 {
+			v, err := c.value(args[0])
+			if err != nil {
+				return sqlExpr{}, err
+			}
+			over, err := c.overClause(n.Name, true, fullFrame)
+			if err != nil {
+				return sqlExpr{}, err
+			}
+			return sqlExpr{sql: fmt.Sprintf("%s_VALUE(%s) %s", n.Name, v, over)}, nil
+		}
+		rowNumber, err := c.overClause(n.Name, true, "")
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		if n.Name == "FIRST" {
+			return sqlExpr{sql: fmt.Sprintf("(1 - ROW_NUMBER() %s)", rowNumber)}, nil
+		}
+		count, err := c.overClause(n.Name, false, "")
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		return sqlExpr{sql: fmt.Sprintf("(COUNT(*) %s - ROW_NUMBER() %s)", count, rowNumber)}, nil
+	}
+	return sqlExpr{}, notTranslatable("function %s", n.Name)
+}
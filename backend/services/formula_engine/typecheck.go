@@ -0,0 +1,432 @@
+package formula_engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the static type of a formula expression or field
+type ValueType string
+
+const (
+	TypeAny    ValueType = "any"
+	TypeNumber ValueType = "number"
+	TypeText   ValueType = "text"
+	TypeBool   ValueType = "boolean"
+	TypeDate   ValueType = "date"
+	TypeRange  ValueType = "range"
+)
+
+// Type issue kinds
+const (
+	IssueUnknownField    = "unknown_field"
+	IssueUnknownFunction = "unknown_function"
+	IssueArgumentCount   = "argument_count"
+	IssueTypeMismatch    = "type_mismatch"
+	IssueDivisionByZero  = "division_by_zero"
+)
+
+// TypeIssue is a problem found by TypeCheck. Position is a byte offset into the formula.
+type TypeIssue struct {
+	Kind     string    `json:"kind"`
+	Code     ErrorCode `json:"code"` // The error value the formula would produce at runtime
+	Message  string    `json:"message"`
+	Position int       `json:"position"`
+}
+
+func (i TypeIssue) String() string {
+	return fmt.Sprintf("%s at position %d", i.Message, i.Position)
+}
+
+// TypeCheckResult is the inferred result type of a formula and the issues found
+type TypeCheckResult struct {
+	Type   ValueType   `json:"type"`
+	Issues []TypeIssue `json:"issues"`
+}
+
+// Valid reports whether the type check found no issues
+func (r *TypeCheckResult) Valid() bool {
+	return len(r.Issues) == 0
+}
+
+// TypeFromSQL maps a catalog column type (e.g. "numeric(10,2)", "varchar",
+// "timestamp with time zone") to a formula value type
+func TypeFromSQL(sqlType string) ValueType {
+	t := strings.ToLower(strings.TrimSpace(sqlType))
+	if i := strings.IndexAny(t, "(["); i >= 0 {
+		t = strings.TrimSpace(t[:i])
+	}
+	switch {
+	case t == "":
+		return TypeAny
+	case strings.Contains(t, "bool") || t == "bit":
+		return TypeBool
+	case strings.Contains(t, "date") || strings.Contains(t, "time"):
+		return TypeDate
+	case strings.Contains(t, "int") || strings.Contains(t, "serial") ||
+		strings.Contains(t, "numeric") || strings.Contains(t, "decimal") ||
+		strings.Contains(t, "float") || strings.Contains(t, "double") ||
+		t == "real" || t == "money" || t == "number":
+		return TypeNumber
+	case strings.Contains(t, "char") || strings.Contains(t, "text") ||
+		strings.Contains(t, "string") || t == "uuid" || t == "enum":
+		return TypeText
+	}
+	return TypeAny
+}
+
+// signature describes a function for the type checker. params gives the
+// expected type of each argument; for variadic functions the last one repeats.
+type signature struct {
+	min, max int // max -1 means unbounded
+	params   []ValueType
+	returns  ValueType
+}
+
+// signatures covers every function in FunctionRegistry. IF, IFS, SWITCH and
+// IFERROR return the common type of their branches and are handled separately.
+var signatures = map[string]signature{
+	"SUM": {1, -1, []ValueType{TypeNumber}, TypeNumber},
+	"AVG": {1, -1, []ValueType{TypeNumber}, TypeNumber},
+	"MIN": {1, -1, []ValueType{TypeNumber}, TypeNumber},
+	"MAX": {1, -1, []ValueType{TypeNumber}, TypeNumber},
+
+	"IF":      {2, 3, []ValueType{TypeBool, TypeAny, TypeAny}, TypeAny},
+	"IFS":     {2, -1, []ValueType{TypeAny}, TypeAny},
+	"SWITCH":  {3, -1, []ValueType{TypeAny}, TypeAny},
+	"IFERROR": {2, 2, []ValueType{TypeAny, TypeAny}, TypeAny},
+	"AND":     {1, -1, []ValueType{TypeBool}, TypeBool},
+	"OR":      {1, -1, []ValueType{TypeBool}, TypeBool},
+	"NOT":     {1, 1, []ValueType{TypeBool}, TypeBool},
+	"ISBLANK": {1, 1, []ValueType{TypeAny}, TypeBool},
+
+	"ROUND":   {1, 2, []ValueType{TypeNumber, TypeNumber}, TypeNumber},
+	"ABS":     {1, 1, []ValueType{TypeNumber}, TypeNumber},
+	"MOD":     {2, 2, []ValueType{TypeNumber, TypeNumber}, TypeNumber},
+	"POWER":   {2, 2, []ValueType{TypeNumber, TypeNumber}, TypeNumber},
+	"SQRT":    {1, 1, []ValueType{TypeNumber}, TypeNumber},
+	"LOG":     {1, 2, []ValueType{TypeNumber, TypeNumber}, TypeNumber},
+	"CEILING": {1, 2, []ValueType{TypeNumber, TypeNumber}, TypeNumber},
+	"FLOOR":   {1, 2, []ValueType{TypeNumber, TypeNumber}, TypeNumber},
+
+	"COUNT":      {1, -1, []ValueType{TypeAny}, TypeNumber},
+	"COUNTIF":    {2, 2, []ValueType{TypeRange, TypeAny}, TypeNumber},
+	"COUNTIFS":   {2, -1, []ValueType{TypeRange, TypeAny}, TypeNumber},
+	"SUMIF":      {2, 3, []ValueType{TypeRange, TypeAny, TypeRange}, TypeNumber},
+	"SUMIFS":     {3, -1, []ValueType{TypeRange, TypeRange, TypeAny}, TypeNumber},
+	"AVERAGEIF":  {2, 3, []ValueType{TypeRange, TypeAny, TypeRange}, TypeNumber},
+	"AVERAGEIFS": {3, -1, []ValueType{TypeRange, TypeRange, TypeAny}, TypeNumber},
+	"VLOOKUP":    {3, 4, []ValueType{TypeAny, TypeRange, TypeNumber, TypeBool}, TypeAny},
+	"INDEX":      {2, 3, []ValueType{TypeRange, TypeNumber, TypeNumber}, TypeAny},
+	"MATCH":      {2, 3, []ValueType{TypeAny, TypeRange, TypeNumber}, TypeNumber},
+
+	"NOW":      {0, 0, nil, TypeDate},
+	"TODAY":    {0, 0, nil, TypeDate},
+	"YEAR":     {1, 1, []ValueType{TypeDate}, TypeNumber},
+	"MONTH":    {1, 1, []ValueType{TypeDate}, TypeNumber},
+	"DAY":      {1, 1, []ValueType{TypeDate}, TypeNumber},
+	"DATE":     {3, 3, []ValueType{TypeNumber, TypeNumber, TypeNumber}, TypeDate},
+	"WEEKDAY":  {1, 2, []ValueType{TypeDate, TypeNumber}, TypeNumber},
+	"EOMONTH":  {2, 2, []ValueType{TypeDate, TypeNumber}, TypeDate},
+	"EDATE":    {2, 2, []ValueType{TypeDate, TypeNumber}, TypeDate},
+	"DATEDIFF": {2, 3, []ValueType{TypeDate, TypeDate, TypeText}, TypeNumber},
+	"DATEDIF":  {2, 3, []ValueType{TypeDate, TypeDate, TypeText}, TypeNumber},
+
+	"UPPER":      {1, 1, []ValueType{TypeText}, TypeText},
+	"LOWER":      {1, 1, []ValueType{TypeText}, TypeText},
+	"CONCAT":     {1, -1, []ValueType{TypeText}, TypeText},
+	"LEN":        {1, 1, []ValueType{TypeText}, TypeNumber},
+	"TRIM":       {1, 1, []ValueType{TypeText}, TypeText},
+	"LEFT":       {1, 2, []ValueType{TypeText, TypeNumber}, TypeText},
+	"RIGHT":      {1, 2, []ValueType{TypeText, TypeNumber}, TypeText},
+	"MID":        {3, 3, []ValueType{TypeText, TypeNumber, TypeNumber}, TypeText},
+	"FIND":       {2, 3, []ValueType{TypeText, TypeText, TypeNumber}, TypeNumber},
+	"SUBSTITUTE": {3, 4, []ValueType{TypeText, TypeText, TypeText, TypeNumber}, TypeText},
+	"REPLACE":    {4, 4, []ValueType{TypeText, TypeNumber, TypeNumber, TypeText}, TypeText},
+	"TEXT":       {2, 2, []ValueType{TypeAny, TypeText}, TypeText},
+	"VALUE":      {1, 1, []ValueType{TypeText}, TypeNumber},
+	"REGEXMATCH": {2, 2, []ValueType{TypeText, TypeText}, TypeBool},
+
+	"RUNNING_SUM":      {1, 1, []ValueType{TypeNumber}, TypeNumber},
+	"RUNNING_AVG":      {1, 1, []ValueType{TypeNumber}, TypeNumber},
+	"RUNNING_COUNT":    {1, 1, []ValueType{TypeAny}, TypeNumber},
+	"WINDOW_SUM":       {1, 3, []ValueType{TypeNumber, TypeNumber, TypeNumber}, TypeNumber},
+	"WINDOW_AVG":       {1, 3, []ValueType{TypeNumber, TypeNumber, TypeNumber}, TypeNumber},
+	"WINDOW_MIN":       {1, 3, []ValueType{TypeNumber, TypeNumber, TypeNumber}, TypeNumber},
+	"WINDOW_MAX":       {1, 3, []ValueType{TypeNumber, TypeNumber, TypeNumber}, TypeNumber},
+	"WINDOW_COUNT":     {1, 3, []ValueType{TypeAny, TypeNumber, TypeNumber}, TypeNumber},
+	"RANK":             {1, 2, []ValueType{TypeAny, TypeText}, TypeNumber},
+	"PERCENT_OF_TOTAL": {1, 1, []ValueType{TypeNumber}, TypeNumber},
+	"LOOKUP":           {2, 2, []ValueType{TypeAny, TypeNumber}, TypeAny},
+	"FIRST":            {0, 1, []ValueType{TypeAny}, TypeNumber},
+	"LAST":             {0, 1, []ValueType{TypeAny}, TypeNumber},
+}
+
+// paramType returns the expected type of argument i
+func (s signature) paramType(i int) ValueType {
+	switch {
+	case len(s.params) == 0:
+		return TypeAny
+	case i < len(s.params):
+		return s.params[i]
+	case s.max < 0:
+		// Variadic pairs such as COUNTIFS(range, criteria, ...) repeat their last two params
+		if len(s.params) >= 2 && s.params[len(s.params)-2] == TypeRange && s.params[len(s.params)-1] == TypeAny {
+			if (i-len(s.params))%2 == 0 {
+				return TypeRange
+			}
+			return TypeAny
+		}
+		return s.params[len(s.params)-1]
+	}
+	return TypeAny
+}
+
+// TypeCheck infers the type of a formula and reports unknown fields and
+// functions, wrong argument counts and type mismatches with their positions.
+// fields maps field names (case-insensitively) to their types; when nil,
+// references are not checked. Only syntax errors are returned as err.
+func (e *FormulaEngine) TypeCheck(formula string, fields map[string]ValueType) (*TypeCheckResult, error) {
+	node, err := e.ParseFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+	tc := &typeChecker{fields: fields, udfs: e.userFunctions}
+	result := &TypeCheckResult{Type: tc.check(node), Issues: tc.issues}
+	if result.Issues == nil {
+		result.Issues = []TypeIssue{}
+	}
+	return result, nil
+}
+
+type typeChecker struct {
+	fields map[string]ValueType
+	udfs   map[string]*userFunction
+	issues []TypeIssue
+}
+
+func (tc *typeChecker) report(kind string, code ErrorCode, pos int, format string, args ...interface{}) {
+	tc.issues = append(tc.issues, TypeIssue{Kind: kind, Code: code, Message: fmt.Sprintf(format, args...), Position: pos})
+}
+
+func (tc *typeChecker) fieldType(name string) (ValueType, bool) {
+	if t, ok := tc.fields[name]; ok {
+		return t, true
+	}
+	for k, t := range tc.fields {
+		if strings.EqualFold(k, name) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+func (tc *typeChecker) check(node FormulaNode) ValueType {
+	switch n := node.(type) {
+	case *NumberNode:
+		return TypeNumber
+	case *StringNode:
+		return TypeText
+	case *BoolNode:
+		return TypeBool
+	case *CellRefNode:
+		if n.RangeEnd != "" {
+			return TypeRange
+		}
+		if tc.fields == nil {
+			return TypeAny
+		}
+		t, ok := tc.fieldType(n.Ref)
+		if !ok {
+			tc.report(IssueUnknownField, ErrRef, n.Pos, "unknown field '%s'", n.Ref)
+			return TypeAny
+		}
+		return t
+	case *UnaryNode:
+		tc.expect(n.Operand, tc.check(n.Operand), TypeNumber, "operand of unary "+n.Op.String())
+		return TypeNumber
+	case *BinaryNode:
+		return tc.checkBinary(n)
+	case *FuncCallNode:
+		return tc.checkCall(n)
+	}
+	return TypeAny
+}
+
+func (tc *typeChecker) checkBinary(n *BinaryNode) ValueType {
+	left := tc.check(n.Left)
+	right := tc.check(n.Right)
+
+	switch n.Op {
+	case TokAmpersand:
+		return TypeText
+	case TokEq, TokNeq, TokLt, TokGt, TokLte, TokGte:
+		return TypeBool
+	}
+
+	op := "operator " + n.Op.String()
+	tc.expect(n.Left, left, TypeNumber, "left operand of "+op)
+	tc.expect(n.Right, right, TypeNumber, "right operand of "+op)
+	if n.Op == TokSlash || n.Op == TokPercent {
+		if num, ok := n.Right.(*NumberNode); ok && num.Value == 0 {
+			tc.report(IssueDivisionByZero, ErrDiv0, n.Pos, "division by zero")
+		}
+	}
+	return TypeNumber
+}
+
+func (tc *typeChecker) checkCall(n *FuncCallNode) ValueType {
+	sig, ok := signatures[n.Name]
+	if uf, isUser := tc.udfs[n.Name]; !ok && isUser {
+		if len(n.Args) != len(uf.params) {
+			tc.report(IssueArgumentCount, ErrValue, n.Pos, "%s expects %d argument(s), got %d", n.Name, len(uf.params), len(n.Args))
+		}
+		for _, arg := range n.Args {
+			tc.check(arg)
+		}
+		return uf.returns
+	}
+	if !ok {
+		tc.report(IssueUnknownFunction, ErrName, n.Pos, "unknown function %s", n.Name)
+		for _, arg := range n.Args {
+			tc.check(arg)
+		}
+		return TypeAny
+	}
+
+	if len(n.Args) < sig.min || (sig.max >= 0 && len(n.Args) > sig.max) {
+		tc.report(IssueArgumentCount, ErrValue, n.Pos, "%s expects %s, got %d", n.Name, describeArity(sig), len(n.Args))
+	} else if strings.HasPrefix(n.Name, "WINDOW_") && len(n.Args) == 2 {
+		tc.report(IssueArgumentCount, ErrValue, n.Pos, "%s expects an expression and both window bounds", n.Name)
+	}
+
+	types := make([]ValueType, len(n.Args))
+	for i, arg := range n.Args {
+		types[i] = tc.check(arg)
+		// Variadic functions such as SUM(A1:A5, B1) take ranges as lists of values
+		if types[i] == TypeRange && sig.max < 0 {
+			continue
+		}
+		tc.expect(arg, types[i], sig.paramType(i), fmt.Sprintf("argument %d of %s", i+1, n.Name))
+	}
+
+	switch n.Name {
+	case "IF":
+		if len(n.Args) > 1 {
+			return commonType(types[1:])
+		}
+	case "IFS":
+		var branches []ValueType
+		for i := 1; i < len(types); i += 2 {
+			branches = append(branches, types[i])
+		}
+		return commonType(branches)
+	case "SWITCH":
+		var branches []ValueType
+		for i := 2; i < len(types); i += 2 {
+			branches = append(branches, types[i])
+		}
+		if len(types) > 1 && len(types)%2 == 0 {
+			branches = append(branches, types[len(types)-1])
+		}
+		return commonType(branches)
+	case "IFERROR":
+		return commonType(types)
+	case "LOOKUP":
+		if len(types) > 0 {
+			return types[0]
+		}
+	case "FIRST", "LAST":
+		// FIRST() is a row offset, FIRST(expr) the expression's first value
+		if len(types) == 1 {
+			return types[0]
+		}
+	}
+	return sig.returns
+}
+
+func describeArity(sig signature) string {
+	switch {
+	case sig.min == sig.max:
+		return fmt.Sprintf("%d argument(s)", sig.min)
+	case sig.max < 0:
+		return fmt.Sprintf("at least %d argument(s)", sig.min)
+	default:
+		return fmt.Sprintf("%d to %d arguments", sig.min, sig.max)
+	}
+}
+
+// commonType returns the shared type of branches, or TypeAny when they differ
+func commonType(types []ValueType) ValueType {
+	if len(types) == 0 {
+		return TypeAny
+	}
+	for _, t := range types[1:] {
+		if t != types[0] {
+			return TypeAny
+		}
+	}
+	return types[0]
+}
+
+// expect reports a mismatch when a value of type got cannot be used where want
+// is expected. The rules mirror the evaluator's runtime coercions: booleans and
+// numeric text count as numbers, anything renders as text, and dates accept
+// text and serial numbers.
+func (tc *typeChecker) expect(node FormulaNode, got, want ValueType, what string) {
+	if got == TypeAny || want == TypeAny || got == want {
+		return
+	}
+	ok := false
+	switch want {
+	case TypeNumber:
+		ok = got == TypeBool || (got == TypeText && isNumericLiteral(node))
+	case TypeText:
+		ok = got != TypeRange
+	case TypeRange:
+		ok = true
+	case TypeBool:
+		ok = got == TypeNumber || (got == TypeText && isBoolLiteral(node))
+	case TypeDate:
+		ok = got == TypeText || got == TypeNumber
+	}
+	if !ok {
+		tc.report(IssueTypeMismatch, ErrValue, nodePos(node), "%s must be %s, got %s", what, want, got)
+	}
+}
+
+func isNumericLiteral(node FormulaNode) bool {
+	s, ok := node.(*StringNode)
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseFloat(strings.TrimSpace(s.Value), 64)
+	return err == nil
+}
+
+func isBoolLiteral(node FormulaNode) bool {
+	s, ok := node.(*StringNode)
+	return ok && (strings.EqualFold(s.Value, "TRUE") || strings.EqualFold(s.Value, "FALSE"))
+}
+
+// nodePos returns the position of the leftmost token of an expression
+func nodePos(node FormulaNode) int {
+	switch n := node.(type) {
+	case *NumberNode:
+		return n.Pos
+	case *StringNode:
+		return n.Pos
+	case *BoolNode:
+		return n.Pos
+	case *CellRefNode:
+		return n.Pos
+	case *UnaryNode:
+		return n.Pos
+	case *BinaryNode:
+		return nodePos(n.Left)
+	case *FuncCallNode:
+		return n.Pos
+	}
+	return 0
+}
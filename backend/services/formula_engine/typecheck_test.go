@@ -0,0 +1,124 @@
+package formula_engine
+
+import (
+	"testing"
+)
+
+func TestTypeCheck(t *testing.T) {
+	engine := NewFormulaEngine()
+	fields := map[string]ValueType{
+		"Revenue":   TypeNumber,
+		"Cost":      TypeNumber,
+		"Region":    TypeText,
+		"OrderDate": TypeDate,
+		"Active":    TypeBool,
+	}
+
+	tests := []struct {
+		name     string
+		formula  string
+		wantType ValueType
+		issues   []TypeIssue // Kind and Position are compared
+	}{
+		{"Arithmetic", "[Revenue] - [Cost]", TypeNumber, nil},
+		{"Text plus number", "[Revenue] + [Region]", TypeNumber, []TypeIssue{{Kind: IssueTypeMismatch, Position: 12}}},
+		{"Numeric string literal", `[Revenue] + "10"`, TypeNumber, nil},
+		{"Unknown field", "[Revenue] * [Margin]", TypeNumber, []TypeIssue{{Kind: IssueUnknownField, Position: 12}}},
+		{"Case-insensitive field", "[revenue] * 2", TypeNumber, nil},
+		{"Unknown function", "FOO([Revenue])", TypeAny, []TypeIssue{{Kind: IssueUnknownFunction, Position: 0}}},
+		{"Argument count", "ROUND([Revenue], 2, 3)", TypeNumber, []TypeIssue{{Kind: IssueArgumentCount, Position: 0}}},
+		{"Position after leading =", "= ABS()", TypeNumber, []TypeIssue{{Kind: IssueArgumentCount, Position: 2}}},
+		{"IF branches agree", `IF([Active], "yes", "no")`, TypeText, nil},
+		{"IF branches differ", `IF([Revenue] > 0, 1, "none")`, TypeAny, nil},
+		{"Text condition", `IF([Region], 1, 0)`, TypeNumber, []TypeIssue{{Kind: IssueTypeMismatch, Position: 3}}},
+		{"Date functions", "YEAR([OrderDate]) + MONTH(\"2024-01-31\")", TypeNumber, nil},
+		{"Bool is not a date", "YEAR([Active])", TypeNumber, []TypeIssue{{Kind: IssueTypeMismatch, Position: 5}}},
+		{"Concat anything", `[Region] & [Revenue]`, TypeText, nil},
+		{"Ranges in variadic functions", "SUM(A1:A5, [Revenue])", TypeNumber, nil},
+		{"Literal division by zero", "[Revenue] / 0", TypeNumber, []TypeIssue{{Kind: IssueDivisionByZero, Position: 10}}},
+		{"Criteria pairs", `COUNTIFS(A1:A5, ">1", B1:B5, "x")`, TypeNumber, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.TypeCheck(tt.formula, fields)
+			if err != nil {
+				t.Fatalf("TypeCheck(%q) error = %v", tt.formula, err)
+			}
+			if result.Type != tt.wantType {
+				t.Errorf("TypeCheck(%q) type = %s, want %s", tt.formula, result.Type, tt.wantType)
+			}
+			if len(result.Issues) != len(tt.issues) {
+				t.Fatalf("TypeCheck(%q) issues = %v, want %v", tt.formula, result.Issues, tt.issues)
+			}
+			for i, want := range tt.issues {
+				got := result.Issues[i]
+				if got.Kind != want.Kind || got.Position != want.Position {
+					t.Errorf("issue %d = %s (%s), want %s at %d", i, got, got.Kind, want.Kind, want.Position)
+				}
+			}
+		})
+	}
+}
+
+func TestTypeCheck_NoSchema(t *testing.T) {
+	result, err := NewFormulaEngine().TypeCheck("[Anything] + 1", nil)
+	if err != nil {
+		t.Fatalf("TypeCheck() error = %v", err)
+	}
+	if !result.Valid() {
+		t.Errorf("expected no issues without a schema, got %v", result.Issues)
+	}
+}
+
+func TestTypeFromSQL(t *testing.T) {
+	tests := map[string]ValueType{
+		"integer":                  TypeNumber,
+		"numeric(10,2)":            TypeNumber,
+		"double precision":         TypeNumber,
+		"character varying(255)":   TypeText,
+		"text":                     TypeText,
+		"timestamp with time zone": TypeDate,
+		"date":                     TypeDate,
+		"boolean":                  TypeBool,
+		"jsonb":                    TypeAny,
+	}
+	for sqlType, want := range tests {
+		if got := TypeFromSQL(sqlType); got != want {
+			t.Errorf("TypeFromSQL(%q) = %s, want %s", sqlType, got, want)
+		}
+	}
+}
+
+func TestEvaluate_TypedErrors(t *testing.T) {
+	engine := NewFormulaEngine()
+	ctx := &FormulaContext{FieldValues: map[string]interface{}{
+		"Amount": "12.5",
+		"Bad":    &FormulaError{Code: ErrNA},
+	}}
+
+	got, err := engine.Evaluate("[Amount] * 2", ctx)
+	if err != nil || got != 25.0 {
+		t.Errorf("numeric string arithmetic = %v, %v; want 25", got, err)
+	}
+
+	tests := map[string]ErrorCode{
+		"[Missing] + 1":  ErrRef,
+		"[Bad] + 1":      ErrNA,
+		"1 / 0":          ErrDiv0,
+		`"abc" * 2`:      ErrValue,
+		"UPPER()":        ErrValue,
+		"-[Amount] & -x": ErrRef,
+	}
+	for formula, want := range tests {
+		_, err := engine.Evaluate(formula, ctx)
+		if code, ok := ErrorCodeOf(err); !ok || code != want {
+			t.Errorf("Evaluate(%q) error = %v, want %s", formula, err, want)
+		}
+	}
+
+	got, err = engine.Evaluate("IFERROR([Bad], 0)", ctx)
+	if err != nil || got != 0.0 {
+		t.Errorf("IFERROR over an error value = %v, %v; want 0", got, err)
+	}
+}
@@ -0,0 +1,227 @@
+package formula_engine
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxUserFunctionDepth bounds nested user-defined function calls so that a
+// recursive function without a reachable base case fails instead of
+// exhausting the stack
+const MaxUserFunctionDepth = 32
+
+var userFunctionName = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// UserFunction is a function written in the formula language itself. The body
+// refers to the parameters as fields, e.g. FISCAL_QUARTER(date) with body
+// "Q" & (FLOOR(MOD(MONTH([date]) + 10, 12) / 3, 1) + 1)
+type UserFunction struct {
+	Name   string
+	Params []string
+	Body   string
+}
+
+// userFunction is a parsed UserFunction
+type userFunction struct {
+	name    string
+	params  []string
+	body    FormulaNode
+	run     evalFn // compiled body
+	returns ValueType
+}
+
+func (uf *userFunction) param(ref string) (int, bool) {
+	for i, p := range uf.params {
+		if strings.EqualFold(p, ref) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// WithUserFunctions returns an engine that resolves the given functions in
+// addition to the built-in ones. Every body is checked up front: it may only
+// reference its own parameters and call built-in or user-defined functions
+// with the right number of arguments.
+func (e *FormulaEngine) WithUserFunctions(defs []UserFunction) (*FormulaEngine, error) {
+	udfs := make(map[string]*userFunction, len(defs))
+	for _, def := range defs {
+		uf, err := parseUserFunction(e, def)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := udfs[uf.name]; dup {
+			return nil, fmt.Errorf("function %s is defined more than once", uf.name)
+		}
+		udfs[uf.name] = uf
+	}
+
+	engine := &FormulaEngine{userFunctions: udfs}
+	names := make([]string, 0, len(udfs))
+	for name := range udfs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := engine.checkUserFunction(udfs[name]); err != nil {
+			return nil, err
+		}
+	}
+	// Return types are inferred with every parameter untyped; functions
+	// calling one inferred later see it as returning any
+	for _, name := range names {
+		tc := &typeChecker{udfs: udfs}
+		udfs[name].returns = tc.check(udfs[name].body)
+	}
+	for _, uf := range udfs {
+		uf.run = engine.compileNode(uf.body)
+	}
+	return engine, nil
+}
+
+// HasUserFunction reports whether name is a user-defined function of this engine
+func (e *FormulaEngine) HasUserFunction(name string) bool {
+	_, ok := e.userFunctions[strings.ToUpper(name)]
+	return ok
+}
+
+func parseUserFunction(e *FormulaEngine, def UserFunction) (*userFunction, error) {
+	name := strings.ToUpper(strings.TrimSpace(def.Name))
+	if !userFunctionName.MatchString(name) || isCellRef(name) || name == "TRUE" || name == "FALSE" {
+		return nil, fmt.Errorf("invalid function name '%s'", def.Name)
+	}
+	if _, builtin := GetFunction(name); builtin {
+		return nil, fmt.Errorf("function %s conflicts with a built-in function", name)
+	}
+
+	uf := &userFunction{name: name, returns: TypeAny}
+	for _, p := range def.Params {
+		p = strings.TrimSpace(p)
+		if !userFunctionName.MatchString(strings.ToUpper(p)) || isCellRef(p) {
+			return nil, fmt.Errorf("function %s: invalid parameter name '%s'", name, p)
+		}
+		if _, dup := uf.param(p); dup {
+			return nil, fmt.Errorf("function %s: duplicate parameter '%s'", name, p)
+		}
+		uf.params = append(uf.params, p)
+	}
+
+	body, err := e.ParseFormula(def.Body)
+	if err != nil {
+		return nil, fmt.Errorf("function %s: %w", name, err)
+	}
+	uf.body = body
+	return uf, nil
+}
+
+func (e *FormulaEngine) checkUserFunction(uf *userFunction) error {
+	var walk func(node FormulaNode) error
+	walk = func(node FormulaNode) error {
+		switch n := node.(type) {
+		case *CellRefNode:
+			if n.RangeEnd != "" {
+				return fmt.Errorf("function %s: ranges are not allowed in function bodies", uf.name)
+			}
+			if _, ok := uf.param(n.Ref); !ok {
+				return fmt.Errorf("function %s: '%s' is not a parameter", uf.name, n.Ref)
+			}
+		case *BinaryNode:
+			if err := walk(n.Left); err != nil {
+				return err
+			}
+			return walk(n.Right)
+		case *UnaryNode:
+			return walk(n.Operand)
+		case *FuncCallNode:
+			if windowFunctions[n.Name] {
+				return fmt.Errorf("function %s: table calculation %s is not allowed in function bodies", uf.name, n.Name)
+			}
+			if callee, ok := e.userFunctions[n.Name]; ok {
+				if len(n.Args) != len(callee.params) {
+					return fmt.Errorf("function %s: %s expects %d argument(s), got %d", uf.name, n.Name, len(callee.params), len(n.Args))
+				}
+			} else if _, ok := GetFunction(n.Name); !ok {
+				return fmt.Errorf("function %s: unknown function %s", uf.name, n.Name)
+			}
+			for _, arg := range n.Args {
+				if err := walk(arg); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(uf.body)
+}
+
+// evalUserFunction binds the evaluated arguments to the parameters and
+// evaluates the body in a context of its own
+func (e *FormulaEngine) evalUserFunction(uf *userFunction, n *FuncCallNode, ctx *FormulaContext) (interface{}, error) {
+	args := make([]evalFn, len(n.Args))
+	for i, arg := range n.Args {
+		node := arg
+		args[i] = func(ctx *FormulaContext) (interface{}, error) {
+			return e.evalNode(node, ctx)
+		}
+	}
+	return callUserFunction(uf, args, ctx)
+}
+
+// callUserFunction runs a user-defined function on its arguments; it serves
+// both the tree-walking and the compiled evaluator
+func callUserFunction(uf *userFunction, args []evalFn, ctx *FormulaContext) (interface{}, error) {
+	if len(args) != len(uf.params) {
+		return nil, arityError(uf.name, fmt.Sprintf("%d argument(s)", len(uf.params)))
+	}
+	depth := 1
+	if ctx != nil {
+		depth = ctx.depth + 1
+	}
+	if depth > MaxUserFunctionDepth {
+		return nil, newFormulaError(ErrNum, "%s: recursion deeper than %d calls", uf.name, MaxUserFunctionDepth)
+	}
+
+	params := make(map[string]interface{}, len(uf.params))
+	for i, arg := range args {
+		val, err := arg(ctx)
+		if err != nil {
+			return nil, err
+		}
+		params[uf.params[i]] = val
+	}
+	return uf.run(&FormulaContext{FieldValues: params, depth: depth})
+}
+
+// userCall inlines a user-defined function, substituting the compiled
+// arguments for its parameters. Recursive functions cannot be unrolled.
+func (c *sqlCompiler) userCall(uf *userFunction, n *FuncCallNode) (sqlExpr, error) {
+	if err := sqlArity(uf.name, n.Args, len(uf.params), len(uf.params)); err != nil {
+		return sqlExpr{}, err
+	}
+	for _, name := range c.inlining {
+		if name == uf.name {
+			return sqlExpr{}, notTranslatable("recursive function %s", uf.name)
+		}
+	}
+
+	args := make([]string, len(n.Args))
+	for i, arg := range n.Args {
+		v, err := c.value(arg)
+		if err != nil {
+			return sqlExpr{}, err
+		}
+		args[i] = "(" + v + ")"
+	}
+
+	body := *c
+	body.inlining = append(append([]string(nil), c.inlining...), uf.name)
+	body.resolve = func(ref string) (string, error) {
+		if i, ok := uf.param(ref); ok {
+			return args[i], nil
+		}
+		return "", fmt.Errorf("function %s: '%s' is not a parameter", uf.name, ref)
+	}
+	return body.compile(uf.body)
+}
@@ -0,0 +1,122 @@
+package formula_engine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func udfEngine(t *testing.T) *FormulaEngine {
+	t.Helper()
+	engine, err := NewFormulaEngine().WithUserFunctions([]UserFunction{
+		{Name: "fiscal_quarter", Params: []string{"date"}, Body: `"Q" & (FLOOR(MOD(MONTH([date]) + 10, 12) / 3, 1) + 1)`},
+		{Name: "MARGIN", Params: []string{"revenue", "cost"}, Body: "IF([revenue] = 0, 0, ([revenue] - [cost]) / [revenue])"},
+		{Name: "HIGH_MARGIN", Params: []string{"revenue", "cost"}, Body: "MARGIN([revenue], [cost]) > 0.5"},
+		{Name: "FACT", Params: []string{"n"}, Body: "IF([n] <= 1, 1, [n] * FACT([n] - 1))"},
+		{Name: "FOREVER", Params: []string{"n"}, Body: "FOREVER([n] + 1)"},
+	})
+	if err != nil {
+		t.Fatalf("WithUserFunctions() error = %v", err)
+	}
+	return engine
+}
+
+func TestUserFunctions_Evaluate(t *testing.T) {
+	engine := udfEngine(t)
+	ctx := &FormulaContext{FieldValues: map[string]interface{}{
+		"Revenue": 200.0,
+		"Cost":    50.0,
+		"Ordered": time.Date(2024, 2, 14, 0, 0, 0, 0, time.UTC),
+	}}
+
+	tests := []struct {
+		formula string
+		want    interface{}
+	}{
+		{"MARGIN([Revenue], [Cost])", 0.75},
+		{"HIGH_MARGIN([Revenue], [Cost])", true},
+		{"fiscal_quarter([Ordered])", "Q1"},
+		{"FACT(5)", 120.0},
+		{"MARGIN(0, 10)", 0.0},
+	}
+	for _, tt := range tests {
+		got, err := engine.Evaluate(tt.formula, ctx)
+		if err != nil {
+			t.Fatalf("Evaluate(%q) error = %v", tt.formula, err)
+		}
+		if got != tt.want {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.formula, got, tt.want)
+		}
+	}
+}
+
+func TestUserFunctions_RecursionLimit(t *testing.T) {
+	_, err := udfEngine(t).Evaluate("FOREVER(1)", &FormulaContext{})
+	if code, ok := ErrorCodeOf(err); !ok || code != ErrNum {
+		t.Errorf("Evaluate() error = %v, want #NUM!", err)
+	}
+}
+
+func TestUserFunctions_InvalidDefinitions(t *testing.T) {
+	tests := []struct {
+		name string
+		def  UserFunction
+		want string
+	}{
+		{"Shadows built-in", UserFunction{Name: "SUM", Body: "1"}, "built-in"},
+		{"Cell-like name", UserFunction{Name: "AB12", Body: "1"}, "invalid function name"},
+		{"Unknown parameter", UserFunction{Name: "F", Params: []string{"x"}, Body: "[x] + [y]"}, "'y' is not a parameter"},
+		{"Duplicate parameter", UserFunction{Name: "F", Params: []string{"x", "X"}, Body: "[x]"}, "duplicate parameter"},
+		{"Unknown function", UserFunction{Name: "F", Params: []string{"x"}, Body: "NOPE([x])"}, "unknown function NOPE"},
+		{"Wrong arity", UserFunction{Name: "F", Params: []string{"x"}, Body: "F([x], 1)"}, "expects 1 argument"},
+		{"Table calculation", UserFunction{Name: "F", Params: []string{"x"}, Body: "RUNNING_SUM([x])"}, "not allowed"},
+		{"Syntax error", UserFunction{Name: "F", Params: []string{"x"}, Body: "[x] +"}, "function F"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFormulaEngine().WithUserFunctions([]UserFunction{tt.def})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("WithUserFunctions() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserFunctions_CompileSQL(t *testing.T) {
+	engine := udfEngine(t)
+
+	got, err := engine.CompileSQL("MARGIN([Revenue], [Cost])", SQLCompileOptions{Dialect: "postgres"})
+	if err != nil {
+		t.Fatalf("CompileSQL() error = %v", err)
+	}
+	want := `CASE WHEN (("Revenue") = 0) THEN 0 ELSE ((("Revenue") - ("Cost")) * 1.0 / NULLIF(("Revenue"), 0)) END`
+	if got != want {
+		t.Errorf("CompileSQL() = %s, want %s", got, want)
+	}
+
+	if _, err := engine.CompileSQL("FACT([n])", SQLCompileOptions{Dialect: "postgres"}); !errors.Is(err, ErrNotTranslatable) {
+		t.Errorf("CompileSQL(FACT) error = %v, want ErrNotTranslatable", err)
+	}
+}
+
+func TestUserFunctions_TypeCheck(t *testing.T) {
+	engine := udfEngine(t)
+
+	result, err := engine.TypeCheck("FISCAL_QUARTER([d]) & \"-\" & MARGIN([r], [c])", map[string]ValueType{"d": TypeDate, "r": TypeNumber, "c": TypeNumber})
+	if err != nil {
+		t.Fatalf("TypeCheck() error = %v", err)
+	}
+	if !result.Valid() || result.Type != TypeText {
+		t.Errorf("TypeCheck() = %+v", result)
+	}
+
+	result, _ = engine.TypeCheck("MARGIN([r]) + 1", map[string]ValueType{"r": TypeNumber})
+	if result.Valid() || result.Issues[0].Kind != IssueArgumentCount {
+		t.Errorf("expected argument count issue, got %+v", result.Issues)
+	}
+	result, _ = engine.TypeCheck("HIGH_MARGIN([r], [c]) & \"\"", map[string]ValueType{"r": TypeNumber, "c": TypeNumber})
+	if !result.Valid() {
+		t.Errorf("boolean result should concatenate: %+v", result.Issues)
+	}
+}
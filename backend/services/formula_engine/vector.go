@@ -0,0 +1,362 @@
+package formula_engine
+
+import (
+	"math"
+	"strings"
+)
+
+// vectorBatchSize is the number of rows the columnar evaluator handles at once
+const vectorBatchSize = 4096
+
+type vectorKind int
+
+const (
+	vectorNumber vectorKind = iota
+	vectorBool
+)
+
+// vector holds one value per row of a batch. Rows that failed carry a
+// *FormulaError in errs, which stays nil until the first failure.
+type vector struct {
+	nums  []float64
+	bools []bool
+	errs  []*FormulaError
+}
+
+func (v *vector) fail(i, n int, err *FormulaError) {
+	if v.errs == nil {
+		v.errs = make([]*FormulaError, n)
+	}
+	v.errs[i] = err
+}
+
+// errAt returns the error of a row, if any
+func (v *vector) errAt(i int) *FormulaError {
+	if v.errs == nil {
+		return nil
+	}
+	return v.errs[i]
+}
+
+// columnBatch holds the referenced numeric columns of a batch of rows
+type columnBatch struct {
+	n    int
+	cols map[string][]float64
+}
+
+type vectorFn func(b *columnBatch) *vector
+
+// vectorPlan is the columnar form of a formula built from numeric columns,
+// arithmetic, numeric comparisons and IF. It is used for a batch only when
+// every referenced field holds a number in every row of the batch.
+type vectorPlan struct {
+	kind    vectorKind
+	run     vectorFn
+	columns []string
+}
+
+// planVector compiles the columnar form of a formula, or returns nil when
+// part of it needs the row-by-row evaluator
+func planVector(node FormulaNode) *vectorPlan {
+	p := &vectorPlan{}
+	kind, run, ok := p.compile(node, true)
+	if !ok {
+		return nil
+	}
+	p.kind, p.run = kind, run
+	return p
+}
+
+// compile builds the vector function of a node. A result position (the
+// formula itself or an IF branch) cannot be a bare field: the row evaluator
+// returns such values unconverted, while vectors hold float64.
+func (p *vectorPlan) compile(node FormulaNode, result bool) (vectorKind, vectorFn, bool) {
+	switch n := node.(type) {
+	case *NumberNode:
+		return vectorNumber, numberConstant(n.Value), true
+
+	case *BoolNode:
+		return vectorBool, boolConstant(n.Value), true
+
+	case *CellRefNode:
+		if result || n.RangeEnd != "" {
+			return 0, nil, false
+		}
+		name := n.Ref
+		p.addColumn(name)
+		return vectorNumber, func(b *columnBatch) *vector {
+			return &vector{nums: b.cols[name]}
+		}, true
+
+	case *UnaryNode:
+		kind, operand, ok := p.compile(n.Operand, false)
+		if !ok || kind != vectorNumber {
+			return 0, nil, false
+		}
+		if n.Op != TokMinus {
+			return vectorNumber, operand, true
+		}
+		return vectorNumber, func(b *columnBatch) *vector {
+			in := operand(b)
+			out := &vector{nums: make([]float64, b.n), errs: in.errs}
+			for i, x := range in.nums {
+				out.nums[i] = -x
+			}
+			return out
+		}, true
+
+	case *BinaryNode:
+		lKind, left, lok := p.compile(n.Left, false)
+		rKind, right, rok := p.compile(n.Right, false)
+		if !lok || !rok || lKind != vectorNumber || rKind != vectorNumber {
+			return 0, nil, false
+		}
+		switch n.Op {
+		case TokPlus, TokMinus, TokStar, TokSlash, TokPercent, TokCaret:
+			return vectorNumber, arithmeticVector(n.Op, left, right), true
+		case TokLt, TokGt, TokLte, TokGte:
+			return vectorBool, comparisonVector(n.Op, left, right), true
+		}
+		return 0, nil, false
+
+	case *FuncCallNode:
+		if n.Name != "IF" || len(n.Args) < 2 || len(n.Args) > 3 {
+			return 0, nil, false
+		}
+		_, cond, ok := p.compile(n.Args[0], false)
+		if !ok {
+			return 0, nil, false
+		}
+		kind, then, ok := p.compile(n.Args[1], true)
+		if !ok {
+			return 0, nil, false
+		}
+		// IF without an else branch yields FALSE
+		var otherwise vectorFn
+		if len(n.Args) == 3 {
+			elseKind, fn, ok := p.compile(n.Args[2], true)
+			if !ok || elseKind != kind {
+				return 0, nil, false
+			}
+			otherwise = fn
+		} else {
+			if kind != vectorBool {
+				return 0, nil, false
+			}
+			otherwise = boolConstant(false)
+		}
+		return kind, ifVector(cond, then, otherwise), true
+	}
+	return 0, nil, false
+}
+
+func numberConstant(value float64) vectorFn {
+	return func(b *columnBatch) *vector {
+		nums := make([]float64, b.n)
+		for i := range nums {
+			nums[i] = value
+		}
+		return &vector{nums: nums}
+	}
+}
+
+func boolConstant(value bool) vectorFn {
+	return func(b *columnBatch) *vector {
+		bools := make([]bool, b.n)
+		for i := range bools {
+			bools[i] = value
+		}
+		return &vector{bools: bools}
+	}
+}
+
+func (p *vectorPlan) addColumn(name string) {
+	for _, c := range p.columns {
+		if c == name {
+			return
+		}
+	}
+	p.columns = append(p.columns, name)
+}
+
+// mergeErrors carries the operands' row errors into out, the left operand's
+// first, as the row evaluator stops at the first failing operand
+func mergeErrors(out, l, r *vector, n int) {
+	if l.errs == nil && r.errs == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		if err := l.errAt(i); err != nil {
+			out.fail(i, n, err)
+		} else if err := r.errAt(i); err != nil {
+			out.fail(i, n, err)
+		}
+	}
+}
+
+func arithmeticVector(op TokenKind, left, right vectorFn) vectorFn {
+	return func(b *columnBatch) *vector {
+		l, r := left(b), right(b)
+		out := &vector{nums: make([]float64, b.n)}
+		mergeErrors(out, l, r, b.n)
+		x, y, z := l.nums, r.nums, out.nums
+		switch op {
+		case TokPlus:
+			for i := range z {
+				z[i] = x[i] + y[i]
+			}
+		case TokMinus:
+			for i := range z {
+				z[i] = x[i] - y[i]
+			}
+		case TokStar:
+			for i := range z {
+				z[i] = x[i] * y[i]
+			}
+		case TokSlash:
+			for i := range z {
+				if y[i] == 0 {
+					if out.errAt(i) == nil {
+						out.fail(i, b.n, newFormulaError(ErrDiv0, "division by zero"))
+					}
+					continue
+				}
+				z[i] = x[i] / y[i]
+			}
+		case TokPercent:
+			for i := range z {
+				if y[i] == 0 {
+					if out.errAt(i) == nil {
+						out.fail(i, b.n, newFormulaError(ErrDiv0, "modulo by zero"))
+					}
+					continue
+				}
+				z[i] = math.Mod(x[i], y[i])
+			}
+		case TokCaret:
+			for i := range z {
+				z[i] = math.Pow(x[i], y[i])
+			}
+		}
+		return out
+	}
+}
+
+func comparisonVector(op TokenKind, left, right vectorFn) vectorFn {
+	return func(b *columnBatch) *vector {
+		l, r := left(b), right(b)
+		out := &vector{bools: make([]bool, b.n)}
+		mergeErrors(out, l, r, b.n)
+		x, y, z := l.nums, r.nums, out.bools
+		switch op {
+		case TokLt:
+			for i := range z {
+				z[i] = x[i] < y[i]
+			}
+		case TokGt:
+			for i := range z {
+				z[i] = x[i] > y[i]
+			}
+		case TokLte:
+			for i := range z {
+				z[i] = x[i] <= y[i]
+			}
+		case TokGte:
+			for i := range z {
+				z[i] = x[i] >= y[i]
+			}
+		}
+		return out
+	}
+}
+
+// ifVector evaluates both branches over the batch and picks per row; an error
+// in the branch that is not taken does not surface, as with the lazy IF
+func ifVector(cond, then, otherwise vectorFn) vectorFn {
+	return func(b *columnBatch) *vector {
+		c, t, f := cond(b), then(b), otherwise(b)
+		out := &vector{}
+		if t.nums != nil {
+			out.nums = make([]float64, b.n)
+		} else {
+			out.bools = make([]bool, b.n)
+		}
+		for i := 0; i < b.n; i++ {
+			if err := c.errAt(i); err != nil {
+				out.fail(i, b.n, err)
+				continue
+			}
+			taken := f
+			if (c.bools != nil && c.bools[i]) || (c.nums != nil && c.nums[i] != 0) {
+				taken = t
+			}
+			if err := taken.errAt(i); err != nil {
+				out.fail(i, b.n, err)
+			} else if out.nums != nil {
+				out.nums[i] = taken.nums[i]
+			} else {
+				out.bools[i] = taken.bools[i]
+			}
+		}
+		return out
+	}
+}
+
+// load gathers the plan's columns from a batch of rows. It fails when a
+// field is missing or holds anything but a number in some row.
+func (p *vectorPlan) load(rows []map[string]interface{}) (*columnBatch, bool) {
+	b := &columnBatch{n: len(rows), cols: make(map[string][]float64, len(p.columns))}
+	for _, name := range p.columns {
+		col := make([]float64, len(rows))
+		for i, row := range rows {
+			val, ok := row[name]
+			if !ok {
+				if val, ok = lookupFold(row, name); !ok {
+					return nil, false
+				}
+			}
+			switch v := val.(type) {
+			case float64:
+				col[i] = v
+			case int:
+				col[i] = float64(v)
+			case int64:
+				col[i] = float64(v)
+			default:
+				return nil, false
+			}
+		}
+		b.cols[name] = col
+	}
+	return b, true
+}
+
+func lookupFold(row map[string]interface{}, name string) (interface{}, bool) {
+	for k, v := range row {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// evaluate runs the plan over a batch of rows into results; false means the
+// batch is not homogeneous and must be evaluated row by row
+func (p *vectorPlan) evaluate(rows []map[string]interface{}, results []interface{}) bool {
+	b, ok := p.load(rows)
+	if !ok {
+		return false
+	}
+	out := p.run(b)
+	for i := 0; i < b.n; i++ {
+		switch {
+		case out.errAt(i) != nil:
+			results[i] = out.errs[i]
+		case p.kind == vectorNumber:
+			results[i] = out.nums[i]
+		default:
+			results[i] = out.bools[i]
+		}
+	}
+	return true
+}
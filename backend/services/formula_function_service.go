@@ -0,0 +1,243 @@
+package services
+
+import (
+	"fmt"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// FormulaFunctionService manages workspace user-defined formula functions
+// and hands out formula engines that resolve them
+type FormulaFunctionService struct {
+	db     *gorm.DB
+	engine *formula_engine.FormulaEngine
+
+	mu      sync.RWMutex
+	engines map[string]*formula_engine.FormulaEngine // workspace ID -> engine with its functions
+}
+
+// NewFormulaFunctionService creates a new formula function service
+func NewFormulaFunctionService(db *gorm.DB, engine *formula_engine.FormulaEngine) *FormulaFunctionService {
+	return &FormulaFunctionService{
+		db:      db,
+		engine:  engine,
+		engines: make(map[string]*formula_engine.FormulaEngine),
+	}
+}
+
+// AutoMigrate creates the function and version tables
+func (s *FormulaFunctionService) AutoMigrate() error {
+	return s.db.AutoMigrate(&models.FormulaFunction{}, &models.FormulaFunctionVersion{})
+}
+
+// List returns the functions of a workspace
+func (s *FormulaFunctionService) List(workspaceID string) ([]models.FormulaFunction, error) {
+	var functions []models.FormulaFunction
+	err := s.db.Where("workspace_id = ?", workspaceID).Order("name ASC").Find(&functions).Error
+	return functions, err
+}
+
+// Get returns a function by ID
+func (s *FormulaFunctionService) Get(id string) (*models.FormulaFunction, error) {
+	var function models.FormulaFunction
+	if err := s.db.First(&function, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &function, nil
+}
+
+// Versions returns the version history of a function, newest first
+func (s *FormulaFunctionService) Versions(id string) ([]models.FormulaFunctionVersion, error) {
+	var versions []models.FormulaFunctionVersion
+	err := s.db.Where("function_id = ?", id).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// EngineFor returns a formula engine resolving the workspace's functions
+func (s *FormulaFunctionService) EngineFor(workspaceID string) (*formula_engine.FormulaEngine, error) {
+	s.mu.RLock()
+	engine, ok := s.engines[workspaceID]
+	s.mu.RUnlock()
+	if ok {
+		return engine, nil
+	}
+
+	functions, err := s.List(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	engine, err = s.engine.WithUserFunctions(userFunctions(functions))
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.engines[workspaceID] = engine
+	s.mu.Unlock()
+	return engine, nil
+}
+
+func (s *FormulaFunctionService) invalidate(workspaceID string) {
+	s.mu.Lock()
+	delete(s.engines, workspaceID)
+	s.mu.Unlock()
+}
+
+func userFunctions(functions []models.FormulaFunction) []formula_engine.UserFunction {
+	defs := make([]formula_engine.UserFunction, len(functions))
+	for i := range functions {
+		defs[i] = formula_engine.UserFunction{
+			Name:   functions[i].Name,
+			Params: functions[i].ParamNames(),
+			Body:   functions[i].Body,
+		}
+	}
+	return defs
+}
+
+// checkWorkspace validates the workspace's function set with change applied
+// (replacing the function with the same ID, or removed when remove is set),
+// so edits that break a dependent function are rejected
+func (s *FormulaFunctionService) checkWorkspace(tx *gorm.DB, change *models.FormulaFunction, remove bool) error {
+	var functions []models.FormulaFunction
+	if err := tx.Where("workspace_id = ? AND id <> ?", change.WorkspaceID, change.ID).Find(&functions).Error; err != nil {
+		return err
+	}
+	if !remove {
+		functions = append(functions, *change)
+	}
+	_, err := s.engine.WithUserFunctions(userFunctions(functions))
+	return err
+}
+
+func validateFormulaFunction(function *models.FormulaFunction) error {
+	function.Name = strings.ToUpper(strings.TrimSpace(function.Name))
+	if function.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if function.WorkspaceID == "" {
+		return fmt.Errorf("workspace is required")
+	}
+	if strings.TrimSpace(function.Body) == "" {
+		return fmt.Errorf("body is required")
+	}
+	function.SetParamNames(function.ParamNames())
+	return nil
+}
+
+func snapshotFormulaFunction(function *models.FormulaFunction, userID string) *models.FormulaFunctionVersion {
+	return &models.FormulaFunctionVersion{
+		ID:          uuid.New().String(),
+		FunctionID:  function.ID,
+		Version:     function.Version,
+		Name:        function.Name,
+		Description: function.Description,
+		Params:      function.Params,
+		Body:        function.Body,
+		CreatedBy:   userID,
+	}
+}
+
+// Create defines a new function
+func (s *FormulaFunctionService) Create(function *models.FormulaFunction) error {
+	if err := validateFormulaFunction(function); err != nil {
+		return err
+	}
+	if function.ID == "" {
+		function.ID = uuid.New().String()
+	}
+	function.Version = 1
+	function.UpdatedBy = function.CreatedBy
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkWorkspace(tx, function, false); err != nil {
+			return err
+		}
+		if err := tx.Create(function).Error; err != nil {
+			return err
+		}
+		return tx.Create(snapshotFormulaFunction(function, function.CreatedBy)).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(function.WorkspaceID)
+	return nil
+}
+
+// Update changes a function and records the new version
+func (s *FormulaFunctionService) Update(function *models.FormulaFunction, userID string) error {
+	var existing models.FormulaFunction
+	if err := s.db.First(&existing, "id = ?", function.ID).Error; err != nil {
+		return err
+	}
+	function.WorkspaceID = existing.WorkspaceID
+	if err := validateFormulaFunction(function); err != nil {
+		return err
+	}
+	function.CreatedBy = existing.CreatedBy
+	function.CreatedAt = existing.CreatedAt
+	function.UpdatedBy = userID
+	function.Version = existing.Version + 1
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkWorkspace(tx, function, false); err != nil {
+			return err
+		}
+		if err := tx.Save(function).Error; err != nil {
+			return err
+		}
+		return tx.Create(snapshotFormulaFunction(function, userID)).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(function.WorkspaceID)
+	return nil
+}
+
+// Restore makes an earlier version current again, as a new version
+func (s *FormulaFunctionService) Restore(id string, version int, userID string) (*models.FormulaFunction, error) {
+	var snapshot models.FormulaFunctionVersion
+	if err := s.db.Where("function_id = ? AND version = ?", id, version).First(&snapshot).Error; err != nil {
+		return nil, fmt.Errorf("version %d not found", version)
+	}
+	function := &models.FormulaFunction{
+		ID:          id,
+		Name:        snapshot.Name,
+		Description: snapshot.Description,
+		Params:      snapshot.Params,
+		Body:        snapshot.Body,
+	}
+	if err := s.Update(function, userID); err != nil {
+		return nil, err
+	}
+	return function, nil
+}
+
+// Delete removes a function that no other function of the workspace calls
+func (s *FormulaFunctionService) Delete(id string) error {
+	function, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkWorkspace(tx, function, true); err != nil {
+			return fmt.Errorf("function %s is still in use: %w", function.Name, err)
+		}
+		if err := tx.Where("function_id = ?", id).Delete(&models.FormulaFunctionVersion{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.FormulaFunction{}, "id = ?", id).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidate(function.WorkspaceID)
+	return nil
+}
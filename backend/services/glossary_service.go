@@ -7,15 +7,26 @@ import (
 )
 
 type GlossaryService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	metricRegistry *MetricRegistryService
 }
 
 func NewGlossaryService(db *gorm.DB) *GlossaryService {
 	return &GlossaryService{db: db}
 }
 
+// SetMetricRegistry makes term mappings reference registry metrics
+func (s *GlossaryService) SetMetricRegistry(registry *MetricRegistryService) {
+	s.metricRegistry = registry
+}
+
 // CreateTerm creates a new business term
 func (s *GlossaryService) CreateTerm(term *models.BusinessTerm) error {
+	for i := range term.RelatedColumns {
+		if err := s.resolveMappingMetric(&term.RelatedColumns[i]); err != nil {
+			return err
+		}
+	}
 	return s.db.Create(term).Error
 }
 
@@ -37,6 +48,11 @@ func (s *GlossaryService) ListTerms(workspaceID string) ([]models.BusinessTerm,
 
 // UpdateTerm updates a business term
 func (s *GlossaryService) UpdateTerm(term *models.BusinessTerm) error {
+	for i := range term.RelatedColumns {
+		if err := s.resolveMappingMetric(&term.RelatedColumns[i]); err != nil {
+			return err
+		}
+	}
 	return s.db.Session(&gorm.Session{FullSaveAssociations: true}).Save(term).Error
 }
 
@@ -47,9 +63,25 @@ func (s *GlossaryService) DeleteTerm(id string) error {
 
 // AddMapping adds a mapping between a term and a column/metric
 func (s *GlossaryService) AddMapping(mapping *models.TermColumnMapping) error {
+	if err := s.resolveMappingMetric(mapping); err != nil {
+		return err
+	}
 	return s.db.Create(mapping).Error
 }
 
+// resolveMappingMetric stores the registry ID of a mapped metric, which may be given as a legacy semantic or modeling metric ID
+func (s *GlossaryService) resolveMappingMetric(mapping *models.TermColumnMapping) error {
+	if s.metricRegistry == nil || mapping.MetricID == nil || *mapping.MetricID == "" {
+		return nil
+	}
+	metricID, err := s.metricRegistry.ResolveMetricID(*mapping.MetricID)
+	if err != nil {
+		return err
+	}
+	mapping.MetricID = &metricID
+	return nil
+}
+
 // RemoveMapping removes a mapping
 func (s *GlossaryService) RemoveMapping(id string) error {
 	return s.db.Delete(&models.TermColumnMapping{}, "id = ?", id).Error
@@ -3,8 +3,12 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"insight-engine-backend/models"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -21,14 +25,190 @@ func NewIncrementalRefreshService(executor *QueryExecutor) *IncrementalRefreshSe
 	}
 }
 
+// MVIncrementalSettings is the incremental refresh configuration kept in a
+// materialized view's metadata
+type MVIncrementalSettings struct {
+	PrimaryKeys              []string `json:"primary_keys,omitempty"`               // default "id"
+	TimestampColumn          string   `json:"timestamp_column,omitempty"`           // detected when empty
+	LookbackSeconds          int64    `json:"lookback_seconds,omitempty"`           // rows this much older than the last refresh are merged again
+	DeletedColumn            string   `json:"deleted_column,omitempty"`             // changed rows with this flag set are removed
+	TombstoneTable           string   `json:"tombstone_table,omitempty"`            // table of deleted keys, with the primary key columns
+	TombstoneTimestampColumn string   `json:"tombstone_timestamp_column,omitempty"` // when a key was deleted, default "deleted_at"
+	ReconcileEvery           int      `json:"reconcile_every,omitempty"`            // every Nth refresh compares counts and checksums with the source
+}
+
+// mvTableName matches the table names accepted in settings, which are
+// interpolated into SQL
+var mvTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ParseIncrementalSettings reads the incremental settings of a view's
+// metadata
+func ParseIncrementalSettings(metadata map[string]interface{}) (MVIncrementalSettings, error) {
+	var settings MVIncrementalSettings
+	if len(metadata) == 0 {
+		return settings, nil
+	}
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(raw, &settings); err != nil {
+		return settings, fmt.Errorf("invalid incremental settings: %w", err)
+	}
+	if settings.LookbackSeconds < 0 {
+		return settings, fmt.Errorf("lookback_seconds must not be negative")
+	}
+	if settings.ReconcileEvery < 0 {
+		return settings, fmt.Errorf("reconcile_every must not be negative")
+	}
+	if settings.TombstoneTable != "" && !mvTableName.MatchString(settings.TombstoneTable) {
+		return settings, fmt.Errorf("invalid tombstone table %q", settings.TombstoneTable)
+	}
+	return settings, nil
+}
+
+// Store writes the settings into a view's metadata, keeping other keys
+func (settings MVIncrementalSettings) Store(metadata map[string]interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, err
+	}
+	stored := make(map[string]interface{}, len(metadata)+len(values))
+	for key, value := range metadata {
+		stored[key] = value
+	}
+	for key, value := range values {
+		stored[key] = value
+	}
+	return stored, nil
+}
+
 // RefreshConfig holds configuration for incremental refresh
 type RefreshConfig struct {
-	TimestampColumn string    // Column to track changes (e.g., "updated_at")
-	PrimaryKeys     []string  // Primary key columns for delta detection
-	LastRefresh     time.Time // Last successful refresh time
+	TimestampColumn          string        // Column to track changes (e.g., "updated_at")
+	PrimaryKeys              []string      // Primary key columns matching changed rows to stored rows
+	LastRefresh              time.Time     // Last successful refresh time
+	Lookback                 time.Duration // Merge rows changed this long before the last refresh again, for late-arriving data
+	DeletedColumn            string        // Optional soft-delete flag column
+	TombstoneTable           string        // Optional table of deleted keys
+	TombstoneTimestampColumn string        // When a key was deleted
+	Columns                  []string      // Columns of the source query
 }
 
-// PerformIncrementalRefresh performs an incremental refresh based on timestamp
+// Since returns the cutoff of the rows merged by a refresh
+func (c RefreshConfig) Since() time.Time {
+	return c.LastRefresh.Add(-c.Lookback)
+}
+
+// mvDialect returns the SQL dialect of a connection type
+func mvDialect(connectionType string) string {
+	if connectionType == "mssql" {
+		return "sqlserver"
+	}
+	return connectionType
+}
+
+// ResolveConfig checks a view's incremental settings against the columns of
+// its source query, returning them with column names as the query spells
+// them
+func (s *IncrementalRefreshService) ResolveConfig(
+	ctx context.Context,
+	connection *models.Connection,
+	mv *models.MaterializedView,
+) (*RefreshConfig, *MVIncrementalSettings, error) {
+	settings, err := ParseIncrementalSettings(mv.Metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	db, err := s.executor.getConnection(connection)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	columns, err := queryColumns(ctx, db, mv.SourceQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+	column := func(name, role string) (string, error) {
+		for _, col := range columns {
+			if strings.EqualFold(col, name) {
+				return col, nil
+			}
+		}
+		return "", fmt.Errorf("%s column '%s' not found in source query", role, name)
+	}
+
+	if settings.TimestampColumn == "" {
+		// Auto-detect timestamp column
+		if settings.TimestampColumn, err = s.DetectTimestampColumn(ctx, connection, mv.SourceQuery); err != nil {
+			return nil, nil, err
+		}
+	}
+	if settings.TimestampColumn, err = column(settings.TimestampColumn, "timestamp"); err != nil {
+		return nil, nil, err
+	}
+	// Fallback to "id" if no primary keys configured (common convention)
+	if len(settings.PrimaryKeys) == 0 {
+		settings.PrimaryKeys = []string{"id"}
+	}
+	for i, key := range settings.PrimaryKeys {
+		if settings.PrimaryKeys[i], err = column(key, "primary key"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if settings.DeletedColumn != "" {
+		if settings.DeletedColumn, err = column(settings.DeletedColumn, "deleted flag"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if settings.TombstoneTable != "" {
+		if settings.TombstoneTimestampColumn == "" {
+			settings.TombstoneTimestampColumn = "deleted_at"
+		}
+		dialect := mvDialect(connection.Type)
+		probe := fmt.Sprintf("SELECT %s, %s FROM %s WHERE 1=0",
+			quoteColumns(dialect, "", settings.PrimaryKeys),
+			quoteSourceColumn(dialect, settings.TombstoneTimestampColumn),
+			settings.TombstoneTable)
+		rows, err := db.QueryContext(ctx, probe)
+		if err != nil {
+			return nil, nil, fmt.Errorf("tombstone table must have the primary key columns and %s: %w", settings.TombstoneTimestampColumn, err)
+		}
+		rows.Close()
+	}
+
+	return &RefreshConfig{
+		TimestampColumn:          settings.TimestampColumn,
+		PrimaryKeys:              settings.PrimaryKeys,
+		Lookback:                 time.Duration(settings.LookbackSeconds) * time.Second,
+		DeletedColumn:            settings.DeletedColumn,
+		TombstoneTable:           settings.TombstoneTable,
+		TombstoneTimestampColumn: settings.TombstoneTimestampColumn,
+		Columns:                  columns,
+	}, &settings, nil
+}
+
+// queryColumns returns the columns of a query's result
+func queryColumns(ctx context.Context, db *sql.DB, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM (%s) mv_source WHERE 1=0", query))
+	if err != nil {
+		return nil, fmt.Errorf("invalid source query: %w", err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+	return columns, nil
+}
+
+// PerformIncrementalRefresh merges the rows changed since the last refresh,
+// less the lookback window, into the view by primary key, and removes the
+// rows deleted at the source, in one transaction
 func (s *IncrementalRefreshService) PerformIncrementalRefresh(
 	ctx context.Context,
 	connection *models.Connection,
@@ -39,7 +219,6 @@ func (s *IncrementalRefreshService) PerformIncrementalRefresh(
 	if err != nil {
 		return 0, fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
 	// Validate configuration
 	if config.TimestampColumn == "" {
@@ -49,167 +228,258 @@ func (s *IncrementalRefreshService) PerformIncrementalRefresh(
 		return 0, fmt.Errorf("primary keys are required for incremental refresh")
 	}
 
-	// Detect database type and use appropriate strategy
-	switch connection.Type {
-	case "postgres":
-		return s.refreshPostgresIncremental(ctx, db, mv, config)
-	case "mysql":
-		return s.refreshMySQLIncremental(ctx, db, mv, config)
-	case "sqlite":
-		return s.refreshSQLiteIncremental(ctx, db, mv, config)
-	default:
-		return s.refreshGenericIncremental(ctx, db, mv, config)
-	}
-}
+	dialect := mvDialect(connection.Type)
+	cutoff := mvCutoffArg(dialect, config.Since())
 
-// refreshPostgresIncremental performs incremental refresh for PostgreSQL
-func (s *IncrementalRefreshService) refreshPostgresIncremental(
-	ctx context.Context,
-	db *sql.DB,
-	mv *models.MaterializedView,
-	config RefreshConfig,
-) (int64, error) {
-	// Extract table name from source query (simplified - assumes SELECT FROM pattern)
-	sourceTable := s.extractSourceTable(mv.SourceQuery)
-	if sourceTable == "" {
-		return 0, fmt.Errorf("could not extract source table from query")
-	}
-
-	// Step 1: Find changed/new rows since last refresh
-	changedRowsQuery := fmt.Sprintf(
-		"WITH changed_data AS (%s WHERE %s > $1) "+
-			"DELETE FROM %s WHERE (%s) IN (SELECT %s FROM changed_data)",
-		mv.SourceQuery,
-		config.TimestampColumn,
-		mv.TargetTable,
-		strings.Join(config.PrimaryKeys, ", "),
-		strings.Join(config.PrimaryKeys, ", "),
-	)
-
-	// Execute delete of changed rows
-	deleteResult, err := db.ExecContext(ctx, changedRowsQuery, config.LastRefresh)
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete changed rows: %w", err)
+		return 0, err
 	}
-	deletedRows, _ := deleteResult.RowsAffected()
+	defer tx.Rollback()
 
-	// Step 2: Insert new/updated rows
-	insertQuery := fmt.Sprintf(
-		"INSERT INTO %s %s WHERE %s > $1",
-		mv.TargetTable,
-		mv.SourceQuery,
-		config.TimestampColumn,
-	)
+	var totalAffected int64
+	for _, statement := range mergeStatements(dialect, mv.TargetTable, mv.SourceQuery, config) {
+		result, err := tx.ExecContext(ctx, statement, cutoff)
+		if err != nil {
+			return 0, fmt.Errorf("failed to merge changed rows: %w", err)
+		}
+		affected, _ := result.RowsAffected()
+		totalAffected += affected
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return totalAffected, nil
+}
 
-	insertResult, err := db.ExecContext(ctx, insertQuery, config.LastRefresh)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert new rows: %w", err)
+// mergeStatements returns the statements applying the rows changed after a
+// cutoff to a view, each taking the cutoff as its only argument: removal of
+// soft-deleted and tombstoned keys, then an upsert of the other changed rows
+// (INSERT ... ON CONFLICT, REPLACE or MERGE, per dialect)
+func mergeStatements(dialect string, target string, source string, config RefreshConfig) []string {
+	q := func(name string) string { return quoteSourceColumn(dialect, name) }
+	param := mvPlaceholder(dialect)
+	keyMatch := func(left, right string) string {
+		conditions := make([]string, len(config.PrimaryKeys))
+		for i, key := range config.PrimaryKeys {
+			conditions[i] = fmt.Sprintf("%s.%s = %s.%s", left, q(key), right, q(key))
+		}
+		return strings.Join(conditions, " AND ")
+	}
+	changed := fmt.Sprintf("mv_delta.%s > %s", q(config.TimestampColumn), param)
+
+	var statements []string
+	if config.DeletedColumn != "" {
+		statements = append(statements, fmt.Sprintf(
+			"DELETE FROM %s WHERE EXISTS (SELECT 1 FROM (%s) mv_delta WHERE %s AND %s AND %s)",
+			target, source, keyMatch("mv_delta", target), changed, mvFlagSet(dialect, "mv_delta."+q(config.DeletedColumn)),
+		))
+		changed += " AND " + mvFlagUnset(dialect, "mv_delta."+q(config.DeletedColumn))
+	}
+	if config.TombstoneTable != "" {
+		statements = append(statements, fmt.Sprintf(
+			"DELETE FROM %s WHERE EXISTS (SELECT 1 FROM %s mv_tombstones WHERE %s AND mv_tombstones.%s > %s)",
+			target, config.TombstoneTable, keyMatch("mv_tombstones", target), q(config.TombstoneTimestampColumn), param,
+		))
 	}
-	insertedRows, _ := insertResult.RowsAffected()
 
-	return deletedRows + insertedRows, nil
+	isKey := make(map[string]bool, len(config.PrimaryKeys))
+	for _, key := range config.PrimaryKeys {
+		isKey[key] = true
+	}
+	var values []string
+	for _, col := range config.Columns {
+		if !isKey[col] {
+			values = append(values, col)
+		}
+	}
+	columns := quoteColumns(dialect, "", config.Columns)
+	delta := fmt.Sprintf("SELECT %s FROM (%s) mv_delta WHERE %s", quoteColumns(dialect, "mv_delta", config.Columns), source, changed)
+
+	switch dialect {
+	case "postgres", "sqlite":
+		action := "DO NOTHING"
+		if len(values) > 0 {
+			sets := make([]string, len(values))
+			for i, col := range values {
+				sets[i] = fmt.Sprintf("%s = EXCLUDED.%s", q(col), q(col))
+			}
+			action = "DO UPDATE SET " + strings.Join(sets, ", ")
+		}
+		statements = append(statements, fmt.Sprintf("INSERT INTO %s (%s) %s ON CONFLICT (%s) %s",
+			target, columns, delta, quoteColumns(dialect, "", config.PrimaryKeys), action))
+	case "mysql":
+		statements = append(statements, fmt.Sprintf("REPLACE INTO %s (%s) %s", target, columns, delta))
+	default:
+		merge := fmt.Sprintf("MERGE INTO %s mv_target USING (%s) mv_changes ON (%s)", target, delta, keyMatch("mv_target", "mv_changes"))
+		if len(values) > 0 {
+			sets := make([]string, len(values))
+			for i, col := range values {
+				sets[i] = fmt.Sprintf("mv_target.%s = mv_changes.%s", q(col), q(col))
+			}
+			merge += " WHEN MATCHED THEN UPDATE SET " + strings.Join(sets, ", ")
+		}
+		merge += fmt.Sprintf(" WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)", columns, quoteColumns(dialect, "mv_changes", config.Columns))
+		if dialect == "sqlserver" {
+			merge += ";"
+		}
+		statements = append(statements, merge)
+	}
+	return statements
 }
 
-// refreshMySQLIncremental performs incremental refresh for MySQL
-func (s *IncrementalRefreshService) refreshMySQLIncremental(
-	ctx context.Context,
-	db *sql.DB,
-	mv *models.MaterializedView,
-	config RefreshConfig,
-) (int64, error) {
-	// For MySQL, use REPLACE INTO which handles insert/update
-	// First, delete rows that might have been deleted from source
-	var totalAffected int64
+// quoteColumns returns a quoted column list, each column qualified by the
+// given table alias when it is not empty
+func quoteColumns(dialect string, alias string, columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteSourceColumn(dialect, col)
+		if alias != "" {
+			quoted[i] = alias + "." + quoted[i]
+		}
+	}
+	return strings.Join(quoted, ", ")
+}
 
-	// Step 1: Delete rows from MV that no longer exist in source
-	deleteQuery := fmt.Sprintf(
-		"DELETE FROM %s WHERE (%s) NOT IN (SELECT %s FROM (%s WHERE %s > ?) AS source_data)",
-		mv.TargetTable,
-		strings.Join(config.PrimaryKeys, ", "),
-		strings.Join(config.PrimaryKeys, ", "),
-		mv.SourceQuery,
-		config.TimestampColumn,
-	)
+// mvPlaceholder returns the first positional parameter of a dialect
+func mvPlaceholder(dialect string) string {
+	switch dialect {
+	case "postgres":
+		return "$1"
+	case "sqlserver":
+		return "@p1"
+	case "oracle":
+		return ":1"
+	default:
+		return "?"
+	}
+}
 
-	deleteResult, err := db.ExecContext(ctx, deleteQuery, config.LastRefresh)
-	if err == nil {
-		deletedRows, _ := deleteResult.RowsAffected()
-		totalAffected += deletedRows
+// mvCutoffArg binds a cutoff time. SQLite keeps timestamps as text, in UTC
+// as CURRENT_TIMESTAMP writes them.
+func mvCutoffArg(dialect string, cutoff time.Time) interface{} {
+	if dialect == "sqlite" {
+		return cutoff.UTC().Format("2006-01-02 15:04:05")
 	}
+	return cutoff
+}
 
-	// Step 2: Use REPLACE INTO for upsert (insert or update)
-	replaceQuery := fmt.Sprintf(
-		"REPLACE INTO %s %s WHERE %s > ?",
-		mv.TargetTable,
-		mv.SourceQuery,
-		config.TimestampColumn,
-	)
+// mvFlagSet and mvFlagUnset test a soft-delete flag. SQL Server and Oracle
+// have no boolean IS TRUE, so flags there are 1 or 0.
+func mvFlagSet(dialect string, column string) string {
+	if dialect == "sqlserver" || dialect == "oracle" {
+		return column + " = 1"
+	}
+	return column + " IS TRUE"
+}
 
-	replaceResult, err := db.ExecContext(ctx, replaceQuery, config.LastRefresh)
-	if err != nil {
-		return 0, fmt.Errorf("failed to replace rows: %w", err)
+func mvFlagUnset(dialect string, column string) string {
+	if dialect == "sqlserver" || dialect == "oracle" {
+		return fmt.Sprintf("(%s IS NULL OR %s <> 1)", column, column)
 	}
+	return column + " IS NOT TRUE"
+}
 
-	replacedRows, _ := replaceResult.RowsAffected()
-	totalAffected += replacedRows
+// liveQuery returns a view's source query without its soft-deleted rows
+func liveQuery(dialect string, source string, deletedColumn string) string {
+	if deletedColumn == "" {
+		return source
+	}
+	return fmt.Sprintf("SELECT * FROM (%s) mv_source WHERE %s", source, mvFlagUnset(dialect, "mv_source."+quoteSourceColumn(dialect, deletedColumn)))
+}
 
-	return totalAffected, nil
+// MVReconciliation compares a view with its source query
+type MVReconciliation struct {
+	SourceRows     int64  `json:"sourceRows"`
+	TargetRows     int64  `json:"targetRows"`
+	SourceChecksum string `json:"sourceChecksum"`
+	TargetChecksum string `json:"targetChecksum"`
 }
 
-// refreshSQLiteIncremental performs incremental refresh for SQLite
-func (s *IncrementalRefreshService) refreshSQLiteIncremental(
+// Drifted reports whether the view differs from its source
+func (r *MVReconciliation) Drifted() bool {
+	return r.SourceRows != r.TargetRows || r.SourceChecksum != r.TargetChecksum
+}
+
+// Reconcile counts and checksums the rows of a view and of its source query
+func (s *IncrementalRefreshService) Reconcile(
 	ctx context.Context,
-	db *sql.DB,
+	connection *models.Connection,
 	mv *models.MaterializedView,
 	config RefreshConfig,
-) (int64, error) {
-	var totalAffected int64
-
-	// Step 1: Delete old versions of changed rows
-	pkList := strings.Join(config.PrimaryKeys, ", ")
-	deleteQuery := fmt.Sprintf(
-		"DELETE FROM %s WHERE (%s) IN (SELECT %s FROM (%s) WHERE %s > ?)",
-		mv.TargetTable,
-		pkList,
-		pkList,
-		mv.SourceQuery,
-		config.TimestampColumn,
-	)
-
-	deleteResult, err := db.ExecContext(ctx, deleteQuery, config.LastRefresh)
+) (*MVReconciliation, error) {
+	db, err := s.executor.getConnection(connection)
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete changed rows: %w", err)
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
 	}
-	deletedRows, _ := deleteResult.RowsAffected()
-	totalAffected += deletedRows
+	dialect := mvDialect(connection.Type)
+	columns := quoteColumns(dialect, "", config.Columns)
 
-	// Step 2: Insert new rows
-	insertQuery := fmt.Sprintf(
-		"INSERT INTO %s %s WHERE %s > ?",
-		mv.TargetTable,
-		mv.SourceQuery,
-		config.TimestampColumn,
-	)
+	result := &MVReconciliation{}
+	source := fmt.Sprintf("SELECT %s FROM (%s) mv_source", columns, liveQuery(dialect, mv.SourceQuery, config.DeletedColumn))
+	if result.SourceRows, result.SourceChecksum, err = checksumRows(ctx, db, source); err != nil {
+		return nil, fmt.Errorf("failed to checksum source: %w", err)
+	}
+	target := fmt.Sprintf("SELECT %s FROM %s", columns, mv.TargetTable)
+	if result.TargetRows, result.TargetChecksum, err = checksumRows(ctx, db, target); err != nil {
+		return nil, fmt.Errorf("failed to checksum materialized view: %w", err)
+	}
+	return result, nil
+}
 
-	insertResult, err := db.ExecContext(ctx, insertQuery, config.LastRefresh)
+// checksumRows counts the rows of a query and sums a hash of each, so the
+// checksum does not depend on row order
+func checksumRows(ctx context.Context, db *sql.DB, query string) (int64, string, error) {
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert new rows: %w", err)
+		return 0, "", err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, "", err
 	}
-	insertedRows, _ := insertResult.RowsAffected()
-	totalAffected += insertedRows
 
-	return totalAffected, nil
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	var count int64
+	var sum uint64
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return 0, "", err
+		}
+		h := fnv.New64a()
+		for _, value := range values {
+			h.Write([]byte(checksumValue(value)))
+			h.Write([]byte{0x1f})
+		}
+		sum += h.Sum64()
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, "", err
+	}
+	return count, strconv.FormatUint(sum, 16), nil
 }
 
-// refreshGenericIncremental performs generic incremental refresh
-func (s *IncrementalRefreshService) refreshGenericIncremental(
-	ctx context.Context,
-	db *sql.DB,
-	mv *models.MaterializedView,
-	config RefreshConfig,
-) (int64, error) {
-	// Use SQLite strategy for generic databases
-	return s.refreshSQLiteIncremental(ctx, db, mv, config)
+// checksumValue renders a scanned value the same way whatever type the
+// driver returned it as
+func checksumValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "\x00"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
 }
 
 // ValidateIncrementalConfig validates that source query supports incremental refresh
@@ -223,7 +493,6 @@ func (s *IncrementalRefreshService) ValidateIncrementalConfig(
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
 	// Execute query with LIMIT 0 to get column metadata
 	testQuery := fmt.Sprintf("SELECT * FROM (%s) AS t LIMIT 0", sourceQuery)
@@ -265,7 +534,6 @@ func (s *IncrementalRefreshService) DetectTimestampColumn(
 	if err != nil {
 		return "", fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
 	// Execute query with LIMIT 0 to get column metadata
 	testQuery := fmt.Sprintf("SELECT * FROM (%s) AS t LIMIT 0", sourceQuery)
@@ -323,30 +591,6 @@ func (s *IncrementalRefreshService) DetectTimestampColumn(
 	return "", fmt.Errorf("no suitable timestamp column found in source query")
 }
 
-// extractSourceTable extracts the main source table from a SELECT query (simplified)
-func (s *IncrementalRefreshService) extractSourceTable(query string) string {
-	// This is a simplified extraction - in production, use a proper SQL parser
-	lowerQuery := strings.ToLower(query)
-	fromIndex := strings.Index(lowerQuery, "from")
-	if fromIndex == -1 {
-		return ""
-	}
-
-	// Extract text after FROM
-	afterFrom := strings.TrimSpace(query[fromIndex+4:])
-
-	// Find the first space or WHERE/JOIN keyword
-	endIndex := len(afterFrom)
-	for i, keywords := range []string{" ", "where", "join", "group", "order", "limit"} {
-		if idx := strings.Index(strings.ToLower(afterFrom), keywords); idx != -1 && (i == 0 || idx < endIndex) {
-			endIndex = idx
-		}
-	}
-
-	tableName := strings.TrimSpace(afterFrom[:endIndex])
-	return tableName
-}
-
 // GetDeltaStats returns statistics about the delta since last refresh
 func (s *IncrementalRefreshService) GetDeltaStats(
 	ctx context.Context,
@@ -359,7 +603,6 @@ func (s *IncrementalRefreshService) GetDeltaStats(
 	if err != nil {
 		return 0, fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
 	// Count rows changed since last refresh
 	countQuery := fmt.Sprintf(
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIncrementalSettings(t *testing.T) {
+	settings, err := ParseIncrementalSettings(map[string]interface{}{
+		"primary_keys":     []interface{}{"id"},
+		"lookback_seconds": float64(600),
+		"tombstone_table":  "audit.deleted_orders",
+		"custom":           "kept",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id"}, settings.PrimaryKeys)
+	assert.Equal(t, int64(600), settings.LookbackSeconds)
+
+	stored, err := settings.Store(map[string]interface{}{"custom": "kept"})
+	require.NoError(t, err)
+	assert.Equal(t, "kept", stored["custom"])
+	assert.Equal(t, "audit.deleted_orders", stored["tombstone_table"])
+
+	for _, bad := range []map[string]interface{}{
+		{"lookback_seconds": -1},
+		{"reconcile_every": -2},
+		{"tombstone_table": "orders; DROP TABLE orders"},
+		{"primary_keys": "id"},
+	} {
+		_, err := ParseIncrementalSettings(bad)
+		assert.Error(t, err, "%v", bad)
+	}
+}
+
+func TestMergeStatements(t *testing.T) {
+	config := RefreshConfig{
+		TimestampColumn: "updated_at",
+		PrimaryKeys:     []string{"id"},
+		DeletedColumn:   "deleted",
+		TombstoneTable:  "order_tombstones", TombstoneTimestampColumn: "deleted_at",
+		Columns: []string{"id", "amount", "updated_at", "deleted"},
+	}
+
+	statements := mergeStatements("postgres", "mv_orders", "SELECT * FROM orders", config)
+	require.Len(t, statements, 3)
+	assert.Equal(t, `DELETE FROM mv_orders WHERE EXISTS (SELECT 1 FROM (SELECT * FROM orders) mv_delta WHERE mv_delta."id" = mv_orders."id" AND mv_delta."updated_at" > $1 AND mv_delta."deleted" IS TRUE)`, statements[0])
+	assert.Equal(t, `DELETE FROM mv_orders WHERE EXISTS (SELECT 1 FROM order_tombstones mv_tombstones WHERE mv_tombstones."id" = mv_orders."id" AND mv_tombstones."deleted_at" > $1)`, statements[1])
+	assert.Equal(t, `INSERT INTO mv_orders ("id", "amount", "updated_at", "deleted") SELECT mv_delta."id", mv_delta."amount", mv_delta."updated_at", mv_delta."deleted" FROM (SELECT * FROM orders) mv_delta `+
+		`WHERE mv_delta."updated_at" > $1 AND mv_delta."deleted" IS NOT TRUE ON CONFLICT ("id") DO UPDATE SET "amount" = EXCLUDED."amount", "updated_at" = EXCLUDED."updated_at", "deleted" = EXCLUDED."deleted"`, statements[2])
+
+	config.DeletedColumn, config.TombstoneTable = "", ""
+	statements = mergeStatements("mysql", "mv_orders", "SELECT * FROM orders", config)
+	require.Len(t, statements, 1)
+	assert.Equal(t, "REPLACE INTO mv_orders (`id`, `amount`, `updated_at`, `deleted`) SELECT mv_delta.`id`, mv_delta.`amount`, mv_delta.`updated_at`, mv_delta.`deleted` FROM (SELECT * FROM orders) mv_delta WHERE mv_delta.`updated_at` > ?", statements[0])
+
+	statements = mergeStatements("sqlserver", "mv_orders", "SELECT * FROM orders", config)
+	require.Len(t, statements, 1)
+	assert.Contains(t, statements[0], "MERGE INTO mv_orders mv_target USING (SELECT ")
+	assert.Contains(t, statements[0], "WHERE mv_delta.[updated_at] > @p1) mv_changes ON (mv_target.[id] = mv_changes.[id])")
+	assert.Contains(t, statements[0], "WHEN MATCHED THEN UPDATE SET mv_target.[amount] = mv_changes.[amount]")
+	assert.Contains(t, statements[0], "WHEN NOT MATCHED THEN INSERT ([id], [amount], [updated_at], [deleted]) VALUES (mv_changes.[id], mv_changes.[amount], mv_changes.[updated_at], mv_changes.[deleted]);")
+}
+
+func TestMaterializedViewService_IncrementalMerge(t *testing.T) {
+	svc, db, source, conn := setupMVTest(t)
+	ctx := context.Background()
+	stamp := func(at time.Time) string { return at.UTC().Format("2006-01-02 15:04:05") }
+	old := stamp(time.Now().Add(-24 * time.Hour))
+
+	_, err := source.Exec(`CREATE TABLE accounts (id INTEGER, balance INTEGER, updated_at TEXT, deleted INTEGER)`)
+	require.NoError(t, err)
+	_, err = source.Exec(`INSERT INTO accounts VALUES (1, 10, ?, 0), (2, 20, ?, 0), (3, 30, ?, 0)`, old, old, old)
+	require.NoError(t, err)
+	_, err = source.Exec(`CREATE TABLE account_tombstones (id INTEGER, deleted_at TEXT)`)
+	require.NoError(t, err)
+
+	// Settings naming no existing column are refused
+	_, err = svc.CreateMaterializedView(ctx, "u1", conn.ID, "Broken", "SELECT * FROM accounts", "incremental", "",
+		map[string]interface{}{"primary_keys": []interface{}{"account_id"}, "timestamp_column": "updated_at"})
+	require.ErrorContains(t, err, "primary key column 'account_id' not found")
+	var count int64
+	db.Model(&models.MaterializedView{}).Count(&count)
+	assert.Zero(t, count)
+
+	mv, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Accounts", "SELECT * FROM accounts", "incremental", "", map[string]interface{}{
+		"primary_keys":     []interface{}{"ID"},
+		"timestamp_column": "Updated_At",
+		"lookback_seconds": 3600,
+		"deleted_column":   "deleted",
+		"tombstone_table":  "account_tombstones",
+		"reconcile_every":  2,
+	})
+	require.NoError(t, err)
+	waitForViews(t, db)
+	mv, err = svc.GetMaterializedView(mv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), mv.RowCount)
+	assert.Equal(t, []interface{}{"id"}, mv.Metadata["primary_keys"], "settings are stored as the query spells the columns")
+	assert.Equal(t, "updated_at", mv.Metadata["timestamp_column"])
+
+	// Row 2 changes, row 3 is soft-deleted, row 1 is deleted with a
+	// tombstone, row 4 is new and row 5 arrives late, stamped before the
+	// last refresh but within the lookback window
+	now := stamp(time.Now())
+	_, err = source.Exec(`UPDATE accounts SET balance = 21, updated_at = ? WHERE id = 2`, now)
+	require.NoError(t, err)
+	_, err = source.Exec(`UPDATE accounts SET deleted = 1, updated_at = ? WHERE id = 3`, now)
+	require.NoError(t, err)
+	_, err = source.Exec(`DELETE FROM accounts WHERE id = 1`)
+	require.NoError(t, err)
+	_, err = source.Exec(`INSERT INTO account_tombstones VALUES (1, ?)`, now)
+	require.NoError(t, err)
+	_, err = source.Exec(`INSERT INTO accounts VALUES (4, 40, ?, 0), (5, 50, ?, 0)`, now, stamp(mv.LastRefresh.Add(-10*time.Minute)))
+	require.NoError(t, err)
+
+	balances := func() map[int64]int64 {
+		rows, err := source.Query(`SELECT id, balance FROM ` + mv.TargetTable)
+		require.NoError(t, err)
+		defer rows.Close()
+		got := make(map[int64]int64)
+		for rows.Next() {
+			var id, balance int64
+			require.NoError(t, rows.Scan(&id, &balance))
+			_, duplicate := got[id]
+			require.False(t, duplicate, "row %d is stored twice", id)
+			got[id] = balance
+		}
+		return got
+	}
+
+	// The second refresh merges, then reconciles without finding drift
+	require.NoError(t, svc.RefreshMaterializedView(ctx, mv.ID))
+	waitForViews(t, db)
+	assert.Equal(t, map[int64]int64{2: 21, 4: 40, 5: 50}, balances())
+	history, err := svc.GetRefreshHistory(mv.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "success", history[0].Status)
+	assert.Equal(t, "incremental", history[0].RefreshMode)
+	assert.Equal(t, int64(5), history[0].RowsAffected, "one soft delete, one tombstone and three upserts")
+	assert.True(t, history[0].Reconciled)
+	assert.False(t, history[0].Drift)
+	assert.Equal(t, int64(3), history[0].SourceRows)
+	assert.Equal(t, history[0].SourceChecksum, history[0].TargetChecksum)
+	mv, err = svc.GetMaterializedView(mv.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), mv.RowCount)
+	require.NotNil(t, history[0].CompletedAt)
+	assert.True(t, mv.LastRefresh.Before(*history[0].CompletedAt), "the next cutoff is the refresh's start")
+
+	// A change stamped before the lookback window is missed by merges...
+	_, err = source.Exec(`UPDATE accounts SET balance = 41, updated_at = ? WHERE id = 4`, old)
+	require.NoError(t, err)
+	require.NoError(t, svc.RefreshMaterializedView(ctx, mv.ID))
+	waitForViews(t, db)
+	assert.Equal(t, int64(40), balances()[4])
+	history, err = svc.GetRefreshHistory(mv.ID, 1)
+	require.NoError(t, err)
+	assert.False(t, history[0].Reconciled)
+
+	// ...and repaired by the next reconciliation
+	require.NoError(t, svc.RefreshMaterializedView(ctx, mv.ID))
+	waitForViews(t, db)
+	assert.Equal(t, map[int64]int64{2: 21, 4: 41, 5: 50}, balances())
+	history, err = svc.GetRefreshHistory(mv.ID, 1)
+	require.NoError(t, err)
+	assert.True(t, history[0].Reconciled)
+	assert.True(t, history[0].Drift)
+	assert.Equal(t, history[0].SourceRows, history[0].TargetRows)
+	assert.NotEqual(t, history[0].SourceChecksum, history[0].TargetChecksum)
+}
+
+func TestMaterializedViewService_UpgradesLegacyIncrementalView(t *testing.T) {
+	svc, db, source, conn := setupMVTest(t)
+	ctx := context.Background()
+	_, err := source.Exec(`ALTER TABLE orders ADD COLUMN updated_at TEXT`)
+	require.NoError(t, err)
+
+	mv, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Orders", "SELECT * FROM orders", "incremental", "",
+		map[string]interface{}{"timestamp_column": "updated_at"})
+	require.NoError(t, err)
+	waitForViews(t, db)
+
+	// A view from before merges has no key index, and rows merged twice
+	_, err = source.Exec(`DROP INDEX ` + mv.TargetTable + `_key`)
+	require.NoError(t, err)
+	_, err = source.Exec(`INSERT INTO ` + mv.TargetTable + ` SELECT * FROM orders WHERE id = 1`)
+	require.NoError(t, err)
+
+	require.NoError(t, svc.RefreshMaterializedView(ctx, mv.ID))
+	waitForViews(t, db)
+	history, err := svc.GetRefreshHistory(mv.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "success", history[0].Status)
+	var rows, indexes int
+	require.NoError(t, source.QueryRow(`SELECT COUNT(*) FROM `+mv.TargetTable).Scan(&rows))
+	assert.Equal(t, 3, rows, "the view is rebuilt without the duplicates")
+	require.NoError(t, source.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?`, mv.TargetTable+"_key").Scan(&indexes))
+	assert.Equal(t, 1, indexes)
+}
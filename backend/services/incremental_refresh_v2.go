@@ -33,7 +33,7 @@ type PipelineWatermark struct {
 	ID           string    `gorm:"primaryKey" json:"id"`
 	PipelineID   string    `gorm:"uniqueIndex;not null" json:"pipelineId"`
 	ColumnName   string    `gorm:"not null" json:"columnName"` // e.g. "updated_at", "id"
-	ColumnType   string    `gorm:"not null" json:"columnType"` // timestamp, integer, string
+	ColumnType   string    `gorm:"not null" json:"columnType"` // timestamp, integer, string, lsn
 	LastValue    string    `json:"lastValue"`                  // serialized high-water mark
 	RowsLastSync int64     `json:"rowsLastSync"`
 	LastSyncAt   time.Time `json:"lastSyncAt"`
@@ -110,8 +110,17 @@ func (s *IncrementalRefreshV2Service) UpdateWatermark(ctx context.Context, wm *P
 
 	wm.UpdatedAt = time.Now()
 	wm.LastSyncAt = time.Now()
+	return upsertWatermark(ctx, s.db, wm)
+}
+
+// watermarkExecer is a *sql.DB, or a *sql.Tx to store a watermark together
+// with the rows it covers
+type watermarkExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
 
-	_, err := s.db.ExecContext(ctx,
+func upsertWatermark(ctx context.Context, db watermarkExecer, wm *PipelineWatermark) error {
+	_, err := db.ExecContext(ctx,
 		`INSERT INTO pipeline_watermarks (id, pipeline_id, column_name, column_type, last_value, rows_last_sync, last_sync_at, created_at, updated_at)
 		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		 ON CONFLICT (pipeline_id) DO UPDATE SET
@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"insight-engine-backend/database"
 	"insight-engine-backend/models"
@@ -17,13 +18,14 @@ type JobType string
 const (
 	JobTypePipeline JobType = "PIPELINE"
 	JobTypeDataflow JobType = "DATAFLOW"
+	JobTypeBackfill JobType = "BACKFILL"
 )
 
 // Job represents a background job
 type Job struct {
 	ID        string
 	Type      JobType
-	EntityID  string // Pipeline ID or Dataflow ID
+	EntityID  string // Pipeline ID (pipelines, backfills) or Dataflow ID
 	CreatedAt time.Time
 	Retries   int
 }
@@ -36,6 +38,9 @@ type JobQueue struct {
 	workers    int
 	ctx        context.Context
 	cancel     context.CancelFunc
+	running    map[string]context.CancelFunc // job ID -> cancel of the running job
+	dataflows  *DataflowExecutor
+	onPipeline func(execution *models.JobExecution) // called after a pipeline execution completes
 }
 
 // NewJobQueue creates a new job queue
@@ -46,9 +51,42 @@ func NewJobQueue(maxWorkers int) *JobQueue {
 		maxWorkers: maxWorkers,
 		ctx:        ctx,
 		cancel:     cancel,
+		running:    make(map[string]context.CancelFunc),
 	}
 }
 
+// SetDataflowExecutor sets the executor that runs dataflow jobs
+func (jq *JobQueue) SetDataflowExecutor(executor *DataflowExecutor) {
+	jq.dataflows = executor
+}
+
+// SetPipelineCompletionListener registers a callback invoked after each
+// successful pipeline execution
+func (jq *JobQueue) SetPipelineCompletionListener(fn func(execution *models.JobExecution)) {
+	jq.onPipeline = fn
+}
+
+// Cancel removes a queued job or cancels a running one. It reports whether
+// the job was found.
+func (jq *JobQueue) Cancel(jobID string) bool {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+
+	for element := jq.queue.Front(); element != nil; element = element.Next() {
+		if element.Value.(Job).ID == jobID {
+			jq.queue.Remove(element)
+			LogInfo("job_cancel", "Queued job cancelled", map[string]interface{}{"job_id": jobID})
+			return true
+		}
+	}
+	if cancel, ok := jq.running[jobID]; ok {
+		cancel()
+		LogInfo("job_cancel", "Running job cancelled", map[string]interface{}{"job_id": jobID})
+		return true
+	}
+	return false
+}
+
 // Enqueue adds a job to the queue
 func (jq *JobQueue) Enqueue(job Job) {
 	jq.mu.Lock()
@@ -107,10 +145,13 @@ func (jq *JobQueue) worker(id int) {
 
 			LogInfo("job_process_start", "Worker processing job", map[string]interface{}{"worker_id": id, "job_id": job.ID, "job_type": job.Type})
 
-			if err := jq.processJob(job); err != nil {
+			if err := jq.runJob(job); err != nil {
 				LogError("job_process_failed", "Worker failed to process job", map[string]interface{}{"worker_id": id, "job_id": job.ID, "error": err})
 
-				// Retry logic
+				// Retry logic; cancelled jobs stay cancelled
+				if errors.Is(err, context.Canceled) {
+					continue
+				}
 				if job.Retries < 3 {
 					job.Retries++
 					LogInfo("job_retry", "Retrying job", map[string]interface{}{"job_id": job.ID, "attempt": job.Retries, "max_retries": 3})
@@ -127,25 +168,42 @@ func (jq *JobQueue) worker(id int) {
 	}
 }
 
+// runJob processes a job with a context that Cancel can cancel
+func (jq *JobQueue) runJob(job *Job) error {
+	ctx, cancel := context.WithCancel(jq.ctx)
+	jq.mu.Lock()
+	jq.running[job.ID] = cancel
+	jq.mu.Unlock()
+
+	defer func() {
+		jq.mu.Lock()
+		delete(jq.running, job.ID)
+		jq.mu.Unlock()
+		cancel()
+	}()
+	return jq.processJob(ctx, job)
+}
+
 // processJob executes the job based on its type
-func (jq *JobQueue) processJob(job *Job) error {
+func (jq *JobQueue) processJob(ctx context.Context, job *Job) error {
 	switch job.Type {
 	case JobTypePipeline:
-		return jq.processPipeline(job.EntityID)
+		return jq.processPipeline(job)
 	case JobTypeDataflow:
-		return jq.processDataflow(job.EntityID)
+		return jq.processDataflow(ctx, job.ID)
+	case JobTypeBackfill:
+		return jq.processBackfill(ctx, job.ID)
 	default:
 		return fmt.Errorf("unknown job type: %s", job.Type)
 	}
 }
 
-// processPipeline executes a pipeline using the real PipelineExecutor
-func (jq *JobQueue) processPipeline(pipelineID string) error {
-	// Find the PENDING execution record
+// processPipeline executes a pipeline using the real PipelineExecutor. The
+// job ID is the execution ID, so concurrent runs of a pipeline stay apart.
+func (jq *JobQueue) processPipeline(job *Job) error {
+	pipelineID := job.EntityID
 	var execution models.JobExecution
-	if err := database.DB.Where("pipeline_id = ? AND status = ?", pipelineID, "PENDING").
-		Order("started_at DESC").
-		First(&execution).Error; err != nil {
+	if err := database.DB.Where("id = ?", job.ID).First(&execution).Error; err != nil {
 		return fmt.Errorf("execution not found: %w", err)
 	}
 
@@ -202,45 +260,47 @@ func (jq *JobQueue) processPipeline(pipelineID string) error {
 	LogInfo("pipeline_execution_complete", fmt.Sprintf("Pipeline %s execution %s: %s (%d rows, %dms)",
 		pipelineID, execution.ID, execution.Status, result.RowsProcessed, result.DurationMs), nil)
 
+	if result.Error == nil && jq.onPipeline != nil {
+		jq.onPipeline(&execution)
+	}
+
 	return result.Error
 }
 
-// processDataflow executes a dataflow
-func (jq *JobQueue) processDataflow(dataflowID string) error {
-	// Find the run record
+// processDataflow executes a dataflow run (the job ID is the run ID). Step
+// failures are recorded on the run and retried from the failed step on
+// request, so only a run that could not be started is returned as an error.
+func (jq *JobQueue) processDataflow(ctx context.Context, runID string) error {
 	var run models.DataflowRun
-	if err := database.DB.Where("dataflow_id = ? AND status = ?", dataflowID, "PENDING").
-		Order("started_at DESC").
-		First(&run).Error; err != nil {
+	if err := database.DB.Where("id = ?", runID).First(&run).Error; err != nil {
 		return fmt.Errorf("run not found: %w", err)
 	}
-
-	// Update status to RUNNING
-	run.Status = "RUNNING"
-	database.DB.Save(&run)
-
-	// NOTE: Actual dataflow execution logic is business-specific and depends on
-	// the dataflow configuration. This would typically:
-	// 1. Load dataflow nodes and edges from database
-	// 2. Execute nodes in topological order based on dependencies
-	// 3. Pass data between nodes according to edge configuration
-	// 4. Handle transformations, aggregations, and joins
-	// 5. Update run metadata with node-level execution details
-	//
-	// For now, this is a placeholder that simulates successful execution.
-	// Production implementation should integrate with DataflowExecutor service.
-	time.Sleep(2 * time.Second)
-
-	// Update run record
-	now := time.Now()
-	run.Status = "COMPLETED"
-	run.CompletedAt = &now
-
-	if err := database.DB.Save(&run).Error; err != nil {
-		return fmt.Errorf("failed to update run: %w", err)
+	if run.Status != "PENDING" {
+		// Cancelled before a worker picked it up
+		return nil
 	}
+	if jq.dataflows == nil {
+		return fmt.Errorf("dataflow executor not configured")
+	}
+	return jq.dataflows.Run(ctx, &run)
+}
 
-	return nil
+// processBackfill runs a pipeline backfill (the job ID is the backfill ID).
+// Chunk failures are recorded on the backfill and resumed on request, so
+// only a backfill that could not be started is returned as an error.
+func (jq *JobQueue) processBackfill(ctx context.Context, backfillID string) error {
+	var backfill models.PipelineBackfill
+	if err := database.DB.Where("id = ?", backfillID).First(&backfill).Error; err != nil {
+		return fmt.Errorf("backfill not found: %w", err)
+	}
+	if backfill.Status != "PENDING" {
+		// Cancelled before a worker picked it up
+		return nil
+	}
+	if GlobalPipelineExecutor == nil {
+		InitPipelineExecutor()
+	}
+	return GlobalPipelineExecutor.RunBackfill(ctx, &backfill)
 }
 
 // markJobFailed marks a job as failed in the database
@@ -250,8 +310,7 @@ func (jq *JobQueue) markJobFailed(job *Job, err error) {
 	switch job.Type {
 	case JobTypePipeline:
 		var execution models.JobExecution
-		if dbErr := database.DB.Where("pipeline_id = ? AND status IN ?", job.EntityID, []string{"PENDING", "PROCESSING"}).
-			Order("started_at DESC").
+		if dbErr := database.DB.Where("id = ? AND status IN ?", job.ID, []string{"PENDING", "PROCESSING", "FAILED"}).
 			First(&execution).Error; dbErr == nil {
 			now := time.Now()
 			execution.Status = "FAILED"
@@ -268,8 +327,7 @@ func (jq *JobQueue) markJobFailed(job *Job, err error) {
 
 	case JobTypeDataflow:
 		var run models.DataflowRun
-		if dbErr := database.DB.Where("dataflow_id = ? AND status IN ?", job.EntityID, []string{"PENDING", "RUNNING"}).
-			Order("started_at DESC").
+		if dbErr := database.DB.Where("id = ? AND status IN ?", job.ID, []string{"PENDING", "RUNNING"}).
 			First(&run).Error; dbErr == nil {
 			now := time.Now()
 			run.Status = "FAILED"
@@ -277,6 +335,11 @@ func (jq *JobQueue) markJobFailed(job *Job, err error) {
 			run.Error = &errorMsg
 			database.DB.Save(&run)
 		}
+
+	case JobTypeBackfill:
+		database.DB.Model(&models.PipelineBackfill{}).
+			Where("id = ? AND status IN ?", job.ID, []string{"PENDING", "RUNNING"}).
+			Updates(map[string]interface{}{"status": "FAILED", "error": errorMsg, "finished_at": time.Now()})
 	}
 }
 
@@ -385,6 +385,223 @@ func (imp *JSONImporter) ImportJSON(
 	return result, nil
 }
 
+// ReadJSONRows reads every record of a JSON file: the array at RootPath, the
+// root array, the first array property of the root object, or the root object
+// as a single record. Nested objects are flattened when requested.
+func (imp *JSONImporter) ReadJSONRows(
+	ctx context.Context,
+	r io.Reader,
+	options *JSONImportOptions,
+) ([]map[string]interface{}, error) {
+	reader, err := imp.newJSONRowReader(r, options)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	for {
+		batch, err := reader.next(ctx, 1000)
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, batch...)
+	}
+}
+
+// jsonRowReader reads the records of a JSON document a batch at a time,
+// decoding the record array one element at a time. The first array property
+// is the first in document order; objects before it are read whole.
+type jsonRowReader struct {
+	imp     *JSONImporter
+	decoder *json.Decoder
+	options *JSONImportOptions
+	inArray bool                     // the decoder is positioned inside the record array
+	pending []map[string]interface{} // records found without streaming
+	read    int
+}
+
+func (imp *JSONImporter) newJSONRowReader(r io.Reader, options *JSONImportOptions) (*jsonRowReader, error) {
+	if options == nil {
+		options = imp.GetDefaultOptions()
+	}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	jr := &jsonRowReader{imp: imp, decoder: decoder, options: options}
+
+	if options.RootPath != "" {
+		for _, part := range strings.Split(options.RootPath, ".") {
+			if err := jr.enterProperty(part); err != nil {
+				return nil, fmt.Errorf("failed to navigate to root path: %w", err)
+			}
+		}
+	}
+	if err := jr.open(); err != nil {
+		return nil, err
+	}
+	return jr, nil
+}
+
+// enterProperty positions the decoder at the value of a property of the
+// object it is at
+func (jr *jsonRowReader) enterProperty(name string) error {
+	tok, err := jr.decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("cannot navigate path at: %s", name)
+	}
+	for jr.decoder.More() {
+		key, err := jr.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if key == name {
+			return nil
+		}
+		var skipped json.RawMessage
+		if err := jr.decoder.Decode(&skipped); err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	}
+	return fmt.Errorf("path not found: %s", name)
+}
+
+// open finds the records of the value the decoder is at
+func (jr *jsonRowReader) open() error {
+	tok, err := jr.decoder.Token()
+	if err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if tok == json.Delim('[') {
+		jr.inArray = true
+		return nil
+	}
+	if tok != json.Delim('{') {
+		return errors.New("unsupported JSON structure: expected array or object")
+	}
+
+	obj := make(map[string]interface{})
+	for jr.decoder.More() {
+		key, err := jr.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		valueTok, err := jr.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if valueTok == json.Delim('[') && jr.decoder.More() {
+			jr.inArray = true
+			return nil
+		}
+		value, err := jr.readValue(valueTok)
+		if err != nil {
+			return err
+		}
+		obj[key.(string)] = value
+	}
+
+	// No array property; look one level deeper, else the object is the record
+	if arrayData, _ := jr.imp.findArrayProperty(obj); arrayData != nil {
+		jr.pending = jr.imp.convertArrayToMaps(arrayData, jr.options.MaxRows)
+	} else {
+		jr.pending = []map[string]interface{}{obj}
+	}
+	return nil
+}
+
+// readValue reads the rest of a value whose first token has been read
+func (jr *jsonRowReader) readValue(tok json.Token) (interface{}, error) {
+	switch tok {
+	case json.Delim('{'):
+		obj := make(map[string]interface{})
+		for jr.decoder.More() {
+			key, err := jr.decoder.Token()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse JSON: %w", err)
+			}
+			var value interface{}
+			if err := jr.decoder.Decode(&value); err != nil {
+				return nil, fmt.Errorf("failed to parse JSON: %w", err)
+			}
+			obj[key.(string)] = value
+		}
+		_, err := jr.decoder.Token() // }
+		return obj, err
+	case json.Delim('['):
+		arr := []interface{}{}
+		for jr.decoder.More() {
+			var value interface{}
+			if err := jr.decoder.Decode(&value); err != nil {
+				return nil, fmt.Errorf("failed to parse JSON: %w", err)
+			}
+			arr = append(arr, value)
+		}
+		_, err := jr.decoder.Token() // ]
+		return arr, err
+	}
+	return tok, nil
+}
+
+// next returns up to n records, or io.EOF after the last
+func (jr *jsonRowReader) next(ctx context.Context, n int) ([]map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	for len(rows) < n && (jr.options.MaxRows <= 0 || jr.read < jr.options.MaxRows) {
+		if len(jr.pending) > 0 {
+			rows = append(rows, jr.pending[0])
+			jr.pending = jr.pending[1:]
+			jr.read++
+			continue
+		}
+		if !jr.inArray || !jr.decoder.More() {
+			break
+		}
+		var element interface{}
+		if err := jr.decoder.Decode(&element); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if obj, ok := element.(map[string]interface{}); ok {
+			rows = append(rows, obj)
+			jr.read++
+		}
+	}
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+
+	if jr.options.FlattenNested {
+		rows = jr.imp.flattenRows(rows, jr.options.MaxDepth, jr.options.ArrayStrategy)
+	}
+	for _, row := range rows {
+		for key, value := range row {
+			row[key] = jsonNumberValue(value)
+		}
+	}
+	return rows, nil
+}
+
+// jsonNumberValue converts a decoded json.Number to int64 when it is whole
+// and float64 otherwise
+func jsonNumberValue(value interface{}) interface{} {
+	n, ok := value.(json.Number)
+	if !ok {
+		return value
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return n.String()
+}
+
 // ValidateJSONFile validates JSON file before import
 func (imp *JSONImporter) ValidateJSONFile(fileHeader *multipart.FileHeader) error {
 	// Check file size
@@ -0,0 +1,671 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// ============================================================
+// KPI Evaluation Engine
+// Resolves KPI metrics through the semantic layer, stores actual
+// vs target history, and rolls statuses up the KPI tree
+// ============================================================
+
+// SemanticKPITarget is a target that applies from EffectiveFrom until the next target starts
+type SemanticKPITarget struct {
+	ID                string    `gorm:"primaryKey" json:"id"`
+	KPIID             string    `gorm:"not null;index" json:"kpiId"`
+	EffectiveFrom     time.Time `gorm:"not null;index" json:"effectiveFrom"`
+	TargetValue       float64   `json:"targetValue"`
+	WarningThreshold  *float64  `json:"warningThreshold,omitempty"`
+	CriticalThreshold *float64  `json:"criticalThreshold,omitempty"`
+	Source            string    `gorm:"default:'manual'" json:"source"` // manual | table
+	CreatedAt         time.Time `json:"createdAt"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+func (SemanticKPITarget) TableName() string { return "semantic_kpi_targets" }
+
+// SemanticKPISnapshot is one evaluated point of a KPI's actual vs target time series
+type SemanticKPISnapshot struct {
+	ID          string    `gorm:"primaryKey" json:"id"`
+	KPIID       string    `gorm:"not null;index:idx_kpi_snapshot_period" json:"kpiId"`
+	PeriodStart time.Time `gorm:"index:idx_kpi_snapshot_period" json:"periodStart"`
+	PeriodEnd   time.Time `json:"periodEnd"`
+	ActualValue float64   `json:"actualValue"`
+	TargetValue *float64  `json:"targetValue,omitempty"`
+	PctOfTarget float64   `json:"pctOfTarget"`
+	Status      string    `json:"status"`
+	Trend       string    `json:"trend"`
+	TrendPct    float64   `json:"trendPct"`
+	EvaluatedAt time.Time `json:"evaluatedAt"`
+}
+
+func (SemanticKPISnapshot) TableName() string { return "semantic_kpi_snapshots" }
+
+// KPIScorecardNode is one KPI in a scorecard tree with its own and rolled-up status
+type KPIScorecardNode struct {
+	KPI          *SemanticKPI         `json:"kpi"`
+	Latest       *SemanticKPISnapshot `json:"latest,omitempty"`
+	Status       string               `json:"status"`       // the KPI's own latest status
+	RollupStatus string               `json:"rollupStatus"` // status including all descendants
+	RollupScore  float64              `json:"rollupScore"`  // 0 (critical) .. 1 (on track)
+	Children     []*KPIScorecardNode  `json:"children,omitempty"`
+}
+
+// KPIScorecard is the scorecard for all KPIs of a semantic model
+type KPIScorecard struct {
+	ModelID     string              `json:"modelId"`
+	GeneratedAt time.Time           `json:"generatedAt"`
+	Roots       []*KPIScorecardNode `json:"roots"`
+	Counts      map[string]int      `json:"counts"` // rollup status → number of root KPIs
+}
+
+// KPIService evaluates KPIs against live data
+type KPIService struct {
+	db            *gorm.DB
+	semanticV2    *SemanticLayerV2Service
+	queryExecutor QueryExecutorInterface
+	rlsService    *RLSService
+}
+
+// NewKPIService creates a new KPI evaluation service
+func NewKPIService(db *gorm.DB, semanticV2 *SemanticLayerV2Service, queryExecutor QueryExecutorInterface, rlsService *RLSService) *KPIService {
+	return &KPIService{
+		db:            db,
+		semanticV2:    semanticV2,
+		queryExecutor: queryExecutor,
+		rlsService:    rlsService,
+	}
+}
+
+// ---- Evaluation ----
+
+// EvaluateKPI resolves the KPI's metric for the current period, as the user
+// sees it, and stores a snapshot
+func (s *KPIService) EvaluateKPI(ctx context.Context, kpiID string, at time.Time, userCtx models.UserContext) (*SemanticKPISnapshot, error) {
+	kpi, err := s.semanticV2.GetKPI(kpiID)
+	if err != nil {
+		return nil, fmt.Errorf("KPI not found: %w", err)
+	}
+
+	cal, err := s.semanticV2.CalendarForModel(kpi.ModelID)
+	if err != nil {
+		LogWarn("kpi_calendar", "Falling back to the Gregorian calendar", map[string]interface{}{"kpi_id": kpi.ID, "error": err.Error()})
+		cal = nil
+	}
+	periodStart, periodEnd, err := kpiPeriodBounds(cal, TimeGrain(kpi.TrendPeriod), at)
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := s.ResolveMetricValue(ctx, kpi, periodStart, periodEnd, userCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Targets may vary over time, so evaluate against the one in effect for this period
+	effective := *kpi
+	target, err := s.TargetAt(kpi.ID, periodStart)
+	if err != nil {
+		return nil, err
+	}
+	if target != nil {
+		effective.TargetValue = &target.TargetValue
+		if target.WarningThreshold != nil {
+			effective.WarningThreshold = target.WarningThreshold
+		}
+		if target.CriticalThreshold != nil {
+			effective.CriticalThreshold = target.CriticalThreshold
+		}
+	}
+
+	var previous *float64
+	var prev SemanticKPISnapshot
+	err = s.db.Where("kpi_id = ? AND period_start < ?", kpi.ID, periodStart).
+		Order("period_start DESC").First(&prev).Error
+	if err == nil {
+		previous = &prev.ActualValue
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to load previous snapshot: %w", err)
+	}
+
+	status := s.semanticV2.EvaluateKPIStatus(&effective, actual, previous)
+
+	snapshot := &SemanticKPISnapshot{
+		KPIID:       kpi.ID,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		ActualValue: actual,
+		TargetValue: effective.TargetValue,
+		PctOfTarget: status.PctOfTarget,
+		Status:      status.Status,
+		Trend:       status.Trend,
+		TrendPct:    status.TrendPct,
+		EvaluatedAt: at,
+	}
+
+	// Re-evaluating a period overwrites its snapshot instead of duplicating it
+	var existing SemanticKPISnapshot
+	err = s.db.Where("kpi_id = ? AND period_start = ?", kpi.ID, periodStart).First(&existing).Error
+	switch {
+	case err == nil:
+		snapshot.ID = existing.ID
+	case err == gorm.ErrRecordNotFound:
+		snapshot.ID = uuid.New().String()
+	default:
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	if err := s.db.Save(snapshot).Error; err != nil {
+		return nil, fmt.Errorf("failed to store snapshot: %w", err)
+	}
+	if err := s.db.Model(&SemanticKPI{}).Where("id = ?", kpi.ID).Update("last_evaluated_at", at).Error; err != nil {
+		return nil, fmt.Errorf("failed to update KPI: %w", err)
+	}
+
+	return snapshot, nil
+}
+
+// ResolveMetricValue runs the KPI's metric through the semantic layer for a
+// period, routed to an aggregate where one can answer it and restricted by
+// the user's row-level security. A zero periodStart evaluates the metric
+// over the whole model.
+func (s *KPIService) ResolveMetricValue(ctx context.Context, kpi *SemanticKPI, periodStart, periodEnd time.Time, userCtx models.UserContext) (float64, error) {
+	if err := validateKPIColumns(kpi); err != nil {
+		return 0, err
+	}
+	var metric models.SemanticMetric
+	if err := s.db.First(&metric, "id = ?", kpi.MetricID).Error; err != nil {
+		return 0, fmt.Errorf("metric not found: %w", err)
+	}
+
+	var owner models.SemanticModel
+	if err := s.db.Select("id", "workspace_id").First(&owner, "id = ?", metric.ModelID).Error; err != nil {
+		return 0, fmt.Errorf("model not found: %w", err)
+	}
+	model, conn, err := loadSemanticModel(s.db, owner.WorkspaceID, owner.ID, "")
+	if err != nil {
+		return 0, err
+	}
+	lite, err := secureSemanticModel(s.semanticV2, s.rlsService, model, conn, userCtx)
+	if err != nil {
+		return 0, err
+	}
+
+	query := &SemanticQueryV2{ModelID: model.ID, Metrics: []string{metric.Name}}
+	if kpi.TimeColumn != "" && !periodStart.IsZero() {
+		grain := TimeGrain(kpi.TrendPeriod)
+		if grain == "" {
+			grain = TimeGrainMonth
+		}
+		query.TimeColumn, query.TimeGrain = kpi.TimeColumn, grain
+		query.TimeFrom, query.TimeTo = &periodStart, &periodEnd
+	}
+	translated, err := s.semanticV2.TranslateV2WithSource(query, lite, conn.Type)
+	if err != nil {
+		return 0, fmt.Errorf("failed to translate metric %s: %w", metric.Name, err)
+	}
+
+	result, err := s.queryExecutor.Execute(ctx, conn, rebindPlaceholders(translated.SQL, conn.Type), translated.Args, nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve metric %s: %w", metric.Name, err)
+	}
+	if result == nil || len(result.Rows) == 0 || len(result.Rows[0]) == 0 {
+		return 0, nil
+	}
+	// The metric is the last column, after the period when the query has one
+	row := result.Rows[0]
+	return toFloat64Loose(row[len(row)-1]), nil
+}
+
+// ProcessDueKPIs evaluates every KPI whose schedule has come due
+func (s *KPIService) ProcessDueKPIs(ctx context.Context) error {
+	var kpis []SemanticKPI
+	if err := s.db.Where("schedule <> ''").Find(&kpis).Error; err != nil {
+		return fmt.Errorf("failed to load scheduled KPIs: %w", err)
+	}
+
+	now := time.Now()
+	for _, kpi := range kpis {
+		schedule, err := cron.ParseStandard(kpi.Schedule)
+		if err != nil {
+			LogWarn("kpi_schedule", "Invalid KPI schedule", map[string]interface{}{"kpi_id": kpi.ID, "schedule": kpi.Schedule, "error": err})
+			continue
+		}
+
+		last := kpi.CreatedAt
+		if kpi.LastEvaluatedAt != nil {
+			last = *kpi.LastEvaluatedAt
+		}
+		if schedule.Next(last).After(now) {
+			continue
+		}
+
+		// Scheduled runs have no user, so only policies applying to everyone restrict them
+		if _, err := s.EvaluateKPI(ctx, kpi.ID, now, models.UserContext{}); err != nil {
+			LogError("kpi_evaluate", "Scheduled KPI evaluation failed", map[string]interface{}{"kpi_id": kpi.ID, "error": err})
+		}
+	}
+	return nil
+}
+
+// ---- Targets ----
+
+// TargetAt returns the time-varying target in effect at the given time, or nil
+func (s *KPIService) TargetAt(kpiID string, at time.Time) (*SemanticKPITarget, error) {
+	var target SemanticKPITarget
+	err := s.db.Where("kpi_id = ? AND effective_from <= ?", kpiID, at).
+		Order("effective_from DESC").First(&target).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load KPI target: %w", err)
+	}
+	return &target, nil
+}
+
+// SetTargets replaces the manually maintained targets of a KPI
+func (s *KPIService) SetTargets(kpiID string, targets []SemanticKPITarget) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kpi_id = ? AND source = ?", kpiID, "manual").Delete(&SemanticKPITarget{}).Error; err != nil {
+			return err
+		}
+		for i := range targets {
+			targets[i].ID = uuid.New().String()
+			targets[i].KPIID = kpiID
+			targets[i].Source = "manual"
+			if err := tx.Create(&targets[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ImportTargetsFromTable loads time-varying targets from the KPI's TargetTable
+func (s *KPIService) ImportTargetsFromTable(ctx context.Context, kpiID string) (int, error) {
+	kpi, err := s.semanticV2.GetKPI(kpiID)
+	if err != nil {
+		return 0, fmt.Errorf("KPI not found: %w", err)
+	}
+	if kpi.TargetTable == "" || kpi.TargetDateCol == "" || kpi.TargetValueCol == "" {
+		return 0, fmt.Errorf("KPI has no target table configured")
+	}
+	if err := validateKPIColumns(kpi); err != nil {
+		return 0, err
+	}
+
+	var model models.SemanticModel
+	if err := s.db.First(&model, "id = ?", kpi.ModelID).Error; err != nil {
+		return 0, fmt.Errorf("model not found: %w", err)
+	}
+	var conn models.Connection
+	if err := s.db.Where("id = ?", model.DataSourceID).First(&conn).Error; err != nil {
+		return 0, fmt.Errorf("connection not found: %w", err)
+	}
+
+	sql := fmt.Sprintf("SELECT %s, %s FROM %s ORDER BY %s", kpi.TargetDateCol, kpi.TargetValueCol, kpi.TargetTable, kpi.TargetDateCol)
+	result, err := s.queryExecutor.Execute(ctx, &conn, sql, nil, nil, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read target table: %w", err)
+	}
+
+	var targets []SemanticKPITarget
+	for _, row := range result.Rows {
+		if len(row) < 2 {
+			continue
+		}
+		from, err := parseKPITargetDate(row[0])
+		if err != nil {
+			return 0, err
+		}
+		targets = append(targets, SemanticKPITarget{
+			ID:            uuid.New().String(),
+			KPIID:         kpi.ID,
+			EffectiveFrom: from,
+			TargetValue:   toFloat64Loose(row[1]),
+			Source:        "table",
+		})
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("kpi_id = ? AND source = ?", kpi.ID, "table").Delete(&SemanticKPITarget{}).Error; err != nil {
+			return err
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+		return tx.Create(&targets).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to store targets: %w", err)
+	}
+	return len(targets), nil
+}
+
+// ListTargets returns all targets of a KPI ordered by effective date
+func (s *KPIService) ListTargets(kpiID string) ([]SemanticKPITarget, error) {
+	var targets []SemanticKPITarget
+	err := s.db.Where("kpi_id = ?", kpiID).Order("effective_from ASC").Find(&targets).Error
+	return targets, err
+}
+
+// ---- History & Scorecards ----
+
+// GetHistory returns the actual vs target time series of a KPI
+func (s *KPIService) GetHistory(kpiID string, from, to time.Time) ([]SemanticKPISnapshot, error) {
+	query := s.db.Where("kpi_id = ?", kpiID)
+	if !from.IsZero() {
+		query = query.Where("period_start >= ?", from)
+	}
+	if !to.IsZero() {
+		query = query.Where("period_start < ?", to)
+	}
+
+	var history []SemanticKPISnapshot
+	err := query.Order("period_start ASC").Find(&history).Error
+	return history, err
+}
+
+// BuildScorecard assembles the KPI tree of a model with rolled-up statuses
+func (s *KPIService) BuildScorecard(modelID string) (*KPIScorecard, error) {
+	kpis, err := s.semanticV2.ListKPIs(modelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list KPIs: %w", err)
+	}
+
+	latest := make(map[string]*SemanticKPISnapshot, len(kpis))
+	if len(kpis) > 0 {
+		ids := make([]string, len(kpis))
+		for i, kpi := range kpis {
+			ids[i] = kpi.ID
+		}
+		var snapshots []SemanticKPISnapshot
+		if err := s.db.Where("kpi_id IN ?", ids).Order("period_start ASC").Find(&snapshots).Error; err != nil {
+			return nil, fmt.Errorf("failed to load KPI snapshots: %w", err)
+		}
+		for i := range snapshots {
+			latest[snapshots[i].KPIID] = &snapshots[i]
+		}
+	}
+
+	return BuildKPIScorecard(modelID, kpis, latest), nil
+}
+
+// BuildKPIScorecard builds the scorecard tree from KPIs and their latest snapshots
+func BuildKPIScorecard(modelID string, kpis []SemanticKPI, latest map[string]*SemanticKPISnapshot) *KPIScorecard {
+	nodes := make(map[string]*KPIScorecardNode, len(kpis))
+	for i := range kpis {
+		node := &KPIScorecardNode{KPI: &kpis[i], Latest: latest[kpis[i].ID], Status: "no_data"}
+		if node.Latest != nil {
+			node.Status = node.Latest.Status
+		}
+		nodes[kpis[i].ID] = node
+	}
+
+	scorecard := &KPIScorecard{
+		ModelID:     modelID,
+		GeneratedAt: time.Now(),
+		Counts:      make(map[string]int),
+	}
+	for i := range kpis {
+		node := nodes[kpis[i].ID]
+		if parentID := kpis[i].ParentKPIID; parentID != nil {
+			if parent, ok := nodes[*parentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		scorecard.Roots = append(scorecard.Roots, node)
+	}
+
+	sort.Slice(scorecard.Roots, func(i, j int) bool { return scorecard.Roots[i].KPI.Name < scorecard.Roots[j].KPI.Name })
+	for _, root := range scorecard.Roots {
+		rollupKPINode(root)
+		scorecard.Counts[root.RollupStatus]++
+	}
+	return scorecard
+}
+
+// rollupKPINode computes the rolled-up status of a node from its own status and its children
+func rollupKPINode(node *KPIScorecardNode) {
+	sort.Slice(node.Children, func(i, j int) bool { return node.Children[i].KPI.Name < node.Children[j].KPI.Name })
+	for _, child := range node.Children {
+		rollupKPINode(child)
+	}
+
+	ownScore, ownScored := kpiStatusScore(node.Status)
+	if len(node.Children) == 0 {
+		node.RollupStatus = node.Status
+		node.RollupScore = ownScore
+		return
+	}
+
+	if node.KPI.RollupMethod == "weighted" {
+		var total, weights float64
+		if ownScored {
+			total, weights = ownScore, 1
+		}
+		for _, child := range node.Children {
+			if _, ok := kpiStatusScore(child.RollupStatus); !ok {
+				continue
+			}
+			w := child.KPI.Weight
+			if w <= 0 {
+				w = 1
+			}
+			total += child.RollupScore * w
+			weights += w
+		}
+		if weights == 0 {
+			node.RollupStatus = node.Status
+			return
+		}
+		node.RollupScore = total / weights
+		node.RollupStatus = kpiStatusFromScore(node.RollupScore)
+		return
+	}
+
+	// Default "worst": a parent is only as healthy as its weakest child
+	node.RollupStatus = node.Status
+	node.RollupScore = ownScore
+	scored := ownScored
+	for _, child := range node.Children {
+		childScore, ok := kpiStatusScore(child.RollupStatus)
+		if !ok {
+			continue
+		}
+		if !scored || childScore < node.RollupScore {
+			node.RollupScore = childScore
+			node.RollupStatus = child.RollupStatus
+			scored = true
+		}
+	}
+}
+
+// kpiStatusScore maps a status onto a 0..1 health score; unscored statuses return false
+func kpiStatusScore(status string) (float64, bool) {
+	switch status {
+	case "on_track":
+		return 1, true
+	case "warning":
+		return 0.5, true
+	case "critical":
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func kpiStatusFromScore(score float64) string {
+	switch {
+	case score >= 0.75:
+		return "on_track"
+	case score >= 0.4:
+		return "warning"
+	default:
+		return "critical"
+	}
+}
+
+// RenderScorecardHTML renders a scorecard as an HTML table for email digests
+func RenderScorecardHTML(scorecard *KPIScorecard) string {
+	var b strings.Builder
+	b.WriteString(`<table style="width: 100%; border-collapse: collapse; font-size: 14px;">`)
+	b.WriteString(`<tr style="background: #eef2ff;"><th align="left" style="padding: 6px;">KPI</th><th align="right" style="padding: 6px;">Actual</th><th align="right" style="padding: 6px;">Target</th><th align="left" style="padding: 6px;">Status</th></tr>`)
+
+	var walk func(nodes []*KPIScorecardNode, depth int)
+	walk = func(nodes []*KPIScorecardNode, depth int) {
+		for _, node := range nodes {
+			actual, target := "-", "-"
+			if node.Latest != nil {
+				actual = fmt.Sprintf("%.2f%s", node.Latest.ActualValue, node.KPI.Unit)
+				if node.Latest.TargetValue != nil {
+					target = fmt.Sprintf("%.2f%s", *node.Latest.TargetValue, node.KPI.Unit)
+				}
+			}
+			fmt.Fprintf(&b, `<tr><td style="padding: 6px; padding-left: %dpx;">%s</td><td align="right" style="padding: 6px;">%s</td><td align="right" style="padding: 6px;">%s</td><td style="padding: 6px; color: %s;">%s</td></tr>`,
+				6+depth*16, html.EscapeString(node.KPI.Name), html.EscapeString(actual), html.EscapeString(target),
+				kpiStatusColor(node.RollupStatus), strings.ReplaceAll(node.RollupStatus, "_", " "))
+			walk(node.Children, depth+1)
+		}
+	}
+	walk(scorecard.Roots, 0)
+
+	b.WriteString(`</table>`)
+	return b.String()
+}
+
+// RenderScorecardCSV renders a scorecard as flat CSV rows, one per KPI
+func RenderScorecardCSV(scorecard *KPIScorecard) string {
+	var b strings.Builder
+	for _, record := range scorecardRecords(scorecard) {
+		for i, field := range record {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(csvField(field))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// RenderScorecardExcel renders a scorecard as an xlsx workbook with the same columns as the CSV export
+func RenderScorecardExcel(scorecard *KPIScorecard) (*bytes.Buffer, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheet = "Sheet1"
+	for i, record := range scorecardRecords(scorecard) {
+		cell, err := excelize.CoordinatesToCellName(1, i+1)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]interface{}, len(record))
+		for j, field := range record {
+			row[j] = field
+		}
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return nil, err
+		}
+	}
+	return f.WriteToBuffer()
+}
+
+// scorecardRecords flattens the KPI tree depth-first into a header row followed by one row per KPI
+func scorecardRecords(scorecard *KPIScorecard) [][]string {
+	records := [][]string{{"kpi", "parent", "period_start", "actual", "target", "pct_of_target", "status", "rollup_status"}}
+
+	var walk func(nodes []*KPIScorecardNode, parent string)
+	walk = func(nodes []*KPIScorecardNode, parent string) {
+		for _, node := range nodes {
+			periodStart, actual, target, pct := "", "", "", ""
+			if node.Latest != nil {
+				periodStart = node.Latest.PeriodStart.Format("2006-01-02")
+				actual = fmt.Sprintf("%g", node.Latest.ActualValue)
+				pct = fmt.Sprintf("%.1f", node.Latest.PctOfTarget)
+				if node.Latest.TargetValue != nil {
+					target = fmt.Sprintf("%g", *node.Latest.TargetValue)
+				}
+			}
+			records = append(records, []string{node.KPI.Name, parent, periodStart, actual, target, pct, node.Status, node.RollupStatus})
+			walk(node.Children, node.KPI.Name)
+		}
+	}
+	walk(scorecard.Roots, "")
+	return records
+}
+
+func kpiStatusColor(status string) string {
+	switch status {
+	case "on_track":
+		return "#059669"
+	case "warning":
+		return "#d97706"
+	case "critical":
+		return "#dc2626"
+	default:
+		return "#6b7280"
+	}
+}
+
+func csvField(v string) string {
+	if strings.ContainsAny(v, ",\"\n") {
+		return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+	}
+	return v
+}
+
+// kpiPeriodBounds returns the [start, end) period containing at for a grain,
+// following the workspace calendar (nil means Gregorian).
+// An empty grain defaults to month.
+func kpiPeriodBounds(cal *WorkspaceCalendar, grain TimeGrain, at time.Time) (time.Time, time.Time, error) {
+	if err := validateKPITrendPeriod(string(grain)); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if grain == "" {
+		grain = TimeGrainMonth
+	}
+	start, end := cal.PeriodBounds(grain, at)
+	return start, end, nil
+}
+
+func validateKPITrendPeriod(period string) error {
+	switch TimeGrain(period) {
+	case "", TimeGrainDay, TimeGrainWeek, TimeGrainMonth, TimeGrainQuarter, TimeGrainYear:
+		return nil
+	default:
+		return fmt.Errorf("unsupported KPI trend period: %s", period)
+	}
+}
+
+func parseKPITargetDate(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid target date: %s", t)
+	default:
+		return time.Time{}, fmt.Errorf("invalid target date: %v", v)
+	}
+}
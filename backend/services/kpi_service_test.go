@@ -0,0 +1,110 @@
+package services_test
+
+import (
+	"insight-engine-backend/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestBuildKPIScorecard_Rollups(t *testing.T) {
+	kpis := []services.SemanticKPI{
+		{ID: "revenue", Name: "Revenue", RollupMethod: "worst"},
+		{ID: "emea", Name: "EMEA Revenue", ParentKPIID: strPtr("revenue"), Weight: 1},
+		{ID: "apac", Name: "APAC Revenue", ParentKPIID: strPtr("revenue"), Weight: 1},
+		{ID: "nps", Name: "NPS", RollupMethod: "weighted"},
+		{ID: "nps-web", Name: "Web NPS", ParentKPIID: strPtr("nps"), Weight: 3},
+		{ID: "nps-app", Name: "App NPS", ParentKPIID: strPtr("nps"), Weight: 1},
+		{ID: "orphan", Name: "Churn", ParentKPIID: strPtr("missing")},
+	}
+	latest := map[string]*services.SemanticKPISnapshot{
+		"revenue": {Status: "on_track"},
+		"emea":    {Status: "on_track"},
+		"apac":    {Status: "critical"},
+		"nps-web": {Status: "on_track"},
+		"nps-app": {Status: "critical"},
+	}
+
+	scorecard := services.BuildKPIScorecard("m1", kpis, latest)
+	require.Len(t, scorecard.Roots, 3)
+
+	byName := map[string]*services.KPIScorecardNode{}
+	for _, root := range scorecard.Roots {
+		byName[root.KPI.Name] = root
+	}
+
+	revenue := byName["Revenue"]
+	require.NotNil(t, revenue)
+	assert.Equal(t, "on_track", revenue.Status)
+	assert.Equal(t, "critical", revenue.RollupStatus, "worst rollup takes the weakest child")
+	assert.Len(t, revenue.Children, 2)
+
+	nps := byName["NPS"]
+	require.NotNil(t, nps)
+	assert.Equal(t, "no_data", nps.Status)
+	assert.InDelta(t, 0.75, nps.RollupScore, 0.0001)
+	assert.Equal(t, "on_track", nps.RollupStatus)
+
+	churn := byName["Churn"]
+	require.NotNil(t, churn, "KPIs with unknown parents are treated as roots")
+	assert.Equal(t, "no_data", churn.RollupStatus)
+
+	assert.Equal(t, 1, scorecard.Counts["critical"])
+	assert.Equal(t, 1, scorecard.Counts["on_track"])
+}
+
+func TestRenderScorecardCSV(t *testing.T) {
+	target := 100.0
+	kpis := []services.SemanticKPI{{ID: "k1", Name: "Revenue, net", Unit: "$"}}
+	latest := map[string]*services.SemanticKPISnapshot{
+		"k1": {ActualValue: 90, TargetValue: &target, PctOfTarget: 90, Status: "warning"},
+	}
+
+	csv := services.RenderScorecardCSV(services.BuildKPIScorecard("m1", kpis, latest))
+	assert.Contains(t, csv, `"Revenue, net",,0001-01-01,90,100,90.0,warning,warning`)
+}
+
+func TestRenderScorecardExcel(t *testing.T) {
+	kpis := []services.SemanticKPI{
+		{ID: "k1", Name: "Revenue"},
+		{ID: "k2", Name: "EMEA Revenue", ParentKPIID: strPtr("k1")},
+	}
+	latest := map[string]*services.SemanticKPISnapshot{"k1": {ActualValue: 90, Status: "warning"}}
+
+	buf, err := services.RenderScorecardExcel(services.BuildKPIScorecard("m1", kpis, latest))
+	require.NoError(t, err)
+
+	f, err := excelize.OpenReader(buf)
+	require.NoError(t, err)
+	defer f.Close()
+
+	rows, err := f.GetRows("Sheet1")
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, "kpi", rows[0][0])
+	assert.Equal(t, []string{"Revenue", "", "0001-01-01", "90", "", "0.0", "warning", "warning"}, rows[1])
+	assert.Equal(t, "EMEA Revenue", rows[2][0])
+	assert.Equal(t, "Revenue", rows[2][1])
+}
+
+func TestCreateKPI_RejectsUnsafeNames(t *testing.T) {
+	svc := services.NewSemanticLayerV2Service(nil)
+	tests := map[string]services.SemanticKPI{
+		"time column":  {TimeColumn: "order_date; DROP TABLE users"},
+		"target table": {TargetTable: "targets t, pg_shadow", TargetDateCol: "month", TargetValueCol: "value"},
+		"date column":  {TargetTable: "kpi_targets", TargetDateCol: "(SELECT 1)", TargetValueCol: "value"},
+		"value column": {TargetTable: "kpi_targets", TargetDateCol: "month", TargetValueCol: "value --"},
+		"columns":      {TargetTable: "kpi_targets"},
+		"schedule":     {Schedule: "every day"},
+	}
+	for name, kpi := range tests {
+		t.Run(name, func(t *testing.T) {
+			kpi.ModelID, kpi.MetricID = "m1", "metric1"
+			assert.Error(t, svc.CreateKPI(&kpi))
+		})
+	}
+}
@@ -22,20 +22,31 @@ type MaterializedViewService struct {
 	executor           *QueryExecutor
 	cron               *cron.Cron
 	incrementalRefresh *IncrementalRefreshService
-	mu                 sync.Mutex // Protect concurrent refresh operations
+	onRefreshed        func(mvID string) // called after a successful refresh
+	mu                 sync.Mutex        // Protect concurrent refresh operations
+	lastTick           time.Time         // when the scheduler last looked for due views
 }
 
 // NewMaterializedViewService creates a new materialized view service
 func NewMaterializedViewService(db *gorm.DB, executor *QueryExecutor) *MaterializedViewService {
 	c := cron.New()
-	c.Start()
-
-	return &MaterializedViewService{
+	s := &MaterializedViewService{
 		db:                 db,
 		executor:           executor,
 		cron:               c,
 		incrementalRefresh: NewIncrementalRefreshService(executor),
+		lastTick:           time.Now(),
 	}
+	// One scheduler for all views, so views due together refresh in
+	// dependency order
+	c.AddFunc("* * * * *", s.runScheduledRefreshes)
+	c.Start()
+	return s
+}
+
+// SetRefreshListener registers a callback invoked after each successful refresh
+func (s *MaterializedViewService) SetRefreshListener(fn func(mvID string)) {
+	s.onRefreshed = fn
 }
 
 // generateTableName generates a unique table name for the materialized view
@@ -60,11 +71,15 @@ func (s *MaterializedViewService) CreateMaterializedView(
 	sourceQuery string,
 	refreshMode string,
 	schedule string,
+	metadata map[string]interface{},
 ) (*models.MaterializedView, error) {
 	// Validate refresh mode
 	if refreshMode != "full" && refreshMode != "incremental" {
 		return nil, fmt.Errorf("invalid refresh mode: must be 'full' or 'incremental'")
 	}
+	if _, err := ParseIncrementalSettings(metadata); err != nil {
+		return nil, err
+	}
 
 	// Validate cron schedule if provided
 	if schedule != "" {
@@ -92,6 +107,7 @@ func (s *MaterializedViewService) CreateMaterializedView(
 		TargetTable:  targetTable,
 		RefreshMode:  refreshMode,
 		Schedule:     schedule,
+		Metadata:     metadata,
 		Status:       "idle",
 	}
 
@@ -107,6 +123,14 @@ func (s *MaterializedViewService) CreateMaterializedView(
 		return nil, fmt.Errorf("failed to create materialized view in database: %w", err)
 	}
 
+	if refreshMode == "incremental" {
+		if err := s.prepareIncremental(ctx, &connection, mv); err != nil {
+			s.dropTarget(ctx, &connection, mv)
+			s.db.Delete(mv)
+			return nil, err
+		}
+	}
+
 	// Perform initial refresh
 	if err := s.RefreshMaterializedView(ctx, mv.ID); err != nil {
 		// Keep the MV but mark as error
@@ -117,14 +141,6 @@ func (s *MaterializedViewService) CreateMaterializedView(
 		return mv, fmt.Errorf("materialized view created but initial refresh failed: %w", err)
 	}
 
-	// Setup cron schedule if provided
-	if schedule != "" {
-		if err := s.setupSchedule(mv); err != nil {
-			// Keep the MV but schedule failed
-			return mv, fmt.Errorf("materialized view created but schedule setup failed: %w", err)
-		}
-	}
-
 	return mv, nil
 }
 
@@ -138,11 +154,13 @@ func (s *MaterializedViewService) createMaterializedViewInDatabase(
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
 	// Create based on database type
 	switch connection.Type {
 	case "postgres":
+		if !nativeMV(connection, mv) {
+			return s.createGenericMV(ctx, db, mv)
+		}
 		return s.createPostgresMV(ctx, db, mv)
 	case "mysql":
 		return s.createMySQLMV(ctx, db, mv)
@@ -163,7 +181,7 @@ func (s *MaterializedViewService) createPostgresMV(ctx context.Context, db *sql.
 // createMySQLMV creates a table-based materialized view for MySQL
 func (s *MaterializedViewService) createMySQLMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) error {
 	// MySQL doesn't have native MV, so create a table
-	query := fmt.Sprintf("CREATE TABLE %s AS %s LIMIT 0", mv.TargetTable, mv.SourceQuery)
+	query := fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM (%s) AS mv_source LIMIT 0", mv.TargetTable, mv.SourceQuery)
 	_, err := db.ExecContext(ctx, query)
 	return err
 }
@@ -171,19 +189,156 @@ func (s *MaterializedViewService) createMySQLMV(ctx context.Context, db *sql.DB,
 // createSQLiteMV creates a table-based materialized view for SQLite
 func (s *MaterializedViewService) createSQLiteMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) error {
 	// SQLite also uses table-based approach
-	query := fmt.Sprintf("CREATE TABLE %s AS %s WHERE 1=0", mv.TargetTable, mv.SourceQuery)
+	query := fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM (%s) AS mv_source WHERE 1=0", mv.TargetTable, mv.SourceQuery)
 	_, err := db.ExecContext(ctx, query)
 	return err
 }
 
 // createGenericMV creates a generic table-based materialized view
 func (s *MaterializedViewService) createGenericMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) error {
-	query := fmt.Sprintf("CREATE TABLE %s AS %s WHERE 1=0", mv.TargetTable, mv.SourceQuery)
+	query := fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM (%s) AS mv_source WHERE 1=0", mv.TargetTable, mv.SourceQuery)
 	_, err := db.ExecContext(ctx, query)
 	return err
 }
 
-// RefreshMaterializedView refreshes a materialized view
+// nativeMV reports whether a view is a native PostgreSQL materialized view.
+// Incremental views are tables everywhere, so rows can be merged into them.
+func nativeMV(connection *models.Connection, mv *models.MaterializedView) bool {
+	return connection.Type == "postgres" && mv.RefreshMode != "incremental"
+}
+
+// prepareIncremental checks the incremental settings of a new view against
+// its source query, stores them as resolved, and indexes the view's table
+// on the primary key for merges
+func (s *MaterializedViewService) prepareIncremental(ctx context.Context, connection *models.Connection, mv *models.MaterializedView) error {
+	_, settings, err := s.incrementalRefresh.ResolveConfig(ctx, connection, mv)
+	if err != nil {
+		return fmt.Errorf("invalid incremental refresh settings: %w", err)
+	}
+	if mv.Metadata, err = settings.Store(mv.Metadata); err != nil {
+		return err
+	}
+	if err := s.db.Model(mv).Select("metadata").Updates(mv).Error; err != nil {
+		return fmt.Errorf("failed to save incremental refresh settings: %w", err)
+	}
+
+	db, err := s.executor.getConnection(connection)
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	dialect := mvDialect(connection.Type)
+	index := fmt.Sprintf("CREATE UNIQUE INDEX %s_key ON %s (%s)", mv.TargetTable, mv.TargetTable, quoteColumns(dialect, "", settings.PrimaryKeys))
+	if _, err := db.ExecContext(ctx, index); err != nil {
+		return fmt.Errorf("failed to index materialized view on its primary key: %w", err)
+	}
+	return nil
+}
+
+// upgradeIncremental converts an incremental view created before merges, a
+// native PostgreSQL materialized view or a table without the unique index
+// on the primary key, into a table merges can write to. A table that cannot
+// be indexed as it is, holding rows stored twice by earlier merges, is
+// emptied first; upgradeIncremental then reports it must be rebuilt in full.
+func (s *MaterializedViewService) upgradeIncremental(ctx context.Context, connection *models.Connection, mv *models.MaterializedView) (bool, error) {
+	if mv.RefreshMode != "incremental" {
+		return false, nil
+	}
+	db, err := s.executor.getConnection(connection)
+	if err != nil {
+		return false, fmt.Errorf("failed to get database connection: %w", err)
+	}
+
+	dialect := mvDialect(connection.Type)
+	if dialect == "postgres" {
+		native, err := isPostgresMV(ctx, db, mv)
+		if err != nil {
+			return false, err
+		}
+		if native {
+			if err := convertPostgresMV(ctx, db, mv); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	indexed, err := hasKeyIndex(ctx, db, dialect, mv)
+	if err != nil || indexed {
+		return false, err
+	}
+	if err := s.prepareIncremental(ctx, connection, mv); err == nil {
+		return false, nil
+	}
+	if _, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s", mv.TargetTable)); err != nil {
+		return false, fmt.Errorf("failed to empty materialized view: %w", err)
+	}
+	if err := s.prepareIncremental(ctx, connection, mv); err != nil {
+		// Merges then fail and fall back to full refreshes
+		LogWarn("mv_refresh", "Failed to index incremental materialized view", map[string]interface{}{"mv_id": mv.ID, "error": err.Error()})
+	}
+	return true, nil
+}
+
+// isPostgresMV reports whether a view's target is a native PostgreSQL
+// materialized view
+func isPostgresMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) (bool, error) {
+	var count int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM pg_matviews WHERE schemaname = current_schema() AND matviewname = $1", mv.TargetTable).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up materialized view: %w", err)
+	}
+	return count > 0, nil
+}
+
+// convertPostgresMV replaces a native materialized view with a table
+// holding its rows, in one transaction. Database views reading it make the
+// drop fail rather than being dropped along.
+func convertPostgresMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	staging := mv.TargetTable + "__table"
+	for _, statement := range []string{
+		fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s", staging, mv.TargetTable),
+		fmt.Sprintf("DROP MATERIALIZED VIEW %s", mv.TargetTable),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", staging, mv.TargetTable),
+	} {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to convert materialized view to a table: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// hasKeyIndex reports whether a view's table has the unique index
+// prepareIncremental creates. Databases whose catalog is not known are
+// assumed to have it.
+func hasKeyIndex(ctx context.Context, db *sql.DB, dialect string, mv *models.MaterializedView) (bool, error) {
+	index := mv.TargetTable + "_key"
+	var query string
+	args := []interface{}{index}
+	switch dialect {
+	case "postgres":
+		query = "SELECT COUNT(*) FROM pg_indexes WHERE schemaname = current_schema() AND indexname = $1"
+	case "mysql":
+		query = "SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?"
+		args = []interface{}{mv.TargetTable, index}
+	case "sqlite":
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = ?"
+	case "sqlserver":
+		query = "SELECT COUNT(*) FROM sys.indexes WHERE name = @p1"
+	default:
+		return true, nil
+	}
+	var count int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up the primary key index: %w", err)
+	}
+	return count > 0, nil
+}
+
+// RefreshMaterializedView refreshes a materialized view, then the views
+// built on it in dependency order. The refresh runs in the background.
 func (s *MaterializedViewService) RefreshMaterializedView(ctx context.Context, mvID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -199,87 +354,102 @@ func (s *MaterializedViewService) RefreshMaterializedView(ctx context.Context, m
 		return fmt.Errorf("materialized view is already being refreshed")
 	}
 
-	// Get connection
-	var connection models.Connection
-	if err := s.db.Where("id = ?", mv.ConnectionID).First(&connection).Error; err != nil {
-		return fmt.Errorf("connection not found: %w", err)
-	}
+	return s.startRefreshChain(mv.ConnectionID, []string{mvID})
+}
 
+// refreshView refreshes one materialized view and records the outcome
+func (s *MaterializedViewService) refreshView(ctx context.Context, connection *models.Connection, mv *models.MaterializedView) error {
 	// Create refresh history entry
 	history := &models.RefreshHistory{
 		ID:               uuid.NewString(),
-		MaterializedView: mvID,
+		MaterializedView: mv.ID,
 		RefreshMode:      mv.RefreshMode,
 		StartedAt:        time.Now(),
 		Status:           "running",
 	}
 	s.db.Create(history)
 
-	// Update status to refreshing
-	s.db.Model(&mv).Updates(map[string]interface{}{
-		"status":        "refreshing",
-		"error_message": "",
-	})
-
-	// Perform refresh in background
-	go func() {
-		startTime := time.Now()
-		var rowsAffected int64
-		var refreshErr error
-
-		// Perform the refresh
-		if mv.RefreshMode == "incremental" && mv.LastRefresh != nil {
-			rowsAffected, refreshErr = s.performIncrementalRefresh(context.Background(), &connection, &mv)
+	startTime := time.Now()
+	var rowsAffected int64
+	var reconciliation *MVReconciliation
+	var refreshErr error
+
+	// Perform the refresh, upgrading incremental views created before merges
+	rebuild, refreshErr := s.upgradeIncremental(ctx, connection, mv)
+	incremental := mv.RefreshMode == "incremental" && mv.LastRefresh != nil && !rebuild
+	if refreshErr == nil {
+		if incremental {
+			rowsAffected, reconciliation, refreshErr = s.performIncrementalRefresh(ctx, connection, mv)
 		} else {
-			rowsAffected, refreshErr = s.performFullRefresh(context.Background(), &connection, &mv)
+			rowsAffected, refreshErr = s.performFullRefresh(ctx, connection, mv)
 		}
+	}
 
-		duration := time.Since(startTime).Milliseconds()
-		now := time.Now()
-
-		// Update history
-		if refreshErr != nil {
-			s.db.Model(history).Updates(map[string]interface{}{
-				"completed_at":  &now,
-				"status":        "failed",
-				"error_message": refreshErr.Error(),
-				"duration":      duration,
-				"rows_affected": rowsAffected,
-			})
-
-			// Update MV status
-			s.db.Model(&mv).Updates(map[string]interface{}{
-				"status":        "error",
-				"error_message": refreshErr.Error(),
-			})
-		} else {
-			s.db.Model(history).Updates(map[string]interface{}{
-				"completed_at":  &now,
-				"status":        "success",
-				"duration":      duration,
-				"rows_affected": rowsAffected,
-			})
-
-			// Calculate next refresh time
-			var nextRefresh *time.Time
-			if mv.Schedule != "" {
-				schedule, _ := cron.ParseStandard(mv.Schedule)
-				next := schedule.Next(now)
-				nextRefresh = &next
-			}
+	// A merge affects only the changed rows
+	rowCount := rowsAffected
+	if incremental && refreshErr == nil {
+		rowCount, refreshErr = s.countRows(ctx, connection, mv)
+	}
 
-			// Update MV status
-			s.db.Model(&mv).Updates(map[string]interface{}{
-				"status":        "idle",
-				"last_refresh":  &now,
-				"next_refresh":  nextRefresh,
-				"row_count":     rowsAffected,
-				"refresh_count": gorm.Expr("refresh_count + 1"),
-				"error_message": "",
-			})
-		}
-	}()
+	duration := time.Since(startTime).Milliseconds()
+	now := time.Now()
+
+	// Update history
+	if refreshErr != nil {
+		s.db.Model(history).Updates(map[string]interface{}{
+			"completed_at":  &now,
+			"status":        "failed",
+			"error_message": refreshErr.Error(),
+			"duration":      duration,
+			"rows_affected": rowsAffected,
+		})
 
+		// Update MV status
+		s.db.Model(mv).Updates(map[string]interface{}{
+			"status":        "error",
+			"error_message": refreshErr.Error(),
+		})
+		return refreshErr
+	}
+
+	outcome := map[string]interface{}{
+		"completed_at":  &now,
+		"status":        "success",
+		"duration":      duration,
+		"rows_affected": rowsAffected,
+	}
+	if reconciliation != nil {
+		outcome["reconciled"] = true
+		outcome["source_rows"] = reconciliation.SourceRows
+		outcome["target_rows"] = reconciliation.TargetRows
+		outcome["source_checksum"] = reconciliation.SourceChecksum
+		outcome["target_checksum"] = reconciliation.TargetChecksum
+		outcome["drift"] = reconciliation.Drifted()
+	}
+	s.db.Model(history).Updates(outcome)
+
+	// Calculate next refresh time
+	var nextRefresh *time.Time
+	if mv.Schedule != "" {
+		schedule, _ := cron.ParseStandard(mv.Schedule)
+		next := schedule.Next(now)
+		nextRefresh = &next
+	}
+
+	// Update MV status. The refresh's start is the next merge's cutoff: rows
+	// changed while it ran may have been missed.
+	s.db.Model(mv).Updates(map[string]interface{}{
+		"status":        "idle",
+		"last_refresh":  &startTime,
+		"next_refresh":  nextRefresh,
+		"row_count":     rowCount,
+		"refresh_count": gorm.Expr("refresh_count + 1"),
+		"error_message": "",
+	})
+
+	if s.onRefreshed != nil {
+		s.onRefreshed(mv.ID)
+	}
 	return nil
 }
 
@@ -293,20 +463,44 @@ func (s *MaterializedViewService) performFullRefresh(
 	if err != nil {
 		return 0, fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
-	switch connection.Type {
-	case "postgres":
+	if nativeMV(connection, mv) {
 		return s.refreshPostgresMV(ctx, db, mv)
+	}
+
+	// Soft-deleted rows are left out, as by incremental refreshes
+	settings, err := ParseIncrementalSettings(mv.Metadata)
+	if err != nil {
+		return 0, err
+	}
+	query := mv.SourceQuery
+	if mv.RefreshMode == "incremental" {
+		query = liveQuery(mvDialect(connection.Type), mv.SourceQuery, settings.DeletedColumn)
+	}
+
+	switch connection.Type {
 	case "mysql":
-		return s.refreshMySQLMV(ctx, db, mv)
+		return s.refreshMySQLMV(ctx, db, mv, query)
 	case "sqlite":
-		return s.refreshSQLiteMV(ctx, db, mv)
+		return s.refreshSQLiteMV(ctx, db, mv, query)
 	default:
-		return s.refreshGenericMV(ctx, db, mv)
+		return s.refreshGenericMV(ctx, db, mv, query)
 	}
 }
 
+// countRows counts the rows of a view
+func (s *MaterializedViewService) countRows(ctx context.Context, connection *models.Connection, mv *models.MaterializedView) (int64, error) {
+	db, err := s.executor.getConnection(connection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	var count int64
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", mv.TargetTable)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
 // refreshPostgresMV refreshes a PostgreSQL materialized view
 func (s *MaterializedViewService) refreshPostgresMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) (int64, error) {
 	query := fmt.Sprintf("REFRESH MATERIALIZED VIEW %s", mv.TargetTable)
@@ -324,14 +518,14 @@ func (s *MaterializedViewService) refreshPostgresMV(ctx context.Context, db *sql
 }
 
 // refreshMySQLMV refreshes a MySQL table-based materialized view
-func (s *MaterializedViewService) refreshMySQLMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) (int64, error) {
+func (s *MaterializedViewService) refreshMySQLMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView, query string) (int64, error) {
 	// Truncate and repopulate
 	truncateQuery := fmt.Sprintf("TRUNCATE TABLE %s", mv.TargetTable)
 	if _, err := db.ExecContext(ctx, truncateQuery); err != nil {
 		return 0, fmt.Errorf("failed to truncate table: %w", err)
 	}
 
-	insertQuery := fmt.Sprintf("INSERT INTO %s %s", mv.TargetTable, mv.SourceQuery)
+	insertQuery := fmt.Sprintf("INSERT INTO %s %s", mv.TargetTable, query)
 	result, err := db.ExecContext(ctx, insertQuery)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert data: %w", err)
@@ -342,14 +536,14 @@ func (s *MaterializedViewService) refreshMySQLMV(ctx context.Context, db *sql.DB
 }
 
 // refreshSQLiteMV refreshes a SQLite table-based materialized view
-func (s *MaterializedViewService) refreshSQLiteMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) (int64, error) {
+func (s *MaterializedViewService) refreshSQLiteMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView, query string) (int64, error) {
 	// Delete all rows and repopulate
 	deleteQuery := fmt.Sprintf("DELETE FROM %s", mv.TargetTable)
 	if _, err := db.ExecContext(ctx, deleteQuery); err != nil {
 		return 0, fmt.Errorf("failed to delete rows: %w", err)
 	}
 
-	insertQuery := fmt.Sprintf("INSERT INTO %s %s", mv.TargetTable, mv.SourceQuery)
+	insertQuery := fmt.Sprintf("INSERT INTO %s %s", mv.TargetTable, query)
 	result, err := db.ExecContext(ctx, insertQuery)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert data: %w", err)
@@ -360,61 +554,55 @@ func (s *MaterializedViewService) refreshSQLiteMV(ctx context.Context, db *sql.D
 }
 
 // refreshGenericMV refreshes a generic table-based materialized view
-func (s *MaterializedViewService) refreshGenericMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView) (int64, error) {
-	return s.refreshSQLiteMV(ctx, db, mv)
+func (s *MaterializedViewService) refreshGenericMV(ctx context.Context, db *sql.DB, mv *models.MaterializedView, query string) (int64, error) {
+	return s.refreshSQLiteMV(ctx, db, mv, query)
 }
 
-// performIncrementalRefresh performs an incremental refresh using IncrementalRefreshService
+// performIncrementalRefresh merges the rows changed since the last refresh
+// using IncrementalRefreshService. Every Nth refresh, as configured, then
+// compares the view with its source and rebuilds it in full on drift.
 func (s *MaterializedViewService) performIncrementalRefresh(
 	ctx context.Context,
 	connection *models.Connection,
 	mv *models.MaterializedView,
-) (int64, error) {
+) (int64, *MVReconciliation, error) {
 	// Ensure we have a last refresh time
 	if mv.LastRefresh == nil || mv.LastRefresh.IsZero() {
 		// First refresh - do full refresh
-		return s.performFullRefresh(ctx, connection, mv)
+		rows, err := s.performFullRefresh(ctx, connection, mv)
+		return rows, nil, err
 	}
 
-	// Auto-detect timestamp column
-	timestampColumn, err := s.incrementalRefresh.DetectTimestampColumn(ctx, connection, mv.SourceQuery)
-	if err != nil {
-		// Fall back to full refresh if no timestamp column found
-		return s.performFullRefresh(ctx, connection, mv)
-	}
-
-	// Extract primary keys from metadata, with fallback to "id"
-	var primaryKeys []string
-	if mv.Metadata != nil {
-		if keys, ok := mv.Metadata["primary_keys"].([]interface{}); ok {
-			for _, key := range keys {
-				if keyStr, ok := key.(string); ok {
-					primaryKeys = append(primaryKeys, keyStr)
-				}
+	config, settings, err := s.incrementalRefresh.ResolveConfig(ctx, connection, mv)
+	if err == nil {
+		config.LastRefresh = *mv.LastRefresh
+		var rowsAffected int64
+		rowsAffected, err = s.incrementalRefresh.PerformIncrementalRefresh(ctx, connection, mv, *config)
+		if err == nil {
+			if settings.ReconcileEvery == 0 || (mv.RefreshCount+1)%settings.ReconcileEvery != 0 {
+				return rowsAffected, nil, nil
+			}
+			reconciliation, err := s.incrementalRefresh.Reconcile(ctx, connection, mv, *config)
+			if err != nil {
+				return rowsAffected, nil, err
+			}
+			if reconciliation.Drifted() {
+				LogWarn("mv_reconcile", "Materialized view drifted from its source; rebuilding", map[string]interface{}{
+					"mv_id":       mv.ID,
+					"source_rows": reconciliation.SourceRows,
+					"target_rows": reconciliation.TargetRows,
+				})
+				rebuilt, err := s.performFullRefresh(ctx, connection, mv)
+				return rowsAffected + rebuilt, reconciliation, err
 			}
+			return rowsAffected, reconciliation, nil
 		}
 	}
 
-	// Fallback to "id" if no primary keys configured (common convention)
-	if len(primaryKeys) == 0 {
-		primaryKeys = []string{"id"}
-	}
-
-	// Build refresh config
-	config := RefreshConfig{
-		TimestampColumn: timestampColumn,
-		PrimaryKeys:     primaryKeys,
-		LastRefresh:     *mv.LastRefresh,
-	}
-
-	// Perform incremental refresh
-	rowsAffected, err := s.incrementalRefresh.PerformIncrementalRefresh(ctx, connection, mv, config)
-	if err != nil {
-		// If incremental refresh fails, fall back to full refresh
-		return s.performFullRefresh(ctx, connection, mv)
-	}
-
-	return rowsAffected, nil
+	// If incremental refresh fails, fall back to full refresh
+	LogWarn("mv_refresh", "Incremental refresh failed; refreshing in full", map[string]interface{}{"mv_id": mv.ID, "error": err.Error()})
+	rows, err := s.performFullRefresh(ctx, connection, mv)
+	return rows, nil, err
 }
 
 // DropMaterializedView drops a materialized view
@@ -425,6 +613,19 @@ func (s *MaterializedViewService) DropMaterializedView(ctx context.Context, mvID
 		return fmt.Errorf("materialized view not found: %w", err)
 	}
 
+	// Views built on this one would break
+	graph, err := s.dependencyGraph(mv.ConnectionID)
+	if err != nil {
+		return err
+	}
+	if dependents := graph.downstream[mv.ID]; len(dependents) > 0 {
+		names := make([]string, len(dependents))
+		for i, id := range dependents {
+			names[i] = graph.views[id].Name
+		}
+		return fmt.Errorf("materialized view is read by %s; drop those first", strings.Join(names, ", "))
+	}
+
 	// Get connection
 	var connection models.Connection
 	if err := s.db.Where("id = ?", mv.ConnectionID).First(&connection).Error; err != nil {
@@ -432,14 +633,34 @@ func (s *MaterializedViewService) DropMaterializedView(ctx context.Context, mvID
 	}
 
 	// Drop from database
-	db, err := s.executor.getConnection(&connection)
+	if err := s.dropTarget(ctx, &connection, &mv); err != nil {
+		return err
+	}
+
+	// Delete from our database
+	if err := s.db.Delete(&mv).Error; err != nil {
+		return fmt.Errorf("failed to delete materialized view record: %w", err)
+	}
+
+	return nil
+}
+
+// dropTarget drops a view from the connection's database
+func (s *MaterializedViewService) dropTarget(ctx context.Context, connection *models.Connection, mv *models.MaterializedView) error {
+	db, err := s.executor.getConnection(connection)
 	if err != nil {
 		return fmt.Errorf("failed to get database connection: %w", err)
 	}
-	defer db.Close()
 
+	native := nativeMV(connection, mv)
+	if !native && mvDialect(connection.Type) == "postgres" {
+		// Incremental views not refreshed since merges came are still native
+		if native, err = isPostgresMV(ctx, db, mv); err != nil {
+			return err
+		}
+	}
 	var dropQuery string
-	if connection.Type == "postgres" {
+	if native {
 		dropQuery = fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s", mv.TargetTable)
 	} else {
 		dropQuery = fmt.Sprintf("DROP TABLE IF EXISTS %s", mv.TargetTable)
@@ -448,17 +669,6 @@ func (s *MaterializedViewService) DropMaterializedView(ctx context.Context, mvID
 	if _, err := db.ExecContext(ctx, dropQuery); err != nil {
 		return fmt.Errorf("failed to drop materialized view from database: %w", err)
 	}
-
-	// Remove cron job if exists
-	if mv.Schedule != "" {
-		// Note: cron job removal would need job IDs stored, simplified here
-	}
-
-	// Delete from our database
-	if err := s.db.Delete(&mv).Error; err != nil {
-		return fmt.Errorf("failed to delete materialized view record: %w", err)
-	}
-
 	return nil
 }
 
@@ -495,19 +705,6 @@ func (s *MaterializedViewService) GetRefreshHistory(mvID string, limit int) ([]m
 	return history, nil
 }
 
-// setupSchedule sets up a cron job for the materialized view
-func (s *MaterializedViewService) setupSchedule(mv *models.MaterializedView) error {
-	if mv.Schedule == "" {
-		return nil
-	}
-
-	_, err := s.cron.AddFunc(mv.Schedule, func() {
-		s.RefreshMaterializedView(context.Background(), mv.ID)
-	})
-
-	return err
-}
-
 // UpdateSchedule updates the refresh schedule
 func (s *MaterializedViewService) UpdateSchedule(mvID string, schedule string) error {
 	// Validate cron schedule
@@ -517,13 +714,6 @@ func (s *MaterializedViewService) UpdateSchedule(mvID string, schedule string) e
 		}
 	}
 
-	// Update in database
-	if err := s.db.Model(&models.MaterializedView{}).Where("id = ?", mvID).Update("schedule", schedule).Error; err != nil {
-		return err
-	}
-
-	// Reload cron jobs (simplified - in production would track job IDs)
-	// For now, the schedule will be picked up on next app restart
-
-	return nil
+	// The scheduler reads schedules from the database on every tick
+	return s.db.Model(&models.MaterializedView{}).Where("id = ?", mvID).Update("schedule", schedule).Error
 }
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"insight-engine-backend/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+// mvTableReference matches the tables a query reads
+var mvTableReference = regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+([a-zA-Z0-9_."` + "`" + `]+)`)
+
+// referencedTables returns the tables a query reads, unqualified and lower
+// case
+func referencedTables(query string) map[string]bool {
+	tables := make(map[string]bool)
+	for _, match := range mvTableReference.FindAllStringSubmatch(query, -1) {
+		parts := strings.Split(match[1], ".")
+		name := strings.Trim(parts[len(parts)-1], "\"`")
+		if name != "" {
+			tables[strings.ToLower(name)] = true
+		}
+	}
+	return tables
+}
+
+// mvGraph is the dependency graph of the materialized views of a
+// connection: a view depends on the views whose tables its source query
+// reads
+type mvGraph struct {
+	views      map[string]*models.MaterializedView
+	upstream   map[string][]string // view ID → IDs of the views it reads
+	downstream map[string][]string // view ID → IDs of the views reading it
+}
+
+// newMVGraph derives the dependencies between views of one connection
+func newMVGraph(views []models.MaterializedView) *mvGraph {
+	g := &mvGraph{
+		views:      make(map[string]*models.MaterializedView, len(views)),
+		upstream:   make(map[string][]string),
+		downstream: make(map[string][]string),
+	}
+	byTable := make(map[string]string, len(views))
+	for i := range views {
+		g.views[views[i].ID] = &views[i]
+		byTable[strings.ToLower(views[i].TargetTable)] = views[i].ID
+	}
+	for _, id := range g.sorted(keys(g.views)) {
+		for table := range referencedTables(g.views[id].SourceQuery) {
+			if up, ok := byTable[table]; ok && up != id {
+				g.upstream[id] = append(g.upstream[id], up)
+				g.downstream[up] = append(g.downstream[up], id)
+			}
+		}
+	}
+	for id := range g.upstream {
+		g.upstream[id] = g.sorted(g.upstream[id])
+	}
+	for id := range g.downstream {
+		g.downstream[id] = g.sorted(g.downstream[id])
+	}
+	return g
+}
+
+func keys(views map[string]*models.MaterializedView) []string {
+	ids := make([]string, 0, len(views))
+	for id := range views {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// sorted orders view IDs by view name, for a stable refresh order
+func (g *mvGraph) sorted(ids []string) []string {
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := g.views[ids[i]], g.views[ids[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID < b.ID
+	})
+	return ids
+}
+
+// reach returns the given views and every view reachable from them along
+// the edges
+func (g *mvGraph) reach(ids []string, edges map[string][]string) map[string]bool {
+	seen := make(map[string]bool)
+	stack := append([]string(nil), ids...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[id] || g.views[id] == nil {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, edges[id]...)
+	}
+	return seen
+}
+
+// order sorts a set of views so every view comes after the views it reads
+func (g *mvGraph) order(set map[string]bool) ([]string, error) {
+	pending := make(map[string]int, len(set))
+	var ready []string
+	for id := range set {
+		for _, up := range g.upstream[id] {
+			if set[up] {
+				pending[id]++
+			}
+		}
+		if pending[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+
+	var ordered []string
+	for len(ready) > 0 {
+		ready = g.sorted(ready)
+		id := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, id)
+		for _, down := range g.downstream[id] {
+			if !set[down] {
+				continue
+			}
+			pending[down]--
+			if pending[down] == 0 {
+				ready = append(ready, down)
+			}
+		}
+	}
+
+	if len(ordered) < len(set) {
+		var cycle []string
+		for id := range set {
+			if pending[id] > 0 {
+				cycle = append(cycle, g.views[id].Name)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf("materialized views depend on each other in a cycle: %s", strings.Join(cycle, ", "))
+	}
+	return ordered, nil
+}
+
+// dependencyGraph loads the dependency graph of a connection's views
+func (s *MaterializedViewService) dependencyGraph(connectionID string) (*mvGraph, error) {
+	var views []models.MaterializedView
+	if err := s.db.Where("connection_id = ?", connectionID).Find(&views).Error; err != nil {
+		return nil, err
+	}
+	return newMVGraph(views), nil
+}
+
+// startRefreshChain refreshes the given views and every view built on them,
+// in dependency order, in the background. Views already refreshing on their
+// own are left out. Callers hold s.mu.
+func (s *MaterializedViewService) startRefreshChain(connectionID string, roots []string) error {
+	var connection models.Connection
+	if err := s.db.Where("id = ?", connectionID).First(&connection).Error; err != nil {
+		return fmt.Errorf("connection not found: %w", err)
+	}
+	graph, err := s.dependencyGraph(connectionID)
+	if err != nil {
+		return err
+	}
+	order, err := graph.order(graph.reach(roots, graph.downstream))
+	if err != nil {
+		return err
+	}
+
+	var chain []string
+	for _, id := range order {
+		if graph.views[id].Status != "refreshing" {
+			chain = append(chain, id)
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	s.db.Model(&models.MaterializedView{}).Where("id IN ?", chain).Updates(map[string]interface{}{
+		"status":        "refreshing",
+		"error_message": "",
+	})
+
+	go s.runRefreshChain(context.Background(), &connection, graph, chain)
+	return nil
+}
+
+// runRefreshChain refreshes views in order. A view whose upstream failed,
+// in this chain or before, is blocked instead of built from stale data.
+func (s *MaterializedViewService) runRefreshChain(ctx context.Context, connection *models.Connection, graph *mvGraph, chain []string) {
+	succeeded := make(map[string]bool, len(chain))
+	for _, id := range chain {
+		mv := graph.views[id]
+
+		var blocker *models.MaterializedView
+		for _, up := range graph.upstream[id] {
+			ok, ran := succeeded[up]
+			status := graph.views[up].Status
+			if (ran && !ok) || (!ran && (status == "error" || status == "blocked")) {
+				blocker = graph.views[up]
+				break
+			}
+		}
+		if blocker != nil {
+			s.blockRefresh(mv, blocker)
+			succeeded[id] = false
+			continue
+		}
+
+		succeeded[id] = s.refreshView(ctx, connection, mv) == nil
+	}
+}
+
+// blockRefresh records that a view was not refreshed because an upstream
+// view failed
+func (s *MaterializedViewService) blockRefresh(mv *models.MaterializedView, upstream *models.MaterializedView) {
+	message := fmt.Sprintf("blocked: upstream materialized view %s failed to refresh", upstream.Name)
+	now := time.Now()
+	s.db.Create(&models.RefreshHistory{
+		ID:               uuid.NewString(),
+		MaterializedView: mv.ID,
+		RefreshMode:      mv.RefreshMode,
+		StartedAt:        now,
+		CompletedAt:      &now,
+		Status:           "blocked",
+		ErrorMessage:     message,
+	})
+	s.db.Model(mv).Updates(map[string]interface{}{
+		"status":        "blocked",
+		"error_message": message,
+	})
+}
+
+// runScheduledRefreshes starts the refreshes due since the last tick. The
+// due views of a connection and the views built on them refresh as one
+// chain, so a view due together with its upstream waits for it.
+func (s *MaterializedViewService) runScheduledRefreshes() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	since := s.lastTick
+	now := time.Now()
+	s.lastTick = now
+
+	var scheduled []models.MaterializedView
+	if err := s.db.Where("schedule <> ''").Find(&scheduled).Error; err != nil {
+		LogWarn("mv_scheduler", "Failed to load scheduled materialized views", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	due := make(map[string][]string)
+	for _, mv := range scheduled {
+		schedule, err := cron.ParseStandard(mv.Schedule)
+		if err != nil || schedule.Next(since).After(now) {
+			continue
+		}
+		due[mv.ConnectionID] = append(due[mv.ConnectionID], mv.ID)
+	}
+	for connectionID, roots := range due {
+		if err := s.startRefreshChain(connectionID, roots); err != nil {
+			LogWarn("mv_scheduler", "Failed to start scheduled refreshes", map[string]interface{}{"connection_id": connectionID, "error": err.Error()})
+		}
+	}
+}
+
+// MVChainNode is a materialized view in a dependency chain with its
+// freshness
+type MVChainNode struct {
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	TargetTable string     `json:"targetTable"`
+	Status      string     `json:"status"`
+	LastRefresh *time.Time `json:"lastRefresh"`
+	AgeSeconds  *int64     `json:"ageSeconds"`         // Since the last refresh
+	Stale       bool       `json:"stale"`              // An upstream view has newer data
+	Upstream    []string   `json:"upstream,omitempty"` // IDs of the views it reads
+	Error       string     `json:"error,omitempty"`
+}
+
+// MVDependencyChain is the upstream and downstream views of a view, each
+// after the views it reads
+type MVDependencyChain struct {
+	ViewID string        `json:"viewId"`
+	Nodes  []MVChainNode `json:"nodes"`
+}
+
+// GetDependencyChain returns the views a view is built from and the views
+// built on it
+func (s *MaterializedViewService) GetDependencyChain(mvID string) (*MVDependencyChain, error) {
+	mv, err := s.GetMaterializedView(mvID)
+	if err != nil {
+		return nil, err
+	}
+	graph, err := s.dependencyGraph(mv.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	set := graph.reach([]string{mvID}, graph.upstream)
+	for id := range graph.reach([]string{mvID}, graph.downstream) {
+		set[id] = true
+	}
+	order, err := graph.order(set)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := &MVDependencyChain{ViewID: mvID, Nodes: make([]MVChainNode, 0, len(order))}
+	stale := make(map[string]bool, len(order))
+	for _, id := range order {
+		view := graph.views[id]
+		node := MVChainNode{
+			ID:          view.ID,
+			Name:        view.Name,
+			TargetTable: view.TargetTable,
+			Status:      view.Status,
+			LastRefresh: view.LastRefresh,
+			Error:       view.ErrorMessage,
+		}
+		if view.LastRefresh != nil {
+			age := int64(time.Since(*view.LastRefresh).Seconds())
+			node.AgeSeconds = &age
+		}
+		for _, up := range graph.upstream[id] {
+			if !set[up] {
+				continue
+			}
+			node.Upstream = append(node.Upstream, up)
+			upRefresh := graph.views[up].LastRefresh
+			if stale[up] || (upRefresh != nil && (view.LastRefresh == nil || upRefresh.After(*view.LastRefresh))) {
+				stale[id] = true
+			}
+		}
+		node.Stale = stale[id]
+		chain.Nodes = append(chain.Nodes, node)
+	}
+	return chain, nil
+}
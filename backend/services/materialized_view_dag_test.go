@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"insight-engine-backend/models"
+	"insight-engine-backend/pkg/resilience"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestReferencedTables(t *testing.T) {
+	tables := referencedTables(`SELECT o.id FROM analytics."MV_Orders" o JOIN customers c ON c.id = o.customer_id LEFT JOIN ` + "`mv_x`" + ` x ON true`)
+	assert.Equal(t, map[string]bool{"mv_orders": true, "customers": true, "mv_x": true}, tables)
+}
+
+func TestMVGraph_OrderAndCycles(t *testing.T) {
+	graph := newMVGraph([]models.MaterializedView{
+		{ID: "c", Name: "C", TargetTable: "mv_c", SourceQuery: "SELECT * FROM mv_b JOIN mv_a ON true"},
+		{ID: "b", Name: "B", TargetTable: "mv_b", SourceQuery: "SELECT * FROM mv_a"},
+		{ID: "a", Name: "A", TargetTable: "mv_a", SourceQuery: "SELECT * FROM orders"},
+		{ID: "d", Name: "D", TargetTable: "mv_d", SourceQuery: "SELECT * FROM mv_d_source"},
+	})
+	assert.Equal(t, []string{"a", "b"}, graph.upstream["c"])
+
+	order, err := graph.order(graph.reach([]string{"a"}, graph.downstream))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, order)
+
+	order, err = graph.order(graph.reach([]string{"c"}, graph.upstream))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, order)
+
+	cyclic := newMVGraph([]models.MaterializedView{
+		{ID: "x", Name: "X", TargetTable: "mv_x", SourceQuery: "SELECT * FROM mv_y"},
+		{ID: "y", Name: "Y", TargetTable: "mv_y", SourceQuery: "SELECT * FROM mv_x"},
+	})
+	_, err = cyclic.order(cyclic.reach([]string{"x"}, cyclic.downstream))
+	assert.ErrorContains(t, err, "cycle: X, Y")
+}
+
+// setupMVTest returns a view service whose connection is a SQLite database
+// holding an orders table
+func setupMVTest(t *testing.T) (*MaterializedViewService, *gorm.DB, *sql.DB, *models.Connection) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "app.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.MaterializedView{}, &models.RefreshHistory{}, &models.Connection{}))
+
+	source, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "source.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { source.Close() })
+	_, err = source.Exec(`CREATE TABLE orders (id INTEGER, amount INTEGER)`)
+	require.NoError(t, err)
+	_, err = source.Exec(`INSERT INTO orders VALUES (1, 10), (2, 20), (3, 30)`)
+	require.NoError(t, err)
+
+	conn := models.Connection{ID: "warehouse", Name: "Warehouse", Type: "sqlite", Database: "source", UserID: "u1"}
+	require.NoError(t, db.Create(&conn).Error)
+	qe := NewQueryExecutor(&resilience.MockCircuitBreaker{NameVal: "test"}, nil, nil)
+	qe.connectionPool[conn.ID] = source
+
+	svc := NewMaterializedViewService(db, qe)
+	t.Cleanup(func() { svc.cron.Stop() })
+	return svc, db, source, &conn
+}
+
+// waitForViews waits until no view is refreshing
+func waitForViews(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		var refreshing int64
+		db.Model(&models.MaterializedView{}).Where("status = ?", "refreshing").Count(&refreshing)
+		return refreshing == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMaterializedViewService_CascadingRefresh(t *testing.T) {
+	svc, db, source, conn := setupMVTest(t)
+	ctx := context.Background()
+
+	a, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Orders", "SELECT id, amount FROM orders", "full", "", nil)
+	require.NoError(t, err)
+	waitForViews(t, db)
+	b, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Big Orders", "SELECT id, amount FROM "+a.TargetTable+" WHERE amount > 15", "full", "", nil)
+	require.NoError(t, err)
+	waitForViews(t, db)
+	c, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Totals", "SELECT SUM(amount) AS total FROM "+b.TargetTable, "full", "", nil)
+	require.NoError(t, err)
+	waitForViews(t, db)
+
+	var total int64
+	require.NoError(t, source.QueryRow("SELECT total FROM "+c.TargetTable).Scan(&total))
+	assert.Equal(t, int64(50), total)
+
+	// Refreshing the first view rebuilds the views on it, in order
+	_, err = source.Exec(`INSERT INTO orders VALUES (4, 40)`)
+	require.NoError(t, err)
+	require.NoError(t, svc.RefreshMaterializedView(ctx, a.ID))
+	waitForViews(t, db)
+	require.NoError(t, source.QueryRow("SELECT total FROM "+c.TargetTable).Scan(&total))
+	assert.Equal(t, int64(90), total)
+
+	chain, err := svc.GetDependencyChain(b.ID)
+	require.NoError(t, err)
+	require.Len(t, chain.Nodes, 3)
+	assert.Equal(t, []string{a.ID, b.ID, c.ID}, []string{chain.Nodes[0].ID, chain.Nodes[1].ID, chain.Nodes[2].ID})
+	assert.Equal(t, []string{a.ID}, chain.Nodes[1].Upstream)
+	for _, node := range chain.Nodes {
+		assert.Equal(t, "idle", node.Status)
+		assert.False(t, node.Stale, node.Name)
+		assert.NotNil(t, node.AgeSeconds)
+	}
+
+	assert.ErrorContains(t, svc.DropMaterializedView(ctx, a.ID), "read by Big Orders")
+
+	// A failed upstream blocks the views built on it
+	_, err = source.Exec(`ALTER TABLE orders RENAME TO orders_old`)
+	require.NoError(t, err)
+	require.NoError(t, svc.RefreshMaterializedView(ctx, a.ID))
+	waitForViews(t, db)
+	chain, err = svc.GetDependencyChain(c.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error", "blocked", "blocked"}, []string{chain.Nodes[0].Status, chain.Nodes[1].Status, chain.Nodes[2].Status})
+	assert.Contains(t, chain.Nodes[2].Error, "Big Orders failed")
+
+	// ...also when they are refreshed on their own
+	require.NoError(t, svc.RefreshMaterializedView(ctx, b.ID))
+	waitForViews(t, db)
+	history, err := svc.GetRefreshHistory(b.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "blocked", history[0].Status)
+	require.NoError(t, source.QueryRow("SELECT total FROM "+c.TargetTable).Scan(&total))
+	assert.Equal(t, int64(90), total, "blocked views keep their data")
+
+	_, err = source.Exec(`ALTER TABLE orders_old RENAME TO orders`)
+	require.NoError(t, err)
+	require.NoError(t, svc.RefreshMaterializedView(ctx, a.ID))
+	waitForViews(t, db)
+	chain, err = svc.GetDependencyChain(c.ID)
+	require.NoError(t, err)
+	for _, node := range chain.Nodes {
+		assert.Equal(t, "idle", node.Status)
+	}
+}
+
+func TestMaterializedViewService_ScheduledChain(t *testing.T) {
+	svc, db, source, conn := setupMVTest(t)
+	ctx := context.Background()
+
+	a, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Orders", "SELECT id, amount FROM orders", "full", "*/5 * * * *", nil)
+	require.NoError(t, err)
+	waitForViews(t, db)
+	b, err := svc.CreateMaterializedView(ctx, "u1", conn.ID, "Totals", "SELECT SUM(amount) AS total FROM "+a.TargetTable, "full", "0 0 1 1 *", nil)
+	require.NoError(t, err)
+	waitForViews(t, db)
+
+	// A later refresh of the upstream leaves the downstream stale
+	require.NoError(t, db.Model(&models.MaterializedView{}).Where("id = ?", a.ID).Update("last_refresh", time.Now().Add(time.Hour)).Error)
+	chain, err := svc.GetDependencyChain(b.ID)
+	require.NoError(t, err)
+	assert.True(t, chain.Nodes[1].Stale)
+
+	// The upstream is due: the scheduler refreshes it and then the view
+	// built on it, though the latter is not due itself
+	_, err = source.Exec(`INSERT INTO orders VALUES (4, 40)`)
+	require.NoError(t, err)
+	svc.mu.Lock()
+	svc.lastTick = time.Now().Add(-5 * time.Minute)
+	svc.mu.Unlock()
+	svc.runScheduledRefreshes()
+	waitForViews(t, db)
+
+	var total int64
+	require.NoError(t, source.QueryRow("SELECT total FROM "+b.TargetTable).Scan(&total))
+	assert.Equal(t, int64(100), total)
+	var refreshed models.MaterializedView
+	require.NoError(t, db.First(&refreshed, "id = ?", b.ID).Error)
+	assert.Equal(t, 2, refreshed.RefreshCount)
+}
@@ -0,0 +1,771 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"insight-engine-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// The semantic layer and modeling accepted ROUND, CAST and COALESCE
+	// formulas, and REPLACE as a string function, before the registry
+	metricAggregatePattern = regexp.MustCompile(`(?i)\b(SUM|AVG|COUNT|MIN|MAX|ROUND|CAST|COALESCE)\s*\(`)
+	metricForbiddenPattern = regexp.MustCompile(`(?i)\b(DROP|DELETE|UPDATE|INSERT|ALTER|CREATE|EXEC|EXECUTE|TRUNCATE|GRANT|REVOKE|MERGE)\b`)
+
+	validMetricDataTypes = map[string]bool{
+		"number": true, "currency": true, "percentage": true,
+		"count": true, "decimal": true,
+	}
+	validMetricAggregationTypes = map[string]bool{
+		"sum": true, "avg": true, "count": true,
+		"min": true, "max": true, "count_distinct": true,
+	}
+)
+
+// ValidateMetricFormula is the single formula validation shared by the metric
+// registry, the semantic layer and the modeling service
+func ValidateMetricFormula(formula string) error {
+	if strings.TrimSpace(formula) == "" {
+		return fmt.Errorf("formula cannot be empty")
+	}
+	if strings.Contains(formula, ";") || strings.Contains(formula, "--") || strings.Contains(formula, "/*") {
+		return fmt.Errorf("formula cannot contain statement separators or comments")
+	}
+	if match := metricForbiddenPattern.FindString(formula); match != "" {
+		return fmt.Errorf("formula contains forbidden keyword: %s", strings.ToUpper(match))
+	}
+	if !metricAggregatePattern.MatchString(formula) {
+		return fmt.Errorf("formula must contain a valid aggregation function (SUM, AVG, COUNT, MIN, MAX)")
+	}
+	return nil
+}
+
+// normalizeMetricFormula canonicalizes a formula for equivalence checks:
+// whitespace is collapsed and everything outside string literals is upper-cased
+func normalizeMetricFormula(formula string) string {
+	var b strings.Builder
+	var last rune
+	inString := false
+	pendingSpace := false
+	for _, r := range strings.TrimSpace(formula) {
+		if !inString && unicode.IsSpace(r) {
+			pendingSpace = true
+			continue
+		}
+		// Spaces next to punctuation carry no meaning
+		if pendingSpace && !strings.ContainsRune("(,*/+-", last) && !strings.ContainsRune("),*/+-", r) {
+			b.WriteRune(' ')
+		}
+		pendingSpace = false
+		if r == '\'' {
+			inString = !inString
+		}
+		if !inString {
+			r = unicode.ToUpper(r)
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
+
+// MetricConflict is a legacy metric that could not be merged into the registry
+type MetricConflict struct {
+	WorkspaceID      string `json:"workspaceId"`
+	Name             string `json:"name"`
+	Source           string `json:"source"` // <system>:<scope>/<legacy id>
+	Formula          string `json:"formula"`
+	MetricID         string `json:"metricId,omitempty"`
+	CanonicalFormula string `json:"canonicalFormula,omitempty"`
+	Reason           string `json:"reason"`
+}
+
+// MetricMigrationReport summarizes a conversion of legacy metric definitions
+type MetricMigrationReport struct {
+	DryRun       bool             `json:"dryRun"`
+	Scanned      int              `json:"scanned"`
+	Created      int              `json:"created"`
+	Bound        int              `json:"bound"`
+	AlreadyBound int              `json:"alreadyBound"`
+	Conflicts    []MetricConflict `json:"conflicts"`
+	Invalid      []MetricConflict `json:"invalid"`
+}
+
+// legacyMetric is a metric as defined by the semantic layer or the modeling service
+type legacyMetric struct {
+	System          string
+	ScopeID         string
+	LegacyID        string
+	WorkspaceID     string
+	Name            string
+	Description     string
+	Formula         string
+	DataType        string
+	Format          string
+	AggregationType string
+	CreatedBy       string
+	CreatedAt       time.Time
+}
+
+func (l legacyMetric) source() string {
+	return fmt.Sprintf("%s:%s/%s", l.System, l.ScopeID, l.LegacyID)
+}
+
+func legacyFromSemantic(model *models.SemanticModel, metric models.SemanticMetric) legacyMetric {
+	dataType := "number"
+	if validMetricDataTypes[metric.Format] {
+		dataType = metric.Format
+	}
+	return legacyMetric{
+		System:      models.MetricSystemSemanticLayer,
+		ScopeID:     model.ID,
+		LegacyID:    metric.ID,
+		WorkspaceID: model.WorkspaceID,
+		Name:        metric.Name,
+		Description: metric.Description,
+		Formula:     metric.Formula,
+		DataType:    dataType,
+		Format:      metric.Format,
+		CreatedBy:   model.CreatedBy,
+		CreatedAt:   metric.CreatedAt,
+	}
+}
+
+func legacyFromDefinition(metric *models.MetricDefinition) legacyMetric {
+	return legacyMetric{
+		System:          models.MetricSystemModeling,
+		ScopeID:         metric.WorkspaceID,
+		LegacyID:        metric.ID,
+		WorkspaceID:     metric.WorkspaceID,
+		Name:            metric.Name,
+		Description:     metric.Description,
+		Formula:         metric.Formula,
+		DataType:        metric.DataType,
+		Format:          metric.Format,
+		AggregationType: metric.AggregationType,
+		CreatedBy:       metric.CreatedBy,
+		CreatedAt:       metric.CreatedAt,
+	}
+}
+
+// sortLegacyMetrics orders legacy metrics so the earliest definition of a name becomes canonical
+func sortLegacyMetrics(metrics []legacyMetric) {
+	sort.SliceStable(metrics, func(i, j int) bool {
+		if !metrics[i].CreatedAt.Equal(metrics[j].CreatedAt) {
+			return metrics[i].CreatedAt.Before(metrics[j].CreatedAt)
+		}
+		if metrics[i].System != metrics[j].System {
+			// Modeling definitions carry the richest metadata
+			return metrics[i].System == models.MetricSystemModeling
+		}
+		return metrics[i].LegacyID < metrics[j].LegacyID
+	})
+}
+
+// MetricRegistryService owns the canonical, workspace-wide metric definitions.
+// Semantic model metrics and modeling metric definitions are kept as bound
+// projections so every consumer resolves a metric name to the same formula.
+type MetricRegistryService struct {
+	db *gorm.DB
+}
+
+// NewMetricRegistryService creates a new metric registry service
+func NewMetricRegistryService(db *gorm.DB) *MetricRegistryService {
+	return &MetricRegistryService{db: db}
+}
+
+// AutoMigrate creates the registry tables
+func (s *MetricRegistryService) AutoMigrate() error {
+	return s.db.AutoMigrate(&models.RegistryMetric{}, &models.RegistryMetricBinding{})
+}
+
+// List returns the registry metrics of a workspace
+func (s *MetricRegistryService) List(workspaceID string, includeDeprecated bool) ([]models.RegistryMetric, error) {
+	var metrics []models.RegistryMetric
+	query := s.db.Preload("Bindings").Where("workspace_id = ?", workspaceID)
+	if !includeDeprecated {
+		query = query.Where("status = ?", models.MetricStatusActive)
+	}
+	err := query.Order("name ASC").Find(&metrics).Error
+	return metrics, err
+}
+
+// Get returns a registry metric with its bindings
+func (s *MetricRegistryService) Get(id string) (*models.RegistryMetric, error) {
+	var metric models.RegistryMetric
+	if err := s.db.Preload("Bindings").First(&metric, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &metric, nil
+}
+
+// MetricsForConnection returns the active registry metrics bound to semantic models of a connection
+func (s *MetricRegistryService) MetricsForConnection(connID string) ([]models.RegistryMetric, error) {
+	var metrics []models.RegistryMetric
+	err := s.db.Where("status = ?", models.MetricStatusActive).
+		Where("id IN (?)", s.db.Model(&models.RegistryMetricBinding{}).Select("metric_id").
+			Where("system = ?", models.MetricSystemSemanticLayer).
+			Where("scope_id IN (?)", s.db.Model(&models.SemanticModel{}).Select("id").Where("data_source_id = ?", connID))).
+		Order("name ASC").
+		Find(&metrics).Error
+	return metrics, err
+}
+
+// UnboundSemanticMetrics returns the metrics of a connection's semantic models
+// that are not bound to the registry yet, e.g. because they were never migrated
+func (s *MetricRegistryService) UnboundSemanticMetrics(connID string) ([]models.SemanticMetric, error) {
+	var metrics []models.SemanticMetric
+	err := s.db.Where("model_id IN (?)", s.db.Model(&models.SemanticModel{}).Select("id").Where("data_source_id = ?", connID)).
+		Where("id NOT IN (?)", s.db.Model(&models.RegistryMetricBinding{}).Select("legacy_id").
+			Where("system = ? AND legacy_id IS NOT NULL", models.MetricSystemSemanticLayer)).
+		Order("name ASC").
+		Find(&metrics).Error
+	return metrics, err
+}
+
+// ResolveMetricID maps a registry ID or the ID of a bound legacy metric to the registry ID
+func (s *MetricRegistryService) ResolveMetricID(id string) (string, error) {
+	var count int64
+	if err := s.db.Model(&models.RegistryMetric{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return id, nil
+	}
+
+	var binding models.RegistryMetricBinding
+	if err := s.db.Where("legacy_id = ?", id).First(&binding).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("metric not found in registry: %s", id)
+		}
+		return "", err
+	}
+	return binding.MetricID, nil
+}
+
+func validateRegistryMetric(metric *models.RegistryMetric) error {
+	if strings.TrimSpace(metric.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if metric.WorkspaceID == "" {
+		return fmt.Errorf("workspace is required")
+	}
+	if metric.DataType == "" {
+		metric.DataType = "number"
+	}
+	if !validMetricDataTypes[metric.DataType] {
+		return fmt.Errorf("invalid data type: %s", metric.DataType)
+	}
+	if metric.AggregationType != "" && !validMetricAggregationTypes[metric.AggregationType] {
+		return fmt.Errorf("invalid aggregation type: %s", metric.AggregationType)
+	}
+	if metric.Status == "" {
+		metric.Status = models.MetricStatusActive
+	}
+	if metric.Status != models.MetricStatusActive && metric.Status != models.MetricStatusDeprecated {
+		return fmt.Errorf("invalid status: %s", metric.Status)
+	}
+	return ValidateMetricFormula(metric.Formula)
+}
+
+// Create registers a new metric and projects it into the modeling definitions of its workspace
+func (s *MetricRegistryService) Create(metric *models.RegistryMetric) error {
+	if err := validateRegistryMetric(metric); err != nil {
+		return err
+	}
+	if metric.ID == "" {
+		metric.ID = uuid.New().String()
+	}
+	if metric.Origin == "" {
+		metric.Origin = models.MetricSystemRegistry
+	}
+	metric.Version = 1
+	metric.Bindings = nil
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(metric).Error; err != nil {
+			return err
+		}
+		return s.ensureModelingProjection(tx, metric)
+	})
+}
+
+// Update changes a registry metric, bumps its version and propagates it to every bound projection
+func (s *MetricRegistryService) Update(metric *models.RegistryMetric) error {
+	if err := validateRegistryMetric(metric); err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var existing models.RegistryMetric
+		if err := tx.First(&existing, "id = ?", metric.ID).Error; err != nil {
+			return err
+		}
+		metric.WorkspaceID = existing.WorkspaceID
+		metric.Origin = existing.Origin
+		metric.CreatedBy = existing.CreatedBy
+		metric.CreatedAt = existing.CreatedAt
+		metric.Version = existing.Version + 1
+		metric.Bindings = nil
+
+		if err := tx.Save(metric).Error; err != nil {
+			return err
+		}
+		return s.projectBindings(tx, metric, nil)
+	})
+}
+
+// Delete removes a registry metric that is no longer used by any semantic model.
+// Its modeling projection is removed and glossary mappings are detached.
+func (s *MetricRegistryService) Delete(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var bindings []models.RegistryMetricBinding
+		if err := tx.Where("metric_id = ?", id).Find(&bindings).Error; err != nil {
+			return err
+		}
+		for _, b := range bindings {
+			switch b.System {
+			case models.MetricSystemSemanticLayer:
+				return fmt.Errorf("metric is used by semantic model %s; deprecate it instead", b.ScopeID)
+			case models.MetricSystemModeling:
+				if err := tx.Delete(&models.MetricDefinition{}, "id = ?", b.LegacyID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := tx.Model(&models.TermColumnMapping{}).Where("metric_id = ?", id).Update("metric_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("metric_id = ?", id).Delete(&models.RegistryMetricBinding{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.RegistryMetric{}, "id = ?", id).Error
+	})
+}
+
+// BindToSemanticModel adds a registry metric to a semantic model of the same workspace
+func (s *MetricRegistryService) BindToSemanticModel(metricID, modelID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var metric models.RegistryMetric
+		if err := tx.First(&metric, "id = ?", metricID).Error; err != nil {
+			return err
+		}
+		var model models.SemanticModel
+		if err := tx.First(&model, "id = ?", modelID).Error; err != nil {
+			return fmt.Errorf("semantic model not found: %s", modelID)
+		}
+		if model.WorkspaceID != metric.WorkspaceID {
+			return fmt.Errorf("semantic model belongs to another workspace")
+		}
+
+		var existing models.SemanticMetric
+		err := tx.Where("model_id = ? AND name = ?", modelID, metric.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			if normalizeMetricFormula(existing.Formula) != normalizeMetricFormula(metric.Formula) {
+				return fmt.Errorf("semantic model already defines %s with a different formula", metric.Name)
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			existing = models.SemanticMetric{
+				ID:          uuid.New().String(),
+				ModelID:     modelID,
+				Name:        metric.Name,
+				Formula:     metric.Formula,
+				Description: metric.Description,
+				Format:      metric.Format,
+			}
+			if err := tx.Create(&existing).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return s.bind(tx, metric.ID, models.MetricSystemSemanticLayer, modelID, metric.Name, existing.ID)
+	})
+}
+
+// SyncSemanticModel registers the metrics of a created or updated semantic model.
+// Metrics already bound update the registry; new ones are merged by name or
+// registered, and formula mismatches are reported as conflicts.
+func (s *MetricRegistryService) SyncSemanticModel(model *models.SemanticModel) []MetricConflict {
+	report := &MetricMigrationReport{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var bindings []models.RegistryMetricBinding
+		if err := tx.Where("system = ? AND scope_id = ?", models.MetricSystemSemanticLayer, model.ID).Find(&bindings).Error; err != nil {
+			return err
+		}
+		// Bindings are matched like findBinding does, so a renamed metric keeps its binding
+		current := make(map[string]bool, 2*len(model.Metrics))
+		for _, metric := range model.Metrics {
+			current[metric.Name] = true
+			current[metric.ID] = true
+			if err := s.syncLegacy(tx, legacyFromSemantic(model, metric), report); err != nil {
+				return err
+			}
+		}
+		for _, b := range bindings {
+			if !current[b.Name] && !current[b.LegacyID] {
+				if err := tx.Delete(&b).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		LogWarn("metric_registry_sync", "Failed to sync semantic model metrics", map[string]interface{}{"model_id": model.ID, "error": err.Error()})
+	}
+	logMetricConflicts(report.Conflicts)
+	return report.Conflicts
+}
+
+// UnbindSemanticModel drops the bindings of a deleted semantic model
+func (s *MetricRegistryService) UnbindSemanticModel(modelID string) error {
+	return s.db.Where("system = ? AND scope_id = ?", models.MetricSystemSemanticLayer, modelID).
+		Delete(&models.RegistryMetricBinding{}).Error
+}
+
+// SyncMetricDefinition registers a created or updated modeling metric definition
+func (s *MetricRegistryService) SyncMetricDefinition(metric *models.MetricDefinition) []MetricConflict {
+	report := &MetricMigrationReport{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return s.syncLegacy(tx, legacyFromDefinition(metric), report)
+	})
+	if err != nil {
+		LogWarn("metric_registry_sync", "Failed to sync metric definition", map[string]interface{}{"metric_id": metric.ID, "error": err.Error()})
+	}
+	logMetricConflicts(report.Conflicts)
+	return report.Conflicts
+}
+
+// UnbindMetricDefinition drops the binding of a deleted modeling metric definition
+func (s *MetricRegistryService) UnbindMetricDefinition(id string) error {
+	return s.db.Where("system = ? AND legacy_id = ?", models.MetricSystemModeling, id).
+		Delete(&models.RegistryMetricBinding{}).Error
+}
+
+// MigrateLegacyMetrics converts semantic layer and modeling metrics into registry
+// metrics. The earliest definition of a name becomes canonical; later definitions
+// with an equivalent formula are bound to it and the rest are reported as
+// conflicts. Re-running it is a no-op for already bound metrics. A dry run
+// reports the outcome without persisting anything.
+func (s *MetricRegistryService) MigrateLegacyMetrics(workspaceID string, dryRun bool) (*MetricMigrationReport, error) {
+	if workspaceID == "" {
+		return nil, errors.New("workspace ID is required")
+	}
+
+	var semanticModels []models.SemanticModel
+	if err := s.db.Preload("Metrics").Where("workspace_id = ?", workspaceID).Find(&semanticModels).Error; err != nil {
+		return nil, err
+	}
+
+	var definitions []models.MetricDefinition
+	if err := s.db.Where("workspace_id = ?", workspaceID).Find(&definitions).Error; err != nil {
+		return nil, err
+	}
+
+	var legacy []legacyMetric
+	for i := range semanticModels {
+		for _, metric := range semanticModels[i].Metrics {
+			legacy = append(legacy, legacyFromSemantic(&semanticModels[i], metric))
+		}
+	}
+	for i := range definitions {
+		legacy = append(legacy, legacyFromDefinition(&definitions[i]))
+	}
+	sortLegacyMetrics(legacy)
+
+	report := &MetricMigrationReport{DryRun: dryRun, Scanned: len(legacy), Conflicts: []MetricConflict{}, Invalid: []MetricConflict{}}
+	errDryRun := errors.New("dry run")
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, l := range legacy {
+			if err := s.registerLegacy(tx, l, report); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+// syncLegacy applies a live legacy write: bound metrics push their definition to
+// the registry and its other projections, unbound ones are registered
+func (s *MetricRegistryService) syncLegacy(tx *gorm.DB, l legacyMetric, report *MetricMigrationReport) error {
+	binding, err := s.findBinding(tx, l)
+	if err != nil {
+		return err
+	}
+	if binding == nil {
+		return s.registerLegacy(tx, l, report)
+	}
+
+	if err := ValidateMetricFormula(l.Formula); err != nil {
+		return err
+	}
+	var metric models.RegistryMetric
+	if err := tx.First(&metric, "id = ?", binding.MetricID).Error; err != nil {
+		return err
+	}
+
+	// A rename carries over to the registry and the other projections, unless
+	// another registry metric of the workspace already has the name
+	if metric.Name != l.Name {
+		var taken int64
+		if err := tx.Model(&models.RegistryMetric{}).
+			Where("workspace_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", metric.WorkspaceID, l.Name, metric.ID).
+			Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			report.Conflicts = append(report.Conflicts, MetricConflict{
+				WorkspaceID: l.WorkspaceID, Name: l.Name, Source: l.source(), Formula: l.Formula,
+				MetricID: metric.ID, CanonicalFormula: metric.Formula,
+				Reason: "renamed to the name of another registry metric",
+			})
+			return nil
+		}
+	}
+
+	binding.Name = l.Name
+	binding.LegacyID = l.LegacyID
+	if err := tx.Save(binding).Error; err != nil {
+		return err
+	}
+
+	if metric.Name == l.Name && normalizeMetricFormula(metric.Formula) == normalizeMetricFormula(l.Formula) &&
+		metric.Description == l.Description && metric.Format == l.Format {
+		return nil
+	}
+	metric.Name = l.Name
+	metric.Formula = l.Formula
+	metric.Description = l.Description
+	metric.Format = l.Format
+	if l.System == models.MetricSystemModeling {
+		metric.DataType = l.DataType
+		metric.AggregationType = l.AggregationType
+	}
+	metric.Version++
+	if err := tx.Save(&metric).Error; err != nil {
+		return err
+	}
+	return s.projectBindings(tx, &metric, binding)
+}
+
+// registerLegacy binds a legacy metric to the registry metric of the same name,
+// creating it when the name is new
+func (s *MetricRegistryService) registerLegacy(tx *gorm.DB, l legacyMetric, report *MetricMigrationReport) error {
+	binding, err := s.findBinding(tx, l)
+	if err != nil {
+		return err
+	}
+	if binding != nil {
+		report.AlreadyBound++
+		return nil
+	}
+
+	if err := ValidateMetricFormula(l.Formula); err != nil {
+		report.Invalid = append(report.Invalid, MetricConflict{
+			WorkspaceID: l.WorkspaceID, Name: l.Name, Source: l.source(), Formula: l.Formula, Reason: err.Error(),
+		})
+		return nil
+	}
+
+	var metric models.RegistryMetric
+	err = tx.Where("workspace_id = ? AND LOWER(name) = LOWER(?)", l.WorkspaceID, l.Name).First(&metric).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		dataType := l.DataType
+		if !validMetricDataTypes[dataType] {
+			dataType = "number"
+		}
+		metric = models.RegistryMetric{
+			ID:              uuid.New().String(),
+			WorkspaceID:     l.WorkspaceID,
+			Name:            l.Name,
+			Description:     l.Description,
+			Formula:         l.Formula,
+			DataType:        dataType,
+			Format:          l.Format,
+			AggregationType: l.AggregationType,
+			Owner:           l.CreatedBy,
+			Status:          models.MetricStatusActive,
+			Version:         1,
+			Origin:          l.System,
+			CreatedBy:       l.CreatedBy,
+		}
+		if err := tx.Create(&metric).Error; err != nil {
+			return err
+		}
+		if err := s.bind(tx, metric.ID, l.System, l.ScopeID, l.Name, l.LegacyID); err != nil {
+			return err
+		}
+		report.Created++
+		if l.System == models.MetricSystemSemanticLayer {
+			return s.ensureModelingProjection(tx, &metric)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if normalizeMetricFormula(metric.Formula) != normalizeMetricFormula(l.Formula) {
+		report.Conflicts = append(report.Conflicts, MetricConflict{
+			WorkspaceID:      l.WorkspaceID,
+			Name:             l.Name,
+			Source:           l.source(),
+			Formula:          l.Formula,
+			MetricID:         metric.ID,
+			CanonicalFormula: metric.Formula,
+			Reason:           "formula differs from the registry definition",
+		})
+		return nil
+	}
+	if err := s.bind(tx, metric.ID, l.System, l.ScopeID, l.Name, l.LegacyID); err != nil {
+		return err
+	}
+	report.Bound++
+	return nil
+}
+
+// ensureModelingProjection makes a registry metric visible to the modeling service
+func (s *MetricRegistryService) ensureModelingProjection(tx *gorm.DB, metric *models.RegistryMetric) error {
+	var count int64
+	if err := tx.Model(&models.RegistryMetricBinding{}).
+		Where("metric_id = ? AND system = ?", metric.ID, models.MetricSystemModeling).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var definition models.MetricDefinition
+	err := tx.Where("workspace_id = ? AND name = ?", metric.WorkspaceID, metric.Name).First(&definition).Error
+	switch {
+	case err == nil:
+		// A differing definition stays unbound and is reported when it is registered
+		if normalizeMetricFormula(definition.Formula) != normalizeMetricFormula(metric.Formula) {
+			return nil
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		definition = models.MetricDefinition{
+			ID:              uuid.New().String(),
+			Name:            metric.Name,
+			Description:     metric.Description,
+			Formula:         metric.Formula,
+			DataType:        metric.DataType,
+			Format:          metric.Format,
+			AggregationType: metric.AggregationType,
+			WorkspaceID:     metric.WorkspaceID,
+			CreatedBy:       metric.CreatedBy,
+		}
+		if err := tx.Create(&definition).Error; err != nil {
+			return err
+		}
+	default:
+		return err
+	}
+	return s.bind(tx, metric.ID, models.MetricSystemModeling, metric.WorkspaceID, definition.Name, definition.ID)
+}
+
+// projectBindings writes a registry metric to its bound projections, skipping the one that originated the change
+func (s *MetricRegistryService) projectBindings(tx *gorm.DB, metric *models.RegistryMetric, origin *models.RegistryMetricBinding) error {
+	var bindings []models.RegistryMetricBinding
+	if err := tx.Where("metric_id = ?", metric.ID).Find(&bindings).Error; err != nil {
+		return err
+	}
+
+	for _, b := range bindings {
+		if origin != nil && b.ID == origin.ID {
+			continue
+		}
+		switch b.System {
+		case models.MetricSystemSemanticLayer:
+			if err := tx.Model(&models.SemanticMetric{}).
+				Where("model_id = ? AND name = ?", b.ScopeID, b.Name).
+				Updates(map[string]interface{}{
+					"name":        metric.Name,
+					"formula":     metric.Formula,
+					"description": metric.Description,
+					"format":      metric.Format,
+				}).Error; err != nil {
+				return err
+			}
+		case models.MetricSystemModeling:
+			if err := tx.Model(&models.MetricDefinition{}).
+				Where("id = ?", b.LegacyID).
+				Updates(map[string]interface{}{
+					"name":             metric.Name,
+					"formula":          metric.Formula,
+					"description":      metric.Description,
+					"format":           metric.Format,
+					"data_type":        metric.DataType,
+					"aggregation_type": metric.AggregationType,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		if b.Name != metric.Name {
+			if err := tx.Model(&b).Update("name", metric.Name).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findBinding looks a legacy metric up by its legacy ID, then by its name in the
+// same scope (semantic model updates recreate metric rows with new IDs)
+func (s *MetricRegistryService) findBinding(tx *gorm.DB, l legacyMetric) (*models.RegistryMetricBinding, error) {
+	var binding models.RegistryMetricBinding
+	err := tx.Where("system = ? AND legacy_id = ?", l.System, l.LegacyID).First(&binding).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = tx.Where("system = ? AND scope_id = ? AND name = ?", l.System, l.ScopeID, l.Name).First(&binding).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+func (s *MetricRegistryService) bind(tx *gorm.DB, metricID, system, scopeID, name, legacyID string) error {
+	return tx.Create(&models.RegistryMetricBinding{
+		ID:       uuid.New().String(),
+		MetricID: metricID,
+		System:   system,
+		ScopeID:  scopeID,
+		Name:     name,
+		LegacyID: legacyID,
+	}).Error
+}
+
+func logMetricConflicts(conflicts []MetricConflict) {
+	for _, c := range conflicts {
+		LogWarn("metric_registry_conflict", "Metric definition conflicts with the registry", map[string]interface{}{
+			"workspace_id": c.WorkspaceID,
+			"name":         c.Name,
+			"source":       c.Source,
+			"metric_id":    c.MetricID,
+		})
+	}
+}
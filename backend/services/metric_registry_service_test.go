@@ -0,0 +1,103 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMetricFormula(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula string
+		ok      bool
+	}{
+		{"sum", "SUM(amount)", true},
+		{"distinct count", "count(DISTINCT customer_id)", true},
+		{"ratio with rounding", "ROUND(SUM(profit) / NULLIF(SUM(revenue), 0), 2)", true},
+		{"columns containing keywords", "MAX(updated_at) - MIN(created_at)", true},
+		{"empty", "  ", false},
+		{"coalesce", "COALESCE(amount, 0)", true},
+		{"cast", "CAST(amount AS DECIMAL(10, 2))", true},
+		{"no aggregation", "amount * 2", false},
+		{"column named like a function", "summary_total", false},
+		{"statement separator", "SUM(amount); DROP TABLE sales", false},
+		{"comment", "SUM(amount) -- note", false},
+		{"forbidden keyword", "SUM((SELECT 1 FROM x WHERE EXISTS (DELETE FROM y)))", false},
+		{"replace function", "COUNT(REPLACE(code, 'a', 'b'))", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMetricFormula(tt.formula)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNormalizeMetricFormula(t *testing.T) {
+	assert.Equal(t, normalizeMetricFormula("SUM(amount)"), normalizeMetricFormula("  sum( amount )\n"))
+	assert.Equal(t, normalizeMetricFormula("SUM(a) / COUNT(*)"), normalizeMetricFormula("sum(a)/count(*)"))
+	assert.Equal(t, "COUNT(DISTINCT CUSTOMER_ID)", normalizeMetricFormula("count(distinct   customer_id)"))
+	assert.NotEqual(t, normalizeMetricFormula("SUM(CASE WHEN s = 'Open' THEN 1 END)"), normalizeMetricFormula("SUM(CASE WHEN s = 'open' THEN 1 END)"))
+	assert.NotEqual(t, normalizeMetricFormula("SUM(amount)"), normalizeMetricFormula("AVG(amount)"))
+}
+
+func TestSortLegacyMetrics(t *testing.T) {
+	early := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+
+	metrics := []legacyMetric{
+		{System: models.MetricSystemSemanticLayer, LegacyID: "s2", CreatedAt: late},
+		{System: models.MetricSystemSemanticLayer, LegacyID: "s1", CreatedAt: early},
+		{System: models.MetricSystemModeling, LegacyID: "m1", CreatedAt: early},
+	}
+	sortLegacyMetrics(metrics)
+
+	assert.Equal(t, "m1", metrics[0].LegacyID)
+	assert.Equal(t, "s1", metrics[1].LegacyID)
+	assert.Equal(t, "s2", metrics[2].LegacyID)
+}
+
+func TestSyncSemanticModel_RenamePropagates(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+	require.NoError(t, db.AutoMigrate(&models.SemanticModel{}, &models.SemanticMetric{}, &models.MetricDefinition{}))
+	registry := NewMetricRegistryService(db)
+	require.NoError(t, registry.AutoMigrate())
+
+	model := models.SemanticModel{
+		ID: "m1", Name: "Sales", DataSourceID: "c1", Table: "sales", WorkspaceID: "ws", CreatedBy: "u1",
+		Metrics: []models.SemanticMetric{{ID: "sm1", ModelID: "m1", Name: "Revenue", Formula: "SUM(amount)"}},
+	}
+	require.NoError(t, db.Create(&model).Error)
+	assert.Empty(t, registry.SyncSemanticModel(&model))
+
+	model.Metrics[0].Name = "Net Revenue"
+	require.NoError(t, db.Save(&model.Metrics[0]).Error)
+	assert.Empty(t, registry.SyncSemanticModel(&model))
+
+	var metric models.RegistryMetric
+	require.NoError(t, db.First(&metric, "workspace_id = ?", "ws").Error)
+	assert.Equal(t, "Net Revenue", metric.Name)
+	var definition models.MetricDefinition
+	require.NoError(t, db.First(&definition, "workspace_id = ?", "ws").Error)
+	assert.Equal(t, "Net Revenue", definition.Name, "the modeling projection follows the rename")
+	var bindings int64
+	db.Model(&models.RegistryMetricBinding{}).Where("metric_id = ? AND name = ?", metric.ID, "Net Revenue").Count(&bindings)
+	assert.Equal(t, int64(2), bindings)
+
+	// Metrics never synced to the registry are still reported for the connection
+	require.NoError(t, db.Create(&models.SemanticMetric{ID: "sm2", ModelID: "m1", Name: "Orders", Formula: "COUNT(*)"}).Error)
+	unbound, err := registry.UnboundSemanticMetrics("c1")
+	require.NoError(t, err)
+	require.Len(t, unbound, 1)
+	assert.Equal(t, "Orders", unbound[0].Name)
+}
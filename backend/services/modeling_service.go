@@ -3,19 +3,24 @@ package services
 import (
 	"fmt"
 	"insight-engine-backend/models"
-	"strings"
 
 	"gorm.io/gorm"
 )
 
 type ModelingService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	metricRegistry *MetricRegistryService
 }
 
 func NewModelingService(db *gorm.DB) *ModelingService {
 	return &ModelingService{db: db}
 }
 
+// SetMetricRegistry registers metric definitions in the shared metric registry on every write
+func (s *ModelingService) SetMetricRegistry(registry *MetricRegistryService) {
+	s.metricRegistry = registry
+}
+
 // Model Definitions
 
 func (s *ModelingService) ListModelDefinitions(workspaceID string) ([]models.ModelDefinition, error) {
@@ -130,7 +135,13 @@ func (s *ModelingService) CreateMetricDefinition(metric *models.MetricDefinition
 		}
 	}
 
-	return s.db.Create(metric).Error
+	if err := s.db.Create(metric).Error; err != nil {
+		return err
+	}
+	if s.metricRegistry != nil {
+		s.metricRegistry.SyncMetricDefinition(metric)
+	}
+	return nil
 }
 
 func (s *ModelingService) UpdateMetricDefinition(metric *models.MetricDefinition) error {
@@ -148,50 +159,26 @@ func (s *ModelingService) UpdateMetricDefinition(metric *models.MetricDefinition
 		return err
 	}
 
-	return s.db.Save(metric).Error
+	if err := s.db.Save(metric).Error; err != nil {
+		return err
+	}
+	if s.metricRegistry != nil {
+		s.metricRegistry.SyncMetricDefinition(metric)
+	}
+	return nil
 }
 
 func (s *ModelingService) DeleteMetricDefinition(id string) error {
-	return s.db.Delete(&models.MetricDefinition{}, "id = ?", id).Error
+	if err := s.db.Delete(&models.MetricDefinition{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if s.metricRegistry != nil {
+		return s.metricRegistry.UnbindMetricDefinition(id)
+	}
+	return nil
 }
 
 // ValidateFormula validates metric formula for security
 func (s *ModelingService) ValidateFormula(formula string) error {
-	if formula == "" {
-		return fmt.Errorf("formula cannot be empty")
-	}
-
-	// Check for allowed aggregation functions
-	allowedFunctions := []string{
-		"SUM", "AVG", "COUNT", "MIN", "MAX",
-		"COUNT(DISTINCT", "ROUND", "CAST", "COALESCE",
-	}
-
-	upperFormula := strings.ToUpper(formula)
-	hasValidFunction := false
-	for _, fn := range allowedFunctions {
-		if strings.Contains(upperFormula, fn) {
-			hasValidFunction = true
-			break
-		}
-	}
-
-	if !hasValidFunction {
-		return fmt.Errorf("formula must contain a valid aggregation function (SUM, AVG, COUNT, MIN, MAX)")
-	}
-
-	// Check for dangerous keywords
-	dangerousKeywords := []string{
-		"DROP", "DELETE", "UPDATE", "INSERT", "ALTER",
-		"CREATE", "EXEC", "EXECUTE", "TRUNCATE", "GRANT",
-		"REVOKE", "MERGE", "REPLACE",
-	}
-
-	for _, keyword := range dangerousKeywords {
-		if strings.Contains(upperFormula, keyword) {
-			return fmt.Errorf("formula contains forbidden keyword: %s", keyword)
-		}
-	}
-
-	return nil
+	return ValidateMetricFormula(formula)
 }
@@ -0,0 +1,504 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Backfill limits
+const (
+	DefaultBackfillParallelism = 2
+	MaxBackfillParallelism     = 8
+	maxBackfillChunks          = 1000
+	defaultBackfillIDChunk     = 10000
+)
+
+// rangeReplace makes a load replace the destination rows of a partition
+// range rather than load the whole table
+type rangeReplace struct {
+	column  string
+	numeric bool        // ID ranges; DATE ranges compare YYYY-MM-DD strings
+	start   interface{} // inclusive
+	end     interface{} // exclusive
+	shared  *rangePublish
+}
+
+// rangePublish serializes the publishing loads of one backfill
+type rangePublish struct {
+	sync.Mutex
+	created bool // a load of the backfill created the destination table
+}
+
+// PlanPipelineBackfill validates a backfill request, filling in its
+// defaults, and splits its range into chunks
+func PlanPipelineBackfill(pipeline *models.Pipeline, backfill *models.PipelineBackfill) ([]models.PipelineBackfillChunk, error) {
+	if pipeline.SourceType == "POSTGRES_CDC" {
+		return nil, fmt.Errorf("CDC pipelines cannot be backfilled")
+	}
+	steps, err := ParseTransformSteps(pipeline.TransformationSteps)
+	if err != nil {
+		return nil, err
+	}
+	if _, sqlSteps := splitTransformSteps(steps); len(sqlSteps) > 0 {
+		return nil, fmt.Errorf("pipelines with SQL steps cannot be backfilled")
+	}
+	if strings.TrimSpace(backfill.Column) == "" {
+		return nil, fmt.Errorf("column is required")
+	}
+	if backfill.Parallelism <= 0 {
+		backfill.Parallelism = DefaultBackfillParallelism
+	}
+	if backfill.Parallelism > MaxBackfillParallelism {
+		return nil, fmt.Errorf("parallelism must be at most %d", MaxBackfillParallelism)
+	}
+
+	var bounds [][2]string
+	switch backfill.RangeType {
+	case "DATE":
+		start, err := time.Parse("2006-01-02", backfill.RangeStart)
+		if err != nil {
+			return nil, fmt.Errorf("rangeStart must be a date (YYYY-MM-DD)")
+		}
+		end, err := time.Parse("2006-01-02", backfill.RangeEnd)
+		if err != nil {
+			return nil, fmt.Errorf("rangeEnd must be a date (YYYY-MM-DD)")
+		}
+		if !start.Before(end) {
+			return nil, fmt.Errorf("rangeStart must be before rangeEnd")
+		}
+		if backfill.ChunkSize <= 0 {
+			backfill.ChunkSize = 1
+		}
+		for from := start; from.Before(end) && len(bounds) <= maxBackfillChunks; {
+			to := from.AddDate(0, 0, backfill.ChunkSize)
+			if to.After(end) {
+				to = end
+			}
+			bounds = append(bounds, [2]string{from.Format("2006-01-02"), to.Format("2006-01-02")})
+			from = to
+		}
+	case "ID":
+		start, err := strconv.ParseInt(backfill.RangeStart, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rangeStart must be an integer")
+		}
+		end, err := strconv.ParseInt(backfill.RangeEnd, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rangeEnd must be an integer")
+		}
+		if start >= end {
+			return nil, fmt.Errorf("rangeStart must be less than rangeEnd")
+		}
+		if backfill.ChunkSize <= 0 {
+			backfill.ChunkSize = defaultBackfillIDChunk
+		}
+		for from := start; from < end && len(bounds) <= maxBackfillChunks; {
+			to := end
+			if end-from > int64(backfill.ChunkSize) {
+				to = from + int64(backfill.ChunkSize)
+			}
+			bounds = append(bounds, [2]string{strconv.FormatInt(from, 10), strconv.FormatInt(to, 10)})
+			from = to
+		}
+	default:
+		return nil, fmt.Errorf("rangeType must be DATE or ID")
+	}
+	if len(bounds) > maxBackfillChunks {
+		return nil, fmt.Errorf("the range splits into more than %d chunks; use a larger chunkSize", maxBackfillChunks)
+	}
+
+	chunks := make([]models.PipelineBackfillChunk, len(bounds))
+	for i, b := range bounds {
+		chunks[i] = models.PipelineBackfillChunk{
+			ID:         uuid.New().String(),
+			BackfillID: backfill.ID,
+			Seq:        i,
+			RangeStart: b[0],
+			RangeEnd:   b[1],
+			Status:     "PENDING",
+		}
+	}
+	return chunks, nil
+}
+
+// CreatePipelineBackfill plans a backfill, records it with its chunks and
+// queues it
+func CreatePipelineBackfill(pipeline *models.Pipeline, backfill *models.PipelineBackfill) error {
+	if GlobalJobQueue == nil {
+		return fmt.Errorf("job queue not initialized")
+	}
+	backfill.ID = uuid.New().String()
+	backfill.PipelineID = pipeline.ID
+	backfill.Status = "PENDING"
+	chunks, err := PlanPipelineBackfill(pipeline, backfill)
+	if err != nil {
+		return err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Chunks").Create(backfill).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(chunks, 200).Error
+	})
+	if err != nil {
+		return err
+	}
+	backfill.Chunks = chunks
+	enqueueBackfill(backfill)
+	return nil
+}
+
+// ResumePipelineBackfill queues a failed or cancelled backfill again; only
+// the chunks that did not complete run
+func ResumePipelineBackfill(backfill *models.PipelineBackfill) error {
+	if GlobalJobQueue == nil {
+		return fmt.Errorf("job queue not initialized")
+	}
+	res := database.DB.Model(&models.PipelineBackfill{}).
+		Where("id = ? AND status IN ?", backfill.ID, []string{"FAILED", "CANCELLED"}).
+		Updates(map[string]interface{}{"status": "PENDING", "error": nil, "finished_at": nil})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("only failed or cancelled backfills can be resumed")
+	}
+	backfill.Status = "PENDING"
+	enqueueBackfill(backfill)
+	return nil
+}
+
+// enqueueBackfill hands a PENDING backfill to the job queue; the job ID is
+// the backfill ID
+func enqueueBackfill(backfill *models.PipelineBackfill) {
+	GlobalJobQueue.Enqueue(Job{
+		ID:        backfill.ID,
+		Type:      JobTypeBackfill,
+		EntityID:  backfill.PipelineID,
+		CreatedAt: time.Now(),
+	})
+}
+
+// RunBackfill runs the chunks of a PENDING backfill that have not completed,
+// at most Parallelism at once. Each chunk replays the pipeline's extraction
+// and transformations over its range and replaces that range of the
+// destination in one transaction; quality rules are not evaluated. Failed
+// chunks are recorded and the backfill fails once the others finished, so
+// resuming it runs just those. The returned error is set only when the
+// backfill could not be started.
+func (pe *PipelineExecutor) RunBackfill(ctx context.Context, backfill *models.PipelineBackfill) error {
+	var pipeline models.Pipeline
+	if err := database.DB.First(&pipeline, "id = ?", backfill.PipelineID).Error; err != nil {
+		return fmt.Errorf("pipeline not found: %w", err)
+	}
+	var chunks []models.PipelineBackfillChunk
+	if err := database.DB.Where(`"backfillId" = ? AND status <> ?`, backfill.ID, "COMPLETED").Order("seq ASC").Find(&chunks).Error; err != nil {
+		return fmt.Errorf("failed to load backfill chunks: %w", err)
+	}
+
+	now := time.Now()
+	backfill.Status = "RUNNING"
+	backfill.StartedAt = &now
+	database.DB.Model(&models.PipelineBackfill{}).Where("id = ?", backfill.ID).
+		Updates(map[string]interface{}{"status": "RUNNING", "started_at": now})
+
+	var sourceConfig models.SourceConfig
+	if err := json.Unmarshal([]byte(pipeline.SourceConfig), &sourceConfig); err != nil {
+		return pe.finishBackfill(backfill, fmt.Errorf("invalid source config: %w", err))
+	}
+	steps, err := ParseTransformSteps(pipeline.TransformationSteps)
+	if err == nil {
+		err = ValidateTransformSteps(steps, pipeline.Mode, pipeline.DestinationType)
+	}
+	if err != nil {
+		return pe.finishBackfill(backfill, err)
+	}
+	if _, sqlSteps := splitTransformSteps(steps); len(sqlSteps) > 0 {
+		return pe.finishBackfill(backfill, fmt.Errorf("pipelines with SQL steps cannot be backfilled"))
+	}
+
+	parallelism := backfill.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultBackfillParallelism
+	}
+	shared := &rangePublish{}
+	work := make(chan *models.PipelineBackfillChunk)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range work {
+				pe.runBackfillChunk(ctx, &pipeline, &sourceConfig, steps, backfill, chunk, shared)
+			}
+		}()
+	}
+	for i := range chunks {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case work <- &chunks[i]:
+		case <-ctx.Done():
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	// Chunks that never started were cancelled with the backfill
+	if ctx.Err() != nil {
+		database.DB.Model(&models.PipelineBackfillChunk{}).
+			Where(`"backfillId" = ? AND status = ?`, backfill.ID, "PENDING").
+			Update("status", "CANCELLED")
+		return pe.finishBackfill(backfill, ctx.Err())
+	}
+	var failed int64
+	database.DB.Model(&models.PipelineBackfillChunk{}).
+		Where(`"backfillId" = ? AND status <> ?`, backfill.ID, "COMPLETED").Count(&failed)
+	if failed > 0 {
+		return pe.finishBackfill(backfill, fmt.Errorf("%d chunks failed", failed))
+	}
+	return pe.finishBackfill(backfill, nil)
+}
+
+// runBackfillChunk runs one chunk and records its outcome
+func (pe *PipelineExecutor) runBackfillChunk(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig, steps []models.TransformStep, backfill *models.PipelineBackfill, chunk *models.PipelineBackfillChunk, shared *rangePublish) {
+	started := time.Now()
+	chunk.Attempts++
+	database.DB.Model(&models.PipelineBackfillChunk{}).Where("id = ?", chunk.ID).Updates(map[string]interface{}{
+		"status":      "RUNNING",
+		"attempts":    chunk.Attempts,
+		"started_at":  started,
+		"finished_at": nil,
+		"error":       nil,
+	})
+
+	rng, err := newRangeReplace(backfill, chunk, shared)
+	if err == nil {
+		err = pe.loadBackfillChunk(ctx, pipeline, config, steps, chunk, rng)
+	}
+
+	finished := time.Now()
+	updates := map[string]interface{}{"finished_at": finished}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		updates["status"] = "CANCELLED"
+	case err != nil:
+		updates["status"] = "FAILED"
+		updates["error"] = err.Error()
+		LogWarn("pipeline_backfill", "Backfill chunk failed", map[string]interface{}{
+			"backfill_id": backfill.ID,
+			"chunk":       chunk.Seq,
+			"error":       err.Error(),
+		})
+	default:
+		updates["status"] = "COMPLETED"
+		updates["rows_loaded"] = chunk.RowsLoaded
+		updates["rows_deleted"] = chunk.RowsDeleted
+	}
+	database.DB.Model(&models.PipelineBackfillChunk{}).Where("id = ?", chunk.ID).Updates(updates)
+}
+
+// loadBackfillChunk extracts the chunk's range, transforms it and replaces
+// the range in the destination
+func (pe *PipelineExecutor) loadBackfillChunk(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig, steps []models.TransformStep, chunk *models.PipelineBackfillChunk, rng *rangeReplace) error {
+	ranged, err := rng.sourcePipeline(pipeline, pe.resolveQuery(pipeline, config))
+	if err != nil {
+		return err
+	}
+	source, err := pe.openSource(ctx, ranged, config)
+	if err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+	// File and REST sources are filtered here; SQL sources already were
+	var stream rowStream = &mapStream{in: source, apply: func(ctx context.Context, batch []map[string]interface{}) ([]map[string]interface{}, error) {
+		kept := batch[:0]
+		for _, row := range batch {
+			if rng.contains(row[rng.column]) {
+				kept = append(kept, row)
+			}
+		}
+		return kept, nil
+	}}
+	defer func() { stream.Close() }()
+
+	for i := range steps {
+		step := &steps[i]
+		next, err := pe.streamTransform(ctx, pipeline, stream, step)
+		if err != nil {
+			return fmt.Errorf("transform step '%s' failed: %w", step.Type, err)
+		}
+		stream = next
+	}
+
+	loader, err := pe.openLoader(ctx, pipeline)
+	if err != nil {
+		return fmt.Errorf("load failed: %w", err)
+	}
+	defer loader.abort()
+	loader.replace = rng
+	loader.staging = siblingTableName(loader.dest.table, fmt.Sprintf("__backfill%d", chunk.Seq))
+
+	for {
+		batch, err := stream.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := loader.write(ctx, batch); err != nil {
+			return fmt.Errorf("load failed: %w", err)
+		}
+	}
+	if err := loader.commit(ctx); err != nil {
+		return fmt.Errorf("load failed: %w", err)
+	}
+	chunk.RowsLoaded = loader.rows
+	chunk.RowsDeleted = loader.replaced
+	return nil
+}
+
+// finishBackfill records the outcome of a backfill run
+func (pe *PipelineExecutor) finishBackfill(backfill *models.PipelineBackfill, err error) error {
+	var rows struct{ Total int }
+	database.DB.Model(&models.PipelineBackfillChunk{}).Select("COALESCE(SUM(rows_loaded), 0) AS total").
+		Where(`"backfillId" = ? AND status = ?`, backfill.ID, "COMPLETED").Scan(&rows)
+
+	now := time.Now()
+	backfill.FinishedAt = &now
+	backfill.RowsLoaded = rows.Total
+	backfill.Status = "COMPLETED"
+	backfill.Error = nil
+	if err != nil {
+		backfill.Status = "FAILED"
+		if errors.Is(err, context.Canceled) {
+			backfill.Status = "CANCELLED"
+		}
+		message := err.Error()
+		backfill.Error = &message
+	}
+	if dbErr := database.DB.Model(&models.PipelineBackfill{}).Where("id = ?", backfill.ID).Updates(map[string]interface{}{
+		"status":      backfill.Status,
+		"rows_loaded": backfill.RowsLoaded,
+		"error":       backfill.Error,
+		"finished_at": now,
+	}).Error; dbErr != nil {
+		return fmt.Errorf("failed to update backfill: %w", dbErr)
+	}
+	LogInfo("pipeline_backfill", "Backfill finished", map[string]interface{}{
+		"backfill_id": backfill.ID,
+		"pipeline_id": backfill.PipelineID,
+		"status":      backfill.Status,
+		"rows":        backfill.RowsLoaded,
+	})
+	return nil
+}
+
+// newRangeReplace is the partition range of a backfill chunk
+func newRangeReplace(backfill *models.PipelineBackfill, chunk *models.PipelineBackfillChunk, shared *rangePublish) (*rangeReplace, error) {
+	rng := &rangeReplace{column: backfill.Column, numeric: backfill.RangeType == "ID", shared: shared}
+	if !rng.numeric {
+		rng.start, rng.end = chunk.RangeStart, chunk.RangeEnd
+		return rng, nil
+	}
+	start, err := strconv.ParseInt(chunk.RangeStart, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk range: %w", err)
+	}
+	end, err := strconv.ParseInt(chunk.RangeEnd, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk range: %w", err)
+	}
+	rng.start, rng.end = start, end
+	return rng, nil
+}
+
+// contains reports whether a partition column value falls in the range.
+// Dates compare by day, so timestamps and date strings both work.
+func (r *rangeReplace) contains(val interface{}) bool {
+	if val == nil {
+		return false
+	}
+	if r.numeric {
+		n, err := strconv.ParseFloat(strings.TrimSpace(fmt.Sprintf("%v", val)), 64)
+		return err == nil && n >= float64(r.start.(int64)) && n < float64(r.end.(int64))
+	}
+	var day string
+	if t, ok := val.(time.Time); ok {
+		day = t.Format("2006-01-02")
+	} else {
+		s := strings.TrimSpace(fmt.Sprintf("%v", val))
+		if len(s) < 10 {
+			return false
+		}
+		if _, err := time.Parse("2006-01-02", s[:10]); err != nil {
+			return false
+		}
+		day = s[:10]
+	}
+	return day >= r.start.(string) && day < r.end.(string)
+}
+
+// sourcePipeline returns the pipeline with its source query restricted to
+// the range, for SQL sources; other sources are returned as they are
+func (r *rangeReplace) sourcePipeline(pipeline *models.Pipeline, query string) (*models.Pipeline, error) {
+	var dialect string
+	if pipeline.ConnectionID != nil && *pipeline.ConnectionID != "" {
+		var conn models.Connection
+		if err := database.DB.First(&conn, "id = ?", *pipeline.ConnectionID).Error; err != nil {
+			return nil, fmt.Errorf("connection not found: %w", err)
+		}
+		dialect = normalizeSQLDialect(conn.Type)
+	} else if pipeline.SourceType == "POSTGRES" || pipeline.SourceType == "MYSQL" {
+		dialect = normalizeSQLDialect(pipeline.SourceType)
+	} else {
+		return pipeline, nil
+	}
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if query == "" {
+		return pipeline, nil
+	}
+
+	column := quoteSourceColumn(dialect, r.column)
+	var start, end string
+	if r.numeric {
+		start, end = strconv.FormatInt(r.start.(int64), 10), strconv.FormatInt(r.end.(int64), 10)
+	} else {
+		// Both bounds were parsed when the backfill was planned
+		from, _ := time.Parse("2006-01-02", r.start.(string))
+		to, _ := time.Parse("2006-01-02", r.end.(string))
+		start, end = sqlDateLiteral(dialect, from), sqlDateLiteral(dialect, to)
+	}
+	ranged := fmt.Sprintf("SELECT * FROM (%s) _backfill WHERE %s >= %s AND %s < %s", query, column, start, column, end)
+
+	copied := *pipeline
+	copied.SourceQuery = &ranged
+	return &copied, nil
+}
+
+// quoteSourceColumn quotes a column name for a source query in a normalized
+// SQL dialect
+func quoteSourceColumn(dialect string, name string) string {
+	switch dialect {
+	case "mysql", "bigquery":
+		return "`" + strings.ReplaceAll(name, "`", "") + "`"
+	case "sqlserver":
+		return "[" + strings.ReplaceAll(name, "]", "") + "]"
+	default:
+		return `"` + strings.ReplaceAll(name, `"`, "") + `"`
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanPipelineBackfill(t *testing.T) {
+	pipeline := &models.Pipeline{ID: "p1", SourceType: "CSV"}
+	chunkRanges := func(chunks []models.PipelineBackfillChunk) [][2]string {
+		var ranges [][2]string
+		for _, c := range chunks {
+			ranges = append(ranges, [2]string{c.RangeStart, c.RangeEnd})
+		}
+		return ranges
+	}
+
+	backfill := &models.PipelineBackfill{Column: "day", RangeType: "DATE", RangeStart: "2024-01-30", RangeEnd: "2024-02-06", ChunkSize: 3}
+	chunks, err := PlanPipelineBackfill(pipeline, backfill)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{{"2024-01-30", "2024-02-02"}, {"2024-02-02", "2024-02-05"}, {"2024-02-05", "2024-02-06"}}, chunkRanges(chunks))
+	assert.Equal(t, DefaultBackfillParallelism, backfill.Parallelism)
+
+	backfill = &models.PipelineBackfill{Column: "id", RangeType: "ID", RangeStart: "0", RangeEnd: "25", ChunkSize: 10}
+	chunks, err = PlanPipelineBackfill(pipeline, backfill)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{{"0", "10"}, {"10", "20"}, {"20", "25"}}, chunkRanges(chunks))
+
+	for _, bad := range []models.PipelineBackfill{
+		{Column: "day", RangeType: "DATE", RangeStart: "2024-02-01", RangeEnd: "2024-01-01"},
+		{Column: "day", RangeType: "DATE", RangeStart: "yesterday", RangeEnd: "2024-01-01"},
+		{Column: "id", RangeType: "ID", RangeStart: "0", RangeEnd: "1000000", ChunkSize: 1},
+		{Column: "id", RangeType: "HASH", RangeStart: "0", RangeEnd: "10"},
+		{RangeType: "ID", RangeStart: "0", RangeEnd: "10"},
+		{Column: "id", RangeType: "ID", RangeStart: "0", RangeEnd: "10", Parallelism: 100},
+	} {
+		_, err := PlanPipelineBackfill(pipeline, &bad)
+		assert.Error(t, err, "%+v", bad)
+	}
+
+	steps := `[{"type": "SQL", "order": 1, "config": {"sql": "DELETE FROM {{table}}"}}]`
+	_, err = PlanPipelineBackfill(&models.Pipeline{SourceType: "CSV", Mode: "ELT", TransformationSteps: &steps},
+		&models.PipelineBackfill{Column: "id", RangeType: "ID", RangeStart: "0", RangeEnd: "10"})
+	assert.ErrorContains(t, err, "SQL steps")
+}
+
+func TestRangeReplace_SourceQueryAndRows(t *testing.T) {
+	rng := &rangeReplace{column: "created_at", start: "2024-01-02", end: "2024-01-03"}
+	ranged, err := rng.sourcePipeline(&models.Pipeline{SourceType: "POSTGRES"}, "SELECT * FROM orders;")
+	require.NoError(t, err)
+	assert.Equal(t, `SELECT * FROM (SELECT * FROM orders) _backfill WHERE "created_at" >= DATE '2024-01-02' AND "created_at" < DATE '2024-01-03'`, *ranged.SourceQuery)
+	assert.True(t, rng.contains("2024-01-02T23:59:59Z"))
+	assert.False(t, rng.contains("2024-01-03"))
+	assert.False(t, rng.contains(nil))
+
+	file := &models.Pipeline{SourceType: "CSV"}
+	same, err := rng.sourcePipeline(file, "")
+	require.NoError(t, err)
+	assert.Same(t, file, same)
+
+	rng = &rangeReplace{column: "id", numeric: true, start: int64(10), end: int64(20)}
+	ranged, err = rng.sourcePipeline(&models.Pipeline{SourceType: "MYSQL"}, "SELECT * FROM orders")
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM (SELECT * FROM orders) _backfill WHERE `id` >= 10 AND `id` < 20", *ranged.SourceQuery)
+	assert.True(t, rng.contains("10"))
+	assert.True(t, rng.contains(19.5))
+	assert.False(t, rng.contains(20))
+}
+
+func TestRunBackfill_ReplacesRangesAndResumes(t *testing.T) {
+	withSmallBatches(t)
+	db := setupTestDB(t, &models.Pipeline{}, &models.QualityRule{}, &models.JobExecution{}, &models.PipelineBackfill{}, &models.PipelineBackfillChunk{}, &PipelineWatermark{})
+	previous := GlobalJobQueue
+	GlobalJobQueue = NewJobQueue(0)
+	t.Cleanup(func() { GlobalJobQueue = previous })
+	files := t.TempDir()
+	t.Setenv("PIPELINE_FILES_DIR", files)
+	writePipelineFile(t, "sales.csv", "day,amount\n2024-01-01,1\n2024-01-02,2\n2024-01-02,3\n2024-01-03,4\n2024-01-04,5\n")
+
+	steps := `[{"type": "FILTER", "order": 1, "config": {"column": "amount", "operator": "gt", "value": 0}}]`
+	pipeline := models.Pipeline{ID: "sales", Name: "Sales", WorkspaceID: "ws", Mode: "ETL", SourceType: "CSV", SourceConfig: `{"filePath": "sales.csv"}`, DestinationType: "INTERNAL_RAW", TransformationSteps: &steps}
+	require.NoError(t, db.Create(&pipeline).Error)
+	require.NoError(t, db.Create(&models.JobExecution{ID: "exec-1", PipelineID: "sales", Status: "PROCESSING"}).Error)
+	pe := NewPipelineExecutor()
+	require.NoError(t, pe.Execute("sales", "exec-1").Error)
+	require.NoError(t, db.Create(&PipelineWatermark{ID: "wm", PipelineID: "sales", ColumnName: "day", ColumnType: "timestamp", LastValue: "2024-01-04"}).Error)
+
+	// The fixed source: day 2 changed, day 3 lost a row, other days changed
+	// too but are outside the backfill
+	writePipelineFile(t, "sales.csv", "day,amount\n2024-01-01,10\n2024-01-02,20\n2024-01-04,50\n")
+	require.NoError(t, os.Rename(filepath.Join(files, "sales.csv"), filepath.Join(files, "moved.csv")))
+
+	backfill := models.PipelineBackfill{Column: "day", RangeType: "DATE", RangeStart: "2024-01-02", RangeEnd: "2024-01-04", Parallelism: 1}
+	require.NoError(t, CreatePipelineBackfill(&pipeline, &backfill))
+	require.Len(t, backfill.Chunks, 2)
+
+	// Every chunk fails while the source is missing
+	require.NoError(t, pe.RunBackfill(context.Background(), &backfill))
+	assert.Equal(t, "FAILED", backfill.Status)
+	var chunks []models.PipelineBackfillChunk
+	require.NoError(t, db.Order("seq").Find(&chunks).Error)
+	for _, c := range chunks {
+		assert.Equal(t, "FAILED", c.Status)
+		assert.Contains(t, *c.Error, "extraction failed")
+	}
+
+	// A chunk completed elsewhere is not run again on resume
+	require.NoError(t, db.Model(&chunks[1]).Updates(map[string]interface{}{"status": "COMPLETED", "error": nil}).Error)
+	require.NoError(t, os.Rename(filepath.Join(files, "moved.csv"), filepath.Join(files, "sales.csv")))
+	require.NoError(t, ResumePipelineBackfill(&backfill))
+	require.Error(t, ResumePipelineBackfill(&backfill), "only failed backfills resume")
+	require.NoError(t, pe.RunBackfill(context.Background(), &backfill))
+	assert.Equal(t, "COMPLETED", backfill.Status)
+	assert.Equal(t, 1, backfill.RowsLoaded)
+
+	require.NoError(t, db.Order("seq").Find(&chunks).Error)
+	assert.Equal(t, 2, chunks[0].Attempts)
+	assert.Equal(t, 2, chunks[0].RowsDeleted)
+	assert.Equal(t, 1, chunks[0].RowsLoaded)
+	assert.Equal(t, 1, chunks[1].Attempts)
+
+	var rows []struct{ Day, Amount string }
+	require.NoError(t, db.Raw(`SELECT day, amount FROM pipeline_data_sales ORDER BY day, amount`).Scan(&rows).Error)
+	assert.Equal(t, []struct{ Day, Amount string }{
+		{"2024-01-01", "1"}, {"2024-01-02", "20"}, {"2024-01-03", "4"}, {"2024-01-04", "5"},
+	}, rows)
+
+	// Now the second chunk replaces day 3 with nothing
+	require.NoError(t, db.Model(&models.PipelineBackfill{}).Where("id = ?", backfill.ID).Update("status", "FAILED").Error)
+	require.NoError(t, db.Model(&chunks[1]).Update("status", "FAILED").Error)
+	require.NoError(t, ResumePipelineBackfill(&backfill))
+	require.NoError(t, pe.RunBackfill(context.Background(), &backfill))
+	var count int64
+	require.NoError(t, db.Table("pipeline_data_sales").Where("day = ?", "2024-01-03").Count(&count).Error)
+	assert.Zero(t, count)
+
+	var watermark PipelineWatermark
+	require.NoError(t, db.First(&watermark, "pipeline_id = ?", "sales").Error)
+	assert.Equal(t, "2024-01-04", watermark.LastValue, "the live watermark is left alone")
+}
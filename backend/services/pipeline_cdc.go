@@ -0,0 +1,939 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Change data capture from PostgreSQL: a POSTGRES_CDC pipeline reads the
+// pgoutput logical decoding stream of a replication slot and applies the
+// inserts, updates and deletes of one table to its destination, keyed on the
+// table's replica identity. The commit LSN of the last applied transaction is
+// the pipeline's watermark; transactions at or before it are skipped, and the
+// slot is only advanced once the watermark is stored. The watermark is
+// written in the same transaction as the changes: in pipeline_watermarks for
+// INTERNAL_RAW destinations, in a checkpoint table of the destination for
+// external ones (mirrored to pipeline_watermarks once committed). The first
+// run creates the slot exporting its snapshot, from which the table is copied,
+// so the copy and the stream meet exactly at the slot's start.
+
+// cdcPeekChanges bounds the changes read from the slot per destination
+// transaction; whole source transactions are always read
+var cdcPeekChanges = 10000
+
+// pgoutput message types
+const (
+	pgoutputMsgBegin    = 'B'
+	pgoutputMsgCommit   = 'C'
+	pgoutputMsgRelation = 'R'
+	pgoutputMsgInsert   = 'I'
+	pgoutputMsgUpdate   = 'U'
+	pgoutputMsgDelete   = 'D'
+	pgoutputMsgTruncate = 'T'
+)
+
+// pgoutputRelation describes a table as the stream sends it before its
+// first change
+type pgoutputRelation struct {
+	ID        uint32
+	Namespace string
+	Name      string
+	Columns   []string
+	Key       []bool // column is part of the replica identity
+}
+
+// pgoutputTuple is a row of a change; columns not in Values are unchanged
+// TOASTed values the stream leaves out
+type pgoutputTuple struct {
+	Values    map[string]interface{} // text values, nil for NULL
+	Unchanged []string
+}
+
+// pgoutputMessage is a decoded pgoutput message
+type pgoutputMessage struct {
+	Type      byte
+	FinalLSN  uint64 // Begin: the commit LSN of the transaction
+	CommitLSN uint64 // Commit
+	EndLSN    uint64 // Commit: where the next transaction starts
+	Relation  *pgoutputRelation
+	Old       *pgoutputTuple // Update and Delete: the replica identity, or the whole row with REPLICA IDENTITY FULL
+	New       *pgoutputTuple // Insert and Update
+	Truncated []*pgoutputRelation
+}
+
+// pgoutputDecoder decodes pgoutput (protocol version 1) messages, keeping
+// the relations the stream described
+type pgoutputDecoder struct {
+	relations map[uint32]*pgoutputRelation
+}
+
+func newPgoutputDecoder() *pgoutputDecoder {
+	return &pgoutputDecoder{relations: make(map[uint32]*pgoutputRelation)}
+}
+
+// pgoutputReader reads the fields of a message
+type pgoutputReader struct {
+	data []byte
+	err  error
+}
+
+func (r *pgoutputReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = errors.New("truncated pgoutput message")
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *pgoutputReader) byte1() byte {
+	if b := r.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *pgoutputReader) int16() int {
+	if b := r.take(2); b != nil {
+		return int(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *pgoutputReader) int32() uint32 {
+	if b := r.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) int64() uint64 {
+	if b := r.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *pgoutputReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.data {
+		if c == 0 {
+			s := string(r.data[:i])
+			r.data = r.data[i+1:]
+			return s
+		}
+	}
+	r.err = errors.New("unterminated string in pgoutput message")
+	return ""
+}
+
+func (r *pgoutputReader) tuple(rel *pgoutputRelation) *pgoutputTuple {
+	n := r.int16()
+	if r.err == nil && n != len(rel.Columns) {
+		r.err = fmt.Errorf("tuple of %s.%s has %d columns, relation has %d", rel.Namespace, rel.Name, n, len(rel.Columns))
+		return nil
+	}
+	t := &pgoutputTuple{Values: make(map[string]interface{}, n)}
+	for i := 0; i < n && r.err == nil; i++ {
+		switch kind := r.byte1(); kind {
+		case 'n':
+			t.Values[rel.Columns[i]] = nil
+		case 'u':
+			t.Unchanged = append(t.Unchanged, rel.Columns[i])
+		case 't':
+			t.Values[rel.Columns[i]] = string(r.take(int(r.int32())))
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("unsupported tuple value kind %q", kind)
+			}
+		}
+	}
+	return t
+}
+
+func (d *pgoutputDecoder) relation(r *pgoutputReader) *pgoutputRelation {
+	id := r.int32()
+	rel, ok := d.relations[id]
+	if !ok && r.err == nil {
+		r.err = fmt.Errorf("change for unknown relation %d", id)
+	}
+	return rel
+}
+
+// decode decodes one message. Message types a capture does not use (type,
+// origin and logical messages) come back with their type only.
+func (d *pgoutputDecoder) decode(data []byte) (*pgoutputMessage, error) {
+	r := &pgoutputReader{data: data}
+	msg := &pgoutputMessage{Type: r.byte1()}
+
+	switch msg.Type {
+	case pgoutputMsgBegin:
+		msg.FinalLSN = r.int64()
+	case pgoutputMsgCommit:
+		r.byte1() // flags
+		msg.CommitLSN = r.int64()
+		msg.EndLSN = r.int64()
+	case pgoutputMsgRelation:
+		rel := &pgoutputRelation{ID: r.int32(), Namespace: r.string(), Name: r.string()}
+		r.byte1() // replica identity setting
+		n := r.int16()
+		for i := 0; i < n && r.err == nil; i++ {
+			flags := r.byte1()
+			rel.Columns = append(rel.Columns, r.string())
+			rel.Key = append(rel.Key, flags&1 == 1)
+			r.int32() // type OID
+			r.int32() // type modifier
+		}
+		if r.err == nil {
+			d.relations[rel.ID] = rel
+		}
+		msg.Relation = rel
+	case pgoutputMsgInsert:
+		msg.Relation = d.relation(r)
+		if r.byte1() == 'N' && msg.Relation != nil {
+			msg.New = r.tuple(msg.Relation)
+		}
+	case pgoutputMsgUpdate:
+		msg.Relation = d.relation(r)
+		if msg.Relation == nil {
+			break
+		}
+		kind := r.byte1()
+		if kind == 'K' || kind == 'O' {
+			msg.Old = r.tuple(msg.Relation)
+			kind = r.byte1()
+		}
+		if kind == 'N' {
+			msg.New = r.tuple(msg.Relation)
+		}
+	case pgoutputMsgDelete:
+		msg.Relation = d.relation(r)
+		if kind := r.byte1(); (kind == 'K' || kind == 'O') && msg.Relation != nil {
+			msg.Old = r.tuple(msg.Relation)
+		}
+	case pgoutputMsgTruncate:
+		n := int(r.int32())
+		r.byte1() // options
+		for i := 0; i < n && r.err == nil; i++ {
+			if rel := d.relation(r); rel != nil {
+				msg.Truncated = append(msg.Truncated, rel)
+			}
+		}
+	}
+
+	if r.err != nil {
+		return nil, fmt.Errorf("failed to decode pgoutput %q message: %w", msg.Type, r.err)
+	}
+	return msg, nil
+}
+
+// parseLSN parses a log sequence number written as X/Y
+func parseLSN(s string) (uint64, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("invalid LSN %q", s)
+	}
+	return uint64(hi)<<32 | uint64(lo), nil
+}
+
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+// cdcApplier applies changes to the destination table in a transaction
+type cdcApplier struct {
+	dest    *pipelineDestination
+	tx      *sql.Tx
+	raw     bool            // the applier defines the columns (INTERNAL_RAW, all TEXT)
+	exists  bool            // the destination table exists
+	columns map[string]bool // destination columns, read on first use
+
+	inserted, updated, deleted int
+}
+
+// ensureColumns makes sure the destination table has the columns, creating
+// a raw table or adding TEXT columns to it
+func (a *cdcApplier) ensureColumns(ctx context.Context, columns []string) error {
+	table := a.dest.quote(a.dest.table)
+	if !a.exists {
+		if !a.raw {
+			return fmt.Errorf("destination table %s does not exist", a.dest.table)
+		}
+		sorted := append([]string(nil), columns...)
+		sort.Strings(sorted)
+		colDefs := make([]string, len(sorted))
+		for i, col := range sorted {
+			colDefs[i] = a.dest.quote(col) + " TEXT"
+		}
+		if _, err := a.tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(colDefs, ", "))); err != nil {
+			return fmt.Errorf("failed to create destination table: %w", err)
+		}
+		a.exists = true
+	}
+	if a.columns == nil {
+		existing, err := tableColumns(ctx, a.tx, table)
+		if err != nil {
+			return err
+		}
+		a.columns = existing
+	}
+	for _, col := range columns {
+		if a.columns[col] {
+			continue
+		}
+		if !a.raw {
+			return fmt.Errorf("destination table %s has no column %s", a.dest.table, col)
+		}
+		if _, err := a.tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s TEXT", table, a.dest.quote(col))); err != nil {
+			return fmt.Errorf("failed to add column %s: %w", col, err)
+		}
+		a.columns[col] = true
+	}
+	return nil
+}
+
+// truncate removes every row of the destination table
+func (a *cdcApplier) truncate(ctx context.Context) error {
+	if !a.exists {
+		return nil
+	}
+	if _, err := a.tx.ExecContext(ctx, "DELETE FROM "+a.dest.quote(a.dest.table)); err != nil {
+		return fmt.Errorf("failed to truncate destination table: %w", err)
+	}
+	return nil
+}
+
+// apply applies an insert, update, delete or truncate message
+func (a *cdcApplier) apply(ctx context.Context, msg *pgoutputMessage) error {
+	switch msg.Type {
+	case pgoutputMsgTruncate:
+		return a.truncate(ctx)
+	case pgoutputMsgInsert:
+		if err := a.ensureColumns(ctx, msg.Relation.Columns); err != nil {
+			return err
+		}
+		a.inserted++
+		return a.upsert(ctx, msg.Relation, msg.New)
+	case pgoutputMsgUpdate:
+		if err := a.ensureColumns(ctx, msg.Relation.Columns); err != nil {
+			return err
+		}
+		old := msg.Old
+		if old == nil {
+			old = msg.New // the key did not change
+		}
+		a.updated++
+		if len(msg.New.Unchanged) > 0 {
+			return a.update(ctx, msg.Relation, old, msg.New)
+		}
+		if old != msg.New {
+			if err := a.deleteKey(ctx, msg.Relation, old); err != nil {
+				return err
+			}
+		}
+		// A replayed key change finds the row under its new key
+		return a.upsert(ctx, msg.Relation, msg.New)
+	case pgoutputMsgDelete:
+		if msg.Old == nil || !a.exists {
+			return nil
+		}
+		a.deleted++
+		return a.deleteKey(ctx, msg.Relation, msg.Old)
+	}
+	return nil
+}
+
+// keyCondition builds the WHERE clause matching a row on the replica
+// identity of its relation, with its arguments numbered from first
+func (a *cdcApplier) keyCondition(rel *pgoutputRelation, row *pgoutputTuple, first int) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for i, col := range rel.Columns {
+		if !rel.Key[i] {
+			continue
+		}
+		val, ok := row.Values[col]
+		if !ok {
+			continue
+		}
+		if val == nil {
+			conditions = append(conditions, a.dest.quote(col)+" IS NULL")
+			continue
+		}
+		args = append(args, val)
+		conditions = append(conditions, a.dest.quote(col)+" = "+a.dest.placeholder(first+len(args)-1))
+	}
+	if len(conditions) == 0 {
+		return "", nil, fmt.Errorf("table %s.%s has no replica identity: add a primary key or set REPLICA IDENTITY FULL", rel.Namespace, rel.Name)
+	}
+	return strings.Join(conditions, " AND "), args, nil
+}
+
+func (a *cdcApplier) deleteKey(ctx context.Context, rel *pgoutputRelation, row *pgoutputTuple) error {
+	where, args, err := a.keyCondition(rel, row, 1)
+	if err != nil {
+		return err
+	}
+	if _, err := a.tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s", a.dest.quote(a.dest.table), where), args...); err != nil {
+		return fmt.Errorf("failed to apply change: %w", err)
+	}
+	return nil
+}
+
+// upsert writes a row in place of the row with the same replica identity,
+// which makes replayed inserts and updates idempotent
+func (a *cdcApplier) upsert(ctx context.Context, rel *pgoutputRelation, row *pgoutputTuple) error {
+	if err := a.deleteKey(ctx, rel, row); err != nil {
+		return err
+	}
+	columns := make([]string, 0, len(row.Values))
+	for col := range row.Values {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	if err := insertBatch(ctx, a.tx, a.dest, a.dest.quote(a.dest.table), columns, []map[string]interface{}{row.Values}); err != nil {
+		return fmt.Errorf("failed to apply change: %w", err)
+	}
+	return nil
+}
+
+// update sets the columns an update carries, keeping the unchanged TOASTed
+// values the stream leaves out
+func (a *cdcApplier) update(ctx context.Context, rel *pgoutputRelation, old *pgoutputTuple, row *pgoutputTuple) error {
+	var sets []string
+	var args []interface{}
+	for _, col := range rel.Columns {
+		val, ok := row.Values[col]
+		if !ok {
+			continue
+		}
+		args = append(args, textValue(val))
+		sets = append(sets, a.dest.quote(col)+" = "+a.dest.placeholder(len(args)))
+	}
+	where, keyArgs, err := a.keyCondition(rel, old, len(args)+1)
+	if err != nil {
+		return err
+	}
+	updateSQL := fmt.Sprintf("UPDATE %s SET %s WHERE %s", a.dest.quote(a.dest.table), strings.Join(sets, ", "), where)
+	if _, err := a.tx.ExecContext(ctx, updateSQL, append(args, keyArgs...)...); err != nil {
+		return fmt.Errorf("failed to apply change: %w", err)
+	}
+	return nil
+}
+
+// cdcSource is the replication slot a CDC pipeline reads
+type cdcSource struct {
+	db          *sql.DB
+	dsn         string
+	slot        string
+	publication string
+	schema      string
+	table       string
+}
+
+// quotedTable is the captured table, quoted for the source
+func (s *cdcSource) quotedTable() string {
+	return pq.QuoteIdentifier(s.schema) + "." + pq.QuoteIdentifier(s.table)
+}
+
+// cdcSlotSnapshot is the snapshot a new replication slot exported: the
+// state of the database at the slot's start. It can be imported until
+// release closes the replication connection that created the slot.
+type cdcSlotSnapshot struct {
+	name    string
+	release func()
+}
+
+// ensure creates the publication and the replication slot when missing. It
+// returns the LSN a new slot starts at, 0 when the slot existed, and the
+// snapshot the new slot exported when export is set.
+func (s *cdcSource) ensure(ctx context.Context, export bool) (uint64, *cdcSlotSnapshot, error) {
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", s.publication).Scan(&exists); err != nil {
+		return 0, nil, fmt.Errorf("failed to look up publication: %w", err)
+	}
+	if !exists {
+		createSQL := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s", pq.QuoteIdentifier(s.publication), s.quotedTable())
+		if _, err := s.db.ExecContext(ctx, createSQL); err != nil {
+			return 0, nil, fmt.Errorf("failed to create publication %s: %w", s.publication, err)
+		}
+	}
+
+	if err := s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_replication_slots WHERE slot_name = $1)", s.slot).Scan(&exists); err != nil {
+		return 0, nil, fmt.Errorf("failed to look up replication slot: %w", err)
+	}
+	if exists {
+		return 0, nil, nil
+	}
+	if export {
+		return s.createSlotWithSnapshot(ctx)
+	}
+	var lsn string
+	if err := s.db.QueryRowContext(ctx, "SELECT lsn::text FROM pg_create_logical_replication_slot($1, 'pgoutput')", s.slot).Scan(&lsn); err != nil {
+		return 0, nil, fmt.Errorf("failed to create replication slot %s (wal_level must be logical): %w", s.slot, err)
+	}
+	start, err := parseLSN(lsn)
+	return start, nil, err
+}
+
+// createSlotWithSnapshot creates the replication slot over a replication
+// connection, which alone can export the slot's snapshot
+func (s *cdcSource) createSlotWithSnapshot(ctx context.Context) (uint64, *cdcSlotSnapshot, error) {
+	repl, err := sql.Open("postgres", s.dsn+" replication=database")
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open replication connection: %w", err)
+	}
+	conn, err := repl.Conn(ctx)
+	if err != nil {
+		repl.Close()
+		return 0, nil, fmt.Errorf("failed to open replication connection (the user needs the REPLICATION attribute): %w", err)
+	}
+	release := func() {
+		conn.Close()
+		repl.Close()
+	}
+
+	var slotName, lsn, snapshot, plugin sql.NullString
+	createSQL := fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput EXPORT_SNAPSHOT", pq.QuoteIdentifier(s.slot))
+	if err := conn.QueryRowContext(ctx, createSQL).Scan(&slotName, &lsn, &snapshot, &plugin); err != nil {
+		release()
+		return 0, nil, fmt.Errorf("failed to create replication slot %s (wal_level must be logical): %w", s.slot, err)
+	}
+	start, err := parseLSN(lsn.String)
+	if err != nil {
+		release()
+		return 0, nil, err
+	}
+	return start, &cdcSlotSnapshot{name: snapshot.String, release: release}, nil
+}
+
+// cdcSlotName derives the default slot and publication name of a pipeline
+func cdcSlotName(pipelineID string) string {
+	name := "pipeline_" + strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, pipelineID)
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	return name
+}
+
+// openCDCSource connects to the source database of a CDC pipeline
+func (pe *PipelineExecutor) openCDCSource(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (*cdcSource, error) {
+	if config.Table == "" {
+		return nil, fmt.Errorf("table required in source config for CDC")
+	}
+	schema, table := "public", config.Table
+	if i := strings.Index(config.Table, "."); i >= 0 {
+		schema, table = config.Table[:i], config.Table[i+1:]
+	}
+
+	host, port, dbName, username, password, sslMode, err := pe.resolveConnectionCredentials(pipeline, config)
+	if err != nil {
+		return nil, err
+	}
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s connect_timeout=30",
+		host, port, username, password, dbName, sslMode)
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	db.SetMaxOpenConns(2)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("PostgreSQL connection ping failed: %w", err)
+	}
+
+	source := &cdcSource{db: db, dsn: dsn, slot: config.SlotName, publication: config.Publication, schema: schema, table: table}
+	if source.slot == "" {
+		source.slot = cdcSlotName(pipeline.ID)
+	}
+	if source.publication == "" {
+		source.publication = cdcSlotName(pipeline.ID)
+	}
+	return source, nil
+}
+
+// cdcRun is the state of a CDC pipeline run
+type cdcRun struct {
+	pe          *PipelineExecutor
+	pipeline    *models.Pipeline
+	executionID string
+	dest        *pipelineDestination
+	checkpoint  *PipelineWatermark
+	applied     int
+	inserted    int
+	updated     int
+	deleted     int
+}
+
+// begin opens a destination transaction
+func (r *cdcRun) begin(ctx context.Context) (*cdcApplier, error) {
+	exists, err := r.dest.hasTable(ctx, r.dest.table)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := r.dest.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin apply: %w", err)
+	}
+	return &cdcApplier{dest: r.dest, tx: tx, raw: r.pipeline.DestinationType == "INTERNAL_RAW", exists: exists}, nil
+}
+
+// commit commits the applied changes with the checkpoint at lsn
+func (r *cdcRun) commit(ctx context.Context, applier *cdcApplier, lsn uint64, changes int) error {
+	r.checkpoint.LastValue = formatLSN(lsn)
+	r.checkpoint.RowsLastSync = int64(changes)
+	r.checkpoint.LastSyncAt = time.Now()
+	r.checkpoint.UpdatedAt = time.Now()
+
+	if !r.dest.owned {
+		// The watermark table is in the destination database: one transaction
+		if err := upsertWatermark(ctx, applier.tx, r.checkpoint); err != nil {
+			applier.tx.Rollback()
+			return fmt.Errorf("failed to store CDC checkpoint: %w", err)
+		}
+		if err := applier.tx.Commit(); err != nil {
+			return err
+		}
+	} else {
+		if err := r.storeDestinationCheckpoint(ctx, applier.tx); err != nil {
+			applier.tx.Rollback()
+			return fmt.Errorf("failed to store CDC checkpoint: %w", err)
+		}
+		if err := applier.tx.Commit(); err != nil {
+			return err
+		}
+		sqlDB, err := database.DB.DB()
+		if err != nil {
+			return err
+		}
+		if err := upsertWatermark(ctx, sqlDB, r.checkpoint); err != nil {
+			return fmt.Errorf("failed to store CDC checkpoint: %w", err)
+		}
+	}
+	r.applied += changes
+	r.inserted += applier.inserted
+	r.updated += applier.updated
+	r.deleted += applier.deleted
+	r.pe.updateProgress(r.executionID, "LOADING", r.applied, r.applied)
+	return nil
+}
+
+// cdcCheckpointTable holds, in an external destination, the checkpoints of
+// the CDC pipelines loading into it
+const cdcCheckpointTable = "pipeline_cdc_checkpoints"
+
+// ensureCheckpointTable creates the checkpoint table of an external
+// destination, outside the apply transactions since MySQL commits DDL
+func (r *cdcRun) ensureCheckpointTable(ctx context.Context) error {
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (pipeline_id VARCHAR(64) PRIMARY KEY, slot_name VARCHAR(64) NOT NULL, lsn VARCHAR(32) NOT NULL, updated_at TIMESTAMP)",
+		r.dest.quote(cdcCheckpointTable))
+	if _, err := r.dest.db.ExecContext(ctx, createSQL); err != nil {
+		return fmt.Errorf("failed to create CDC checkpoint table: %w", err)
+	}
+	return nil
+}
+
+// destinationCheckpoint reads the slot and LSN the destination last
+// committed for the pipeline, empty when it has none
+func (r *cdcRun) destinationCheckpoint(ctx context.Context) (string, string, error) {
+	query := fmt.Sprintf("SELECT slot_name, lsn FROM %s WHERE pipeline_id = %s", r.dest.quote(cdcCheckpointTable), r.dest.placeholder(1))
+	var slot, lsn string
+	err := r.dest.db.QueryRowContext(ctx, query, r.pipeline.ID).Scan(&slot, &lsn)
+	if err == sql.ErrNoRows {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read CDC checkpoint: %w", err)
+	}
+	return slot, lsn, nil
+}
+
+// storeDestinationCheckpoint writes the checkpoint in the destination, in
+// the transaction applying the changes it covers
+func (r *cdcRun) storeDestinationCheckpoint(ctx context.Context, tx *sql.Tx) error {
+	table := r.dest.quote(cdcCheckpointTable)
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE pipeline_id = %s", table, r.dest.placeholder(1)), r.pipeline.ID); err != nil {
+		return err
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (pipeline_id, slot_name, lsn, updated_at) VALUES (%s, %s, %s, %s)",
+		table, r.dest.placeholder(1), r.dest.placeholder(2), r.dest.placeholder(3), r.dest.placeholder(4))
+	_, err := tx.ExecContext(ctx, insertSQL, r.pipeline.ID, r.checkpoint.ColumnName, r.checkpoint.LastValue, r.checkpoint.UpdatedAt)
+	return err
+}
+
+// snapshot copies the source table into the destination, replacing its
+// rows. The copy reads the snapshot the slot exported, when given, so that
+// it holds exactly the transactions committed before the slot's start.
+func (r *cdcRun) snapshot(ctx context.Context, source *cdcSource, lsn uint64, exported *cdcSlotSnapshot) error {
+	applier, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := applier.truncate(ctx); err != nil {
+		applier.tx.Rollback()
+		return err
+	}
+
+	sourceTx, err := source.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		applier.tx.Rollback()
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	defer sourceTx.Rollback()
+	if exported != nil {
+		if _, err := sourceTx.ExecContext(ctx, "SET TRANSACTION SNAPSHOT "+pq.QuoteLiteral(exported.name)); err != nil {
+			applier.tx.Rollback()
+			return fmt.Errorf("failed to import the slot snapshot: %w", err)
+		}
+	}
+	sourceRows, err := sourceTx.QueryContext(ctx, "SELECT * FROM "+source.quotedTable())
+	if err != nil {
+		applier.tx.Rollback()
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+	stream, err := newSQLRowsStream(sourceRows, 0, nil)
+	if err != nil {
+		applier.tx.Rollback()
+		return err
+	}
+	defer stream.Close()
+	rows := 0
+	for {
+		batch, err := stream.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && len(batch) > 0 {
+			columns := make([]string, 0, len(batch[0]))
+			for col := range batch[0] {
+				columns = append(columns, col)
+			}
+			sort.Strings(columns)
+			if err = applier.ensureColumns(ctx, columns); err == nil {
+				err = insertBatch(ctx, applier.tx, r.dest, r.dest.quote(r.dest.table), columns, batch)
+			}
+		}
+		if err != nil {
+			applier.tx.Rollback()
+			return fmt.Errorf("snapshot failed: %w", err)
+		}
+		rows += len(batch)
+	}
+	applier.inserted = rows
+	return r.commit(ctx, applier, lsn, rows)
+}
+
+// stream applies the changes in the slot up to the given LSN, a destination
+// transaction per read, and advances the slot past them
+func (r *cdcRun) stream(ctx context.Context, source *cdcSource, upto string) error {
+	decoder := newPgoutputDecoder()
+	for {
+		done, err := r.streamBatch(ctx, source, decoder, upto)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+func (r *cdcRun) streamBatch(ctx context.Context, source *cdcSource, decoder *pgoutputDecoder, upto string) (bool, error) {
+	checkpoint, err := parseLSN(r.checkpoint.LastValue)
+	if err != nil {
+		checkpoint = 0
+	}
+
+	rows, err := source.db.QueryContext(ctx,
+		"SELECT data FROM pg_logical_slot_peek_binary_changes($1, $2::pg_lsn, $3, 'proto_version', '1', 'publication_names', $4)",
+		source.slot, upto, cdcPeekChanges, source.publication)
+	if err != nil {
+		return false, fmt.Errorf("failed to read replication slot %s: %w", source.slot, err)
+	}
+	defer rows.Close()
+
+	applier, err := r.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			applier.tx.Rollback()
+		}
+	}()
+
+	var lastCommit, lastEnd uint64
+	skip, changes := false, 0
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return false, err
+		}
+		msg, err := decoder.decode(data)
+		if err != nil {
+			return false, err
+		}
+		switch msg.Type {
+		case pgoutputMsgBegin:
+			// Applied by an earlier run whose slot advance did not happen
+			skip = msg.FinalLSN <= checkpoint
+		case pgoutputMsgCommit:
+			lastEnd = msg.EndLSN
+			if !skip {
+				lastCommit = msg.CommitLSN
+			}
+		case pgoutputMsgInsert, pgoutputMsgUpdate, pgoutputMsgDelete:
+			if skip || msg.Relation.Namespace != source.schema || msg.Relation.Name != source.table {
+				continue
+			}
+			if err := applier.apply(ctx, msg); err != nil {
+				return false, err
+			}
+			changes++
+		case pgoutputMsgTruncate:
+			for _, rel := range msg.Truncated {
+				if !skip && rel.Namespace == source.schema && rel.Name == source.table {
+					if err := applier.apply(ctx, msg); err != nil {
+						return false, err
+					}
+					changes++
+				}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to read replication slot %s: %w", source.slot, err)
+	}
+	if lastEnd == 0 {
+		return true, nil // Nothing left up to the run's end
+	}
+
+	if lastCommit > checkpoint {
+		committed = true
+		if err := r.commit(ctx, applier, lastCommit, changes); err != nil {
+			return false, err
+		}
+	}
+	if _, err := source.db.ExecContext(ctx, "SELECT pg_replication_slot_advance($1, $2::pg_lsn)", source.slot, formatLSN(lastEnd)); err != nil {
+		return false, fmt.Errorf("failed to advance replication slot %s: %w", source.slot, err)
+	}
+	return false, nil
+}
+
+// executeCDC runs a POSTGRES_CDC pipeline: a snapshot of the table on the
+// first run, then the changes in the slot up to the current WAL position
+func (pe *PipelineExecutor) executeCDC(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig, executionID string, result *ExecutionResult) error {
+	if steps, err := ParseTransformSteps(pipeline.TransformationSteps); err != nil || len(steps) > 0 {
+		return fmt.Errorf("CDC pipelines apply source changes as they are and do not support transformation steps")
+	}
+	if len(pipeline.QualityRules) > 0 {
+		return fmt.Errorf("CDC pipelines do not support quality rules")
+	}
+
+	result.appendLog("INFO", "EXTRACT", "Connecting to PostgreSQL replication slot...", "")
+	pe.updateProgress(executionID, "EXTRACTING", 0, 0)
+	source, err := pe.openCDCSource(ctx, pipeline, config)
+	if err != nil {
+		return err
+	}
+	defer source.db.Close()
+
+	dest, err := pe.openDestination(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer dest.close()
+
+	run := &cdcRun{pe: pe, pipeline: pipeline, executionID: executionID, dest: dest}
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		return err
+	}
+	run.checkpoint, err = NewIncrementalRefreshV2Service(sqlDB).GetWatermark(ctx, pipeline.ID)
+	if err != nil {
+		return err
+	}
+	if dest.owned {
+		// The destination's checkpoint is committed with the changes and
+		// wins over the mirror in pipeline_watermarks
+		if err := run.ensureCheckpointTable(ctx); err != nil {
+			return err
+		}
+		slot, lsn, err := run.destinationCheckpoint(ctx)
+		if err != nil {
+			return err
+		}
+		if slot != "" {
+			if run.checkpoint == nil {
+				run.checkpoint = &PipelineWatermark{ID: uuid.New().String(), PipelineID: pipeline.ID, ColumnType: "lsn", CreatedAt: time.Now()}
+			}
+			run.checkpoint.ColumnName, run.checkpoint.LastValue = slot, lsn
+		}
+	}
+
+	firstRun := run.checkpoint == nil || run.checkpoint.ColumnName != source.slot
+	start, exported, err := source.ensure(ctx, firstRun && !config.SkipSnapshot)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if exported != nil {
+			exported.release()
+		}
+	}()
+
+	if firstRun {
+		// First run, or the slot changed: the slot's stream starts now
+		run.checkpoint = &PipelineWatermark{ID: uuid.New().String(), PipelineID: pipeline.ID, ColumnName: source.slot, ColumnType: "lsn", CreatedAt: time.Now()}
+		if !config.SkipSnapshot {
+			result.appendLog("INFO", "EXTRACT", fmt.Sprintf("Copying a snapshot of %s.%s...", source.schema, source.table), "")
+			if err := run.snapshot(ctx, source, start, exported); err != nil {
+				return err
+			}
+			if exported != nil {
+				exported.release()
+				exported = nil
+			}
+			result.appendLog("INFO", "LOAD", fmt.Sprintf("Snapshot loaded %d rows", run.inserted), "")
+		}
+	}
+
+	var upto string
+	if err := source.db.QueryRowContext(ctx, "SELECT pg_current_wal_lsn()::text").Scan(&upto); err != nil {
+		return fmt.Errorf("failed to read the current WAL position: %w", err)
+	}
+	result.appendLog("INFO", "EXTRACT", fmt.Sprintf("Applying changes from slot %s up to %s...", source.slot, upto), "")
+	snapshotRows := run.applied
+	if err := run.stream(ctx, source, upto); err != nil {
+		return err
+	}
+
+	result.RowsProcessed = run.applied
+	result.appendLog("INFO", "LOAD", fmt.Sprintf("Applied %d changes (%d inserts, %d updates, %d deletes), checkpoint %s",
+		run.applied-snapshotRows, run.inserted-snapshotRows, run.updated, run.deleted, run.checkpoint.LastValue), "")
+	return nil
+}
@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sqlStepPlaceholder matches the {{name}} placeholders of SQL step templates
+var sqlStepPlaceholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// sqlStepVars are the values substituted into SQL step templates
+type sqlStepVars struct {
+	Table       string // quoted destination table
+	PipelineID  string
+	ExecutionID string
+}
+
+// renderSQLStep substitutes {{table}}, {{pipeline_id}} and {{execution_id}}
+// into a SQL step; the IDs become string literals
+func renderSQLStep(statement string, vars sqlStepVars) (string, error) {
+	values := map[string]string{
+		"table":        vars.Table,
+		"pipeline_id":  sqlStringLiteral(vars.PipelineID),
+		"execution_id": sqlStringLiteral(vars.ExecutionID),
+	}
+	var unknown []string
+	rendered := sqlStepPlaceholder.ReplaceAllStringFunc(statement, func(match string) string {
+		name := sqlStepPlaceholder.FindStringSubmatch(match)[1]
+		value, ok := values[name]
+		if !ok {
+			unknown = append(unknown, name)
+			return match
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholder {{%s}}; use {{table}}, {{pipeline_id}} or {{execution_id}}", unknown[0])
+	}
+	return rendered, nil
+}
+
+func sqlStringLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// pipelineDestination is an open handle on the database a pipeline loads into
+type pipelineDestination struct {
+	db      *sql.DB
+	dialect string // postgres, mysql or sqlite (the embedded engine)
+	table   string
+	owned   bool // opened for this run, closed by close
+	copyIn  bool // loads with COPY (lib/pq connections)
+}
+
+func (d *pipelineDestination) close() {
+	if d.owned {
+		d.db.Close()
+	}
+}
+
+// quote quotes an identifier for the destination's dialect
+func (d *pipelineDestination) quote(name string) string {
+	if d.dialect == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, "") + `"`
+}
+
+// placeholder returns the n-th (from 1) bind parameter of a statement
+func (d *pipelineDestination) placeholder(n int) string {
+	if d.dialect == "mysql" {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// hasTable reports whether the destination database has a table
+func (d *pipelineDestination) hasTable(ctx context.Context, name string) (bool, error) {
+	if !d.owned && d.dialect != "sqlite" {
+		return database.DB.WithContext(ctx).Migrator().HasTable(name), nil
+	}
+	query := "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	switch d.dialect {
+	case "mysql":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	case "sqlite":
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	}
+	var count int
+	if err := d.db.QueryRowContext(ctx, query, name).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to look up table %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// renameSQL returns the statements renaming tables, given as from, to pairs,
+// in order
+func (d *pipelineDestination) renameSQL(pairs ...string) []string {
+	if d.dialect == "mysql" {
+		// One RENAME TABLE statement swaps atomically
+		var renames []string
+		for i := 0; i+1 < len(pairs); i += 2 {
+			renames = append(renames, d.quote(pairs[i])+" TO "+d.quote(pairs[i+1]))
+		}
+		return []string{"RENAME TABLE " + strings.Join(renames, ", ")}
+	}
+	var statements []string
+	for i := 0; i+1 < len(pairs); i += 2 {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", d.quote(pairs[i]), d.quote(pairs[i+1])))
+	}
+	return statements
+}
+
+// cloneSQL returns the statements copying a table with its rows. External
+// tables keep their definition; raw tables are plain TEXT columns.
+func (d *pipelineDestination) cloneSQL(from string, to string, raw bool) []string {
+	switch {
+	case raw:
+		return []string{fmt.Sprintf("CREATE TABLE %s AS SELECT * FROM %s", d.quote(to), d.quote(from))}
+	case d.dialect == "mysql":
+		return []string{fmt.Sprintf("CREATE TABLE %s LIKE %s", d.quote(to), d.quote(from)), d.copySQL(from, to)}
+	default:
+		return []string{fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", d.quote(to), d.quote(from)), d.copySQL(from, to)}
+	}
+}
+
+// copySQL returns the statement appending the rows of an external table to
+// another with the same definition
+func (d *pipelineDestination) copySQL(from string, to string) string {
+	if d.dialect == "mysql" {
+		return fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", d.quote(to), d.quote(from))
+	}
+	return fmt.Sprintf("INSERT INTO %s OVERRIDING SYSTEM VALUE SELECT * FROM %s", d.quote(to), d.quote(from))
+}
+
+// execAround runs statements changing a table's rows together with the
+// schema changes they need before and after. All run in one transaction,
+// except on MySQL, which commits DDL implicitly: there the schema changes run
+// outside the transaction, which then holds the row changes alone.
+func (d *pipelineDestination) execAround(ctx context.Context, before []string, statements []string, after []string) error {
+	if d.dialect != "mysql" {
+		statements = append(append(append([]string{}, before...), statements...), after...)
+		before, after = nil, nil
+	}
+	for _, statement := range before {
+		if _, err := d.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, statement := range after {
+		if _, err := d.db.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openDestination connects to the database of the pipeline's destination
+func (pe *PipelineExecutor) openDestination(ctx context.Context, pipeline *models.Pipeline) (*pipelineDestination, error) {
+	if pipeline.DestinationType == "INTERNAL_RAW" {
+		sqlDB, err := database.DB.DB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get underlying DB: %w", err)
+		}
+		return &pipelineDestination{db: sqlDB, dialect: database.DB.Dialector.Name(), table: internalRawTableName(pipeline)}, nil
+	}
+
+	if pipeline.DestinationConfig == nil {
+		return nil, fmt.Errorf("destination config required for external DB target")
+	}
+
+	var destConf models.DestConfig
+	if err := json.Unmarshal([]byte(*pipeline.DestinationConfig), &destConf); err != nil {
+		return nil, fmt.Errorf("invalid destination config: %w", err)
+	}
+
+	if destConf.ConnectionID == "" {
+		return nil, fmt.Errorf("connectionId required in destination config for external DB")
+	}
+
+	// Get destination connection
+	var conn models.Connection
+	if err := database.DB.First(&conn, "id = ?", destConf.ConnectionID).Error; err != nil {
+		return nil, fmt.Errorf("destination connection not found: %w", err)
+	}
+
+	// Build DSN
+	var dsn string
+	var driver string
+	host := ""
+	if conn.Host != nil {
+		host = *conn.Host
+	}
+	port := 5432
+	if conn.Port != nil {
+		port = *conn.Port
+	}
+	username := ""
+	if conn.Username != nil {
+		username = *conn.Username
+	}
+	password := ""
+	if conn.Password != nil {
+		password = *conn.Password
+	}
+
+	switch pipeline.DestinationType {
+	case "POSTGRES":
+		driver = "postgres"
+		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable connect_timeout=30",
+			host, port, username, password, conn.Database)
+	case "MYSQL":
+		driver = "mysql"
+		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=30s&parseTime=true",
+			username, password, host, port, conn.Database)
+	default:
+		return nil, fmt.Errorf("unsupported destination type: %s", pipeline.DestinationType)
+	}
+
+	destDB, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to destination: %w", err)
+	}
+
+	destDB.SetMaxOpenConns(5)
+	destDB.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := destDB.PingContext(ctx); err != nil {
+		destDB.Close()
+		return nil, fmt.Errorf("destination ping failed: %w", err)
+	}
+
+	return &pipelineDestination{db: destDB, dialect: driver, table: externalTableName(pipeline, &destConf), owned: true, copyIn: driver == "postgres"}, nil
+}
+
+// checkSQLStepDestination rejects SQL steps for destinations in the
+// application database, where they would run with the application's
+// credentials
+func checkSQLStepDestination(destinationType string) error {
+	if destinationType == "INTERNAL_RAW" {
+		return fmt.Errorf("SQL steps require an external destination; they cannot run on the internal store")
+	}
+	return nil
+}
+
+// runSQLSteps runs ELT SQL steps in the destination, in one transaction, with
+// {{table}} naming the table the pipeline loaded
+func (pe *PipelineExecutor) runSQLSteps(ctx context.Context, pipeline *models.Pipeline, executionID string, steps []models.TransformStep) error {
+	if err := checkSQLStepDestination(pipeline.DestinationType); err != nil {
+		return err
+	}
+	dest, err := pe.openDestination(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer dest.close()
+	return runSQLStepsIn(ctx, dest, pipeline, executionID, steps)
+}
+
+func runSQLStepsIn(ctx context.Context, dest *pipelineDestination, pipeline *models.Pipeline, executionID string, steps []models.TransformStep) error {
+	tx, err := dest.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	vars := sqlStepVars{Table: dest.quote(dest.table), PipelineID: pipeline.ID, ExecutionID: executionID}
+	if err := execSQLSteps(ctx, tx, steps, vars); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func execSQLSteps(ctx context.Context, tx *sql.Tx, steps []models.TransformStep, vars sqlStepVars) error {
+	for i, step := range steps {
+		statement, _ := step.Config["sql"].(string)
+		rendered, err := renderSQLStep(statement, vars)
+		if err != nil {
+			return fmt.Errorf("SQL step %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, rendered); err != nil {
+			return fmt.Errorf("SQL step %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// TransformPreview is the result of running transformation steps on a sample
+// of the pipeline's source
+type TransformPreview struct {
+	SampleRows int                      `json:"sampleRows"` // rows extracted
+	StepRows   []int                    `json:"stepRows"`   // rows after each step, in execution order
+	SQL        []string                 `json:"sql,omitempty"`
+	Rows       []map[string]interface{} `json:"rows"`
+}
+
+// PreviewTransformSteps extracts a sample of the pipeline's source and runs
+// the steps on it without loading anything. SQL steps run against a temporary
+// copy of the sample in the destination, inside a transaction that is rolled
+// back.
+func (pe *PipelineExecutor) PreviewTransformSteps(ctx context.Context, pipeline *models.Pipeline, steps []models.TransformStep, sampleSize int) (*TransformPreview, error) {
+	if err := ValidateTransformSteps(steps, pipeline.Mode, pipeline.DestinationType); err != nil {
+		return nil, err
+	}
+
+	var sourceConfig models.SourceConfig
+	if err := json.Unmarshal([]byte(pipeline.SourceConfig), &sourceConfig); err != nil {
+		return nil, fmt.Errorf("invalid source config: %w", err)
+	}
+	sample := *pipeline
+	sample.RowLimit = sampleSize
+	data, _, _, err := pe.extractData(ctx, &sample, &sourceConfig)
+	if err != nil {
+		return nil, fmt.Errorf("extraction failed: %w", err)
+	}
+
+	preview := &TransformPreview{SampleRows: len(data)}
+	inMemory, sqlSteps := splitTransformSteps(steps)
+	for i := range inMemory {
+		data, err = pe.applyTransform(ctx, pipeline, data, &inMemory[i])
+		if err != nil {
+			return nil, fmt.Errorf("step %d (%s): %w", i+1, inMemory[i].Type, err)
+		}
+		preview.StepRows = append(preview.StepRows, len(data))
+	}
+
+	if len(sqlSteps) > 0 {
+		data, err = pe.previewSQLSteps(ctx, &sample, sqlSteps, data, preview)
+		if err != nil {
+			return nil, err
+		}
+	}
+	preview.Rows = data
+	return preview, nil
+}
+
+// previewSQLSteps stages the sample in a temporary table of the destination,
+// runs the SQL steps against it and reads it back, then rolls everything back
+func (pe *PipelineExecutor) previewSQLSteps(ctx context.Context, pipeline *models.Pipeline, steps []models.TransformStep, data []map[string]interface{}, preview *TransformPreview) ([]map[string]interface{}, error) {
+	if err := checkSQLStepDestination(pipeline.DestinationType); err != nil {
+		return nil, err
+	}
+	dest, err := pe.openDestination(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer dest.close()
+	return previewSQLStepsIn(ctx, dest, pipeline, steps, data, preview)
+}
+
+func previewSQLStepsIn(ctx context.Context, dest *pipelineDestination, pipeline *models.Pipeline, steps []models.TransformStep, data []map[string]interface{}, preview *TransformPreview) ([]map[string]interface{}, error) {
+	tx, err := dest.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	staged := dest.quote(fmt.Sprintf("preview_%d", time.Now().UnixNano()))
+	if err := stageTemporaryTable(ctx, tx, dest, staged, data); err != nil {
+		return nil, fmt.Errorf("failed to stage sample: %w", err)
+	}
+	if dest.dialect == "mysql" {
+		// MySQL temporary tables outlive the transaction
+		defer tx.ExecContext(context.Background(), "DROP TEMPORARY TABLE IF EXISTS "+staged)
+	}
+
+	vars := sqlStepVars{Table: staged, PipelineID: pipeline.ID, ExecutionID: "preview"}
+	for _, step := range steps {
+		statement, _ := step.Config["sql"].(string)
+		rendered, err := renderSQLStep(statement, vars)
+		if err != nil {
+			return nil, err
+		}
+		preview.SQL = append(preview.SQL, rendered)
+	}
+	for i, statement := range preview.SQL {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return nil, fmt.Errorf("SQL step %d: %w", i+1, err)
+		}
+		var count int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+staged).Scan(&count); err != nil {
+			return nil, fmt.Errorf("SQL step %d: %w", i+1, err)
+		}
+		preview.StepRows = append(preview.StepRows, count)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+staged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read staged sample: %w", err)
+	}
+	defer rows.Close()
+	result, _, err := scanQueryRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// stageTemporaryTable creates a session-scoped table holding rows as TEXT
+func stageTemporaryTable(ctx context.Context, tx *sql.Tx, dest *pipelineDestination, table string, data []map[string]interface{}) error {
+	columnSet := make(map[string]bool)
+	for _, row := range data {
+		for col := range row {
+			columnSet[col] = true
+		}
+	}
+	columns := make([]string, 0, len(columnSet))
+	for col := range columnSet {
+		columns = append(columns, col)
+	}
+	sort.Strings(columns)
+	if len(columns) == 0 {
+		return fmt.Errorf("sample has no columns")
+	}
+
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		defs[i] = dest.quote(col) + " TEXT"
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TEMPORARY TABLE %s (%s)", table, strings.Join(defs, ", "))); err != nil {
+		return err
+	}
+	return insertBatch(ctx, tx, dest, table, columns, data)
+}
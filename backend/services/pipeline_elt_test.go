@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderSQLStep(t *testing.T) {
+	rendered, err := renderSQLStep("UPDATE {{ table }} SET run = {{execution_id}} WHERE p = {{pipeline_id}}", sqlStepVars{Table: `"t"`, PipelineID: "p'1", ExecutionID: "e1"})
+	require.NoError(t, err)
+	assert.Equal(t, `UPDATE "t" SET run = 'e1' WHERE p = 'p''1'`, rendered)
+
+	_, err = renderSQLStep("SELECT {{current_user}}", sqlStepVars{})
+	assert.ErrorContains(t, err, "{{current_user}}")
+}
+
+func TestTransformDerive(t *testing.T) {
+	pe := NewPipelineExecutor()
+	data := []map[string]interface{}{
+		{"price": 10.0, "qty": 2.0},
+		{"price": 4.0, "qty": 0.0},
+	}
+	step := &models.TransformStep{Type: "DERIVE", Config: map[string]interface{}{
+		"columns": []interface{}{
+			map[string]interface{}{"name": "total", "formula": "[price] * [qty]"},
+			map[string]interface{}{"name": "unit", "formula": "[total] / [qty]"},
+			map[string]interface{}{"name": "price", "formula": "[price] + 1"},
+		},
+	}}
+
+	_, err := pe.applyTransform(context.Background(), &models.Pipeline{}, data, step)
+	assert.ErrorContains(t, err, "column 'unit', row 2", "formula errors fail the step by default")
+
+	step.Config["onError"] = "null"
+	rows, err := pe.applyTransform(context.Background(), &models.Pipeline{}, data, step)
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, rows[0]["total"])
+	assert.Equal(t, 10.0, rows[0]["unit"], "later columns see earlier ones")
+	assert.Equal(t, 11.0, rows[0]["price"], "a derived column can replace a source column")
+	assert.Nil(t, rows[1]["unit"])
+}
+
+func TestPreviewTransformSteps(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	writePipelineFile(t, "orders.csv", "id,amount\n1,10\n2,-3\n3,7\n")
+
+	pipeline := &models.Pipeline{ID: "orders", Name: "Orders", WorkspaceID: "ws", Mode: "ELT", SourceType: "CSV", SourceConfig: `{"filePath": "orders.csv"}`, DestinationType: "INTERNAL_RAW"}
+	steps := []models.TransformStep{
+		{Type: "DERIVE", Order: 1, Config: map[string]interface{}{"columns": []interface{}{map[string]interface{}{"name": "doubled", "formula": "[amount] * 2"}}}},
+		{Type: "SQL", Order: 2, Config: map[string]interface{}{"sql": "DELETE FROM {{table}} WHERE CAST(amount AS INTEGER) < 0"}},
+	}
+
+	// SQL steps never run on the application database
+	_, err := NewPipelineExecutor().PreviewTransformSteps(context.Background(), pipeline, steps, 2)
+	assert.ErrorContains(t, err, "external destination")
+
+	preview, err := NewPipelineExecutor().PreviewTransformSteps(context.Background(), pipeline, steps[:1], 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.SampleRows)
+	assert.Equal(t, []int{2}, preview.StepRows)
+	assert.Equal(t, 20.0, preview.Rows[0]["doubled"])
+
+	// In an external destination they run on a staged copy of the sample
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	dest := &pipelineDestination{db: sqlDB, dialect: "sqlite", table: "orders"}
+	rows, err := previewSQLStepsIn(context.Background(), dest, pipeline, steps[1:], preview.Rows, preview)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, preview.StepRows)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "20", rows[0]["doubled"])
+	require.Len(t, preview.SQL, 1)
+	assert.Contains(t, preview.SQL[0], "DELETE FROM \"preview_")
+}
+
+func TestRunSQLSteps(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+	require.NoError(t, db.Exec(`CREATE TABLE "orders" (id TEXT, run TEXT)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO "orders" (id) VALUES ('1'), ('2')`).Error)
+
+	pipeline := &models.Pipeline{ID: "orders", Name: "Orders", Mode: "ELT", DestinationType: "INTERNAL_RAW"}
+	steps := []models.TransformStep{
+		{Type: "SQL", Config: map[string]interface{}{"sql": "UPDATE {{table}} SET run = {{execution_id}}"}},
+		{Type: "SQL", Config: map[string]interface{}{"sql": "DELETE FROM {{table}} WHERE id = '2'"}},
+	}
+	assert.ErrorContains(t, NewPipelineExecutor().runSQLSteps(context.Background(), pipeline, "exec-1", steps), "external destination")
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	dest := &pipelineDestination{db: sqlDB, dialect: "sqlite", table: "orders"}
+	require.NoError(t, runSQLStepsIn(context.Background(), dest, pipeline, "exec-1", steps))
+
+	var runs []string
+	require.NoError(t, db.Raw(`SELECT run FROM "orders"`).Scan(&runs).Error)
+	assert.Equal(t, []string{"exec-1"}, runs)
+
+	steps[1].Config["sql"] = "DELETE FROM {{table}} WHERE missing = 1"
+	require.Error(t, runSQLStepsIn(context.Background(), dest, pipeline, "exec-2", steps))
+	require.NoError(t, db.Raw(`SELECT run FROM "orders"`).Scan(&runs).Error)
+	assert.Equal(t, []string{"exec-1"}, runs, "a failing step rolls back the earlier ones")
+}
@@ -7,7 +7,8 @@ import (
 	"fmt"
 	"insight-engine-backend/database"
 	"insight-engine-backend/models"
-	"sort"
+	"insight-engine-backend/services/formula_engine"
+	"io"
 	"strings"
 	"sync"
 	"time"
@@ -18,19 +19,29 @@ import (
 
 // PipelineExecutor handles real data pipeline execution
 type PipelineExecutor struct {
-	db         *sql.DB
-	mu         sync.RWMutex
-	activeRuns map[string]*ExecutionContext
+	db            *sql.DB
+	mu            sync.RWMutex
+	activeRuns    map[string]*ExecutionContext
+	queryExecutor *QueryExecutor
+	restConnector *RESTConnector
+
+	formulaEngine    *formula_engine.FormulaEngine
+	formulaFunctions *FormulaFunctionService
+	notifications    *NotificationService
 }
 
-// ExecutionContext tracks a running pipeline execution
+// ExecutionContext tracks a running pipeline execution. Progress is reported
+// as rows, since a streaming run does not know its total up front; Progress
+// reaches 100 on completion.
 type ExecutionContext struct {
-	ExecutionID string
-	PipelineID  string
-	Status      string
-	Progress    int
-	Cancel      context.CancelFunc
-	StartedAt   time.Time
+	ExecutionID   string
+	PipelineID    string
+	Status        string
+	Progress      int
+	RowsExtracted int
+	RowsLoaded    int
+	Cancel        context.CancelFunc
+	StartedAt     time.Time
 }
 
 // ExecutionResult contains the outcome of a pipeline run
@@ -51,6 +62,8 @@ type QualityViolation struct {
 	RowIndex int    `json:"rowIndex"`
 	Value    string `json:"value"`
 	Message  string `json:"message"`
+
+	rule int // index of the violated rule
 }
 
 // Global executor instance
@@ -59,8 +72,41 @@ var GlobalPipelineExecutor *PipelineExecutor
 // NewPipelineExecutor creates a new pipeline executor
 func NewPipelineExecutor() *PipelineExecutor {
 	return &PipelineExecutor{
-		activeRuns: make(map[string]*ExecutionContext),
+		activeRuns:    make(map[string]*ExecutionContext),
+		restConnector: NewRESTConnector(),
+		formulaEngine: formula_engine.NewFormulaEngine(),
+	}
+}
+
+// SetQueryExecutor sets the executor used to extract from saved connections
+func (pe *PipelineExecutor) SetQueryExecutor(queryExecutor *QueryExecutor) {
+	pe.queryExecutor = queryExecutor
+}
+
+// SetFormulaFunctionService sets the service resolving workspace
+// user-defined functions in DERIVE steps
+func (pe *PipelineExecutor) SetFormulaFunctionService(svc *FormulaFunctionService) {
+	pe.formulaFunctions = svc
+}
+
+// SetNotificationService sets the service notifying workspace owners of
+// failed quality rules
+func (pe *PipelineExecutor) SetNotificationService(svc *NotificationService) {
+	pe.notifications = svc
+}
+
+// formulaEngineFor returns the formula engine for a workspace's DERIVE steps,
+// falling back to the built-in functions only
+func (pe *PipelineExecutor) formulaEngineFor(workspaceID string) *formula_engine.FormulaEngine {
+	if pe.formulaFunctions == nil || workspaceID == "" {
+		return pe.formulaEngine
 	}
+	engine, err := pe.formulaFunctions.EngineFor(workspaceID)
+	if err != nil {
+		LogWarn("formula_functions", "Failed to load workspace formula functions", map[string]interface{}{"workspace_id": workspaceID, "error": err})
+		return pe.formulaEngine
+	}
+	return engine
 }
 
 // InitPipelineExecutor initializes the global executor
@@ -69,11 +115,17 @@ func InitPipelineExecutor() {
 	LogInfo("pipeline_executor_init", "Pipeline executor initialized", nil)
 }
 
-// GetActiveRun returns the execution context for a running pipeline
+// GetActiveRun returns a snapshot of the execution context of a running
+// pipeline, nil when it is not running
 func (pe *PipelineExecutor) GetActiveRun(executionID string) *ExecutionContext {
 	pe.mu.RLock()
 	defer pe.mu.RUnlock()
-	return pe.activeRuns[executionID]
+	run, ok := pe.activeRuns[executionID]
+	if !ok {
+		return nil
+	}
+	snapshot := *run
+	return &snapshot
 }
 
 // Execute runs a complete pipeline: extract → transform → load
@@ -109,7 +161,7 @@ func (pe *PipelineExecutor) Execute(pipelineID string, executionID string) *Exec
 
 	// Step 1: Load pipeline configuration
 	result.appendLog("INFO", "INIT", "Loading pipeline configuration", "")
-	pe.updateProgress(executionID, 5, "PROCESSING")
+	pe.updateProgress(executionID, "PROCESSING", 0, 0)
 
 	var pipeline models.Pipeline
 	if err := database.DB.Preload("QualityRules").First(&pipeline, "id = ?", pipelineID).Error; err != nil {
@@ -118,9 +170,8 @@ func (pe *PipelineExecutor) Execute(pipelineID string, executionID string) *Exec
 		return pe.finalizeResult(result, startTime)
 	}
 
-	// Step 2: Parse source configuration
+	// Step 2: Parse source configuration and transformation steps
 	result.appendLog("INFO", "INIT", fmt.Sprintf("Pipeline '%s' loaded, source type: %s", pipeline.Name, pipeline.SourceType), "")
-	pe.updateProgress(executionID, 10, "EXTRACTING")
 
 	var sourceConfig models.SourceConfig
 	if err := json.Unmarshal([]byte(pipeline.SourceConfig), &sourceConfig); err != nil {
@@ -129,127 +180,235 @@ func (pe *PipelineExecutor) Execute(pipelineID string, executionID string) *Exec
 		return pe.finalizeResult(result, startTime)
 	}
 
-	// Step 3: Extract data from source
+	// CDC pipelines apply changes instead of loading rows
+	if pipeline.SourceType == "POSTGRES_CDC" {
+		if err := pe.executeCDC(ctx, &pipeline, &sourceConfig, executionID, result); err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("execution cancelled or timed out")
+			}
+			result.Error = fmt.Errorf("CDC failed: %w", err)
+			result.appendLog("ERROR", "LOAD", "Change data capture failed", err.Error())
+			return pe.finalizeResult(result, startTime)
+		}
+		pe.updateProgress(executionID, "COMPLETED", result.RowsProcessed, result.RowsProcessed)
+		result.appendLog("INFO", "COMPLETE", fmt.Sprintf("Pipeline execution completed in %dms", int(time.Since(startTime).Milliseconds())), "")
+		return pe.finalizeResult(result, startTime)
+	}
+
+	steps, err := ParseTransformSteps(pipeline.TransformationSteps)
+	if err != nil {
+		result.Error = err
+		result.appendLog("ERROR", "TRANSFORM", "Failed to parse transformation steps", err.Error())
+		return pe.finalizeResult(result, startTime)
+	}
+	if err := ValidateTransformSteps(steps, pipeline.Mode, pipeline.DestinationType); err != nil {
+		result.Error = err
+		result.appendLog("ERROR", "TRANSFORM", "Invalid transformation steps", err.Error())
+		return pe.finalizeResult(result, startTime)
+	}
+	// SQL steps (ELT mode) run in the destination after the load
+	inMemory, sqlSteps := splitTransformSteps(steps)
+
+	// Step 3: Open the source stream
 	result.appendLog("INFO", "EXTRACT", fmt.Sprintf("Connecting to %s source...", pipeline.SourceType), "")
+	pe.updateProgress(executionID, "EXTRACTING", 0, 0)
 
-	data, rowCount, bytesRead, err := pe.extractData(ctx, &pipeline, &sourceConfig)
+	source, err := pe.openSource(ctx, &pipeline, &sourceConfig)
 	if err != nil {
 		result.Error = fmt.Errorf("extraction failed: %w", err)
 		result.appendLog("ERROR", "EXTRACT", "Data extraction failed", err.Error())
 		return pe.finalizeResult(result, startTime)
 	}
-
-	result.RowsProcessed = rowCount
-	result.BytesProcessed = bytesRead
-	result.appendLog("INFO", "EXTRACT", fmt.Sprintf("Extracted %d rows (%d bytes)", rowCount, bytesRead), "")
-	pe.updateProgress(executionID, 40, "TRANSFORMING")
-
-	// Step 4: Apply transformation steps
-	if pipeline.TransformationSteps != nil && *pipeline.TransformationSteps != "" && *pipeline.TransformationSteps != "null" {
-		result.appendLog("INFO", "TRANSFORM", "Applying transformation steps...", "")
-
-		var steps []models.TransformStep
-		if err := json.Unmarshal([]byte(*pipeline.TransformationSteps), &steps); err != nil {
-			result.Error = fmt.Errorf("invalid transformation steps: %w", err)
-			result.appendLog("ERROR", "TRANSFORM", "Failed to parse transformation steps", err.Error())
+	loaded := 0
+	extracted := &countingStream{in: source, onBatch: func(rows int) {
+		pe.trackProgress(executionID, "PROCESSING", rows, loaded)
+	}}
+	var stream rowStream = &stageStream{in: extracted, stage: "EXTRACT", wrap: func(err error) error {
+		return fmt.Errorf("extraction failed: %w", err)
+	}}
+	defer func() { stream.Close() }()
+
+	// Step 4: Chain the transformation steps; batches flow through them as
+	// they are loaded
+	if len(inMemory) > 0 {
+		result.appendLog("INFO", "TRANSFORM", fmt.Sprintf("Applying %d transformation steps...", len(inMemory)), "")
+	} else if len(sqlSteps) == 0 {
+		result.appendLog("INFO", "TRANSFORM", "No transformation steps configured, skipping", "")
+	}
+	for i := range inMemory {
+		step := &inMemory[i]
+		next, err := pe.streamTransform(ctx, &pipeline, stream, step)
+		if err != nil {
+			result.Error = fmt.Errorf("transform step '%s' failed: %w", step.Type, err)
+			result.appendLog("ERROR", "TRANSFORM", fmt.Sprintf("Transform step '%s' failed", step.Type), err.Error())
 			return pe.finalizeResult(result, startTime)
 		}
+		stream = &stageStream{in: next, stage: "TRANSFORM", wrap: func(err error) error {
+			return fmt.Errorf("transform step '%s' failed: %w", step.Type, err)
+		}}
+		result.appendLog("INFO", "TRANSFORM", fmt.Sprintf("Step %d/%d: %s", i+1, len(steps), step.Type), "")
+	}
 
-		// Sort by order
-		sort.Slice(steps, func(i, j int) bool { return steps[i].Order < steps[j].Order })
+	// Step 5: Validate quality rules and load to destination, batch by batch,
+	// in one destination transaction
+	checker := newQualityChecker(pe, pipeline.QualityRules)
+	if len(pipeline.QualityRules) > 0 {
+		checker.baseline = latestQualityScorecard(pipeline.ID)
+	}
 
-		for i, step := range steps {
-			select {
-			case <-ctx.Done():
-				result.Error = fmt.Errorf("execution cancelled or timed out")
-				result.appendLog("ERROR", "TRANSFORM", "Execution cancelled", "")
-				return pe.finalizeResult(result, startTime)
-			default:
-			}
+	result.appendLog("INFO", "LOAD", fmt.Sprintf("Loading to destination (%s)...", pipeline.DestinationType), "")
+	loader, err := pe.openLoader(ctx, &pipeline)
+	if err != nil {
+		result.Error = fmt.Errorf("load failed: %w", err)
+		result.appendLog("ERROR", "LOAD", "Failed to open destination", err.Error())
+		return pe.finalizeResult(result, startTime)
+	}
+	defer loader.abort()
+	checker.lookup, err = referenceLookup(&pipeline, loader)
+	if err != nil {
+		result.Error = fmt.Errorf("load failed: %w", err)
+		result.appendLog("ERROR", "LOAD", "Failed to resolve referenced tables", err.Error())
+		return pe.finalizeResult(result, startTime)
+	}
 
-			result.appendLog("INFO", "TRANSFORM", fmt.Sprintf("Step %d/%d: %s", i+1, len(steps), step.Type), "")
-			data, err = pe.applyTransform(data, &step)
-			if err != nil {
-				result.Error = fmt.Errorf("transform step '%s' failed: %w", step.Type, err)
-				result.appendLog("ERROR", "TRANSFORM", fmt.Sprintf("Transform step '%s' failed", step.Type), err.Error())
-				return pe.finalizeResult(result, startTime)
+	if len(pipeline.QualityRules) > 0 {
+		result.appendLog("INFO", "VALIDATE", fmt.Sprintf("Running %d quality rules...", len(pipeline.QualityRules)), "")
+	}
+	for {
+		batch, err := stream.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("execution cancelled or timed out")
 			}
+			stage := errorStage(err, "LOAD")
+			result.Error = err
+			result.appendLog("ERROR", stage, "Pipeline execution failed", err.Error())
+			return pe.finalizeResult(result, startTime)
+		}
 
-			progressPct := 40 + ((i + 1) * 20 / len(steps))
-			pe.updateProgress(executionID, progressPct, "TRANSFORMING")
+		batch, failed, err := checker.check(ctx, batch)
+		if err != nil {
+			result.Error = fmt.Errorf("quality check failed: %w", err)
+			result.appendLog("ERROR", "VALIDATE", "Failed to check quality rules", err.Error())
+			return pe.finalizeResult(result, startTime)
+		}
+		if failed != nil {
+			return pe.abortOnQuality(result, &pipeline, executionID, loader, checker, failed, startTime)
+		}
+		if err := loader.quarantine(ctx, executionID, checker.takeQuarantined()); err != nil {
+			result.Error = fmt.Errorf("load failed: %w", err)
+			result.appendLog("ERROR", "VALIDATE", "Failed to quarantine rows", err.Error())
+			return pe.finalizeResult(result, startTime)
 		}
 
-		result.RowsProcessed = len(data)
-		result.appendLog("INFO", "TRANSFORM", fmt.Sprintf("Transformations complete. Rows after transforms: %d", len(data)), "")
-	} else {
-		result.appendLog("INFO", "TRANSFORM", "No transformation steps configured, skipping", "")
+		if err := loader.write(ctx, batch); err != nil {
+			result.Error = fmt.Errorf("load failed: %w", err)
+			result.appendLog("ERROR", "LOAD", "Failed to load data to destination", err.Error())
+			return pe.finalizeResult(result, startTime)
+		}
+		loaded += len(batch)
+		pe.trackProgress(executionID, "LOADING", extracted.rows, loaded)
 	}
 
-	pe.updateProgress(executionID, 65, "LOADING")
+	// Run rules check the run as a whole, before it becomes visible
+	failed, err := checker.finish(ctx, loader, sqlStepVars{PipelineID: pipeline.ID, ExecutionID: executionID}, time.Now())
+	if err != nil {
+		result.Error = fmt.Errorf("quality check failed: %w", err)
+		result.appendLog("ERROR", "VALIDATE", "Failed to check quality rules", err.Error())
+		return pe.finalizeResult(result, startTime)
+	}
+	if failed != nil {
+		return pe.abortOnQuality(result, &pipeline, executionID, loader, checker, failed, startTime)
+	}
+
+	if err := loader.commit(ctx); err != nil {
+		result.Error = fmt.Errorf("load failed: %w", err)
+		result.appendLog("ERROR", "LOAD", "Failed to commit load", err.Error())
+		return pe.finalizeResult(result, startTime)
+	}
 
-	// Step 5: Validate quality rules
+	result.RowsProcessed = loaded
+	result.BytesProcessed = extracted.bytes
+	result.QualityViolations = checker.violations
+	result.appendLog("INFO", "EXTRACT", fmt.Sprintf("Extracted %d rows (%d bytes)", extracted.rows, extracted.bytes), "")
 	if len(pipeline.QualityRules) > 0 {
-		result.appendLog("INFO", "VALIDATE", fmt.Sprintf("Running %d quality rules...", len(pipeline.QualityRules)), "")
-		violations := pe.validateQualityRules(data, pipeline.QualityRules)
-		result.QualityViolations = len(violations)
-
-		if len(violations) > 0 {
-			result.appendLog("WARN", "VALIDATE", fmt.Sprintf("%d quality violations found", len(violations)), "")
-
-			// Check for FAIL severity violations
-			for _, rule := range pipeline.QualityRules {
-				if rule.Severity == "FAIL" {
-					for _, v := range violations {
-						if v.RuleType == rule.RuleType && v.Column == rule.Column {
-							result.Error = fmt.Errorf("quality rule violation (severity=FAIL): %s on column '%s'", rule.RuleType, rule.Column)
-							result.appendLog("ERROR", "VALIDATE", "Pipeline aborted due to FAIL-severity quality violation", result.Error.Error())
-							return pe.finalizeResult(result, startTime)
-						}
-					}
-				}
-			}
+		if checker.violations > 0 {
+			result.appendLog("WARN", "VALIDATE", fmt.Sprintf("%d quality violations found", checker.violations), "")
 		} else {
 			result.appendLog("INFO", "VALIDATE", "All quality rules passed", "")
 		}
+		if checker.rowsQuarantined > 0 {
+			result.appendLog("WARN", "VALIDATE", fmt.Sprintf("%d rows quarantined", checker.rowsQuarantined), "")
+		}
+		pe.recordQualityScorecard(&pipeline, executionID, checker)
 	}
+	result.appendLog("INFO", "LOAD", fmt.Sprintf("Successfully loaded %d rows to destination", loaded), "")
 
-	pe.updateProgress(executionID, 75, "LOADING")
-
-	// Step 6: Load to destination
-	result.appendLog("INFO", "LOAD", fmt.Sprintf("Loading %d rows to destination (%s)...", len(data), pipeline.DestinationType), "")
-
-	if err := pe.loadToDestination(ctx, &pipeline, data); err != nil {
-		result.Error = fmt.Errorf("load failed: %w", err)
-		result.appendLog("ERROR", "LOAD", "Failed to load data to destination", err.Error())
-		return pe.finalizeResult(result, startTime)
+	// Step 6: Run ELT SQL steps against the loaded table
+	if len(sqlSteps) > 0 {
+		pe.updateProgress(executionID, "TRANSFORMING", extracted.rows, loaded)
+		result.appendLog("INFO", "TRANSFORM", fmt.Sprintf("Running %d SQL steps in the destination...", len(sqlSteps)), "")
+		if err := pe.runSQLSteps(ctx, &pipeline, executionID, sqlSteps); err != nil {
+			result.Error = fmt.Errorf("SQL step failed: %w", err)
+			result.appendLog("ERROR", "TRANSFORM", "SQL step failed", err.Error())
+			return pe.finalizeResult(result, startTime)
+		}
+		result.appendLog("INFO", "TRANSFORM", "SQL steps complete", "")
 	}
 
-	result.appendLog("INFO", "LOAD", fmt.Sprintf("Successfully loaded %d rows to destination", len(data)), "")
-	pe.updateProgress(executionID, 100, "COMPLETED")
+	pe.updateProgress(executionID, "COMPLETED", extracted.rows, loaded)
 
 	result.appendLog("INFO", "COMPLETE", fmt.Sprintf("Pipeline execution completed in %dms", int(time.Since(startTime).Milliseconds())), "")
 
 	return pe.finalizeResult(result, startTime)
 }
 
-// extractData connects to the source and retrieves data
+// extractData connects to the source and retrieves all of its data
 func (pe *PipelineExecutor) extractData(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) ([]map[string]interface{}, int, int64, error) {
+	source, err := pe.openSource(ctx, pipeline, config)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	rows, err := drainStream(ctx, source)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return rows, len(rows), estimateRowBytes(rows), nil
+}
+
+// openSource connects to the source and streams its data in batches
+func (pe *PipelineExecutor) openSource(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (rowStream, error) {
+	switch pipeline.SourceType {
+	case "CSV", "JSON", "EXCEL":
+		return pe.extractFromFile(ctx, pipeline, config)
+	case "REST_API":
+		return pe.extractFromREST(ctx, pipeline, config)
+	}
+
+	// Saved connections of any type go through the QueryExecutor
+	if pipeline.ConnectionID != nil && *pipeline.ConnectionID != "" {
+		return pe.extractFromConnection(ctx, pipeline, config)
+	}
+
 	switch pipeline.SourceType {
 	case "POSTGRES":
 		return pe.extractFromPostgres(ctx, pipeline, config)
 	case "MYSQL":
 		return pe.extractFromMySQL(ctx, pipeline, config)
 	default:
-		return nil, 0, 0, fmt.Errorf("unsupported source type: %s", pipeline.SourceType)
+		return nil, fmt.Errorf("unsupported source type without a connection: %s", pipeline.SourceType)
 	}
 }
 
-// extractFromPostgres extracts data from a PostgreSQL source
-func (pe *PipelineExecutor) extractFromPostgres(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) ([]map[string]interface{}, int, int64, error) {
+// extractFromPostgres streams data from a PostgreSQL source
+func (pe *PipelineExecutor) extractFromPostgres(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (rowStream, error) {
 	// Resolve connection credentials
 	host, port, dbName, username, password, sslMode, err := pe.resolveConnectionCredentials(pipeline, config)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
 	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s connect_timeout=30",
@@ -257,38 +416,32 @@ func (pe *PipelineExecutor) extractFromPostgres(ctx context.Context, pipeline *m
 
 	sourceDB, err := sql.Open("postgres", dsn)
 	if err != nil {
-		return nil, 0, 0, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
 	}
-	defer sourceDB.Close()
 
 	sourceDB.SetMaxOpenConns(5)
 	sourceDB.SetMaxIdleConns(1)
 	sourceDB.SetConnMaxLifetime(5 * time.Minute)
 
 	if err := sourceDB.PingContext(ctx); err != nil {
-		return nil, 0, 0, fmt.Errorf("PostgreSQL connection ping failed: %w", err)
+		sourceDB.Close()
+		return nil, fmt.Errorf("PostgreSQL connection ping failed: %w", err)
 	}
 
 	query := pe.resolveQuery(pipeline, config)
 	if query == "" {
-		return nil, 0, 0, fmt.Errorf("no source query configured")
-	}
-
-	// Apply row limit
-	rowLimit := pipeline.RowLimit
-	if rowLimit <= 0 {
-		rowLimit = 100000
+		sourceDB.Close()
+		return nil, fmt.Errorf("no source query configured")
 	}
-	limitedQuery := fmt.Sprintf("SELECT * FROM (%s) AS _sub LIMIT %d", query, rowLimit)
 
-	return pe.executeQuery(ctx, sourceDB, limitedQuery)
+	return pe.streamQuery(ctx, sourceDB, limitSourceQuery("postgres", query, pipelineRowLimit(pipeline)), pipelineRowLimit(pipeline), func() { sourceDB.Close() })
 }
 
-// extractFromMySQL extracts data from a MySQL source
-func (pe *PipelineExecutor) extractFromMySQL(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) ([]map[string]interface{}, int, int64, error) {
+// extractFromMySQL streams data from a MySQL source
+func (pe *PipelineExecutor) extractFromMySQL(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (rowStream, error) {
 	host, port, dbName, username, password, _, err := pe.resolveConnectionCredentials(pipeline, config)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, err
 	}
 
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=30s&parseTime=true",
@@ -296,30 +449,25 @@ func (pe *PipelineExecutor) extractFromMySQL(ctx context.Context, pipeline *mode
 
 	sourceDB, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return nil, 0, 0, fmt.Errorf("failed to connect to MySQL: %w", err)
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
 	}
-	defer sourceDB.Close()
 
 	sourceDB.SetMaxOpenConns(5)
 	sourceDB.SetMaxIdleConns(1)
 	sourceDB.SetConnMaxLifetime(5 * time.Minute)
 
 	if err := sourceDB.PingContext(ctx); err != nil {
-		return nil, 0, 0, fmt.Errorf("MySQL connection ping failed: %w", err)
+		sourceDB.Close()
+		return nil, fmt.Errorf("MySQL connection ping failed: %w", err)
 	}
 
 	query := pe.resolveQuery(pipeline, config)
 	if query == "" {
-		return nil, 0, 0, fmt.Errorf("no source query configured")
-	}
-
-	rowLimit := pipeline.RowLimit
-	if rowLimit <= 0 {
-		rowLimit = 100000
+		sourceDB.Close()
+		return nil, fmt.Errorf("no source query configured")
 	}
-	limitedQuery := fmt.Sprintf("SELECT * FROM (%s) AS _sub LIMIT %d", query, rowLimit)
 
-	return pe.executeQuery(ctx, sourceDB, limitedQuery)
+	return pe.streamQuery(ctx, sourceDB, limitSourceQuery("mysql", query, pipelineRowLimit(pipeline)), pipelineRowLimit(pipeline), func() { sourceDB.Close() })
 }
 
 // resolveConnectionCredentials gets source connection details from either ConnectionID or inline config
@@ -388,9 +536,32 @@ func (pe *PipelineExecutor) executeQuery(ctx context.Context, db *sql.DB, query
 	}
 	defer rows.Close()
 
+	result, totalBytes, err := scanQueryRows(rows)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return result, len(result), totalBytes, nil
+}
+
+// streamQuery runs a SQL query and streams its results, at most limit rows
+// (0 = all); release runs when the stream is closed
+func (pe *PipelineExecutor) streamQuery(ctx context.Context, db *sql.DB, query string, limit int, release func()) (rowStream, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		if release != nil {
+			release()
+		}
+		return nil, fmt.Errorf("query execution failed: %w", err)
+	}
+	return newSQLRowsStream(rows, limit, release)
+}
+
+// scanQueryRows reads a result set into rows keyed by column name, with a
+// rough estimate of the bytes read
+func scanQueryRows(rows *sql.Rows) ([]map[string]interface{}, int64, error) {
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, 0, 0, fmt.Errorf("failed to get columns: %w", err)
+		return nil, 0, fmt.Errorf("failed to get columns: %w", err)
 	}
 
 	var result []map[string]interface{}
@@ -404,7 +575,7 @@ func (pe *PipelineExecutor) executeQuery(ctx context.Context, db *sql.DB, query
 		}
 
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, 0, 0, fmt.Errorf("scan failed: %w", err)
+			return nil, 0, fmt.Errorf("scan failed: %w", err)
 		}
 
 		row := make(map[string]interface{})
@@ -425,14 +596,14 @@ func (pe *PipelineExecutor) executeQuery(ctx context.Context, db *sql.DB, query
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, 0, 0, fmt.Errorf("row iteration error: %w", err)
+		return nil, 0, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	return result, len(result), totalBytes, nil
+	return result, totalBytes, nil
 }
 
 // applyTransform applies a single transformation step to the data
-func (pe *PipelineExecutor) applyTransform(data []map[string]interface{}, step *models.TransformStep) ([]map[string]interface{}, error) {
+func (pe *PipelineExecutor) applyTransform(ctx context.Context, pipeline *models.Pipeline, data []map[string]interface{}, step *models.TransformStep) ([]map[string]interface{}, error) {
 	switch step.Type {
 	case "FILTER":
 		return pe.transformFilter(data, step.Config)
@@ -441,11 +612,35 @@ func (pe *PipelineExecutor) applyTransform(data []map[string]interface{}, step *
 	case "CAST":
 		return pe.transformCast(data, step.Config)
 	case "DEDUPLICATE":
-		return pe.transformDeduplicate(data, step.Config)
+		var config TransformDeduplicateConfig
+		if err := decodeStepConfig(step.Config, &config); err != nil {
+			return data, err
+		}
+		return TransformDeduplicate(data, config), nil
 	case "AGGREGATE":
 		return pe.transformAggregate(data, step.Config)
+	case "JOIN":
+		return pe.transformJoin(ctx, pipeline, data, step.Config)
+	case "UNION":
+		return pe.transformUnion(ctx, pipeline, data, step.Config)
+	case "PIVOT":
+		var config TransformPivotConfig
+		if err := decodeStepConfig(step.Config, &config); err != nil {
+			return data, err
+		}
+		return TransformPivot(data, config)
+	case "UNPIVOT":
+		var config TransformUnpivotConfig
+		if err := decodeStepConfig(step.Config, &config); err != nil {
+			return data, err
+		}
+		return TransformUnpivot(data, config)
+	case "DERIVE":
+		return pe.transformDerive(pipeline, data, step.Config)
+	case "SQL":
+		return data, fmt.Errorf("SQL steps run in the destination after the load")
 	default:
-		return data, nil // Unknown transform types are silently skipped
+		return data, fmt.Errorf("unknown transform type: %s", step.Type)
 	}
 }
 
@@ -512,39 +707,6 @@ func (pe *PipelineExecutor) transformCast(data []map[string]interface{}, config
 	return data, nil
 }
 
-// transformDeduplicate removes duplicate rows based on specified columns
-func (pe *PipelineExecutor) transformDeduplicate(data []map[string]interface{}, config map[string]interface{}) ([]map[string]interface{}, error) {
-	columnsRaw, ok := config["columns"].([]interface{})
-	if !ok || len(columnsRaw) == 0 {
-		return data, fmt.Errorf("deduplicate requires 'columns' array")
-	}
-
-	var columns []string
-	for _, c := range columnsRaw {
-		if s, ok := c.(string); ok {
-			columns = append(columns, s)
-		}
-	}
-
-	seen := make(map[string]bool)
-	var result []map[string]interface{}
-
-	for _, row := range data {
-		var keyParts []string
-		for _, col := range columns {
-			keyParts = append(keyParts, fmt.Sprintf("%v", row[col]))
-		}
-		key := strings.Join(keyParts, "||")
-
-		if !seen[key] {
-			seen[key] = true
-			result = append(result, row)
-		}
-	}
-
-	return result, nil
-}
-
 // transformAggregate groups data and applies aggregate functions
 func (pe *PipelineExecutor) transformAggregate(data []map[string]interface{}, config map[string]interface{}) ([]map[string]interface{}, error) {
 	groupByRaw, _ := config["groupBy"].([]interface{})
@@ -659,80 +821,9 @@ func (pe *PipelineExecutor) computeAggregate(rows []map[string]interface{}, colu
 	}
 }
 
-// validateQualityRules checks data against quality rules
-func (pe *PipelineExecutor) validateQualityRules(data []map[string]interface{}, rules []models.QualityRule) []QualityViolation {
-	var violations []QualityViolation
-
-	for _, rule := range rules {
-		for i, row := range data {
-			val := row[rule.Column]
-
-			var violated bool
-			switch rule.RuleType {
-			case "NOT_NULL":
-				violated = val == nil || fmt.Sprintf("%v", val) == ""
-			case "UNIQUE":
-				// Check uniqueness across all rows (O(n) per rule)
-				for j, otherRow := range data {
-					if j != i && fmt.Sprintf("%v", otherRow[rule.Column]) == fmt.Sprintf("%v", val) {
-						violated = true
-						break
-					}
-				}
-			case "RANGE":
-				if rule.Value != nil {
-					var rangeConfig struct {
-						Min float64 `json:"min"`
-						Max float64 `json:"max"`
-					}
-					if err := json.Unmarshal([]byte(*rule.Value), &rangeConfig); err == nil {
-						numVal := pe.toFloat64(val)
-						violated = numVal < rangeConfig.Min || numVal > rangeConfig.Max
-					}
-				}
-			case "REGEX":
-				// Simple string match for now
-				if rule.Value != nil && val != nil {
-					valStr := fmt.Sprintf("%v", val)
-					violated = !strings.Contains(valStr, *rule.Value)
-				}
-			}
-
-			if violated {
-				violations = append(violations, QualityViolation{
-					RuleID:   rule.ID,
-					Column:   rule.Column,
-					RuleType: rule.RuleType,
-					RowIndex: i,
-					Value:    fmt.Sprintf("%v", val),
-					Message:  fmt.Sprintf("Row %d, column '%s': %s rule violated", i, rule.Column, rule.RuleType),
-				})
-			}
-		}
-	}
-
-	return violations
-}
-
-// loadToDestination writes processed data to the target
-func (pe *PipelineExecutor) loadToDestination(ctx context.Context, pipeline *models.Pipeline, data []map[string]interface{}) error {
-	if len(data) == 0 {
-		return nil // Nothing to load
-	}
-
-	switch pipeline.DestinationType {
-	case "INTERNAL_RAW":
-		return pe.loadToInternalRaw(ctx, pipeline, data)
-	case "POSTGRES", "MYSQL":
-		return pe.loadToExternalDB(ctx, pipeline, data)
-	default:
-		return fmt.Errorf("unsupported destination type: %s", pipeline.DestinationType)
-	}
-}
-
-// loadToInternalRaw writes data to the application's own database as a raw table
-func (pe *PipelineExecutor) loadToInternalRaw(ctx context.Context, pipeline *models.Pipeline, data []map[string]interface{}) error {
-	// Generate table name from pipeline name
+// internalRawTableName is the table an INTERNAL_RAW pipeline loads into,
+// generated from the pipeline name
+func internalRawTableName(pipeline *models.Pipeline) string {
 	tableName := fmt.Sprintf("pipeline_data_%s", strings.ReplaceAll(strings.ToLower(pipeline.Name), " ", "_"))
 	tableName = strings.Map(func(r rune) rune {
 		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
@@ -745,215 +836,68 @@ func (pe *PipelineExecutor) loadToInternalRaw(ctx context.Context, pipeline *mod
 	if len(tableName) > 63 {
 		tableName = tableName[:63]
 	}
-
-	// Determine columns from first row
-	firstRow := data[0]
-	var columns []string
-	for col := range firstRow {
-		columns = append(columns, col)
-	}
-	sort.Strings(columns) // Deterministic column order
-
-	// Create the table (DROP + CREATE for OVERWRITE mode, or CREATE IF NOT EXISTS for APPEND)
-	writeMode := "OVERWRITE"
-	if pipeline.DestinationConfig != nil {
-		var destConf models.DestConfig
-		if err := json.Unmarshal([]byte(*pipeline.DestinationConfig), &destConf); err == nil && destConf.WriteMode != "" {
-			writeMode = destConf.WriteMode
-		}
-	}
-
-	sqlDB, err := database.DB.DB()
-	if err != nil {
-		return fmt.Errorf("failed to get underlying DB: %w", err)
-	}
-
-	if writeMode == "OVERWRITE" {
-		dropSQL := fmt.Sprintf(`DROP TABLE IF EXISTS "%s"`, tableName)
-		if _, err := sqlDB.ExecContext(ctx, dropSQL); err != nil {
-			return fmt.Errorf("failed to drop existing table: %w", err)
-		}
-	}
-
-	// Build CREATE TABLE with TEXT columns (raw ingestion pattern)
-	var colDefs []string
-	for _, col := range columns {
-		colDefs = append(colDefs, fmt.Sprintf(`"%s" TEXT`, col))
-	}
-	createSQL := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (%s)`, tableName, strings.Join(colDefs, ", "))
-	if _, err := sqlDB.ExecContext(ctx, createSQL); err != nil {
-		return fmt.Errorf("failed to create table: %w", err)
-	}
-
-	// Batch insert data (chunks of 500 rows)
-	batchSize := 500
-	for i := 0; i < len(data); i += batchSize {
-		end := i + batchSize
-		if end > len(data) {
-			end = len(data)
-		}
-		batch := data[i:end]
-
-		if err := pe.insertBatch(ctx, sqlDB, tableName, columns, batch); err != nil {
-			return fmt.Errorf("batch insert failed at row %d: %w", i, err)
-		}
-	}
-
-	return nil
+	return tableName
 }
 
-// loadToExternalDB writes data to an external database
-func (pe *PipelineExecutor) loadToExternalDB(ctx context.Context, pipeline *models.Pipeline, data []map[string]interface{}) error {
-	if pipeline.DestinationConfig == nil {
-		return fmt.Errorf("destination config required for external DB target")
-	}
-
-	var destConf models.DestConfig
-	if err := json.Unmarshal([]byte(*pipeline.DestinationConfig), &destConf); err != nil {
-		return fmt.Errorf("invalid destination config: %w", err)
-	}
-
-	if destConf.ConnectionID == "" {
-		return fmt.Errorf("connectionId required in destination config for external DB")
-	}
-
-	// Get destination connection
-	var conn models.Connection
-	if err := database.DB.First(&conn, "id = ?", destConf.ConnectionID).Error; err != nil {
-		return fmt.Errorf("destination connection not found: %w", err)
-	}
-
-	// Build DSN
-	var dsn string
-	var driver string
-	host := ""
-	if conn.Host != nil {
-		host = *conn.Host
-	}
-	port := 5432
-	if conn.Port != nil {
-		port = *conn.Port
-	}
-	username := ""
-	if conn.Username != nil {
-		username = *conn.Username
-	}
-	password := ""
-	if conn.Password != nil {
-		password = *conn.Password
-	}
-
-	switch pipeline.DestinationType {
-	case "POSTGRES":
-		driver = "postgres"
-		dsn = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable connect_timeout=30",
-			host, port, username, password, conn.Database)
-	case "MYSQL":
-		driver = "mysql"
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?timeout=30s&parseTime=true",
-			username, password, host, port, conn.Database)
-	default:
-		return fmt.Errorf("unsupported destination type: %s", pipeline.DestinationType)
-	}
-
-	destDB, err := sql.Open(driver, dsn)
-	if err != nil {
-		return fmt.Errorf("failed to connect to destination: %w", err)
-	}
-	defer destDB.Close()
-
-	destDB.SetMaxOpenConns(5)
-	destDB.SetConnMaxLifetime(5 * time.Minute)
-
-	if err := destDB.PingContext(ctx); err != nil {
-		return fmt.Errorf("destination ping failed: %w", err)
+// externalTableName is the table an external DB pipeline loads into
+func externalTableName(pipeline *models.Pipeline, destConf *models.DestConfig) string {
+	if destConf.TableName != "" {
+		return destConf.TableName
 	}
+	return fmt.Sprintf("pipeline_%s", pipeline.ID)
+}
 
-	tableName := destConf.TableName
-	if tableName == "" {
-		tableName = fmt.Sprintf("pipeline_%s", pipeline.ID)
+// Helper: updateProgress records the status and row counts of a run in the
+// live status and the execution record; progress reaches 100 on completion.
+// A failed write is logged rather than failing the run.
+func (pe *PipelineExecutor) updateProgress(executionID string, status string, rowsExtracted int, rowsLoaded int) {
+	updates := map[string]interface{}{
+		"status":         status,
+		"rows_processed": rowsLoaded,
 	}
-
-	// Determine columns
-	var columns []string
-	for col := range data[0] {
-		columns = append(columns, col)
+	if pe.trackProgress(executionID, status, rowsExtracted, rowsLoaded) && status == "COMPLETED" {
+		updates["progress"] = 100
 	}
-	sort.Strings(columns)
 
-	// Batch insert
-	batchSize := 500
-	for i := 0; i < len(data); i += batchSize {
-		end := i + batchSize
-		if end > len(data) {
-			end = len(data)
-		}
-		batch := data[i:end]
-
-		if err := pe.insertBatch(ctx, destDB, tableName, columns, batch); err != nil {
-			return fmt.Errorf("external batch insert failed at row %d: %w", i, err)
-		}
+	if err := database.DB.Model(&models.JobExecution{}).
+		Where("id = ?", executionID).
+		Updates(updates).Error; err != nil {
+		LogWarn("pipeline_progress", "Failed to record run progress", map[string]interface{}{"execution_id": executionID, "status": status, "error": err.Error()})
 	}
-
-	return nil
 }
 
-// insertBatch inserts a batch of rows into a table
-func (pe *PipelineExecutor) insertBatch(ctx context.Context, db *sql.DB, tableName string, columns []string, rows []map[string]interface{}) error {
-	if len(rows) == 0 {
-		return nil
-	}
-
-	// Build parameterized INSERT
-	var quotedCols []string
-	for _, col := range columns {
-		quotedCols = append(quotedCols, fmt.Sprintf(`"%s"`, col))
+// trackProgress updates only the live status of an active run. Batches use
+// it while the load transaction is open: the execution record may live in
+// the destination database, whose write lock the load holds on SQLite.
+func (pe *PipelineExecutor) trackProgress(executionID string, status string, rowsExtracted int, rowsLoaded int) bool {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+	ctx, ok := pe.activeRuns[executionID]
+	if !ok {
+		return false
 	}
-
-	var valueRows []string
-	var args []interface{}
-	paramIdx := 1
-
-	for _, row := range rows {
-		var placeholders []string
-		for _, col := range columns {
-			placeholders = append(placeholders, fmt.Sprintf("$%d", paramIdx))
-			val := row[col]
-			if val == nil {
-				args = append(args, nil)
-			} else {
-				args = append(args, fmt.Sprintf("%v", val))
-			}
-			paramIdx++
-		}
-		valueRows = append(valueRows, fmt.Sprintf("(%s)", strings.Join(placeholders, ", ")))
+	ctx.Status = status
+	ctx.RowsExtracted = rowsExtracted
+	ctx.RowsLoaded = rowsLoaded
+	if status == "COMPLETED" {
+		ctx.Progress = 100
 	}
-
-	insertSQL := fmt.Sprintf(`INSERT INTO "%s" (%s) VALUES %s`,
-		tableName,
-		strings.Join(quotedCols, ", "),
-		strings.Join(valueRows, ", "))
-
-	_, err := db.ExecContext(ctx, insertSQL)
-	return err
+	return true
 }
 
-// Helper: updateProgress updates the execution context progress
-func (pe *PipelineExecutor) updateProgress(executionID string, progress int, status string) {
-	pe.mu.Lock()
-	if ctx, ok := pe.activeRuns[executionID]; ok {
-		ctx.Progress = progress
-		ctx.Status = status
+// abortOnQuality ends a run a FAIL-severity rule stopped: nothing is loaded
+// and the scorecard is recorded
+func (pe *PipelineExecutor) abortOnQuality(result *ExecutionResult, pipeline *models.Pipeline, executionID string, loader *tableLoader, checker *qualityChecker, failed *QualityViolation, startTime time.Time) *ExecutionResult {
+	loader.abort()
+	pe.recordQualityScorecard(pipeline, executionID, checker)
+	result.QualityViolations = checker.violations
+	if failed.Column != "" {
+		result.Error = fmt.Errorf("quality rule violation (severity=FAIL): %s on column '%s'", failed.RuleType, failed.Column)
+	} else {
+		result.Error = fmt.Errorf("quality rule violation (severity=FAIL): %s", failed.RuleType)
 	}
-	pe.mu.Unlock()
-
-	// Also update DB
-	database.DB.Model(&models.JobExecution{}).
-		Where("id = ?", executionID).
-		Updates(map[string]interface{}{
-			"progress": progress,
-			"status":   status,
-		})
+	result.appendLog("ERROR", "VALIDATE", "Pipeline aborted due to FAIL-severity quality violation", result.Error.Error()+": "+failed.Message)
+	return pe.finalizeResult(result, startTime)
 }
 
 // Helper: finalizeResult calculates duration and serializes logs
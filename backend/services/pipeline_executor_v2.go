@@ -8,16 +8,17 @@ import (
 
 // ============================================================
 // Pipeline Executor V2 Transforms (GAP-010)
-// Adds: JOIN, UNION, PIVOT, DEDUPLICATE
+// Adds: JOIN, UNION, PIVOT, UNPIVOT, DEDUPLICATE
 // These extend the existing PipelineExecutor.applyTransform
 // ============================================================
 
 // TransformJoinConfig configures a join operation
 type TransformJoinConfig struct {
-	JoinType string `json:"joinType"` // inner, left, right, full
-	LeftKey  string `json:"leftKey"`
-	RightKey string `json:"rightKey"`
-	Prefix   string `json:"prefix,omitempty"` // prefix for right-side columns to avoid collisions
+	JoinType string         `json:"joinType"` // inner, left, right, full
+	LeftKey  string         `json:"leftKey"`
+	RightKey string         `json:"rightKey"`
+	Prefix   string         `json:"prefix,omitempty"` // prefix for right-side columns to avoid collisions
+	Input    TransformInput `json:"input"`            // right-side dataset when run as a pipeline step
 }
 
 // TransformPivotConfig configures a pivot operation
@@ -31,14 +32,23 @@ type TransformPivotConfig struct {
 // TransformDeduplicateConfig configures deduplication
 type TransformDeduplicateConfig struct {
 	Columns    []string `json:"columns"`              // columns to check for duplicates
-	KeepFirst  bool     `json:"keepFirst"`            // true = keep first occurrence, false = keep last
+	KeepFirst  *bool    `json:"keepFirst,omitempty"`  // true (default) = keep first occurrence, false = keep last
 	SortColumn string   `json:"sortColumn,omitempty"` // optional sort before dedup
 	SortOrder  string   `json:"sortOrder,omitempty"`  // asc or desc
 }
 
 // TransformUnionConfig configures a union operation
 type TransformUnionConfig struct {
-	Distinct bool `json:"distinct"` // true = remove duplicates after union
+	Distinct bool           `json:"distinct"` // true = remove duplicates after union
+	Input    TransformInput `json:"input"`    // bottom dataset when run as a pipeline step
+}
+
+// TransformInput is the second dataset of a JOIN or UNION pipeline step: a
+// query on a saved connection, or the output table of another pipeline
+type TransformInput struct {
+	ConnectionID string `json:"connectionId,omitempty"`
+	Query        string `json:"query,omitempty"`
+	PipelineID   string `json:"pipelineId,omitempty"`
 }
 
 // ---- Join Transform ----
@@ -290,12 +300,26 @@ func TransformDeduplicate(
 		})
 	}
 
-	if len(config.Columns) > 0 {
-		return deduplicateRows(data, config.Columns)
+	// Keeping the last occurrence is keeping the first one of the reversed rows
+	keepLast := config.KeepFirst != nil && !*config.KeepFirst
+	if keepLast {
+		data = reversedRows(data)
 	}
 
-	// Deduplicate on all columns
-	return deduplicateRows(data, nil)
+	// No columns: deduplicate on all columns
+	result := deduplicateRows(data, config.Columns)
+	if keepLast {
+		result = reversedRows(result)
+	}
+	return result
+}
+
+func reversedRows(data []map[string]interface{}) []map[string]interface{} {
+	reversed := make([]map[string]interface{}, len(data))
+	for i, row := range data {
+		reversed[len(data)-1-i] = row
+	}
+	return reversed
 }
 
 func deduplicateRows(data []map[string]interface{}, columns []string) []map[string]interface{} {
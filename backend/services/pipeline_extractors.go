@@ -0,0 +1,379 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// defaultPipelineMaxPages bounds how many pages a REST source fetches per run
+const defaultPipelineMaxPages = 100
+
+// pipelineRowLimit returns the maximum number of rows a run extracts, 0 for
+// no limit
+func pipelineRowLimit(pipeline *models.Pipeline) int {
+	if pipeline.RowLimit <= 0 {
+		return 0
+	}
+	return pipeline.RowLimit
+}
+
+// pipelineFilesDir is the directory file sources are read from, set with
+// PIPELINE_FILES_DIR
+func pipelineFilesDir() string {
+	if dir := os.Getenv("PIPELINE_FILES_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("data", "pipeline-files")
+}
+
+// resolvePipelineFile resolves a file source path, which must stay inside
+// the pipeline files directory
+func resolvePipelineFile(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", fmt.Errorf("no file path configured")
+	}
+	root, err := filepath.Abs(pipelineFilesDir())
+	if err != nil {
+		return "", err
+	}
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(root, full)
+	}
+	full = filepath.Clean(full)
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file %s is outside the pipeline files directory", path)
+	}
+	return full, nil
+}
+
+// extractFromFile streams a CSV, JSON or Excel file source with the file
+// importers. CSV and JSON files are read a batch at a time; Excel workbooks
+// are read whole.
+func (pe *PipelineExecutor) extractFromFile(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (rowStream, error) {
+	path, err := resolvePipelineFile(config.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+
+	stream, err := openFileStream(ctx, pipeline, config, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func openFileStream(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig, file *os.File) (rowStream, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	csvImporter := NewCSVImporter()
+	if info.Size() > csvImporter.maxFileSize {
+		return nil, fmt.Errorf("file too large: %d bytes (max %d)", info.Size(), csvImporter.maxFileSize)
+	}
+
+	limit := pipelineRowLimit(pipeline)
+	hasHeader := config.HasHeader == nil || *config.HasHeader
+
+	switch pipeline.SourceType {
+	case "CSV":
+		options := csvImporter.GetDefaultOptions()
+		options.HasHeader = hasHeader
+		options.SkipRows = config.SkipRows
+		options.MaxRows = limit
+
+		reader := bufio.NewReader(file)
+		if delimiter, ok := parseDelimiter(config.Delimiter); ok {
+			options.Delimiter = delimiter
+		} else {
+			sample, _ := reader.Peek(4096)
+			options.Delimiter = csvImporter.DetectDelimiter(string(sample))
+		}
+		rows, err := csvImporter.newCSVRowReader(ctx, reader, options)
+		if err != nil {
+			return nil, err
+		}
+		return &fileStream{file: file, next: func(ctx context.Context) ([]map[string]interface{}, error) {
+			return rows.next(ctx, pipelineBatchSize)
+		}}, nil
+
+	case "JSON":
+		importer := NewJSONImporter()
+		options := importer.GetDefaultOptions()
+		options.RootPath = config.DataPath
+		options.MaxRows = limit
+		rows, err := importer.newJSONRowReader(bufio.NewReader(file), options)
+		if err != nil {
+			return nil, err
+		}
+		return &fileStream{file: file, next: func(ctx context.Context) ([]map[string]interface{}, error) {
+			return rows.next(ctx, pipelineBatchSize)
+		}}, nil
+
+	case "EXCEL":
+		importer := NewExcelImporter()
+		options := importer.GetDefaultOptions()
+		options.SheetName = config.SheetName
+		options.HasHeader = hasHeader
+		options.SkipRows = config.SkipRows
+		options.MaxRows = limit
+		rows, err := importer.ReadExcelRows(ctx, file, options)
+		if err != nil {
+			return nil, err
+		}
+		if limit > 0 && len(rows) > limit {
+			rows = rows[:limit]
+		}
+		return &fileStream{file: file, next: (&sliceStream{rows: rows}).Next}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported file source type: %s", pipeline.SourceType)
+	}
+}
+
+// fileStream streams the records of a file source and closes the file
+type fileStream struct {
+	file *os.File
+	next func(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+func (s *fileStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	return s.next(ctx)
+}
+
+func (s *fileStream) Close() error { return s.file.Close() }
+
+// parseDelimiter reads a configured CSV delimiter; "\t" and "tab" mean a tab
+func parseDelimiter(value string) (rune, bool) {
+	switch value {
+	case "":
+		return 0, false
+	case `\t`, "tab":
+		return '\t', true
+	}
+	return []rune(value)[0], true
+}
+
+// extractFromREST streams a REST API source with the REST connector a page
+// at a time, following its pagination until the row limit or the page limit
+// is reached
+func (pe *PipelineExecutor) extractFromREST(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (rowStream, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("no URL configured")
+	}
+	if err := pe.restConnector.authService.ValidateAuthConfig(config.AuthType, config.AuthConfig); err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+
+	method := strings.ToUpper(config.Method)
+	if method == "" {
+		method = "GET"
+	}
+	restConfig := &RESTConnectorConfig{
+		// Stable per pipeline, so OAuth2 tokens are reused across runs
+		ID:               uuid.NewSHA1(uuid.NameSpaceURL, []byte("pipeline:"+pipeline.ID)),
+		Name:             pipeline.Name,
+		BaseURL:          config.URL,
+		Method:           method,
+		Headers:          config.Headers,
+		QueryParams:      make(map[string]string, len(config.QueryParams)),
+		Body:             config.Body,
+		AuthType:         config.AuthType,
+		AuthConfig:       config.AuthConfig,
+		PaginationType:   config.PaginationType,
+		PaginationConfig: make(map[string]string, len(config.PaginationConfig)),
+		DataPath:         config.DataPath,
+		RetryCount:       3,
+		RetryDelay:       1,
+	}
+	for k, v := range config.QueryParams {
+		restConfig.QueryParams[k] = v
+	}
+	for k, v := range config.PaginationConfig {
+		restConfig.PaginationConfig[k] = v
+	}
+
+	maxPages := config.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultPipelineMaxPages
+	}
+	pageSize := 100
+	if size, err := strconv.Atoi(restConfig.PaginationConfig["limit"]); err == nil && size > 0 {
+		pageSize = size
+	}
+	return &restStream{connector: pe.restConnector, config: restConfig, limit: pipelineRowLimit(pipeline), maxPages: maxPages, pageSize: pageSize}, nil
+}
+
+// restStream fetches the pages of a REST source one at a time
+type restStream struct {
+	connector *RESTConnector
+	config    *RESTConnectorConfig
+	limit     int // rows, 0 = no limit
+	maxPages  int
+	pageSize  int // offset pagination: a shorter page is the last
+	page      *RESTDataResult
+	fetched   int
+	read      int
+	done      bool
+}
+
+func (s *restStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if s.done || s.fetched >= s.maxPages {
+		return nil, io.EOF
+	}
+
+	var page *RESTDataResult
+	var err error
+	switch {
+	case s.fetched == 0 && s.config.PaginationType != "offset" && s.config.PaginationType != "page":
+		page, err = s.connector.FetchData(ctx, s.config, 0)
+	default:
+		// Page pagination reads the page being fetched to tell whether more follow
+		s.config.PaginationConfig["current_page"] = strconv.Itoa(s.fetched + 1)
+		cursor := ""
+		if s.page != nil {
+			cursor = s.page.NextCursor
+		}
+		page, err = s.connector.GetNextPage(ctx, s.config, s.fetched, cursor)
+	}
+	s.fetched++
+	if err != nil {
+		return nil, fmt.Errorf("page %d: %w", s.fetched, err)
+	}
+	s.page = page
+
+	rows := page.Rows
+	switch {
+	case s.limit > 0 && s.read+len(rows) >= s.limit:
+		rows = rows[:s.limit-s.read]
+		s.done = true
+	case !page.HasMore || len(page.Rows) == 0:
+		s.done = true
+	case s.config.PaginationType == "offset" && len(page.Rows) < s.pageSize:
+		s.done = true
+	}
+	s.read += len(rows)
+	if len(rows) == 0 {
+		return nil, io.EOF
+	}
+	return rows, nil
+}
+
+func (s *restStream) Close() error { return nil }
+
+// estimateRowBytes approximates the size of extracted rows the way
+// executeQuery does: text by length, other values as 8 bytes
+func estimateRowBytes(rows []map[string]interface{}) int64 {
+	var total int64
+	for _, row := range rows {
+		for _, val := range row {
+			if s, ok := val.(string); ok {
+				total += int64(len(s))
+			} else {
+				total += 8
+			}
+		}
+	}
+	return total
+}
+
+// extractFromConnection streams the source query on a saved connection
+// through the QueryExecutor, so every connection type it supports can be a
+// source
+func (pe *PipelineExecutor) extractFromConnection(ctx context.Context, pipeline *models.Pipeline, config *models.SourceConfig) (rowStream, error) {
+	query := pe.resolveQuery(pipeline, config)
+	if query == "" {
+		return nil, fmt.Errorf("no source query configured")
+	}
+	return pe.streamConnection(ctx, *pipeline.ConnectionID, query, pipelineRowLimit(pipeline))
+}
+
+// queryConnection runs a query on a saved connection, returning at most limit
+// rows (0 = all)
+func (pe *PipelineExecutor) queryConnection(ctx context.Context, connectionID string, query string, limit int) ([]map[string]interface{}, int, int64, error) {
+	stream, err := pe.streamConnection(ctx, connectionID, query, limit)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	rows, err := drainStream(ctx, stream)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return rows, len(rows), estimateRowBytes(rows), nil
+}
+
+// streamConnection streams a query on a saved connection, at most limit rows
+// (0 = all)
+func (pe *PipelineExecutor) streamConnection(ctx context.Context, connectionID string, query string, limit int) (rowStream, error) {
+	if pe.queryExecutor == nil {
+		return nil, fmt.Errorf("query executor not configured")
+	}
+	var conn models.Connection
+	if err := database.DB.First(&conn, "id = ?", connectionID).Error; err != nil {
+		return nil, fmt.Errorf("connection not found: %w", err)
+	}
+	limitedQuery := limitSourceQuery(conn.Type, query, limit)
+
+	// Acceleration connections live in the in-process SQLite store. The rows
+	// are read up front, as a load may write to the same store.
+	if conn.Type == "duckdb" || conn.Type == "sqlite_memory" {
+		accel := GetAccelerationService()
+		if accel == nil || accel.db == nil {
+			return nil, fmt.Errorf("embedded engine not available")
+		}
+		result, err := accel.db.QueryContext(ctx, limitedQuery)
+		if err != nil {
+			return nil, fmt.Errorf("query execution failed: %w", err)
+		}
+		stream, err := newSQLRowsStream(result, limit, nil)
+		if err != nil {
+			return nil, err
+		}
+		defer stream.Close()
+		rows, err := drainStream(ctx, stream)
+		if err != nil {
+			return nil, err
+		}
+		return &sliceStream{rows: rows, columns: stream.sourceColumns()}, nil
+	}
+
+	db, err := pe.queryExecutor.getConnection(&conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", conn.Type, err)
+	}
+	return pe.streamQuery(ctx, db, limitedQuery, limit, nil)
+}
+
+// limitSourceQuery wraps a source query so it returns at most limit rows, in
+// the syntax of the connection's dialect; a limit of 0 leaves it unchanged
+func limitSourceQuery(connType string, query string, limit int) string {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if limit <= 0 {
+		return query
+	}
+	switch normalizeSQLDialect(connType) {
+	case "sqlserver":
+		return fmt.Sprintf("SELECT TOP %d * FROM (%s) AS _sub", limit, query)
+	case "oracle":
+		return fmt.Sprintf("SELECT * FROM (%s) _sub FETCH FIRST %d ROWS ONLY", query, limit)
+	default:
+		return fmt.Sprintf("SELECT * FROM (%s) AS _sub LIMIT %d", query, limit)
+	}
+}
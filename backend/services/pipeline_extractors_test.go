@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func writePipelineFile(t *testing.T, name string, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(os.Getenv("PIPELINE_FILES_DIR"), name), []byte(content), 0o644))
+}
+
+func extractPipeline(t *testing.T, pipeline *models.Pipeline, config models.SourceConfig) ([]map[string]interface{}, error) {
+	t.Helper()
+	rows, count, _, err := NewPipelineExecutor().extractData(context.Background(), pipeline, &config)
+	if err == nil {
+		assert.Equal(t, len(rows), count)
+	}
+	return rows, err
+}
+
+func TestExtractFromFile_CSV(t *testing.T) {
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	writePipelineFile(t, "orders.csv", "Order ID;Amount;Paid;Region\n1;10.5;yes;US\n2;7;no;NA\n3;;yes;EU\n")
+
+	rows, err := extractPipeline(t, &models.Pipeline{SourceType: "CSV", RowLimit: 2}, models.SourceConfig{FilePath: "orders.csv"})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, map[string]interface{}{"order_id": int64(1), "amount": 10.5, "paid": true, "region": "US"}, rows[0])
+	assert.Nil(t, rows[1]["region"], "NA is a NULL marker")
+
+	noHeader := false
+	rows, err = extractPipeline(t, &models.Pipeline{SourceType: "CSV"}, models.SourceConfig{FilePath: "orders.csv", Delimiter: ";", HasHeader: &noHeader, SkipRows: 1})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, int64(3), rows[2]["column_1"])
+}
+
+func TestExtractFromFile_JSON(t *testing.T) {
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	writePipelineFile(t, "events.json", `{"meta": {"count": 2}, "result": {"events": [
+		{"id": 9007199254740993, "user": {"name": "ana"}, "tags": ["a", "b"], "score": 1.5},
+		{"id": 2, "user": {"name": "bo"}, "tags": [], "score": null}
+	]}}`)
+
+	rows, err := extractPipeline(t, &models.Pipeline{SourceType: "JSON"}, models.SourceConfig{FilePath: "events.json", DataPath: "result.events"})
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, int64(9007199254740993), rows[0]["id"], "large IDs keep their precision")
+	assert.Equal(t, "ana", rows[0]["user_name"])
+	assert.Equal(t, `["a","b"]`, rows[0]["tags"])
+	assert.Equal(t, 1.5, rows[0]["score"])
+	assert.Nil(t, rows[1]["score"])
+}
+
+func TestOpenSource_StreamsFilesInBatches(t *testing.T) {
+	withSmallBatches(t)
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	writePipelineFile(t, "ids.csv", "id\n1\n2\n3\n4\n5\n6\n7\n")
+	writePipelineFile(t, "ids.json", `[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}, {"id": 5}, {"id": 6}, {"id": 7}]`)
+
+	for _, source := range []struct{ kind, file string }{{"CSV", "ids.csv"}, {"JSON", "ids.json"}} {
+		stream, err := NewPipelineExecutor().openSource(context.Background(), &models.Pipeline{SourceType: source.kind, RowLimit: 5}, &models.SourceConfig{FilePath: source.file})
+		require.NoError(t, err, source.kind)
+
+		var sizes []int
+		for {
+			batch, err := stream.Next(context.Background())
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, source.kind)
+			sizes = append(sizes, len(batch))
+		}
+		require.NoError(t, stream.Close())
+		assert.Equal(t, []int{3, 2}, sizes, source.kind)
+	}
+}
+
+func TestExtractFromFile_Excel(t *testing.T) {
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	f := excelize.NewFile()
+	_, err := f.NewSheet("Sales")
+	require.NoError(t, err)
+	require.NoError(t, f.SetSheetRow("Sales", "A1", &[]interface{}{"Product", "Units"}))
+	require.NoError(t, f.SetSheetRow("Sales", "A2", &[]interface{}{"Widget", 12}))
+	require.NoError(t, f.SetSheetRow("Sales", "A3", &[]interface{}{"Gadget"}))
+	require.NoError(t, f.SaveAs(filepath.Join(os.Getenv("PIPELINE_FILES_DIR"), "sales.xlsx")))
+
+	rows, err := extractPipeline(t, &models.Pipeline{SourceType: "EXCEL"}, models.SourceConfig{FilePath: "sales.xlsx", SheetName: "Sales"})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"product": "Widget", "units": int64(12)},
+		{"product": "Gadget", "units": nil},
+	}, rows)
+}
+
+func TestExtractFromFile_StaysInsideFilesDir(t *testing.T) {
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	for _, path := range []string{"../secrets.csv", "/etc/passwd", ""} {
+		_, err := extractPipeline(t, &models.Pipeline{SourceType: "CSV"}, models.SourceConfig{FilePath: path})
+		assert.Error(t, err, path)
+	}
+}
+
+func TestExtractFromREST_OffsetPagination(t *testing.T) {
+	const total = 250
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		items := []map[string]interface{}{}
+		for i := offset; i < offset+limit && i < total; i++ {
+			items = append(items, map[string]interface{}{"id": i})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": items})
+	}))
+	defer server.Close()
+
+	config := models.SourceConfig{
+		URL:              server.URL,
+		AuthType:         "bearer",
+		AuthConfig:       map[string]string{"token": "secret"},
+		PaginationType:   "offset",
+		PaginationConfig: map[string]string{"limit": "100"},
+	}
+	rows, err := extractPipeline(t, &models.Pipeline{ID: "p1", SourceType: "REST_API"}, config)
+	require.NoError(t, err)
+	assert.Len(t, rows, total)
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, float64(249), rows[249]["id"])
+
+	requests = 0
+	rows, err = extractPipeline(t, &models.Pipeline{ID: "p1", SourceType: "REST_API", RowLimit: 150}, config)
+	require.NoError(t, err)
+	assert.Len(t, rows, 150)
+	assert.Equal(t, 2, requests)
+}
+
+func TestExtractFromREST_PagePagination(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results":     []map[string]interface{}{{"page": page}},
+			"total_pages": 3,
+		})
+	}))
+	defer server.Close()
+
+	rows, err := extractPipeline(t, &models.Pipeline{ID: "p2", SourceType: "REST_API"}, models.SourceConfig{
+		URL:            server.URL,
+		PaginationType: "page",
+	})
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, float64(3), rows[2]["page"])
+
+	_, err = extractPipeline(t, &models.Pipeline{ID: "p2", SourceType: "REST_API"}, models.SourceConfig{URL: server.URL, AuthType: "api_key"})
+	assert.ErrorContains(t, err, "api_key is required")
+}
+
+func TestExtractData_RequiresConnectionForOtherDatabases(t *testing.T) {
+	_, err := extractPipeline(t, &models.Pipeline{SourceType: "SNOWFLAKE"}, models.SourceConfig{})
+	assert.ErrorContains(t, err, "unsupported source type without a connection")
+}
+
+func TestLimitSourceQuery(t *testing.T) {
+	tests := []struct {
+		connType string
+		want     string
+	}{
+		{"postgres", "SELECT * FROM (SELECT a FROM t) AS _sub LIMIT 10"},
+		{"snowflake", "SELECT * FROM (SELECT a FROM t) AS _sub LIMIT 10"},
+		{"sqlserver", "SELECT TOP 10 * FROM (SELECT a FROM t) AS _sub"},
+		{"oracle", "SELECT * FROM (SELECT a FROM t) _sub FETCH FIRST 10 ROWS ONLY"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, limitSourceQuery(tt.connType, "SELECT a FROM t;", 10), tt.connType)
+	}
+}
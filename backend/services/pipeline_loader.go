@@ -0,0 +1,557 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"insight-engine-backend/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Suffixes of the tables a load works with next to the destination table
+const (
+	stagingTableSuffix  = "__staging"
+	previousTableSuffix = "__previous"
+	swapTableSuffix     = "__swap"
+)
+
+// tableLoader writes the batches of a run into a staging table next to the
+// destination table, then swaps (OVERWRITE) or merges (APPEND, UPSERT) it
+// into the destination in one transaction (on MySQL, which commits DDL
+// implicitly, the row changes alone are). Readers of the destination only
+// wait for that final step, a failed run leaves the destination as it was,
+// and the version it replaced is kept as the previous table for
+// RollbackLoad.
+type tableLoader struct {
+	dest      *pipelineDestination
+	tx        *sql.Tx
+	writeMode string // OVERWRITE, APPEND or UPSERT
+	upsertKey string
+	manage    bool           // the loader defines the columns (INTERNAL_RAW, all TEXT)
+	declared  []sourceColumn // source columns of a managed table, see declare
+	exists    bool           // the destination table existed when the load started
+	staging   string
+	columns   []string
+	known     map[string]bool
+	rows      int
+	done      bool
+
+	quarantineReady bool // the quarantine table was created in this load
+
+	replace  *rangeReplace // set for backfill loads, which replace a partition range
+	replaced int           // destination rows of the range the load replaced
+}
+
+// openLoader starts loading into the pipeline's destination
+func (pe *PipelineExecutor) openLoader(ctx context.Context, pipeline *models.Pipeline) (*tableLoader, error) {
+	writeMode := "OVERWRITE"
+	var destConf models.DestConfig
+	if pipeline.DestinationConfig != nil {
+		if err := json.Unmarshal([]byte(*pipeline.DestinationConfig), &destConf); err == nil && destConf.WriteMode != "" {
+			writeMode = strings.ToUpper(destConf.WriteMode)
+		}
+	}
+	switch writeMode {
+	case "OVERWRITE", "APPEND":
+	case "UPSERT":
+		if destConf.UpsertKey == "" {
+			return nil, fmt.Errorf("UPSERT write mode requires upsertKey in destination config")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported write mode: %s", writeMode)
+	}
+
+	dest, err := pe.openDestination(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return beginLoad(ctx, dest, writeMode, destConf.UpsertKey, pipeline.DestinationType == "INTERNAL_RAW")
+}
+
+// beginLoad starts loading into an open destination, which the loader then
+// owns. A managed (raw) destination table is created by the first load.
+func beginLoad(ctx context.Context, dest *pipelineDestination, writeMode string, upsertKey string, manage bool) (*tableLoader, error) {
+	exists, err := dest.hasTable(ctx, dest.table)
+	if err != nil {
+		dest.close()
+		return nil, err
+	}
+	if !exists && !manage {
+		dest.close()
+		return nil, fmt.Errorf("destination table %s does not exist", dest.table)
+	}
+
+	tx, err := dest.db.BeginTx(ctx, nil)
+	if err != nil {
+		dest.close()
+		return nil, fmt.Errorf("failed to begin load: %w", err)
+	}
+	return &tableLoader{
+		dest:      dest,
+		tx:        tx,
+		writeMode: writeMode,
+		upsertKey: upsertKey,
+		manage:    manage,
+		exists:    exists,
+		staging:   siblingTableName(dest.table, stagingTableSuffix),
+		known:     make(map[string]bool),
+	}, nil
+}
+
+// declare has a managed table take the order and types of the source
+// columns instead of sorted TEXT columns. Call it before the first write.
+func (l *tableLoader) declare(columns []sourceColumn) {
+	l.declared = columns
+}
+
+// columnType is the type of a column the loader adds to a managed table
+func (l *tableLoader) columnType(column string) string {
+	for _, col := range l.declared {
+		if col.name == column {
+			return storeColumnType(col.dbType)
+		}
+	}
+	return "TEXT"
+}
+
+// storeColumnType maps a source database type name to the type a managed
+// table stores it as; types without a portable equivalent are kept as TEXT
+func storeColumnType(dbType string) string {
+	t := strings.ToUpper(strings.TrimSpace(dbType))
+	switch {
+	case t == "INTEGER" || strings.HasSuffix(t, "INT") || t == "INT2" || t == "INT4" || t == "INT8":
+		return "BIGINT"
+	case t == "BOOL" || t == "BOOLEAN":
+		return "BOOLEAN"
+	case strings.Contains(t, "NUMERIC") || strings.Contains(t, "DECIMAL"):
+		return "NUMERIC"
+	case strings.Contains(t, "FLOAT") || strings.Contains(t, "DOUBLE") || t == "REAL":
+		return "DOUBLE PRECISION"
+	case strings.HasPrefix(t, "TIMESTAMP") || t == "DATETIME":
+		return "TIMESTAMP"
+	case t == "DATE":
+		return "DATE"
+	}
+	return "TEXT"
+}
+
+// write loads one batch into the staging table. The first batch fixes the
+// column order and creates the staging table: with TEXT columns (or the
+// declared source columns) for the raw table, as a copy of the destination's
+// definition otherwise.
+func (l *tableLoader) write(ctx context.Context, batch []map[string]interface{}) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if l.declared != nil {
+		// Timestamps are written in a form typed columns parse
+		for _, row := range batch {
+			for col, val := range row {
+				if t, ok := val.(time.Time); ok {
+					row[col] = t.UTC().Format(time.RFC3339Nano)
+				}
+			}
+		}
+	}
+
+	var added []string
+	for _, row := range batch {
+		for col := range row {
+			if !l.known[col] {
+				l.known[col] = true
+				added = append(added, col)
+			}
+		}
+	}
+	sort.Strings(added) // Deterministic column order
+
+	staging := l.dest.quote(l.staging)
+	if l.columns == nil {
+		l.columns = l.sourceOrder(added)
+		if _, err := l.tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+staging); err != nil {
+			return fmt.Errorf("failed to drop stale staging table: %w", err)
+		}
+		var createSQL string
+		if l.manage {
+			colDefs := make([]string, len(l.columns))
+			for i, col := range l.columns {
+				colDefs[i] = l.dest.quote(col) + " " + l.columnType(col)
+			}
+			createSQL = fmt.Sprintf("CREATE TABLE %s (%s)", staging, strings.Join(colDefs, ", "))
+		} else if l.dest.dialect == "mysql" {
+			createSQL = fmt.Sprintf("CREATE TABLE %s LIKE %s", staging, l.dest.quote(l.dest.table))
+		} else {
+			createSQL = fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING ALL)", staging, l.dest.quote(l.dest.table))
+		}
+		if _, err := l.tx.ExecContext(ctx, createSQL); err != nil {
+			return fmt.Errorf("failed to create staging table: %w", err)
+		}
+	} else if len(added) > 0 {
+		// Columns a later batch introduces, e.g. after a JSON source's sparse fields
+		for _, col := range added {
+			if l.manage {
+				alter := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", staging, l.dest.quote(col), l.columnType(col))
+				if _, err := l.tx.ExecContext(ctx, alter); err != nil {
+					return fmt.Errorf("failed to add column %s: %w", col, err)
+				}
+			}
+			l.columns = append(l.columns, col)
+		}
+	}
+
+	var err error
+	if l.dest.copyIn {
+		err = copyBatch(ctx, l.tx, l.staging, l.columns, batch)
+	} else {
+		err = insertBatch(ctx, l.tx, l.dest, staging, l.columns, batch)
+	}
+	if err != nil {
+		return fmt.Errorf("batch insert failed at row %d: %w", l.rows, err)
+	}
+	l.rows += len(batch)
+	return nil
+}
+
+// sourceOrder orders the first batch's columns as declared, followed by
+// any the source did not declare
+func (l *tableLoader) sourceOrder(columns []string) []string {
+	if l.declared == nil {
+		return columns
+	}
+	ordered := make([]string, 0, len(columns))
+	seen := make(map[string]bool, len(l.declared))
+	for _, col := range l.declared {
+		if l.known[col.name] {
+			ordered = append(ordered, col.name)
+			seen[col.name] = true
+		}
+	}
+	for _, col := range columns {
+		if !seen[col] {
+			ordered = append(ordered, col)
+		}
+	}
+	return ordered
+}
+
+// commit swaps or merges the staging table into the destination and makes
+// the load visible. A run that loaded no rows leaves the destination as it
+// was.
+func (l *tableLoader) commit(ctx context.Context) error {
+	if l.replace != nil {
+		// A chunk without rows still empties its range
+		l.replace.shared.Lock()
+		defer l.replace.shared.Unlock()
+		if err := l.publishRange(ctx); err != nil {
+			return err
+		}
+	} else if l.columns != nil {
+		if err := l.publish(ctx); err != nil {
+			return err
+		}
+	}
+	if err := l.tx.Commit(); err != nil {
+		return err
+	}
+	if l.replace != nil && l.columns != nil {
+		l.replace.shared.created = true
+	}
+	l.done = true
+	if l.columns != nil && l.dest.dialect == "mysql" {
+		// merge leaves the staging table to drop here, outside the transaction
+		if _, err := l.dest.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+l.dest.quote(l.staging)); err != nil {
+			LogWarn("pipeline_load", "Failed to drop staging table", map[string]interface{}{"table": l.staging, "error": err.Error()})
+		}
+	}
+	l.dest.close()
+	return nil
+}
+
+func (l *tableLoader) publish(ctx context.Context) error {
+	target := l.dest.quote(l.dest.table)
+	staging := l.dest.quote(l.staging)
+	previous := siblingTableName(l.dest.table, previousTableSuffix)
+	dropPrevious := "DROP TABLE IF EXISTS " + l.dest.quote(previous)
+
+	if !l.exists {
+		return l.exec(ctx, "failed to publish staging table", append([]string{dropPrevious}, l.dest.renameSQL(l.staging, l.dest.table)...)...)
+	}
+	if l.writeMode == "OVERWRITE" && l.manage {
+		return l.exec(ctx, "failed to swap staging table", append([]string{dropPrevious}, l.dest.renameSQL(l.dest.table, previous, l.staging, l.dest.table)...)...)
+	}
+
+	// Other loads change the destination in place, so an external table keeps
+	// its views and grants; keep a copy
+	if err := l.alter(ctx, append([]string{dropPrevious}, l.dest.cloneSQL(l.dest.table, previous, l.manage)...)...); err != nil {
+		return err
+	}
+	switch l.writeMode {
+	case "OVERWRITE":
+		// DELETE rather than TRUNCATE, which MySQL commits implicitly
+		if _, err := l.tx.ExecContext(ctx, "DELETE FROM "+target); err != nil {
+			return fmt.Errorf("failed to clear destination table: %w", err)
+		}
+	case "UPSERT":
+		key := l.dest.quote(l.upsertKey)
+		if l.declared != nil {
+			key = "CAST(" + key + " AS TEXT)" // the table may predate typed columns
+		}
+		deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s IN (SELECT %s FROM %s)", target, key, key, staging)
+		if _, err := l.tx.ExecContext(ctx, deleteSQL); err != nil {
+			return fmt.Errorf("failed to replace upserted rows: %w", err)
+		}
+	}
+	return l.merge(ctx)
+}
+
+// publishRange replaces the destination rows of the load's partition range
+// with the staging table. The loads of a backfill publish one at a time, and
+// the first to publish creates a missing raw destination table.
+func (l *tableLoader) publishRange(ctx context.Context) error {
+	if !l.exists && !l.replace.shared.created {
+		if l.columns == nil {
+			return nil
+		}
+		return l.exec(ctx, "failed to publish staging table", l.dest.renameSQL(l.staging, l.dest.table)...)
+	}
+
+	if err := l.alter(ctx); err != nil {
+		return err
+	}
+	column := l.dest.quote(l.replace.column)
+	if l.replace.numeric && l.manage {
+		column = "CAST(" + column + " AS NUMERIC)" // raw tables store TEXT
+	}
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s >= %s AND %s < %s",
+		l.dest.quote(l.dest.table), column, l.dest.placeholder(1), column, l.dest.placeholder(2))
+	res, err := l.tx.ExecContext(ctx, deleteSQL, l.replace.start, l.replace.end)
+	if err != nil {
+		return fmt.Errorf("failed to delete partition range: %w", err)
+	}
+	deleted, _ := res.RowsAffected()
+	l.replaced = int(deleted)
+
+	if l.columns == nil {
+		return nil
+	}
+	return l.merge(ctx)
+}
+
+// alter runs the schema changes that precede the row changes of a publish:
+// the given statements, then adding the loaded columns a raw destination
+// table lacks. MySQL commits DDL implicitly, so there the load's transaction
+// (which only holds the staging table) is committed first, the changes run
+// outside any transaction, and a new transaction is begun that holds the
+// DELETE and INSERT alone, which then commit or roll back together.
+func (l *tableLoader) alter(ctx context.Context, statements ...string) error {
+	if l.manage && l.columns != nil {
+		target := l.dest.quote(l.dest.table)
+		existing, err := tableColumns(ctx, l.tx, target)
+		if err != nil {
+			return err
+		}
+		for _, col := range l.columns {
+			if !existing[col] {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", target, l.dest.quote(col), l.columnType(col)))
+			}
+		}
+	}
+	if l.dest.dialect != "mysql" {
+		return l.exec(ctx, "failed to prepare destination table", statements...)
+	}
+
+	if err := l.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit staging table: %w", err)
+	}
+	for _, statement := range statements {
+		if _, err := l.dest.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to prepare destination table: %w", err)
+		}
+	}
+	tx, err := l.dest.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin publish: %w", err)
+	}
+	l.tx = tx
+	return nil
+}
+
+// merge inserts the staging table's rows into the destination and drops it;
+// on MySQL commit drops it once the transaction is done
+func (l *tableLoader) merge(ctx context.Context) error {
+	staging := l.dest.quote(l.staging)
+	quotedCols := make([]string, len(l.columns))
+	for i, col := range l.columns {
+		quotedCols[i] = l.dest.quote(col)
+	}
+	cols := strings.Join(quotedCols, ", ")
+	mergeSQL := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", l.dest.quote(l.dest.table), cols, cols, staging)
+	if l.dest.dialect == "mysql" {
+		return l.exec(ctx, "failed to merge staging table", mergeSQL)
+	}
+	return l.exec(ctx, "failed to merge staging table", mergeSQL, "DROP TABLE "+staging)
+}
+
+func (l *tableLoader) exec(ctx context.Context, failure string, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := l.tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%s: %w", failure, err)
+		}
+	}
+	return nil
+}
+
+// abort discards the loaded rows; a no-op after commit
+func (l *tableLoader) abort() {
+	if l.done {
+		return
+	}
+	l.done = true
+	l.tx.Rollback()
+	if l.columns != nil && l.dest.dialect == "mysql" {
+		// MySQL commits DDL implicitly, so the staging table outlives the rollback
+		l.dest.db.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+l.dest.quote(l.staging))
+	}
+	l.dest.close()
+}
+
+// RollbackLoad restores the destination table version a pipeline's last
+// load replaced. The two versions are swapped, so a rollback can itself be
+// rolled back.
+func (pe *PipelineExecutor) RollbackLoad(ctx context.Context, pipeline *models.Pipeline) error {
+	dest, err := pe.openDestination(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer dest.close()
+
+	previous := siblingTableName(dest.table, previousTableSuffix)
+	if ok, err := dest.hasTable(ctx, previous); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("no previous version of %s to roll back to", dest.table)
+	}
+
+	swap := siblingTableName(dest.table, swapTableSuffix)
+	var before, after []string
+	statements := dest.renameSQL(dest.table, swap, previous, dest.table, swap, previous)
+	if pipeline.DestinationType != "INTERNAL_RAW" {
+		// External tables keep their views and grants, so swap their rows instead
+		before = append([]string{"DROP TABLE IF EXISTS " + dest.quote(swap)}, dest.cloneSQL(dest.table, swap, false)...)
+		statements = []string{"DELETE FROM " + dest.quote(dest.table), dest.copySQL(previous, dest.table)}
+		after = append([]string{"DROP TABLE " + dest.quote(previous)}, dest.renameSQL(swap, previous)...)
+	}
+	if err := dest.execAround(ctx, before, statements, after); err != nil {
+		return fmt.Errorf("failed to restore previous table version: %w", err)
+	}
+	LogInfo("pipeline_rollback", "Restored previous destination table version", map[string]interface{}{
+		"pipeline_id": pipeline.ID,
+		"table":       dest.table,
+	})
+	return nil
+}
+
+// siblingTableName derives the name of a table kept next to table, within
+// the 63-character identifier limit of PostgreSQL
+func siblingTableName(table string, suffix string) string {
+	if len(table)+len(suffix) > 63 {
+		table = table[:63-len(suffix)]
+	}
+	return table + suffix
+}
+
+// tableColumns returns the column names of a table
+func tableColumns(ctx context.Context, tx *sql.Tx, quotedTable string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT * FROM "+quotedTable+" WHERE 1 = 0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read columns of %s: %w", quotedTable, err)
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]bool, len(names))
+	for _, name := range names {
+		columns[name] = true
+	}
+	return columns, nil
+}
+
+// insertBatch inserts rows with multi-row INSERT statements, keeping each
+// under common bind parameter limits. Values are written as text.
+func insertBatch(ctx context.Context, tx *sql.Tx, dest *pipelineDestination, table string, columns []string, rows []map[string]interface{}) error {
+	quotedCols := make([]string, len(columns))
+	for i, col := range columns {
+		quotedCols[i] = dest.quote(col)
+	}
+
+	perStatement := 60000 / len(columns)
+	if perStatement > 500 {
+		perStatement = 500
+	}
+	if perStatement < 1 {
+		perStatement = 1
+	}
+
+	for start := 0; start < len(rows); start += perStatement {
+		end := start + perStatement
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		var valueRows []string
+		var args []interface{}
+		for _, row := range rows[start:end] {
+			placeholders := make([]string, len(columns))
+			for i, col := range columns {
+				args = append(args, textValue(row[col]))
+				placeholders[i] = "?"
+				if dest.dialect == "postgres" {
+					placeholders[i] = fmt.Sprintf("$%d", len(args))
+				}
+			}
+			valueRows = append(valueRows, "("+strings.Join(placeholders, ", ")+")")
+		}
+
+		insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(quotedCols, ", "), strings.Join(valueRows, ", "))
+		if _, err := tx.ExecContext(ctx, insertSQL, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBatch loads rows with PostgreSQL COPY
+func copyBatch(ctx context.Context, tx *sql.Tx, table string, columns []string, rows []map[string]interface{}) error {
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn(table, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	args := make([]interface{}, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			args[i] = textValue(row[col])
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// textValue is how a value is stored in a TEXT column
+func textValue(val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	return fmt.Sprintf("%v", val)
+}
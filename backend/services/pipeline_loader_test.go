@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func loadRows(t *testing.T, pipeline *models.Pipeline, batches ...[]map[string]interface{}) {
+	t.Helper()
+	ctx := context.Background()
+	loader, err := NewPipelineExecutor().openLoader(ctx, pipeline)
+	require.NoError(t, err)
+	defer loader.abort()
+	for _, batch := range batches {
+		require.NoError(t, loader.write(ctx, batch))
+	}
+	require.NoError(t, loader.commit(ctx))
+}
+
+func tableIDs(t *testing.T, db *gorm.DB, table string) []string {
+	t.Helper()
+	var ids []string
+	require.NoError(t, db.Raw(`SELECT id FROM "`+table+`" ORDER BY id`).Scan(&ids).Error)
+	return ids
+}
+
+func TestTableLoader_WriteModesKeepPreviousVersion(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+	destConfig := `{"writeMode": "OVERWRITE"}`
+	pipeline := &models.Pipeline{ID: "users", Name: "Users", DestinationType: "INTERNAL_RAW", DestinationConfig: &destConfig}
+
+	loadRows(t, pipeline, []map[string]interface{}{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}})
+	loadRows(t, pipeline, []map[string]interface{}{{"id": 3, "name": "c"}})
+	assert.Equal(t, []string{"3"}, tableIDs(t, db, "pipeline_data_users"))
+	assert.Equal(t, []string{"1", "2"}, tableIDs(t, db, "pipeline_data_users__previous"))
+	assert.False(t, db.Migrator().HasTable("pipeline_data_users__staging"))
+
+	destConfig = `{"writeMode": "APPEND"}`
+	loadRows(t, pipeline, []map[string]interface{}{{"id": 4, "name": "d", "team": "x"}})
+	assert.Equal(t, []string{"3", "4"}, tableIDs(t, db, "pipeline_data_users"))
+	assert.Equal(t, []string{"3"}, tableIDs(t, db, "pipeline_data_users__previous"))
+
+	destConfig = `{"writeMode": "UPSERT", "upsertKey": "id"}`
+	loadRows(t, pipeline, []map[string]interface{}{{"id": 4, "name": "D"}, {"id": 5, "name": "e"}})
+	var names []string
+	require.NoError(t, db.Raw(`SELECT name FROM "pipeline_data_users" ORDER BY id`).Scan(&names).Error)
+	assert.Equal(t, []string{"c", "D", "e"}, names)
+
+	require.NoError(t, NewPipelineExecutor().RollbackLoad(context.Background(), pipeline))
+	assert.Equal(t, []string{"3", "4"}, tableIDs(t, db, "pipeline_data_users"))
+	assert.Equal(t, []string{"3", "4", "5"}, tableIDs(t, db, "pipeline_data_users__previous"), "a rollback can be undone")
+
+	destConfig = `{"writeMode": "UPSERT"}`
+	_, err := NewPipelineExecutor().openLoader(context.Background(), pipeline)
+	assert.ErrorContains(t, err, "upsertKey")
+}
+
+// TestTableLoader_MySQLFailedMergeKeepsRows loads into an external table on
+// a MySQL server, given as PIPELINE_LOADER_TEST_MYSQL_DSN
+// (user:password@tcp(localhost:3306)/db), and fails the merge after the
+// destination rows were deleted. The foreign key is not copied to the
+// staging table, so only the INSERT into the destination rejects the row.
+func TestTableLoader_MySQLFailedMergeKeepsRows(t *testing.T) {
+	dsn := os.Getenv("PIPELINE_LOADER_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("PIPELINE_LOADER_TEST_MYSQL_DSN not set")
+	}
+	ctx := context.Background()
+	db, err := sql.Open("mysql", dsn)
+	require.NoError(t, err)
+	defer db.Close()
+
+	exec := func(statements ...string) {
+		for _, statement := range statements {
+			_, err := db.ExecContext(ctx, statement)
+			require.NoError(t, err, statement)
+		}
+	}
+	cleanup := func() {
+		exec("DROP TABLE IF EXISTS loader_orders, loader_orders__previous, loader_orders__staging, loader_customers")
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	exec("CREATE TABLE loader_customers (id INT PRIMARY KEY)",
+		"INSERT INTO loader_customers VALUES (1)",
+		"CREATE TABLE loader_orders (id INT PRIMARY KEY, customer_id INT, FOREIGN KEY (customer_id) REFERENCES loader_customers (id))",
+		"INSERT INTO loader_orders VALUES (1, 1), (2, 1)")
+	ids := func(table string) []int {
+		rows, err := db.QueryContext(ctx, "SELECT id FROM "+table+" ORDER BY id")
+		require.NoError(t, err)
+		defer rows.Close()
+		var got []int
+		for rows.Next() {
+			var id int
+			require.NoError(t, rows.Scan(&id))
+			got = append(got, id)
+		}
+		return got
+	}
+	destination := func() *pipelineDestination {
+		conn, err := sql.Open("mysql", dsn)
+		require.NoError(t, err)
+		return &pipelineDestination{db: conn, dialect: "mysql", table: "loader_orders", owned: true}
+	}
+
+	for _, writeMode := range []string{"OVERWRITE", "UPSERT"} {
+		loader, err := beginLoad(ctx, destination(), writeMode, "id", false)
+		require.NoError(t, err)
+		require.NoError(t, loader.write(ctx, []map[string]interface{}{{"id": 1, "customer_id": 1}, {"id": 3, "customer_id": 99}}))
+		assert.ErrorContains(t, loader.commit(ctx), "failed to merge staging table", writeMode)
+		loader.abort()
+
+		assert.Equal(t, []int{1, 2}, ids("loader_orders"), "%s: the delete rolls back with the failed insert", writeMode)
+		var staging int
+		require.NoError(t, db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'loader_orders__staging'").Scan(&staging))
+		assert.Zero(t, staging, writeMode)
+	}
+
+	loader, err := beginLoad(ctx, destination(), "OVERWRITE", "", false)
+	require.NoError(t, err)
+	require.NoError(t, loader.write(ctx, []map[string]interface{}{{"id": 3, "customer_id": 1}}))
+	require.NoError(t, loader.commit(ctx))
+	assert.Equal(t, []int{3}, ids("loader_orders"))
+	assert.Equal(t, []int{1, 2}, ids("loader_orders__previous"))
+}
+
+func TestSiblingTableName(t *testing.T) {
+	long := "pipeline_data_a_very_long_pipeline_name_that_fills_the_identifier"
+	assert.Equal(t, "orders__staging", siblingTableName("orders", stagingTableSuffix))
+	assert.Len(t, siblingTableName(long, previousTableSuffix), 63)
+}
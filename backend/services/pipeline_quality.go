@@ -0,0 +1,1063 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// quarantineTableSuffix names the table next to the destination table that
+// receives the rows failing QUARANTINE rules
+const quarantineTableSuffix = "__quarantine"
+
+// qualityRowRules check every row; the other rule types check the run
+var qualityRowRules = map[string]bool{
+	"NOT_NULL": true, "UNIQUE": true, "RANGE": true, "REGEX": true, "ALLOWED_VALUES": true, "REFERENTIAL": true,
+}
+
+var qualityRunRules = map[string]bool{
+	"ROW_COUNT": true, "ROW_COUNT_DELTA": true, "FRESHNESS": true, "DRIFT": true, "CUSTOM_SQL": true,
+}
+
+// qualityRuleParams is the parsed value of a rule
+type qualityRuleParams struct {
+	Min           *float64 `json:"min"`
+	Max           *float64 `json:"max"`
+	Table         string   `json:"table"`
+	Column        string   `json:"column"`
+	MaxPercent    *float64 `json:"maxPercent"`
+	MaxAgeMinutes *float64 `json:"maxAgeMinutes"`
+	Metric        string   `json:"metric"`
+	MaxChange     *float64 `json:"maxChange"`
+
+	allowed map[string]bool // ALLOWED_VALUES
+}
+
+// parseQualityRule parses the value of a rule and checks it has what the
+// rule type needs
+func parseQualityRule(rule models.QualityRule) (qualityRuleParams, error) {
+	var params qualityRuleParams
+	value := ""
+	if rule.Value != nil {
+		value = strings.TrimSpace(*rule.Value)
+	}
+
+	switch rule.RuleType {
+	case "NOT_NULL", "UNIQUE":
+		return params, nil
+	case "REGEX":
+		if value == "" {
+			return params, fmt.Errorf("REGEX rule requires a value")
+		}
+		return params, nil
+	case "CUSTOM_SQL":
+		statement := strings.ToUpper(value)
+		if !strings.HasPrefix(statement, "SELECT") && !strings.HasPrefix(statement, "WITH") {
+			return params, fmt.Errorf("CUSTOM_SQL rule requires a SELECT returning the number of failing rows")
+		}
+		if err := checkCustomSQL(value); err != nil {
+			return params, err
+		}
+		return params, nil
+	case "ALLOWED_VALUES":
+		var values []interface{}
+		if err := json.Unmarshal([]byte(value), &values); err != nil || len(values) == 0 {
+			return params, fmt.Errorf("ALLOWED_VALUES rule requires a JSON array of values")
+		}
+		params.allowed = make(map[string]bool, len(values))
+		for _, v := range values {
+			params.allowed[fmt.Sprintf("%v", v)] = true
+		}
+		return params, nil
+	}
+
+	if !qualityRunRules[rule.RuleType] && rule.RuleType != "RANGE" && rule.RuleType != "REFERENTIAL" {
+		return params, fmt.Errorf("unknown quality rule type: %s", rule.RuleType)
+	}
+	if value == "" {
+		return params, fmt.Errorf("%s rule requires a value", rule.RuleType)
+	}
+	if err := json.Unmarshal([]byte(value), &params); err != nil {
+		return params, fmt.Errorf("invalid %s rule value: %w", rule.RuleType, err)
+	}
+
+	switch rule.RuleType {
+	case "RANGE", "ROW_COUNT":
+		if params.Min == nil && params.Max == nil {
+			return params, fmt.Errorf("%s rule requires min or max", rule.RuleType)
+		}
+	case "REFERENTIAL":
+		if params.Table == "" || params.Column == "" {
+			return params, fmt.Errorf("REFERENTIAL rule requires table and column")
+		}
+	case "ROW_COUNT_DELTA":
+		if params.MaxPercent == nil || *params.MaxPercent < 0 {
+			return params, fmt.Errorf("ROW_COUNT_DELTA rule requires a non-negative maxPercent")
+		}
+	case "FRESHNESS":
+		if params.MaxAgeMinutes == nil || *params.MaxAgeMinutes <= 0 {
+			return params, fmt.Errorf("FRESHNESS rule requires a positive maxAgeMinutes")
+		}
+	case "DRIFT":
+		if params.Metric != "mean" && params.Metric != "nullRate" {
+			return params, fmt.Errorf("DRIFT rule metric must be mean or nullRate")
+		}
+		if params.MaxChange == nil || *params.MaxChange < 0 {
+			return params, fmt.Errorf("DRIFT rule requires a non-negative maxChange")
+		}
+	}
+	return params, nil
+}
+
+// customSQLStaging stands for {{table}} while a CUSTOM_SQL rule is checked
+const customSQLStaging = "quality_rule_staging__"
+
+// customSQLWrites are the keywords of the clauses that change data, schema
+// or session state, which CUSTOM_SQL rules must not have
+var customSQLWrites = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "TRUNCATE": true, "DROP": true, "ALTER": true,
+	"CREATE": true, "GRANT": true, "REVOKE": true, "COPY": true, "CALL": true, "EXEC": true, "EXECUTE": true,
+	"INTO": true, "LOCK": true, "SET": true, "DO": true,
+}
+
+// checkCustomSQL checks a CUSTOM_SQL rule is a single query reading only
+// {{table}}, the staging table of the run, and the CTEs it defines
+func checkCustomSQL(statement string) error {
+	if err := checkSingleStatement(statement); err != nil {
+		return err
+	}
+	rendered, err := renderSQLStep(statement, sqlStepVars{Table: customSQLStaging})
+	if err != nil {
+		return err
+	}
+	tokens := sqlTokens(rendered)
+
+	ctes := make(map[string]bool)
+	for i := 1; i+2 < len(tokens); i++ {
+		prev := strings.ToUpper(tokens[i-1])
+		if (prev == "WITH" || prev == "RECURSIVE" || prev == ",") && strings.EqualFold(tokens[i+1], "AS") && tokens[i+2] == "(" {
+			ctes[sqlTokenName(tokens[i])] = true
+		}
+	}
+
+	// Each parenthesis opens a level; FROM and JOIN name tables only in
+	// levels that are queries, not in EXTRACT(... FROM ...) and the like
+	type level struct{ query, from, expectTable bool }
+	levels := []level{{}}
+	for i, token := range tokens {
+		cur := &levels[len(levels)-1]
+		keyword := strings.ToUpper(token)
+		switch {
+		case keyword == "FROM" && i > 0 && strings.EqualFold(tokens[i-1], "DISTINCT"):
+			// IS [NOT] DISTINCT FROM compares values
+		case token == "(":
+			cur.expectTable = false
+			levels = append(levels, level{})
+		case token == ")":
+			if len(levels) > 1 {
+				levels = levels[:len(levels)-1]
+			}
+		case token == ",":
+			cur.expectTable = cur.from
+		case customSQLWrites[keyword]:
+			return fmt.Errorf("CUSTOM_SQL rule must not modify data (%s)", keyword)
+		case keyword == "SELECT":
+			cur.query, cur.from, cur.expectTable = true, false, false
+		case keyword == "FROM" || keyword == "JOIN":
+			cur.from = cur.query
+			cur.expectTable = cur.query
+		case keyword == "WHERE" || keyword == "GROUP" || keyword == "HAVING" || keyword == "ORDER" || keyword == "LIMIT" ||
+			keyword == "OFFSET" || keyword == "FETCH" || keyword == "WINDOW" || keyword == "UNION" || keyword == "EXCEPT" || keyword == "INTERSECT":
+			cur.from, cur.expectTable = false, false
+		case keyword == "LATERAL" || keyword == "ONLY":
+		case cur.expectTable:
+			name := sqlTokenName(token)
+			if name != customSQLStaging && !ctes[name] {
+				return fmt.Errorf("CUSTOM_SQL rule may only read {{table}}, not %s", token)
+			}
+			cur.expectTable = false
+		}
+	}
+	return nil
+}
+
+// sqlTokens splits a statement into words, quoted identifiers (kept with a
+// qualifying prefix), parentheses, commas and operators; string literals
+// become a single quote
+func sqlTokens(statement string) []string {
+	var tokens []string
+	runes := []rune(statement)
+	isWord := func(r rune) bool {
+		return r == '_' || r == '.' || r == '$' || r == '"' || r == '`' || r == '[' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r > 127
+	}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '\'':
+			for i++; i < len(runes); i++ {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			i++
+			tokens = append(tokens, "'")
+		case isWord(r):
+			start := i
+			for i < len(runes) && isWord(runes[i]) {
+				if closing := map[rune]rune{'"': '"', '`': '`', '[': ']'}[runes[i]]; closing != 0 {
+					for i++; i < len(runes) && runes[i] != closing; i++ {
+					}
+				}
+				i++
+			}
+			if i > len(runes) {
+				i = len(runes)
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+// sqlTokenName returns the lower-case name of an identifier token, without
+// quotes
+func sqlTokenName(token string) string {
+	return strings.ToLower(strings.NewReplacer(`"`, "", "`", "", "[", "", "]", "").Replace(token))
+}
+
+// ValidateQualityRules rejects unknown or misconfigured quality rules, and
+// CUSTOM_SQL rules for destinations in the application database
+func ValidateQualityRules(rules []models.QualityRule, destinationType string) error {
+	for i, rule := range rules {
+		rule.RuleType = strings.ToUpper(rule.RuleType)
+		if _, err := parseQualityRule(rule); err != nil {
+			return fmt.Errorf("quality rule %d: %w", i+1, err)
+		}
+		if rule.RuleType == "CUSTOM_SQL" {
+			if err := checkCustomSQLDestination(destinationType); err != nil {
+				return fmt.Errorf("quality rule %d: %w", i+1, err)
+			}
+		}
+		needsColumn := rule.RuleType != "ROW_COUNT" && rule.RuleType != "ROW_COUNT_DELTA" && rule.RuleType != "CUSTOM_SQL"
+		if needsColumn && rule.Column == "" {
+			return fmt.Errorf("quality rule %d: %s rule requires a column", i+1, rule.RuleType)
+		}
+		switch strings.ToUpper(rule.Severity) {
+		case "", "WARN", "FAIL":
+		case "QUARANTINE":
+			if !qualityRowRules[rule.RuleType] {
+				return fmt.Errorf("quality rule %d: only row rules can quarantine rows", i+1)
+			}
+		default:
+			return fmt.Errorf("quality rule %d: severity must be WARN, FAIL or QUARANTINE", i+1)
+		}
+	}
+	return nil
+}
+
+// checkCustomSQLDestination rejects CUSTOM_SQL rules for destinations in the
+// application database. A statement can read any table there, and the SQL
+// inside string literals (query_to_xml, dblink, ...) is beyond what a check of
+// the statement can see, so only the destination's own database is safe.
+func checkCustomSQLDestination(destinationType string) error {
+	if destinationType == "INTERNAL_RAW" {
+		return fmt.Errorf("CUSTOM_SQL rules require an external destination; they cannot run on the internal store")
+	}
+	return nil
+}
+
+// SetPipelineQualityRules validates and replaces the quality rules of a
+// pipeline
+func SetPipelineQualityRules(pipelineID string, destinationType string, rules []models.QualityRule) error {
+	if err := ValidateQualityRules(rules, destinationType); err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"pipelineId\" = ?", pipelineID).Delete(&models.QualityRule{}).Error; err != nil {
+			return err
+		}
+		for i := range rules {
+			rules[i].ID = uuid.New().String()
+			rules[i].PipelineID = pipelineID
+			rules[i].RuleType = strings.ToUpper(rules[i].RuleType)
+			rules[i].Severity = strings.ToUpper(rules[i].Severity)
+			if rules[i].Severity == "" {
+				rules[i].Severity = "WARN"
+			}
+			rules[i].CreatedAt = time.Now()
+			rules[i].UpdatedAt = time.Now()
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Omit("Pipeline").Create(&rules).Error
+	})
+}
+
+// quarantinedRow is a row held back from the load by QUARANTINE rules
+type quarantinedRow struct {
+	index      int
+	row        map[string]interface{}
+	violations []string
+}
+
+// columnProfile sums up a column for DRIFT rules
+type columnProfile struct {
+	rows, nulls, numbers int
+	sum                  float64
+}
+
+func (p *columnProfile) metrics() map[string]float64 {
+	metrics := make(map[string]float64)
+	if p.rows > 0 {
+		metrics["nullRate"] = float64(p.nulls) / float64(p.rows)
+	}
+	if p.numbers > 0 {
+		metrics["mean"] = p.sum / float64(p.numbers)
+	}
+	return metrics
+}
+
+// qualityChecker checks batches against quality rules as they stream past,
+// then the run as a whole before it is committed. UNIQUE keeps the values it
+// has seen, so a repeated value is a violation from its second occurrence on.
+type qualityChecker struct {
+	pe       *PipelineExecutor
+	rules    []models.QualityRule
+	params   []qualityRuleParams
+	seen     []map[string]bool // per rule, UNIQUE only
+	known    []map[string]bool // per rule, REFERENTIAL only: whether a value exists
+	counts   []int             // violations per rule
+	observed []*float64        // per run rule
+	messages []string          // per rule
+
+	violations      int
+	rows            int
+	rowsQuarantined int
+	failed          bool
+	quarantined     []quarantinedRow // not yet written
+	profiles        map[string]*columnProfile
+	newest          []time.Time // per rule, FRESHNESS only
+
+	// lookup returns which values of a column exist in a destination table
+	lookup func(ctx context.Context, table string, column string, values []string) (map[string]bool, error)
+	// baseline is the scorecard of the last loaded run, nil for the first
+	baseline *models.QualityScorecard
+}
+
+func newQualityChecker(pe *PipelineExecutor, rules []models.QualityRule) *qualityChecker {
+	c := &qualityChecker{
+		pe:       pe,
+		rules:    rules,
+		params:   make([]qualityRuleParams, len(rules)),
+		seen:     make([]map[string]bool, len(rules)),
+		known:    make([]map[string]bool, len(rules)),
+		counts:   make([]int, len(rules)),
+		observed: make([]*float64, len(rules)),
+		messages: make([]string, len(rules)),
+		profiles: make(map[string]*columnProfile),
+		newest:   make([]time.Time, len(rules)),
+	}
+	for i, rule := range rules {
+		// Rules saved before validation existed may not parse; they check nothing
+		c.params[i], _ = parseQualityRule(rule)
+		switch rule.RuleType {
+		case "UNIQUE":
+			c.seen[i] = make(map[string]bool)
+		case "REFERENTIAL":
+			c.known[i] = make(map[string]bool)
+		case "DRIFT":
+			c.profiles[rule.Column] = &columnProfile{}
+		}
+	}
+	return c
+}
+
+// check checks a batch against the row rules. It returns the rows to load,
+// holding back those failing QUARANTINE rules, or the first violation of a
+// FAIL rule.
+func (c *qualityChecker) check(ctx context.Context, batch []map[string]interface{}) ([]map[string]interface{}, *QualityViolation, error) {
+	offset := c.rows
+	c.rows += len(batch)
+
+	violations := c.pe.validateQualityRules(batch, c.rules, c.seen, offset)
+	references, err := c.checkReferences(ctx, batch, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	violations = append(violations, references...)
+
+	var failed *QualityViolation
+	quarantine := make(map[int][]string)
+	for _, v := range violations {
+		c.violations++
+		c.counts[v.rule]++
+		if c.messages[v.rule] == "" {
+			c.messages[v.rule] = v.Message
+		}
+		switch c.rules[v.rule].Severity {
+		case "FAIL":
+			if failed == nil {
+				violation := v
+				failed = &violation
+			}
+		case "QUARANTINE":
+			quarantine[v.RowIndex-offset] = append(quarantine[v.RowIndex-offset], v.Message)
+		}
+	}
+	if failed != nil {
+		c.failed = true
+		return nil, failed, nil
+	}
+
+	keep := batch
+	if len(quarantine) > 0 {
+		keep = make([]map[string]interface{}, 0, len(batch)-len(quarantine))
+		for i, row := range batch {
+			if messages, ok := quarantine[i]; ok {
+				c.quarantined = append(c.quarantined, quarantinedRow{index: offset + i, row: row, violations: messages})
+			} else {
+				keep = append(keep, row)
+			}
+		}
+		c.rowsQuarantined += len(quarantine)
+	}
+	c.profile(keep)
+	return keep, nil, nil
+}
+
+// checkReferences checks REFERENTIAL rules, looking up the values not seen
+// in earlier batches
+func (c *qualityChecker) checkReferences(ctx context.Context, batch []map[string]interface{}, offset int) ([]QualityViolation, error) {
+	var violations []QualityViolation
+	for r, rule := range c.rules {
+		if rule.RuleType != "REFERENTIAL" || c.lookup == nil || c.params[r].Table == "" {
+			continue
+		}
+		var unknown []string
+		pending := make(map[string]bool)
+		for _, row := range batch {
+			if row[rule.Column] == nil {
+				continue
+			}
+			key := fmt.Sprintf("%v", row[rule.Column])
+			if _, ok := c.known[r][key]; !ok && !pending[key] {
+				pending[key] = true
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) > 0 {
+			found, err := c.lookup(ctx, c.params[r].Table, c.params[r].Column, unknown)
+			if err != nil {
+				return nil, fmt.Errorf("REFERENTIAL rule on column '%s': %w", rule.Column, err)
+			}
+			for _, key := range unknown {
+				c.known[r][key] = found[key]
+			}
+		}
+		for i, row := range batch {
+			if row[rule.Column] == nil {
+				continue
+			}
+			key := fmt.Sprintf("%v", row[rule.Column])
+			if !c.known[r][key] {
+				violations = append(violations, QualityViolation{
+					RuleID:   rule.ID,
+					Column:   rule.Column,
+					RuleType: rule.RuleType,
+					RowIndex: offset + i,
+					Value:    key,
+					Message:  fmt.Sprintf("Row %d, column '%s': %s not found in %s.%s", offset+i, rule.Column, key, c.params[r].Table, c.params[r].Column),
+					rule:     r,
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// profile accumulates the loaded rows into the DRIFT and FRESHNESS figures
+func (c *qualityChecker) profile(rows []map[string]interface{}) {
+	for column, p := range c.profiles {
+		for _, row := range rows {
+			p.rows++
+			val := row[column]
+			if val == nil || fmt.Sprintf("%v", val) == "" {
+				p.nulls++
+				continue
+			}
+			if number, err := strconv.ParseFloat(fmt.Sprintf("%v", val), 64); err == nil {
+				p.numbers++
+				p.sum += number
+			}
+		}
+	}
+	for r, rule := range c.rules {
+		if rule.RuleType != "FRESHNESS" {
+			continue
+		}
+		for _, row := range rows {
+			if at, ok := qualityTimestamp(row[rule.Column]); ok && at.After(c.newest[r]) {
+				c.newest[r] = at
+			}
+		}
+	}
+}
+
+// finish checks the run rules once every batch is written and before the
+// load is committed, returning the first violation of a FAIL rule. Rows of
+// the run are in the loader's staging table, nil when none were loaded.
+func (c *qualityChecker) finish(ctx context.Context, loader *tableLoader, vars sqlStepVars, now time.Time) (*QualityViolation, error) {
+	var failed *QualityViolation
+	for r, rule := range c.rules {
+		if !qualityRunRules[rule.RuleType] {
+			continue
+		}
+		params := c.params[r]
+		var observed float64
+		var violated bool
+		var message string
+
+		switch rule.RuleType {
+		case "ROW_COUNT":
+			observed = float64(c.rows)
+			violated = (params.Min != nil && observed < *params.Min) || (params.Max != nil && observed > *params.Max)
+			message = fmt.Sprintf("%d rows", c.rows)
+		case "ROW_COUNT_DELTA":
+			if c.baseline == nil || c.baseline.RowsChecked == 0 || params.MaxPercent == nil {
+				message = "No previous run to compare with"
+				break
+			}
+			previous := float64(c.baseline.RowsChecked)
+			observed = math.Abs(float64(c.rows)-previous) / previous * 100
+			violated = observed > *params.MaxPercent
+			message = fmt.Sprintf("%d rows, %d in the previous run (%.1f%% change)", c.rows, c.baseline.RowsChecked, observed)
+		case "FRESHNESS":
+			if c.newest[r].IsZero() {
+				violated = true
+				message = fmt.Sprintf("No timestamps in column '%s'", rule.Column)
+				break
+			}
+			observed = now.Sub(c.newest[r]).Minutes()
+			violated = params.MaxAgeMinutes != nil && observed > *params.MaxAgeMinutes
+			message = fmt.Sprintf("Newest row is %.0f minutes old", observed)
+		case "DRIFT":
+			current, ok := c.profiles[rule.Column].metrics()[params.Metric]
+			previous, hasBaseline := c.baselineMetric(rule.Column, params.Metric)
+			if !ok || !hasBaseline || params.MaxChange == nil {
+				message = "No previous run to compare with"
+				break
+			}
+			observed = math.Abs(current - previous)
+			if params.Metric == "mean" && previous != 0 {
+				observed /= math.Abs(previous)
+			}
+			violated = observed > *params.MaxChange
+			message = fmt.Sprintf("%s of '%s' is %.4g, %.4g in the previous run", params.Metric, rule.Column, current, previous)
+		case "CUSTOM_SQL":
+			if loader == nil || loader.columns == nil || rule.Value == nil {
+				message = "No rows loaded"
+				break
+			}
+			count, err := loader.countFailing(ctx, *rule.Value, vars)
+			if err != nil {
+				return nil, fmt.Errorf("CUSTOM_SQL rule failed: %w", err)
+			}
+			observed = count
+			violated = count > 0
+			message = fmt.Sprintf("%.0f failing rows", count)
+		}
+
+		value := observed
+		c.observed[r] = &value
+		c.messages[r] = message
+		if !violated {
+			continue
+		}
+		c.counts[r] = 1
+		if rule.RuleType == "CUSTOM_SQL" {
+			c.counts[r] = int(observed)
+		}
+		c.violations += c.counts[r]
+		if rule.Severity == "FAIL" && failed == nil {
+			failed = &QualityViolation{RuleID: rule.ID, Column: rule.Column, RuleType: rule.RuleType, Message: message, rule: r}
+		}
+	}
+	if failed != nil {
+		c.failed = true
+	}
+	return failed, nil
+}
+
+// baselineMetric returns a column metric of the last loaded run
+func (c *qualityChecker) baselineMetric(column string, metric string) (float64, bool) {
+	if c.baseline == nil || c.baseline.Metrics == "" {
+		return 0, false
+	}
+	var metrics map[string]map[string]float64
+	if err := json.Unmarshal([]byte(c.baseline.Metrics), &metrics); err != nil {
+		return 0, false
+	}
+	value, ok := metrics[column][metric]
+	return value, ok
+}
+
+// takeQuarantined returns the quarantined rows not yet written
+func (c *qualityChecker) takeQuarantined() []quarantinedRow {
+	rows := c.quarantined
+	c.quarantined = nil
+	return rows
+}
+
+// scorecard sums up the rules of the run
+func (c *qualityChecker) scorecard(pipelineID string, executionID string) *models.QualityScorecard {
+	results := make([]models.QualityRuleResult, len(c.rules))
+	passed := 0
+	for r, rule := range c.rules {
+		results[r] = models.QualityRuleResult{
+			RuleID:     rule.ID,
+			RuleType:   rule.RuleType,
+			Column:     rule.Column,
+			Severity:   rule.Severity,
+			Passed:     c.counts[r] == 0,
+			Violations: c.counts[r],
+			Observed:   c.observed[r],
+			Message:    c.messages[r],
+		}
+		if c.counts[r] == 0 {
+			passed++
+		}
+	}
+
+	status := "PASSED"
+	if c.failed {
+		status = "FAILED"
+	} else if passed < len(c.rules) {
+		status = "WARNED"
+	}
+	score := 100.0
+	if len(c.rules) > 0 {
+		score = math.Round(float64(passed)/float64(len(c.rules))*1000) / 10
+	}
+
+	metrics := make(map[string]map[string]float64, len(c.profiles))
+	for column, p := range c.profiles {
+		metrics[column] = p.metrics()
+	}
+	resultsJSON, _ := json.Marshal(results)
+	metricsJSON, _ := json.Marshal(metrics)
+	return &models.QualityScorecard{
+		ID:              uuid.New().String(),
+		PipelineID:      pipelineID,
+		ExecutionID:     executionID,
+		Status:          status,
+		Score:           score,
+		RowsChecked:     c.rows,
+		RowsQuarantined: c.rowsQuarantined,
+		Results:         string(resultsJSON),
+		Metrics:         string(metricsJSON),
+		CreatedAt:       time.Now(),
+	}
+}
+
+// validateQualityRules checks data against the row rules. seen holds the
+// values UNIQUE rules saw in earlier batches and is updated; row indexes
+// start at offset. REFERENTIAL rules are checked by the qualityChecker.
+func (pe *PipelineExecutor) validateQualityRules(data []map[string]interface{}, rules []models.QualityRule, seen []map[string]bool, offset int) []QualityViolation {
+	var violations []QualityViolation
+
+	for r, rule := range rules {
+		var allowed map[string]bool
+		if rule.RuleType == "ALLOWED_VALUES" {
+			params, _ := parseQualityRule(rule)
+			allowed = params.allowed
+		}
+
+		for i, row := range data {
+			val := row[rule.Column]
+
+			var violated bool
+			switch rule.RuleType {
+			case "NOT_NULL":
+				violated = val == nil || fmt.Sprintf("%v", val) == ""
+			case "UNIQUE":
+				key := fmt.Sprintf("%v", val)
+				violated = seen[r][key]
+				seen[r][key] = true
+			case "RANGE":
+				if rule.Value != nil {
+					var rangeConfig struct {
+						Min float64 `json:"min"`
+						Max float64 `json:"max"`
+					}
+					if err := json.Unmarshal([]byte(*rule.Value), &rangeConfig); err == nil {
+						numVal := pe.toFloat64(val)
+						violated = numVal < rangeConfig.Min || numVal > rangeConfig.Max
+					}
+				}
+			case "REGEX":
+				// Simple string match for now
+				if rule.Value != nil && val != nil {
+					valStr := fmt.Sprintf("%v", val)
+					violated = !strings.Contains(valStr, *rule.Value)
+				}
+			case "ALLOWED_VALUES":
+				violated = allowed != nil && val != nil && !allowed[fmt.Sprintf("%v", val)]
+			}
+
+			if violated {
+				violations = append(violations, QualityViolation{
+					RuleID:   rule.ID,
+					Column:   rule.Column,
+					RuleType: rule.RuleType,
+					RowIndex: offset + i,
+					Value:    fmt.Sprintf("%v", val),
+					Message:  fmt.Sprintf("Row %d, column '%s': %s rule violated", offset+i, rule.Column, rule.RuleType),
+					rule:     r,
+				})
+			}
+		}
+	}
+
+	return violations
+}
+
+// qualityTimestamp reads a FRESHNESS column value as a time
+func qualityTimestamp(val interface{}) (time.Time, bool) {
+	switch t := val.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+			if parsed, err := time.Parse(layout, t); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// existingValues returns which of the values exist in a column of a table
+// of the destination database
+func (l *tableLoader) existingValues(ctx context.Context, table string, column string, values []string) (map[string]bool, error) {
+	found := make(map[string]bool, len(values))
+	for start := 0; start < len(values); start += 500 {
+		end := start + 500
+		if end > len(values) {
+			end = len(values)
+		}
+		placeholders := make([]string, end-start)
+		args := make([]interface{}, end-start)
+		for i, value := range values[start:end] {
+			placeholders[i] = "?"
+			if l.dest.dialect == "postgres" {
+				placeholders[i] = fmt.Sprintf("$%d", i+1)
+			}
+			args[i] = value
+		}
+		col := l.dest.quote(column)
+		query := fmt.Sprintf("SELECT DISTINCT %s FROM %s WHERE %s IN (%s)", col, l.dest.quote(table), col, strings.Join(placeholders, ", "))
+		rows, err := l.tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var value sql.NullString
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			found[value.String] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// quarantine writes rows held back by QUARANTINE rules to the quarantine
+// table, in the load transaction: they are kept only if the load commits
+func (l *tableLoader) quarantine(ctx context.Context, executionID string, rows []quarantinedRow) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	table := l.dest.quote(siblingTableName(l.dest.table, quarantineTableSuffix))
+	if !l.quarantineReady {
+		createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (execution_id VARCHAR(36), row_index INTEGER, violations TEXT, row_data TEXT, quarantined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP)", table)
+		if _, err := l.tx.ExecContext(ctx, createSQL); err != nil {
+			return fmt.Errorf("failed to create quarantine table: %w", err)
+		}
+		l.quarantineReady = true
+	}
+
+	records := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		data, _ := json.Marshal(row.row)
+		violations, _ := json.Marshal(row.violations)
+		records[i] = map[string]interface{}{
+			"execution_id": executionID,
+			"row_index":    row.index,
+			"violations":   string(violations),
+			"row_data":     string(data),
+		}
+	}
+	columns := []string{"execution_id", "row_index", "violations", "row_data"}
+	if err := insertBatch(ctx, l.tx, l.dest, table, columns, records); err != nil {
+		return fmt.Errorf("failed to quarantine rows: %w", err)
+	}
+	return nil
+}
+
+// countFailing runs a CUSTOM_SQL rule against the staging table. It runs in
+// a savepoint rolled back afterwards, read-only on Postgres, so that it
+// cannot change the load even where the checks of the rule fall short.
+func (l *tableLoader) countFailing(ctx context.Context, statement string, vars sqlStepVars) (float64, error) {
+	if l.manage {
+		// Rules saved before CUSTOM_SQL was limited to external destinations
+		return 0, checkCustomSQLDestination("INTERNAL_RAW")
+	}
+	if err := checkCustomSQL(statement); err != nil {
+		return 0, err
+	}
+	vars.Table = l.dest.quote(l.staging)
+	query, err := renderSQLStep(statement, vars)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := l.tx.ExecContext(ctx, "SAVEPOINT quality_rule"); err != nil {
+		return 0, err
+	}
+	defer func() {
+		l.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT quality_rule")
+		l.tx.ExecContext(ctx, "RELEASE SAVEPOINT quality_rule")
+	}()
+	if l.dest.dialect == "postgres" {
+		if _, err := l.tx.ExecContext(ctx, "SET LOCAL transaction_read_only = on"); err != nil {
+			return 0, err
+		}
+	}
+	var count sql.NullFloat64
+	if err := l.tx.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count.Float64, nil
+}
+
+// referenceLookup looks up the values of REFERENTIAL rules in the loader's
+// destination, only in the tables the workspace's pipelines load into it
+func referenceLookup(pipeline *models.Pipeline, loader *tableLoader) (func(ctx context.Context, table string, column string, values []string) (map[string]bool, error), error) {
+	var pipelines []models.Pipeline
+	if err := database.DB.Where("workspace_id = ? AND destination_type = ?", pipeline.WorkspaceID, pipeline.DestinationType).Find(&pipelines).Error; err != nil {
+		return nil, fmt.Errorf("failed to load workspace pipelines: %w", err)
+	}
+	destConfig := func(p *models.Pipeline) models.DestConfig {
+		var destConf models.DestConfig
+		if p.DestinationConfig != nil {
+			json.Unmarshal([]byte(*p.DestinationConfig), &destConf)
+		}
+		return destConf
+	}
+
+	own := destConfig(pipeline)
+	tables := make(map[string]bool, len(pipelines))
+	for i := range pipelines {
+		p := &pipelines[i]
+		if p.DestinationType == "INTERNAL_RAW" {
+			tables[internalRawTableName(p)] = true
+			continue
+		}
+		if destConf := destConfig(p); destConf.ConnectionID != "" && destConf.ConnectionID == own.ConnectionID {
+			tables[externalTableName(p, &destConf)] = true
+		}
+	}
+
+	return func(ctx context.Context, table string, column string, values []string) (map[string]bool, error) {
+		if !tables[table] {
+			return nil, fmt.Errorf("table %s is not loaded by a pipeline of this workspace", table)
+		}
+		return loader.existingValues(ctx, table, column, values)
+	}, nil
+}
+
+// latestQualityScorecard returns the scorecard of the last loaded run of a
+// pipeline, the baseline of ROW_COUNT_DELTA and DRIFT rules
+func latestQualityScorecard(pipelineID string) *models.QualityScorecard {
+	var scorecard models.QualityScorecard
+	err := database.DB.Where("\"pipelineId\" = ? AND status <> ?", pipelineID, "FAILED").
+		Order("created_at DESC").First(&scorecard).Error
+	if err != nil {
+		return nil
+	}
+	return &scorecard
+}
+
+// recordQualityScorecard stores the scorecard of a run with quality rules
+// and notifies the workspace owners when rules failed
+func (pe *PipelineExecutor) recordQualityScorecard(pipeline *models.Pipeline, executionID string, checker *qualityChecker) {
+	if len(checker.rules) == 0 {
+		return
+	}
+	scorecard := checker.scorecard(pipeline.ID, executionID)
+	if err := database.DB.Create(scorecard).Error; err != nil {
+		LogWarn("pipeline_quality", "Failed to store quality scorecard", map[string]interface{}{"pipeline_id": pipeline.ID, "error": err})
+		return
+	}
+	if scorecard.Status != "PASSED" {
+		pe.notifyQualityOwners(pipeline, scorecard)
+	}
+}
+
+// notifyQualityOwners tells the owners of a pipeline's workspace about a
+// scorecard with failed rules
+func (pe *PipelineExecutor) notifyQualityOwners(pipeline *models.Pipeline, scorecard *models.QualityScorecard) {
+	if pe.notifications == nil {
+		return
+	}
+
+	var results []models.QualityRuleResult
+	json.Unmarshal([]byte(scorecard.Results), &results)
+	var failedRules []string
+	for _, result := range results {
+		if !result.Passed {
+			name := result.RuleType
+			if result.Column != "" {
+				name += " on " + result.Column
+			}
+			failedRules = append(failedRules, name)
+		}
+	}
+
+	title := fmt.Sprintf("Data quality issues in pipeline %s", pipeline.Name)
+	notifType := "alert_warning"
+	if scorecard.Status == "FAILED" {
+		title = fmt.Sprintf("Pipeline %s aborted by a data quality rule", pipeline.Name)
+		notifType = "alert_critical"
+	}
+	message := fmt.Sprintf("Quality score %.1f%%. Failed rules: %s.", scorecard.Score, strings.Join(failedRules, ", "))
+	if scorecard.RowsQuarantined > 0 {
+		message += fmt.Sprintf(" %d rows quarantined.", scorecard.RowsQuarantined)
+	}
+
+	for _, userID := range workspaceOwnerIDs(pipeline.WorkspaceID) {
+		err := pe.notifications.SendNotification(userID, title, message, notifType, "/pipelines/"+pipeline.ID, map[string]interface{}{
+			"pipelineId":  pipeline.ID,
+			"executionId": scorecard.ExecutionID,
+			"scorecardId": scorecard.ID,
+		})
+		if err != nil {
+			LogWarn("pipeline_quality", "Failed to notify about quality issues", map[string]interface{}{"pipeline_id": pipeline.ID, "user_id": userID, "error": err})
+		}
+	}
+}
+
+// workspaceOwnerIDs returns the creator and the OWNER members of a workspace
+func workspaceOwnerIDs(workspaceID string) []string {
+	owners := make(map[string]bool)
+	var workspace models.Workspace
+	if err := database.DB.Select("owner_id").First(&workspace, "id = ?", workspaceID).Error; err == nil && workspace.OwnerID != "" {
+		owners[workspace.OwnerID] = true
+	}
+	var members []models.WorkspaceMember
+	database.DB.Where("workspace_id = ? AND role = ?", workspaceID, "OWNER").Find(&members)
+	for _, member := range members {
+		owners[member.UserID] = true
+	}
+
+	ids := make([]string, 0, len(owners))
+	for id := range owners {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// QualityScorecards returns the latest scorecards of a pipeline, newest
+// first, of one execution when executionID is set
+func QualityScorecards(pipelineID string, executionID string, limit int) ([]models.QualityScorecard, error) {
+	query := database.DB.Where("\"pipelineId\" = ?", pipelineID)
+	if executionID != "" {
+		query = query.Where("\"executionId\" = ?", executionID)
+	}
+	var scorecards []models.QualityScorecard
+	err := query.Order("created_at DESC").Limit(limit).Find(&scorecards).Error
+	return scorecards, err
+}
+
+// QuarantinedRows returns rows the pipeline's runs quarantined, newest
+// first, of one execution when executionID is set
+func (pe *PipelineExecutor) QuarantinedRows(ctx context.Context, pipeline *models.Pipeline, executionID string, limit int) ([]map[string]interface{}, error) {
+	dest, err := pe.openDestination(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer dest.close()
+
+	table := siblingTableName(dest.table, quarantineTableSuffix)
+	if ok, err := dest.hasTable(ctx, table); err != nil || !ok {
+		return []map[string]interface{}{}, err
+	}
+
+	query := "SELECT execution_id, row_index, violations, row_data, quarantined_at FROM " + dest.quote(table)
+	var args []interface{}
+	if executionID != "" {
+		placeholder := "?"
+		if dest.dialect == "postgres" {
+			placeholder = "$1"
+		}
+		query += " WHERE execution_id = " + placeholder
+		args = append(args, executionID)
+	}
+	query += fmt.Sprintf(" ORDER BY quarantined_at DESC, row_index LIMIT %d", limit)
+
+	rows, err := dest.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quarantined rows: %w", err)
+	}
+	defer rows.Close()
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		var execution, violations, data sql.NullString
+		var index int
+		var at interface{}
+		if err := rows.Scan(&execution, &index, &violations, &data, &at); err != nil {
+			return nil, err
+		}
+		var messages []string
+		var row map[string]interface{}
+		json.Unmarshal([]byte(violations.String), &messages)
+		json.Unmarshal([]byte(data.String), &row)
+		result = append(result, map[string]interface{}{
+			"executionId":   execution.String,
+			"rowIndex":      index,
+			"violations":    messages,
+			"row":           row,
+			"quarantinedAt": at,
+		})
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQualityChecker_UniqueAcrossBatches(t *testing.T) {
+	ctx := context.Background()
+	checker := newQualityChecker(NewPipelineExecutor(), []models.QualityRule{
+		{RuleType: "UNIQUE", Column: "id", Severity: "WARN"},
+		{RuleType: "NOT_NULL", Column: "name", Severity: "FAIL"},
+	})
+	_, failed, err := checker.check(ctx, []map[string]interface{}{{"id": 1, "name": "a"}, {"id": 2, "name": "b"}})
+	require.NoError(t, err)
+	assert.Nil(t, failed)
+	keep, failed, err := checker.check(ctx, []map[string]interface{}{{"id": 2, "name": "c"}})
+	require.NoError(t, err)
+	assert.Nil(t, failed)
+	assert.Len(t, keep, 1, "WARN rules do not hold rows back")
+	assert.Equal(t, 1, checker.violations)
+
+	_, failed, err = checker.check(ctx, []map[string]interface{}{{"id": 4}})
+	require.NoError(t, err)
+	require.NotNil(t, failed)
+	assert.Equal(t, 3, failed.RowIndex)
+	assert.Equal(t, "FAILED", checker.scorecard("p", "e").Status)
+}
+
+func TestQualityChecker_QuarantinesFailingRows(t *testing.T) {
+	ctx := context.Background()
+	checker := newQualityChecker(NewPipelineExecutor(), []models.QualityRule{
+		{RuleType: "ALLOWED_VALUES", Column: "region", Value: strPtr(`["EU", "US"]`), Severity: "QUARANTINE"},
+		{RuleType: "REFERENTIAL", Column: "customer", Value: strPtr(`{"table": "customers", "column": "id"}`), Severity: "QUARANTINE"},
+	})
+	var lookups [][]string
+	checker.lookup = func(ctx context.Context, table string, column string, values []string) (map[string]bool, error) {
+		assert.Equal(t, "customers", table)
+		lookups = append(lookups, values)
+		return map[string]bool{"c1": true}, nil
+	}
+
+	keep, failed, err := checker.check(ctx, []map[string]interface{}{
+		{"region": "EU", "customer": "c1"},
+		{"region": "APAC", "customer": "c1"},
+		{"region": "US", "customer": "c9"},
+		{"region": "US", "customer": nil},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, failed)
+	assert.Equal(t, []map[string]interface{}{{"region": "EU", "customer": "c1"}, {"region": "US", "customer": nil}}, keep)
+
+	keep, _, err = checker.check(ctx, []map[string]interface{}{{"region": "EU", "customer": "c9"}})
+	require.NoError(t, err)
+	assert.Empty(t, keep)
+	assert.Len(t, lookups, 1, "values already looked up are not looked up again")
+
+	quarantined := checker.takeQuarantined()
+	require.Len(t, quarantined, 3)
+	assert.Equal(t, 1, quarantined[0].index)
+	assert.Equal(t, 4, quarantined[2].index)
+	assert.Contains(t, quarantined[1].violations[0], "c9 not found in customers.id")
+	assert.Empty(t, checker.takeQuarantined())
+
+	scorecard := checker.scorecard("p", "e")
+	assert.Equal(t, "WARNED", scorecard.Status)
+	assert.Equal(t, 5, scorecard.RowsChecked)
+	assert.Equal(t, 3, scorecard.RowsQuarantined)
+	assert.Equal(t, 0.0, scorecard.Score)
+}
+
+func TestQualityChecker_RunRules(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	rules := []models.QualityRule{
+		{RuleType: "ROW_COUNT", Value: strPtr(`{"min": 1, "max": 10}`), Severity: "FAIL"},
+		{RuleType: "ROW_COUNT_DELTA", Value: strPtr(`{"maxPercent": 20}`), Severity: "WARN"},
+		{RuleType: "FRESHNESS", Column: "updated", Value: strPtr(`{"maxAgeMinutes": 60}`), Severity: "WARN"},
+		{RuleType: "DRIFT", Column: "amount", Value: strPtr(`{"metric": "mean", "maxChange": 0.5}`), Severity: "WARN"},
+		{RuleType: "DRIFT", Column: "amount", Value: strPtr(`{"metric": "nullRate", "maxChange": 0.1}`), Severity: "WARN"},
+	}
+	batch := []map[string]interface{}{
+		{"amount": 10, "updated": "2026-10-18T11:30:00Z"},
+		{"amount": 30, "updated": "2026-10-18 10:00:00"},
+		{"amount": nil, "updated": nil},
+	}
+
+	// The first run has nothing to compare with
+	checker := newQualityChecker(NewPipelineExecutor(), rules)
+	_, _, err := checker.check(ctx, batch)
+	require.NoError(t, err)
+	failed, err := checker.finish(ctx, nil, sqlStepVars{}, now)
+	require.NoError(t, err)
+	assert.Nil(t, failed)
+	first := checker.scorecard("p", "e1")
+	assert.Equal(t, "PASSED", first.Status)
+	var metrics map[string]map[string]float64
+	require.NoError(t, json.Unmarshal([]byte(first.Metrics), &metrics))
+	assert.Equal(t, 20.0, metrics["amount"]["mean"])
+	assert.InDelta(t, 1.0/3, metrics["amount"]["nullRate"], 1e-9)
+
+	// The second run drifts: more rows, a higher mean, older data
+	checker = newQualityChecker(NewPipelineExecutor(), rules)
+	checker.baseline = first
+	_, _, err = checker.check(ctx, []map[string]interface{}{
+		{"amount": 100, "updated": "2026-10-18T09:00:00Z"},
+		{"amount": 100, "updated": "2026-10-18T09:00:00Z"},
+		{"amount": 100, "updated": "2026-10-18T09:00:00Z"},
+		{"amount": nil, "updated": "2026-10-18T09:00:00Z"},
+	})
+	require.NoError(t, err)
+	failed, err = checker.finish(ctx, nil, sqlStepVars{}, now)
+	require.NoError(t, err)
+	assert.Nil(t, failed)
+
+	second := checker.scorecard("p", "e2")
+	assert.Equal(t, "WARNED", second.Status)
+	var results []models.QualityRuleResult
+	require.NoError(t, json.Unmarshal([]byte(second.Results), &results))
+	passed := make([]bool, len(results))
+	for i, result := range results {
+		passed[i] = result.Passed
+	}
+	assert.Equal(t, []bool{true, false, false, false, true}, passed)
+	assert.InDelta(t, 33.33, *results[1].Observed, 0.01)
+	assert.Equal(t, 180.0, *results[2].Observed)
+	assert.Equal(t, 40.0, second.Score)
+
+	// Too many rows fails the run
+	checker = newQualityChecker(NewPipelineExecutor(), rules)
+	_, _, err = checker.check(ctx, make([]map[string]interface{}, 11))
+	require.NoError(t, err)
+	failed, err = checker.finish(ctx, nil, sqlStepVars{}, now)
+	require.NoError(t, err)
+	require.NotNil(t, failed)
+	assert.Equal(t, "ROW_COUNT", failed.RuleType)
+	assert.Equal(t, "FAILED", checker.scorecard("p", "e3").Status)
+}
+
+func TestValidateQualityRules(t *testing.T) {
+	valid := []models.QualityRule{
+		{RuleType: "not_null", Column: "id"},
+		{RuleType: "ALLOWED_VALUES", Column: "region", Value: strPtr(`["EU"]`), Severity: "quarantine"},
+		{RuleType: "ROW_COUNT", Value: strPtr(`{"min": 1}`), Severity: "FAIL"},
+		{RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT COUNT(*) FROM {{table}} WHERE amount < 0`)},
+		{RuleType: "CUSTOM_SQL", Value: strPtr(`WITH late AS (SELECT id FROM {{table}} t WHERE EXTRACT(YEAR FROM t.day) < 2000) ` +
+			`SELECT COUNT(*) FROM late JOIN {{table}} b ON b.id = late.id WHERE b.note IS DISTINCT FROM 'x; delete'`)},
+	}
+	require.NoError(t, ValidateQualityRules(valid, "POSTGRES"))
+
+	cases := map[string]models.QualityRule{
+		"unknown quality rule type":       {RuleType: "SPELLCHECK", Column: "name"},
+		"requires a column":               {RuleType: "NOT_NULL"},
+		"JSON array":                      {RuleType: "ALLOWED_VALUES", Column: "region", Value: strPtr(`"EU"`)},
+		"requires table and column":       {RuleType: "REFERENTIAL", Column: "customer", Value: strPtr(`{"table": "customers"}`)},
+		"metric must be mean or nullRate": {RuleType: "DRIFT", Column: "amount", Value: strPtr(`{"metric": "max", "maxChange": 1}`)},
+		"only row rules":                  {RuleType: "ROW_COUNT", Value: strPtr(`{"min": 1}`), Severity: "QUARANTINE"},
+		"requires a SELECT":               {RuleType: "CUSTOM_SQL", Value: strPtr(`DELETE FROM {{table}}`)},
+		"unknown placeholder":             {RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT COUNT(*) FROM {{other}}`)},
+		"single statement":                {RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT 1; DROP TABLE users`)},
+		"must not modify data (DELETE)":   {RuleType: "CUSTOM_SQL", Value: strPtr(`WITH gone AS (DELETE FROM {{table}} RETURNING 1) SELECT COUNT(*) FROM gone`)},
+		"must not modify data (INTO)":     {RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT * INTO copy FROM {{table}}`)},
+		"only read {{table}}, not users":  {RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT COUNT(*) FROM {{table}} t, users WHERE t.id = users.id`)},
+		`not public."Users"`:              {RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT COUNT(*) FROM (SELECT 1 FROM public."Users") u`)},
+		"severity must be":                {RuleType: "UNIQUE", Column: "id", Severity: "PANIC"},
+	}
+	for message, rule := range cases {
+		assert.ErrorContains(t, ValidateQualityRules([]models.QualityRule{rule}, "POSTGRES"), message)
+	}
+
+	// SQL hidden in string literals is beyond the statement checks, so the
+	// application database never runs CUSTOM_SQL rules
+	hidden := models.QualityRule{RuleType: "CUSTOM_SQL", Value: strPtr(`SELECT COUNT(*) FROM {{table}} WHERE query_to_xml('select password from users', true, true, '')::text LIKE '%a%'`)}
+	assert.ErrorContains(t, ValidateQualityRules([]models.QualityRule{hidden}, "INTERNAL_RAW"), "internal store")
+}
+
+func TestExecute_QuarantinesRowsAndRecordsScorecards(t *testing.T) {
+	withSmallBatches(t)
+	db := setupTestDB(t, &models.Pipeline{}, &models.QualityRule{}, &models.JobExecution{}, &models.QualityScorecard{})
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	writePipelineFile(t, "sales.csv", "region,amount\nEU,1\nUS,2\nAPAC,3\nEU,4\nMARS,5\n")
+
+	pipeline := models.Pipeline{ID: "sales", Name: "Sales", WorkspaceID: "ws", Mode: "ETL", SourceType: "CSV", SourceConfig: `{"filePath": "sales.csv"}`, DestinationType: "INTERNAL_RAW"}
+	require.NoError(t, db.Create(&pipeline).Error)
+	require.NoError(t, SetPipelineQualityRules("sales", "INTERNAL_RAW", []models.QualityRule{
+		{RuleType: "ALLOWED_VALUES", Column: "region", Value: strPtr(`["EU", "US"]`), Severity: "QUARANTINE"},
+		{RuleType: "ROW_COUNT", Value: strPtr(`{"max": 2}`), Severity: "WARN"},
+	}))
+	require.NoError(t, db.Create(&models.JobExecution{ID: "exec-1", PipelineID: "sales", Status: "PROCESSING"}).Error)
+
+	pe := NewPipelineExecutor()
+	result := pe.Execute("sales", "exec-1")
+	require.NoError(t, result.Error)
+	assert.Equal(t, 3, result.RowsProcessed)
+	assert.Equal(t, 3, result.QualityViolations)
+
+	var loaded int64
+	require.NoError(t, db.Table("pipeline_data_sales").Count(&loaded).Error)
+	assert.Equal(t, int64(3), loaded)
+
+	quarantined, err := pe.QuarantinedRows(context.Background(), &pipeline, "exec-1", 10)
+	require.NoError(t, err)
+	require.Len(t, quarantined, 2)
+	assert.Equal(t, 2, quarantined[0]["rowIndex"])
+	assert.Equal(t, map[string]interface{}{"region": "APAC", "amount": float64(3)}, quarantined[0]["row"])
+	assert.Equal(t, "MARS", quarantined[1]["row"].(map[string]interface{})["region"])
+
+	scorecards, err := QualityScorecards("sales", "", 10)
+	require.NoError(t, err)
+	require.Len(t, scorecards, 1)
+	assert.Equal(t, "WARNED", scorecards[0].Status)
+	assert.Equal(t, 5, scorecards[0].RowsChecked)
+	assert.Equal(t, 2, scorecards[0].RowsQuarantined)
+
+	// A FAIL rule aborts the next run: the table and the quarantine keep the first run
+	require.NoError(t, SetPipelineQualityRules("sales", "INTERNAL_RAW", []models.QualityRule{
+		{RuleType: "ALLOWED_VALUES", Column: "region", Value: strPtr(`["EU", "US"]`), Severity: "QUARANTINE"},
+		{RuleType: "ROW_COUNT", Value: strPtr(`{"min": 100}`), Severity: "FAIL"},
+	}))
+	require.NoError(t, db.Create(&models.JobExecution{ID: "exec-2", PipelineID: "sales", Status: "PROCESSING"}).Error)
+	result = pe.Execute("sales", "exec-2")
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "ROW_COUNT")
+
+	require.NoError(t, db.Table("pipeline_data_sales").Count(&loaded).Error)
+	assert.Equal(t, int64(3), loaded)
+	quarantined, err = pe.QuarantinedRows(context.Background(), &pipeline, "", 10)
+	require.NoError(t, err)
+	assert.Len(t, quarantined, 2)
+
+	scorecards, err = QualityScorecards("sales", "exec-2", 10)
+	require.NoError(t, err)
+	require.Len(t, scorecards, 1)
+	assert.Equal(t, "FAILED", scorecards[0].Status)
+	assert.Equal(t, "exec-1", latestQualityScorecard("sales").ExecutionID, "failed runs are no baseline")
+
+	// CUSTOM_SQL rules saved before they were limited to external destinations do not run
+	require.NoError(t, db.Where("\"pipelineId\" = ?", "sales").Delete(&models.QualityRule{}).Error)
+	require.NoError(t, db.Omit("Pipeline").Create(&models.QualityRule{ID: "legacy", PipelineID: "sales", RuleType: "CUSTOM_SQL", Severity: "WARN",
+		Value: strPtr(`SELECT COUNT(*) FROM {{table}}`)}).Error)
+	require.NoError(t, db.Create(&models.JobExecution{ID: "exec-3", PipelineID: "sales", Status: "PROCESSING"}).Error)
+	result = pe.Execute("sales", "exec-3")
+	require.Error(t, result.Error)
+	assert.Contains(t, result.Error.Error(), "internal store")
+}
+
+func TestReferenceLookup(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+	for _, p := range []models.Pipeline{
+		{ID: "orders", Name: "Orders", WorkspaceID: "ws", SourceType: "CSV", DestinationType: "INTERNAL_RAW"},
+		{ID: "customers", Name: "Customers", WorkspaceID: "ws", SourceType: "CSV", DestinationType: "INTERNAL_RAW"},
+		{ID: "secrets", Name: "Secrets", WorkspaceID: "other", SourceType: "CSV", DestinationType: "INTERNAL_RAW"},
+	} {
+		require.NoError(t, db.Create(&p).Error)
+	}
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`CREATE TABLE pipeline_data_customers (id TEXT)`)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec(`INSERT INTO pipeline_data_customers VALUES ('c1')`)
+	require.NoError(t, err)
+
+	loader := &tableLoader{dest: &pipelineDestination{db: sqlDB, dialect: "sqlite"}}
+	lookup, err := referenceLookup(&models.Pipeline{ID: "orders", Name: "Orders", WorkspaceID: "ws", DestinationType: "INTERNAL_RAW"}, loader)
+	require.NoError(t, err)
+	loader.tx, err = sqlDB.Begin()
+	require.NoError(t, err)
+	defer loader.tx.Rollback()
+
+	found, err := lookup(context.Background(), "pipeline_data_customers", "id", []string{"c1", "c2"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"c1": true}, found)
+	_, err = lookup(context.Background(), "pipeline_data_secrets", "id", []string{"c1"})
+	assert.ErrorContains(t, err, "not loaded by a pipeline of this workspace")
+	_, err = lookup(context.Background(), "users", "id", []string{"c1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+)
+
+// Variables rather than constants so tests can exercise small batches and
+// spilling
+var (
+	// pipelineBatchSize is the number of rows flowing through a run at a time
+	pipelineBatchSize = 5000
+	// pipelineSpillRows is how many rows a blocking transform holds in memory
+	// before it spills to disk
+	pipelineSpillRows = 100000
+	// pipelineSpillPartitions is the number of files a spilled transform
+	// hash-partitions its rows into; each is processed on its own
+	pipelineSpillPartitions = 16
+)
+
+// rowStream yields the rows of a pipeline run in batches
+type rowStream interface {
+	// Next returns the next batch, or io.EOF when the stream is exhausted
+	Next(ctx context.Context) ([]map[string]interface{}, error)
+	Close() error
+}
+
+// stageError tags an error with the run stage (EXTRACT, TRANSFORM) it came from
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string { return e.err.Error() }
+func (e *stageError) Unwrap() error { return e.err }
+
+// errorStage returns the stage an error came from, or fallback
+func errorStage(err error, fallback string) string {
+	var se *stageError
+	if errors.As(err, &se) {
+		return se.stage
+	}
+	return fallback
+}
+
+// drainStream reads a stream to the end
+func drainStream(ctx context.Context, stream rowStream) ([]map[string]interface{}, error) {
+	defer stream.Close()
+	var rows []map[string]interface{}
+	for {
+		batch, err := stream.Next(ctx)
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, batch...)
+	}
+}
+
+// sourceColumn is a column of a source result with its database type name,
+// empty when the source does not report one
+type sourceColumn struct {
+	name   string
+	dbType string
+}
+
+// columnSource is implemented by streams that know their columns, in the
+// order of the source result
+type columnSource interface {
+	sourceColumns() []sourceColumn
+}
+
+// sliceStream streams rows already in memory
+type sliceStream struct {
+	rows    []map[string]interface{}
+	columns []sourceColumn // nil when unknown
+}
+
+func (s *sliceStream) sourceColumns() []sourceColumn { return s.columns }
+
+func (s *sliceStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.rows) == 0 {
+		return nil, io.EOF
+	}
+	n := pipelineBatchSize
+	if n > len(s.rows) {
+		n = len(s.rows)
+	}
+	batch := s.rows[:n]
+	s.rows = s.rows[n:]
+	return batch, nil
+}
+
+func (s *sliceStream) Close() error { return nil }
+
+// sqlRowsStream streams a query result, stopping after limit rows (0 = all)
+type sqlRowsStream struct {
+	rows    *sql.Rows
+	columns []string
+	types   []string // database type names of the columns
+	limit   int
+	read    int
+	release func() // closes what the stream owns besides rows, may be nil
+}
+
+func newSQLRowsStream(rows *sql.Rows, limit int, release func()) (*sqlRowsStream, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		if release != nil {
+			release()
+		}
+		return nil, fmt.Errorf("failed to get columns: %w", err)
+	}
+	types := make([]string, len(columns))
+	if columnTypes, err := rows.ColumnTypes(); err == nil {
+		for i, ct := range columnTypes {
+			types[i] = ct.DatabaseTypeName()
+		}
+	}
+	return &sqlRowsStream{rows: rows, columns: columns, types: types, limit: limit, release: release}, nil
+}
+
+func (s *sqlRowsStream) sourceColumns() []sourceColumn {
+	columns := make([]sourceColumn, len(s.columns))
+	for i, name := range s.columns {
+		columns[i] = sourceColumn{name: name, dbType: s.types[i]}
+	}
+	return columns
+}
+
+func (s *sqlRowsStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var batch []map[string]interface{}
+	for len(batch) < pipelineBatchSize && (s.limit <= 0 || s.read < s.limit) && s.rows.Next() {
+		values := make([]interface{}, len(s.columns))
+		valuePtrs := make([]interface{}, len(s.columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+		if err := s.rows.Scan(valuePtrs...); err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		row := make(map[string]interface{}, len(s.columns))
+		for i, col := range s.columns {
+			// Convert []byte to string for readability
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		batch = append(batch, row)
+		s.read++
+	}
+	if err := s.rows.Err(); err != nil {
+		return nil, fmt.Errorf("row iteration error: %w", err)
+	}
+	if len(batch) == 0 {
+		return nil, io.EOF
+	}
+	return batch, nil
+}
+
+func (s *sqlRowsStream) Close() error {
+	err := s.rows.Close()
+	if s.release != nil {
+		s.release()
+		s.release = nil
+	}
+	return err
+}
+
+// mapStream applies a row-wise transform to every batch
+type mapStream struct {
+	in    rowStream
+	apply func(ctx context.Context, batch []map[string]interface{}) ([]map[string]interface{}, error)
+}
+
+func (s *mapStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	for {
+		batch, err := s.in.Next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out, err := s.apply(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		// Skip batches a filter emptied rather than ending the stream
+		if len(out) > 0 {
+			return out, nil
+		}
+	}
+}
+
+func (s *mapStream) Close() error { return s.in.Close() }
+
+// concatStream streams one stream after another; the second is opened once
+// the first is exhausted
+type concatStream struct {
+	first  rowStream
+	open   func(ctx context.Context) (rowStream, error)
+	second rowStream
+}
+
+func (s *concatStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if s.second == nil {
+		batch, err := s.first.Next(ctx)
+		if err != io.EOF {
+			return batch, err
+		}
+		second, err := s.open(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.second = second
+	}
+	return s.second.Next(ctx)
+}
+
+func (s *concatStream) Close() error {
+	err := s.first.Close()
+	if s.second != nil {
+		if closeErr := s.second.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// blockingStream runs a transform that needs all of its input, like an
+// aggregate. It buffers the input in memory up to pipelineSpillRows, then
+// hash-partitions it into spill files by the transform's key so that each
+// partition can be transformed on its own. Without a key the whole input is
+// one partition, read back from disk when it spilled.
+type blockingStream struct {
+	in      rowStream
+	key     func(row map[string]interface{}) string // nil: one partition
+	observe func(row map[string]interface{})        // sees every input row, may be nil
+	finish  func(rows []map[string]interface{}) ([]map[string]interface{}, error)
+
+	buffered bool
+	memory   []map[string]interface{}
+	spill    *spillFiles
+	next     int // next spill partition to finish
+	pending  []map[string]interface{}
+}
+
+func (s *blockingStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	if !s.buffered {
+		if err := s.buffer(ctx); err != nil {
+			return nil, err
+		}
+		s.buffered = true
+		if s.spill == nil {
+			out, err := s.finish(s.memory)
+			if err != nil {
+				return nil, err
+			}
+			s.memory = nil
+			s.pending = out
+		}
+	}
+
+	for len(s.pending) == 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if s.spill == nil || s.next >= len(s.spill.files) {
+			return nil, io.EOF
+		}
+		rows, err := s.spill.read(s.next)
+		if err != nil {
+			return nil, err
+		}
+		s.next++
+		if len(rows) == 0 {
+			continue
+		}
+		if s.pending, err = s.finish(rows); err != nil {
+			return nil, err
+		}
+	}
+
+	n := pipelineBatchSize
+	if n > len(s.pending) {
+		n = len(s.pending)
+	}
+	batch := s.pending[:n]
+	s.pending = s.pending[n:]
+	return batch, nil
+}
+
+// buffer reads the whole input, spilling once it outgrows memory
+func (s *blockingStream) buffer(ctx context.Context) error {
+	for {
+		batch, err := s.in.Next(ctx)
+		if err == io.EOF {
+			if s.spill != nil {
+				return s.spill.flush()
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, row := range batch {
+			if s.observe != nil {
+				s.observe(row)
+			}
+		}
+
+		if s.spill == nil {
+			s.memory = append(s.memory, batch...)
+			if len(s.memory) <= pipelineSpillRows {
+				continue
+			}
+			partitions := pipelineSpillPartitions
+			if s.key == nil {
+				partitions = 1
+			}
+			if s.spill, err = newSpillFiles(partitions); err != nil {
+				return err
+			}
+			batch, s.memory = s.memory, nil
+		}
+		for _, row := range batch {
+			if err := s.spill.write(s.partition(row), row); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *blockingStream) partition(row map[string]interface{}) int {
+	if s.key == nil {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s.key(row)))
+	return int(h.Sum32() % uint32(len(s.spill.files)))
+}
+
+func (s *blockingStream) Close() error {
+	err := s.in.Close()
+	if s.spill != nil {
+		s.spill.remove()
+	}
+	return err
+}
+
+// spillFiles are the temporary files of a spilled blocking transform, one
+// per partition, holding rows as JSON lines
+type spillFiles struct {
+	dir     string
+	files   []*os.File
+	writers []*bufio.Writer
+}
+
+func newSpillFiles(partitions int) (*spillFiles, error) {
+	dir, err := os.MkdirTemp("", "pipeline-spill-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	s := &spillFiles{dir: dir}
+	for i := 0; i < partitions; i++ {
+		f, err := os.CreateTemp(dir, "partition-*.jsonl")
+		if err != nil {
+			s.remove()
+			return nil, fmt.Errorf("failed to create spill file: %w", err)
+		}
+		s.files = append(s.files, f)
+		s.writers = append(s.writers, bufio.NewWriter(f))
+	}
+	return s, nil
+}
+
+func (s *spillFiles) write(partition int, row map[string]interface{}) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Errorf("failed to spill row: %w", err)
+	}
+	w := s.writers[partition]
+	if _, err := w.Write(line); err != nil {
+		return fmt.Errorf("failed to spill row: %w", err)
+	}
+	return w.WriteByte('\n')
+}
+
+func (s *spillFiles) flush() error {
+	for _, w := range s.writers {
+		if err := w.Flush(); err != nil {
+			return fmt.Errorf("failed to spill rows: %w", err)
+		}
+	}
+	return nil
+}
+
+// read loads one partition back. Numbers come back as int64 when integral
+// and float64 otherwise; other values as their JSON decoding.
+func (s *spillFiles) read(partition int) ([]map[string]interface{}, error) {
+	f := s.files[partition]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	decoder.UseNumber()
+	var rows []map[string]interface{}
+	for {
+		var row map[string]interface{}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read spilled rows: %w", err)
+		}
+		for col, val := range row {
+			if n, ok := val.(json.Number); ok {
+				if i, err := n.Int64(); err == nil && !strings.ContainsAny(n.String(), ".eE") {
+					row[col] = i
+				} else if f, err := n.Float64(); err == nil {
+					row[col] = f
+				}
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func (s *spillFiles) remove() {
+	for _, f := range s.files {
+		f.Close()
+	}
+	os.RemoveAll(s.dir)
+}
+
+// countingStream counts the rows and approximate bytes of a stream and
+// reports them after every batch
+type countingStream struct {
+	in      rowStream
+	rows    int
+	bytes   int64
+	onBatch func(rows int)
+}
+
+func (s *countingStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	batch, err := s.in.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.rows += len(batch)
+	s.bytes += estimateRowBytes(batch)
+	if s.onBatch != nil {
+		s.onBatch(s.rows)
+	}
+	return batch, nil
+}
+
+func (s *countingStream) Close() error { return s.in.Close() }
+
+// stageStream tags the errors of a stream with a stage
+type stageStream struct {
+	in    rowStream
+	stage string
+	wrap  func(err error) error
+}
+
+func (s *stageStream) Next(ctx context.Context) ([]map[string]interface{}, error) {
+	batch, err := s.in.Next(ctx)
+	if err != nil && err != io.EOF {
+		var se *stageError
+		if ctx.Err() != nil || errors.As(err, &se) {
+			return nil, err
+		}
+		return nil, &stageError{stage: s.stage, err: s.wrap(err)}
+	}
+	return batch, err
+}
+
+func (s *stageStream) Close() error { return s.in.Close() }
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withSmallBatches makes runs use tiny batches and spill after a few rows
+func withSmallBatches(t *testing.T) {
+	t.Helper()
+	batch, spill := pipelineBatchSize, pipelineSpillRows
+	pipelineBatchSize, pipelineSpillRows = 3, 5
+	t.Cleanup(func() { pipelineBatchSize, pipelineSpillRows = batch, spill })
+}
+
+func TestStreamTransform_SpilledMatchesInMemory(t *testing.T) {
+	withSmallBatches(t)
+	pe := NewPipelineExecutor()
+	ctx := context.Background()
+
+	var data []map[string]interface{}
+	for i := 0; i < 40; i++ {
+		data = append(data, map[string]interface{}{"region": fmt.Sprintf("r%d", i%7), "month": fmt.Sprintf("m%d", i%3), "sales": int64(i)})
+	}
+	steps := []*models.TransformStep{
+		{Type: "AGGREGATE", Config: map[string]interface{}{
+			"groupBy":    []interface{}{"region"},
+			"aggregates": []interface{}{map[string]interface{}{"column": "sales", "function": "SUM", "alias": "total"}},
+		}},
+		{Type: "PIVOT", Config: map[string]interface{}{"groupBy": "region", "pivotColumn": "month", "valueColumn": "sales", "aggFunc": "sum"}},
+		{Type: "DEDUPLICATE", Config: map[string]interface{}{"columns": []interface{}{"month"}}},
+	}
+
+	byKey := func(rows []map[string]interface{}, key string) []map[string]interface{} {
+		sort.Slice(rows, func(i, j int) bool { return fmt.Sprint(rows[i][key]) < fmt.Sprint(rows[j][key]) })
+		return rows
+	}
+	for _, step := range steps {
+		want, err := pe.applyTransform(ctx, &models.Pipeline{}, data, step)
+		require.NoError(t, err)
+
+		stream, err := pe.streamTransform(ctx, &models.Pipeline{}, &sliceStream{rows: data}, step)
+		require.NoError(t, err)
+		got, err := drainStream(ctx, stream)
+		require.NoError(t, err)
+
+		key := "region"
+		if step.Type == "DEDUPLICATE" {
+			key = "month"
+		}
+		assert.Equal(t, byKey(want, key), byKey(got, key), step.Type)
+	}
+}
+
+func TestStreamTransform_FilterSkipsEmptyBatches(t *testing.T) {
+	withSmallBatches(t)
+	pe := NewPipelineExecutor()
+	data := []map[string]interface{}{{"a": 1.0}, {"a": 1.0}, {"a": 1.0}, {"a": 2.0}}
+
+	stream, err := pe.streamTransform(context.Background(), &models.Pipeline{}, &sliceStream{rows: data}, &models.TransformStep{
+		Type: "FILTER", Config: map[string]interface{}{"column": "a", "operator": "eq", "value": 2.0},
+	})
+	require.NoError(t, err)
+	rows, err := drainStream(context.Background(), stream)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"a": 2.0}}, rows)
+}
+
+func TestTableLoader_InternalRaw(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+	pipeline := &models.Pipeline{ID: "events", Name: "Events", DestinationType: "INTERNAL_RAW"}
+	ctx := context.Background()
+
+	loader, err := NewPipelineExecutor().openLoader(ctx, pipeline)
+	require.NoError(t, err)
+	require.NoError(t, loader.write(ctx, []map[string]interface{}{{"id": 1, "kind": "open"}}))
+	require.NoError(t, loader.write(ctx, []map[string]interface{}{{"id": 2, "kind": "click", "target": "nav"}}))
+	require.NoError(t, loader.commit(ctx))
+
+	var rows []struct {
+		ID     string
+		Kind   string
+		Target *string
+	}
+	require.NoError(t, db.Raw(`SELECT id, kind, target FROM "pipeline_data_events" ORDER BY id`).Scan(&rows).Error)
+	require.Len(t, rows, 2)
+	assert.Nil(t, rows[0].Target)
+	require.NotNil(t, rows[1].Target, "later batches can add columns")
+	assert.Equal(t, "nav", *rows[1].Target)
+
+	loader, err = NewPipelineExecutor().openLoader(ctx, pipeline)
+	require.NoError(t, err)
+	require.NoError(t, loader.write(ctx, []map[string]interface{}{{"id": 3}}))
+	loader.abort()
+
+	var count int
+	require.NoError(t, db.Raw(`SELECT COUNT(*) FROM "pipeline_data_events"`).Scan(&count).Error)
+	assert.Equal(t, 2, count, "an aborted overwrite leaves the table as it was")
+}
+
+func TestExecute_StreamsIntoInternalRaw(t *testing.T) {
+	withSmallBatches(t)
+	db := setupTestDB(t, &models.Pipeline{}, &models.QualityRule{}, &models.JobExecution{})
+
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	writePipelineFile(t, "sales.csv", "region,amount\nEU,1\nUS,2\nEU,3\nUS,4\nEU,5\nAPAC,6\nEU,7\n")
+
+	steps := `[{"type": "FILTER", "order": 1, "config": {"column": "region", "operator": "neq", "value": "APAC"}},
+		{"type": "AGGREGATE", "order": 2, "config": {"groupBy": ["region"], "aggregates": [{"column": "amount", "function": "SUM", "alias": "total"}]}}]`
+	pipeline := models.Pipeline{ID: "sales", Name: "Sales", WorkspaceID: "ws", Mode: "ETL", SourceType: "CSV", SourceConfig: `{"filePath": "sales.csv"}`, DestinationType: "INTERNAL_RAW", TransformationSteps: &steps}
+	require.NoError(t, db.Create(&pipeline).Error)
+	require.NoError(t, db.Create(&models.JobExecution{ID: "exec-1", PipelineID: "sales", Status: "PROCESSING"}).Error)
+
+	result := NewPipelineExecutor().Execute("sales", "exec-1")
+	require.NoError(t, result.Error)
+	assert.Equal(t, 2, result.RowsProcessed)
+
+	var totals []struct {
+		Region string
+		Total  string
+	}
+	require.NoError(t, db.Raw(`SELECT region, total FROM "pipeline_data_sales" ORDER BY region`).Scan(&totals).Error)
+	require.Len(t, totals, 2)
+	assert.Equal(t, "16", totals[0].Total)
+
+	var execution models.JobExecution
+	require.NoError(t, db.First(&execution, "id = ?", "exec-1").Error)
+	assert.Equal(t, "COMPLETED", execution.Status)
+	assert.Equal(t, 100, execution.Progress)
+}
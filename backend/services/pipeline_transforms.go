@@ -0,0 +1,583 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// transformValidators checks the configuration of each supported transform
+// step type; a type missing here is rejected when the pipeline is saved
+var transformValidators = map[string]func(config map[string]interface{}) error{
+	"FILTER":      validateFilterStep,
+	"RENAME":      validateRenameStep,
+	"CAST":        validateCastStep,
+	"DEDUPLICATE": validateDeduplicateStep,
+	"AGGREGATE":   validateAggregateStep,
+	"JOIN":        validateJoinStep,
+	"UNION":       validateUnionStep,
+	"PIVOT":       validatePivotStep,
+	"UNPIVOT":     validateUnpivotStep,
+	"DERIVE":      validateDeriveStep,
+	"SQL":         validateSQLStep,
+}
+
+var filterOperators = map[string]bool{
+	"eq": true, "=": true, "==": true, "neq": true, "!=": true, "<>": true,
+	"contains": true, "not_contains": true, "starts_with": true,
+	"gt": true, ">": true, "gte": true, ">=": true, "lt": true, "<": true, "lte": true, "<=": true,
+	"is_null": true, "is_not_null": true,
+}
+
+// ParseTransformSteps decodes the transformation steps of a pipeline
+func ParseTransformSteps(raw *string) ([]models.TransformStep, error) {
+	if raw == nil || *raw == "" || *raw == "null" {
+		return nil, nil
+	}
+	var steps []models.TransformStep
+	if err := json.Unmarshal([]byte(*raw), &steps); err != nil {
+		return nil, fmt.Errorf("invalid transformation steps: %w", err)
+	}
+	return steps, nil
+}
+
+// ValidateTransformSteps checks that every step has a supported type and the
+// settings that type requires. SQL steps run in the destination after the
+// load, so they need ELT mode and an external destination, and must come
+// after every in-memory step.
+func ValidateTransformSteps(steps []models.TransformStep, mode string, destinationType string) error {
+	for i, step := range steps {
+		validate, ok := transformValidators[step.Type]
+		if !ok {
+			return fmt.Errorf("step %d: unknown transform type '%s'", i+1, step.Type)
+		}
+		if err := validate(step.Config); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step.Type, err)
+		}
+		if step.Type == "SQL" && mode != "ELT" {
+			return fmt.Errorf("step %d (SQL): SQL steps require ELT mode", i+1)
+		}
+		if step.Type == "SQL" {
+			if err := checkSQLStepDestination(destinationType); err != nil {
+				return fmt.Errorf("step %d (SQL): %w", i+1, err)
+			}
+		}
+	}
+
+	ordered := sortedTransformSteps(steps)
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i-1].Type == "SQL" && ordered[i].Type != "SQL" {
+			return fmt.Errorf("SQL steps must come after all other steps")
+		}
+	}
+	return nil
+}
+
+// sortedTransformSteps returns the steps in execution order
+func sortedTransformSteps(steps []models.TransformStep) []models.TransformStep {
+	ordered := append([]models.TransformStep(nil), steps...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Order < ordered[j].Order })
+	return ordered
+}
+
+// splitTransformSteps separates the steps applied in memory from the SQL
+// steps run in the destination, keeping execution order
+func splitTransformSteps(steps []models.TransformStep) (inMemory []models.TransformStep, sqlSteps []models.TransformStep) {
+	for _, step := range sortedTransformSteps(steps) {
+		if step.Type == "SQL" {
+			sqlSteps = append(sqlSteps, step)
+		} else {
+			inMemory = append(inMemory, step)
+		}
+	}
+	return inMemory, sqlSteps
+}
+
+// TransformStepInputs lists the second inputs of the JOIN and UNION steps, so
+// callers can check the connections and pipelines they read
+func TransformStepInputs(steps []models.TransformStep) []TransformInput {
+	var inputs []TransformInput
+	for _, step := range steps {
+		if step.Type != "JOIN" && step.Type != "UNION" {
+			continue
+		}
+		var config struct {
+			Input TransformInput `json:"input"`
+		}
+		if err := decodeStepConfig(step.Config, &config); err == nil {
+			inputs = append(inputs, config.Input)
+		}
+	}
+	return inputs
+}
+
+// decodeStepConfig decodes a step's config map into a typed config
+func decodeStepConfig(config map[string]interface{}, out interface{}) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("invalid step config: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid step config: %w", err)
+	}
+	return nil
+}
+
+func validateFilterStep(config map[string]interface{}) error {
+	column, _ := config["column"].(string)
+	operator, _ := config["operator"].(string)
+	if column == "" || operator == "" {
+		return fmt.Errorf("filter requires 'column' and 'operator'")
+	}
+	if !filterOperators[operator] {
+		return fmt.Errorf("unknown filter operator '%s'", operator)
+	}
+	return nil
+}
+
+func validateRenameStep(config map[string]interface{}) error {
+	if _, ok := config["mappings"].(map[string]interface{}); !ok {
+		return fmt.Errorf("rename requires 'mappings' object")
+	}
+	return nil
+}
+
+func validateCastStep(config map[string]interface{}) error {
+	if _, ok := config["casts"].(map[string]interface{}); !ok {
+		return fmt.Errorf("cast requires 'casts' object")
+	}
+	return nil
+}
+
+func validateDeduplicateStep(config map[string]interface{}) error {
+	var c TransformDeduplicateConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return err
+	}
+	switch strings.ToLower(c.SortOrder) {
+	case "", "asc", "desc":
+		return nil
+	}
+	return fmt.Errorf("sortOrder must be asc or desc")
+}
+
+func validateAggregateStep(config map[string]interface{}) error {
+	if groupBy, _ := config["groupBy"].([]interface{}); len(groupBy) == 0 {
+		return fmt.Errorf("aggregate requires 'groupBy' array")
+	}
+	return nil
+}
+
+func validateJoinStep(config map[string]interface{}) error {
+	var c TransformJoinConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return err
+	}
+	if c.LeftKey == "" || c.RightKey == "" {
+		return fmt.Errorf("join requires leftKey and rightKey")
+	}
+	switch strings.ToLower(c.JoinType) {
+	case "", "inner", "left", "right", "full":
+	default:
+		return fmt.Errorf("joinType must be inner, left, right or full")
+	}
+	return validateTransformInput(c.Input)
+}
+
+func validateUnionStep(config map[string]interface{}) error {
+	var c TransformUnionConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return err
+	}
+	return validateTransformInput(c.Input)
+}
+
+func validatePivotStep(config map[string]interface{}) error {
+	var c TransformPivotConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return err
+	}
+	if c.GroupBy == "" || c.PivotColumn == "" || c.ValueColumn == "" {
+		return fmt.Errorf("pivot requires groupBy, pivotColumn, and valueColumn")
+	}
+	switch strings.ToLower(c.AggFunc) {
+	case "", "sum", "avg", "average", "count", "min", "max", "first", "last":
+		return nil
+	}
+	return fmt.Errorf("unknown aggFunc '%s'", c.AggFunc)
+}
+
+func validateUnpivotStep(config map[string]interface{}) error {
+	var c TransformUnpivotConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return err
+	}
+	if len(c.ValueColumns) == 0 {
+		return fmt.Errorf("unpivot requires at least one valueColumn")
+	}
+	return nil
+}
+
+func validateDeriveStep(config map[string]interface{}) error {
+	var c TransformDeriveConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return err
+	}
+	if len(c.Columns) == 0 {
+		return fmt.Errorf("derive requires at least one column")
+	}
+	switch c.OnError {
+	case "", "fail", "null":
+	default:
+		return fmt.Errorf("onError must be fail or null")
+	}
+	engine := formula_engine.NewFormulaEngine()
+	for _, col := range c.Columns {
+		if strings.TrimSpace(col.Name) == "" {
+			return fmt.Errorf("derived column requires a name")
+		}
+		if err := engine.Validate(col.Formula); err != nil {
+			return fmt.Errorf("column '%s': %w", col.Name, err)
+		}
+	}
+	return nil
+}
+
+// sqlStepTarget matches the statements a SQL step may run: one write to the
+// pipeline's table
+var sqlStepTarget = regexp.MustCompile(`(?i)^\s*(INSERT\s+INTO|UPDATE|DELETE\s+FROM|MERGE\s+INTO)\s+\{\{\s*table\s*\}\}(\s|$)`)
+
+func validateSQLStep(config map[string]interface{}) error {
+	statement, _ := config["sql"].(string)
+	if strings.TrimSpace(statement) == "" {
+		return fmt.Errorf("sql step requires 'sql'")
+	}
+	if err := checkSingleStatement(statement); err != nil {
+		return err
+	}
+	if !sqlStepTarget.MatchString(statement) {
+		return fmt.Errorf("sql step must be an INSERT INTO, UPDATE, DELETE FROM or MERGE INTO {{table}}")
+	}
+	_, err := renderSQLStep(statement, sqlStepVars{})
+	return err
+}
+
+// checkSingleStatement rejects SQL holding more than one statement or
+// comments, outside quoted literals and identifiers. A trailing semicolon is
+// allowed.
+func checkSingleStatement(statement string) error {
+	statement = strings.TrimSuffix(strings.TrimSpace(statement), ";")
+	var quote rune
+	prev := rune(0)
+	for _, r := range statement {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == ';':
+			return fmt.Errorf("sql step must be a single statement")
+		case (r == '-' && prev == '-') || (r == '*' && prev == '/'):
+			return fmt.Errorf("sql step must not contain comments")
+		}
+		prev = r
+	}
+	if quote != 0 {
+		return fmt.Errorf("sql step has an unterminated quote")
+	}
+	return nil
+}
+
+func validateTransformInput(input TransformInput) error {
+	switch {
+	case input.PipelineID != "" && input.ConnectionID != "":
+		return fmt.Errorf("input takes either pipelineId or connectionId, not both")
+	case input.PipelineID != "":
+		return nil
+	case input.ConnectionID != "":
+		if strings.TrimSpace(input.Query) == "" {
+			return fmt.Errorf("input requires a query for connectionId")
+		}
+		return nil
+	}
+	return fmt.Errorf("input requires pipelineId or connectionId")
+}
+
+// transformJoin joins the data with the step's second input
+func (pe *PipelineExecutor) transformJoin(ctx context.Context, pipeline *models.Pipeline, data []map[string]interface{}, config map[string]interface{}) ([]map[string]interface{}, error) {
+	var c TransformJoinConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return data, err
+	}
+	right, err := pe.loadTransformInput(ctx, pipeline, c.Input)
+	if err != nil {
+		return data, err
+	}
+	return TransformJoin(data, right, c)
+}
+
+// transformUnion appends the rows of the step's second input to the data
+func (pe *PipelineExecutor) transformUnion(ctx context.Context, pipeline *models.Pipeline, data []map[string]interface{}, config map[string]interface{}) ([]map[string]interface{}, error) {
+	var c TransformUnionConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return data, err
+	}
+	bottom, err := pe.loadTransformInput(ctx, pipeline, c.Input)
+	if err != nil {
+		return data, err
+	}
+	return TransformUnion(data, bottom, c), nil
+}
+
+// loadTransformInput reads the second input of a JOIN or UNION step, bounded
+// by the pipeline's row limit
+func (pe *PipelineExecutor) loadTransformInput(ctx context.Context, pipeline *models.Pipeline, input TransformInput) ([]map[string]interface{}, error) {
+	if err := validateTransformInput(input); err != nil {
+		return nil, err
+	}
+	limit := pipelineRowLimit(pipeline)
+
+	if input.ConnectionID != "" {
+		rows, _, _, err := pe.queryConnection(ctx, input.ConnectionID, input.Query, limit)
+		if err != nil {
+			return nil, fmt.Errorf("input query failed: %w", err)
+		}
+		return rows, nil
+	}
+
+	if input.PipelineID == pipeline.ID {
+		return nil, fmt.Errorf("a pipeline cannot read its own output")
+	}
+	var upstream models.Pipeline
+	if err := database.DB.First(&upstream, "id = ? AND workspace_id = ?", input.PipelineID, pipeline.WorkspaceID).Error; err != nil {
+		return nil, fmt.Errorf("input pipeline not found: %w", err)
+	}
+	rows, err := pe.readPipelineOutput(ctx, &upstream, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output of pipeline '%s': %w", upstream.Name, err)
+	}
+	return rows, nil
+}
+
+// readPipelineOutput reads the table a pipeline loads into
+func (pe *PipelineExecutor) readPipelineOutput(ctx context.Context, pipeline *models.Pipeline, limit int) ([]map[string]interface{}, error) {
+	switch pipeline.DestinationType {
+	case "INTERNAL_RAW":
+		sqlDB, err := database.DB.DB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get underlying DB: %w", err)
+		}
+		query := fmt.Sprintf(`SELECT * FROM "%s"`, internalRawTableName(pipeline))
+		if limit > 0 {
+			query += fmt.Sprintf(" LIMIT %d", limit)
+		}
+		rows, _, _, err := pe.executeQuery(ctx, sqlDB, query)
+		return rows, err
+
+	case "POSTGRES", "MYSQL":
+		var destConf models.DestConfig
+		if pipeline.DestinationConfig != nil {
+			if err := json.Unmarshal([]byte(*pipeline.DestinationConfig), &destConf); err != nil {
+				return nil, fmt.Errorf("invalid destination config: %w", err)
+			}
+		}
+		if destConf.ConnectionID == "" {
+			return nil, fmt.Errorf("destination has no connection")
+		}
+		table := strings.ReplaceAll(externalTableName(pipeline, &destConf), `"`, "")
+		query := fmt.Sprintf(`SELECT * FROM "%s"`, table)
+		if pipeline.DestinationType == "MYSQL" {
+			query = fmt.Sprintf("SELECT * FROM `%s`", strings.ReplaceAll(table, "`", ""))
+		}
+		rows, _, _, err := pe.queryConnection(ctx, destConf.ConnectionID, query, limit)
+		return rows, err
+
+	default:
+		return nil, fmt.Errorf("unsupported destination type: %s", pipeline.DestinationType)
+	}
+}
+
+// TransformDeriveConfig configures a DERIVE step: formula_engine expressions
+// evaluated per row into new or replaced columns
+type TransformDeriveConfig struct {
+	Columns []DerivedColumn `json:"columns"`
+	OnError string          `json:"onError,omitempty"` // fail (default) or null
+}
+
+// DerivedColumn is a column computed by a formula; later columns of the same
+// step can reference earlier ones
+type DerivedColumn struct {
+	Name    string `json:"name"`
+	Formula string `json:"formula"`
+}
+
+// transformDerive evaluates the step's formulas with the workspace's formula
+// functions. Table calculations see the whole dataset in its current order.
+func (pe *PipelineExecutor) transformDerive(pipeline *models.Pipeline, data []map[string]interface{}, config map[string]interface{}) ([]map[string]interface{}, error) {
+	var c TransformDeriveConfig
+	if err := decodeStepConfig(config, &c); err != nil {
+		return data, err
+	}
+	engine := pe.formulaEngineFor(pipeline.WorkspaceID)
+
+	for _, col := range c.Columns {
+		compiled, err := engine.Compile(col.Formula)
+		if err != nil {
+			return data, fmt.Errorf("column '%s': %w", col.Name, err)
+		}
+		values := compiled.EvaluateTable(data, formula_engine.WindowSpec{})
+		for i, row := range data {
+			if fe, ok := values[i].(*formula_engine.FormulaError); ok {
+				if c.OnError != "null" {
+					return data, fmt.Errorf("column '%s', row %d: %s", col.Name, i+1, fe.Error())
+				}
+				values[i] = nil
+			}
+			row[col.Name] = values[i]
+		}
+	}
+	return data, nil
+}
+
+// streamTransform chains a transformation step onto a stream. Row-wise steps
+// transform each batch as it passes. Steps that need all rows (AGGREGATE,
+// DEDUPLICATE, PIVOT, distinct unions, right and full joins, table
+// calculations) buffer their input and spill it to disk, partitioned by their
+// grouping key where they have one.
+func (pe *PipelineExecutor) streamTransform(ctx context.Context, pipeline *models.Pipeline, in rowStream, step *models.TransformStep) (rowStream, error) {
+	perBatch := func() rowStream {
+		return &mapStream{in: in, apply: func(ctx context.Context, batch []map[string]interface{}) ([]map[string]interface{}, error) {
+			return pe.applyTransform(ctx, pipeline, batch, step)
+		}}
+	}
+	whole := func(rows []map[string]interface{}) ([]map[string]interface{}, error) {
+		return pe.applyTransform(ctx, pipeline, rows, step)
+	}
+
+	switch step.Type {
+	case "FILTER", "RENAME", "CAST", "UNPIVOT":
+		return perBatch(), nil
+
+	case "DERIVE":
+		var c TransformDeriveConfig
+		if err := decodeStepConfig(step.Config, &c); err != nil {
+			return nil, err
+		}
+		engine := pe.formulaEngineFor(pipeline.WorkspaceID)
+		for _, col := range c.Columns {
+			if table, err := engine.IsTableCalculation(col.Formula); err != nil {
+				return nil, fmt.Errorf("column '%s': %w", col.Name, err)
+			} else if table {
+				return &blockingStream{in: in, finish: whole}, nil
+			}
+		}
+		return perBatch(), nil
+
+	case "JOIN":
+		var c TransformJoinConfig
+		if err := decodeStepConfig(step.Config, &c); err != nil {
+			return nil, err
+		}
+		right, err := pe.loadTransformInput(ctx, pipeline, c.Input)
+		if err != nil {
+			return nil, err
+		}
+		join := func(rows []map[string]interface{}) ([]map[string]interface{}, error) {
+			return TransformJoin(rows, right, c)
+		}
+		// Unmatched right rows are only known once every left row was seen
+		switch strings.ToLower(c.JoinType) {
+		case "right", "full":
+			return &blockingStream{in: in, finish: join}, nil
+		}
+		return &mapStream{in: in, apply: func(_ context.Context, batch []map[string]interface{}) ([]map[string]interface{}, error) {
+			return join(batch)
+		}}, nil
+
+	case "UNION":
+		var c TransformUnionConfig
+		if err := decodeStepConfig(step.Config, &c); err != nil {
+			return nil, err
+		}
+		var out rowStream = &concatStream{first: in, open: func(ctx context.Context) (rowStream, error) {
+			rows, err := pe.loadTransformInput(ctx, pipeline, c.Input)
+			if err != nil {
+				return nil, err
+			}
+			return &sliceStream{rows: rows}, nil
+		}}
+		if c.Distinct {
+			out = &blockingStream{
+				in:  out,
+				key: func(row map[string]interface{}) string { return buildRowKey(row, nil) },
+				finish: func(rows []map[string]interface{}) ([]map[string]interface{}, error) {
+					return deduplicateRows(rows, nil), nil
+				},
+			}
+		}
+		return out, nil
+
+	case "AGGREGATE":
+		var c struct {
+			GroupBy []string `json:"groupBy"`
+		}
+		if err := decodeStepConfig(step.Config, &c); err != nil {
+			return nil, err
+		}
+		return &blockingStream{in: in, key: columnsKey(c.GroupBy), finish: whole}, nil
+
+	case "DEDUPLICATE":
+		var c TransformDeduplicateConfig
+		if err := decodeStepConfig(step.Config, &c); err != nil {
+			return nil, err
+		}
+		return &blockingStream{in: in, key: columnsKey(c.Columns), finish: whole}, nil
+
+	case "PIVOT":
+		var c TransformPivotConfig
+		if err := decodeStepConfig(step.Config, &c); err != nil {
+			return nil, err
+		}
+		// Every output row carries every pivot value seen, not just those of
+		// its partition
+		pivotValues := make(map[string]bool)
+		return &blockingStream{
+			in:      in,
+			key:     columnsKey([]string{c.GroupBy}),
+			observe: func(row map[string]interface{}) { pivotValues[fmt.Sprintf("%v", row[c.PivotColumn])] = true },
+			finish: func(rows []map[string]interface{}) ([]map[string]interface{}, error) {
+				out, err := TransformPivot(rows, c)
+				if err != nil {
+					return nil, err
+				}
+				for _, row := range out {
+					for pv := range pivotValues {
+						if _, ok := row[pv]; !ok {
+							row[pv] = 0.0
+						}
+					}
+				}
+				return out, nil
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown transform type: %s", step.Type)
+	}
+}
+
+// columnsKey returns the partition key of rows on the given columns, all
+// columns when none are given
+func columnsKey(columns []string) func(row map[string]interface{}) string {
+	return func(row map[string]interface{}) string {
+		return buildRowKey(row, columns)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateTransformSteps(t *testing.T) {
+	valid := []models.TransformStep{
+		{Type: "FILTER", Config: map[string]interface{}{"column": "a", "operator": "eq", "value": 1}},
+		{Type: "JOIN", Config: map[string]interface{}{"leftKey": "id", "rightKey": "id", "input": map[string]interface{}{"pipelineId": "p2"}}},
+		{Type: "UNION", Config: map[string]interface{}{"input": map[string]interface{}{"connectionId": "c1", "query": "SELECT 1"}}},
+		{Type: "PIVOT", Config: map[string]interface{}{"groupBy": "region", "pivotColumn": "month", "valueColumn": "sales"}},
+		{Type: "UNPIVOT", Config: map[string]interface{}{"valueColumns": []interface{}{"q1", "q2"}}},
+		{Type: "DERIVE", Config: map[string]interface{}{"columns": []interface{}{map[string]interface{}{"name": "total", "formula": "[q1] + [q2]"}}}},
+		{Type: "SQL", Order: 1, Config: map[string]interface{}{"sql": "DELETE FROM {{table}} WHERE total < 0"}},
+	}
+	require.NoError(t, ValidateTransformSteps(valid, "ELT", "POSTGRES"))
+	assert.ErrorContains(t, ValidateTransformSteps(valid, "ETL", "POSTGRES"), "require ELT mode")
+	assert.ErrorContains(t, ValidateTransformSteps(valid, "ELT", "INTERNAL_RAW"), "require an external destination")
+	valid[0].Order = 2
+	assert.ErrorContains(t, ValidateTransformSteps(valid, "ELT", "POSTGRES"), "after all other steps")
+	assert.Equal(t, []TransformInput{{PipelineID: "p2"}, {ConnectionID: "c1", Query: "SELECT 1"}}, TransformStepInputs(valid))
+
+	cases := map[string]models.TransformStep{
+		"unknown transform type": {Type: "EXPLODE"},
+		"input requires":         {Type: "UNION", Config: map[string]interface{}{}},
+		"not both":               {Type: "JOIN", Config: map[string]interface{}{"leftKey": "id", "rightKey": "id", "input": map[string]interface{}{"pipelineId": "p", "connectionId": "c", "query": "SELECT 1"}}},
+		"joinType":               {Type: "JOIN", Config: map[string]interface{}{"leftKey": "id", "rightKey": "id", "joinType": "cross", "input": map[string]interface{}{"pipelineId": "p"}}},
+		"valueColumn":            {Type: "UNPIVOT", Config: map[string]interface{}{"valueColumns": []interface{}{}}},
+		"filter operator":        {Type: "FILTER", Config: map[string]interface{}{"column": "a", "operator": "like"}},
+		"derived column":         {Type: "DERIVE", Config: map[string]interface{}{"columns": []interface{}{map[string]interface{}{"formula": "1"}}}},
+		"column 'x'":             {Type: "DERIVE", Config: map[string]interface{}{"columns": []interface{}{map[string]interface{}{"name": "x", "formula": "1 +"}}}},
+		"unknown placeholder":    {Type: "SQL", Config: map[string]interface{}{"sql": "DELETE FROM {{table}} WHERE run = {{run}}"}},
+		"single statement":       {Type: "SQL", Config: map[string]interface{}{"sql": "DELETE FROM {{table}}; DROP TABLE users"}},
+		"comments":               {Type: "SQL", Config: map[string]interface{}{"sql": "DELETE FROM {{table}} --"}},
+		"must be an INSERT INTO": {Type: "SQL", Config: map[string]interface{}{"sql": "UPDATE users SET role = 'ADMIN'"}},
+		"be an INSERT INTO":      {Type: "SQL", Config: map[string]interface{}{"sql": "WITH d AS (DELETE FROM users RETURNING 1) INSERT INTO {{table}} SELECT * FROM d"}},
+	}
+	for want, step := range cases {
+		err := ValidateTransformSteps([]models.TransformStep{step}, "ELT", "POSTGRES")
+		require.Error(t, err, want)
+		assert.Contains(t, err.Error(), want)
+	}
+	assert.NoError(t, validateSQLStep(map[string]interface{}{"sql": "UPDATE {{ table }} SET note = 'a; -- b';"}))
+}
+
+func TestApplyTransform_PivotUnpivotDeduplicate(t *testing.T) {
+	pe := NewPipelineExecutor()
+	ctx := context.Background()
+	data := []map[string]interface{}{
+		{"region": "EU", "month": "jan", "sales": 10.0},
+		{"region": "EU", "month": "feb", "sales": 5.0},
+		{"region": "US", "month": "jan", "sales": 7.0},
+		{"region": "US", "month": "jan", "sales": 3.0},
+	}
+
+	pivoted, err := pe.applyTransform(ctx, &models.Pipeline{}, data, &models.TransformStep{Type: "PIVOT", Config: map[string]interface{}{
+		"groupBy": "region", "pivotColumn": "month", "valueColumn": "sales", "aggFunc": "sum",
+	}})
+	require.NoError(t, err)
+	require.Len(t, pivoted, 2)
+	assert.Equal(t, 10.0, pivoted[1]["jan"])
+
+	unpivoted, err := pe.applyTransform(ctx, &models.Pipeline{}, pivoted, &models.TransformStep{Type: "UNPIVOT", Config: map[string]interface{}{
+		"idColumns": []interface{}{"region"}, "valueColumns": []interface{}{"jan"}, "varName": "month", "valName": "sales",
+	}})
+	require.NoError(t, err)
+	assert.Len(t, unpivoted, 2)
+
+	last, err := pe.applyTransform(ctx, &models.Pipeline{}, data, &models.TransformStep{Type: "DEDUPLICATE", Config: map[string]interface{}{
+		"columns": []interface{}{"region"}, "keepFirst": false,
+	}})
+	require.NoError(t, err)
+	require.Len(t, last, 2)
+	assert.Equal(t, "feb", last[0]["month"])
+	assert.Equal(t, 3.0, last[1]["sales"])
+
+	_, err = pe.applyTransform(ctx, &models.Pipeline{}, data, &models.TransformStep{Type: "EXPLODE"})
+	assert.Error(t, err, "unknown step types fail instead of being skipped")
+}
+
+func TestApplyTransform_JoinAndUnionWithPipelineOutput(t *testing.T) {
+	db := setupTestDB(t, &models.Pipeline{})
+
+	upstream := models.Pipeline{ID: "regions", Name: "Regions", WorkspaceID: "ws", SourceType: "CSV", SourceConfig: "{}", DestinationType: "INTERNAL_RAW"}
+	require.NoError(t, db.Create(&upstream).Error)
+	require.NoError(t, db.Exec(`CREATE TABLE "pipeline_data_regions" (code TEXT, name TEXT)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO "pipeline_data_regions" VALUES ('EU', 'Europe'), ('US', 'United States')`).Error)
+
+	pe := NewPipelineExecutor()
+	ctx := context.Background()
+	pipeline := &models.Pipeline{ID: "orders", WorkspaceID: "ws", RowLimit: 100}
+	data := []map[string]interface{}{{"id": 1, "region": "EU"}, {"id": 2, "region": "APAC"}}
+
+	joined, err := pe.applyTransform(ctx, pipeline, data, &models.TransformStep{Type: "JOIN", Config: map[string]interface{}{
+		"joinType": "left", "leftKey": "region", "rightKey": "code", "prefix": "r_", "input": map[string]interface{}{"pipelineId": "regions"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, joined, 2)
+	assert.Equal(t, "Europe", joined[0]["r_name"])
+	assert.Nil(t, joined[1]["r_name"])
+
+	unioned, err := pe.applyTransform(ctx, pipeline, data, &models.TransformStep{Type: "UNION", Config: map[string]interface{}{
+		"input": map[string]interface{}{"pipelineId": "regions"},
+	}})
+	require.NoError(t, err)
+	assert.Len(t, unioned, 4)
+
+	_, err = pe.applyTransform(ctx, &models.Pipeline{ID: "orders", WorkspaceID: "other"}, data, &models.TransformStep{Type: "UNION", Config: map[string]interface{}{
+		"input": map[string]interface{}{"pipelineId": "regions"},
+	}})
+	assert.Error(t, err, "pipelines of other workspaces are not readable")
+}
@@ -0,0 +1,459 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"insight-engine-backend/database"
+	"insight-engine-backend/models"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Trigger types of a pipeline execution
+const (
+	PipelineTriggerManual     = "MANUAL"
+	PipelineTriggerDependency = "DEPENDENCY"
+	PipelineTriggerWebhook    = "WEBHOOK"
+	PipelineTriggerFile       = "FILE"
+)
+
+// Upstream types a pipeline can depend on
+const (
+	UpstreamPipeline         = "PIPELINE"
+	UpstreamDataflow         = "DATAFLOW"
+	UpstreamMaterializedView = "MATERIALIZED_VIEW"
+)
+
+// pipelineWebhookTolerance is how far the timestamp of a signed trigger
+// request may be from now, which bounds replays
+const pipelineWebhookTolerance = 5 * time.Minute
+
+// pipelineTriggerMu serializes the decisions to trigger, so two upstreams
+// finishing together trigger their common downstream once
+var pipelineTriggerMu sync.Mutex
+
+// EnqueuePipelineRun records a PENDING execution of a pipeline and queues it
+func EnqueuePipelineRun(pipelineID string, triggerType string, chain []models.TriggerLink) (*models.JobExecution, error) {
+	if GlobalJobQueue == nil {
+		return nil, fmt.Errorf("job queue not initialized")
+	}
+
+	execution := models.JobExecution{
+		ID:          uuid.New().String(),
+		PipelineID:  pipelineID,
+		Status:      "PENDING",
+		StartedAt:   time.Now(),
+		TriggerType: triggerType,
+	}
+	if len(chain) > 0 {
+		data, _ := json.Marshal(chain)
+		s := string(data)
+		execution.TriggerChain = &s
+	}
+	if err := database.DB.Create(&execution).Error; err != nil {
+		return nil, err
+	}
+
+	GlobalJobQueue.Enqueue(Job{
+		ID:        execution.ID,
+		Type:      JobTypePipeline,
+		EntityID:  pipelineID,
+		CreatedAt: time.Now(),
+	})
+	return &execution, nil
+}
+
+// PipelineUpstreamSucceeded triggers the pipelines depending on an upstream
+// that just succeeded, once all of their upstreams have succeeded since their
+// last run. runID is the upstream's execution or run, empty for views.
+func PipelineUpstreamSucceeded(upstreamType string, upstreamID string, runID string) {
+	var deps []models.PipelineDependency
+	if err := database.DB.Where("upstream_type = ? AND upstream_id = ?", upstreamType, upstreamID).Find(&deps).Error; err != nil {
+		LogWarn("pipeline_trigger", "Failed to look up dependent pipelines", map[string]interface{}{"upstream_id": upstreamID, "error": err.Error()})
+		return
+	}
+	if len(deps) == 0 {
+		return
+	}
+
+	// The chain that led to the upstream run, extended by the run itself
+	var chain []models.TriggerLink
+	if upstreamType == UpstreamPipeline && runID != "" {
+		var upstream models.JobExecution
+		if err := database.DB.First(&upstream, "id = ?", runID).Error; err == nil && upstream.TriggerChain != nil {
+			_ = json.Unmarshal([]byte(*upstream.TriggerChain), &chain)
+		}
+	}
+	chain = append(chain, models.TriggerLink{Type: upstreamType, ID: upstreamID, RunID: runID})
+
+	pipelineTriggerMu.Lock()
+	defer pipelineTriggerMu.Unlock()
+
+	for _, dep := range deps {
+		ready, err := pipelineDependenciesMet(dep.PipelineID)
+		if err != nil {
+			LogWarn("pipeline_trigger", "Failed to check pipeline dependencies", map[string]interface{}{"pipeline_id": dep.PipelineID, "error": err.Error()})
+			continue
+		}
+		if !ready {
+			continue
+		}
+		execution, err := EnqueuePipelineRun(dep.PipelineID, PipelineTriggerDependency, chain)
+		if err != nil {
+			LogWarn("pipeline_trigger", "Failed to trigger dependent pipeline", map[string]interface{}{"pipeline_id": dep.PipelineID, "error": err.Error()})
+			continue
+		}
+		LogInfo("pipeline_trigger", "Dependent pipeline triggered", map[string]interface{}{
+			"pipeline_id":   dep.PipelineID,
+			"execution_id":  execution.ID,
+			"upstream_type": upstreamType,
+			"upstream_id":   upstreamID,
+		})
+	}
+}
+
+// pipelineDependenciesMet reports whether an active pipeline with no run
+// waiting has seen every upstream succeed since its last run started
+func pipelineDependenciesMet(pipelineID string) (bool, error) {
+	var pipeline models.Pipeline
+	if err := database.DB.Preload("Dependencies").First(&pipeline, "id = ?", pipelineID).Error; err != nil {
+		return false, err
+	}
+	if !pipeline.IsActive {
+		return false, nil
+	}
+	since, pending, err := lastPipelineRun(pipelineID)
+	if err != nil || pending {
+		return false, err
+	}
+
+	for _, dep := range pipeline.Dependencies {
+		succeeded, err := upstreamLastSuccess(dep.UpstreamType, dep.UpstreamID)
+		if err != nil {
+			return false, err
+		}
+		if succeeded == nil || (since != nil && !succeeded.After(*since)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lastPipelineRun returns when the latest run of a pipeline started, and
+// whether a run is waiting in the queue
+func lastPipelineRun(pipelineID string) (*time.Time, bool, error) {
+	var last models.JobExecution
+	err := database.DB.Where("\"pipelineId\" = ?", pipelineID).Order("started_at DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, false, err
+	}
+	if last.ID == "" {
+		return nil, false, nil
+	}
+	return &last.StartedAt, last.Status == "PENDING", nil
+}
+
+// upstreamLastSuccess returns when an upstream last succeeded, nil if never
+func upstreamLastSuccess(upstreamType string, upstreamID string) (*time.Time, error) {
+	switch upstreamType {
+	case UpstreamPipeline:
+		var execution models.JobExecution
+		err := database.DB.Where("\"pipelineId\" = ? AND status = ?", upstreamID, "COMPLETED").
+			Order("completed_at DESC").Limit(1).Find(&execution).Error
+		return execution.CompletedAt, err
+	case UpstreamDataflow:
+		var run models.DataflowRun
+		err := database.DB.Where("\"dataflowId\" = ? AND status = ?", upstreamID, "COMPLETED").
+			Order("\"completedAt\" DESC").Limit(1).Find(&run).Error
+		return run.CompletedAt, err
+	case UpstreamMaterializedView:
+		var mv models.MaterializedView
+		err := database.DB.Where("id = ?", upstreamID).Limit(1).Find(&mv).Error
+		return mv.LastRefresh, err
+	default:
+		return nil, fmt.Errorf("unknown upstream type: %s", upstreamType)
+	}
+}
+
+// ValidatePipelineDependencies checks the upstreams of a pipeline. Upstream
+// pipelines must be in the pipeline's workspace, dataflows and views must be
+// the user's, and pipeline dependencies must not form a cycle.
+func ValidatePipelineDependencies(pipelineID string, workspaceID string, userID string, deps []models.PipelineDependency) error {
+	seen := make(map[string]bool)
+	var upstreamPipelines []string
+	for i := range deps {
+		dep := &deps[i]
+		dep.UpstreamType = strings.ToUpper(dep.UpstreamType)
+		key := dep.UpstreamType + ":" + dep.UpstreamID
+		if dep.UpstreamID == "" {
+			return fmt.Errorf("dependency %d: upstreamId is required", i+1)
+		}
+		if seen[key] {
+			return fmt.Errorf("dependency %d: %s %s is listed twice", i+1, dep.UpstreamType, dep.UpstreamID)
+		}
+		seen[key] = true
+
+		var count int64
+		switch dep.UpstreamType {
+		case UpstreamPipeline:
+			if dep.UpstreamID == pipelineID {
+				return fmt.Errorf("a pipeline cannot depend on itself")
+			}
+			database.DB.Model(&models.Pipeline{}).Where("id = ? AND workspace_id = ?", dep.UpstreamID, workspaceID).Count(&count)
+			upstreamPipelines = append(upstreamPipelines, dep.UpstreamID)
+		case UpstreamDataflow:
+			database.DB.Model(&models.Dataflow{}).Where("id = ? AND \"userId\" = ?", dep.UpstreamID, userID).Count(&count)
+		case UpstreamMaterializedView:
+			database.DB.Model(&models.MaterializedView{}).Where("id = ? AND user_id = ?", dep.UpstreamID, userID).Count(&count)
+		default:
+			return fmt.Errorf("dependency %d: upstreamType must be PIPELINE, DATAFLOW or MATERIALIZED_VIEW", i+1)
+		}
+		if count == 0 {
+			return fmt.Errorf("dependency %d: %s %s not found", i+1, strings.ToLower(dep.UpstreamType), dep.UpstreamID)
+		}
+	}
+
+	if path, err := pipelineDependencyPath(upstreamPipelines, pipelineID); err != nil {
+		return err
+	} else if path != nil {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(append([]string{pipelineID}, path...), " -> "))
+	}
+	return nil
+}
+
+// SetPipelineDependencies validates and replaces the upstreams of a pipeline
+func SetPipelineDependencies(pipelineID string, workspaceID string, userID string, deps []models.PipelineDependency) error {
+	if err := ValidatePipelineDependencies(pipelineID, workspaceID, userID, deps); err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("\"pipelineId\" = ?", pipelineID).Delete(&models.PipelineDependency{}).Error; err != nil {
+			return err
+		}
+		for i := range deps {
+			deps[i].ID = uuid.New().String()
+			deps[i].PipelineID = pipelineID
+			deps[i].CreatedAt = time.Now()
+		}
+		if len(deps) == 0 {
+			return nil
+		}
+		return tx.Create(&deps).Error
+	})
+}
+
+// pipelineDependencyPath searches the pipeline dependency graph from the
+// given upstreams for target, returning the path of pipeline IDs that reach
+// it (ending with target), nil if none does
+func pipelineDependencyPath(from []string, target string) ([]string, error) {
+	visited := make(map[string]bool)
+	var visit func(id string) ([]string, error)
+	visit = func(id string) ([]string, error) {
+		if id == target {
+			return []string{id}, nil
+		}
+		if visited[id] {
+			return nil, nil
+		}
+		visited[id] = true
+
+		var upstreams []string
+		if err := database.DB.Model(&models.PipelineDependency{}).
+			Where("\"pipelineId\" = ? AND upstream_type = ?", id, UpstreamPipeline).
+			Pluck("upstream_id", &upstreams).Error; err != nil {
+			return nil, err
+		}
+		for _, upstream := range upstreams {
+			path, err := visit(upstream)
+			if err != nil || path != nil {
+				if path != nil {
+					path = append([]string{id}, path...)
+				}
+				return path, err
+			}
+		}
+		return nil, nil
+	}
+
+	for _, id := range from {
+		if path, err := visit(id); err != nil || path != nil {
+			return path, err
+		}
+	}
+	return nil, nil
+}
+
+// ValidatePipelineWatch checks a watched directory, which must be inside the
+// pipeline files directory, and its file name pattern
+func ValidatePipelineWatch(path string, pattern string) error {
+	if _, err := resolvePipelineFile(path); err != nil {
+		return err
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid watch pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// RotatePipelineWebhookSecret enables the trigger webhook of a pipeline with
+// a new secret and returns it
+func RotatePipelineWebhookSecret(pipelineID string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(raw)
+	if err := database.DB.Model(&models.Pipeline{}).Where("id = ?", pipelineID).Update("webhook_secret", secret).Error; err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// VerifyPipelineWebhook checks the signature of a trigger request: the hex
+// HMAC-SHA256, under the pipeline's secret, of "<timestamp>.<body>", where
+// timestamp is in Unix seconds and must be recent
+func VerifyPipelineWebhook(secret string, timestamp string, body []byte, signature string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or invalid timestamp")
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > pipelineWebhookTolerance || skew < -pipelineWebhookTolerance {
+		return fmt.Errorf("timestamp outside the allowed window")
+	}
+	expected := computeHMAC(append([]byte(timestamp+"."), body...), secret)
+	signature = strings.TrimPrefix(signature, "sha256=")
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// PipelineFileWatcher triggers pipelines when files land in their watched
+// directory. A file counts once it is older than the settle time, so files
+// still being written are not picked up, and triggers a run when it is newer
+// than the pipeline's last run.
+type PipelineFileWatcher struct {
+	interval time.Duration
+	settle   time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewPipelineFileWatcher creates a watcher polling every interval
+func NewPipelineFileWatcher(interval time.Duration) *PipelineFileWatcher {
+	return &PipelineFileWatcher{interval: interval, settle: 5 * time.Second, stop: make(chan struct{})}
+}
+
+// Start polls the watched directories until Stop is called
+func (w *PipelineFileWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.Scan(time.Now())
+			}
+		}
+	}()
+}
+
+// Stop ends polling
+func (w *PipelineFileWatcher) Stop() {
+	w.once.Do(func() { close(w.stop) })
+}
+
+// Scan checks every watched directory once
+func (w *PipelineFileWatcher) Scan(now time.Time) {
+	var pipelines []models.Pipeline
+	if err := database.DB.Where("watch_path IS NOT NULL AND watch_path <> '' AND is_active = ?", true).Find(&pipelines).Error; err != nil {
+		LogWarn("pipeline_file_watch", "Failed to list watched pipelines", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	pipelineTriggerMu.Lock()
+	defer pipelineTriggerMu.Unlock()
+
+	for i := range pipelines {
+		pipeline := &pipelines[i]
+		file, err := w.landedFile(pipeline, now)
+		if err != nil {
+			LogWarn("pipeline_file_watch", "Failed to scan watched directory", map[string]interface{}{"pipeline_id": pipeline.ID, "error": err.Error()})
+			continue
+		}
+		if file == "" {
+			continue
+		}
+		execution, err := EnqueuePipelineRun(pipeline.ID, PipelineTriggerFile, []models.TriggerLink{{Type: PipelineTriggerFile, ID: file}})
+		if err != nil {
+			LogWarn("pipeline_file_watch", "Failed to trigger pipeline", map[string]interface{}{"pipeline_id": pipeline.ID, "error": err.Error()})
+			continue
+		}
+		LogInfo("pipeline_file_watch", "Pipeline triggered by landed file", map[string]interface{}{"pipeline_id": pipeline.ID, "execution_id": execution.ID, "file": file})
+	}
+}
+
+// landedFile returns the newest settled file of a pipeline's watched
+// directory that arrived after its last run, relative to the pipeline files
+// directory; empty when there is none or a run is already waiting
+func (w *PipelineFileWatcher) landedFile(pipeline *models.Pipeline, now time.Time) (string, error) {
+	dir, err := resolvePipelineFile(*pipeline.WatchPath)
+	if err != nil {
+		return "", err
+	}
+	since, pending, err := lastPipelineRun(pipeline.ID)
+	if err != nil || pending {
+		return "", err
+	}
+	if since == nil {
+		since = &pipeline.CreatedAt
+	}
+	pattern := ""
+	if pipeline.WatchPattern != nil {
+		pattern = *pipeline.WatchPattern
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var newest string
+	var newestAt time.Time
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, entry.Name()); !ok {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		modified := info.ModTime()
+		if !modified.After(*since) || now.Sub(modified) < w.settle {
+			continue
+		}
+		if newest == "" || modified.After(newestAt) {
+			newest, newestAt = entry.Name(), modified
+		}
+	}
+	if newest == "" {
+		return "", nil
+	}
+	return filepath.ToSlash(filepath.Join(*pipeline.WatchPath, newest)), nil
+}
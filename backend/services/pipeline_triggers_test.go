@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupTriggerTestDB adds the trigger tables to the pipeline test database
+// and gives the triggers a job queue that is not processing
+func setupTriggerTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := setupTestDB(t, &models.Pipeline{})
+	require.NoError(t, db.AutoMigrate(&models.PipelineDependency{}, &models.JobExecution{}, &models.DataflowRun{}))
+	previous := GlobalJobQueue
+	GlobalJobQueue = NewJobQueue(0)
+	t.Cleanup(func() { GlobalJobQueue = previous })
+	return db
+}
+
+func createTestPipelines(t *testing.T, db *gorm.DB, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		require.NoError(t, db.Create(&models.Pipeline{ID: id, Name: id, WorkspaceID: "ws", SourceType: "CSV", SourceConfig: "{}", IsActive: true}).Error)
+	}
+}
+
+func TestVerifyPipelineWebhook(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	body := []byte(`{"reason":"upstream"}`)
+	signature := computeHMAC(append([]byte(ts+"."), body...), "secret")
+
+	require.NoError(t, VerifyPipelineWebhook("secret", ts, body, "sha256="+signature, now))
+	assert.ErrorContains(t, VerifyPipelineWebhook("other", ts, body, signature, now), "invalid signature")
+	assert.ErrorContains(t, VerifyPipelineWebhook("secret", ts, []byte(`{}`), signature, now), "invalid signature")
+	assert.ErrorContains(t, VerifyPipelineWebhook("secret", ts, body, signature, now.Add(10*time.Minute)), "timestamp")
+	assert.ErrorContains(t, VerifyPipelineWebhook("secret", "", body, signature, now), "timestamp")
+}
+
+func TestSetPipelineDependencies_RejectsCycles(t *testing.T) {
+	db := setupTriggerTestDB(t)
+	createTestPipelines(t, db, "a", "b", "c")
+
+	require.NoError(t, SetPipelineDependencies("b", "ws", "u", []models.PipelineDependency{{UpstreamType: "pipeline", UpstreamID: "a"}}))
+	require.NoError(t, SetPipelineDependencies("c", "ws", "u", []models.PipelineDependency{{UpstreamType: "PIPELINE", UpstreamID: "b"}}))
+
+	err := SetPipelineDependencies("a", "ws", "u", []models.PipelineDependency{{UpstreamType: "PIPELINE", UpstreamID: "c"}})
+	assert.ErrorContains(t, err, "dependency cycle: a -> c -> b -> a")
+	assert.ErrorContains(t, SetPipelineDependencies("a", "ws", "u", []models.PipelineDependency{{UpstreamType: "PIPELINE", UpstreamID: "a"}}), "itself")
+	assert.ErrorContains(t, SetPipelineDependencies("a", "other", "u", []models.PipelineDependency{{UpstreamType: "PIPELINE", UpstreamID: "b"}}), "not found")
+	assert.ErrorContains(t, SetPipelineDependencies("a", "ws", "u", []models.PipelineDependency{{UpstreamType: "REPORT", UpstreamID: "b"}}), "upstreamType")
+
+	var count int64
+	db.Model(&models.PipelineDependency{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestPipelineUpstreamSucceeded_WaitsForAllUpstreams(t *testing.T) {
+	db := setupTriggerTestDB(t)
+	createTestPipelines(t, db, "orders", "customers", "report")
+	require.NoError(t, db.Create(&models.Dataflow{ID: "df", Name: "df", UserID: "u"}).Error)
+	require.NoError(t, SetPipelineDependencies("report", "ws", "u", []models.PipelineDependency{
+		{UpstreamType: "PIPELINE", UpstreamID: "orders"},
+		{UpstreamType: "DATAFLOW", UpstreamID: "df"},
+	}))
+
+	complete := func(id string, pipelineID string, chain *string) {
+		now := time.Now()
+		require.NoError(t, db.Create(&models.JobExecution{ID: id, PipelineID: pipelineID, Status: "COMPLETED", StartedAt: now, CompletedAt: &now, TriggerChain: chain}).Error)
+	}
+	reportRuns := func() []models.JobExecution {
+		var runs []models.JobExecution
+		require.NoError(t, db.Where("\"pipelineId\" = ?", "report").Find(&runs).Error)
+		return runs
+	}
+
+	upstreamChain := `[{"type":"WEBHOOK","id":"10.0.0.1"}]`
+	complete("o1", "orders", &upstreamChain)
+	PipelineUpstreamSucceeded(UpstreamPipeline, "orders", "o1")
+	assert.Empty(t, reportRuns(), "the dataflow has not succeeded yet")
+
+	finished := time.Now()
+	require.NoError(t, db.Create(&models.DataflowRun{ID: "r1", DataflowID: "df", Status: "COMPLETED", StartedAt: finished, CompletedAt: &finished}).Error)
+	PipelineUpstreamSucceeded(UpstreamDataflow, "df", "r1")
+	PipelineUpstreamSucceeded(UpstreamDataflow, "df", "r1")
+	runs := reportRuns()
+	require.Len(t, runs, 1, "a waiting run is not triggered twice")
+	assert.Equal(t, PipelineTriggerDependency, runs[0].TriggerType)
+	var chain []models.TriggerLink
+	require.NoError(t, json.Unmarshal([]byte(*runs[0].TriggerChain), &chain))
+	assert.Equal(t, []models.TriggerLink{{Type: "DATAFLOW", ID: "df", RunID: "r1"}}, chain)
+
+	// Once the triggered run has started, a new upstream success alone is not enough
+	db.Model(&models.JobExecution{}).Where("id = ?", runs[0].ID).Update("status", "COMPLETED")
+	time.Sleep(10 * time.Millisecond)
+	complete("o2", "orders", &upstreamChain)
+	PipelineUpstreamSucceeded(UpstreamPipeline, "orders", "o2")
+	assert.Len(t, reportRuns(), 1)
+
+	finished = time.Now()
+	require.NoError(t, db.Create(&models.DataflowRun{ID: "r2", DataflowID: "df", Status: "COMPLETED", StartedAt: finished, CompletedAt: &finished}).Error)
+	require.NoError(t, SetPipelineDependencies("report", "ws", "u", []models.PipelineDependency{{UpstreamType: "PIPELINE", UpstreamID: "orders"}}))
+	complete("o3", "orders", &upstreamChain)
+	PipelineUpstreamSucceeded(UpstreamPipeline, "orders", "o3")
+	runs = reportRuns()
+	require.Len(t, runs, 2)
+	for _, run := range runs {
+		if run.Status == "PENDING" {
+			chain = nil
+			require.NoError(t, json.Unmarshal([]byte(*run.TriggerChain), &chain))
+			assert.Equal(t, []models.TriggerLink{{Type: "WEBHOOK", ID: "10.0.0.1"}, {Type: "PIPELINE", ID: "orders", RunID: "o3"}}, chain, "the chain extends the upstream's")
+		}
+	}
+}
+
+func TestPipelineFileWatcher_TriggersOnSettledFiles(t *testing.T) {
+	db := setupTriggerTestDB(t)
+	t.Setenv("PIPELINE_FILES_DIR", t.TempDir())
+	require.NoError(t, os.Mkdir(filepath.Join(os.Getenv("PIPELINE_FILES_DIR"), "inbox"), 0o755))
+
+	watchPath, pattern := "inbox", "*.csv"
+	created := time.Now().Add(-time.Hour)
+	require.NoError(t, db.Create(&models.Pipeline{ID: "p", Name: "p", WorkspaceID: "ws", SourceType: "CSV", SourceConfig: "{}", IsActive: true, WatchPath: &watchPath, WatchPattern: &pattern, CreatedAt: created}).Error)
+
+	land := func(name string, at time.Time) {
+		path := filepath.Join(os.Getenv("PIPELINE_FILES_DIR"), "inbox", name)
+		require.NoError(t, os.WriteFile(path, []byte("id\n1\n"), 0o644))
+		require.NoError(t, os.Chtimes(path, at, at))
+	}
+	runs := func() []models.JobExecution {
+		var runs []models.JobExecution
+		require.NoError(t, db.Where("\"pipelineId\" = ?", "p").Find(&runs).Error)
+		return runs
+	}
+
+	watcher := NewPipelineFileWatcher(time.Minute)
+	now := time.Now()
+	land("notes.txt", now.Add(-time.Minute))
+	land("partial.csv", now)
+	watcher.Scan(now)
+	assert.Empty(t, runs(), "files not matching or still being written are ignored")
+
+	watcher.Scan(now.Add(time.Minute))
+	require.Len(t, runs(), 1)
+	assert.Equal(t, PipelineTriggerFile, runs()[0].TriggerType)
+	assert.Contains(t, *runs()[0].TriggerChain, "inbox/partial.csv")
+
+	watcher.Scan(now.Add(2 * time.Minute))
+	assert.Len(t, runs(), 1, "a waiting run is not triggered twice")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
 	"regexp"
 	"strings"
 )
@@ -16,6 +17,8 @@ type QueryBuilder struct {
 	rlsService        *RLSService
 	paginationService *PaginationService
 	queryQueue        *QueryQueueService
+	formulaEngine     *formula_engine.FormulaEngine
+	formulaFunctions  *FormulaFunctionService
 }
 
 // NewQueryBuilder creates a new query builder service
@@ -27,22 +30,57 @@ func NewQueryBuilder(validator *QueryValidator, schemaDiscovery *SchemaDiscovery
 		rlsService:        rlsService,
 		paginationService: paginationService,
 		queryQueue:        queryQueue,
+		formulaEngine:     formula_engine.NewFormulaEngine(),
 	}
 }
 
 // BuildSQL generates SQL from visual configuration
 // Updated to accept user context for RLS enforcement
 func (qb *QueryBuilder) BuildSQL(ctx context.Context, config *models.VisualQueryConfig, conn *models.Connection, userID string, workspaceID string, userRole *string) (string, []interface{}, error) {
+	sql, params, _, err := qb.buildSQL(ctx, config, conn, workspaceID)
+	return sql, params, err
+}
+
+// SetFormulaFunctionService lets calculated fields call the workspace's
+// user-defined formula functions
+func (qb *QueryBuilder) SetFormulaFunctionService(svc *FormulaFunctionService) {
+	qb.formulaFunctions = svc
+}
+
+// formulaEngineFor returns the formula engine for a workspace's calculated
+// fields, falling back to the built-in functions only
+func (qb *QueryBuilder) formulaEngineFor(workspaceID string) *formula_engine.FormulaEngine {
+	if qb.formulaFunctions == nil || workspaceID == "" {
+		return qb.formulaEngine
+	}
+	engine, err := qb.formulaFunctions.EngineFor(workspaceID)
+	if err != nil {
+		LogWarn("formula_functions", "Failed to load workspace formula functions", map[string]interface{}{"workspace_id": workspaceID, "error": err})
+		return qb.formulaEngine
+	}
+	return engine
+}
+
+// buildSQL generates SQL and the calculated field plan that says which
+// calculated fields were pushed down and which must be evaluated in memory
+func (qb *QueryBuilder) buildSQL(ctx context.Context, config *models.VisualQueryConfig, conn *models.Connection, workspaceID string) (string, []interface{}, *calculatedFieldPlan, error) {
+	engine := qb.formulaEngineFor(workspaceID)
+
 	// Validate configuration
-	if err := qb.ValidateConfig(ctx, config, conn); err != nil {
-		return "", nil, fmt.Errorf("invalid configuration: %w", err)
+	if err := qb.validateConfig(ctx, config, conn, engine); err != nil {
+		return "", nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	calc, err := qb.planCalculatedFields(engine, config, conn.Type)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	var sqlParts []string
 	var params []interface{}
 
 	// Build SELECT clause
-	selectClause := qb.buildSelectClause(config)
+	selectClause := qb.buildSelectClause(config, calc)
 	sqlParts = append(sqlParts, selectClause)
 
 	// Build FROM clause
@@ -56,21 +94,26 @@ func (qb *QueryBuilder) BuildSQL(ctx context.Context, config *models.VisualQuery
 	}
 
 	// Build WHERE clause
-	if len(config.Filters) > 0 {
-		whereClause, whereParams := qb.buildWhereClause(config)
+	if whereClause, whereParams := qb.buildWhereClause(config, calc); whereClause != "" {
 		sqlParts = append(sqlParts, whereClause)
 		params = append(params, whereParams...)
 	}
 
 	// Build GROUP BY clause
 	if len(config.GroupBy) > 0 {
-		groupByClause := qb.buildGroupByClause(config)
+		groupByClause := qb.buildGroupByClause(config, calc)
 		sqlParts = append(sqlParts, groupByClause)
 	}
 
+	// Build HAVING clause, numbering its parameters after WHERE's
+	if havingClause, havingParams := qb.buildHavingClause(config, calc, len(params)+1); havingClause != "" {
+		sqlParts = append(sqlParts, havingClause)
+		params = append(params, havingParams...)
+	}
+
 	// Build ORDER BY clause
 	if len(config.OrderBy) > 0 {
-		orderByClause := qb.buildOrderByClause(config)
+		orderByClause := qb.buildOrderByClause(config, calc)
 		sqlParts = append(sqlParts, orderByClause)
 	}
 
@@ -85,11 +128,17 @@ func (qb *QueryBuilder) BuildSQL(ctx context.Context, config *models.VisualQuery
 	// Note: RLS is now applied at query execution time via QueryExecutor
 	// to avoid tight coupling and provide cleaner separation of concerns
 
-	return sql, params, nil
+	return sql, params, calc, nil
 }
 
 // ValidateConfig validates visual configuration before SQL generation
 func (qb *QueryBuilder) ValidateConfig(ctx context.Context, config *models.VisualQueryConfig, conn *models.Connection) error {
+	return qb.validateConfig(ctx, config, conn, qb.formulaEngine)
+}
+
+// validateConfig validates a configuration, type-checking calculated fields
+// with the given engine so workspace formula functions resolve
+func (qb *QueryBuilder) validateConfig(ctx context.Context, config *models.VisualQueryConfig, conn *models.Connection, engine *formula_engine.FormulaEngine) error {
 	// Validate tables exist
 	if len(config.Tables) == 0 {
 		return fmt.Errorf("at least one table is required")
@@ -186,11 +235,33 @@ func (qb *QueryBuilder) ValidateConfig(ctx context.Context, config *models.Visua
 		}
 	}
 
+	// Validate calculated fields
+	fieldNames := make(map[string]bool)
+	for _, field := range config.CalculatedFields {
+		name := strings.ToLower(strings.TrimSpace(field.Name))
+		if name == "" {
+			return fmt.Errorf("calculated field name is required")
+		}
+		if fieldNames[name] {
+			return fmt.Errorf("duplicate calculated field '%s'", field.Name)
+		}
+		fieldNames[name] = true
+		if err := qb.formulaEngine.Validate(field.Formula); err != nil {
+			return fmt.Errorf("invalid formula for calculated field '%s': %w", field.Name, err)
+		}
+	}
+	if len(config.CalculatedFields) > 0 {
+		if err := qb.typeCheckCalculatedFields(engine, config, tableMap); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// buildSelectClause generates SELECT clause with columns and aggregations
-func (qb *QueryBuilder) buildSelectClause(config *models.VisualQueryConfig) string {
+// buildSelectClause generates SELECT clause with columns, aggregations and
+// pushed-down calculated fields
+func (qb *QueryBuilder) buildSelectClause(config *models.VisualQueryConfig, calc *calculatedFieldPlan) string {
 	var columns []string
 
 	// Add regular columns
@@ -228,6 +299,13 @@ func (qb *QueryBuilder) buildSelectClause(config *models.VisualQueryConfig) stri
 		columns = append(columns, "*")
 	}
 
+	// Add calculated fields compiled to SQL
+	for _, field := range config.CalculatedFields {
+		if expr, ok := calc.sqlExpr(field.Name); ok {
+			columns = append(columns, fmt.Sprintf("%s AS %s", expr, qb.sanitizeIdentifier(field.Name)))
+		}
+	}
+
 	return "SELECT\n    " + strings.Join(columns, ",\n    ")
 }
 
@@ -264,42 +342,62 @@ func (qb *QueryBuilder) buildJoinClause(config *models.VisualQueryConfig) string
 	return strings.Join(joins, "\n")
 }
 
-// buildWhereClause generates WHERE clause with filters (AND/OR logic)
-func (qb *QueryBuilder) buildWhereClause(config *models.VisualQueryConfig) (string, []interface{}) {
-	if len(config.Filters) == 0 {
+// buildWhereClause generates WHERE clause with filters (AND/OR logic).
+// Filters on calculated fields over aggregates are left to HAVING.
+func (qb *QueryBuilder) buildWhereClause(config *models.VisualQueryConfig, calc *calculatedFieldPlan) (string, []interface{}) {
+	conditions, params := qb.buildConditions(config.Filters, calc, false, 1)
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conditions, "\n    "), params
+}
+
+// buildHavingClause generates HAVING clause with the filters on calculated
+// fields over aggregates, numbering parameters from paramIndex
+func (qb *QueryBuilder) buildHavingClause(config *models.VisualQueryConfig, calc *calculatedFieldPlan, paramIndex int) (string, []interface{}) {
+	conditions, params := qb.buildConditions(config.Filters, calc, true, paramIndex)
+	if len(conditions) == 0 {
 		return "", nil
 	}
+	return "HAVING " + strings.Join(conditions, "\n    "), params
+}
 
+// buildConditions renders the filters that do, or do not, reference
+// aggregates as conditions joined by their logic operators
+func (qb *QueryBuilder) buildConditions(filters []models.FilterCondition, calc *calculatedFieldPlan, aggregated bool, paramIndex int) ([]string, []interface{}) {
 	var conditions []string
 	var params []interface{}
-	paramIndex := 1
 
-	for i, filter := range config.Filters {
+	for _, filter := range filters {
+		if calc.aggregated(filter.Column) != aggregated {
+			continue
+		}
 		var condition string
+		column := qb.columnExpr(filter.Column, calc)
 
 		// Handle different operators
 		switch strings.ToUpper(filter.Operator) {
 		case "IN":
 			// For IN operator, value should be an array
-			condition = fmt.Sprintf("%s IN ($%d)", qb.sanitizeIdentifier(filter.Column), paramIndex)
+			condition = fmt.Sprintf("%s IN ($%d)", column, paramIndex)
 			params = append(params, filter.Value)
 			paramIndex++
 		case "BETWEEN":
 			// For BETWEEN, value should be an array with 2 elements
-			condition = fmt.Sprintf("%s BETWEEN $%d AND $%d", qb.sanitizeIdentifier(filter.Column), paramIndex, paramIndex+1)
+			condition = fmt.Sprintf("%s BETWEEN $%d AND $%d", column, paramIndex, paramIndex+1)
 			// Assuming filter.Value is []interface{}{start, end}
 			if arr, ok := filter.Value.([]interface{}); ok && len(arr) == 2 {
 				params = append(params, arr[0], arr[1])
 				paramIndex += 2
 			}
 		default:
-			condition = fmt.Sprintf("%s %s $%d", qb.sanitizeIdentifier(filter.Column), filter.Operator, paramIndex)
+			condition = fmt.Sprintf("%s %s $%d", column, filter.Operator, paramIndex)
 			params = append(params, filter.Value)
 			paramIndex++
 		}
 
 		// Add logic operator (AND/OR) except for first condition
-		if i > 0 {
+		if len(conditions) > 0 {
 			logic := "AND"
 			if filter.Logic != "" {
 				logic = strings.ToUpper(filter.Logic)
@@ -310,28 +408,27 @@ func (qb *QueryBuilder) buildWhereClause(config *models.VisualQueryConfig) (stri
 		}
 	}
 
-	whereClause := "WHERE " + strings.Join(conditions, "\n    ")
-	return whereClause, params
+	return conditions, params
 }
 
 // buildGroupByClause generates GROUP BY clause
-func (qb *QueryBuilder) buildGroupByClause(config *models.VisualQueryConfig) string {
+func (qb *QueryBuilder) buildGroupByClause(config *models.VisualQueryConfig, calc *calculatedFieldPlan) string {
 	var groupByCols []string
 	for _, col := range config.GroupBy {
-		groupByCols = append(groupByCols, qb.sanitizeIdentifier(col))
+		groupByCols = append(groupByCols, qb.columnExpr(col, calc))
 	}
 	return "GROUP BY " + strings.Join(groupByCols, ", ")
 }
 
 // buildOrderByClause generates ORDER BY clause
-func (qb *QueryBuilder) buildOrderByClause(config *models.VisualQueryConfig) string {
+func (qb *QueryBuilder) buildOrderByClause(config *models.VisualQueryConfig, calc *calculatedFieldPlan) string {
 	var orderByCols []string
 	for _, orderBy := range config.OrderBy {
 		direction := "ASC"
 		if strings.ToUpper(orderBy.Direction) == "DESC" {
 			direction = "DESC"
 		}
-		orderByCols = append(orderByCols, fmt.Sprintf("%s %s", qb.sanitizeIdentifier(orderBy.Column), direction))
+		orderByCols = append(orderByCols, fmt.Sprintf("%s %s", qb.columnExpr(orderBy.Column, calc), direction))
 	}
 	return "ORDER BY " + strings.Join(orderByCols, ", ")
 }
@@ -375,7 +472,7 @@ func (qb *QueryBuilder) ExecuteQuery(ctx context.Context, config *models.VisualQ
 
 	// Cache miss or cache disabled - build SQL
 	// Build SQL (Initial pass for validity check)
-	_, _, err := qb.BuildSQL(ctx, config, conn, userID, workspaceID, userRole)
+	_, _, _, err := qb.buildSQL(ctx, config, conn, workspaceID)
 	if err != nil {
 		return nil, err
 	}
@@ -412,7 +509,8 @@ func (qb *QueryBuilder) ExecuteQuery(ctx context.Context, config *models.VisualQ
 						op = "<"
 					}
 
-					// Add filter
+					// Add filter (in HAVING when the sort column is a
+					// calculated field over aggregates)
 					// Note: Modifying config in place. Ensure this is safe (request scoped)
 					config.Filters = append(config.Filters, models.FilterCondition{
 						Column:   sortCol.Column,
@@ -429,7 +527,7 @@ func (qb *QueryBuilder) ExecuteQuery(ctx context.Context, config *models.VisualQ
 	}
 
 	// Re-build SQL with potential filter injections (for cursor pagination)
-	sql, params, err := qb.BuildSQL(ctx, config, conn, userID, workspaceID, userRole)
+	sql, params, calc, err := qb.buildSQL(ctx, config, conn, workspaceID)
 	if err != nil {
 		return nil, err
 	}
@@ -474,8 +572,9 @@ func (qb *QueryBuilder) ExecuteQuery(ctx context.Context, config *models.VisualQ
 		result.Rows = result.Rows[:*config.Limit] // Remove the extra row
 		result.RowCount = len(result.Rows)
 
-		// Generate next cursor
-		if len(result.Rows) > 0 && len(config.OrderBy) > 0 && qb.paginationService != nil {
+		// Generate next cursor. Table calculations cannot be paged, so
+		// queries with them get no cursor
+		if len(result.Rows) > 0 && len(config.OrderBy) > 0 && qb.paginationService != nil && !calc.hasTableCalculations() {
 			lastRow := result.Rows[len(result.Rows)-1]
 			// We need to extract values corresponding to order by columns
 			// This is tricky because `lastRow` is `[]interface{}`, and we need to map column names to indices.
@@ -511,6 +610,9 @@ func (qb *QueryBuilder) ExecuteQuery(ctx context.Context, config *models.VisualQ
 		}
 	}
 
+	// Calculated fields that could not be pushed down are computed on the fetched page
+	qb.applyInMemoryCalculatedFields(result, calc)
+
 	// Store result in cache with tags for invalidation (if cache is available)
 	if qb.queryCache != nil {
 		tags := qb.queryCache.GenerateTags(visualQueryID, conn.ID, userID)
@@ -50,7 +50,7 @@ func TestBuildSQL_SimpleSelect(t *testing.T) {
 	ctx := context.Background()
 
 	// Build SQL (skip validation for unit test)
-	sql := queryBuilder.buildSelectClause(config) + "\n" +
+	sql := queryBuilder.buildSelectClause(config, nil) + "\n" +
 		queryBuilder.buildFromClause(config) + "\n" +
 		queryBuilder.buildLimitClause(config)
 
@@ -130,7 +130,7 @@ func TestBuildSQL_WithFilters(t *testing.T) {
 		},
 	}
 
-	whereClause, params := queryBuilder.buildWhereClause(config)
+	whereClause, params := queryBuilder.buildWhereClause(config, nil)
 
 	// Check WHERE clause exists
 	if !contains(whereClause, "WHERE") {
@@ -182,7 +182,7 @@ func TestBuildSQL_WithAggregations(t *testing.T) {
 				},
 			}
 
-			sql := queryBuilder.buildSelectClause(config)
+			sql := queryBuilder.buildSelectClause(config, nil)
 
 			if !contains(sql, tt.expected) {
 				t.Errorf("Expected %s function, got: %s", tt.expected, sql)
@@ -204,7 +204,7 @@ func TestBuildSQL_WithGroupBy(t *testing.T) {
 		GroupBy: []string{"customer_id", "product_id"},
 	}
 
-	sql := queryBuilder.buildGroupByClause(config)
+	sql := queryBuilder.buildGroupByClause(config, nil)
 
 	if !contains(sql, "GROUP BY") {
 		t.Error("Expected GROUP BY clause")
@@ -240,7 +240,7 @@ func TestBuildSQL_WithOrderBy(t *testing.T) {
 				},
 			}
 
-			sql := queryBuilder.buildOrderByClause(config)
+			sql := queryBuilder.buildOrderByClause(config, nil)
 
 			if !contains(sql, "ORDER BY") {
 				t.Error("Expected ORDER BY clause")
@@ -307,12 +307,12 @@ func TestBuildSQL_ComplexQuery(t *testing.T) {
 	}
 
 	// Build all clauses
-	selectClause := queryBuilder.buildSelectClause(config)
+	selectClause := queryBuilder.buildSelectClause(config, nil)
 	fromClause := queryBuilder.buildFromClause(config)
 	joinClause := queryBuilder.buildJoinClause(config)
-	whereClause, _ := queryBuilder.buildWhereClause(config)
-	groupByClause := queryBuilder.buildGroupByClause(config)
-	orderByClause := queryBuilder.buildOrderByClause(config)
+	whereClause, _ := queryBuilder.buildWhereClause(config, nil)
+	groupByClause := queryBuilder.buildGroupByClause(config, nil)
+	orderByClause := queryBuilder.buildOrderByClause(config, nil)
 	limitClause := queryBuilder.buildLimitClause(config)
 
 	// Verify all clauses are present
@@ -382,7 +382,7 @@ func TestBuildSQL_SQLInjectionPrevention(t *testing.T) {
 		},
 	}
 
-	sql2 := queryBuilder.buildSelectClause(config2)
+	sql2 := queryBuilder.buildSelectClause(config2, nil)
 
 	// Sanitized identifier should not contain quotes
 	if contains(sql2, "'") {
@@ -163,6 +163,11 @@ func (qc *QueryCache) InvalidateUser(ctx context.Context, userId string) error {
 	return qc.redis.InvalidateByTag(ctx, tag)
 }
 
+// InvalidateTag invalidates all cached results carrying a tag
+func (qc *QueryCache) InvalidateTag(ctx context.Context, tag string) error {
+	return qc.redis.InvalidateByTag(ctx, tag)
+}
+
 // GetStats retrieves cache statistics
 func (qc *QueryCache) GetStats(ctx context.Context) (*CacheStats, error) {
 	return qc.redis.GetStats(ctx)
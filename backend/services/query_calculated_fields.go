@@ -0,0 +1,410 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
+	"strings"
+)
+
+// calculatedFieldPlan records how each calculated field of a visual query is
+// computed: compiled into the generated SQL, or evaluated in memory because it
+// uses a function or construct the SQL compiler cannot translate
+type calculatedFieldPlan struct {
+	exprs    map[string]string // lower-cased name -> SQL expression
+	inMemory []models.CalculatedField
+	status   []models.CalculatedFieldExecution
+	windowed map[string]bool // fields that are, or depend on, table calculations
+	grouped  map[string]bool // fields that reference aggregates, filtered in HAVING
+	engine   *formula_engine.FormulaEngine
+}
+
+// sqlExpr returns the compiled expression of a pushed-down calculated field
+func (p *calculatedFieldPlan) sqlExpr(name string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	expr, ok := p.exprs[strings.ToLower(name)]
+	return expr, ok
+}
+
+func (p *calculatedFieldPlan) evaluatedInMemory(name string) (models.CalculatedFieldExecution, bool) {
+	if p == nil {
+		return models.CalculatedFieldExecution{}, false
+	}
+	for _, st := range p.status {
+		if !st.PushedDown && strings.EqualFold(st.Name, name) {
+			return st, true
+		}
+	}
+	return models.CalculatedFieldExecution{}, false
+}
+
+// hasTableCalculations reports whether any calculated field is, or depends
+// on, a table calculation
+func (p *calculatedFieldPlan) hasTableCalculations() bool {
+	return p != nil && len(p.windowed) > 0
+}
+
+// aggregated reports whether a column names a pushed-down calculated field
+// that references an aggregate, so filters on it belong in HAVING
+func (p *calculatedFieldPlan) aggregated(column string) bool {
+	return p != nil && p.grouped[strings.ToLower(column)]
+}
+
+// namedFormulas lists calculated fields for the formula engine's dependency graph
+func namedFormulas(fields []models.CalculatedField) []formula_engine.NamedFormula {
+	named := make([]formula_engine.NamedFormula, len(fields))
+	for i, f := range fields {
+		named[i] = formula_engine.NamedFormula{Name: f.Name, Formula: f.Formula}
+	}
+	return named
+}
+
+// windowSpec converts a calculated field's partitioning and ordering
+func windowSpec(field models.CalculatedField) formula_engine.WindowSpec {
+	spec := formula_engine.WindowSpec{PartitionBy: field.PartitionBy}
+	for _, order := range field.OrderBy {
+		spec.OrderBy = append(spec.OrderBy, formula_engine.WindowOrder{
+			Field: order.Column,
+			Desc:  strings.EqualFold(order.Direction, "DESC"),
+		})
+	}
+	return spec
+}
+
+// columnExpr returns the SQL for a column reference in WHERE, GROUP BY or
+// ORDER BY, substituting pushed-down calculated fields by their expression
+func (qb *QueryBuilder) columnExpr(column string, calc *calculatedFieldPlan) string {
+	if expr, ok := calc.sqlExpr(column); ok {
+		return expr
+	}
+	return qb.sanitizeIdentifier(column)
+}
+
+// planCalculatedFields compiles the calculated fields of a query for the
+// connection's dialect. A field falls back to in-memory evaluation when it is
+// not translatable or depends on a field that is not; such fields cannot be
+// used in filters, grouping or sorting.
+func (qb *QueryBuilder) planCalculatedFields(engine *formula_engine.FormulaEngine, config *models.VisualQueryConfig, dialect string) (*calculatedFieldPlan, error) {
+	plan := &calculatedFieldPlan{exprs: make(map[string]string), windowed: make(map[string]bool), grouped: make(map[string]bool), engine: engine}
+	if len(config.CalculatedFields) == 0 {
+		return plan, nil
+	}
+
+	fields := make(map[string]models.CalculatedField, len(config.CalculatedFields))
+	for _, field := range config.CalculatedFields {
+		fields[strings.ToLower(field.Name)] = field
+	}
+	graph, err := engine.DependencyGraph(namedFormulas(config.CalculatedFields))
+	if err != nil {
+		return nil, err
+	}
+	order, err := graph.Order()
+	if err != nil {
+		return nil, err
+	}
+
+	// Compile in dependency order so a field's dependencies are settled
+	// before it inlines them
+	reasons := make(map[string]string)
+	for _, name := range order {
+		key := strings.ToLower(name)
+		field := fields[key]
+		if isWindow, err := engine.IsTableCalculation(field.Formula); err == nil && isWindow {
+			plan.windowed[key] = true
+		}
+		expr, err := engine.CompileSQL(field.Formula, formula_engine.SQLCompileOptions{
+			Dialect: dialect,
+			Window:  windowSpec(field),
+			ResolveField: func(ref string) (string, error) {
+				dep, ok := fields[strings.ToLower(ref)]
+				if !ok {
+					expr, aggregate := qb.fieldExpr(config, ref)
+					if aggregate {
+						plan.grouped[key] = true
+					}
+					return expr, nil
+				}
+				if plan.windowed[strings.ToLower(ref)] {
+					plan.windowed[key] = true
+				}
+				if plan.grouped[strings.ToLower(ref)] {
+					plan.grouped[key] = true
+				}
+				if expr, ok := plan.exprs[strings.ToLower(ref)]; ok {
+					return "(" + expr + ")", nil
+				}
+				return "", fmt.Errorf("%w: depends on in-memory field '%s'", formula_engine.ErrNotTranslatable, dep.Name)
+			},
+		})
+		switch {
+		case err == nil:
+			plan.exprs[key] = expr
+		case errors.Is(err, formula_engine.ErrNotTranslatable):
+			reasons[key] = err.Error()
+			// In-memory fields are evaluated in dependency order too
+			plan.inMemory = append(plan.inMemory, field)
+		default:
+			return nil, fmt.Errorf("calculated field '%s': %w", field.Name, err)
+		}
+	}
+
+	for _, field := range config.CalculatedFields {
+		if reason, ok := reasons[strings.ToLower(field.Name)]; ok {
+			plan.status = append(plan.status, models.CalculatedFieldExecution{Name: field.Name, Reason: reason})
+		} else {
+			plan.status = append(plan.status, models.CalculatedFieldExecution{Name: field.Name, PushedDown: true})
+		}
+	}
+
+	// In-memory fields only exist after the rows are fetched, and table
+	// calculations only once the rows they run over are known. Fields over
+	// aggregates are filtered in HAVING, which is only equivalent when every
+	// filter is combined with AND.
+	for _, filter := range config.Filters {
+		if st, ok := plan.evaluatedInMemory(filter.Column); ok {
+			return nil, fmt.Errorf("calculated field '%s' cannot be used in filters: %s", st.Name, st.Reason)
+		}
+		if plan.windowed[strings.ToLower(filter.Column)] {
+			return nil, fmt.Errorf("calculated field '%s' is a table calculation and cannot be used in filters", filter.Column)
+		}
+	}
+	// Table calculations run over every row of the result: evaluated in
+	// memory they would only see the fetched page, and pushed down they
+	// would restart on each cursor page
+	paged := config.Cursor != nil && *config.Cursor != ""
+	for _, field := range config.CalculatedFields {
+		if !plan.windowed[strings.ToLower(field.Name)] {
+			continue
+		}
+		if _, ok := plan.evaluatedInMemory(field.Name); ok && (config.Limit != nil || paged) {
+			return nil, fmt.Errorf("calculated field '%s' is a table calculation evaluated in memory and cannot be used with a limit or cursor", field.Name)
+		}
+		if paged {
+			return nil, fmt.Errorf("calculated field '%s' is a table calculation and cannot be used with cursor pagination", field.Name)
+		}
+	}
+	for _, filter := range config.Filters {
+		if !plan.aggregated(filter.Column) {
+			continue
+		}
+		for i, other := range config.Filters {
+			if i > 0 && strings.EqualFold(other.Logic, "OR") {
+				return nil, fmt.Errorf("calculated field '%s' aggregates and can only be combined with other filters using AND", filter.Column)
+			}
+		}
+	}
+	for _, col := range config.GroupBy {
+		if st, ok := plan.evaluatedInMemory(col); ok {
+			return nil, fmt.Errorf("calculated field '%s' cannot be used in group by: %s", st.Name, st.Reason)
+		}
+		if plan.windowed[strings.ToLower(col)] {
+			return nil, fmt.Errorf("calculated field '%s' is a table calculation and cannot be used in group by", col)
+		}
+		if plan.aggregated(col) {
+			return nil, fmt.Errorf("calculated field '%s' aggregates and cannot be used in group by", col)
+		}
+	}
+	for _, order := range config.OrderBy {
+		if st, ok := plan.evaluatedInMemory(order.Column); ok {
+			return nil, fmt.Errorf("calculated field '%s' cannot be used in order by: %s", st.Name, st.Reason)
+		}
+	}
+
+	return plan, nil
+}
+
+// fieldExpr resolves a formula field reference against the query's output:
+// aggregation and column aliases first, then column names, then a raw column.
+// It also reports whether the reference is an aggregate.
+func (qb *QueryBuilder) fieldExpr(config *models.VisualQueryConfig, ref string) (string, bool) {
+	for _, agg := range config.Aggregations {
+		if strings.EqualFold(agg.Alias, ref) {
+			return fmt.Sprintf("%s(%s)", strings.ToUpper(agg.Function), qb.sanitizeIdentifier(agg.Column)), true
+		}
+	}
+	for _, col := range config.Columns {
+		if col.Column == "*" {
+			continue
+		}
+		aliased := col.Alias != nil && strings.EqualFold(*col.Alias, ref)
+		if !aliased && !strings.EqualFold(col.Column, ref) && !strings.EqualFold(col.Table+"."+col.Column, ref) {
+			continue
+		}
+		expr := fmt.Sprintf("%s.%s", qb.sanitizeIdentifier(col.Table), qb.sanitizeIdentifier(col.Column))
+		if col.Aggregation != nil && *col.Aggregation != "" {
+			return fmt.Sprintf("%s(%s)", strings.ToUpper(*col.Aggregation), expr), true
+		}
+		return expr, false
+	}
+	if table, column, ok := strings.Cut(ref, "."); ok {
+		return fmt.Sprintf("%s.%s", qb.sanitizeIdentifier(table), qb.sanitizeIdentifier(column)), false
+	}
+	return qb.sanitizeIdentifier(ref), false
+}
+
+// applyInMemoryCalculatedFields appends the calculated fields that were not
+// pushed down to the result and records how every field was computed
+func (qb *QueryBuilder) applyInMemoryCalculatedFields(result *models.QueryResult, calc *calculatedFieldPlan) {
+	if calc == nil || len(calc.status) == 0 {
+		return
+	}
+	result.CalculatedFields = calc.status
+	if len(calc.inMemory) == 0 {
+		return
+	}
+	engine := calc.engine
+	if engine == nil {
+		engine = qb.formulaEngine
+	}
+
+	data := make([]map[string]interface{}, len(result.Rows))
+	for i, row := range result.Rows {
+		record := make(map[string]interface{}, len(result.Columns)+len(calc.inMemory))
+		for j, col := range result.Columns {
+			if j < len(row) {
+				record[col] = row[j]
+			}
+		}
+		data[i] = record
+	}
+
+	for _, field := range calc.inMemory {
+		values, err := engine.EvaluateTable(field.Formula, data, windowSpec(field))
+		if err != nil {
+			LogWarn("calculated_field_eval", "Failed to evaluate calculated field", map[string]interface{}{"field": field.Name, "error": err})
+			values = make([]interface{}, len(data))
+		}
+		result.Columns = append(result.Columns, field.Name)
+		for i := range result.Rows {
+			result.Rows[i] = append(result.Rows[i], values[i])
+			// Later fields may reference this one
+			data[i][field.Name] = values[i]
+		}
+	}
+}
+
+// ApplyCardCalculatedFields evaluates a dashboard card's calculated fields
+// over the result of its saved query. Saved queries are raw SQL, so every
+// field is evaluated in memory, in dependency order like the in-memory fields
+// of a visual query. Table calculations need every row and are rejected when
+// the result is a page.
+func (qb *QueryBuilder) ApplyCardCalculatedFields(result *models.QueryResult, card *models.DashboardCard, workspaceID string, paged bool) error {
+	fields, err := CardCalculatedFields(card)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	engine := qb.formulaEngineFor(workspaceID)
+	graph, err := engine.DependencyGraph(namedFormulas(fields))
+	if err != nil {
+		return err
+	}
+	order, err := graph.Order()
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]models.CalculatedField, len(fields))
+	for _, field := range fields {
+		byName[strings.ToLower(field.Name)] = field
+	}
+	plan := &calculatedFieldPlan{windowed: make(map[string]bool), engine: engine}
+	for _, name := range order {
+		key := strings.ToLower(name)
+		field := byName[key]
+		if isWindow, err := engine.IsTableCalculation(field.Formula); err == nil && isWindow {
+			plan.windowed[key] = true
+		}
+		for _, dep := range graph.Dependencies(name) {
+			if plan.windowed[strings.ToLower(dep)] {
+				plan.windowed[key] = true
+			}
+		}
+		if paged && plan.windowed[key] {
+			return fmt.Errorf("calculated field '%s' is a table calculation and cannot be used with a limit or offset", field.Name)
+		}
+		plan.inMemory = append(plan.inMemory, field)
+	}
+	for _, field := range fields {
+		plan.status = append(plan.status, models.CalculatedFieldExecution{Name: field.Name, Reason: "card fields are evaluated over the saved query's rows"})
+	}
+	qb.applyInMemoryCalculatedFields(result, plan)
+	return nil
+}
+
+// typeCheckCalculatedFields checks calculated field formulas against the
+// catalog types of the queried tables, the query's aliases and the other
+// calculated fields, so mismatches like [Revenue] + [Region] fail up front
+func (qb *QueryBuilder) typeCheckCalculatedFields(engine *formula_engine.FormulaEngine, config *models.VisualQueryConfig, tableMap map[string]*TableInfo) error {
+	fields := make(map[string]formula_engine.ValueType)
+	columnType := func(table, column string) formula_engine.ValueType {
+		if info, ok := tableMap[table]; ok {
+			for _, col := range info.Columns {
+				if strings.EqualFold(col.Name, column) {
+					return formula_engine.TypeFromSQL(col.Type)
+				}
+			}
+		}
+		return formula_engine.TypeAny
+	}
+	aggregateType := func(function string, valueType formula_engine.ValueType) formula_engine.ValueType {
+		switch strings.ToUpper(function) {
+		case "MIN", "MAX":
+			return valueType
+		}
+		return formula_engine.TypeNumber
+	}
+
+	for _, table := range config.Tables {
+		info, ok := tableMap[table.Name]
+		if !ok {
+			continue
+		}
+		for _, col := range info.Columns {
+			t := formula_engine.TypeFromSQL(col.Type)
+			fields[col.Name] = t
+			fields[table.Name+"."+col.Name] = t
+		}
+	}
+	for _, col := range config.Columns {
+		if col.Alias == nil || *col.Alias == "" || col.Column == "*" {
+			continue
+		}
+		t := columnType(col.Table, col.Column)
+		if col.Aggregation != nil && *col.Aggregation != "" {
+			t = aggregateType(*col.Aggregation, t)
+		}
+		fields[*col.Alias] = t
+	}
+	for _, agg := range config.Aggregations {
+		if agg.Alias == "" {
+			continue
+		}
+		valueType := formula_engine.TypeAny
+		if t, ok := fields[agg.Column]; ok {
+			valueType = t
+		}
+		fields[agg.Alias] = aggregateType(agg.Function, valueType)
+	}
+	for _, field := range config.CalculatedFields {
+		fields[field.Name] = formula_engine.TypeAny
+	}
+
+	for _, field := range config.CalculatedFields {
+		result, err := engine.TypeCheck(field.Formula, fields)
+		if err != nil {
+			return fmt.Errorf("invalid formula for calculated field '%s': %w", field.Name, err)
+		}
+		if !result.Valid() {
+			messages := make([]string, len(result.Issues))
+			for i, issue := range result.Issues {
+				messages[i] = issue.String()
+			}
+			return fmt.Errorf("calculated field '%s': %s", field.Name, strings.Join(messages, "; "))
+		}
+		fields[field.Name] = result.Type
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"insight-engine-backend/models"
+	"insight-engine-backend/services/formula_engine"
+	"strings"
+	"testing"
+)
+
+func TestPlanCalculatedFields_PushDown(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	config := &models.VisualQueryConfig{
+		Tables:       []models.TableSelection{{Name: "orders"}},
+		Columns:      []models.ColumnSelection{{Table: "orders", Column: "region"}},
+		Aggregations: []models.Aggregation{{Function: "SUM", Column: "amount", Alias: "revenue"}},
+		GroupBy:      []string{"region"},
+		CalculatedFields: []models.CalculatedField{
+			{Name: "half", Formula: "[revenue] / 2"},
+			{Name: "label", Formula: `IF([half] > 100, "big", "small")`},
+		},
+		OrderBy: []models.OrderByClause{{Column: "half", Direction: "DESC"}},
+	}
+
+	calc, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres")
+	if err != nil {
+		t.Fatalf("planCalculatedFields() error = %v", err)
+	}
+	for _, st := range calc.status {
+		if !st.PushedDown {
+			t.Errorf("field %s was not pushed down: %s", st.Name, st.Reason)
+		}
+	}
+
+	selectClause := qb.buildSelectClause(config, calc)
+	if !strings.Contains(selectClause, `(SUM("amount") * 1.0 / NULLIF(2, 0)) AS "half"`) {
+		t.Errorf("SELECT missing pushed-down field: %s", selectClause)
+	}
+	if !strings.Contains(selectClause, `CASE WHEN (((SUM("amount") * 1.0 / NULLIF(2, 0))) > 100)`) {
+		t.Errorf("SELECT missing inlined dependency: %s", selectClause)
+	}
+	orderBy := qb.buildOrderByClause(config, calc)
+	if orderBy != `ORDER BY (SUM("amount") * 1.0 / NULLIF(2, 0)) DESC` {
+		t.Errorf("unexpected ORDER BY: %s", orderBy)
+	}
+}
+
+func TestPlanCalculatedFields_AggregateFilter(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	config := &models.VisualQueryConfig{
+		Tables:       []models.TableSelection{{Name: "orders"}},
+		Columns:      []models.ColumnSelection{{Table: "orders", Column: "region"}},
+		Aggregations: []models.Aggregation{{Function: "SUM", Column: "amount", Alias: "revenue"}},
+		GroupBy:      []string{"region"},
+		CalculatedFields: []models.CalculatedField{
+			{Name: "half", Formula: "[revenue] / 2"},
+			{Name: "code", Formula: `UPPER([region])`},
+		},
+		Filters: []models.FilterCondition{
+			{Column: "half", Operator: ">", Value: 100},
+			{Column: "code", Operator: "=", Value: "EU", Logic: "AND"},
+		},
+	}
+
+	calc, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres")
+	if err != nil {
+		t.Fatalf("planCalculatedFields() error = %v", err)
+	}
+	where, whereParams := qb.buildWhereClause(config, calc)
+	if where != `WHERE UPPER("orders"."region") = $1` || len(whereParams) != 1 || whereParams[0] != "EU" {
+		t.Errorf("unexpected WHERE: %s %v", where, whereParams)
+	}
+	having, havingParams := qb.buildHavingClause(config, calc, 2)
+	if having != `HAVING (SUM("amount") * 1.0 / NULLIF(2, 0)) > $2` || len(havingParams) != 1 || havingParams[0] != 100 {
+		t.Errorf("unexpected HAVING: %s %v", having, havingParams)
+	}
+
+	// HAVING only splits off conditions joined by AND
+	config.Filters[1].Logic = "OR"
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil {
+		t.Error("expected error combining an aggregate filter with OR")
+	}
+	config.Filters = nil
+	config.GroupBy = []string{"region", "half"}
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil {
+		t.Error("expected error grouping by an aggregate")
+	}
+}
+
+func TestPlanCalculatedFields_InMemoryFallback(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	config := &models.VisualQueryConfig{
+		Tables:  []models.TableSelection{{Name: "orders"}},
+		Columns: []models.ColumnSelection{{Table: "orders", Column: "created_at"}},
+		CalculatedFields: []models.CalculatedField{
+			{Name: "day", Formula: `TEXT([created_at], "yyyy-mm-dd")`},
+			{Name: "label", Formula: `"Day " & [day]`},
+		},
+	}
+
+	calc, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres")
+	if err != nil {
+		t.Fatalf("planCalculatedFields() error = %v", err)
+	}
+	if len(calc.inMemory) != 2 {
+		t.Fatalf("expected both fields in memory, got %d", len(calc.inMemory))
+	}
+	if strings.Contains(qb.buildSelectClause(config, calc), "AS \"day\"") {
+		t.Error("in-memory field must not be selected in SQL")
+	}
+
+	result := &models.QueryResult{
+		Columns: []string{"created_at"},
+		Rows:    [][]interface{}{{"2024-03-05"}},
+	}
+	qb.applyInMemoryCalculatedFields(result, calc)
+	if len(result.Columns) != 3 || result.Rows[0][2] != "Day 2024-03-05" {
+		t.Errorf("unexpected in-memory result: %v %v", result.Columns, result.Rows)
+	}
+	if result.CalculatedFields[0].PushedDown || result.CalculatedFields[0].Reason == "" {
+		t.Errorf("expected fallback indicator, got %+v", result.CalculatedFields[0])
+	}
+
+	config.Filters = []models.FilterCondition{{Column: "day", Operator: "=", Value: "2024-03-05"}}
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil {
+		t.Error("expected error filtering on an in-memory calculated field")
+	}
+}
+
+func TestPlanCalculatedFields_InMemoryDependencyOrder(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	config := &models.VisualQueryConfig{
+		Tables:  []models.TableSelection{{Name: "orders"}},
+		Columns: []models.ColumnSelection{{Table: "orders", Column: "created_at"}},
+		CalculatedFields: []models.CalculatedField{
+			{Name: "label", Formula: `"Day " & [day]`},
+			{Name: "day", Formula: `TEXT([created_at], "yyyy-mm-dd")`},
+		},
+	}
+
+	calc, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres")
+	if err != nil {
+		t.Fatalf("planCalculatedFields() error = %v", err)
+	}
+	result := &models.QueryResult{Columns: []string{"created_at"}, Rows: [][]interface{}{{"2024-03-05"}}}
+	qb.applyInMemoryCalculatedFields(result, calc)
+	if result.Columns[1] != "day" || result.Rows[0][2] != "Day 2024-03-05" {
+		t.Errorf("dependency evaluated out of order: %v %v", result.Columns, result.Rows)
+	}
+	if result.CalculatedFields[0].Name != "label" {
+		t.Errorf("status should keep declaration order: %+v", result.CalculatedFields)
+	}
+}
+
+func TestPlanCalculatedFields_Cycle(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	config := &models.VisualQueryConfig{
+		CalculatedFields: []models.CalculatedField{
+			{Name: "a", Formula: "[b] + 1"},
+			{Name: "b", Formula: "[a] + 1"},
+		},
+	}
+	_, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres")
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+}
+
+func TestPlanCalculatedFields_TableCalculation(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	config := &models.VisualQueryConfig{
+		Tables:       []models.TableSelection{{Name: "orders"}},
+		Columns:      []models.ColumnSelection{{Table: "orders", Column: "month"}},
+		Aggregations: []models.Aggregation{{Function: "SUM", Column: "amount", Alias: "revenue"}},
+		GroupBy:      []string{"month"},
+		CalculatedFields: []models.CalculatedField{
+			{Name: "cumulative", Formula: "RUNNING_SUM([revenue])", OrderBy: []models.OrderByClause{{Column: "month"}}},
+			{Name: "share", Formula: "[cumulative] / WINDOW_MAX([cumulative])"},
+		},
+		OrderBy: []models.OrderByClause{{Column: "share"}},
+	}
+
+	calc, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres")
+	if err != nil {
+		t.Fatalf("planCalculatedFields() error = %v", err)
+	}
+	want := `SUM(SUM("amount")) OVER (ORDER BY "orders"."month" ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)`
+	if expr, _ := calc.sqlExpr("cumulative"); expr != want {
+		t.Errorf("cumulative = %s, want %s", expr, want)
+	}
+	if !calc.windowed["share"] {
+		t.Error("a field depending on a table calculation is itself one")
+	}
+
+	config.Filters = []models.FilterCondition{{Column: "share", Operator: ">", Value: 0.5}}
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil {
+		t.Error("expected error filtering on a table calculation")
+	}
+	config.Filters = nil
+
+	// A pushed-down window spans the whole result before LIMIT, but would
+	// restart on a cursor page
+	limit := 10
+	config.Limit = &limit
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err != nil {
+		t.Errorf("planCalculatedFields() with limit error = %v", err)
+	}
+	cursor := "next"
+	config.Cursor = &cursor
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil {
+		t.Error("expected error paging a table calculation with a cursor")
+	}
+
+	// In memory, a table calculation would only see the fetched page
+	config.Cursor = nil
+	config.CalculatedFields = []models.CalculatedField{{Name: "cumulative", Formula: "RUNNING_SUM([revenue])"}}
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil || !strings.Contains(err.Error(), "evaluated in memory") {
+		t.Errorf("expected error limiting an in-memory table calculation, got %v", err)
+	}
+}
+
+func TestApplyInMemoryCalculatedFields_TableCalculation(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	calc := &calculatedFieldPlan{
+		inMemory: []models.CalculatedField{{
+			Name:    "prev",
+			Formula: "LOOKUP([revenue], -1)",
+			OrderBy: []models.OrderByClause{{Column: "month", Direction: "DESC"}},
+		}},
+		status: []models.CalculatedFieldExecution{{Name: "prev", Reason: "test"}},
+	}
+	result := &models.QueryResult{
+		Columns: []string{"month", "revenue"},
+		Rows:    [][]interface{}{{1, 10.0}, {2, 20.0}, {3, 30.0}},
+	}
+	qb.applyInMemoryCalculatedFields(result, calc)
+	if result.Rows[0][2] != 20.0 || result.Rows[1][2] != 30.0 || result.Rows[2][2] != nil {
+		t.Errorf("unexpected table calculation result: %v", result.Rows)
+	}
+}
+
+func TestPlanCalculatedFields_UserFunction(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	engine, err := qb.formulaEngine.WithUserFunctions([]formula_engine.UserFunction{
+		{Name: "MARGIN", Params: []string{"revenue", "cost"}, Body: "([revenue] - [cost]) / [revenue]"},
+	})
+	if err != nil {
+		t.Fatalf("WithUserFunctions() error = %v", err)
+	}
+	config := &models.VisualQueryConfig{
+		Tables:           []models.TableSelection{{Name: "orders"}},
+		CalculatedFields: []models.CalculatedField{{Name: "margin", Formula: "MARGIN([amount], [cost])"}},
+	}
+
+	calc, err := qb.planCalculatedFields(engine, config, "postgres")
+	if err != nil {
+		t.Fatalf("planCalculatedFields() error = %v", err)
+	}
+	want := `((("amount") - ("cost")) * 1.0 / NULLIF(("amount"), 0))`
+	if expr, ok := calc.sqlExpr("margin"); !ok || expr != want {
+		t.Errorf("margin = %s, want %s", expr, want)
+	}
+	if _, err := qb.planCalculatedFields(qb.formulaEngine, config, "postgres"); err == nil {
+		t.Error("expected unknown function error without the workspace functions")
+	}
+}
+
+func TestTypeCheckCalculatedFields(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	tableMap := map[string]*TableInfo{
+		"orders": {Name: "orders", Columns: []ColumnInfo{
+			{Name: "amount", Type: "numeric(12,2)"},
+			{Name: "region", Type: "varchar(50)"},
+		}},
+	}
+	config := &models.VisualQueryConfig{
+		Tables:       []models.TableSelection{{Name: "orders"}},
+		Aggregations: []models.Aggregation{{Function: "SUM", Column: "amount", Alias: "revenue"}},
+		CalculatedFields: []models.CalculatedField{
+			{Name: "double", Formula: "[revenue] * 2"},
+			{Name: "label", Formula: `[region] & ": " & [double]`},
+		},
+	}
+	if err := qb.typeCheckCalculatedFields(qb.formulaEngine, config, tableMap); err != nil {
+		t.Fatalf("typeCheckCalculatedFields() error = %v", err)
+	}
+
+	config.CalculatedFields = append(config.CalculatedFields, models.CalculatedField{Name: "bad", Formula: "[amount] + [region]"})
+	err := qb.typeCheckCalculatedFields(qb.formulaEngine, config, tableMap)
+	if err == nil || !strings.Contains(err.Error(), "position 11") {
+		t.Errorf("expected a positioned type mismatch, got %v", err)
+	}
+}
+
+func TestApplyCardCalculatedFields(t *testing.T) {
+	qb := NewQueryBuilder(nil, nil, nil, nil, nil, nil)
+	card := &models.DashboardCard{CalculatedFields: []byte(`[
+		{"name": "Margin", "formula": "[Profit] / [Sales]"},
+		{"name": "Profit", "formula": "[Sales] - [Cost]"}
+	]`)}
+
+	result := &models.QueryResult{
+		Columns: []string{"Sales", "Cost"},
+		Rows:    [][]interface{}{{200.0, 150.0}},
+	}
+	if err := qb.ApplyCardCalculatedFields(result, card, "", false); err != nil {
+		t.Fatalf("ApplyCardCalculatedFields() error = %v", err)
+	}
+	if strings.Join(result.Columns, ",") != "Sales,Cost,Profit,Margin" {
+		t.Fatalf("fields should be evaluated in dependency order, got %v", result.Columns)
+	}
+	if result.Rows[0][2] != 50.0 || result.Rows[0][3] != 0.25 {
+		t.Errorf("unexpected card field values: %v", result.Rows[0])
+	}
+
+	card.CalculatedFields = []byte(`[{"name": "cumulative", "formula": "RUNNING_SUM([Sales])"}]`)
+	result = &models.QueryResult{Columns: []string{"Sales"}, Rows: [][]interface{}{{1.0}}}
+	if err := qb.ApplyCardCalculatedFields(result, card, "", true); err == nil {
+		t.Error("expected a table calculation over a page of rows to be rejected")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"insight-engine-backend/models"
 	"insight-engine-backend/pkg/resilience"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/denisenkom/go-mssqldb" // SQL Server driver
@@ -19,10 +20,12 @@ import (
 
 // QueryExecutor handles SQL query execution across different database types
 type QueryExecutor struct {
+	poolMu         sync.Mutex
 	connectionPool map[string]*sql.DB
 	circuitBreaker resilience.CircuitBreaker
 	queryOptimizer *QueryOptimizer
 	queryCache     QueryCacheInterface
+	extracts       *ExtractService // answers the queries extracts copy, may be nil
 }
 
 // QueryExecutorInterface defines the interface for query execution
@@ -42,6 +45,11 @@ func NewQueryExecutor(cb resilience.CircuitBreaker, qo *QueryOptimizer, qc Query
 	}
 }
 
+// SetExtractService lets extracts answer the queries they copy
+func (qe *QueryExecutor) SetExtractService(extracts *ExtractService) {
+	qe.extracts = extracts
+}
+
 // IsHealthy returns true if the circuit breaker is not open
 func (qe *QueryExecutor) IsHealthy() bool {
 	state := qe.circuitBreaker.State()
@@ -50,6 +58,13 @@ func (qe *QueryExecutor) IsHealthy() bool {
 
 // Execute runs a SQL query and returns results
 func (qe *QueryExecutor) Execute(ctx context.Context, conn *models.Connection, sqlQuery string, params []interface{}, limit *int, offset *int) (*models.QueryResult, error) {
+	// Queries copied by an extract are answered from its local store
+	if qe.extracts != nil && len(params) == 0 {
+		if result, ok := qe.extracts.Serve(ctx, conn, sqlQuery, limit, offset); ok {
+			return result, nil
+		}
+	}
+
 	// Acceleration Interception (SQLite)
 	// We use "duckdb" as connection type alias for "acceleration" to avoid changing frontend config structure too much right now
 	if conn.Type == "duckdb" || conn.Type == "sqlite_memory" {
@@ -269,6 +284,9 @@ func (qe *QueryExecutor) Execute(ctx context.Context, conn *models.Connection, s
 
 // getConnection retrieves or creates a database connection
 func (qe *QueryExecutor) getConnection(conn *models.Connection) (*sql.DB, error) {
+	qe.poolMu.Lock()
+	defer qe.poolMu.Unlock()
+
 	// Check if connection already exists in pool
 	if db, exists := qe.connectionPool[conn.ID]; exists {
 		// Verify connection is still alive
@@ -459,6 +477,9 @@ func (qe *QueryExecutor) buildDSN(conn *models.Connection) (string, error) {
 
 // Close closes all database connections in the pool
 func (qe *QueryExecutor) Close() error {
+	qe.poolMu.Lock()
+	defer qe.poolMu.Unlock()
+
 	for _, db := range qe.connectionPool {
 		if err := db.Close(); err != nil {
 			return err
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2"
@@ -13,6 +14,7 @@ import (
 // RESTAuthService handles authentication for REST APIs
 type RESTAuthService struct {
 	// OAuth2 token cache
+	mu         sync.Mutex
 	tokenCache map[string]*oauth2.Token
 }
 
@@ -131,7 +133,10 @@ func (ras *RESTAuthService) applyOAuth2(req *http.Request, config *RESTConnector
 
 	// Check token cache
 	cacheKey := config.ID.String()
-	if cachedToken, exists := ras.tokenCache[cacheKey]; exists {
+	ras.mu.Lock()
+	cachedToken, exists := ras.tokenCache[cacheKey]
+	ras.mu.Unlock()
+	if exists {
 		if cachedToken.Valid() {
 			req.Header.Set("Authorization", "Bearer "+cachedToken.AccessToken)
 			return nil
@@ -145,7 +150,9 @@ func (ras *RESTAuthService) applyOAuth2(req *http.Request, config *RESTConnector
 	}
 
 	// Cache token
+	ras.mu.Lock()
 	ras.tokenCache[cacheKey] = token
+	ras.mu.Unlock()
 
 	// Apply to request
 	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
@@ -262,6 +269,8 @@ func (ras *RESTAuthService) ValidateAuthConfig(authType string, authConfig map[s
 
 // ClearTokenCache clears the OAuth2 token cache
 func (ras *RESTAuthService) ClearTokenCache(configID string) {
+	ras.mu.Lock()
+	defer ras.mu.Unlock()
 	delete(ras.tokenCache, configID)
 }
 
@@ -296,7 +305,9 @@ func (ras *RESTAuthService) RefreshOAuth2Token(config *RESTConnectorConfig) (*oa
 
 	// Update cache
 	cacheKey := config.ID.String()
+	ras.mu.Lock()
 	ras.tokenCache[cacheKey] = newToken
+	ras.mu.Unlock()
 
 	return newToken, nil
 }
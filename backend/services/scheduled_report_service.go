@@ -22,6 +22,12 @@ type ScheduledReportService struct {
 	emailService *EmailService
 	exportDir    string
 	baseURL      string
+	kpiService   *KPIService
+}
+
+// SetKPIService enables KPI scorecard digests
+func (s *ScheduledReportService) SetKPIService(kpiService *KPIService) {
+	s.kpiService = kpiService
 }
 
 // NewScheduledReportService creates a new scheduled report service
@@ -45,6 +51,9 @@ func (s *ScheduledReportService) CreateScheduledReport(userID string, req *model
 	if err := s.validateSchedule(req.ScheduleType, req.CronExpr, req.TimeOfDay, req.DayOfWeek, req.DayOfMonth); err != nil {
 		return nil, err
 	}
+	if err := validateReportFormat(req.ResourceType, req.Format); err != nil {
+		return nil, err
+	}
 
 	// Set default timezone
 	timezone := req.Timezone
@@ -169,6 +178,9 @@ func (s *ScheduledReportService) UpdateScheduledReport(reportID, userID string,
 		updates["timezone"] = *req.Timezone
 	}
 	if req.Format != nil {
+		if err := validateReportFormat(report.ResourceType, *req.Format); err != nil {
+			return nil, err
+		}
 		updates["format"] = *req.Format
 	}
 	if req.IncludeFilters != nil {
@@ -510,6 +522,24 @@ func (s *ScheduledReportService) generateAndSendReport(report models.ScheduledRe
 		message = fmt.Sprintf("Please find attached the scheduled report: %s", report.Name)
 	}
 
+	// KPI scorecards are also rendered inline so the digest is readable without the attachment
+	digestHTML := ""
+	if report.ResourceType == models.ReportResourceKPIScorecard {
+		scorecard, err := s.kpiService.BuildScorecard(report.ResourceID)
+		if err != nil {
+			run.Status = models.ReportRunFailed
+			errMsg := fmt.Sprintf("failed to build KPI scorecard: %v", err)
+			run.ErrorMessage = &errMsg
+			LogError("scheduled_report_generate", "Failed to build KPI scorecard digest", map[string]interface{}{
+				"report_id": report.ID,
+				"run_id":    run.ID,
+				"error":     err,
+			})
+			return
+		}
+		digestHTML = RenderScorecardHTML(scorecard)
+	}
+
 	// Build HTML body
 	bodyHTML := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -532,6 +562,7 @@ func (s *ScheduledReportService) generateAndSendReport(report models.ScheduledRe
         </div>
         <div class="content">
             <p>%s</p>
+            %s
             <p style="margin-top: 20px;">
                 <a href="%s" class="button">Download Report</a>
             </p>
@@ -545,7 +576,7 @@ func (s *ScheduledReportService) generateAndSendReport(report models.ScheduledRe
         </div>
     </div>
 </body>
-</html>`, report.Name, message, downloadURL, time.Now().Format("2006-01-02 15:04:05"))
+</html>`, report.Name, message, digestHTML, downloadURL, time.Now().Format("2006-01-02 15:04:05"))
 
 	// Prepare attachment
 	attachment := ReportAttachment{
@@ -630,6 +661,8 @@ func (s *ScheduledReportService) GenerateReport(report *models.ScheduledReport)
 		return s.generateDashboardReport(report, filePath, fileType)
 	case models.ReportResourceQuery:
 		return s.generateQueryReport(report, filePath, fileType)
+	case models.ReportResourceKPIScorecard:
+		return s.generateKPIScorecardReport(report, filePath, fileType)
 	default:
 		return "", 0, "", fmt.Errorf("unsupported resource type: %s", report.ResourceType)
 	}
@@ -685,6 +718,57 @@ func (s *ScheduledReportService) generateQueryReport(report *models.ScheduledRep
 	return filePath, info.Size(), fileType, nil
 }
 
+// generateKPIScorecardReport exports the KPI scorecard of a semantic model as CSV or Excel
+func (s *ScheduledReportService) generateKPIScorecardReport(report *models.ScheduledReport, filePath, fileType string) (string, int64, string, error) {
+	if err := validateReportFormat(report.ResourceType, report.Format); err != nil {
+		return "", 0, "", err
+	}
+	if s.kpiService == nil {
+		return "", 0, "", fmt.Errorf("KPI service is not configured")
+	}
+
+	scorecard, err := s.kpiService.BuildScorecard(report.ResourceID)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to build KPI scorecard: %w", err)
+	}
+
+	var content []byte
+	switch report.Format {
+	case models.ReportFormatExcel:
+		buf, err := RenderScorecardExcel(scorecard)
+		if err != nil {
+			return "", 0, "", fmt.Errorf("failed to render KPI scorecard: %w", err)
+		}
+		content = buf.Bytes()
+	default:
+		content = []byte(RenderScorecardCSV(scorecard))
+	}
+
+	if err := os.WriteFile(filePath, content, 0644); err != nil {
+		return "", 0, "", fmt.Errorf("failed to write report file: %w", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", 0, "", fmt.Errorf("failed to stat report file: %w", err)
+	}
+
+	return filePath, info.Size(), fileType, nil
+}
+
+// validateReportFormat rejects formats a resource type cannot be exported as
+func validateReportFormat(resourceType models.ReportResourceType, format models.ReportFormat) error {
+	if resourceType != models.ReportResourceKPIScorecard {
+		return nil
+	}
+	switch format {
+	case models.ReportFormatCSV, models.ReportFormatExcel:
+		return nil
+	default:
+		return fmt.Errorf("KPI scorecard reports support csv and excel formats, got %q", format)
+	}
+}
+
 // CalculateNextRun calculates the next run time for a scheduled report
 func (s *ScheduledReportService) CalculateNextRun(report *models.ScheduledReport) (*time.Time, error) {
 	// Load timezone
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================
+// Aggregate Awareness
+// Materialized views and rollup tables registered as pre-aggregated
+// sources of a semantic model; queries are routed to the smallest
+// aggregate that can answer them
+// ============================================================
+
+// Aggregate source types
+const (
+	AggregateSourceMaterializedView = "materialized_view"
+	AggregateSourceTable            = "table"
+)
+
+// Query sources reported with translated queries
+const (
+	QuerySourceBaseTable = "base_table"
+	QuerySourceAggregate = "aggregate"
+)
+
+// SemanticAggregate is a pre-aggregated copy of a semantic model's data
+type SemanticAggregate struct {
+	ID                 string    `gorm:"primaryKey" json:"id"`
+	ModelID            string    `gorm:"not null;index" json:"modelId"`
+	Name               string    `gorm:"not null" json:"name"`
+	SourceType         string    `gorm:"not null;default:'table'" json:"sourceType"` // materialized_view | table
+	MaterializedViewID *string   `gorm:"index" json:"materializedViewId,omitempty"`
+	Table              string    `gorm:"column:agg_table;not null" json:"table"`
+	Dimensions         string    `json:"dimensions"`                // JSON object: {"Region":"region"} (dimension name → aggregate column)
+	Measures           string    `json:"measures"`                  // JSON object: {"Revenue":{"column":"revenue","rollup":"sum"}}
+	TimeColumn         string    `json:"timeColumn,omitempty"`      // base-table time column the aggregate was grouped by
+	TimeKey            string    `json:"timeKey,omitempty"`         // aggregate column holding the period start
+	TimeGrain          TimeGrain `json:"timeGrain,omitempty"`       // grain of TimeKey
+	RowCount           int64     `gorm:"default:0" json:"rowCount"` // used to pick the smallest candidate
+	Disabled           bool      `gorm:"default:false" json:"disabled"`
+	CreatedAt          time.Time `json:"createdAt"`
+	UpdatedAt          time.Time `json:"updatedAt"`
+}
+
+func (SemanticAggregate) TableName() string { return "semantic_aggregates" }
+
+// AggregateMeasure describes how a metric is stored in an aggregate and rolled up further
+type AggregateMeasure struct {
+	Column      string `json:"column"`
+	Rollup      string `json:"rollup"`                // sum | count | min | max | avg | count_distinct
+	CountColumn string `json:"countColumn,omitempty"` // avg: column holding the row count behind Column's sum
+}
+
+// TranslatedQueryV2 is a translated semantic query together with the source it reads
+type TranslatedQueryV2 struct {
+	SQL           string        `json:"sql"`
+	Args          []interface{} `json:"args"`
+	Source        string        `json:"source"`     // base_table | aggregate
+	SourceName    string        `json:"sourceName"` // base table or aggregate name
+	AggregateID   string        `json:"aggregateId,omitempty"`
+	AggregateNote string        `json:"aggregateNote,omitempty"` // why no aggregate was used
+}
+
+func (a *SemanticAggregate) parse() (map[string]string, map[string]AggregateMeasure, error) {
+	dims := make(map[string]string)
+	measures := make(map[string]AggregateMeasure)
+	if a.Dimensions != "" {
+		if err := json.Unmarshal([]byte(a.Dimensions), &dims); err != nil {
+			return nil, nil, fmt.Errorf("invalid dimensions JSON: %w", err)
+		}
+	}
+	if a.Measures != "" {
+		if err := json.Unmarshal([]byte(a.Measures), &measures); err != nil {
+			return nil, nil, fmt.Errorf("invalid measures JSON: %w", err)
+		}
+	}
+	return dims, measures, nil
+}
+
+// Validate checks the aggregate definition
+func (a *SemanticAggregate) Validate() error {
+	if a.ModelID == "" || a.Name == "" {
+		return fmt.Errorf("model and name are required")
+	}
+	if !sqlIdentifierPattern.MatchString(a.Table) {
+		return fmt.Errorf("invalid aggregate table: %s", a.Table)
+	}
+
+	dims, measures, err := a.parse()
+	if err != nil {
+		return err
+	}
+	if len(measures) == 0 {
+		return fmt.Errorf("aggregate must store at least one measure")
+	}
+	for name, col := range dims {
+		if !sqlIdentifierPattern.MatchString(col) {
+			return fmt.Errorf("invalid column for dimension %s: %s", name, col)
+		}
+	}
+	for name, m := range measures {
+		if !sqlIdentifierPattern.MatchString(m.Column) {
+			return fmt.Errorf("invalid column for measure %s: %s", name, m.Column)
+		}
+		switch m.Rollup {
+		case "sum", "count", "min", "max", "count_distinct":
+		case "avg":
+			if !sqlIdentifierPattern.MatchString(m.CountColumn) {
+				return fmt.Errorf("avg measure %s requires a count column", name)
+			}
+		default:
+			return fmt.Errorf("unsupported rollup for measure %s: %s", name, m.Rollup)
+		}
+	}
+
+	if a.TimeKey != "" {
+		if a.TimeColumn == "" || !sqlIdentifierPattern.MatchString(a.TimeKey) {
+			return fmt.Errorf("time key requires a valid base time column")
+		}
+		switch a.TimeGrain {
+		case TimeGrainDay, TimeGrainWeek, TimeGrainMonth, TimeGrainQuarter, TimeGrainYear:
+		default:
+			return fmt.Errorf("invalid time grain: %s", a.TimeGrain)
+		}
+	}
+	return nil
+}
+
+// ---- Aggregate Operations ----
+
+// RegisterAggregate registers a materialized view or rollup table as an aggregate of a model
+func (s *SemanticLayerV2Service) RegisterAggregate(agg *SemanticAggregate) error {
+	var model models.SemanticModel
+	if err := s.db.First(&model, "id = ?", agg.ModelID).Error; err != nil {
+		return fmt.Errorf("model not found: %w", err)
+	}
+
+	if agg.SourceType == "" {
+		agg.SourceType = AggregateSourceTable
+	}
+	switch agg.SourceType {
+	case AggregateSourceMaterializedView:
+		if agg.MaterializedViewID == nil || *agg.MaterializedViewID == "" {
+			return fmt.Errorf("materialized view ID is required")
+		}
+		var mv models.MaterializedView
+		if err := s.db.First(&mv, "id = ?", *agg.MaterializedViewID).Error; err != nil {
+			return fmt.Errorf("materialized view not found: %w", err)
+		}
+		if mv.ConnectionID != model.DataSourceID {
+			return fmt.Errorf("materialized view %s does not live on the model's connection", mv.Name)
+		}
+		agg.Table = mv.TargetTable
+		agg.RowCount = mv.RowCount
+	case AggregateSourceTable:
+		agg.MaterializedViewID = nil
+	default:
+		return fmt.Errorf("unknown aggregate source type: %s", agg.SourceType)
+	}
+
+	if err := agg.Validate(); err != nil {
+		return err
+	}
+	if agg.ID == "" {
+		agg.ID = uuid.New().String()
+		return s.db.Create(agg).Error
+	}
+	var existing int64
+	if err := s.db.Model(&SemanticAggregate{}).Where("id = ? AND model_id = ?", agg.ID, agg.ModelID).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing == 0 {
+		return fmt.Errorf("aggregate %s not found in model %s", agg.ID, agg.ModelID)
+	}
+	return s.db.Save(agg).Error
+}
+
+// ListAggregates lists all aggregates registered for a model
+func (s *SemanticLayerV2Service) ListAggregates(modelID string) ([]SemanticAggregate, error) {
+	var aggs []SemanticAggregate
+	err := s.db.Where("model_id = ?", modelID).Order("name ASC").Find(&aggs).Error
+	return aggs, err
+}
+
+// DeleteAggregate removes an aggregate registration of a model
+func (s *SemanticLayerV2Service) DeleteAggregate(modelID string, id string) error {
+	result := s.db.Delete(&SemanticAggregate{}, "id = ? AND model_id = ?", id, modelID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ActiveAggregates returns the aggregates of a model that can currently serve queries.
+// Materialized views must have refreshed successfully; their row counts are kept in sync.
+func (s *SemanticLayerV2Service) ActiveAggregates(modelID string) ([]SemanticAggregate, error) {
+	var aggs []SemanticAggregate
+	if err := s.db.Where("model_id = ? AND disabled = ?", modelID, false).Find(&aggs).Error; err != nil {
+		return nil, err
+	}
+
+	active := aggs[:0]
+	for _, agg := range aggs {
+		if agg.SourceType == AggregateSourceMaterializedView && agg.MaterializedViewID != nil {
+			var mv models.MaterializedView
+			if err := s.db.First(&mv, "id = ?", *agg.MaterializedViewID).Error; err != nil {
+				continue
+			}
+			if mv.LastRefresh == nil || mv.Status == "error" {
+				continue
+			}
+			agg.Table = mv.TargetTable
+			agg.RowCount = mv.RowCount
+		}
+		active = append(active, agg)
+	}
+	return active, nil
+}
+
+// AggregatesForMaterializedView returns the aggregates backed by a materialized view
+func (s *SemanticLayerV2Service) AggregatesForMaterializedView(mvID string) ([]SemanticAggregate, error) {
+	var aggs []SemanticAggregate
+	err := s.db.Where("materialized_view_id = ?", mvID).Find(&aggs).Error
+	return aggs, err
+}
+
+// ---- Routing ----
+
+// routeToAggregate picks the smallest aggregate able to answer the query and
+// rewrites the query against it. It returns nil when the base table must be used.
+func routeToAggregate(query *SemanticQueryV2, model *SemanticModelLite) (*SemanticAggregate, *SemanticQueryV2, *SemanticModelLite, string) {
+	if len(model.Aggregates) == 0 {
+		return nil, nil, nil, ""
+	}
+
+	candidates := make([]SemanticAggregate, len(model.Aggregates))
+	copy(candidates, model.Aggregates)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ri, rj := aggregateSize(candidates[i]), aggregateSize(candidates[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return aggregateWidth(candidates[i]) < aggregateWidth(candidates[j])
+	})
+
+	note := ""
+	for i := range candidates {
+		agg := &candidates[i]
+		rewritten, lite, reason := rewriteForAggregate(query, model, agg)
+		if rewritten != nil {
+			return agg, rewritten, lite, ""
+		}
+		if note == "" {
+			note = fmt.Sprintf("%s: %s", agg.Name, reason)
+		}
+	}
+	return nil, nil, nil, note
+}
+
+func aggregateSize(agg SemanticAggregate) int64 {
+	if agg.RowCount <= 0 {
+		return math.MaxInt64 // unknown sizes are tried last
+	}
+	return agg.RowCount
+}
+
+// aggregateWidth counts stored dimensions; narrower aggregates are preferred on ties
+func aggregateWidth(agg SemanticAggregate) int {
+	dims, _, err := agg.parse()
+	if err != nil {
+		return math.MaxInt32
+	}
+	return len(dims)
+}
+
+// rewriteForAggregate maps the query onto an aggregate, or explains why it cannot
+func rewriteForAggregate(query *SemanticQueryV2, model *SemanticModelLite, agg *SemanticAggregate) (*SemanticQueryV2, *SemanticModelLite, string) {
+	dims, measures, err := agg.parse()
+	if err != nil {
+		return nil, nil, err.Error()
+	}
+
+	lite := &SemanticModelLite{
+		TableName: agg.Table,
+		DimMap:    make(map[string]string),
+		MetricMap: make(map[string]string),
+		Calendar:  model.Calendar,
+	}
+
+	groupDims := make(map[string]bool)
+	for _, name := range query.Dimensions {
+		col, ok := dims[name]
+		if !ok {
+			return nil, nil, fmt.Sprintf("dimension %s is not stored", name)
+		}
+		lite.DimMap[name] = col
+		groupDims[name] = true
+	}
+	for name := range query.Filters {
+		col, ok := dims[name]
+		if !ok {
+			return nil, nil, fmt.Sprintf("filter dimension %s is not stored", name)
+		}
+		lite.DimMap[name] = col
+	}
+
+	rewritten := *query
+	usesTime := query.TimeColumn != "" && (query.TimeGrain != "" || query.TimePeriods > 0 || query.TimeFrom != nil || query.TimeTo != nil)
+	if usesTime {
+		if agg.TimeKey == "" || agg.TimeColumn != query.TimeColumn {
+			return nil, nil, fmt.Sprintf("time column %s is not stored", query.TimeColumn)
+		}
+		if query.TimeGrain == "" || !aggregateServesGrain(agg.TimeGrain, query.TimeGrain, model.Calendar) {
+			return nil, nil, fmt.Sprintf("%s grain cannot be rolled up to %s", agg.TimeGrain, query.TimeGrain)
+		}
+		if query.TimePeriods > 0 && model.Calendar.calendarType() == CalendarGregorian {
+			return nil, nil, "rolling time windows do not align with aggregate periods"
+		}
+		// The range is applied to the period starts, so it must select whole periods
+		for _, bound := range []*time.Time{query.TimeFrom, query.TimeTo} {
+			if bound != nil && !model.Calendar.PeriodStart(agg.TimeGrain, *bound).Equal(*bound) {
+				return nil, nil, fmt.Sprintf("time range does not align with %s periods", agg.TimeGrain)
+			}
+		}
+		rewritten.TimeColumn = agg.TimeKey
+	} else if query.TimeColumn != "" {
+		rewritten.TimeColumn = ""
+	}
+
+	// Distinct counts cannot be re-aggregated, so they need the aggregate's exact grain
+	exactGrain := len(groupDims) == len(dims) && (agg.TimeKey == "" || (usesTime && query.TimeGrain == agg.TimeGrain))
+	for _, name := range query.Metrics {
+		m, ok := measures[name]
+		if !ok {
+			return nil, nil, fmt.Sprintf("measure %s is not stored", name)
+		}
+		switch m.Rollup {
+		case "sum", "count":
+			lite.MetricMap[name] = fmt.Sprintf("SUM(%s)", m.Column)
+		case "min":
+			lite.MetricMap[name] = fmt.Sprintf("MIN(%s)", m.Column)
+		case "max":
+			lite.MetricMap[name] = fmt.Sprintf("MAX(%s)", m.Column)
+		case "avg":
+			lite.MetricMap[name] = fmt.Sprintf("SUM(%s) * 1.0 / NULLIF(SUM(%s), 0)", m.Column, m.CountColumn)
+		case "count_distinct":
+			if !exactGrain {
+				return nil, nil, fmt.Sprintf("distinct count %s needs the aggregate's exact grain", name)
+			}
+			lite.MetricMap[name] = fmt.Sprintf("MAX(%s)", m.Column)
+		default:
+			return nil, nil, fmt.Sprintf("unsupported rollup %s", m.Rollup)
+		}
+	}
+
+	return &rewritten, lite, ""
+}
+
+// aggregateServesGrain reports whether every period of the query grain is a
+// union of whole aggregate periods under the calendar
+func aggregateServesGrain(aggGrain, queryGrain TimeGrain, cal *WorkspaceCalendar) bool {
+	if aggGrain == TimeGrainDay {
+		return true
+	}
+
+	switch cal.calendarType() {
+	case CalendarGregorian, CalendarFiscal:
+		shift := int(cal.startMonth()) - 1
+		switch aggGrain {
+		case TimeGrainWeek:
+			return queryGrain == TimeGrainWeek
+		case TimeGrainMonth:
+			return queryGrain == TimeGrainMonth || queryGrain == TimeGrainQuarter || queryGrain == TimeGrainYear
+		case TimeGrainQuarter:
+			return (queryGrain == TimeGrainQuarter || queryGrain == TimeGrainYear) && shift%3 == 0
+		case TimeGrainYear:
+			return queryGrain == TimeGrainYear && shift == 0
+		}
+	case CalendarRetail, CalendarISO:
+		// Week-based periods are built from whole Monday weeks only when the calendar starts weeks on Monday
+		return aggGrain == TimeGrainWeek && cal.weekStart() == time.Monday && queryGrain != TimeGrainDay
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package services_test
+
+import (
+	"insight-engine-backend/services"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func aggregateFixture() *services.SemanticModelLite {
+	return &services.SemanticModelLite{
+		TableName: "sales",
+		BaseTable: "sales",
+		DimMap:    map[string]string{"Region": "region", "Country": "country", "City": "city"},
+		MetricMap: map[string]string{"Revenue": "SUM(amount)", "Customers": "COUNT(DISTINCT customer_id)", "Avg Order": "AVG(amount)"},
+		Aggregates: []services.SemanticAggregate{
+			{
+				ID: "daily", Name: "Daily by region", Table: "agg_sales_daily", RowCount: 10000,
+				Dimensions: `{"Region":"region","Country":"country"}`,
+				Measures:   `{"Revenue":{"column":"revenue","rollup":"sum"},"Avg Order":{"column":"revenue","rollup":"avg","countColumn":"orders"}}`,
+				TimeColumn: "order_date", TimeKey: "order_day", TimeGrain: services.TimeGrainDay,
+			},
+			{
+				ID: "monthly", Name: "Monthly by region", Table: "agg_sales_monthly", RowCount: 500,
+				Dimensions: `{"Region":"region","Country":"country"}`,
+				Measures:   `{"Revenue":{"column":"revenue","rollup":"sum"},"Customers":{"column":"customers","rollup":"count_distinct"}}`,
+				TimeColumn: "order_date", TimeKey: "order_month", TimeGrain: services.TimeGrainMonth,
+			},
+			{
+				ID: "country", Name: "Monthly by country", Table: "agg_sales_country", RowCount: 50,
+				Dimensions: `{"Country":"country"}`,
+				Measures:   `{"Revenue":{"column":"revenue","rollup":"sum"}}`,
+				TimeColumn: "order_date", TimeKey: "order_month", TimeGrain: services.TimeGrainMonth,
+			},
+		},
+	}
+}
+
+func TestTranslateV2WithSource_AggregateRouting(t *testing.T) {
+	svc := services.NewSemanticLayerV2Service(nil)
+	retail := &services.WorkspaceCalendar{Type: services.CalendarRetail, FiscalYearStartMonth: 2, WeekPattern: "4-4-5"}
+	fiscal := &services.WorkspaceCalendar{Type: services.CalendarFiscal, FiscalYearStartMonth: 7}
+
+	tests := []struct {
+		name       string
+		query      services.SemanticQueryV2
+		calendar   *services.WorkspaceCalendar
+		source     string
+		sourceName string
+	}{
+		{"smallest aggregate with the dimension", services.SemanticQueryV2{Dimensions: []string{"Region"}, Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainQuarter}, nil, services.QuerySourceAggregate, "Monthly by region"},
+		{"narrowest aggregate wins", services.SemanticQueryV2{Dimensions: []string{"Country"}, Metrics: []string{"Revenue"}}, nil, services.QuerySourceAggregate, "Monthly by country"},
+		{"weekly grain needs daily data", services.SemanticQueryV2{Dimensions: []string{"Region"}, Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainWeek}, nil, services.QuerySourceAggregate, "Daily by region"},
+		{"fiscal quarters roll up months", services.SemanticQueryV2{Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainQuarter, TimePeriods: 4}, fiscal, services.QuerySourceAggregate, "Monthly by country"},
+		{"retail months need daily data", services.SemanticQueryV2{Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainMonth}, retail, services.QuerySourceAggregate, "Daily by region"},
+		{"rolling windows use the base table", services.SemanticQueryV2{Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainMonth, TimePeriods: 3}, nil, services.QuerySourceBaseTable, "sales"},
+		{"unknown dimension falls back", services.SemanticQueryV2{Dimensions: []string{"City"}, Metrics: []string{"Revenue"}}, nil, services.QuerySourceBaseTable, "sales"},
+		{"distinct counts at their exact grain", services.SemanticQueryV2{Dimensions: []string{"Region", "Country"}, Metrics: []string{"Customers"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainMonth}, nil, services.QuerySourceAggregate, "Monthly by region"},
+		{"distinct counts cannot roll up", services.SemanticQueryV2{Dimensions: []string{"Region"}, Metrics: []string{"Customers"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainMonth}, nil, services.QuerySourceBaseTable, "sales"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := aggregateFixture()
+			model.Calendar = tt.calendar
+			translated, err := svc.TranslateV2WithSource(&tt.query, model, "postgres")
+			require.NoError(t, err)
+			assert.Equal(t, tt.source, translated.Source)
+			assert.Equal(t, tt.sourceName, translated.SourceName)
+			if tt.source == services.QuerySourceBaseTable {
+				assert.NotEmpty(t, translated.AggregateNote)
+			}
+		})
+	}
+}
+
+func TestTranslateV2WithSource_RewritesMeasures(t *testing.T) {
+	svc := services.NewSemanticLayerV2Service(nil)
+	model := aggregateFixture()
+
+	translated, err := svc.TranslateV2WithSource(&services.SemanticQueryV2{
+		Dimensions: []string{"Region"},
+		Metrics:    []string{"Avg Order"},
+		Filters:    map[string]interface{}{"Country": "US"},
+		TimeColumn: "order_date",
+		TimeGrain:  services.TimeGrainMonth,
+	}, model, "postgres")
+	require.NoError(t, err)
+
+	assert.Equal(t, "daily", translated.AggregateID)
+	assert.Contains(t, translated.SQL, "FROM agg_sales_daily")
+	assert.Contains(t, translated.SQL, `SUM(revenue) * 1.0 / NULLIF(SUM(orders), 0) AS "Avg Order"`)
+	assert.Contains(t, translated.SQL, "DATE_TRUNC('month', order_day) AS time_period")
+	assert.Contains(t, translated.SQL, "country = ?")
+	assert.Equal(t, []interface{}{"US"}, translated.Args)
+}
+
+func TestTranslateV2WithSource_TimeRange(t *testing.T) {
+	svc := services.NewSemanticLayerV2Service(nil)
+	date := func(month time.Month, day int) *time.Time {
+		d := time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	query := func(from, to *time.Time) *services.SemanticQueryV2 {
+		return &services.SemanticQueryV2{Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: services.TimeGrainMonth, TimeFrom: from, TimeTo: to}
+	}
+
+	translated, err := svc.TranslateV2WithSource(query(date(1, 1), date(2, 1)), aggregateFixture(), "postgres")
+	require.NoError(t, err)
+	assert.Equal(t, "Monthly by country", translated.SourceName)
+	assert.Contains(t, translated.SQL, "WHERE order_month >= ? AND order_month < ?")
+	assert.Equal(t, []interface{}{*date(1, 1), *date(2, 1)}, translated.Args)
+
+	translated, err = svc.TranslateV2WithSource(query(date(1, 15), date(2, 15)), aggregateFixture(), "postgres")
+	require.NoError(t, err)
+	assert.Equal(t, "Daily by region", translated.SourceName, "a range within months needs daily data")
+
+	model := aggregateFixture()
+	model.Aggregates = nil
+	translated, err = svc.TranslateV2WithSource(query(date(1, 15), nil), model, "postgres")
+	require.NoError(t, err)
+	assert.Contains(t, translated.SQL, "FROM sales WHERE order_date >= ?")
+
+	ranged := query(date(1, 1), date(2, 1))
+	ranged.Comparison = "previous_period"
+	_, err = svc.TranslateV2WithSource(ranged, model, "postgres")
+	assert.ErrorContains(t, err, "time range")
+}
+
+func TestSemanticAggregate_Validate(t *testing.T) {
+	valid := services.SemanticAggregate{ModelID: "m1", Name: "a", Table: "agg", Measures: `{"Revenue":{"column":"revenue","rollup":"sum"}}`}
+	assert.NoError(t, valid.Validate())
+
+	noCount := valid
+	noCount.Measures = `{"Avg":{"column":"revenue","rollup":"avg"}}`
+	assert.Error(t, noCount.Validate())
+
+	badTable := valid
+	badTable.Table = "agg; DROP TABLE sales"
+	assert.Error(t, badTable.Validate())
+
+	noGrain := valid
+	noGrain.TimeColumn, noGrain.TimeKey = "order_date", "order_day"
+	assert.Error(t, noGrain.Validate())
+}
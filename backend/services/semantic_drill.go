@@ -0,0 +1,411 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"insight-engine-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// ============================================================
+// Semantic Drill Execution
+// Turns a click on a chart point into the next semantic query
+// (drill-down) or into the underlying detail rows (drill-through)
+// ============================================================
+
+const (
+	// DefaultDrillThroughRowCap is used when the caller does not request a row cap
+	DefaultDrillThroughRowCap = 500
+	// MaxDrillThroughRowCap is the hard upper bound for detail rows returned
+	MaxDrillThroughRowCap = 10000
+)
+
+// DrillRequest describes a drill action on a card backed by a semantic query
+type DrillRequest struct {
+	Query        SemanticQueryV2        `json:"query"`        // the card's current semantic query
+	HierarchyID  string                 `json:"hierarchyId"`  // hierarchy being drilled
+	CurrentLevel int                    `json:"currentLevel"` // level the clicked point belongs to
+	Members      map[string]interface{} `json:"members"`      // clicked member values keyed by dimension name
+	Breadcrumbs  []string               `json:"breadcrumbs,omitempty"`
+	RowCap       int                    `json:"rowCap,omitempty"` // drill-through only
+}
+
+// DrillDownResult is the drilled-down query together with its results
+type DrillDownResult struct {
+	Query      *SemanticQueryV2    `json:"query"`
+	Path       *DrillPath          `json:"path"`
+	SQL        string              `json:"sql"`
+	Args       []interface{}       `json:"args"`
+	Result     *models.QueryResult `json:"result"`
+	Source     string              `json:"source"`     // base_table | aggregate
+	SourceName string              `json:"sourceName"` // table or aggregate that answered the query
+}
+
+// DrillThroughResult holds the detail rows behind a clicked member
+type DrillThroughResult struct {
+	SQL       string              `json:"sql"`
+	Args      []interface{}       `json:"args"`
+	Result    *models.QueryResult `json:"result"`
+	RowCap    int                 `json:"rowCap"`
+	Truncated bool                `json:"truncated"`
+}
+
+// SemanticDrillService executes drill-down and drill-through actions
+type SemanticDrillService struct {
+	db            *gorm.DB
+	semanticV2    *SemanticLayerV2Service
+	queryExecutor QueryExecutorInterface
+	rlsService    *RLSService
+}
+
+// NewSemanticDrillService creates a new drill execution service
+func NewSemanticDrillService(db *gorm.DB, semanticV2 *SemanticLayerV2Service, queryExecutor QueryExecutorInterface, rlsService *RLSService) *SemanticDrillService {
+	return &SemanticDrillService{
+		db:            db,
+		semanticV2:    semanticV2,
+		queryExecutor: queryExecutor,
+		rlsService:    rlsService,
+	}
+}
+
+// DrillDown builds the next-level query for a clicked member and executes it
+func (s *SemanticDrillService) DrillDown(ctx context.Context, req *DrillRequest, workspaceID string, userCtx models.UserContext) (*DrillDownResult, error) {
+	hierarchy, err := s.semanticV2.GetHierarchy(req.HierarchyID)
+	if err != nil {
+		return nil, fmt.Errorf("hierarchy not found: %w", err)
+	}
+
+	model, conn, err := s.loadModelAndConnection(workspaceID, req.Query.ModelID, hierarchy.ModelID)
+	if err != nil {
+		return nil, err
+	}
+
+	drilled, breadcrumbs, err := BuildDrillDownQuery(req, hierarchy, model)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := s.semanticV2.ResolveDrillPath(hierarchy.ID, drilled.DrillLevel, breadcrumbs)
+	if err != nil {
+		return nil, err
+	}
+
+	lite, err := s.securedModel(model, conn, userCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	translated, err := s.semanticV2.TranslateV2WithSource(drilled, lite, conn.Type)
+	if err != nil {
+		return nil, err
+	}
+	sql := rebindPlaceholders(translated.SQL, conn.Type)
+
+	result, err := s.queryExecutor.Execute(ctx, conn, sql, translated.Args, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("drill-down query failed: %w", err)
+	}
+
+	return &DrillDownResult{
+		Query:      drilled,
+		Path:       path,
+		SQL:        sql,
+		Args:       translated.Args,
+		Result:     result,
+		Source:     translated.Source,
+		SourceName: translated.SourceName,
+	}, nil
+}
+
+// DrillThrough returns the underlying detail rows for a clicked member
+func (s *SemanticDrillService) DrillThrough(ctx context.Context, req *DrillRequest, workspaceID string, userCtx models.UserContext) (*DrillThroughResult, error) {
+	model, conn, err := s.loadModelAndConnection(workspaceID, req.Query.ModelID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	rowCap := req.RowCap
+	if rowCap <= 0 {
+		rowCap = DefaultDrillThroughRowCap
+	}
+	if rowCap > MaxDrillThroughRowCap {
+		rowCap = MaxDrillThroughRowCap
+	}
+
+	lite, err := s.securedModel(model, conn, userCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	var selectParts []string
+	for _, dim := range model.Dimensions {
+		if dim.IsHidden {
+			continue
+		}
+		selectParts = append(selectParts, fmt.Sprintf("%s AS \"%s\"", dim.ColumnName, dim.Name))
+	}
+	if len(selectParts) == 0 {
+		return nil, fmt.Errorf("model %s has no visible dimensions to drill through", model.Name)
+	}
+
+	filters := mergeDrillFilters(req.Query.Filters, req.Members)
+
+	var whereParts []string
+	var args []interface{}
+	if req.Query.TimeColumn != "" && req.Query.TimePeriods > 0 {
+		whereParts = append(whereParts, s.semanticV2.BuildCalendarTimeFilter(req.Query.TimeColumn, req.Query.TimeGrain, req.Query.TimePeriods, conn.Type, lite.Calendar))
+	}
+	for _, dimName := range sortedKeys(filters) {
+		col, ok := lite.DimMap[dimName]
+		if !ok {
+			return nil, fmt.Errorf("filter dimension not found: %s", dimName)
+		}
+		whereParts = append(whereParts, fmt.Sprintf("%s = ?", col))
+		args = append(args, filters[dimName])
+	}
+
+	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectParts, ", "), lite.TableName)
+	if len(whereParts) > 0 {
+		sql += " WHERE " + strings.Join(whereParts, " AND ")
+	}
+	// Fetch one extra row so truncation can be reported without a COUNT(*)
+	sql = rebindPlaceholders(limitSourceQuery(conn.Type, sql, rowCap+1), conn.Type)
+
+	result, err := s.queryExecutor.Execute(ctx, conn, sql, args, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("drill-through query failed: %w", err)
+	}
+
+	truncated := false
+	if result != nil && len(result.Rows) > rowCap {
+		result.Rows = result.Rows[:rowCap]
+		result.RowCount = rowCap
+		truncated = true
+	}
+
+	return &DrillThroughResult{
+		SQL:       sql,
+		Args:      args,
+		Result:    result,
+		RowCap:    rowCap,
+		Truncated: truncated,
+	}, nil
+}
+
+// BuildDrillDownQuery derives the next-level query from the current one.
+// The clicked members become equality filters, the levels at or above the
+// clicked level are removed from the dimensions, and the next level is added.
+func BuildDrillDownQuery(req *DrillRequest, hierarchy *SemanticHierarchy, model *models.SemanticModel) (*SemanticQueryV2, []string, error) {
+	totalLevels := len(hierarchy.Levels)
+	if req.CurrentLevel < 0 || req.CurrentLevel >= totalLevels {
+		return nil, nil, fmt.Errorf("level %d out of range (0-%d)", req.CurrentLevel, totalLevels-1)
+	}
+	if req.CurrentLevel+1 >= totalLevels {
+		return nil, nil, fmt.Errorf("hierarchy %s is already at its lowest level", hierarchy.Name)
+	}
+
+	levelNames := make([]string, totalLevels)
+	for i, level := range hierarchy.Levels {
+		name, err := resolveDimensionName(model, level.DimensionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		levelNames[i] = name
+	}
+
+	currentDim := levelNames[req.CurrentLevel]
+	clicked, ok := req.Members[currentDim]
+	if !ok {
+		return nil, nil, fmt.Errorf("clicked member value for dimension %s is required", currentDim)
+	}
+
+	drilled := req.Query
+	drilled.Filters = mergeDrillFilters(req.Query.Filters, req.Members)
+
+	// Ancestor levels are pinned by filters, so they no longer need grouping
+	pinned := make(map[string]bool)
+	for i := 0; i <= req.CurrentLevel; i++ {
+		pinned[levelNames[i]] = true
+	}
+	nextDim := levelNames[req.CurrentLevel+1]
+
+	drilled.Dimensions = nil
+	hasNext := false
+	for _, dim := range req.Query.Dimensions {
+		if pinned[dim] {
+			continue
+		}
+		if dim == nextDim {
+			hasNext = true
+		}
+		drilled.Dimensions = append(drilled.Dimensions, dim)
+	}
+	if !hasNext {
+		drilled.Dimensions = append([]string{nextDim}, drilled.Dimensions...)
+	}
+
+	// A sort on a removed dimension would reference a missing alias
+	if pinned[drilled.SortColumn] {
+		drilled.SortColumn = ""
+		drilled.SortOrder = ""
+	}
+
+	drilled.DrillHierarchy = hierarchy.ID
+	drilled.DrillLevel = req.CurrentLevel + 1
+
+	breadcrumbs := append(append([]string{}, req.Breadcrumbs...), fmt.Sprintf("%v", clicked))
+
+	return &drilled, breadcrumbs, nil
+}
+
+// loadModelAndConnection loads the semantic model of a workspace and the
+// connection it queries. When expectedModelID is set, the query must target
+// that model.
+func (s *SemanticDrillService) loadModelAndConnection(workspaceID, modelID, expectedModelID string) (*models.SemanticModel, *models.Connection, error) {
+	return loadSemanticModel(s.db, workspaceID, modelID, expectedModelID)
+}
+
+func loadSemanticModel(db *gorm.DB, workspaceID, modelID, expectedModelID string) (*models.SemanticModel, *models.Connection, error) {
+	if modelID == "" {
+		modelID = expectedModelID
+	}
+	if modelID == "" {
+		return nil, nil, fmt.Errorf("model ID is required")
+	}
+	if expectedModelID != "" && modelID != expectedModelID {
+		return nil, nil, fmt.Errorf("hierarchy does not belong to model %s", modelID)
+	}
+
+	var model models.SemanticModel
+	if err := db.Preload("Dimensions").Preload("Metrics").First(&model, "id = ? AND workspace_id = ?", modelID, workspaceID).Error; err != nil {
+		return nil, nil, fmt.Errorf("model not found: %w", err)
+	}
+
+	var conn models.Connection
+	if err := db.Where("id = ?", model.DataSourceID).First(&conn).Error; err != nil {
+		return nil, nil, fmt.Errorf("connection not found: %w", err)
+	}
+
+	return &model, &conn, nil
+}
+
+// securedModel returns a lite model whose source is wrapped with the user's RLS conditions
+func (s *SemanticDrillService) securedModel(model *models.SemanticModel, conn *models.Connection, userCtx models.UserContext) (*SemanticModelLite, error) {
+	return secureSemanticModel(s.semanticV2, s.rlsService, model, conn, userCtx)
+}
+
+// secureSemanticModel builds the lite model with the workspace calendar and the
+// model's aggregates, wrapping the source with the user's RLS conditions.
+// Aggregates are skipped when RLS applies, since they may not carry the filtered columns.
+func secureSemanticModel(semanticV2 *SemanticLayerV2Service, rlsService *RLSService, model *models.SemanticModel, conn *models.Connection, userCtx models.UserContext) (*SemanticModelLite, error) {
+	lite := NewSemanticModelLite(model)
+	if semanticV2 != nil {
+		cal, err := semanticV2.GetWorkspaceCalendar(model.WorkspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load workspace calendar: %w", err)
+		}
+		lite.Calendar = cal
+	}
+
+	if rlsService != nil {
+		base := fmt.Sprintf("SELECT * FROM %s", model.Table)
+		secured, err := rlsService.ApplyRLSToQuery(base, userCtx, conn.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply row-level security: %w", err)
+		}
+		if secured != base {
+			alias := model.Table
+			if idx := strings.LastIndex(alias, "."); idx != -1 {
+				alias = alias[idx+1:]
+			}
+			lite.TableName = fmt.Sprintf("(%s) AS %s", secured, alias)
+			return lite, nil
+		}
+	}
+
+	if semanticV2 != nil {
+		aggs, err := semanticV2.ActiveAggregates(model.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load aggregates: %w", err)
+		}
+		lite.Aggregates = aggs
+	}
+	return lite, nil
+}
+
+// NewSemanticModelLite builds the lightweight translation model from a full semantic model
+func NewSemanticModelLite(model *models.SemanticModel) *SemanticModelLite {
+	lite := &SemanticModelLite{
+		TableName: model.Table,
+		BaseTable: model.Table,
+		DimMap:    make(map[string]string, len(model.Dimensions)),
+		MetricMap: make(map[string]string, len(model.Metrics)),
+	}
+	for _, dim := range model.Dimensions {
+		lite.DimMap[dim.Name] = dim.ColumnName
+	}
+	for _, metric := range model.Metrics {
+		lite.MetricMap[metric.Name] = metric.Formula
+	}
+	return lite
+}
+
+// resolveDimensionName maps a hierarchy level's dimension reference (ID or name) to its name
+func resolveDimensionName(model *models.SemanticModel, ref string) (string, error) {
+	for _, dim := range model.Dimensions {
+		if dim.ID == ref || dim.Name == ref {
+			return dim.Name, nil
+		}
+	}
+	return "", fmt.Errorf("hierarchy level references unknown dimension: %s", ref)
+}
+
+// mergeDrillFilters overlays clicked member values on top of existing filters
+func mergeDrillFilters(filters, members map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(filters)+len(members))
+	for k, v := range filters {
+		merged[k] = v
+	}
+	for k, v := range members {
+		merged[k] = v
+	}
+	return merged
+}
+
+// sortedKeys returns map keys in a stable order so generated SQL is deterministic
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// rebindPlaceholders converts '?' placeholders to the positional form used by the dialect
+func rebindPlaceholders(sql, dialect string) string {
+	if dialect != "postgres" && dialect != "postgresql" {
+		return sql
+	}
+
+	var b strings.Builder
+	inString := false
+	n := 0
+	for _, r := range sql {
+		switch {
+		case r == '\'':
+			inString = !inString
+			b.WriteRune(r)
+		case r == '?' && !inString:
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package services_test
+
+import (
+	"insight-engine-backend/models"
+	"insight-engine-backend/services"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func drillFixture() (*services.SemanticHierarchy, *models.SemanticModel) {
+	model := &models.SemanticModel{
+		ID:    "m1",
+		Table: "sales",
+		Dimensions: []models.SemanticDimension{
+			{ID: "d-country", Name: "Country", ColumnName: "country"},
+			{ID: "d-region", Name: "Region", ColumnName: "region"},
+			{ID: "d-city", Name: "City", ColumnName: "city"},
+			{ID: "d-channel", Name: "Channel", ColumnName: "channel"},
+		},
+		Metrics: []models.SemanticMetric{
+			{Name: "Revenue", Formula: "SUM(amount)"},
+		},
+	}
+	hierarchy := &services.SemanticHierarchy{
+		ID:      "h1",
+		ModelID: "m1",
+		Name:    "Geography",
+		Levels: []services.SemanticHierarchyLevel{
+			{DimensionID: "d-country", LevelOrder: 0},
+			{DimensionID: "d-region", LevelOrder: 1},
+			{DimensionID: "City", LevelOrder: 2}, // levels may reference dimensions by name
+		},
+	}
+	return hierarchy, model
+}
+
+func TestBuildDrillDownQuery_AddsNextLevelAndFilters(t *testing.T) {
+	hierarchy, model := drillFixture()
+
+	req := &services.DrillRequest{
+		Query: services.SemanticQueryV2{
+			ModelID:    "m1",
+			Dimensions: []string{"Country", "Channel"},
+			Metrics:    []string{"Revenue"},
+			Filters:    map[string]interface{}{"Channel": "Online"},
+			SortColumn: "Country",
+		},
+		HierarchyID:  "h1",
+		CurrentLevel: 0,
+		Members:      map[string]interface{}{"Country": "USA"},
+	}
+
+	drilled, breadcrumbs, err := services.BuildDrillDownQuery(req, hierarchy, model)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Region", "Channel"}, drilled.Dimensions)
+	assert.Equal(t, "USA", drilled.Filters["Country"])
+	assert.Equal(t, "Online", drilled.Filters["Channel"])
+	assert.Equal(t, 1, drilled.DrillLevel)
+	assert.Equal(t, "h1", drilled.DrillHierarchy)
+	assert.Empty(t, drilled.SortColumn, "sort on a pinned level must be dropped")
+	assert.Equal(t, []string{"USA"}, breadcrumbs)
+
+	// The card's original query must not be mutated
+	assert.Equal(t, []string{"Country", "Channel"}, req.Query.Dimensions)
+	assert.NotContains(t, req.Query.Filters, "Country")
+
+	sql, args, err := services.NewSemanticLayerV2Service(nil).TranslateV2(drilled, services.NewSemanticModelLite(model), "postgres")
+	require.NoError(t, err)
+	assert.Contains(t, sql, `region AS "Region"`)
+	assert.Contains(t, sql, "country = ?")
+	assert.Len(t, args, 2)
+}
+
+func TestBuildDrillDownQuery_Errors(t *testing.T) {
+	hierarchy, model := drillFixture()
+
+	tests := []struct {
+		name    string
+		level   int
+		members map[string]interface{}
+	}{
+		{"lowest level", 2, map[string]interface{}{"City": "LA"}},
+		{"out of range", 5, map[string]interface{}{"City": "LA"}},
+		{"missing clicked member", 1, map[string]interface{}{"Country": "USA"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &services.DrillRequest{HierarchyID: "h1", CurrentLevel: tt.level, Members: tt.members}
+			_, _, err := services.BuildDrillDownQuery(req, hierarchy, model)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -10,13 +10,19 @@ import (
 )
 
 type SemanticLayerService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	metricRegistry *MetricRegistryService
 }
 
 func NewSemanticLayerService(db *gorm.DB) *SemanticLayerService {
 	return &SemanticLayerService{db: db}
 }
 
+// SetMetricRegistry registers model metrics in the shared metric registry on every write
+func (s *SemanticLayerService) SetMetricRegistry(registry *MetricRegistryService) {
+	s.metricRegistry = registry
+}
+
 // GetModelByID retrieves a semantic model with its dimensions and metrics
 func (s *SemanticLayerService) GetModelByID(modelID string) (*models.SemanticModel, error) {
 	var model models.SemanticModel
@@ -111,31 +117,7 @@ func (s *SemanticLayerService) TranslateSemanticQuery(
 
 // ValidateMetricFormula validates a metric formula
 func (s *SemanticLayerService) ValidateMetricFormula(formula string) error {
-	// Basic validation: check for allowed aggregation functions
-	allowedFunctions := []string{"SUM", "AVG", "COUNT", "MIN", "MAX", "COUNT(DISTINCT"}
-
-	upperFormula := strings.ToUpper(formula)
-	hasValidFunction := false
-	for _, fn := range allowedFunctions {
-		if strings.Contains(upperFormula, fn) {
-			hasValidFunction = true
-			break
-		}
-	}
-
-	if !hasValidFunction {
-		return fmt.Errorf("formula must contain a valid aggregation function (SUM, AVG, COUNT, MIN, MAX)")
-	}
-
-	// Check for dangerous SQL keywords
-	dangerousKeywords := []string{"DROP", "DELETE", "UPDATE", "INSERT", "ALTER", "CREATE", "EXEC", "EXECUTE"}
-	for _, keyword := range dangerousKeywords {
-		if strings.Contains(upperFormula, keyword) {
-			return fmt.Errorf("formula contains forbidden keyword: %s", keyword)
-		}
-	}
-
-	return nil
+	return ValidateMetricFormula(formula)
 }
 
 // ListModelsByWorkspace retrieves all models for a workspace
@@ -156,7 +138,13 @@ func (s *SemanticLayerService) CreateModel(model *models.SemanticModel) error {
 		}
 	}
 
-	return s.db.Create(model).Error
+	if err := s.db.Create(model).Error; err != nil {
+		return err
+	}
+	if s.metricRegistry != nil {
+		s.metricRegistry.SyncSemanticModel(model)
+	}
+	return nil
 }
 
 // ListMetricsByModel retrieves all metrics for a model
@@ -185,10 +173,22 @@ func (s *SemanticLayerService) UpdateModel(model *models.SemanticModel) error {
 	}
 
 	// Use FullSaveAssociations to update the model and its nested dimensions and metrics
-	return s.db.Session(&gorm.Session{FullSaveAssociations: true}).Save(model).Error
+	if err := s.db.Session(&gorm.Session{FullSaveAssociations: true}).Save(model).Error; err != nil {
+		return err
+	}
+	if s.metricRegistry != nil {
+		s.metricRegistry.SyncSemanticModel(model)
+	}
+	return nil
 }
 
 // DeleteModel deletes a semantic model
 func (s *SemanticLayerService) DeleteModel(id string) error {
-	return s.db.Delete(&models.SemanticModel{}, "id = ?", id).Error
+	if err := s.db.Delete(&models.SemanticModel{}, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if s.metricRegistry != nil {
+		return s.metricRegistry.UnbindSemanticModel(id)
+	}
+	return nil
 }
@@ -6,6 +6,10 @@ import (
 	"strings"
 	"time"
 
+	"insight-engine-backend/models"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
 	"gorm.io/gorm"
 )
 
@@ -45,21 +49,33 @@ func (SemanticHierarchyLevel) TableName() string { return "semantic_hierarchy_le
 
 // SemanticKPI is a goal-oriented metric with targets, thresholds, and trend
 type SemanticKPI struct {
-	ID                string    `gorm:"primaryKey" json:"id"`
-	ModelID           string    `gorm:"not null;index" json:"modelId"`
-	Name              string    `gorm:"not null" json:"name"`
-	Description       string    `json:"description"`
-	MetricID          string    `gorm:"not null" json:"metricId"` // FK to SemanticMetric
-	TargetValue       *float64  `json:"targetValue,omitempty"`
-	WarningThreshold  *float64  `json:"warningThreshold,omitempty"`                  // amber zone
-	CriticalThreshold *float64  `json:"criticalThreshold,omitempty"`                 // red zone
-	Direction         string    `gorm:"default:'higher_is_better'" json:"direction"` // higher_is_better | lower_is_better
-	TrendPeriod       string    `json:"trendPeriod,omitempty"`                       // day, week, month, quarter, year
-	Unit              string    `json:"unit,omitempty"`                              // $, %, units
-	Owner             string    `json:"owner,omitempty"`                             // team/person responsible
-	Tags              string    `json:"tags,omitempty"`                              // comma-separated tags
-	CreatedAt         time.Time `json:"createdAt"`
-	UpdatedAt         time.Time `json:"updatedAt"`
+	ID                string   `gorm:"primaryKey" json:"id"`
+	ModelID           string   `gorm:"not null;index" json:"modelId"`
+	Name              string   `gorm:"not null" json:"name"`
+	Description       string   `json:"description"`
+	MetricID          string   `gorm:"not null" json:"metricId"` // FK to SemanticMetric
+	TargetValue       *float64 `json:"targetValue,omitempty"`
+	WarningThreshold  *float64 `json:"warningThreshold,omitempty"`                  // amber zone
+	CriticalThreshold *float64 `json:"criticalThreshold,omitempty"`                 // red zone
+	Direction         string   `gorm:"default:'higher_is_better'" json:"direction"` // higher_is_better | lower_is_better
+	TrendPeriod       string   `json:"trendPeriod,omitempty"`                       // day, week, month, quarter, year
+	Unit              string   `json:"unit,omitempty"`                              // $, %, units
+	Owner             string   `json:"owner,omitempty"`                             // team/person responsible
+	Tags              string   `json:"tags,omitempty"`                              // comma-separated tags
+
+	// Evaluation engine
+	TimeColumn      string     `json:"timeColumn,omitempty"`                // column used to scope each TrendPeriod
+	Schedule        string     `json:"schedule,omitempty"`                  // cron expression, empty = manual only
+	LastEvaluatedAt *time.Time `json:"lastEvaluatedAt,omitempty"`           // last scheduled or manual evaluation
+	ParentKPIID     *string    `gorm:"index" json:"parentKpiId,omitempty"`  // KPI tree
+	RollupMethod    string     `gorm:"default:'worst'" json:"rollupMethod"` // worst | weighted
+	Weight          float64    `gorm:"default:1" json:"weight"`             // contribution to a weighted parent
+	TargetTable     string     `json:"targetTable,omitempty"`               // optional table of time-varying targets
+	TargetDateCol   string     `json:"targetDateColumn,omitempty"`          // effective-from column in TargetTable
+	TargetValueCol  string     `json:"targetValueColumn,omitempty"`         // target column in TargetTable
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 func (SemanticKPI) TableName() string { return "semantic_kpis" }
@@ -220,10 +236,82 @@ func (s *SemanticLayerV2Service) DeleteHierarchy(id string) error {
 
 // CreateKPI defines a new KPI
 func (s *SemanticLayerV2Service) CreateKPI(kpi *SemanticKPI) error {
+	if err := s.validateKPI(kpi); err != nil {
+		return err
+	}
+	if kpi.ID == "" {
+		kpi.ID = uuid.New().String()
+	}
+	return s.db.Create(kpi).Error
+}
+
+// validateKPI checks a KPI before it is saved
+func (s *SemanticLayerV2Service) validateKPI(kpi *SemanticKPI) error {
 	if kpi.MetricID == "" {
 		return fmt.Errorf("KPI must reference a metric")
 	}
-	return s.db.Create(kpi).Error
+	if err := validateKPITrendPeriod(kpi.TrendPeriod); err != nil {
+		return err
+	}
+	if err := validateKPIColumns(kpi); err != nil {
+		return err
+	}
+	if kpi.Schedule != "" {
+		if _, err := cron.ParseStandard(kpi.Schedule); err != nil {
+			return fmt.Errorf("invalid KPI schedule: %w", err)
+		}
+	}
+
+	var metrics int64
+	if err := s.db.Model(&models.SemanticMetric{}).Where("id = ? AND model_id = ?", kpi.MetricID, kpi.ModelID).Count(&metrics).Error; err != nil {
+		return fmt.Errorf("failed to look up metric: %w", err)
+	}
+	if metrics == 0 {
+		return fmt.Errorf("metric %s does not belong to the KPI's model", kpi.MetricID)
+	}
+	return s.validateKPIParent(kpi)
+}
+
+// validateKPIColumns checks the table and column names the KPI's queries embed
+func validateKPIColumns(kpi *SemanticKPI) error {
+	for _, name := range []string{kpi.TimeColumn, kpi.TargetTable, kpi.TargetDateCol, kpi.TargetValueCol} {
+		if name != "" && !sqlIdentifierPattern.MatchString(name) {
+			return fmt.Errorf("invalid KPI table or column name: %s", name)
+		}
+	}
+	if kpi.TargetTable != "" && (kpi.TargetDateCol == "" || kpi.TargetValueCol == "") {
+		return fmt.Errorf("a KPI target table needs a date column and a value column")
+	}
+	return nil
+}
+
+// validateKPIParent rejects parent links that would create a cycle in the KPI tree
+func (s *SemanticLayerV2Service) validateKPIParent(kpi *SemanticKPI) error {
+	if kpi.ParentKPIID == nil || *kpi.ParentKPIID == "" {
+		return nil
+	}
+
+	seen := map[string]bool{kpi.ID: true}
+	parentID := *kpi.ParentKPIID
+	for parentID != "" {
+		if seen[parentID] {
+			return fmt.Errorf("KPI parent %s would create a cycle", *kpi.ParentKPIID)
+		}
+		seen[parentID] = true
+
+		parent, err := s.GetKPI(parentID)
+		if err != nil {
+			return fmt.Errorf("parent KPI not found: %w", err)
+		}
+		if parent.ModelID != kpi.ModelID {
+			return fmt.Errorf("parent KPI must belong to the same model")
+		}
+		parentID = ""
+		if parent.ParentKPIID != nil {
+			parentID = *parent.ParentKPIID
+		}
+	}
+	return nil
 }
 
 // GetKPI retrieves a KPI by ID
@@ -302,6 +390,9 @@ func (s *SemanticLayerV2Service) EvaluateKPIStatus(kpi *SemanticKPI, currentValu
 
 // UpdateKPI updates an existing KPI
 func (s *SemanticLayerV2Service) UpdateKPI(kpi *SemanticKPI) error {
+	if err := s.validateKPI(kpi); err != nil {
+		return err
+	}
 	return s.db.Save(kpi).Error
 }
 
@@ -409,11 +500,13 @@ func (s *SemanticLayerV2Service) BuildTimeFilter(columnName string, grain TimeGr
 		dialect = "postgres"
 	}
 
-	switch dialect {
+	switch normalizeSQLDialect(dialect) {
 	case "postgres":
 		return s.buildPostgresTimeFilter(columnName, grain, periodsBack)
 	case "mysql":
 		return s.buildMySQLTimeFilter(columnName, grain, periodsBack)
+	case "sqlserver", "oracle", "snowflake", "bigquery", "sqlite":
+		return s.buildRollingTimeFilter(normalizeSQLDialect(dialect), columnName, grain, periodsBack)
 	default:
 		return s.buildPostgresTimeFilter(columnName, grain, periodsBack)
 	}
@@ -459,10 +552,58 @@ func (s *SemanticLayerV2Service) buildMySQLTimeFilter(col string, grain TimeGrai
 	return fmt.Sprintf("%s >= DATE_SUB(NOW(), INTERVAL %d %s)", col, count, unit)
 }
 
+// buildRollingTimeFilter covers the remaining dialects with day and month arithmetic
+func (s *SemanticLayerV2Service) buildRollingTimeFilter(d string, col string, grain TimeGrain, periods int) string {
+	days, months := 0, 0
+	switch grain {
+	case TimeGrainWeek:
+		days = periods * 7
+	case TimeGrainMonth:
+		months = periods
+	case TimeGrainQuarter:
+		months = periods * 3
+	case TimeGrainYear:
+		months = periods * 12
+	default:
+		days = periods
+	}
+
+	switch d {
+	case "sqlserver":
+		if months > 0 {
+			return fmt.Sprintf("%s >= DATEADD(month, -%d, GETDATE())", col, months)
+		}
+		return fmt.Sprintf("%s >= DATEADD(day, -%d, GETDATE())", col, days)
+	case "oracle":
+		if months > 0 {
+			return fmt.Sprintf("%s >= ADD_MONTHS(SYSDATE, -%d)", col, months)
+		}
+		return fmt.Sprintf("%s >= SYSDATE - %d", col, days)
+	case "snowflake":
+		if months > 0 {
+			return fmt.Sprintf("%s >= DATEADD(month, -%d, CURRENT_TIMESTAMP())", col, months)
+		}
+		return fmt.Sprintf("%s >= DATEADD(day, -%d, CURRENT_TIMESTAMP())", col, days)
+	case "bigquery":
+		if months > 0 {
+			return fmt.Sprintf("DATE(%s) >= DATE_SUB(CURRENT_DATE(), INTERVAL %d MONTH)", col, months)
+		}
+		return fmt.Sprintf("DATE(%s) >= DATE_SUB(CURRENT_DATE(), INTERVAL %d DAY)", col, days)
+	default: // sqlite
+		if months > 0 {
+			return fmt.Sprintf("%s >= datetime('now', '-%d months')", col, months)
+		}
+		return fmt.Sprintf("%s >= datetime('now', '-%d days')", col, days)
+	}
+}
+
 // BuildTimeGroupBy generates a date_trunc expression for grouping
 func (s *SemanticLayerV2Service) BuildTimeGroupBy(columnName string, grain TimeGrain, dialect string) string {
-	if dialect == "" || dialect == "postgres" {
+	switch d := normalizeSQLDialect(dialect); d {
+	case "postgres":
 		return fmt.Sprintf("DATE_TRUNC('%s', %s)", string(grain), columnName)
+	case "sqlserver", "oracle", "snowflake", "bigquery", "sqlite":
+		return sqlTruncDate(d, grain, columnName)
 	}
 	// MySQL
 	switch grain {
@@ -497,24 +638,70 @@ type SemanticQueryV2 struct {
 	SortColumn     string                 `json:"sortColumn,omitempty"`
 	SortOrder      string                 `json:"sortOrder,omitempty"`
 	Limit          int                    `json:"limit,omitempty"`
+	Comparison     string                 `json:"comparison,omitempty"` // previous_period | previous_year
+	TimeFrom       *time.Time             `json:"timeFrom,omitempty"`   // TimeColumn range [TimeFrom, TimeTo)
+	TimeTo         *time.Time             `json:"timeTo,omitempty"`
 }
 
 // TranslateV2 translates an enhanced semantic query to SQL
 func (s *SemanticLayerV2Service) TranslateV2(query *SemanticQueryV2, model *SemanticModelLite, dialect string) (string, []interface{}, error) {
+	translated, err := s.TranslateV2WithSource(query, model, dialect)
+	if err != nil {
+		return "", nil, err
+	}
+	return translated.SQL, translated.Args, nil
+}
+
+// TranslateV2WithSource translates a semantic query, routing it to the smallest
+// registered aggregate that can answer it and falling back to the base table
+func (s *SemanticLayerV2Service) TranslateV2WithSource(query *SemanticQueryV2, model *SemanticModelLite, dialect string) (*TranslatedQueryV2, error) {
 	if model == nil {
-		return "", nil, fmt.Errorf("model is required")
+		return nil, fmt.Errorf("model is required")
+	}
+
+	agg, rewritten, aggModel, note := routeToAggregate(query, model)
+	if agg != nil {
+		sql, args, err := s.translateV2(rewritten, aggModel, dialect)
+		if err == nil {
+			return &TranslatedQueryV2{
+				SQL:         sql,
+				Args:        args,
+				Source:      QuerySourceAggregate,
+				SourceName:  agg.Name,
+				AggregateID: agg.ID,
+			}, nil
+		}
+		note = fmt.Sprintf("%s: %v", agg.Name, err)
 	}
 
+	sql, args, err := s.translateV2(query, model, dialect)
+	if err != nil {
+		return nil, err
+	}
+	sourceName := model.BaseTable
+	if sourceName == "" {
+		sourceName = model.TableName
+	}
+	return &TranslatedQueryV2{
+		SQL:           sql,
+		Args:          args,
+		Source:        QuerySourceBaseTable,
+		SourceName:    sourceName,
+		AggregateNote: note,
+	}, nil
+}
+
+func (s *SemanticLayerV2Service) translateV2(query *SemanticQueryV2, model *SemanticModelLite, dialect string) (string, []interface{}, error) {
+
 	var selectParts []string
 	var groupByParts []string
-	var whereParts []string
+	var filterParts []string
 	var args []interface{}
 
-	// Add time grouping if specified
+	// Time grouping comes first; its expression depends on the side of a comparison
+	timeExpr := ""
 	if query.TimeColumn != "" && query.TimeGrain != "" {
-		timeExpr := s.BuildTimeGroupBy(query.TimeColumn, query.TimeGrain, dialect)
-		selectParts = append(selectParts, fmt.Sprintf("%s AS time_period", timeExpr))
-		groupByParts = append(groupByParts, timeExpr)
+		timeExpr = s.BuildCalendarTimeGroupBy(query.TimeColumn, query.TimeGrain, dialect, model.Calendar)
 	}
 
 	// Add dimensions
@@ -536,33 +723,97 @@ func (s *SemanticLayerV2Service) TranslateV2(query *SemanticQueryV2, model *Sema
 		selectParts = append(selectParts, fmt.Sprintf("%s AS \"%s\"", formula, metricName))
 	}
 
-	if len(selectParts) == 0 {
+	if len(selectParts) == 0 && timeExpr == "" {
 		return "", nil, fmt.Errorf("no dimensions or metrics specified")
 	}
 
-	sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(selectParts, ", "), model.TableName)
-
-	// Add time filter
-	if query.TimeColumn != "" && query.TimePeriods > 0 {
-		whereParts = append(whereParts, s.BuildTimeFilter(query.TimeColumn, query.TimeGrain, query.TimePeriods, dialect))
-	}
-
 	// Add regular filters
 	for dimName, value := range query.Filters {
 		col, ok := model.DimMap[dimName]
 		if !ok {
 			return "", nil, fmt.Errorf("filter dimension not found: %s", dimName)
 		}
-		whereParts = append(whereParts, fmt.Sprintf("%s = ?", col))
+		filterParts = append(filterParts, fmt.Sprintf("%s = ?", col))
 		args = append(args, value)
 	}
+	if query.TimeColumn != "" && query.TimeFrom != nil {
+		filterParts = append(filterParts, fmt.Sprintf("%s >= ?", query.TimeColumn))
+		args = append(args, *query.TimeFrom)
+	}
+	if query.TimeColumn != "" && query.TimeTo != nil {
+		filterParts = append(filterParts, fmt.Sprintf("%s < ?", query.TimeColumn))
+		args = append(args, *query.TimeTo)
+	}
+
+	// aggregate groups the model's rows by period (timeExpr) and dimensions,
+	// keeping the rows timeFilter selects
+	aggregate := func(timeExpr string, timeFilter string) string {
+		parts, groupBy := selectParts, groupByParts
+		if timeExpr != "" {
+			parts = append([]string{fmt.Sprintf("%s AS time_period", timeExpr)}, parts...)
+			groupBy = append([]string{timeExpr}, groupBy...)
+		}
+		sql := fmt.Sprintf("SELECT %s FROM %s", strings.Join(parts, ", "), model.TableName)
+		where := filterParts
+		if timeFilter != "" {
+			where = append([]string{timeFilter}, where...)
+		}
+		if len(where) > 0 {
+			sql += " WHERE " + strings.Join(where, " AND ")
+		}
+		if len(groupBy) > 0 {
+			sql += " GROUP BY " + strings.Join(groupBy, ", ")
+		}
+		return sql
+	}
 
-	if len(whereParts) > 0 {
-		sql += " WHERE " + strings.Join(whereParts, " AND ")
+	timeFilter := ""
+	if query.TimeColumn != "" && query.TimePeriods > 0 {
+		timeFilter = s.BuildCalendarTimeFilter(query.TimeColumn, query.TimeGrain, query.TimePeriods, dialect, model.Calendar)
 	}
+	sql := aggregate(timeExpr, timeFilter)
 
-	if len(groupByParts) > 0 {
-		sql += " GROUP BY " + strings.Join(groupByParts, ", ")
+	// Period-over-period: join each period to the one it is compared with in
+	// the workspace calendar. The compared rows are read over a range
+	// reaching back far enough to cover the earliest period shown.
+	if query.Comparison != "" {
+		if query.TimeColumn == "" || query.TimeGrain == "" {
+			return "", nil, fmt.Errorf("comparison requires a time column and grain")
+		}
+		if query.TimeFrom != nil || query.TimeTo != nil {
+			return "", nil, fmt.Errorf("comparison does not support a time range")
+		}
+		cmp, err := s.comparePeriods(query.Comparison, query.TimeGrain, dialect, model.Calendar)
+		if err != nil {
+			return "", nil, err
+		}
+
+		prevTime, key := timeExpr, "base.time_period"
+		if cmp.shift != nil {
+			prevTime = s.BuildCalendarTimeGroupBy(cmp.shift(query.TimeColumn), query.TimeGrain, dialect, model.Calendar)
+		} else {
+			key = cmp.mapKey(key)
+		}
+		prevFilter := ""
+		if query.TimePeriods > 0 {
+			prevFilter = s.BuildCalendarTimeFilter(query.TimeColumn, query.TimeGrain, query.TimePeriods+cmp.lookback, dialect, model.Calendar)
+		}
+
+		on := []string{"prev.time_period = " + key}
+		for _, dimName := range query.Dimensions {
+			on = append(on, fmt.Sprintf("(prev.\"%s\" = base.\"%s\" OR (prev.\"%s\" IS NULL AND base.\"%s\" IS NULL))", dimName, dimName, dimName, dimName))
+		}
+		outer := []string{"base.*"}
+		for _, metricName := range query.Metrics {
+			prev := fmt.Sprintf("prev.\"%s\"", metricName)
+			outer = append(outer,
+				fmt.Sprintf("%s AS \"%s_prev\"", prev, metricName),
+				fmt.Sprintf("(base.\"%s\" - %s) * 100.0 / NULLIF(%s, 0) AS \"%s_change_pct\"", metricName, prev, prev, metricName),
+			)
+		}
+		sql = fmt.Sprintf("SELECT %s FROM (%s) base LEFT JOIN (%s) prev ON %s",
+			strings.Join(outer, ", "), sql, aggregate(prevTime, prevFilter), strings.Join(on, " AND "))
+		args = append(args, args...) // the filters are bound once per side
 	}
 
 	// Sort
@@ -589,9 +840,12 @@ func (s *SemanticLayerV2Service) TranslateV2(query *SemanticQueryV2, model *Sema
 // SemanticModelLite is a lightweight model representation
 // for query translation (avoids full GORM loading)
 type SemanticModelLite struct {
-	TableName string
-	DimMap    map[string]string // dim name → column
-	MetricMap map[string]string // metric name → formula
+	TableName  string
+	BaseTable  string              // physical table when TableName is wrapped (e.g. by RLS)
+	DimMap     map[string]string   // dim name → column
+	MetricMap  map[string]string   // metric name → formula
+	Calendar   *WorkspaceCalendar  // optional workspace calendar for time intelligence
+	Aggregates []SemanticAggregate // optional pre-aggregated sources to route to
 }
 
 // ---- Migration Helper ----
@@ -602,6 +856,10 @@ func (s *SemanticLayerV2Service) AutoMigrateV2() error {
 		&SemanticHierarchy{},
 		&SemanticHierarchyLevel{},
 		&SemanticKPI{},
+		&SemanticKPITarget{},
+		&SemanticKPISnapshot{},
 		&SemanticPerspective{},
+		&WorkspaceCalendar{},
+		&SemanticAggregate{},
 	)
 }
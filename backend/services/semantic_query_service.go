@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// SemanticQueryResult is an executed semantic query with the source that answered it
+type SemanticQueryResult struct {
+	TranslatedQueryV2
+	Result   *models.QueryResult `json:"result"`
+	Cached   bool                `json:"cached"`
+	CachedAt *time.Time          `json:"cachedAt,omitempty"`
+}
+
+// SemanticQueryService executes semantic queries with aggregate routing, RLS and
+// result caching keyed by model so definition changes and aggregate refreshes
+// invalidate exactly the affected entries
+type SemanticQueryService struct {
+	db            *gorm.DB
+	semanticV2    *SemanticLayerV2Service
+	queryExecutor QueryExecutorInterface
+	rlsService    *RLSService
+	queryCache    *QueryCache
+}
+
+// NewSemanticQueryService creates a new semantic query execution service
+func NewSemanticQueryService(db *gorm.DB, semanticV2 *SemanticLayerV2Service, queryExecutor QueryExecutorInterface, rlsService *RLSService, queryCache *QueryCache) *SemanticQueryService {
+	return &SemanticQueryService{
+		db:            db,
+		semanticV2:    semanticV2,
+		queryExecutor: queryExecutor,
+		rlsService:    rlsService,
+		queryCache:    queryCache,
+	}
+}
+
+// Execute translates and runs a semantic query of a workspace for a user
+func (s *SemanticQueryService) Execute(ctx context.Context, query *SemanticQueryV2, workspaceID string, userCtx models.UserContext) (*SemanticQueryResult, error) {
+	model, conn, err := loadSemanticModel(s.db, workspaceID, query.ModelID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	lite, err := secureSemanticModel(s.semanticV2, s.rlsService, model, conn, userCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	translated, err := s.semanticV2.TranslateV2WithSource(query, lite, conn.Type)
+	if err != nil {
+		return nil, err
+	}
+	translated.SQL = rebindPlaceholders(translated.SQL, conn.Type)
+
+	// The SQL already embeds the user's RLS conditions and the chosen source,
+	// so it is a safe cache key across users with identical visibility
+	var cacheKey string
+	if s.queryCache != nil {
+		cacheKey = s.queryCache.GenerateRawQueryCacheKey("semantic:"+model.ID, translated.SQL, translated.Args, nil, nil)
+		if cached, err := s.queryCache.GetCachedResultWithMetadata(ctx, cacheKey); err == nil && cached != nil {
+			cachedAt := cached.CachedAt
+			return &SemanticQueryResult{
+				TranslatedQueryV2: *translated,
+				Result:            cached.Result,
+				Cached:            true,
+				CachedAt:          &cachedAt,
+			}, nil
+		}
+	}
+
+	result, err := s.queryExecutor.Execute(ctx, conn, translated.SQL, translated.Args, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("semantic query failed: %w", err)
+	}
+
+	if s.queryCache != nil && result.Error == nil {
+		tags := []string{semanticModelCacheTag(model.ID), fmt.Sprintf("conn:%s", conn.ID)}
+		if translated.AggregateID != "" {
+			tags = append(tags, semanticAggregateCacheTag(translated.AggregateID))
+		}
+		if err := s.queryCache.SetCachedResultWithMetadata(ctx, cacheKey, result, tags); err != nil {
+			LogWarn("semantic_query_cache", "Failed to cache semantic query result", map[string]interface{}{"model_id": model.ID, "error": err.Error()})
+		}
+	}
+
+	return &SemanticQueryResult{
+		TranslatedQueryV2: *translated,
+		Result:            result,
+	}, nil
+}
+
+// InvalidateModel drops cached results of a semantic model (e.g. after its definition changed)
+func (s *SemanticQueryService) InvalidateModel(ctx context.Context, modelID string) error {
+	if s.queryCache == nil {
+		return nil
+	}
+	return s.queryCache.InvalidateTag(ctx, semanticModelCacheTag(modelID))
+}
+
+// InvalidateMaterializedView drops cached results answered by aggregates backed by a materialized view
+func (s *SemanticQueryService) InvalidateMaterializedView(ctx context.Context, mvID string) error {
+	if s.queryCache == nil {
+		return nil
+	}
+	aggs, err := s.semanticV2.AggregatesForMaterializedView(mvID)
+	if err != nil {
+		return err
+	}
+	for _, agg := range aggs {
+		if err := s.queryCache.InvalidateTag(ctx, semanticAggregateCacheTag(agg.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func semanticModelCacheTag(modelID string) string { return "semantic:" + modelID }
+
+func semanticAggregateCacheTag(aggregateID string) string { return "semantic_agg:" + aggregateID }
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"insight-engine-backend/database"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// setupTestDB points database.DB at a SQLite file database for the test,
+// migrated with the given models. A file rather than an in-memory database
+// gives runs several connections: loads keep a transaction open while other
+// queries go on.
+func setupTestDB(t *testing.T, migrate ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	require.NoError(t, db.AutoMigrate(migrate...))
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+	return db
+}
@@ -0,0 +1,772 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"insight-engine-backend/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ============================================================
+// Time Intelligence Calendars
+// Workspace-level fiscal, retail (4-4-5), ISO and custom calendars
+// used by time grains, "last N periods" filters and comparisons
+// ============================================================
+
+// CalendarType selects how periods are derived from dates
+type CalendarType string
+
+const (
+	CalendarGregorian CalendarType = "gregorian" // calendar months, Monday weeks
+	CalendarFiscal    CalendarType = "fiscal"    // calendar months, year starts at FiscalYearStartMonth
+	CalendarRetail    CalendarType = "retail"    // 52/53-week years split 4-4-5, 4-5-4 or 5-4-4
+	CalendarISO       CalendarType = "iso"       // ISO-8601 week-numbering years (4-4-5 months)
+	CalendarCustom    CalendarType = "custom"    // periods read from a calendar table in the data source
+)
+
+// How many years around "now" are expanded when week-based periods are rendered as SQL
+const (
+	calendarYearsBack    = 10
+	calendarYearsForward = 2
+)
+
+// calendarNow is the clock used for period arithmetic (overridable in tests)
+var calendarNow = time.Now
+
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// WorkspaceCalendar is the time intelligence calendar of a workspace
+type WorkspaceCalendar struct {
+	ID                   string       `gorm:"primaryKey" json:"id"`
+	WorkspaceID          string       `gorm:"not null;uniqueIndex" json:"workspaceId"`
+	Name                 string       `json:"name"`
+	Type                 CalendarType `gorm:"not null;default:'gregorian'" json:"type"`
+	FiscalYearStartMonth int          `gorm:"default:1" json:"fiscalYearStartMonth"` // 1 = January … 12 = December
+	WeekPattern          string       `gorm:"default:'4-4-5'" json:"weekPattern"`    // retail: 4-4-5 | 4-5-4 | 5-4-4
+	WeekStartDay         int          `gorm:"default:0" json:"weekStartDay"`         // retail: 0 = Sunday … 6 = Saturday
+	CustomTable          string       `json:"customTable,omitempty"`
+	CustomDateColumn     string       `json:"customDateColumn,omitempty"`
+	CustomGrainColumns   string       `json:"customGrainColumns,omitempty"` // JSON: {"month":"fiscal_month_start", ...}
+	CreatedAt            time.Time    `json:"createdAt"`
+	UpdatedAt            time.Time    `json:"updatedAt"`
+}
+
+func (WorkspaceCalendar) TableName() string { return "workspace_calendars" }
+
+// Validate checks the calendar definition
+func (c *WorkspaceCalendar) Validate() error {
+	if c.FiscalYearStartMonth == 0 {
+		c.FiscalYearStartMonth = 1
+	}
+	if c.FiscalYearStartMonth < 1 || c.FiscalYearStartMonth > 12 {
+		return fmt.Errorf("fiscal year start month must be between 1 and 12")
+	}
+
+	switch c.Type {
+	case CalendarGregorian, CalendarFiscal, CalendarISO:
+	case CalendarRetail:
+		if c.WeekPattern == "" {
+			c.WeekPattern = "4-4-5"
+		}
+		if _, err := parseWeekPattern(c.WeekPattern); err != nil {
+			return err
+		}
+		if c.WeekStartDay < 0 || c.WeekStartDay > 6 {
+			return fmt.Errorf("week start day must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	case CalendarCustom:
+		if !sqlIdentifierPattern.MatchString(c.CustomTable) || !sqlIdentifierPattern.MatchString(c.CustomDateColumn) {
+			return fmt.Errorf("custom calendars require a valid table and date column")
+		}
+		columns, err := c.grainColumns()
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			return fmt.Errorf("custom calendars must map at least one time grain to a column")
+		}
+		for grain, col := range columns {
+			if !sqlIdentifierPattern.MatchString(col) {
+				return fmt.Errorf("invalid column for grain %s: %s", grain, col)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown calendar type: %s", c.Type)
+	}
+	return nil
+}
+
+// ---- Calendar Operations ----
+
+// GetWorkspaceCalendar returns the workspace calendar, or nil when the workspace uses the Gregorian default
+func (s *SemanticLayerV2Service) GetWorkspaceCalendar(workspaceID string) (*WorkspaceCalendar, error) {
+	var cal WorkspaceCalendar
+	err := s.db.Where("workspace_id = ?", workspaceID).First(&cal).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cal, nil
+}
+
+// SaveWorkspaceCalendar creates or replaces the calendar of a workspace
+func (s *SemanticLayerV2Service) SaveWorkspaceCalendar(cal *WorkspaceCalendar) error {
+	if cal.WorkspaceID == "" {
+		return fmt.Errorf("workspace is required")
+	}
+	if cal.Type == "" {
+		cal.Type = CalendarGregorian
+	}
+	if err := cal.Validate(); err != nil {
+		return err
+	}
+
+	existing, err := s.GetWorkspaceCalendar(cal.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		cal.ID = existing.ID
+		cal.CreatedAt = existing.CreatedAt
+		return s.db.Save(cal).Error
+	}
+	cal.ID = uuid.New().String()
+	return s.db.Create(cal).Error
+}
+
+// CalendarForModel returns the calendar of the workspace owning a semantic model
+func (s *SemanticLayerV2Service) CalendarForModel(modelID string) (*WorkspaceCalendar, error) {
+	var model models.SemanticModel
+	if err := s.db.Select("id", "workspace_id").First(&model, "id = ?", modelID).Error; err != nil {
+		return nil, err
+	}
+	return s.GetWorkspaceCalendar(model.WorkspaceID)
+}
+
+// ---- Period arithmetic ----
+// A nil calendar behaves like the Gregorian calendar.
+
+// PeriodStart returns the start of the period containing t
+func (c *WorkspaceCalendar) PeriodStart(grain TimeGrain, t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if c.weekBased() {
+		return c.weekBasedPeriodStart(grain, day)
+	}
+
+	switch grain {
+	case TimeGrainWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case TimeGrainMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	case TimeGrainQuarter:
+		monthStart := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		offset := (int(day.Month()) - int(c.startMonth()) + 12) % 12
+		return monthStart.AddDate(0, -(offset % 3), 0)
+	case TimeGrainYear:
+		year := day.Year()
+		if day.Month() < c.startMonth() {
+			year--
+		}
+		return time.Date(year, c.startMonth(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
+
+// AddPeriods moves a period start n periods forward (or backward for negative n)
+func (c *WorkspaceCalendar) AddPeriods(grain TimeGrain, start time.Time, n int) time.Time {
+	if c.weekBased() && (grain == TimeGrainMonth || grain == TimeGrainQuarter || grain == TimeGrainYear) {
+		current := c.PeriodStart(grain, start)
+		for ; n > 0; n-- {
+			current = c.weekBasedPeriodEnd(grain, current)
+		}
+		for ; n < 0; n++ {
+			current = c.PeriodStart(grain, current.AddDate(0, 0, -1))
+		}
+		return current
+	}
+
+	switch grain {
+	case TimeGrainWeek:
+		return start.AddDate(0, 0, 7*n)
+	case TimeGrainMonth:
+		return start.AddDate(0, n, 0)
+	case TimeGrainQuarter:
+		return start.AddDate(0, 3*n, 0)
+	case TimeGrainYear:
+		return start.AddDate(0, 12*n, 0)
+	default:
+		return start.AddDate(0, 0, n)
+	}
+}
+
+// PeriodBounds returns the [start, end) period containing t
+func (c *WorkspaceCalendar) PeriodBounds(grain TimeGrain, t time.Time) (time.Time, time.Time) {
+	start := c.PeriodStart(grain, t)
+	return start, c.AddPeriods(grain, start, 1)
+}
+
+func (c *WorkspaceCalendar) calendarType() CalendarType {
+	if c == nil || c.Type == "" {
+		return CalendarGregorian
+	}
+	return c.Type
+}
+
+func (c *WorkspaceCalendar) weekBased() bool {
+	t := c.calendarType()
+	return t == CalendarRetail || t == CalendarISO
+}
+
+func (c *WorkspaceCalendar) startMonth() time.Month {
+	switch {
+	case c.calendarType() == CalendarISO:
+		return time.January
+	case c == nil || c.calendarType() == CalendarGregorian || c.FiscalYearStartMonth < 1 || c.FiscalYearStartMonth > 12:
+		return time.January
+	default:
+		return time.Month(c.FiscalYearStartMonth)
+	}
+}
+
+func (c *WorkspaceCalendar) weekStart() time.Weekday {
+	if c.calendarType() == CalendarISO {
+		return time.Monday
+	}
+	return time.Weekday(c.WeekStartDay)
+}
+
+func (c *WorkspaceCalendar) weekPattern() [3]int {
+	if c.calendarType() == CalendarRetail {
+		if pattern, err := parseWeekPattern(c.WeekPattern); err == nil {
+			return pattern
+		}
+	}
+	return [3]int{4, 4, 5}
+}
+
+// weekBasedYearStart returns the first day of a 52/53-week year: the week start
+// day nearest to the first of the start month (ISO: the Monday nearest Jan 1).
+func (c *WorkspaceCalendar) weekBasedYearStart(year int, loc *time.Location) time.Time {
+	anchor := time.Date(year, c.startMonth(), 1, 0, 0, 0, 0, loc)
+	diff := (int(c.weekStart()) - int(anchor.Weekday()) + 7) % 7
+	if diff > 3 {
+		diff -= 7
+	}
+	return anchor.AddDate(0, 0, diff)
+}
+
+func (c *WorkspaceCalendar) weekBasedYear(day time.Time) (int, time.Time) {
+	year := day.Year()
+	start := c.weekBasedYearStart(year, day.Location())
+	if day.Before(start) {
+		year--
+		start = c.weekBasedYearStart(year, day.Location())
+	} else if next := c.weekBasedYearStart(year+1, day.Location()); !day.Before(next) {
+		year++
+		start = next
+	}
+	return year, start
+}
+
+func (c *WorkspaceCalendar) weekBasedPeriodStart(grain TimeGrain, day time.Time) time.Time {
+	switch grain {
+	case TimeGrainDay:
+		return day
+	case TimeGrainWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) - int(c.weekStart()) + 7) % 7))
+	}
+
+	_, yearStart := c.weekBasedYear(day)
+	if grain == TimeGrainYear {
+		return yearStart
+	}
+
+	weeks := daysBetween(yearStart, day) / 7
+	quarter := weeks / 13
+	if quarter > 3 {
+		quarter = 3 // week 53 belongs to the last quarter
+	}
+	if grain == TimeGrainQuarter {
+		return yearStart.AddDate(0, 0, quarter*13*7)
+	}
+
+	pattern := c.weekPattern()
+	within := weeks - quarter*13
+	offset := 0
+	for m := 0; m < 2 && within >= offset+pattern[m]; m++ {
+		offset += pattern[m]
+	}
+	return yearStart.AddDate(0, 0, (quarter*13+offset)*7)
+}
+
+// weekBasedPeriodEnd returns the start of the period following periodStart
+func (c *WorkspaceCalendar) weekBasedPeriodEnd(grain TimeGrain, periodStart time.Time) time.Time {
+	year, yearStart := c.weekBasedYear(periodStart)
+	nextYear := c.weekBasedYearStart(year+1, periodStart.Location())
+
+	var end time.Time
+	switch grain {
+	case TimeGrainYear:
+		return nextYear
+	case TimeGrainQuarter:
+		end = periodStart.AddDate(0, 0, 13*7)
+	default:
+		weeks := daysBetween(yearStart, periodStart) / 7
+		within := weeks % 13
+		pattern := c.weekPattern()
+		length := pattern[2]
+		if within < pattern[0] {
+			length = pattern[0]
+		} else if within < pattern[0]+pattern[1] {
+			length = pattern[1]
+		}
+		end = periodStart.AddDate(0, 0, length*7)
+	}
+
+	// The extra week of a 53-week year is absorbed by the year's last period
+	if !end.Before(nextYear.AddDate(0, 0, -7)) {
+		return nextYear
+	}
+	return end
+}
+
+func (c *WorkspaceCalendar) grainColumns() (map[string]string, error) {
+	columns := make(map[string]string)
+	if c == nil || c.CustomGrainColumns == "" {
+		return columns, nil
+	}
+	if err := json.Unmarshal([]byte(c.CustomGrainColumns), &columns); err != nil {
+		return nil, fmt.Errorf("invalid customGrainColumns JSON: %w", err)
+	}
+	return columns, nil
+}
+
+func parseWeekPattern(pattern string) ([3]int, error) {
+	switch pattern {
+	case "4-4-5":
+		return [3]int{4, 4, 5}, nil
+	case "4-5-4":
+		return [3]int{4, 5, 4}, nil
+	case "5-4-4":
+		return [3]int{5, 4, 4}, nil
+	default:
+		return [3]int{}, fmt.Errorf("week pattern must be 4-4-5, 4-5-4 or 5-4-4, got %q", pattern)
+	}
+}
+
+func daysBetween(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+// ---- SQL generation ----
+
+// BuildCalendarTimeGroupBy generates a period-start expression that honours the calendar
+func (s *SemanticLayerV2Service) BuildCalendarTimeGroupBy(columnName string, grain TimeGrain, dialect string, cal *WorkspaceCalendar) string {
+	d := normalizeSQLDialect(dialect)
+
+	switch cal.calendarType() {
+	case CalendarFiscal:
+		shift := int(cal.startMonth()) - 1
+		if shift == 0 || (grain != TimeGrainQuarter && grain != TimeGrainYear) {
+			break
+		}
+		shifted := sqlAddMonths(d, columnName, -shift)
+		return sqlAddMonths(d, sqlTruncDate(d, grain, shifted), shift)
+
+	case CalendarRetail, CalendarISO:
+		switch grain {
+		case TimeGrainDay:
+			return sqlTruncDate(d, TimeGrainDay, columnName)
+		case TimeGrainWeek:
+			// Weeks are counted from a fixed anchor that falls on the calendar's week start day
+			anchor := sqlDateLiteral(d, time.Date(1900, 1, 1+(int(cal.weekStart())+6)%7, 0, 0, 0, 0, time.UTC))
+			index := sqlIntDiv(d, sqlDiffDays(d, columnName, anchor), 7)
+			return sqlAddDays(d, anchor, fmt.Sprintf("(%s) * 7", index))
+		default:
+			return cal.periodCaseExpr(d, grain, columnName)
+		}
+
+	case CalendarCustom:
+		columns, err := cal.grainColumns()
+		if err == nil && columns[string(grain)] != "" {
+			return fmt.Sprintf("(SELECT cal.%s FROM %s cal WHERE cal.%s = %s)",
+				columns[string(grain)], cal.CustomTable, cal.CustomDateColumn, sqlTruncDate(d, TimeGrainDay, columnName))
+		}
+	}
+
+	return s.BuildTimeGroupBy(columnName, grain, dialect)
+}
+
+// BuildCalendarTimeFilter generates a "last N periods" filter that honours the calendar.
+// For non-Gregorian calendars the window covers the current period and the N-1 before it.
+func (s *SemanticLayerV2Service) BuildCalendarTimeFilter(columnName string, grain TimeGrain, periodsBack int, dialect string, cal *WorkspaceCalendar) string {
+	if periodsBack < 1 {
+		periodsBack = 1
+	}
+	d := normalizeSQLDialect(dialect)
+
+	switch cal.calendarType() {
+	case CalendarGregorian:
+		return s.BuildTimeFilter(columnName, grain, periodsBack, dialect)
+
+	case CalendarCustom:
+		columns, err := cal.grainColumns()
+		col := columns[string(grain)]
+		if err != nil || col == "" {
+			return s.BuildTimeFilter(columnName, grain, periodsBack, dialect)
+		}
+		today := sqlCurrentDate(d)
+		return fmt.Sprintf("%s >= (SELECT MIN(c1.%s) FROM %s c1 WHERE c1.%s <= %s AND (SELECT COUNT(DISTINCT c2.%s) FROM %s c2 WHERE c2.%s > c1.%s AND c2.%s <= %s) < %d)",
+			columnName, col, cal.CustomTable, col, today, col, cal.CustomTable, col, col, col, today, periodsBack)
+
+	default:
+		current := cal.PeriodStart(grain, calendarNow())
+		start := cal.AddPeriods(grain, current, -(periodsBack - 1))
+		end := cal.AddPeriods(grain, current, 1)
+		return fmt.Sprintf("%s >= %s AND %s < %s", columnName, sqlDateLiteral(d, start), columnName, sqlDateLiteral(d, end))
+	}
+}
+
+// periodCaseExpr maps dates onto week-based period starts with explicit ranges
+func (c *WorkspaceCalendar) periodCaseExpr(d string, grain TimeGrain, col string) string {
+	now := calendarNow()
+	first := c.weekBasedYearStart(now.Year()-calendarYearsBack, time.UTC)
+	last := c.weekBasedYearStart(now.Year()+calendarYearsForward+1, time.UTC)
+
+	var b strings.Builder
+	b.WriteString("CASE")
+	for start := first; start.Before(last); {
+		end := c.AddPeriods(grain, start, 1)
+		fmt.Fprintf(&b, " WHEN %s >= %s AND %s < %s THEN %s", col, sqlDateLiteral(d, start), col, sqlDateLiteral(d, end), sqlDateLiteral(d, start))
+		start = end
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// normalizeSQLDialect maps connection types onto the dialects time intelligence knows.
+// Unknown types return "" so callers can keep their historical fallback.
+func normalizeSQLDialect(dialect string) string {
+	switch strings.ToLower(dialect) {
+	case "", "postgres", "postgresql":
+		return "postgres"
+	case "mysql", "mariadb":
+		return "mysql"
+	case "sqlserver", "mssql":
+		return "sqlserver"
+	case "oracle":
+		return "oracle"
+	case "snowflake":
+		return "snowflake"
+	case "bigquery":
+		return "bigquery"
+	case "sqlite", "sqlite_memory", "duckdb":
+		return "sqlite"
+	default:
+		return ""
+	}
+}
+
+func sqlDateLiteral(d string, t time.Time) string {
+	date := t.Format("2006-01-02")
+	switch d {
+	case "sqlserver":
+		return fmt.Sprintf("CAST('%s' AS DATE)", date)
+	case "sqlite":
+		return fmt.Sprintf("'%s'", date)
+	default:
+		return fmt.Sprintf("DATE '%s'", date)
+	}
+}
+
+func sqlCurrentDate(d string) string {
+	switch d {
+	case "sqlserver":
+		return "CAST(GETDATE() AS DATE)"
+	case "oracle":
+		return "TRUNC(SYSDATE)"
+	case "bigquery":
+		return "CURRENT_DATE()"
+	case "sqlite":
+		return "date('now')"
+	default:
+		return "CURRENT_DATE"
+	}
+}
+
+// sqlTruncDate truncates a date/time expression to the start of a Gregorian period
+func sqlTruncDate(d string, grain TimeGrain, col string) string {
+	switch d {
+	case "mysql":
+		switch grain {
+		case TimeGrainWeek:
+			return fmt.Sprintf("DATE(DATE_SUB(%s, INTERVAL WEEKDAY(%s) DAY))", col, col)
+		case TimeGrainMonth:
+			return fmt.Sprintf("DATE(DATE_FORMAT(%s, '%%Y-%%m-01'))", col)
+		case TimeGrainQuarter:
+			return fmt.Sprintf("MAKEDATE(YEAR(%s), 1) + INTERVAL QUARTER(%s) - 1 QUARTER", col, col)
+		case TimeGrainYear:
+			return fmt.Sprintf("MAKEDATE(YEAR(%s), 1)", col)
+		default:
+			return fmt.Sprintf("DATE(%s)", col)
+		}
+	case "sqlserver":
+		switch grain {
+		case TimeGrainWeek:
+			return fmt.Sprintf("DATEADD(day, -((DATEPART(weekday, %s) + @@DATEFIRST - 2) %% 7), CAST(%s AS DATE))", col, col)
+		case TimeGrainMonth:
+			return fmt.Sprintf("DATEFROMPARTS(YEAR(%s), MONTH(%s), 1)", col, col)
+		case TimeGrainQuarter:
+			return fmt.Sprintf("DATEFROMPARTS(YEAR(%s), (DATEPART(quarter, %s) - 1) * 3 + 1, 1)", col, col)
+		case TimeGrainYear:
+			return fmt.Sprintf("DATEFROMPARTS(YEAR(%s), 1, 1)", col)
+		default:
+			return fmt.Sprintf("CAST(%s AS DATE)", col)
+		}
+	case "oracle":
+		format := map[TimeGrain]string{TimeGrainWeek: "IW", TimeGrainMonth: "MM", TimeGrainQuarter: "Q", TimeGrainYear: "YYYY"}[grain]
+		if format == "" {
+			return fmt.Sprintf("TRUNC(%s)", col)
+		}
+		return fmt.Sprintf("TRUNC(%s, '%s')", col, format)
+	case "bigquery":
+		part := map[TimeGrain]string{TimeGrainWeek: "WEEK(MONDAY)", TimeGrainMonth: "MONTH", TimeGrainQuarter: "QUARTER", TimeGrainYear: "YEAR"}[grain]
+		if part == "" {
+			return fmt.Sprintf("DATE(%s)", col)
+		}
+		return fmt.Sprintf("DATE_TRUNC(DATE(%s), %s)", col, part)
+	case "sqlite":
+		switch grain {
+		case TimeGrainWeek:
+			return fmt.Sprintf("date(%s, '-6 days', 'weekday 1')", col)
+		case TimeGrainMonth:
+			return fmt.Sprintf("date(%s, 'start of month')", col)
+		case TimeGrainQuarter:
+			return fmt.Sprintf("date(%s, 'start of month', '-' || ((CAST(strftime('%%m', %s) AS INTEGER) - 1) %% 3) || ' months')", col, col)
+		case TimeGrainYear:
+			return fmt.Sprintf("date(%s, 'start of year')", col)
+		default:
+			return fmt.Sprintf("date(%s)", col)
+		}
+	default: // postgres, snowflake
+		if grain == "" {
+			grain = TimeGrainDay
+		}
+		return fmt.Sprintf("CAST(DATE_TRUNC('%s', %s) AS DATE)", string(grain), col)
+	}
+}
+
+func sqlAddMonths(d string, expr string, months int) string {
+	switch d {
+	case "mysql":
+		return fmt.Sprintf("DATE_ADD(%s, INTERVAL %d MONTH)", expr, months)
+	case "sqlserver", "snowflake":
+		return fmt.Sprintf("DATEADD(month, %d, %s)", months, expr)
+	case "oracle":
+		return fmt.Sprintf("ADD_MONTHS(%s, %d)", expr, months)
+	case "bigquery":
+		return fmt.Sprintf("DATE_ADD(DATE(%s), INTERVAL %d MONTH)", expr, months)
+	case "sqlite":
+		return fmt.Sprintf("date(%s, '%+d months')", expr, months)
+	default:
+		return fmt.Sprintf("(%s + INTERVAL '%d months')", expr, months)
+	}
+}
+
+func sqlAddDays(d string, expr string, days string) string {
+	switch d {
+	case "mysql":
+		return fmt.Sprintf("DATE_ADD(%s, INTERVAL %s DAY)", expr, days)
+	case "sqlserver", "snowflake":
+		return fmt.Sprintf("DATEADD(day, %s, %s)", days, expr)
+	case "bigquery":
+		return fmt.Sprintf("DATE_ADD(%s, INTERVAL %s DAY)", expr, days)
+	case "sqlite":
+		return fmt.Sprintf("date(%s, '+' || (%s) || ' days')", expr, days)
+	default: // postgres and oracle add integer days to dates directly
+		return fmt.Sprintf("(%s + %s)", expr, days)
+	}
+}
+
+// sqlDiffDays returns the whole days from a date literal to a column
+func sqlDiffDays(d string, col string, from string) string {
+	switch d {
+	case "mysql":
+		return fmt.Sprintf("DATEDIFF(%s, %s)", col, from)
+	case "sqlserver", "snowflake":
+		return fmt.Sprintf("DATEDIFF(day, %s, %s)", from, col)
+	case "oracle":
+		return fmt.Sprintf("(TRUNC(%s) - %s)", col, from)
+	case "bigquery":
+		return fmt.Sprintf("DATE_DIFF(DATE(%s), %s, DAY)", col, from)
+	case "sqlite":
+		return fmt.Sprintf("CAST(julianday(date(%s)) - julianday(%s) AS INTEGER)", col, from)
+	default:
+		return fmt.Sprintf("(CAST(%s AS DATE) - %s)", col, from)
+	}
+}
+
+// sqlIntDiv divides a non-negative integer expression, discarding the remainder
+func sqlIntDiv(d string, expr string, divisor int) string {
+	switch d {
+	case "mysql":
+		return fmt.Sprintf("%s DIV %d", expr, divisor)
+	case "bigquery":
+		return fmt.Sprintf("DIV(%s, %d)", expr, divisor)
+	case "oracle", "snowflake":
+		return fmt.Sprintf("FLOOR(%s / %d)", expr, divisor)
+	default:
+		return fmt.Sprintf("%s / %d", expr, divisor)
+	}
+}
+
+// periodComparison says how a period-over-period comparison finds the
+// period each period is compared with. Either the compared rows are grouped
+// by the period of their date shifted forward (shift), or the compared
+// period's key is derived from the current one (mapKey).
+type periodComparison struct {
+	shift    func(col string) string
+	mapKey   func(key string) string
+	lookback int // periods the compared rows reach back
+}
+
+// comparePeriods resolves a comparison (previous_period or previous_year)
+// in the calendar. A year back is the same period of the previous calendar
+// year: 12 months, 4 quarters or 52 weeks for month-based calendars, and
+// the same week number for week-based ones, where week 53 has no
+// counterpart.
+func (s *SemanticLayerV2Service) comparePeriods(comparison string, grain TimeGrain, dialect string, cal *WorkspaceCalendar) (*periodComparison, error) {
+	d := normalizeSQLDialect(dialect)
+	back := 1
+	switch comparison {
+	case "previous_period":
+	case "previous_year":
+		perYear := map[TimeGrain]int{TimeGrainWeek: 52, TimeGrainMonth: 12, TimeGrainQuarter: 4, TimeGrainYear: 1}[grain]
+		if perYear == 0 {
+			return nil, fmt.Errorf("previous_year comparison requires a week, month, quarter or year grain")
+		}
+		back = perYear
+	default:
+		return nil, fmt.Errorf("unknown comparison: %s", comparison)
+	}
+	cmp := &periodComparison{lookback: back}
+	if grain == TimeGrainWeek && back > 1 {
+		cmp.lookback = 53
+	}
+
+	// Custom calendars look the compared period up in the calendar table
+	if cal.calendarType() == CalendarCustom {
+		columns, err := cal.grainColumns()
+		if err == nil && columns[string(grain)] != "" {
+			col := columns[string(grain)]
+			cmp.mapKey = func(key string) string {
+				if back == 1 {
+					return fmt.Sprintf("(SELECT MAX(cal.%s) FROM %s cal WHERE cal.%s < %s)", col, cal.CustomTable, col, key)
+				}
+				return fmt.Sprintf("(SELECT MAX(cal.%s) FROM %s cal WHERE cal.%s = %s)",
+					col, cal.CustomTable, cal.CustomDateColumn, sqlAddMonths(d, key, -12))
+			}
+			return cmp, nil
+		}
+	}
+
+	switch {
+	case grain == TimeGrainDay:
+		cmp.shift = func(col string) string { return sqlAddDays(d, col, "1") }
+	case grain == TimeGrainWeek && (back == 1 || !cal.weekBased()):
+		cmp.shift = func(col string) string { return sqlAddDays(d, col, strconv.Itoa(7*back)) }
+	case grain == TimeGrainWeek:
+		cmp.shift = func(col string) string { return cal.nextYearWeekExpr(d, col) }
+	case cal.weekBased():
+		cmp.mapKey = func(key string) string { return cal.previousPeriodCaseExpr(d, grain, back, key) }
+	default:
+		// Month starts shift without overflowing into the following month
+		months := map[TimeGrain]int{TimeGrainMonth: 1, TimeGrainQuarter: 3, TimeGrainYear: 12}[grain] * back
+		if back > 1 {
+			months = 12
+		}
+		cmp.shift = func(col string) string { return sqlAddMonths(d, sqlTruncDate(d, TimeGrainMonth, col), months) }
+	}
+	return cmp, nil
+}
+
+// nextYearWeekExpr moves dates of a week-based year into the week with the
+// same number in the next year, and dates of a 53rd week to NULL
+func (c *WorkspaceCalendar) nextYearWeekExpr(d string, col string) string {
+	now := calendarNow()
+	var b strings.Builder
+	b.WriteString("CASE")
+	for year := now.Year() - calendarYearsBack - 1; year <= now.Year()+calendarYearsForward; year++ {
+		start := c.weekBasedYearStart(year, time.UTC)
+		next := c.weekBasedYearStart(year+1, time.UTC)
+		fmt.Fprintf(&b, " WHEN %s >= %s AND %s < %s THEN %s", col, sqlDateLiteral(d, start), col,
+			sqlDateLiteral(d, start.AddDate(0, 0, 52*7)), sqlAddDays(d, col, strconv.Itoa(daysBetween(start, next))))
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// previousPeriodCaseExpr maps week-based period starts, as periodCaseExpr
+// renders them, onto the start of the period n periods before
+func (c *WorkspaceCalendar) previousPeriodCaseExpr(d string, grain TimeGrain, n int, key string) string {
+	now := calendarNow()
+	first := c.weekBasedYearStart(now.Year()-calendarYearsBack, time.UTC)
+	last := c.weekBasedYearStart(now.Year()+calendarYearsForward+1, time.UTC)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "CASE %s", key)
+	for start := first; start.Before(last); start = c.AddPeriods(grain, start, 1) {
+		if previous := c.AddPeriods(grain, start, -n); !previous.Before(first) {
+			fmt.Fprintf(&b, " WHEN %s THEN %s", sqlDateLiteral(d, start), sqlDateLiteral(d, previous))
+		}
+	}
+	b.WriteString(" END")
+	return b.String()
+}
+
+// CalendarPeriodLabel formats a period start for display (e.g. "FY2026 Q1")
+func CalendarPeriodLabel(cal *WorkspaceCalendar, grain TimeGrain, start time.Time) string {
+	if cal.calendarType() == CalendarGregorian {
+		return start.Format("2006-01-02")
+	}
+
+	yearStart := cal.PeriodStart(TimeGrainYear, start)
+	year := yearStart.Year()
+	if !cal.weekBased() && cal.startMonth() != time.January {
+		year++ // fiscal years are named after the calendar year they end in
+	}
+	prefix := "FY" + strconv.Itoa(year)
+	if cal.calendarType() == CalendarISO {
+		prefix = strconv.Itoa(year)
+	}
+
+	index := 1
+	for p := yearStart; p.Before(start); p = cal.AddPeriods(grain, p, 1) {
+		index++
+	}
+
+	switch grain {
+	case TimeGrainYear:
+		return prefix
+	case TimeGrainQuarter:
+		return fmt.Sprintf("%s Q%d", prefix, index)
+	case TimeGrainMonth:
+		return fmt.Sprintf("%s P%02d", prefix, index)
+	case TimeGrainWeek:
+		return fmt.Sprintf("%s W%02d", prefix, index)
+	default:
+		return start.Format("2006-01-02")
+	}
+}
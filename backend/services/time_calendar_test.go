@@ -0,0 +1,254 @@
+package services
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func calendarDate(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestWorkspaceCalendar_PeriodStart(t *testing.T) {
+	fiscal := &WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 7}
+	nrf := &WorkspaceCalendar{Type: CalendarRetail, FiscalYearStartMonth: 2, WeekPattern: "4-4-5", WeekStartDay: 0}
+	iso := &WorkspaceCalendar{Type: CalendarISO}
+
+	tests := []struct {
+		name  string
+		cal   *WorkspaceCalendar
+		grain TimeGrain
+		at    string
+		want  string
+	}{
+		{"gregorian week is Monday based", nil, TimeGrainWeek, "2026-10-18", "2026-10-12"},
+		{"gregorian quarter", nil, TimeGrainQuarter, "2026-08-15", "2026-07-01"},
+		{"fiscal quarter", fiscal, TimeGrainQuarter, "2026-03-10", "2026-01-01"},
+		{"fiscal year before start month", fiscal, TimeGrainYear, "2026-03-10", "2025-07-01"},
+		{"fiscal year after start month", fiscal, TimeGrainYear, "2026-08-15", "2026-07-01"},
+		{"retail year", nrf, TimeGrainYear, "2026-05-01", "2026-02-01"},
+		{"retail second month", nrf, TimeGrainMonth, "2026-03-05", "2026-03-01"},
+		{"retail five-week month", nrf, TimeGrainMonth, "2026-04-30", "2026-03-29"},
+		{"retail second quarter", nrf, TimeGrainQuarter, "2026-05-03", "2026-05-03"},
+		{"retail week 53 belongs to last month", nrf, TimeGrainMonth, "2024-02-01", "2023-12-24"},
+		{"retail week starts on Sunday", nrf, TimeGrainWeek, "2026-10-17", "2026-10-11"},
+		{"iso year starts in previous December", iso, TimeGrainYear, "2027-01-01", "2025-12-29"},
+		{"iso week", iso, TimeGrainWeek, "2027-01-03", "2026-12-28"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cal.PeriodStart(tt.grain, calendarDate(tt.at))
+			assert.Equal(t, tt.want, got.Format("2006-01-02"))
+		})
+	}
+}
+
+func TestWorkspaceCalendar_AddPeriods(t *testing.T) {
+	nrf := &WorkspaceCalendar{Type: CalendarRetail, FiscalYearStartMonth: 2, WeekPattern: "4-4-5"}
+
+	// FY2023 has 53 weeks, so its last period runs five weeks plus one
+	assert.Equal(t, "2024-02-04", nrf.AddPeriods(TimeGrainMonth, calendarDate("2023-12-24"), 1).Format("2006-01-02"))
+	assert.Equal(t, "2023-12-24", nrf.AddPeriods(TimeGrainMonth, calendarDate("2024-02-04"), -1).Format("2006-01-02"))
+	assert.Equal(t, "2025-02-02", nrf.AddPeriods(TimeGrainYear, calendarDate("2024-02-04"), 1).Format("2006-01-02"))
+
+	fiscal := &WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 4}
+	start, end := fiscal.PeriodBounds(TimeGrainYear, calendarDate("2026-10-18"))
+	assert.Equal(t, "2026-04-01", start.Format("2006-01-02"))
+	assert.Equal(t, "2027-04-01", end.Format("2006-01-02"))
+	assert.Equal(t, "FY2027 Q3", CalendarPeriodLabel(fiscal, TimeGrainQuarter, fiscal.PeriodStart(TimeGrainQuarter, calendarDate("2026-10-18"))))
+}
+
+func TestKPIPeriodBounds(t *testing.T) {
+	start, end, err := kpiPeriodBounds(nil, "", calendarDate("2026-10-18"))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10-01", start.Format("2006-01-02"), "an empty trend period defaults to month")
+	assert.Equal(t, "2026-11-01", end.Format("2006-01-02"))
+
+	_, _, err = kpiPeriodBounds(nil, "fortnight", calendarDate("2026-10-18"))
+	assert.Error(t, err)
+}
+
+func TestWorkspaceCalendar_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		cal  WorkspaceCalendar
+		ok   bool
+	}{
+		{"fiscal", WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 10}, true},
+		{"bad month", WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 13}, false},
+		{"retail default pattern", WorkspaceCalendar{Type: CalendarRetail}, true},
+		{"retail bad pattern", WorkspaceCalendar{Type: CalendarRetail, WeekPattern: "3-5-5"}, false},
+		{"custom", WorkspaceCalendar{Type: CalendarCustom, CustomTable: "dim_date", CustomDateColumn: "date_key", CustomGrainColumns: `{"month":"fiscal_month_start"}`}, true},
+		{"custom without grains", WorkspaceCalendar{Type: CalendarCustom, CustomTable: "dim_date", CustomDateColumn: "date_key"}, false},
+		{"custom injection", WorkspaceCalendar{Type: CalendarCustom, CustomTable: "dim_date; DROP TABLE x", CustomDateColumn: "d", CustomGrainColumns: `{"month":"m"}`}, false},
+		{"unknown type", WorkspaceCalendar{Type: "lunar"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cal.Validate()
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestBuildCalendarTimeGroupBy_Dialects(t *testing.T) {
+	svc := NewSemanticLayerV2Service(nil)
+	fiscal := &WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 7}
+	retail := &WorkspaceCalendar{Type: CalendarRetail, FiscalYearStartMonth: 2, WeekPattern: "4-4-5"}
+	custom := &WorkspaceCalendar{Type: CalendarCustom, CustomTable: "dim_date", CustomDateColumn: "date_key", CustomGrainColumns: `{"quarter":"fiscal_quarter_start"}`}
+
+	tests := []struct {
+		dialect string
+		cal     *WorkspaceCalendar
+		grain   TimeGrain
+		want    string
+	}{
+		{"postgres", nil, TimeGrainMonth, "DATE_TRUNC('month', order_date)"},
+		{"mysql", nil, TimeGrainYear, "YEAR(order_date)"},
+		{"sqlserver", nil, TimeGrainMonth, "DATEFROMPARTS(YEAR(order_date), MONTH(order_date), 1)"},
+		{"oracle", nil, TimeGrainQuarter, "TRUNC(order_date, 'Q')"},
+		{"postgres", fiscal, TimeGrainQuarter, "(CAST(DATE_TRUNC('quarter', (order_date + INTERVAL '-6 months')) AS DATE) + INTERVAL '6 months')"},
+		{"mssql", fiscal, TimeGrainYear, "DATEADD(month, 6, DATEFROMPARTS(YEAR(DATEADD(month, -6, order_date)), 1, 1))"},
+		{"oracle", fiscal, TimeGrainYear, "ADD_MONTHS(TRUNC(ADD_MONTHS(order_date, -6), 'YYYY'), 6)"},
+		{"snowflake", fiscal, TimeGrainQuarter, "DATEADD(month, 6, CAST(DATE_TRUNC('quarter', DATEADD(month, -6, order_date)) AS DATE))"},
+		{"postgres", fiscal, TimeGrainMonth, "DATE_TRUNC('month', order_date)"},
+		{"postgres", retail, TimeGrainWeek, "(DATE '1900-01-07' + ((CAST(order_date AS DATE) - DATE '1900-01-07') / 7) * 7)"},
+		{"mysql", retail, TimeGrainWeek, "DATE_ADD(DATE '1900-01-07', INTERVAL (DATEDIFF(order_date, DATE '1900-01-07') DIV 7) * 7 DAY)"},
+		{"sqlserver", custom, TimeGrainQuarter, "(SELECT cal.fiscal_quarter_start FROM dim_date cal WHERE cal.date_key = CAST(order_date AS DATE))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dialect+"/"+string(tt.grain), func(t *testing.T) {
+			assert.Equal(t, tt.want, svc.BuildCalendarTimeGroupBy("order_date", tt.grain, tt.dialect, tt.cal))
+		})
+	}
+
+	// Week-based months are rendered as explicit period ranges
+	expr := svc.BuildCalendarTimeGroupBy("order_date", TimeGrainMonth, "postgres", retail)
+	assert.True(t, strings.HasPrefix(expr, "CASE WHEN"))
+	assert.Contains(t, expr, "WHEN order_date >= DATE '2023-12-24' AND order_date < DATE '2024-02-04' THEN DATE '2023-12-24'")
+}
+
+func TestBuildCalendarTimeFilter(t *testing.T) {
+	restore := calendarNow
+	calendarNow = func() time.Time { return calendarDate("2026-10-18") }
+	defer func() { calendarNow = restore }()
+
+	svc := NewSemanticLayerV2Service(nil)
+	fiscal := &WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 7}
+
+	assert.Equal(t, "order_date >= DATE '2026-04-01' AND order_date < DATE '2027-01-01'",
+		svc.BuildCalendarTimeFilter("order_date", TimeGrainQuarter, 3, "postgres", fiscal))
+	assert.Equal(t, "order_date >= CAST('2025-07-01' AS DATE) AND order_date < CAST('2027-07-01' AS DATE)",
+		svc.BuildCalendarTimeFilter("order_date", TimeGrainYear, 2, "sqlserver", fiscal))
+	assert.Equal(t, "order_date >= DATEADD(month, -3, GETDATE())",
+		svc.BuildCalendarTimeFilter("order_date", TimeGrainMonth, 3, "sqlserver", nil))
+
+	custom := &WorkspaceCalendar{Type: CalendarCustom, CustomTable: "dim_date", CustomDateColumn: "d", CustomGrainColumns: `{"month":"m"}`}
+	assert.Contains(t, svc.BuildCalendarTimeFilter("order_date", TimeGrainMonth, 6, "oracle", custom), "c2.m <= TRUNC(SYSDATE)) < 6)")
+}
+
+func TestTranslateV2_PeriodOverPeriod(t *testing.T) {
+	svc := NewSemanticLayerV2Service(nil)
+	model := &SemanticModelLite{
+		TableName: "sales",
+		DimMap:    map[string]string{"Region": "region"},
+		MetricMap: map[string]string{"Revenue": "SUM(amount)"},
+		Calendar:  &WorkspaceCalendar{Type: CalendarFiscal, FiscalYearStartMonth: 7},
+	}
+
+	sql, _, err := svc.TranslateV2(&SemanticQueryV2{
+		Dimensions: []string{"Region"},
+		Metrics:    []string{"Revenue"},
+		TimeColumn: "order_date",
+		TimeGrain:  TimeGrainQuarter,
+		Comparison: "previous_year",
+	}, model, "postgres")
+	require.NoError(t, err)
+	assert.Contains(t, sql, `prev."Revenue" AS "Revenue_prev"`)
+	assert.Contains(t, sql, `(CAST(DATE_TRUNC('month', order_date) AS DATE) + INTERVAL '12 months') + INTERVAL '-6 months'`, "compared rows move a fiscal year forward")
+	assert.Contains(t, sql, `prev ON prev.time_period = base.time_period AND (prev."Region" = base."Region" OR (prev."Region" IS NULL AND base."Region" IS NULL))`)
+	assert.True(t, strings.HasSuffix(sql, " ORDER BY time_period ASC LIMIT 1000"))
+
+	_, _, err = svc.TranslateV2(&SemanticQueryV2{Metrics: []string{"Revenue"}, Comparison: "previous_period"}, model, "postgres")
+	assert.Error(t, err)
+
+	// Week-based calendars map each period onto the same one a year back
+	restore := calendarNow
+	calendarNow = func() time.Time { return calendarDate("2026-10-18") }
+	defer func() { calendarNow = restore }()
+	model.Calendar = &WorkspaceCalendar{Type: CalendarRetail, WeekPattern: "4-4-5", FiscalYearStartMonth: 2}
+	sql, _, err = svc.TranslateV2(&SemanticQueryV2{
+		Metrics:    []string{"Revenue"},
+		TimeColumn: "order_date",
+		TimeGrain:  TimeGrainMonth,
+		Comparison: "previous_year",
+	}, model, "postgres")
+	require.NoError(t, err)
+	period := model.Calendar.PeriodStart(TimeGrainMonth, calendarDate("2026-10-18"))
+	assert.Contains(t, sql, "prev ON prev.time_period = CASE base.time_period WHEN ")
+	assert.Contains(t, sql, " WHEN DATE '"+period.Format("2006-01-02")+"' THEN DATE '"+model.Calendar.AddPeriods(TimeGrainMonth, period, -12).Format("2006-01-02")+"'")
+}
+
+func TestTranslateV2_PeriodOverPeriodRuns(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE sales (order_date TEXT, region TEXT, amount INTEGER)`)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for _, row := range []struct {
+		at     time.Time
+		amount int
+	}{{month, 10}, {month.AddDate(0, -2, 0), 7}, {month.AddDate(-1, 0, 0), 5}, {month.AddDate(-1, -1, 0), 3}} {
+		_, err = db.Exec(`INSERT INTO sales VALUES (?, 'EU', ?)`, row.at.Format("2006-01-02"), row.amount)
+		require.NoError(t, err)
+	}
+
+	svc := NewSemanticLayerV2Service(nil)
+	model := &SemanticModelLite{TableName: "sales", DimMap: map[string]string{"Region": "region"}, MetricMap: map[string]string{"Revenue": "SUM(amount)"}}
+	run := func(query *SemanticQueryV2) map[string][2]interface{} {
+		sqlText, args, err := svc.TranslateV2(query, model, "sqlite")
+		require.NoError(t, err)
+		rows, err := db.Query(sqlText, args...)
+		require.NoError(t, err)
+		defer rows.Close()
+		got := make(map[string][2]interface{})
+		for rows.Next() {
+			var period, region string
+			var revenue, prev, change interface{}
+			require.NoError(t, rows.Scan(&period, &region, &revenue, &prev, &change))
+			got[period] = [2]interface{}{revenue, prev}
+		}
+		require.NoError(t, rows.Err())
+		return got
+	}
+	key := func(t time.Time) string { return t.Format("2006-01-02") }
+
+	// A month without rows is compared with nothing, not the month before it
+	got := run(&SemanticQueryV2{Dimensions: []string{"Region"}, Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: TimeGrainMonth,
+		Filters: map[string]interface{}{"Region": "EU"}, Comparison: "previous_period"})
+	assert.Equal(t, [2]interface{}{int64(10), nil}, got[key(month)])
+	assert.Equal(t, [2]interface{}{int64(7), nil}, got[key(month.AddDate(0, -2, 0))])
+
+	// The compared year is read even though the time range excludes it
+	got = run(&SemanticQueryV2{Dimensions: []string{"Region"}, Metrics: []string{"Revenue"}, TimeColumn: "order_date", TimeGrain: TimeGrainMonth,
+		TimePeriods: 1, Comparison: "previous_year"})
+	assert.Equal(t, map[string][2]interface{}{key(month): {int64(10), int64(5)}}, got)
+}
@@ -122,6 +122,30 @@ func main() {
 	}
 	fmt.Println("QualityRule migration success!")
 
+	err = db.AutoMigrate(&models.QualityScorecard{})
+	if err != nil {
+		log.Fatal("Failed to migrate QualityScorecard:", err)
+	}
+	fmt.Println("QualityScorecard migration success!")
+
+	err = db.AutoMigrate(&models.PipelineDependency{})
+	if err != nil {
+		log.Fatal("Failed to migrate PipelineDependency:", err)
+	}
+	fmt.Println("PipelineDependency migration success!")
+
+	err = db.AutoMigrate(&models.PipelineBackfill{}, &models.PipelineBackfillChunk{})
+	if err != nil {
+		log.Fatal("Failed to migrate PipelineBackfill:", err)
+	}
+	fmt.Println("PipelineBackfill migration success!")
+
+	err = db.AutoMigrate(&models.Extract{})
+	if err != nil {
+		log.Fatal("Failed to migrate Extract:", err)
+	}
+	fmt.Println("Extract migration success!")
+
 	// Webhooks
 	err = db.AutoMigrate(&models.WebhookConfig{})
 	if err != nil {
@@ -6,6 +6,7 @@ import {
     type SemanticQueryRequest,
     type SemanticQueryResponse
 } from '@/types/semantic';
+import type { AutocompleteRequest, AutocompleteResponse } from '@/lib/types/semantic';
 import { fetchWithAuth } from '@/lib/utils';
 
 const BASE_URL = '/api/go/semantic';
@@ -58,4 +59,18 @@ export const semanticApi = {
         method: 'POST',
         body: JSON.stringify(data),
     }),
+
+    // Formula autocomplete: built-in and workspace user-defined functions
+    formulaAutocomplete: async (data: AutocompleteRequest): Promise<AutocompleteResponse> => {
+        const res = await fetchWithAuth('/api/go/formulas/autocomplete', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(data),
+        });
+        if (!res.ok) {
+            const errorData = await res.json().catch(() => ({}));
+            throw new Error(errorData.error || `API Error: ${res.statusText}`);
+        }
+        return res.json();
+    },
 };